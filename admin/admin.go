@@ -0,0 +1,198 @@
+/*
+ * Copyright (c) 2018 Miguel Ángel Ortuño.
+ * See the LICENSE file for more information.
+ */
+
+package admin
+
+import (
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"net"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/ortuman/jackal/log"
+	"github.com/ortuman/jackal/module"
+	"github.com/ortuman/jackal/router"
+	"github.com/ortuman/jackal/storage"
+	"github.com/ortuman/jackal/xmpp/jid"
+)
+
+const maxRequestBodySize = 1 << 20
+
+var listenerProvider = net.Listen
+
+// Server represents an authenticated admin HTTP API server.
+type Server struct {
+	cfg    *Config
+	mods   *module.Modules
+	router *router.Router
+	srv    *http.Server
+}
+
+type errorResponse struct {
+	Error string `json:"error"`
+}
+
+// New returns a new admin HTTP API server instance.
+func New(config *Config, mods *module.Modules, router *router.Router) *Server {
+	s := &Server{cfg: config, mods: mods, router: router}
+	s.srv = &http.Server{Handler: s}
+	return s
+}
+
+// Start starts serving admin HTTP API requests.
+func (s *Server) Start() {
+	go s.start()
+}
+
+func (s *Server) start() {
+	address := s.cfg.BindAddress + ":" + strconv.Itoa(s.cfg.Port)
+
+	ln, err := listenerProvider("tcp", address)
+	if err != nil {
+		log.Fatalf("%v", err)
+		return
+	}
+	log.Infof("admin: listening at %s", address)
+
+	if err := s.srv.Serve(ln); err != nil && err != http.ErrServerClosed {
+		log.Error(err)
+	}
+}
+
+// Shutdown gracefully shuts down admin HTTP API server.
+func (s *Server) Shutdown(ctx context.Context) error {
+	return s.srv.Shutdown(ctx)
+}
+
+// ServeHTTP satisfies http.Handler interface.
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if !s.isAuthorized(r) {
+		w.Header().Set("WWW-Authenticate", `Bearer realm="jackal"`)
+		writeError(w, http.StatusUnauthorized, "unauthorized")
+		return
+	}
+	r.Body = http.MaxBytesReader(w, r.Body, maxRequestBodySize)
+
+	segments, err := pathSegments(r.URL)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	switch {
+	case len(segments) == 1 && segments[0] == "users":
+		s.handleUsers(w, r)
+	case len(segments) == 1 && segments[0] == "sessions":
+		s.handleSessions(w, r)
+	case len(segments) == 1 && segments[0] == "messages":
+		s.handleMessages(w, r)
+	case len(segments) >= 2 && segments[0] == "users":
+		s.handleUser(w, r, segments[1], segments[2:])
+	default:
+		writeError(w, http.StatusNotFound, "not found")
+	}
+}
+
+func (s *Server) handleUser(w http.ResponseWriter, r *http.Request, username string, segments []string) {
+	userJID, err := s.userJID(username)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "malformed username")
+		return
+	}
+	username = userJID.Node()
+
+	exists, err := storage.UserExists(username)
+	if err != nil {
+		log.Error(err)
+		writeError(w, http.StatusInternalServerError, "internal server error")
+		return
+	}
+	if !exists {
+		writeError(w, http.StatusNotFound, "user not found")
+		return
+	}
+	switch {
+	case len(segments) == 0:
+		s.handleDeleteUser(w, r, username)
+	case len(segments) == 1 && segments[0] == "password":
+		s.handlePassword(w, r, username)
+	case len(segments) <= 2 && segments[0] == "sessions":
+		s.handleUserSessions(w, r, username, segments[1:])
+	case len(segments) <= 2 && segments[0] == "roster":
+		s.handleRoster(w, r, username, segments[1:])
+	case len(segments) <= 2 && segments[0] == "blocklist":
+		s.handleBlockList(w, r, username, segments[1:])
+	default:
+		writeError(w, http.StatusNotFound, "not found")
+	}
+}
+
+func (s *Server) isAuthorized(r *http.Request) bool {
+	const prefix = "Bearer "
+	authorization := r.Header.Get("Authorization")
+	if !strings.HasPrefix(authorization, prefix) {
+		return false
+	}
+	token := authorization[len(prefix):]
+	return subtle.ConstantTimeCompare([]byte(token), []byte(s.cfg.Token)) == 1
+}
+
+// domain returns the domain used to compose local user JIDs.
+func (s *Server) domain() string {
+	if len(s.cfg.Domain) > 0 {
+		return s.cfg.Domain
+	}
+	hosts := s.router.HostNames()
+	sort.Strings(hosts)
+	return hosts[0]
+}
+
+func (s *Server) userJID(username string) (*jid.JID, error) {
+	return jid.New(username, s.domain(), "", false)
+}
+
+func pathSegments(u *url.URL) ([]string, error) {
+	var segments []string
+	for _, seg := range strings.Split(strings.Trim(u.EscapedPath(), "/"), "/") {
+		if len(seg) == 0 {
+			continue
+		}
+		unescaped, err := url.PathUnescape(seg)
+		if err != nil {
+			return nil, err
+		}
+		segments = append(segments, unescaped)
+	}
+	return segments, nil
+}
+
+func readJSON(w http.ResponseWriter, r *http.Request, v interface{}) bool {
+	if err := json.NewDecoder(r.Body).Decode(v); err != nil {
+		writeError(w, http.StatusBadRequest, "malformed request body")
+		return false
+	}
+	return true
+}
+
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		log.Error(err)
+	}
+}
+
+func writeError(w http.ResponseWriter, status int, reason string) {
+	writeJSON(w, status, &errorResponse{Error: reason})
+}
+
+func writeMethodNotAllowed(w http.ResponseWriter, allowed ...string) {
+	w.Header().Set("Allow", strings.Join(allowed, ", "))
+	writeError(w, http.StatusMethodNotAllowed, "method not allowed")
+}
@@ -0,0 +1,143 @@
+/*
+ * Copyright (c) 2018 Miguel Ángel Ortuño.
+ * See the LICENSE file for more information.
+ */
+
+package admin
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"encoding/json"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/ortuman/jackal/module"
+	"github.com/ortuman/jackal/router"
+	"github.com/ortuman/jackal/storage"
+	"github.com/ortuman/jackal/storage/memstorage"
+	"github.com/stretchr/testify/require"
+)
+
+const testToken = "s3cr3t"
+
+func TestServer_Authorization(t *testing.T) {
+	srv, _, shutdown := setupTest("jackal.im")
+	defer shutdown()
+
+	req := httptest.NewRequest(http.MethodGet, "/users", nil)
+	rec := httptest.NewRecorder()
+	srv.ServeHTTP(rec, req)
+	require.Equal(t, http.StatusUnauthorized, rec.Code)
+	require.Equal(t, `Bearer realm="jackal"`, rec.Header().Get("WWW-Authenticate"))
+
+	req = httptest.NewRequest(http.MethodGet, "/users", nil)
+	req.Header.Set("Authorization", "Bearer foo")
+	rec = httptest.NewRecorder()
+	srv.ServeHTTP(rec, req)
+	require.Equal(t, http.StatusUnauthorized, rec.Code)
+
+	req = httptest.NewRequest(http.MethodGet, "/users", nil)
+	req.SetBasicAuth("admin", testToken)
+	rec = httptest.NewRecorder()
+	srv.ServeHTTP(rec, req)
+	require.Equal(t, http.StatusUnauthorized, rec.Code)
+
+	rec = doRequest(srv, http.MethodGet, "/users", nil)
+	require.Equal(t, http.StatusOK, rec.Code)
+}
+
+func TestServer_Routing(t *testing.T) {
+	srv, s, shutdown := setupTest("jackal.im")
+	defer shutdown()
+
+	rec := doRequest(srv, http.MethodGet, "/foo", nil)
+	require.Equal(t, http.StatusNotFound, rec.Code)
+
+	rec = doRequest(srv, http.MethodGet, "/users/ortuman", nil)
+	require.Equal(t, http.StatusNotFound, rec.Code)
+
+	createTestUser(t, srv, "ortuman", "1234")
+
+	rec = doRequest(srv, http.MethodGet, "/users/ortuman", nil)
+	require.Equal(t, http.StatusMethodNotAllowed, rec.Code)
+	require.Equal(t, http.MethodDelete, rec.Header().Get("Allow"))
+
+	rec = doRequest(srv, http.MethodGet, "/users/ortuman/foo", nil)
+	require.Equal(t, http.StatusNotFound, rec.Code)
+
+	rec = doRequest(srv, http.MethodPut, "/users", nil)
+	require.Equal(t, http.StatusMethodNotAllowed, rec.Code)
+
+	s.EnableMockedError()
+	rec = doRequest(srv, http.MethodGet, "/users/ortuman/roster", nil)
+	require.Equal(t, http.StatusInternalServerError, rec.Code)
+	s.DisableMockedError()
+}
+
+func TestServer_Domain(t *testing.T) {
+	srv, _, shutdown := setupTest("jackal.im")
+	defer shutdown()
+
+	require.Equal(t, "jackal.im", srv.domain())
+
+	srv.cfg.Domain = "jabber.org"
+	require.Equal(t, "jabber.org", srv.domain())
+}
+
+func TestServer_StartAndShutdown(t *testing.T) {
+	srv, _, shutdown := setupTest("jackal.im")
+	defer shutdown()
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	require.Nil(t, err)
+
+	listenerProvider = func(network, address string) (net.Listener, error) { return ln, nil }
+	defer func() { listenerProvider = net.Listen }()
+
+	srv.Start()
+	time.Sleep(time.Millisecond * 100) // wait until serving...
+
+	req, _ := http.NewRequest(http.MethodGet, "http://"+ln.Addr().String()+"/users", nil)
+	req.Header.Set("Authorization", "Bearer "+testToken)
+	resp, err := http.DefaultClient.Do(req)
+	require.Nil(t, err)
+	_ = resp.Body.Close()
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+
+	require.Nil(t, srv.Shutdown(context.Background()))
+}
+
+func setupTest(domain string) (*Server, *memstorage.Storage, func()) {
+	r, _ := router.New(&router.Config{
+		Hosts: []router.HostConfig{{Name: domain, Certificate: tls.Certificate{}}},
+	})
+	s := memstorage.New()
+	storage.Set(s)
+
+	srv := New(&Config{Token: testToken}, &module.Modules{}, r)
+	return srv, s, func() {
+		storage.Unset()
+	}
+}
+
+func doRequest(srv *Server, method, target string, body interface{}) *httptest.ResponseRecorder {
+	var buf bytes.Buffer
+	if body != nil {
+		_ = json.NewEncoder(&buf).Encode(body)
+	}
+	req := httptest.NewRequest(method, target, &buf)
+	req.Header.Set("Authorization", "Bearer "+testToken)
+	rec := httptest.NewRecorder()
+	srv.ServeHTTP(rec, req)
+	return rec
+}
+
+func createTestUser(t *testing.T, srv *Server, username, password string) {
+	rec := doRequest(srv, http.MethodPost, "/users", &createUserRequest{Username: username, Password: password})
+	require.Equal(t, http.StatusCreated, rec.Code)
+}
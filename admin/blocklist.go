@@ -0,0 +1,98 @@
+/*
+ * Copyright (c) 2018 Miguel Ángel Ortuño.
+ * See the LICENSE file for more information.
+ */
+
+package admin
+
+import (
+	"net/http"
+
+	"github.com/ortuman/jackal/log"
+	"github.com/ortuman/jackal/storage"
+	"github.com/ortuman/jackal/xmpp/jid"
+)
+
+type blockListResponse struct {
+	Items []string `json:"items"`
+}
+
+func (s *Server) handleBlockList(w http.ResponseWriter, r *http.Request, username string, segments []string) {
+	if len(segments) == 1 {
+		s.handleBlockListItem(w, r, username, segments[0])
+		return
+	}
+	switch r.Method {
+	case http.MethodGet:
+		blItems, err := storage.FetchBlockListItems(username)
+		if err != nil {
+			log.Error(err)
+			writeError(w, http.StatusInternalServerError, "internal server error")
+			return
+		}
+		resp := blockListResponse{Items: []string{}}
+		for _, blItem := range blItems {
+			resp.Items = append(resp.Items, blItem.JID)
+		}
+		writeJSON(w, http.StatusOK, &resp)
+
+	case http.MethodDelete:
+		// clear the whole block list
+		s.unblock(w, username, nil)
+
+	default:
+		writeMethodNotAllowed(w, http.MethodGet, http.MethodDelete)
+	}
+}
+
+func (s *Server) handleBlockListItem(w http.ResponseWriter, r *http.Request, username, item string) {
+	j, err := jid.NewWithString(item, false)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "malformed jid")
+		return
+	}
+	switch r.Method {
+	case http.MethodPut:
+		s.block(w, username, j)
+	case http.MethodDelete:
+		s.unblock(w, username, []*jid.JID{j})
+	default:
+		writeMethodNotAllowed(w, http.MethodPut, http.MethodDelete)
+	}
+}
+
+func (s *Server) block(w http.ResponseWriter, username string, j *jid.JID) {
+	if s.mods.BlockingCmd == nil {
+		writeError(w, http.StatusNotImplemented, "blocking command module is disabled")
+		return
+	}
+	userJID, err := s.userJID(username)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "malformed username")
+		return
+	}
+	if err := s.mods.BlockingCmd.Block(userJID, []*jid.JID{j}); err != nil {
+		log.Error(err)
+		writeError(w, http.StatusInternalServerError, "internal server error")
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (s *Server) unblock(w http.ResponseWriter, username string, jds []*jid.JID) {
+	if s.mods.BlockingCmd == nil {
+		writeError(w, http.StatusNotImplemented, "blocking command module is disabled")
+		return
+	}
+	userJID, err := s.userJID(username)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "malformed username")
+		return
+	}
+	if err := s.mods.BlockingCmd.Unblock(userJID, jds); err != nil {
+		log.Error(err)
+		writeError(w, http.StatusInternalServerError, "internal server error")
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
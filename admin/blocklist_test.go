@@ -0,0 +1,60 @@
+/*
+ * Copyright (c) 2018 Miguel Ángel Ortuño.
+ * See the LICENSE file for more information.
+ */
+
+package admin
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+
+	"github.com/ortuman/jackal/module/xep0191"
+	"github.com/ortuman/jackal/xmpp/jid"
+	"github.com/stretchr/testify/require"
+)
+
+func TestBlockList_ListAndEdit(t *testing.T) {
+	srv, _, shutdown := setupTest("jackal.im")
+	defer shutdown()
+
+	createTestUser(t, srv, "ortuman", "1234")
+
+	// blocking command module disabled
+	rec := doRequest(srv, http.MethodPut, "/users/ortuman/blocklist/romeo@jackal.im", nil)
+	require.Equal(t, http.StatusNotImplemented, rec.Code)
+
+	srv.mods.BlockingCmd = xep0191.New(nil, nil, srv.router)
+	defer srv.mods.BlockingCmd.Shutdown()
+
+	rec = doRequest(srv, http.MethodPut, "/users/ortuman/blocklist/romeo@jackal.im", nil)
+	require.Equal(t, http.StatusNoContent, rec.Code)
+	rec = doRequest(srv, http.MethodPut, "/users/ortuman/blocklist/jabber.org", nil)
+	require.Equal(t, http.StatusNoContent, rec.Code)
+
+	romeo, _ := jid.NewWithString("romeo@jackal.im/garden", true)
+	require.True(t, srv.router.IsBlockedJID(romeo, "ortuman"))
+
+	rec = doRequest(srv, http.MethodGet, "/users/ortuman/blocklist", nil)
+	require.Equal(t, http.StatusOK, rec.Code)
+
+	var resp blockListResponse
+	require.Nil(t, json.NewDecoder(rec.Body).Decode(&resp))
+	require.Equal(t, 2, len(resp.Items))
+
+	rec = doRequest(srv, http.MethodDelete, "/users/ortuman/blocklist/romeo@jackal.im", nil)
+	require.Equal(t, http.StatusNoContent, rec.Code)
+	require.False(t, srv.router.IsBlockedJID(romeo, "ortuman"))
+
+	rec = doRequest(srv, http.MethodDelete, "/users/ortuman/blocklist", nil)
+	require.Equal(t, http.StatusNoContent, rec.Code)
+
+	rec = doRequest(srv, http.MethodGet, "/users/ortuman/blocklist", nil)
+	resp = blockListResponse{}
+	require.Nil(t, json.NewDecoder(rec.Body).Decode(&resp))
+	require.Equal(t, 0, len(resp.Items))
+
+	rec = doRequest(srv, http.MethodPost, "/users/ortuman/blocklist", nil)
+	require.Equal(t, http.StatusMethodNotAllowed, rec.Code)
+}
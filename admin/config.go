@@ -0,0 +1,52 @@
+/*
+ * Copyright (c) 2018 Miguel Ángel Ortuño.
+ * See the LICENSE file for more information.
+ */
+
+package admin
+
+import (
+	"github.com/pkg/errors"
+)
+
+const (
+	defaultBindAddress = "127.0.0.1"
+	defaultPort        = 9090
+)
+
+// Config represents admin HTTP API configuration.
+type Config struct {
+	BindAddress string
+	Port        int
+	Token       string
+	Domain      string
+}
+
+type configProxy struct {
+	BindAddress string `yaml:"bind_addr"`
+	Port        int    `yaml:"port"`
+	Token       string `yaml:"token"`
+	Domain      string `yaml:"domain"`
+}
+
+// UnmarshalYAML satisfies Unmarshaler interface.
+func (c *Config) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	p := configProxy{}
+	if err := unmarshal(&p); err != nil {
+		return err
+	}
+	c.BindAddress = p.BindAddress
+	if len(c.BindAddress) == 0 {
+		c.BindAddress = defaultBindAddress
+	}
+	c.Port = p.Port
+	if c.Port == 0 {
+		c.Port = defaultPort
+	}
+	if len(p.Token) == 0 {
+		return errors.New("admin.Config: token must be specified")
+	}
+	c.Token = p.Token
+	c.Domain = p.Domain
+	return nil
+}
@@ -0,0 +1,35 @@
+/*
+ * Copyright (c) 2018 Miguel Ángel Ortuño.
+ * See the LICENSE file for more information.
+ */
+
+package admin
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	yaml "gopkg.in/yaml.v2"
+)
+
+func TestConfig(t *testing.T) {
+	cfg := Config{}
+	require.NotNil(t, yaml.Unmarshal([]byte(`port: 9090`), &cfg))
+	require.NotNil(t, yaml.Unmarshal([]byte(`port: [9090]`), &cfg))
+
+	require.Nil(t, yaml.Unmarshal([]byte(`token: s3cr3t`), &cfg))
+	require.Equal(t, defaultBindAddress, cfg.BindAddress)
+	require.Equal(t, defaultPort, cfg.Port)
+	require.Equal(t, "s3cr3t", cfg.Token)
+	require.Equal(t, "", cfg.Domain)
+
+	require.Nil(t, yaml.Unmarshal([]byte(`
+bind_addr: 0.0.0.0
+port: 8080
+token: s3cr3t
+domain: jackal.im
+`), &cfg))
+	require.Equal(t, "0.0.0.0", cfg.BindAddress)
+	require.Equal(t, 8080, cfg.Port)
+	require.Equal(t, "jackal.im", cfg.Domain)
+}
@@ -0,0 +1,116 @@
+/*
+ * Copyright (c) 2018 Miguel Ángel Ortuño.
+ * See the LICENSE file for more information.
+ */
+
+package admin
+
+import (
+	"net/http"
+
+	"github.com/ortuman/jackal/log"
+	"github.com/ortuman/jackal/router"
+	"github.com/ortuman/jackal/xmpp"
+	"github.com/ortuman/jackal/xmpp/jid"
+	"github.com/pborman/uuid"
+	"github.com/pkg/errors"
+)
+
+var (
+	errMissingRecipient   = errors.New("admin: message recipient must be specified")
+	errInvalidMessageType = errors.New("admin: invalid message type")
+)
+
+type messageRequest struct {
+	From    string `json:"from"`
+	To      string `json:"to"`
+	Type    string `json:"type"`
+	Subject string `json:"subject"`
+	Body    string `json:"body"`
+}
+
+type messageResponse struct {
+	ID      string `json:"id"`
+	Offline bool   `json:"offline"`
+}
+
+func (s *Server) handleMessages(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		writeMethodNotAllowed(w, http.MethodPost)
+		return
+	}
+	var req messageRequest
+	if !readJSON(w, r, &req) {
+		return
+	}
+	msg, err := s.messageFromRequest(&req)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	err = s.router.Route(msg)
+	if err == router.ErrResourceNotFound {
+		// treat the stanza as if it were addressed to <node@domain>
+		msg, _ = xmpp.NewMessageFromElement(msg, msg.FromJID(), msg.ToJID().ToBareJID())
+		err = s.router.Route(msg)
+	}
+	switch err {
+	case nil:
+		writeJSON(w, http.StatusOK, &messageResponse{ID: msg.ID()})
+	case router.ErrNotAuthenticated:
+		if off := s.mods.Offline; off != nil {
+			off.ArchiveMessage(msg)
+			writeJSON(w, http.StatusAccepted, &messageResponse{ID: msg.ID(), Offline: true})
+			return
+		}
+		writeError(w, http.StatusServiceUnavailable, "recipient is not available")
+	case router.ErrNotExistingAccount:
+		writeError(w, http.StatusNotFound, "recipient account does not exist")
+	case router.ErrBlockedJID:
+		writeError(w, http.StatusForbidden, "recipient blocked sender")
+	case router.ErrFailedRemoteConnect:
+		writeError(w, http.StatusBadGateway, "remote server not found")
+	default:
+		log.Error(err)
+		writeError(w, http.StatusInternalServerError, "internal server error")
+	}
+}
+
+func (s *Server) messageFromRequest(req *messageRequest) (*xmpp.Message, error) {
+	if len(req.To) == 0 {
+		return nil, errMissingRecipient
+	}
+	toJID, err := jid.NewWithString(req.To, false)
+	if err != nil {
+		return nil, err
+	}
+	var fromJID *jid.JID
+	if len(req.From) > 0 {
+		fromJID, err = jid.NewWithString(req.From, false)
+	} else {
+		fromJID, err = jid.New("", s.domain(), "", true)
+	}
+	if err != nil {
+		return nil, err
+	}
+	msgType := req.Type
+	switch msgType {
+	case "":
+		msgType = xmpp.ChatType
+	case xmpp.NormalType, xmpp.HeadlineType, xmpp.ChatType:
+	default:
+		return nil, errInvalidMessageType
+	}
+	msg := xmpp.NewMessageType(uuid.New(), msgType)
+	msg.SetFromJID(fromJID)
+	msg.SetToJID(toJID)
+	if len(req.Subject) > 0 {
+		subject := xmpp.NewElementName("subject")
+		subject.SetText(req.Subject)
+		msg.AppendElement(subject)
+	}
+	body := xmpp.NewElementName("body")
+	body.SetText(req.Body)
+	msg.AppendElement(body)
+	return msg, nil
+}
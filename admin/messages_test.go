@@ -0,0 +1,89 @@
+/*
+ * Copyright (c) 2018 Miguel Ángel Ortuño.
+ * See the LICENSE file for more information.
+ */
+
+package admin
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+
+	"github.com/ortuman/jackal/module/offline"
+	"github.com/ortuman/jackal/storage"
+	"github.com/ortuman/jackal/stream"
+	"github.com/ortuman/jackal/xmpp/jid"
+	"github.com/pborman/uuid"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMessages_Send(t *testing.T) {
+	srv, _, shutdown := setupTest("jackal.im")
+	defer shutdown()
+
+	createTestUser(t, srv, "ortuman", "1234")
+
+	rec := doRequest(srv, http.MethodGet, "/messages", nil)
+	require.Equal(t, http.StatusMethodNotAllowed, rec.Code)
+
+	rec = doRequest(srv, http.MethodPost, "/messages", &messageRequest{Body: "Hi!"})
+	require.Equal(t, http.StatusBadRequest, rec.Code)
+
+	rec = doRequest(srv, http.MethodPost, "/messages", &messageRequest{To: "ortuman@jackal.im", Type: "groupchat", Body: "Hi!"})
+	require.Equal(t, http.StatusBadRequest, rec.Code)
+
+	rec = doRequest(srv, http.MethodPost, "/messages", &messageRequest{To: "romeo@jackal.im", Body: "Hi!"})
+	require.Equal(t, http.StatusNotFound, rec.Code)
+
+	// offline module disabled
+	rec = doRequest(srv, http.MethodPost, "/messages", &messageRequest{To: "ortuman@jackal.im", Body: "Hi!"})
+	require.Equal(t, http.StatusServiceUnavailable, rec.Code)
+
+	j, _ := jid.New("ortuman", "jackal.im", "balcony", true)
+	stm := stream.NewMockC2S(uuid.New(), j)
+	stm.SetAuthenticated(true)
+	srv.router.Bind(stm)
+
+	rec = doRequest(srv, http.MethodPost, "/messages", &messageRequest{
+		To:      "ortuman@jackal.im/yard",
+		Type:    "headline",
+		Subject: "Maintenance",
+		Body:    "Server will restart in 5 minutes",
+	})
+	require.Equal(t, http.StatusOK, rec.Code)
+
+	var resp messageResponse
+	require.Nil(t, json.NewDecoder(rec.Body).Decode(&resp))
+	require.False(t, resp.Offline)
+
+	elem := stm.ReceiveElement()
+	require.Equal(t, "message", elem.Name())
+	require.Equal(t, resp.ID, elem.ID())
+	require.Equal(t, "headline", elem.Type())
+	require.Equal(t, "jackal.im", elem.From())
+	require.Equal(t, "ortuman@jackal.im", elem.To())
+	require.Equal(t, "Maintenance", elem.Elements().Child("subject").Text())
+	require.Equal(t, "Server will restart in 5 minutes", elem.Elements().Child("body").Text())
+}
+
+func TestMessages_SendOffline(t *testing.T) {
+	srv, _, shutdown := setupTest("jackal.im")
+	defer shutdown()
+
+	createTestUser(t, srv, "ortuman", "1234")
+
+	srv.mods.Offline = offline.New(&offline.Config{QueueSize: 10}, nil, srv.router)
+
+	rec := doRequest(srv, http.MethodPost, "/messages", &messageRequest{From: "noelia@jackal.im/yard", To: "ortuman@jackal.im", Body: "Hi!"})
+	require.Equal(t, http.StatusAccepted, rec.Code)
+
+	var resp messageResponse
+	require.Nil(t, json.NewDecoder(rec.Body).Decode(&resp))
+	require.True(t, resp.Offline)
+
+	require.Nil(t, srv.mods.Offline.Shutdown()) // wait until archived...
+
+	count, _ := storage.CountOfflineMessages("ortuman")
+	require.Equal(t, 1, count)
+}
@@ -0,0 +1,114 @@
+/*
+ * Copyright (c) 2018 Miguel Ángel Ortuño.
+ * See the LICENSE file for more information.
+ */
+
+package admin
+
+import (
+	"net/http"
+
+	"github.com/ortuman/jackal/log"
+	"github.com/ortuman/jackal/model/rostermodel"
+	"github.com/ortuman/jackal/storage"
+	"github.com/ortuman/jackal/xmpp/jid"
+)
+
+type rosterItemResponse struct {
+	JID          string   `json:"jid"`
+	Name         string   `json:"name,omitempty"`
+	Subscription string   `json:"subscription"`
+	Ask          bool     `json:"ask"`
+	Groups       []string `json:"groups,omitempty"`
+}
+
+type rosterResponse struct {
+	Items []rosterItemResponse `json:"items"`
+}
+
+type rosterItemRequest struct {
+	Name   string   `json:"name"`
+	Groups []string `json:"groups"`
+}
+
+func (s *Server) handleRoster(w http.ResponseWriter, r *http.Request, username string, segments []string) {
+	if len(segments) == 1 {
+		s.handleRosterItem(w, r, username, segments[0])
+		return
+	}
+	if r.Method != http.MethodGet {
+		writeMethodNotAllowed(w, http.MethodGet)
+		return
+	}
+	ris, _, err := storage.FetchRosterItems(username)
+	if err != nil {
+		log.Error(err)
+		writeError(w, http.StatusInternalServerError, "internal server error")
+		return
+	}
+	resp := rosterResponse{Items: []rosterItemResponse{}}
+	for _, ri := range ris {
+		resp.Items = append(resp.Items, rosterItemResponse{
+			JID:          ri.JID,
+			Name:         ri.Name,
+			Subscription: ri.Subscription,
+			Ask:          ri.Ask,
+			Groups:       ri.Groups,
+		})
+	}
+	writeJSON(w, http.StatusOK, &resp)
+}
+
+func (s *Server) handleRosterItem(w http.ResponseWriter, r *http.Request, username, contact string) {
+	if r.Method != http.MethodPut && r.Method != http.MethodDelete {
+		writeMethodNotAllowed(w, http.MethodPut, http.MethodDelete)
+		return
+	}
+	if s.mods.Roster == nil {
+		writeError(w, http.StatusNotImplemented, "roster module is disabled")
+		return
+	}
+	userJID, contactJID, ok := s.userAndContactJIDs(w, username, contact)
+	if !ok {
+		return
+	}
+	switch r.Method {
+	case http.MethodPut:
+		var req rosterItemRequest
+		if !readJSON(w, r, &req) {
+			return
+		}
+		ri := rostermodel.Item{
+			Username: username,
+			JID:      contactJID.String(),
+			Name:     req.Name,
+			Groups:   req.Groups,
+		}
+		if err := s.mods.Roster.UpdateItem(userJID, &ri); err != nil {
+			log.Error(err)
+			writeError(w, http.StatusInternalServerError, "internal server error")
+			return
+		}
+	case http.MethodDelete:
+		if err := s.mods.Roster.RemoveItem(userJID, contactJID); err != nil {
+			log.Error(err)
+			writeError(w, http.StatusInternalServerError, "internal server error")
+			return
+		}
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (s *Server) userAndContactJIDs(w http.ResponseWriter, username, contact string) (*jid.JID, *jid.JID, bool) {
+	userJID, err := s.userJID(username)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "malformed username")
+		return nil, nil, false
+	}
+	contactJID, err := jid.NewWithString(contact, false)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "malformed contact jid")
+		return nil, nil, false
+	}
+	return userJID, contactJID.ToBareJID(), true
+}
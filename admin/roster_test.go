@@ -0,0 +1,58 @@
+/*
+ * Copyright (c) 2018 Miguel Ángel Ortuño.
+ * See the LICENSE file for more information.
+ */
+
+package admin
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+
+	"github.com/ortuman/jackal/model/rostermodel"
+	"github.com/ortuman/jackal/module/roster"
+	"github.com/ortuman/jackal/storage"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRoster_ListAndEdit(t *testing.T) {
+	srv, _, shutdown := setupTest("jackal.im")
+	defer shutdown()
+
+	createTestUser(t, srv, "ortuman", "1234")
+
+	// roster module disabled
+	rec := doRequest(srv, http.MethodPut, "/users/ortuman/roster/noelia@jackal.im", &rosterItemRequest{Name: "My Juliet"})
+	require.Equal(t, http.StatusNotImplemented, rec.Code)
+
+	srv.mods.Roster = roster.New(&roster.Config{}, srv.router)
+	defer srv.mods.Roster.Shutdown()
+
+	rec = doRequest(srv, http.MethodPut, "/users/ortuman/roster/noelia@jackal.im%2Fyard", &rosterItemRequest{
+		Name:   "My Juliet",
+		Groups: []string{"friends"},
+	})
+	require.Equal(t, http.StatusNoContent, rec.Code)
+
+	rec = doRequest(srv, http.MethodGet, "/users/ortuman/roster", nil)
+	require.Equal(t, http.StatusOK, rec.Code)
+
+	var resp rosterResponse
+	require.Nil(t, json.NewDecoder(rec.Body).Decode(&resp))
+	require.Equal(t, []rosterItemResponse{{
+		JID:          "noelia@jackal.im",
+		Name:         "My Juliet",
+		Subscription: rostermodel.SubscriptionNone,
+		Groups:       []string{"friends"},
+	}}, resp.Items)
+
+	rec = doRequest(srv, http.MethodPost, "/users/ortuman/roster/noelia@jackal.im", nil)
+	require.Equal(t, http.StatusMethodNotAllowed, rec.Code)
+
+	rec = doRequest(srv, http.MethodDelete, "/users/ortuman/roster/noelia@jackal.im", nil)
+	require.Equal(t, http.StatusNoContent, rec.Code)
+
+	ris, _, _ := storage.FetchRosterItems("ortuman")
+	require.Equal(t, 0, len(ris))
+}
@@ -0,0 +1,122 @@
+/*
+ * Copyright (c) 2018 Miguel Ángel Ortuño.
+ * See the LICENSE file for more information.
+ */
+
+package admin
+
+import (
+	"net/http"
+
+	"github.com/ortuman/jackal/cluster"
+	streamerror "github.com/ortuman/jackal/errors"
+	"github.com/ortuman/jackal/log"
+	"github.com/ortuman/jackal/storage"
+	"github.com/ortuman/jackal/stream"
+)
+
+type presenceResponse struct {
+	Type     string `json:"type"`
+	Show     string `json:"show,omitempty"`
+	Status   string `json:"status,omitempty"`
+	Priority int8   `json:"priority"`
+}
+
+type sessionResponse struct {
+	JID           string            `json:"jid"`
+	Resource      string            `json:"resource"`
+	Presence      *presenceResponse `json:"presence,omitempty"`
+	Secured       bool              `json:"secured"`
+	Authenticated bool              `json:"authenticated"`
+	Node          string            `json:"node,omitempty"`
+}
+
+type sessionsResponse struct {
+	Sessions []sessionResponse `json:"sessions"`
+}
+
+func (s *Server) handleSessions(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		writeMethodNotAllowed(w, http.MethodGet)
+		return
+	}
+	usernames, err := storage.FetchUsernames()
+	if err != nil {
+		log.Error(err)
+		writeError(w, http.StatusInternalServerError, "internal server error")
+		return
+	}
+	resp := sessionsResponse{Sessions: []sessionResponse{}}
+	for _, username := range usernames {
+		for _, stm := range s.router.UserStreams(username) {
+			resp.Sessions = append(resp.Sessions, s.sessionResponse(stm))
+		}
+	}
+	writeJSON(w, http.StatusOK, &resp)
+}
+
+func (s *Server) handleUserSessions(w http.ResponseWriter, r *http.Request, username string, segments []string) {
+	if len(segments) == 1 {
+		s.handleKickSession(w, r, username, segments[0])
+		return
+	}
+	if r.Method != http.MethodGet {
+		writeMethodNotAllowed(w, http.MethodGet)
+		return
+	}
+	resp := sessionsResponse{Sessions: []sessionResponse{}}
+	for _, stm := range s.router.UserStreams(username) {
+		resp.Sessions = append(resp.Sessions, s.sessionResponse(stm))
+	}
+	writeJSON(w, http.StatusOK, &resp)
+}
+
+func (s *Server) handleKickSession(w http.ResponseWriter, r *http.Request, username, resource string) {
+	if r.Method != http.MethodDelete {
+		writeMethodNotAllowed(w, http.MethodDelete)
+		return
+	}
+	var target stream.C2S
+	for _, stm := range s.router.UserStreams(username) {
+		if stm.Resource() == resource {
+			target = stm
+			break
+		}
+	}
+	if target == nil {
+		writeError(w, http.StatusNotFound, "session not found")
+		return
+	}
+	target.Disconnect(streamerror.ErrPolicyViolation)
+
+	log.Infof("admin: kicked session %s", target.JID().String())
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (s *Server) sessionResponse(stm stream.C2S) sessionResponse {
+	resp := sessionResponse{
+		JID:           stm.JID().String(),
+		Resource:      stm.Resource(),
+		Secured:       stm.IsSecured(),
+		Authenticated: stm.IsAuthenticated(),
+	}
+	if presence := stm.Presence(); presence != nil {
+		resp.Presence = &presenceResponse{
+			Type:     presence.Type(),
+			Status:   presence.Status(),
+			Priority: presence.Priority(),
+		}
+		if show := presence.Elements().Child("show"); show != nil {
+			resp.Presence.Show = show.Text()
+		}
+		if len(resp.Presence.Type) == 0 {
+			resp.Presence.Type = "available"
+		}
+	}
+	if clusterStm, ok := stm.(*cluster.C2S); ok {
+		resp.Node = clusterStm.Node()
+	} else if c := s.router.Cluster(); c != nil {
+		resp.Node = c.LocalNode()
+	}
+	return resp
+}
@@ -0,0 +1,149 @@
+/*
+ * Copyright (c) 2018 Miguel Ángel Ortuño.
+ * See the LICENSE file for more information.
+ */
+
+package admin
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+
+	"github.com/ortuman/jackal/cluster"
+	streamerror "github.com/ortuman/jackal/errors"
+	"github.com/ortuman/jackal/stream"
+	"github.com/ortuman/jackal/xmpp"
+	"github.com/ortuman/jackal/xmpp/jid"
+	"github.com/pborman/uuid"
+	"github.com/stretchr/testify/require"
+)
+
+type fakeCluster struct {
+	cluster cluster.Cluster
+}
+
+func (c *fakeCluster) LocalNode() string { return "node1" }
+
+func (c *fakeCluster) C2SStream(jid *jid.JID, presence *xmpp.Presence, context map[string]interface{}, node string) *cluster.C2S {
+	return c.cluster.C2SStream(jid, presence, context, node)
+}
+
+func (c *fakeCluster) SendMessageTo(node string, message *cluster.Message) {}
+
+func (c *fakeCluster) BroadcastMessage(msg *cluster.Message) {}
+
+func TestSessions_List(t *testing.T) {
+	srv, _, shutdown := setupTest("jackal.im")
+	defer shutdown()
+
+	createTestUser(t, srv, "ortuman", "1234")
+	createTestUser(t, srv, "noelia", "4321")
+
+	j1, _ := jid.New("ortuman", "jackal.im", "balcony", true)
+	stm1 := stream.NewMockC2S(uuid.New(), j1)
+	stm1.SetAuthenticated(true)
+	stm1.SetSecured(true)
+
+	p := xmpp.NewPresence(j1, j1.ToBareJID(), xmpp.AvailableType)
+	show := xmpp.NewElementName("show")
+	show.SetText("away")
+	p.AppendElement(show)
+	status := xmpp.NewElementName("status")
+	status.SetText("Gone fishing")
+	p.AppendElement(status)
+	pr, _ := xmpp.NewPresenceFromElement(p, j1, j1.ToBareJID())
+	stm1.SetPresence(pr)
+	srv.router.Bind(stm1)
+
+	j2, _ := jid.New("noelia", "jackal.im", "yard", true)
+	stm2 := stream.NewMockC2S(uuid.New(), j2)
+	srv.router.Bind(stm2)
+
+	rec := doRequest(srv, http.MethodGet, "/sessions", nil)
+	require.Equal(t, http.StatusOK, rec.Code)
+
+	var resp sessionsResponse
+	require.Nil(t, json.NewDecoder(rec.Body).Decode(&resp))
+	require.Equal(t, 2, len(resp.Sessions))
+	require.Equal(t, "noelia@jackal.im/yard", resp.Sessions[0].JID)
+	require.Equal(t, "ortuman@jackal.im/balcony", resp.Sessions[1].JID)
+
+	rec = doRequest(srv, http.MethodGet, "/users/ortuman/sessions", nil)
+	require.Equal(t, http.StatusOK, rec.Code)
+
+	resp = sessionsResponse{}
+	require.Nil(t, json.NewDecoder(rec.Body).Decode(&resp))
+	require.Equal(t, 1, len(resp.Sessions))
+
+	sess := resp.Sessions[0]
+	require.Equal(t, "balcony", sess.Resource)
+	require.True(t, sess.Secured)
+	require.True(t, sess.Authenticated)
+	require.Equal(t, "", sess.Node)
+	require.NotNil(t, sess.Presence)
+	require.Equal(t, "available", sess.Presence.Type)
+	require.Equal(t, "away", sess.Presence.Show)
+	require.Equal(t, "Gone fishing", sess.Presence.Status)
+}
+
+func TestSessions_Kick(t *testing.T) {
+	srv, _, shutdown := setupTest("jackal.im")
+	defer shutdown()
+
+	createTestUser(t, srv, "ortuman", "1234")
+
+	j, _ := jid.New("ortuman", "jackal.im", "balcony", true)
+	stm := stream.NewMockC2S(uuid.New(), j)
+	srv.router.Bind(stm)
+
+	rec := doRequest(srv, http.MethodDelete, "/users/ortuman/sessions/yard", nil)
+	require.Equal(t, http.StatusNotFound, rec.Code)
+
+	rec = doRequest(srv, http.MethodGet, "/users/ortuman/sessions/balcony", nil)
+	require.Equal(t, http.StatusMethodNotAllowed, rec.Code)
+
+	errCh := make(chan error, 1)
+	go func() { errCh <- stm.WaitDisconnection() }()
+
+	rec = doRequest(srv, http.MethodDelete, "/users/ortuman/sessions/balcony", nil)
+	require.Equal(t, http.StatusNoContent, rec.Code)
+	require.Equal(t, streamerror.ErrPolicyViolation, <-errCh)
+}
+
+func TestSessions_ClusterList(t *testing.T) {
+	srv, _, shutdown := setupTest("jackal.im")
+	defer shutdown()
+
+	createTestUser(t, srv, "ortuman", "1234")
+
+	srv.router.SetCluster(&fakeCluster{})
+
+	j1, _ := jid.New("ortuman", "jackal.im", "balcony", true)
+	srv.router.Bind(stream.NewMockC2S(uuid.New(), j1))
+
+	j2, _ := jid.New("ortuman", "jackal.im", "garden", true)
+	srv.router.ClusterDelegate().NotifyMessage(&cluster.Message{
+		Type: cluster.MsgBind,
+		Node: "node2",
+		Payloads: []cluster.MessagePayload{{
+			JID:     j2,
+			Stanza:  xmpp.NewPresence(j2, j2, xmpp.AvailableType),
+			Context: map[string]interface{}{},
+		}},
+	})
+
+	rec := doRequest(srv, http.MethodGet, "/users/ortuman/sessions", nil)
+	require.Equal(t, http.StatusOK, rec.Code)
+
+	var resp sessionsResponse
+	require.Nil(t, json.NewDecoder(rec.Body).Decode(&resp))
+	require.Equal(t, 2, len(resp.Sessions))
+
+	nodes := map[string]string{}
+	for _, sess := range resp.Sessions {
+		nodes[sess.Resource] = sess.Node
+	}
+	require.Equal(t, "node1", nodes["balcony"])
+	require.Equal(t, "node2", nodes["garden"])
+}
@@ -0,0 +1,150 @@
+/*
+ * Copyright (c) 2018 Miguel Ángel Ortuño.
+ * See the LICENSE file for more information.
+ */
+
+package admin
+
+import (
+	"net/http"
+
+	streamerror "github.com/ortuman/jackal/errors"
+	"github.com/ortuman/jackal/log"
+	"github.com/ortuman/jackal/model"
+	"github.com/ortuman/jackal/storage"
+	"github.com/ortuman/jackal/stream"
+	"github.com/ortuman/jackal/xmpp"
+)
+
+type usersResponse struct {
+	Users []string `json:"users"`
+}
+
+type createUserRequest struct {
+	Username string `json:"username"`
+	Password string `json:"password"`
+}
+
+type passwordRequest struct {
+	Password string `json:"password"`
+}
+
+func (s *Server) handleUsers(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		usernames, err := storage.FetchUsernames()
+		if err != nil {
+			log.Error(err)
+			writeError(w, http.StatusInternalServerError, "internal server error")
+			return
+		}
+		if usernames == nil {
+			usernames = []string{}
+		}
+		writeJSON(w, http.StatusOK, &usersResponse{Users: usernames})
+
+	case http.MethodPost:
+		s.handleCreateUser(w, r)
+
+	default:
+		writeMethodNotAllowed(w, http.MethodGet, http.MethodPost)
+	}
+}
+
+func (s *Server) handleCreateUser(w http.ResponseWriter, r *http.Request) {
+	var req createUserRequest
+	if !readJSON(w, r, &req) {
+		return
+	}
+	if len(req.Username) == 0 || len(req.Password) == 0 {
+		writeError(w, http.StatusBadRequest, "username and password must be specified")
+		return
+	}
+	userJID, err := s.userJID(req.Username)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "malformed username")
+		return
+	}
+	exists, err := storage.UserExists(userJID.Node())
+	if err != nil {
+		log.Error(err)
+		writeError(w, http.StatusInternalServerError, "internal server error")
+		return
+	}
+	if exists {
+		writeError(w, http.StatusConflict, "user already exists")
+		return
+	}
+	user := model.User{
+		Username:     userJID.Node(),
+		LastPresence: xmpp.NewPresence(userJID, userJID, xmpp.UnavailableType),
+	}
+	if err := user.SetPassword(req.Password); err != nil {
+		log.Error(err)
+		writeError(w, http.StatusInternalServerError, "internal server error")
+		return
+	}
+	if err := storage.InsertOrUpdateUser(&user); err != nil {
+		log.Error(err)
+		writeError(w, http.StatusInternalServerError, "internal server error")
+		return
+	}
+	log.Infof("admin: created user %s", user.Username)
+	writeJSON(w, http.StatusCreated, &usersResponse{Users: []string{user.Username}})
+}
+
+func (s *Server) handleDeleteUser(w http.ResponseWriter, r *http.Request, username string) {
+	if r.Method != http.MethodDelete {
+		writeMethodNotAllowed(w, http.MethodDelete)
+		return
+	}
+	if err := storage.DeleteUser(username); err != nil {
+		log.Error(err)
+		writeError(w, http.StatusInternalServerError, "internal server error")
+		return
+	}
+	// close every user session, wherever the owning node is
+	stms := append([]stream.C2S(nil), s.router.UserStreams(username)...)
+	for _, stm := range stms {
+		stm.Disconnect(streamerror.ErrNotAuthorized)
+	}
+	log.Infof("admin: deleted user %s", username)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (s *Server) handlePassword(w http.ResponseWriter, r *http.Request, username string) {
+	if r.Method != http.MethodPut {
+		writeMethodNotAllowed(w, http.MethodPut)
+		return
+	}
+	var req passwordRequest
+	if !readJSON(w, r, &req) {
+		return
+	}
+	if len(req.Password) == 0 {
+		writeError(w, http.StatusBadRequest, "password must be specified")
+		return
+	}
+	user, err := storage.FetchUser(username)
+	if err != nil {
+		log.Error(err)
+		writeError(w, http.StatusInternalServerError, "internal server error")
+		return
+	}
+	if user == nil {
+		writeError(w, http.StatusNotFound, "user not found")
+		return
+	}
+	if err := user.SetPassword(req.Password); err != nil {
+		log.Error(err)
+		writeError(w, http.StatusInternalServerError, "internal server error")
+		return
+	}
+	if err := storage.InsertOrUpdateUser(user); err != nil {
+		log.Error(err)
+		writeError(w, http.StatusInternalServerError, "internal server error")
+		return
+	}
+	log.Infof("admin: reset password for user %s", username)
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,106 @@
+/*
+ * Copyright (c) 2018 Miguel Ángel Ortuño.
+ * See the LICENSE file for more information.
+ */
+
+package admin
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+
+	streamerror "github.com/ortuman/jackal/errors"
+	"github.com/ortuman/jackal/storage"
+	"github.com/ortuman/jackal/stream"
+	"github.com/ortuman/jackal/xmpp/jid"
+	"github.com/pborman/uuid"
+	"github.com/stretchr/testify/require"
+)
+
+func TestUsers_CreateAndList(t *testing.T) {
+	srv, s, shutdown := setupTest("jackal.im")
+	defer shutdown()
+
+	rec := doRequest(srv, http.MethodPost, "/users", &createUserRequest{Username: "ortuman"})
+	require.Equal(t, http.StatusBadRequest, rec.Code)
+
+	rec = doRequest(srv, http.MethodPost, "/users", &createUserRequest{Username: "or@tuman", Password: "1234"})
+	require.Equal(t, http.StatusBadRequest, rec.Code)
+
+	createTestUser(t, srv, "ortuman", "1234")
+	createTestUser(t, srv, "noelia", "4321")
+
+	rec = doRequest(srv, http.MethodPost, "/users", &createUserRequest{Username: "ortuman", Password: "1234"})
+	require.Equal(t, http.StatusConflict, rec.Code)
+
+	usr, _ := storage.FetchUser("ortuman")
+	require.NotNil(t, usr)
+	require.True(t, usr.HasScramCredentials())
+	require.True(t, usr.VerifyPassword("1234"))
+	require.Equal(t, "", usr.Password)
+
+	rec = doRequest(srv, http.MethodGet, "/users", nil)
+	require.Equal(t, http.StatusOK, rec.Code)
+
+	var resp usersResponse
+	require.Nil(t, json.NewDecoder(rec.Body).Decode(&resp))
+	require.Equal(t, []string{"noelia", "ortuman"}, resp.Users)
+
+	s.EnableMockedError()
+	rec = doRequest(srv, http.MethodGet, "/users", nil)
+	require.Equal(t, http.StatusInternalServerError, rec.Code)
+	s.DisableMockedError()
+}
+
+func TestUsers_Delete(t *testing.T) {
+	srv, _, shutdown := setupTest("jackal.im")
+	defer shutdown()
+
+	createTestUser(t, srv, "ortuman", "1234")
+
+	j, _ := jid.New("ortuman", "jackal.im", "balcony", true)
+	stm := stream.NewMockC2S(uuid.New(), j)
+	stm.SetAuthenticated(true)
+	srv.router.Bind(stm)
+
+	rec := doRequest(srv, http.MethodDelete, "/users/or@tuman", nil)
+	require.Equal(t, http.StatusBadRequest, rec.Code)
+
+	errCh := make(chan error, 1)
+	go func() { errCh <- stm.WaitDisconnection() }()
+
+	rec = doRequest(srv, http.MethodDelete, "/users/ortuman", nil)
+	require.Equal(t, http.StatusNoContent, rec.Code)
+	require.Equal(t, streamerror.ErrNotAuthorized, <-errCh)
+
+	exists, _ := storage.UserExists("ortuman")
+	require.False(t, exists)
+
+	rec = doRequest(srv, http.MethodDelete, "/users/ortuman", nil)
+	require.Equal(t, http.StatusNotFound, rec.Code)
+}
+
+func TestUsers_ResetPassword(t *testing.T) {
+	srv, _, shutdown := setupTest("jackal.im")
+	defer shutdown()
+
+	createTestUser(t, srv, "ortuman", "1234")
+
+	rec := doRequest(srv, http.MethodPost, "/users/ortuman/password", &passwordRequest{Password: "4321"})
+	require.Equal(t, http.StatusMethodNotAllowed, rec.Code)
+
+	rec = doRequest(srv, http.MethodPut, "/users/ortuman/password", &passwordRequest{})
+	require.Equal(t, http.StatusBadRequest, rec.Code)
+
+	rec = doRequest(srv, http.MethodPut, "/users/or@tuman/password", &passwordRequest{Password: "4321"})
+	require.Equal(t, http.StatusBadRequest, rec.Code)
+
+	rec = doRequest(srv, http.MethodPut, "/users/ortuman/password", &passwordRequest{Password: "4321"})
+	require.Equal(t, http.StatusNoContent, rec.Code)
+
+	usr, _ := storage.FetchUser("ortuman")
+	require.NotNil(t, usr)
+	require.False(t, usr.VerifyPassword("1234"))
+	require.True(t, usr.VerifyPassword("4321"))
+}
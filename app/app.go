@@ -21,10 +21,14 @@ import (
 	"syscall"
 	"time"
 
+	"github.com/ortuman/jackal/admin"
+	"github.com/ortuman/jackal/auth"
 	"github.com/ortuman/jackal/c2s"
 	"github.com/ortuman/jackal/cluster"
 	"github.com/ortuman/jackal/component"
+	"github.com/ortuman/jackal/component/xep0114"
 	"github.com/ortuman/jackal/log"
+	"github.com/ortuman/jackal/metrics"
 	"github.com/ortuman/jackal/module"
 	"github.com/ortuman/jackal/router"
 	"github.com/ortuman/jackal/s2s"
@@ -66,8 +70,10 @@ type Application struct {
 	router           *router.Router
 	mods             *module.Modules
 	comps            *component.Components
+	extComps         *xep0114.Listener
 	s2s              *s2s.S2S
 	c2s              *c2s.C2S
+	adminSrv         *admin.Server
 	debugSrv         *http.Server
 	waitStopCh       chan os.Signal
 	shutDownWaitSecs time.Duration
@@ -170,7 +176,14 @@ func (a *Application) Run() error {
 
 	// initialize modules & components...
 	a.mods = module.New(&cfg.Modules, a.router)
-	a.comps = component.New(&cfg.Components, a.mods.DiscoInfo)
+	a.comps = component.New(&cfg.Components, a.mods.DiscoInfo, a.router)
+	a.router.SetComponentRouter(a.comps)
+
+	// start serving external components...
+	if cfg.ExtComps != nil {
+		a.extComps = xep0114.New(cfg.ExtComps, a.mods, a.comps, a.router)
+		a.extComps.Start()
+	}
 
 	// start serving s2s...
 	a.s2s = s2s.New(cfg.S2S, a.mods, a.router)
@@ -185,6 +198,12 @@ func (a *Application) Run() error {
 	}
 	a.c2s.Start()
 
+	// start serving admin API...
+	if cfg.Admin != nil {
+		a.adminSrv = admin.New(cfg.Admin, a.mods, a.router)
+		a.adminSrv.Start()
+	}
+
 	// initialize debug server...
 	if cfg.Debug.Port > 0 {
 		if err := a.initDebugServer(cfg.Debug.Port); err != nil {
@@ -253,6 +272,15 @@ func (a *Application) initStorage(config *storage.Config) error {
 	}
 	a.storage = s
 	storage.Set(a.storage)
+
+	// convert legacy plaintext passwords before accepting any connection
+	n, err := auth.MigratePlaintextPasswords()
+	if err != nil {
+		return err
+	}
+	if n > 0 {
+		log.Infof("migrated %d plaintext password(s) to SCRAM credentials", n)
+	}
 	return nil
 }
 
@@ -283,6 +311,7 @@ func (a *Application) initDebugServer(port int) error {
 		return err
 	}
 	http.HandleFunc("/", a.debugResponse)
+	http.Handle("/metrics", metrics.Handler())
 	go a.debugSrv.Serve(ln)
 	log.Infof("debug server listening at %d...", port)
 	return nil
@@ -312,6 +341,11 @@ func (a *Application) shutdown(ctx context.Context) <-chan bool {
 		if a.debugSrv != nil {
 			a.debugSrv.Shutdown(ctx)
 		}
+		if a.adminSrv != nil {
+			if err := a.adminSrv.Shutdown(ctx); err != nil {
+				log.Error(err)
+			}
+		}
 		a.c2s.Shutdown(ctx)
 		if a.s2s != nil {
 			a.s2s.Shutdown(ctx)
@@ -319,6 +353,11 @@ func (a *Application) shutdown(ctx context.Context) <-chan bool {
 		if a.cluster != nil {
 			a.cluster.Shutdown()
 		}
+		if a.extComps != nil {
+			if err := a.extComps.Shutdown(ctx); err != nil {
+				log.Error(err)
+			}
+		}
 		a.comps.Shutdown(ctx)
 		a.mods.Shutdown(ctx)
 
@@ -11,8 +11,10 @@ import (
 
 	"github.com/ortuman/jackal/cluster"
 
+	"github.com/ortuman/jackal/admin"
 	"github.com/ortuman/jackal/c2s"
 	"github.com/ortuman/jackal/component"
+	"github.com/ortuman/jackal/component/xep0114"
 	"github.com/ortuman/jackal/module"
 	"github.com/ortuman/jackal/router"
 	"github.com/ortuman/jackal/s2s"
@@ -42,6 +44,8 @@ type Config struct {
 	Components component.Config `yaml:"components"`
 	C2S        []c2s.Config     `yaml:"c2s"`
 	S2S        *s2s.Config      `yaml:"s2s"`
+	ExtComps   *xep0114.Config  `yaml:"external_components"`
+	Admin      *admin.Config    `yaml:"admin"`
 }
 
 // FromFile loads default global configuration from
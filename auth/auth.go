@@ -5,7 +5,10 @@
 
 package auth
 
-import "github.com/ortuman/jackal/xmpp"
+import (
+	"github.com/ortuman/jackal/storage"
+	"github.com/ortuman/jackal/xmpp"
+)
 
 const saslNamespace = "urn:ietf:params:xml:ns:xmpp-sasl"
 
@@ -65,3 +68,31 @@ var (
 	// ErrSASLTemporaryAuthFailure represents a 'temporary-auth-failure' authentication error.
 	ErrSASLTemporaryAuthFailure = newSASLError("temporary-auth-failure")
 )
+
+// MigratePlaintextPasswords replaces every legacy plaintext password found
+// in storage with its salted SCRAM credentials, returning the number of
+// migrated users.
+func MigratePlaintextPasswords() (int, error) {
+	usernames, err := storage.FetchUsernames()
+	if err != nil {
+		return 0, err
+	}
+	var migrated int
+	for _, username := range usernames {
+		user, err := storage.FetchUser(username)
+		if err != nil {
+			return migrated, err
+		}
+		if user == nil || user.HasScramCredentials() || len(user.Password) == 0 {
+			continue
+		}
+		if err := user.SetPassword(user.Password); err != nil {
+			return migrated, err
+		}
+		if err := storage.InsertOrUpdateUser(user); err != nil {
+			return migrated, err
+		}
+		migrated++
+	}
+	return migrated, nil
+}
@@ -46,3 +46,29 @@ func TestAuthError(t *testing.T) {
 	require.Equal(t, "not-authorized", ErrSASLNotAuthorized.(*SASLError).Element().Name())
 	require.Equal(t, "temporary-auth-failure", ErrSASLTemporaryAuthFailure.(*SASLError).Element().Name())
 }
+
+func TestMigratePlaintextPasswords(t *testing.T) {
+	_, s := authTestSetup(&model.User{Username: "ortuman", Password: "1234"})
+	defer authTestTeardown()
+
+	migrated := &model.User{Username: "mariana"}
+	require.Nil(t, migrated.SetPassword("abcd"))
+	require.Nil(t, s.InsertOrUpdateUser(migrated))
+
+	n, err := MigratePlaintextPasswords()
+	require.Nil(t, err)
+	require.Equal(t, 1, n)
+
+	usr, _ := s.FetchUser("ortuman")
+	require.True(t, usr.HasScramCredentials())
+	require.Equal(t, "", usr.Password)
+	require.True(t, usr.VerifyPassword("1234"))
+
+	usr, _ = s.FetchUser("mariana")
+	require.Equal(t, migrated.Salt, usr.Salt)
+
+	// already migrated
+	n, err = MigratePlaintextPasswords()
+	require.Nil(t, err)
+	require.Equal(t, 0, n)
+}
@@ -190,7 +190,9 @@ func (d *DigestMD5) handleChallenged(elem xmpp.XElement) error {
 	if err != nil {
 		return err
 	}
-	if user == nil {
+	// DIGEST-MD5 requires plaintext password, hence users
+	// whose credentials have been already salted can't be authenticated.
+	if user == nil || user.HasScramCredentials() {
 		return ErrSASLNotAuthorized
 	}
 	// validate response
@@ -12,6 +12,7 @@ import (
 	"testing"
 
 	"github.com/ortuman/jackal/model"
+	"github.com/ortuman/jackal/storage"
 	"github.com/ortuman/jackal/storage/memstorage"
 	"github.com/ortuman/jackal/stream"
 	"github.com/ortuman/jackal/util"
@@ -166,4 +167,12 @@ func TestDigesMD5Authentication(t *testing.T) {
 	require.Equal(t, authr.state, startDigestMD5State)
 	require.False(t, authr.Authenticated())
 	require.Equal(t, "", authr.Username())
+
+	// salted credentials can't be used...
+	require.Nil(t, user.SetPassword("1234"))
+	storage.InsertOrUpdateUser(user)
+
+	authr.ProcessElement(auth)
+	testStm.ReceiveElement()
+	require.Equal(t, ErrSASLNotAuthorized, helper.sendClientParamsResponse(clParams))
 }
@@ -0,0 +1,143 @@
+/*
+ * Copyright (c) 2018 Miguel Ángel Ortuño.
+ * See the LICENSE file for more information.
+ */
+
+package auth
+
+import (
+	"crypto/x509"
+	"encoding/base64"
+
+	"github.com/ortuman/jackal/storage"
+	"github.com/ortuman/jackal/stream"
+	"github.com/ortuman/jackal/transport"
+	"github.com/ortuman/jackal/util"
+	"github.com/ortuman/jackal/xmpp"
+	"github.com/ortuman/jackal/xmpp/jid"
+)
+
+// External represents an EXTERNAL authenticator, which relies on
+// the client certificate presented during the TLS handshake.
+type External struct {
+	stm           stream.C2S
+	tr            transport.Transport
+	roots         *x509.CertPool
+	username      string
+	authenticated bool
+}
+
+// NewExternal returns a new external authenticator instance.
+// Client certificate chains are validated against roots certificate pool.
+func NewExternal(stm stream.C2S, tr transport.Transport, roots *x509.CertPool) *External {
+	return &External{stm: stm, tr: tr, roots: roots}
+}
+
+// Mechanism returns authenticator mechanism name.
+func (e *External) Mechanism() string {
+	return "EXTERNAL"
+}
+
+// Username returns authenticated username in case
+// authentication process has been completed.
+func (e *External) Username() string {
+	return e.username
+}
+
+// Authenticated returns whether or not user has been authenticated.
+func (e *External) Authenticated() bool {
+	return e.authenticated
+}
+
+// UsesChannelBinding returns whether or not external authenticator
+// requires channel binding bytes.
+func (e *External) UsesChannelBinding() bool {
+	return false
+}
+
+// ProcessElement process an incoming authenticator element.
+func (e *External) ProcessElement(elem xmpp.XElement) error {
+	if e.authenticated {
+		return nil
+	}
+	// decode authorization identity (if any)
+	var authzID string
+	if txt := elem.Text(); len(txt) > 0 && txt != "=" {
+		b, err := base64.StdEncoding.DecodeString(txt)
+		if err != nil {
+			return ErrSASLIncorrectEncoding
+		}
+		authzID = string(b)
+	}
+	certs := e.tr.PeerCertificates()
+	if len(certs) == 0 || e.roots == nil {
+		return ErrSASLNotAuthorized
+	}
+	// validate client certificate chain
+	intermediates := x509.NewCertPool()
+	for _, cert := range certs[1:] {
+		intermediates.AddCert(cert)
+	}
+	opts := x509.VerifyOptions{
+		Roots:         e.roots,
+		Intermediates: intermediates,
+		KeyUsages:     []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+	}
+	if _, err := certs[0].Verify(opts); err != nil {
+		return ErrSASLNotAuthorized
+	}
+	username := e.mapUsername(certs[0], authzID)
+	if len(username) == 0 {
+		return ErrSASLNotAuthorized
+	}
+	user, err := storage.FetchUser(username)
+	if err != nil {
+		return err
+	}
+	if user == nil {
+		return ErrSASLNotAuthorized
+	}
+	e.username = username
+	e.authenticated = true
+	return nil
+}
+
+// Reset resets external authenticator internal state.
+func (e *External) Reset() {
+	e.username = ""
+	e.authenticated = false
+}
+
+// mapUsername maps certificate identities to a local username.
+// XmppAddr identities take precedence over e-mail SAN ones,
+// falling back to subject common name if none of them is present.
+func (e *External) mapUsername(cert *x509.Certificate, authzID string) string {
+	var reqUsername string
+	if len(authzID) > 0 {
+		j, err := jid.NewWithString(authzID, false)
+		if err != nil || !j.IsBare() || j.Domain() != e.stm.Domain() {
+			return ""
+		}
+		reqUsername = j.Node()
+	}
+	identities := util.XMPPAddresses(cert)
+	if len(identities) == 0 {
+		identities = cert.EmailAddresses
+	}
+	if len(identities) == 0 && len(cert.Subject.CommonName) > 0 {
+		identities = []string{cert.Subject.CommonName}
+	}
+	for _, identity := range identities {
+		username := identity
+		if j, err := jid.NewWithString(identity, false); err == nil && len(j.Node()) > 0 {
+			if j.Domain() != e.stm.Domain() {
+				continue
+			}
+			username = j.Node()
+		}
+		if len(reqUsername) == 0 || reqUsername == username {
+			return username
+		}
+	}
+	return ""
+}
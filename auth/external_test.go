@@ -0,0 +1,154 @@
+/*
+ * Copyright (c) 2018 Miguel Ángel Ortuño.
+ * See the LICENSE file for more information.
+ */
+
+package auth
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"encoding/base64"
+	"math/big"
+	"testing"
+	"time"
+
+	"github.com/ortuman/jackal/model"
+	"github.com/ortuman/jackal/storage/memstorage"
+	"github.com/ortuman/jackal/xmpp"
+	"github.com/stretchr/testify/require"
+)
+
+var (
+	oidSubjectAltName = asn1.ObjectIdentifier{2, 5, 29, 17}
+	oidXmppAddr       = asn1.ObjectIdentifier{1, 3, 6, 1, 5, 5, 7, 8, 5}
+)
+
+func TestAuthExternalAuthentication(t *testing.T) {
+	testStm, s := authTestSetup(&model.User{Username: "mariana", Password: "1234"})
+	defer authTestTeardown()
+
+	ca, caKey := generateTestCA(t)
+	roots := x509.NewCertPool()
+	roots.AddCert(ca)
+
+	tr := &fakeTransport{}
+	authr := NewExternal(testStm, tr, roots)
+	require.Equal(t, "EXTERNAL", authr.Mechanism())
+	require.False(t, authr.UsesChannelBinding())
+
+	elem := xmpp.NewElementNamespace("auth", "urn:ietf:params:xml:ns:xmpp-sasl")
+	elem.SetAttribute("mechanism", "EXTERNAL")
+	elem.SetText("=")
+
+	// no client certificate...
+	require.Equal(t, ErrSASLNotAuthorized, authr.ProcessElement(elem))
+
+	// untrusted client certificate...
+	otherCA, otherKey := generateTestCA(t)
+	tr.certs = []*x509.Certificate{generateTestClientCert(t, otherCA, otherKey, "mariana@localhost", "")}
+	require.Equal(t, ErrSASLNotAuthorized, authr.ProcessElement(elem))
+
+	// incorrect encoding...
+	tr.certs = []*x509.Certificate{generateTestClientCert(t, ca, caKey, "mariana@localhost", "")}
+	elem.SetText("mariana@localhost")
+	require.Equal(t, ErrSASLIncorrectEncoding, authr.ProcessElement(elem))
+
+	// mismatching authorization identity...
+	elem.SetText(base64.StdEncoding.EncodeToString([]byte("noelia@localhost")))
+	require.Equal(t, ErrSASLNotAuthorized, authr.ProcessElement(elem))
+
+	// storage error...
+	elem.SetText("=")
+	s.EnableMockedError()
+	require.Equal(t, memstorage.ErrMockedError, authr.ProcessElement(elem))
+	s.DisableMockedError()
+
+	// XmppAddr identity...
+	elem.SetText(base64.StdEncoding.EncodeToString([]byte("mariana@localhost")))
+	require.Nil(t, authr.ProcessElement(elem))
+	require.True(t, authr.Authenticated())
+	require.Equal(t, "mariana", authr.Username())
+
+	// already authenticated...
+	require.Nil(t, authr.ProcessElement(elem))
+
+	authr.Reset()
+	require.False(t, authr.Authenticated())
+	require.Equal(t, "", authr.Username())
+
+	// common name identity...
+	elem.SetText("")
+	tr.certs = []*x509.Certificate{generateTestClientCert(t, ca, caKey, "", "mariana")}
+	require.Nil(t, authr.ProcessElement(elem))
+	require.Equal(t, "mariana", authr.Username())
+
+	// foreign domain identity...
+	authr.Reset()
+	tr.certs = []*x509.Certificate{generateTestClientCert(t, ca, caKey, "mariana@jackal.im", "mariana")}
+	require.Equal(t, ErrSASLNotAuthorized, authr.ProcessElement(elem))
+
+	// unknown user...
+	tr.certs = []*x509.Certificate{generateTestClientCert(t, ca, caKey, "", "noelia")}
+	require.Equal(t, ErrSASLNotAuthorized, authr.ProcessElement(elem))
+}
+
+func generateTestCA(t *testing.T) (*x509.Certificate, *ecdsa.PrivateKey) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.Nil(t, err)
+
+	tmpl := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "jackal test CA"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		KeyUsage:              x509.KeyUsageCertSign,
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	require.Nil(t, err)
+	cert, err := x509.ParseCertificate(der)
+	require.Nil(t, err)
+	return cert, key
+}
+
+func generateTestClientCert(t *testing.T, ca *x509.Certificate, caKey *ecdsa.PrivateKey, xmppAddr, commonName string) *x509.Certificate {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.Nil(t, err)
+
+	tmpl := &x509.Certificate{
+		SerialNumber: big.NewInt(2),
+		Subject:      pkix.Name{CommonName: commonName},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+	}
+	if len(xmppAddr) > 0 {
+		// otherName [0] { id-on-xmppAddr, [0] EXPLICIT UTF8String }
+		value, err := asn1.MarshalWithParams(xmppAddr, "utf8")
+		require.Nil(t, err)
+		typeID, err := asn1.Marshal(oidXmppAddr)
+		require.Nil(t, err)
+		otherName := append(typeID, asn1RawBytes(t, asn1.RawValue{Class: asn1.ClassContextSpecific, Tag: 0, IsCompound: true, Bytes: value})...)
+		san, err := asn1.Marshal([]asn1.RawValue{{Class: asn1.ClassContextSpecific, Tag: 0, IsCompound: true, Bytes: otherName}})
+		require.Nil(t, err)
+		tmpl.ExtraExtensions = []pkix.Extension{{Id: oidSubjectAltName, Value: san}}
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, ca, &key.PublicKey, caKey)
+	require.Nil(t, err)
+	cert, err := x509.ParseCertificate(der)
+	require.Nil(t, err)
+	return cert
+}
+
+func asn1RawBytes(t *testing.T, v asn1.RawValue) []byte {
+	b, err := asn1.Marshal(v)
+	require.Nil(t, err)
+	return b
+}
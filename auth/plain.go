@@ -72,9 +72,18 @@ func (p *Plain) ProcessElement(elem xmpp.XElement) error {
 	if err != nil {
 		return err
 	}
-	if user == nil || user.Password != password {
+	if user == nil || !user.VerifyPassword(password) {
 		return ErrSASLNotAuthorized
 	}
+	if !user.HasScramCredentials() {
+		// replace legacy plaintext password
+		if err := user.SetPassword(password); err != nil {
+			return err
+		}
+		if err := storage.InsertOrUpdateUser(user); err != nil {
+			return err
+		}
+	}
 	p.username = username
 	p.authenticated = true
 
@@ -48,6 +48,12 @@ func TestAuthPlainAuthentication(t *testing.T) {
 	require.Equal(t, "mariana", authr.Username())
 	require.True(t, authr.Authenticated())
 
+	// legacy plaintext password should have been replaced
+	usr, _ := s.FetchUser("mariana")
+	require.NotNil(t, usr)
+	require.True(t, usr.HasScramCredentials())
+	require.Equal(t, "", usr.Password)
+
 	// already authenticated...
 	err = authr.ProcessElement(elem)
 	require.Nil(t, err)
@@ -100,4 +106,17 @@ func TestAuthPlainAuthentication(t *testing.T) {
 	authr.Reset()
 	err = authr.ProcessElement(elem)
 	require.Equal(t, ErrSASLNotAuthorized, err)
+
+	// salted credentials
+	buf.Reset()
+	buf.WriteByte(0)
+	buf.WriteString("mariana")
+	buf.WriteByte(0)
+	buf.WriteString("1234")
+	elem.SetText(base64.StdEncoding.EncodeToString(buf.Bytes()))
+
+	authr.Reset()
+	err = authr.ProcessElement(elem)
+	require.Nil(t, err)
+	require.True(t, authr.Authenticated())
 }
@@ -11,6 +11,7 @@ import (
 	"crypto/sha1"
 	"crypto/sha256"
 	"crypto/sha512"
+	"crypto/subtle"
 	"encoding/base64"
 	"fmt"
 	"hash"
@@ -23,7 +24,6 @@ import (
 	"github.com/ortuman/jackal/util"
 	"github.com/ortuman/jackal/xmpp"
 	"github.com/pborman/uuid"
-	"golang.org/x/crypto/pbkdf2"
 )
 
 // ScramType represents a scram autheticator class
@@ -40,7 +40,9 @@ const (
 	ScramSHA512
 )
 
-const iterationsCount = 4096
+// fakeSaltKey derives the salt offered to unknown users, so that it stays
+// stable across attempts and cannot be told apart from a real one.
+var fakeSaltKey = util.RandomBytes(32)
 
 type scramState int
 
@@ -88,11 +90,10 @@ type Scram struct {
 	tp            ScramType
 	usesCb        bool
 	h             func() hash.Hash
-	hKeyLen       int
 	state         scramState
 	params        *scramParameters
 	user          *model.User
-	salt          []byte
+	keys          model.ScramKeys
 	srvNonce      string
 	firstMessage  string
 	authenticated bool
@@ -110,13 +111,10 @@ func NewScram(stm stream.C2S, tr transport.Transport, scramType ScramType, usesC
 	switch s.tp {
 	case ScramSHA1:
 		s.h = sha1.New
-		s.hKeyLen = sha1.Size
 	case ScramSHA256:
 		s.h = sha256.New
-		s.hKeyLen = sha256.Size
 	case ScramSHA512:
 		s.h = sha512.New
-		s.hKeyLen = sha512.Size
 	}
 	return s
 }
@@ -190,7 +188,7 @@ func (s *Scram) Reset() {
 	s.state = startScramState
 	s.params = nil
 	s.user = nil
-	s.salt = nil
+	s.keys = model.ScramKeys{}
 	s.srvNonce = ""
 	s.firstMessage = ""
 }
@@ -213,15 +211,24 @@ func (s *Scram) handleStart(elem xmpp.XElement) error {
 	if err != nil {
 		return err
 	}
-	if user == nil {
-		return ErrSASLNotAuthorized
+	var salt []byte
+	var iterationCount int
+	if user != nil && user.HasScramCredentials() {
+		s.user = user
+		s.keys = s.userKeys()
+		salt, iterationCount = user.Salt, user.IterationCount
+	} else {
+		// unknown (or not yet migrated) users get a challenge
+		// indistinguishable from a real one that can never be satisfied.
+		s.keys = model.ScramKeys{
+			StoredKey: util.RandomBytes(s.h().Size()),
+			ServerKey: util.RandomBytes(s.h().Size()),
+		}
+		salt, iterationCount = s.fakeSalt(username), model.ScramIterationCount
 	}
-	s.user = user
-
 	s.srvNonce = cNonce + "-" + uuid.New()
-	s.salt = util.RandomBytes(32)
-	sb64 := base64.StdEncoding.EncodeToString(s.salt)
-	s.firstMessage = fmt.Sprintf("r=%s,s=%s,i=%d", s.srvNonce, sb64, iterationsCount)
+	sb64 := base64.StdEncoding.EncodeToString(salt)
+	s.firstMessage = fmt.Sprintf("r=%s,s=%s,i=%d", s.srvNonce, sb64, iterationCount)
 
 	respElem := xmpp.NewElementNamespace("challenge", saslNamespace)
 	respElem.SetText(base64.StdEncoding.EncodeToString([]byte(s.firstMessage)))
@@ -240,23 +247,27 @@ func (s *Scram) handleChallenged(elem xmpp.XElement) error {
 	initialMessage := s.params.String()
 	clientFinalMessageBare := fmt.Sprintf("c=%s,r=%s", c, s.srvNonce)
 
-	saltedPassword := s.pbkdf2([]byte(s.user.Password))
-	clientKey := s.hmac([]byte("Client Key"), saltedPassword)
-	storedKey := s.hash(clientKey)
 	authMessage := initialMessage + "," + s.firstMessage + "," + clientFinalMessageBare
-	clientSignature := s.hmac([]byte(authMessage), storedKey)
 
-	clientProof := make([]byte, len(clientKey))
-	for i := 0; i < len(clientKey); i++ {
-		clientProof[i] = clientKey[i] ^ clientSignature[i]
+	proofPrefix := clientFinalMessageBare + ",p="
+	if !strings.HasPrefix(p, proofPrefix) {
+		return ErrSASLNotAuthorized
 	}
-	serverKey := s.hmac([]byte("Server Key"), saltedPassword)
-	serverSignature := s.hmac([]byte(authMessage), serverKey)
-
-	clientFinalMessage := clientFinalMessageBare + ",p=" + base64.StdEncoding.EncodeToString(clientProof)
-	if clientFinalMessage != p {
+	clientProof, err := base64.StdEncoding.DecodeString(p[len(proofPrefix):])
+	if err != nil || len(clientProof) != len(s.keys.StoredKey) {
 		return ErrSASLNotAuthorized
 	}
+	// recover client key from proof and check it against stored key
+	clientSignature := s.hmac([]byte(authMessage), s.keys.StoredKey)
+	clientKey := make([]byte, len(clientProof))
+	for i := 0; i < len(clientProof); i++ {
+		clientKey[i] = clientProof[i] ^ clientSignature[i]
+	}
+	if subtle.ConstantTimeCompare(s.hash(clientKey), s.keys.StoredKey) != 1 {
+		return ErrSASLNotAuthorized
+	}
+	serverSignature := s.hmac([]byte(authMessage), s.keys.ServerKey)
+
 	v := "v=" + base64.StdEncoding.EncodeToString(serverSignature)
 
 	respElem := xmpp.NewElementNamespace("success", saslNamespace)
@@ -333,8 +344,22 @@ func (s *Scram) getCBindInputString() string {
 	return base64.StdEncoding.EncodeToString(buf.Bytes())
 }
 
-func (s *Scram) pbkdf2(b []byte) []byte {
-	return pbkdf2.Key(b, s.salt, iterationsCount, s.hKeyLen, s.h)
+func (s *Scram) userKeys() model.ScramKeys {
+	switch s.tp {
+	case ScramSHA1:
+		return s.user.SHA1
+	case ScramSHA256:
+		return s.user.SHA256
+	case ScramSHA512:
+		return s.user.SHA512
+	}
+	return model.ScramKeys{}
+}
+
+func (s *Scram) fakeSalt(username string) []byte {
+	m := hmac.New(sha256.New, fakeSaltKey)
+	m.Write([]byte(username))
+	return m.Sum(nil)
 }
 
 func (s *Scram) hmac(b []byte, key []byte) []byte {
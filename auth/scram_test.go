@@ -31,6 +31,7 @@ import (
 
 type fakeTransport struct {
 	cbBytes []byte
+	certs   []*x509.Certificate
 }
 
 func (ft *fakeTransport) Read(p []byte) (n int, err error)        { return 0, nil }
@@ -44,7 +45,7 @@ func (ft *fakeTransport) EnableCompression(compress.Level)        { return }
 func (ft *fakeTransport) ChannelBindingBytes(transport.ChannelBindingMechanism) []byte {
 	return ft.cbBytes
 }
-func (ft *fakeTransport) PeerCertificates() []*x509.Certificate { return nil }
+func (ft *fakeTransport) PeerCertificates() []*x509.Certificate { return ft.certs }
 
 type scramAuthTestCase struct {
 	id          int
@@ -271,8 +272,11 @@ func TestScramBadPayload(t *testing.T) {
 }
 
 func TestScramTestCases(t *testing.T) {
+	usr := &model.User{Username: "ortuman"}
+	require.Nil(t, usr.SetPassword("1234"))
+
 	for _, tc := range tt {
-		err := processScramTestCase(t, &tc)
+		err := processScramTestCase(t, &tc, usr)
 		if err != nil {
 			require.Equal(t, tc.expectedErr, err, fmt.Sprintf("TC identifier: %d", tc.id))
 			continue
@@ -280,12 +284,52 @@ func TestScramTestCases(t *testing.T) {
 	}
 }
 
-func processScramTestCase(t *testing.T, tc *scramAuthTestCase) error {
+func TestScramFakeChallenge(t *testing.T) {
+	// legacy plaintext passwords are not usable until migrated
+	testStm, _ := authTestSetup(&model.User{Username: "ortuman", Password: "1234"})
+	defer authTestTeardown()
+
+	startScram := func(username string) (*Scram, map[string]string, string) {
+		authr := NewScram(testStm, &fakeTransport{}, ScramSHA256, false)
+
+		auth := xmpp.NewElementNamespace("auth", saslNamespace)
+		auth.SetAttribute("mechanism", authr.Mechanism())
+		auth.SetText(base64.StdEncoding.EncodeToString([]byte("n,,n=" + username + ",r=bb769406-eaa4-4f38-a279-2b90e596f6dd")))
+		require.Nil(t, authr.ProcessElement(auth))
+
+		challenge := testStm.ReceiveElement()
+		require.Equal(t, "challenge", challenge.Name())
+		srvInitialMessage, _ := base64.StdEncoding.DecodeString(challenge.Text())
+		resp, _ := parseScramResponse(challenge.Text())
+		return authr, resp, string(srvInitialMessage)
+	}
+	for _, username := range []string{"ortuman", "mariana"} {
+		authr, resp, srvInitialMessage := startScram(username)
+
+		salt, _ := base64.StdEncoding.DecodeString(resp["s"])
+		require.Len(t, salt, 32)
+		require.Equal(t, strconv.Itoa(model.ScramIterationCount), resp["i"])
+
+		// same salt is offered on every attempt
+		_, resp2, _ := startScram(username)
+		require.Equal(t, resp["s"], resp2["s"])
+
+		cBytes := base64.StdEncoding.EncodeToString([]byte("n,,"))
+		clientInitialMessage := "n=" + username + ",r=bb769406-eaa4-4f38-a279-2b90e596f6dd"
+		res := computeScramAuthResult(ScramSHA256, clientInitialMessage, srvInitialMessage, resp["r"], cBytes, "1234", salt, model.ScramIterationCount)
+		response := xmpp.NewElementNamespace("response", saslNamespace)
+		response.SetText(base64.StdEncoding.EncodeToString([]byte(res.clientFinalMessage)))
+		require.Equal(t, ErrSASLNotAuthorized, authr.ProcessElement(response))
+		require.False(t, authr.Authenticated())
+	}
+}
+
+func processScramTestCase(t *testing.T, tc *scramAuthTestCase, user *model.User) error {
 	tr := &fakeTransport{}
 	if tc.usesCb {
 		tr.cbBytes = tc.cbBytes
 	}
-	testStm, _ := authTestSetup(&model.User{Username: "ortuman", Password: "1234"})
+	testStm, _ := authTestSetup(user)
 	defer authTestTeardown()
 
 	authr := NewScram(testStm, tr, tc.scramType, tc.usesCb)
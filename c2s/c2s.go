@@ -25,6 +25,8 @@ const (
 	sessionNamespace          = "urn:ietf:params:xml:ns:xmpp-session"
 	saslNamespace             = "urn:ietf:params:xml:ns:xmpp-sasl"
 	blockedErrorNamespace     = "urn:xmpp:blocking:errors"
+	streamManagementNamespace = "urn:xmpp:sm:3"
+	csiNamespace              = "urn:xmpp:csi:0"
 )
 
 type c2sServer interface {
@@ -6,6 +6,8 @@
 package c2s
 
 import (
+	"crypto/x509"
+	"errors"
 	"fmt"
 	"strings"
 	"time"
@@ -13,6 +15,7 @@ import (
 	"github.com/ortuman/jackal/stream"
 	"github.com/ortuman/jackal/transport"
 	"github.com/ortuman/jackal/transport/compress"
+	"github.com/ortuman/jackal/util"
 )
 
 const (
@@ -21,6 +24,9 @@ const (
 	defaultTransportPort           = 5222
 	defaultTransportKeepAlive      = time.Duration(120) * time.Second
 	defaultTransportURLPath        = "/xmpp/ws"
+	defaultTransportBOSHURLPath    = "/http-bind"
+	defaultSMResumeTimeout         = time.Duration(300) * time.Second
+	defaultSMMaxQueueSize          = 500
 )
 
 // ResourceConflictPolicy represents a resource conflict policy.
@@ -74,14 +80,27 @@ type TransportConfig struct {
 	Port        int
 	KeepAlive   time.Duration
 	URLPath     string
+	DirectTLS   bool
+	BOSH        transport.BOSHConfig
+	Scion       *ScionConfig
 }
 
 type transportProxyType struct {
-	Type        string `yaml:"type"`
-	BindAddress string `yaml:"bind_addr"`
-	Port        int    `yaml:"port"`
-	KeepAlive   int    `yaml:"keep_alive"`
-	URLPath     string `yaml:"url_path"`
+	Type        string        `yaml:"type"`
+	BindAddress string        `yaml:"bind_addr"`
+	Port        int           `yaml:"port"`
+	KeepAlive   int           `yaml:"keep_alive"`
+	URLPath     string        `yaml:"url_path"`
+	DirectTLS   bool          `yaml:"direct_tls"`
+	BOSH        boshProxyType `yaml:"bosh"`
+	Scion       *ScionConfig  `yaml:"scion"`
+}
+
+type boshProxyType struct {
+	Wait           int `yaml:"wait"`
+	Hold           int `yaml:"hold"`
+	Inactivity     int `yaml:"inactivity"`
+	MaxRequestSize int `yaml:"max_request_size"`
 }
 
 // UnmarshalYAML satisfies Unmarshaler interface.
@@ -98,15 +117,44 @@ func (t *TransportConfig) UnmarshalYAML(unmarshal func(interface{}) error) error
 	case "websocket":
 		t.Type = transport.WebSocket
 
+	case "bosh":
+		t.Type = transport.BOSH
+
+	case "quic":
+		t.Type = transport.QUIC
+
 	default:
 		return fmt.Errorf("c2s.TransportConfig: unrecognized transport type: %s", p.Type)
 	}
+	if p.DirectTLS && t.Type != transport.Socket {
+		return fmt.Errorf("c2s.TransportConfig: direct TLS requires socket transport type")
+	}
+	if p.Scion != nil && t.Type != transport.QUIC {
+		return fmt.Errorf("c2s.TransportConfig: SCION addressing requires quic transport type")
+	}
 	t.BindAddress = p.BindAddress
 	t.Port = p.Port
+	t.DirectTLS = p.DirectTLS
+	t.Scion = p.Scion
 
 	t.URLPath = p.URLPath
 	if len(t.URLPath) == 0 {
-		t.URLPath = defaultTransportURLPath
+		if t.Type == transport.BOSH {
+			t.URLPath = defaultTransportBOSHURLPath
+		} else {
+			t.URLPath = defaultTransportURLPath
+		}
+	}
+
+	// validate BOSH settings
+	if p.BOSH.Wait < 0 || p.BOSH.Hold < 0 || p.BOSH.Inactivity < 0 || p.BOSH.MaxRequestSize < 0 {
+		return fmt.Errorf("c2s.TransportConfig: invalid bosh settings")
+	}
+	t.BOSH = transport.BOSHConfig{
+		MaxWait:        time.Duration(p.BOSH.Wait) * time.Second,
+		MaxHold:        p.BOSH.Hold,
+		Inactivity:     time.Duration(p.BOSH.Inactivity) * time.Second,
+		MaxRequestSize: p.BOSH.MaxRequestSize,
 	}
 
 	// assign transport's defaults
@@ -120,10 +168,82 @@ func (t *TransportConfig) UnmarshalYAML(unmarshal func(interface{}) error) error
 	return nil
 }
 
+// ScionConfig represents a SCION QUIC listener configuration.
+type ScionConfig struct {
+	Address    string
+	Dispatcher string
+	Sciond     string
+	Key        string
+	Cert       string
+}
+
+type scionProxyType struct {
+	Address    string `yaml:"addr"`
+	Dispatcher string `yaml:"dispatcher_path"`
+	Sciond     string `yaml:"sciond_path"`
+	Key        string `yaml:"privkey_path"`
+	Cert       string `yaml:"cert_path"`
+}
+
+// UnmarshalYAML satisfies Unmarshaler interface.
+func (c *ScionConfig) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	p := scionProxyType{}
+	if err := unmarshal(&p); err != nil {
+		return err
+	}
+	if len(p.Address) == 0 {
+		return errors.New("c2s.ScionConfig: SCION listening address must be specified")
+	}
+	c.Address = p.Address
+	c.Dispatcher = p.Dispatcher
+	c.Sciond = p.Sciond
+	c.Key = p.Key
+	c.Cert = p.Cert
+	return nil
+}
+
+// StreamManagementConfig represents a stream management (XEP-0198) configuration.
+type StreamManagementConfig struct {
+	Enabled       bool
+	ResumeTimeout time.Duration
+	MaxQueueSize  int
+}
+
+type streamManagementProxyType struct {
+	Enabled       bool `yaml:"enabled"`
+	ResumeTimeout int  `yaml:"resume_timeout"`
+	MaxQueueSize  int  `yaml:"max_queue_size"`
+}
+
+// UnmarshalYAML satisfies Unmarshaler interface.
+func (c *StreamManagementConfig) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	p := streamManagementProxyType{}
+	if err := unmarshal(&p); err != nil {
+		return err
+	}
+	if p.ResumeTimeout < 0 {
+		return fmt.Errorf("c2s.StreamManagementConfig: invalid resume timeout: %d", p.ResumeTimeout)
+	}
+	if p.MaxQueueSize < 0 {
+		return fmt.Errorf("c2s.StreamManagementConfig: invalid max queue size: %d", p.MaxQueueSize)
+	}
+	c.Enabled = p.Enabled
+	c.ResumeTimeout = time.Duration(p.ResumeTimeout) * time.Second
+	if c.ResumeTimeout == 0 {
+		c.ResumeTimeout = defaultSMResumeTimeout
+	}
+	c.MaxQueueSize = p.MaxQueueSize
+	if c.MaxQueueSize == 0 {
+		c.MaxQueueSize = defaultSMMaxQueueSize
+	}
+	return nil
+}
+
 // TLSConfig represents a server TLS configuration.
 type TLSConfig struct {
-	CertFile    string `yaml:"cert_path"`
-	PrivKeyFile string `yaml:"privkey_path"`
+	CertFile     string `yaml:"cert_path"`
+	PrivKeyFile  string `yaml:"privkey_path"`
+	ClientCAFile string `yaml:"client_ca_path"`
 }
 
 // Config represents C2S server configuration.
@@ -134,19 +254,22 @@ type Config struct {
 	ResourceConflict ResourceConflictPolicy
 	Transport        TransportConfig
 	SASL             []string
+	ClientCAs        *x509.CertPool
 	Compression      CompressConfig
+	StreamManagement StreamManagementConfig
 }
 
 type configProxy struct {
-	ID               string          `yaml:"id"`
-	Domain           string          `yaml:"domain"`
-	TLS              TLSConfig       `yaml:"tls"`
-	ConnectTimeout   int             `yaml:"connect_timeout"`
-	MaxStanzaSize    int             `yaml:"max_stanza_size"`
-	ResourceConflict string          `yaml:"resource_conflict"`
-	Transport        TransportConfig `yaml:"transport"`
-	SASL             []string        `yaml:"sasl"`
-	Compression      CompressConfig  `yaml:"compression"`
+	ID               string                 `yaml:"id"`
+	Domain           string                 `yaml:"domain"`
+	TLS              TLSConfig              `yaml:"tls"`
+	ConnectTimeout   int                    `yaml:"connect_timeout"`
+	MaxStanzaSize    int                    `yaml:"max_stanza_size"`
+	ResourceConflict string                 `yaml:"resource_conflict"`
+	Transport        TransportConfig        `yaml:"transport"`
+	SASL             []string               `yaml:"sasl"`
+	Compression      CompressConfig         `yaml:"compression"`
+	StreamManagement StreamManagementConfig `yaml:"stream_management"`
 }
 
 // UnmarshalYAML satisfies Unmarshaler interface.
@@ -182,22 +305,39 @@ func (cfg *Config) UnmarshalYAML(unmarshal func(interface{}) error) error {
 		switch sasl {
 		case "plain", "digest_md5", "scram_sha_1", "scram_sha_256", "scram_sha_512":
 			continue
+		case "external":
+			if len(p.TLS.ClientCAFile) == 0 {
+				return fmt.Errorf("c2s.Config: external SASL mechanism requires a client CA bundle")
+			}
 		default:
 			return fmt.Errorf("c2s.Config: unrecognized SASL mechanism: %s", sasl)
 		}
 	}
+	// load client certificates CA bundle
+	if len(p.TLS.ClientCAFile) > 0 {
+		clientCAs, err := util.LoadCertPool(p.TLS.ClientCAFile)
+		if err != nil {
+			return err
+		}
+		cfg.ClientCAs = clientCAs
+	}
 	cfg.Transport = p.Transport
 	cfg.SASL = p.SASL
 	cfg.Compression = p.Compression
+	cfg.StreamManagement = p.StreamManagement
 	return nil
 }
 
 type streamConfig struct {
+	listenerID       string
 	transport        transport.Transport
 	connectTimeout   time.Duration
 	maxStanzaSize    int
 	resourceConflict ResourceConflictPolicy
 	sasl             []string
+	clientCAs        *x509.CertPool
+	directTLS        bool
 	compression      CompressConfig
+	streamManagement StreamManagementConfig
 	onDisconnect     func(s stream.C2S)
 }
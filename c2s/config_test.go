@@ -54,6 +54,70 @@ func TestTransportConfig(t *testing.T) {
 	require.Equal(t, transport.WebSocket, s.Type)
 	require.Equal(t, 5222, s.Port)
 	require.Equal(t, time.Second*time.Duration(120), s.KeepAlive)
+
+	s = TransportConfig{}
+	err = yaml.Unmarshal([]byte("{type: socket, port: 5223, direct_tls: true}"), &s)
+	require.Nil(t, err)
+	require.True(t, s.DirectTLS)
+
+	err = yaml.Unmarshal([]byte("{type: websocket, direct_tls: true}"), &s)
+	require.NotNil(t, err)
+
+	s = TransportConfig{}
+	err = yaml.Unmarshal([]byte("{type: bosh, port: 5280, bosh: {wait: 30, hold: 2, inactivity: 90}}"), &s)
+	require.Nil(t, err)
+
+	require.Equal(t, transport.BOSH, s.Type)
+	require.Equal(t, "/http-bind", s.URLPath)
+	require.Equal(t, time.Second*time.Duration(30), s.BOSH.MaxWait)
+	require.Equal(t, 2, s.BOSH.MaxHold)
+	require.Equal(t, time.Second*time.Duration(90), s.BOSH.Inactivity)
+
+	err = yaml.Unmarshal([]byte("{type: bosh, bosh: {hold: -1}}"), &s)
+	require.NotNil(t, err)
+
+	s = TransportConfig{}
+	err = yaml.Unmarshal([]byte("{type: quic, port: 5224}"), &s)
+	require.Nil(t, err)
+	require.Equal(t, transport.QUIC, s.Type)
+	require.Equal(t, 5224, s.Port)
+	require.Nil(t, s.Scion)
+
+	s = TransportConfig{}
+	err = yaml.Unmarshal([]byte("{type: quic, scion: {addr: '1-ff00:0:110,[127.0.0.1]', sciond_path: /run/sciond.sock}}"), &s)
+	require.Nil(t, err)
+	require.NotNil(t, s.Scion)
+	require.Equal(t, "1-ff00:0:110,[127.0.0.1]", s.Scion.Address)
+	require.Equal(t, "/run/sciond.sock", s.Scion.Sciond)
+
+	err = yaml.Unmarshal([]byte("{type: quic, scion: {sciond_path: /run/sciond.sock}}"), &s)
+	require.NotNil(t, err)
+
+	err = yaml.Unmarshal([]byte("{type: socket, scion: {addr: '1-ff00:0:110,[127.0.0.1]'}}"), &s)
+	require.NotNil(t, err)
+
+	err = yaml.Unmarshal([]byte("{type: quic, direct_tls: true}"), &s)
+	require.NotNil(t, err)
+}
+
+func TestStreamManagementConfig(t *testing.T) {
+	sm := StreamManagementConfig{}
+	err := yaml.Unmarshal([]byte("{enabled: true}"), &sm)
+	require.Nil(t, err)
+	require.True(t, sm.Enabled)
+	require.Equal(t, defaultSMResumeTimeout, sm.ResumeTimeout)
+	require.Equal(t, defaultSMMaxQueueSize, sm.MaxQueueSize)
+
+	err = yaml.Unmarshal([]byte("{enabled: true, resume_timeout: 60, max_queue_size: 100}"), &sm)
+	require.Nil(t, err)
+	require.Equal(t, time.Second*time.Duration(60), sm.ResumeTimeout)
+	require.Equal(t, 100, sm.MaxQueueSize)
+
+	err = yaml.Unmarshal([]byte("{enabled: true, resume_timeout: -1}"), &sm)
+	require.NotNil(t, err)
+
+	err = yaml.Unmarshal([]byte("enabled"), &sm)
+	require.NotNil(t, err)
 }
 
 func TestConfig(t *testing.T) {
@@ -82,6 +146,18 @@ sasl: [plain, digest_md5, scram_sha_1, scram_sha_256, scram_sha_512]
 	require.Nil(t, err)
 	require.Equal(t, 5, len(s.SASL))
 
+	// external auth mechanism...
+	err = yaml.Unmarshal([]byte("{sasl: [plain, external]}"), &s)
+	require.NotNil(t, err)
+
+	err = yaml.Unmarshal([]byte("{sasl: [plain, external], tls: {client_ca_path: ../testdata/cert/unknown.crt}}"), &s)
+	require.NotNil(t, err)
+
+	err = yaml.Unmarshal([]byte("{sasl: [plain, external], tls: {client_ca_path: ../testdata/cert/test.server.crt}}"), &s)
+	require.Nil(t, err)
+	require.Equal(t, []string{"plain", "external"}, s.SASL)
+	require.NotNil(t, s.ClientCAs)
+
 	// invalid auth mechanism...
 	err = yaml.Unmarshal([]byte("{id: default, type: c2s, sasl: [invalid]}"), &s)
 	require.NotNil(t, err)
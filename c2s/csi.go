@@ -0,0 +1,125 @@
+/*
+ * Copyright (c) 2018 Miguel Ángel Ortuño.
+ * See the LICENSE file for more information.
+ */
+
+package c2s
+
+import (
+	streamerror "github.com/ortuman/jackal/errors"
+	"github.com/ortuman/jackal/log"
+	"github.com/ortuman/jackal/xmpp"
+)
+
+const (
+	chatStatesNamespace = "http://jabber.org/protocol/chatstates"
+	carbonsNamespace    = "urn:xmpp:carbons:2"
+	forwardNamespace    = "urn:xmpp:forward:0"
+)
+
+const csiInactiveCtxKey = "csi:inactive"
+
+// csiState holds client state indication (XEP-0352) state.
+// Every field must be accessed from the stream run queue.
+type csiState struct {
+	inactive  bool
+	queue     []xmpp.XElement
+	presences map[string]int
+}
+
+func (s *inStream) handleClientState(elem xmpp.XElement) {
+	switch elem.Name() {
+	case "active":
+		if !s.csi.inactive {
+			return
+		}
+		s.csi.inactive = false
+		s.setContextValue(csiInactiveCtxKey, false)
+		s.flushClientStateQueue()
+
+		log.Infof("client became active... (%s/%s)", s.Username(), s.Resource())
+
+	case "inactive":
+		if s.csi.inactive {
+			return
+		}
+		s.csi.inactive = true
+		s.csi.presences = make(map[string]int)
+		s.setContextValue(csiInactiveCtxKey, true)
+
+		log.Infof("client became inactive... (%s/%s)", s.Username(), s.Resource())
+
+	default:
+		s.disconnectWithStreamError(streamerror.ErrUnsupportedStanzaType)
+	}
+}
+
+// handleInactiveElement returns true in case element delivery should be deferred
+// or skipped because of client being inactive.
+func (s *inStream) handleInactiveElement(elem xmpp.XElement) bool {
+	switch stanza := elem.(type) {
+	case *xmpp.Presence:
+		if !stanza.IsAvailable() && !stanza.IsUnavailable() {
+			break
+		}
+		// keep only the latest presence from every single sender
+		if i, ok := s.csi.presences[stanza.From()]; ok {
+			s.csi.queue[i] = stanza
+			return true
+		}
+		s.csi.presences[stanza.From()] = len(s.csi.queue)
+		s.csi.queue = append(s.csi.queue, stanza)
+		return true
+
+	case *xmpp.Message:
+		if isChatStateMessage(stanza) {
+			return true // not worth waking up the client
+		}
+	}
+	if elem.IsStanza() {
+		// preserve delivery order before sending an important stanza
+		s.flushClientStateQueue()
+	}
+	return false
+}
+
+func (s *inStream) flushClientStateQueue() {
+	queue := s.csi.queue
+	s.csi.queue = nil
+	s.csi.presences = make(map[string]int)
+
+	for _, elem := range queue {
+		s.writeElement(elem)
+		if s.getState() == disconnected {
+			return
+		}
+	}
+}
+
+func isChatStateMessage(msg xmpp.XElement) bool {
+	e := msg.Elements()
+	if carbon := e.ChildNamespace("received", carbonsNamespace); carbon != nil {
+		return isForwardedChatStateMessage(carbon)
+	}
+	if carbon := e.ChildNamespace("sent", carbonsNamespace); carbon != nil {
+		return isForwardedChatStateMessage(carbon)
+	}
+	if e.Child("body") != nil || e.Child("subject") != nil {
+		return false
+	}
+	for _, child := range e.All() {
+		if child.Namespace() == chatStatesNamespace {
+			return true
+		}
+	}
+	return false
+}
+
+func isForwardedChatStateMessage(carbon xmpp.XElement) bool {
+	forwarded := carbon.Elements().ChildNamespace("forwarded", forwardNamespace)
+	if forwarded == nil {
+		return false
+	}
+	msg := forwarded.Elements().Child("message")
+	return msg != nil && isChatStateMessage(msg)
+}
@@ -0,0 +1,129 @@
+/*
+ * Copyright (c) 2018 Miguel Ángel Ortuño.
+ * See the LICENSE file for more information.
+ */
+
+package c2s
+
+import (
+	"testing"
+	"time"
+
+	"github.com/ortuman/jackal/model"
+	"github.com/ortuman/jackal/storage"
+	"github.com/ortuman/jackal/xmpp"
+	"github.com/ortuman/jackal/xmpp/jid"
+	"github.com/pborman/uuid"
+	"github.com/stretchr/testify/require"
+)
+
+func TestStream_ClientStateFeature(t *testing.T) {
+	r, _, shutdown := setupTest("localhost")
+	defer shutdown()
+
+	storage.InsertOrUpdateUser(&model.User{Username: "user", Password: "pencil"})
+
+	_, conn := tUtilStreamInit(r)
+	tUtilStreamOpen(conn)
+	_ = conn.outboundRead() // read stream opening...
+	_ = conn.outboundRead() // read stream features...
+
+	tUtilStreamAuthenticate(conn, t)
+
+	tUtilStreamOpen(conn)
+	_ = conn.outboundRead() // read stream opening...
+
+	elem := conn.outboundRead()
+	require.Equal(t, "stream:features", elem.Name())
+	require.NotNil(t, elem.Elements().ChildNamespace("csi", csiNamespace))
+}
+
+func TestStream_ClientStateInactive(t *testing.T) {
+	r, _, shutdown := setupTest("localhost")
+	defer shutdown()
+
+	stm, conn := tUtilSMStreamInit(r, time.Minute)
+	tUtilSMStreamBind(conn, t)
+
+	conn.inboundWrite([]byte(`<inactive xmlns="urn:xmpp:csi:0"/>`))
+	time.Sleep(time.Millisecond * 100) // wait until stream internal state changes
+
+	require.True(t, stm.GetBool(csiInactiveCtxKey))
+
+	j1, _ := jid.New("ortuman", "localhost", "garden", true)
+	j2, _ := jid.New("noelia", "localhost", "yard", true)
+
+	// presences must be buffered and deduplicated
+	p1 := xmpp.NewPresence(j1, stm.JID(), xmpp.AvailableType)
+	p2 := xmpp.NewPresence(j2, stm.JID(), xmpp.AvailableType)
+	p3 := xmpp.NewPresence(j1, stm.JID(), xmpp.UnavailableType)
+	stm.SendElement(p1)
+	stm.SendElement(p2)
+	stm.SendElement(p3)
+
+	// chat state notifications must be dropped
+	chatState := xmpp.NewMessageType(uuid.New(), xmpp.ChatType)
+	chatState.SetFromJID(j1)
+	chatState.SetToJID(stm.JID())
+	chatState.AppendElement(xmpp.NewElementNamespace("composing", chatStatesNamespace))
+	stm.SendElement(chatState)
+
+	// important stanzas must flush buffered ones
+	msg := tUtilSMMessage(stm.JID())
+	stm.SendElement(msg)
+
+	elem := conn.outboundRead()
+	require.Equal(t, "presence", elem.Name())
+	require.Equal(t, j1.String(), elem.From())
+	require.Equal(t, xmpp.UnavailableType, elem.Type())
+
+	elem = conn.outboundRead()
+	require.Equal(t, "presence", elem.Name())
+	require.Equal(t, j2.String(), elem.From())
+
+	elem = conn.outboundRead()
+	require.Equal(t, "message", elem.Name())
+	require.Equal(t, msg.ID(), elem.ID())
+
+	// flush on active
+	p4 := xmpp.NewPresence(j2, stm.JID(), xmpp.UnavailableType)
+	stm.SendElement(p4)
+	time.Sleep(time.Millisecond * 100)
+
+	stm.runQueue.Run(func() {
+		require.Equal(t, 1, len(stm.csi.queue))
+	})
+	conn.inboundWrite([]byte(`<active xmlns="urn:xmpp:csi:0"/>`))
+
+	elem = conn.outboundRead()
+	require.Equal(t, "presence", elem.Name())
+	require.Equal(t, j2.String(), elem.From())
+	require.Equal(t, xmpp.UnavailableType, elem.Type())
+
+	time.Sleep(time.Millisecond * 100)
+	require.False(t, stm.GetBool(csiInactiveCtxKey))
+
+	// client is active again
+	stm.SendElement(chatState)
+	elem = conn.outboundRead()
+	require.Equal(t, "message", elem.Name())
+	require.Equal(t, chatState.ID(), elem.ID())
+}
+
+func TestStream_ChatStateMessage(t *testing.T) {
+	msg := xmpp.NewMessageType(uuid.New(), xmpp.ChatType)
+	msg.AppendElement(xmpp.NewElementNamespace("paused", chatStatesNamespace))
+	require.True(t, isChatStateMessage(msg))
+
+	forwarded := xmpp.NewElementNamespace("forwarded", forwardNamespace)
+	forwarded.AppendElement(msg)
+	carbon := xmpp.NewElementNamespace("received", carbonsNamespace)
+	carbon.AppendElement(forwarded)
+	carbonMsg := xmpp.NewMessageType(uuid.New(), xmpp.ChatType)
+	carbonMsg.AppendElement(carbon)
+	require.True(t, isChatStateMessage(carbonMsg))
+
+	msg.AppendElement(xmpp.NewElementName("body"))
+	require.False(t, isChatStateMessage(msg))
+	require.False(t, isChatStateMessage(xmpp.NewMessageType(uuid.New(), xmpp.ChatType)))
+}
@@ -6,7 +6,6 @@
 package c2s
 
 import (
-	"crypto/tls"
 	"sync"
 	"sync/atomic"
 	"time"
@@ -18,6 +17,7 @@ import (
 	"github.com/ortuman/jackal/component"
 	streamerror "github.com/ortuman/jackal/errors"
 	"github.com/ortuman/jackal/log"
+	"github.com/ortuman/jackal/metrics"
 	"github.com/ortuman/jackal/module"
 	"github.com/ortuman/jackal/router"
 	"github.com/ortuman/jackal/session"
@@ -35,9 +35,19 @@ const (
 	authenticating
 	authenticated
 	bound
+	detached
 	disconnected
 )
 
+var stateLabels = map[uint32]string{
+	connecting:     "connecting",
+	connected:      "connected",
+	authenticating: "authenticating",
+	authenticated:  "authenticated",
+	bound:          "bound",
+	detached:       "detached",
+}
+
 type inStream struct {
 	cfg            *streamConfig
 	router         *router.Router
@@ -50,6 +60,9 @@ type inStream struct {
 	authenticators []auth.Authenticator
 	activeAuth     auth.Authenticator
 	runQueue       *runqueue.RunQueue
+	doneCh         chan struct{}
+	sm             smState
+	csi            csiState
 
 	mu            sync.RWMutex
 	jid           *jid.JID
@@ -72,10 +85,13 @@ func newStream(id string, config *streamConfig, mods *module.Modules, comps *com
 		id:       id,
 		context:  make(map[string]interface{}),
 		runQueue: runqueue.New(id),
+		doneCh:   make(chan struct{}),
 	}
 
+	metrics.C2SStreams.WithLabelValues(config.listenerID, stateLabels[connecting]).Inc()
+
 	// initialize stream context
-	secured := !(config.transport.Type() == transport.Socket)
+	secured := !(config.transport.Type() == transport.Socket) || config.directTLS
 	s.setSecured(secured)
 	s.setJID(&jid.JID{})
 
@@ -88,7 +104,7 @@ func newStream(id string, config *streamConfig, mods *module.Modules, comps *com
 	if config.connectTimeout > 0 {
 		s.connectTm = time.AfterFunc(config.connectTimeout, s.connectTimeout)
 	}
-	go s.doRead() // start reading...
+	go s.doRead(s.sess) // start reading...
 
 	return s
 }
@@ -221,7 +237,12 @@ func (s *inStream) SendElement(elem xmpp.XElement) {
 	if s.getState() == disconnected {
 		return
 	}
-	s.runQueue.Run(func() { s.writeElement(elem) })
+	s.runQueue.Run(func() {
+		if s.csi.inactive && s.handleInactiveElement(elem) {
+			return
+		}
+		s.writeElement(elem)
+	})
 }
 
 // Disconnect disconnects remote peer by closing the underlying TCP socket connection.
@@ -259,6 +280,9 @@ func (s *inStream) initializeAuthenticators() {
 		case "scram_sha_512":
 			authenticators = append(authenticators, auth.NewScram(s, tr, auth.ScramSHA512, false))
 			authenticators = append(authenticators, auth.NewScram(s, tr, auth.ScramSHA512, true))
+
+		case "external":
+			authenticators = append(authenticators, auth.NewExternal(s, tr, s.cfg.clientCAs))
 		}
 	}
 	s.authenticators = authenticators
@@ -331,6 +355,9 @@ func (s *inStream) unauthenticatedFeatures() []xmpp.XElement {
 		mechanisms := xmpp.NewElementName("mechanisms")
 		mechanisms.SetNamespace(saslNamespace)
 		for _, ath := range s.authenticators {
+			if _, ok := ath.(*auth.External); ok && len(s.cfg.transport.PeerCertificates()) == 0 {
+				continue // no client certificate presented
+			}
 			mechanism := xmpp.NewElementName("mechanism")
 			mechanism.SetText(ath.Mechanism())
 			mechanisms.AppendElement(mechanism)
@@ -375,6 +402,12 @@ func (s *inStream) authenticatedFeatures() []xmpp.XElement {
 		ver := xmpp.NewElementNamespace("ver", "urn:xmpp:features:rosterver")
 		features = append(features, ver)
 	}
+	if s.cfg.streamManagement.Enabled {
+		sm := xmpp.NewElementNamespace("sm", streamManagementNamespace)
+		features = append(features, sm)
+	}
+	csi := xmpp.NewElementNamespace("csi", csiNamespace)
+	features = append(features, csi)
 	return features
 }
 
@@ -433,6 +466,18 @@ func (s *inStream) handleAuthenticated(elem xmpp.XElement) {
 		}
 		s.compress(elem)
 
+	case "enable", "resume":
+		if elem.Namespace() != streamManagementNamespace || !s.cfg.streamManagement.Enabled {
+			s.disconnectWithStreamError(streamerror.ErrUnsupportedStanzaType)
+			return
+		}
+		if elem.Name() == "resume" {
+			s.resumeStream(elem)
+		} else {
+			// resource binding is required before enabling stream management
+			s.failStreamManagement("unexpected-request")
+		}
+
 	case "iq":
 		iq := elem.(*xmpp.IQ)
 		if len(s.JID().Resource()) == 0 { // Expecting bind
@@ -449,11 +494,22 @@ func (s *inStream) handleBound(elem xmpp.XElement) {
 	if p := s.mods.Ping; p != nil {
 		p.SchedulePing(s)
 	}
+	if elem.Namespace() == streamManagementNamespace && s.cfg.streamManagement.Enabled {
+		s.handleStreamManagement(elem)
+		return
+	}
+	if elem.Namespace() == csiNamespace {
+		s.handleClientState(elem)
+		return
+	}
 	stanza, ok := elem.(xmpp.Stanza)
 	if !ok {
 		s.disconnectWithStreamError(streamerror.ErrUnsupportedStanzaType)
 		return
 	}
+	if s.sm.enabled {
+		s.sm.inH++
+	}
 	// handle session IQ
 	if iq, ok := stanza.(*xmpp.IQ); ok && iq.IsSet() {
 		if iq.Elements().ChildNamespace("session", sessionNamespace) != nil {
@@ -469,7 +525,8 @@ func (s *inStream) handleBound(elem xmpp.XElement) {
 	if comp := s.comps.Get(stanza.ToJID().Domain()); comp != nil { // component stanza?
 		switch stanza := stanza.(type) {
 		case *xmpp.IQ:
-			if di := s.mods.DiscoInfo; di != nil && di.MatchesIQ(stanza) {
+			// answer disco info requests on behalf of components registering a provider
+			if di := s.mods.DiscoInfo; di != nil && di.MatchesIQ(stanza) && di.IsProviderRegistered(comp.Host()) {
 				di.ProcessIQ(stanza)
 				return
 			}
@@ -493,7 +550,7 @@ func (s *inStream) proceedStartTLS(elem xmpp.XElement) {
 	s.setSecured(true)
 	s.writeElement(xmpp.NewElementNamespace("proceed", tlsNamespace))
 
-	s.cfg.transport.StartTLS(&tls.Config{Certificates: s.router.Certificates()}, false)
+	s.cfg.transport.StartTLS(tlsConfig(s.router, s.cfg.clientCAs), false)
 
 	log.Infof("secured stream... id: %s", s.id)
 	s.restartSession()
@@ -555,6 +612,11 @@ func (s *inStream) startAuthentication(elem xmpp.XElement) {
 
 func (s *inStream) continueAuthentication(elem xmpp.XElement, authr auth.Authenticator) error {
 	err := authr.ProcessElement(elem)
+	if err != nil {
+		metrics.SASLAuthentications.WithLabelValues(authr.Mechanism(), metrics.SASLFailure).Inc()
+	} else if authr.Authenticated() {
+		metrics.SASLAuthentications.WithLabelValues(authr.Mechanism(), metrics.SASLSuccess).Inc()
+	}
 	if saslErr, ok := err.(*auth.SASLError); ok {
 		s.failAuthentication(saslErr.Element())
 	} else if err != nil {
@@ -709,6 +771,14 @@ func (s *inStream) processPresence(presence *xmpp.Presence) {
 	if r := s.mods.Roster; r != nil {
 		r.ProcessPresence(presence)
 	}
+	// deliver last published items
+	if pep := s.mods.Pep; pep != nil {
+		pep.ProcessPresence(presence)
+	}
+	// deliver message of the day
+	if sa := s.mods.ServiceAdmin; sa != nil && replyOnBehalf {
+		sa.ProcessPresence(presence)
+	}
 	// deliver offline messages
 	if replyOnBehalf && presence.IsAvailable() && presence.Priority() >= 0 {
 		if off := s.mods.Offline; off != nil {
@@ -718,24 +788,14 @@ func (s *inStream) processPresence(presence *xmpp.Presence) {
 }
 
 func (s *inStream) processMessage(message *xmpp.Message) {
-	msg := message
-
-sendMessage:
-	err := s.router.Route(msg)
+	err := s.mods.RouteMessage(message)
+	if err == nil || err == router.ErrNotAuthenticated {
+		s.router.SendSentCarbons(message)
+	}
 	switch err {
 	case nil:
 		break
-	case router.ErrResourceNotFound:
-		// treat the stanza as if it were addressed to <node@domain>
-		msg, _ = xmpp.NewMessageFromElement(msg, msg.FromJID(), msg.ToJID().ToBareJID())
-		goto sendMessage
-	case router.ErrNotAuthenticated:
-		if off := s.mods.Offline; off != nil {
-			off.ArchiveMessage(message)
-			return
-		}
-		fallthrough
-	case router.ErrNotExistingAccount, router.ErrBlockedJID:
+	case router.ErrNotAuthenticated, router.ErrNotExistingAccount, router.ErrBlockedJID:
 		s.writeElement(message.ServiceUnavailableError())
 	case router.ErrFailedRemoteConnect:
 		s.writeElement(message.RemoteServerNotFoundError())
@@ -745,13 +805,19 @@ sendMessage:
 }
 
 // Runs on it's own goroutine
-func (s *inStream) doRead() {
-	elem, sErr := s.sess.Receive()
+func (s *inStream) doRead(sess *session.Session) {
+	elem, sErr := sess.Receive()
 	if sErr == nil {
-		s.runQueue.Run(func() { s.readElement(elem) })
+		s.runQueue.Run(func() {
+			if sess != s.sess {
+				return // session has been replaced by a resumed one
+			}
+			s.readElement(elem)
+		})
 	} else {
 		s.runQueue.Run(func() {
-			if s.getState() == disconnected {
+			// detached stream transport was closed on our side
+			if st := s.getState(); st == disconnected || st == detached || sess != s.sess {
 				return
 			}
 			s.handleSessionError(sErr)
@@ -760,6 +826,11 @@ func (s *inStream) doRead() {
 }
 
 func (s *inStream) handleSessionError(sErr *session.Error) {
+	// wait for the client to resume the stream in case of connection loss
+	if s.sm.resumable && s.getState() == bound && !sErr.ClosedByPeer && isConnectionLossError(sErr.UnderlyingErr) {
+		s.detach()
+		return
+	}
 	switch err := sErr.UnderlyingErr.(type) {
 	case nil:
 		s.disconnect(nil)
@@ -783,7 +854,24 @@ func (s *inStream) writeStanzaErrorResponse(elem xmpp.XElement, stanzaErr *xmpp.
 }
 
 func (s *inStream) writeElement(elem xmpp.XElement) {
+	if !s.sm.enabled || !elem.IsStanza() {
+		s.sess.Send(elem)
+		return
+	}
+	s.enqueueStanza(elem)
+	if len(s.sm.queue) > s.cfg.streamManagement.MaxQueueSize {
+		if s.getState() == detached {
+			s.disconnectClosingSession(false, true)
+		} else {
+			s.disconnectWithStreamError(streamerror.ErrPolicyViolation)
+		}
+		return
+	}
+	if s.getState() == detached {
+		return
+	}
 	s.sess.Send(elem)
+	s.requestAck()
 }
 
 func (s *inStream) readElement(elem xmpp.XElement) {
@@ -791,17 +879,29 @@ func (s *inStream) readElement(elem xmpp.XElement) {
 		s.handleElement(elem)
 	}
 	if s.getState() != disconnected {
-		go s.doRead() // Keep reading...
+		go s.doRead(s.sess) // Keep reading...
 	}
 }
 
 func (s *inStream) disconnect(err error) {
-	if s.getState() == disconnected {
+	switch s.getState() {
+	case disconnected:
+		return
+	case detached:
+		// underlying transport is already closed
+		s.disconnectClosingSession(false, err != streamerror.ErrSystemShutdown)
 		return
 	}
 	switch err {
 	case nil:
 		s.disconnectClosingSession(false, true)
+	case streamerror.ErrConnectionTimeout:
+		// peer stopped responding... wait for the client to resume the stream
+		if s.sm.resumable && s.getState() == bound {
+			s.detach()
+			return
+		}
+		s.disconnectWithStreamError(streamerror.ErrConnectionTimeout)
 	default:
 		if stmErr, ok := err.(*streamerror.Error); ok {
 			s.disconnectWithStreamError(stmErr)
@@ -829,13 +929,29 @@ func (s *inStream) disconnectClosingSession(closeSession, unbind bool) {
 	}
 	// send 'unavailable' presence when disconnecting
 	if presence := s.Presence(); presence != nil && presence.IsAvailable() {
+		unavailable := xmpp.NewPresence(s.JID(), s.JID().ToBareJID(), xmpp.UnavailableType)
 		if r := s.mods.Roster; r != nil {
-			r.ProcessPresence(xmpp.NewPresence(s.JID(), s.JID().ToBareJID(), xmpp.UnavailableType))
+			r.ProcessPresence(unavailable)
+		}
+		if pep := s.mods.Pep; pep != nil {
+			pep.ProcessPresence(unavailable)
 		}
 	}
 	if closeSession {
 		_ = s.sess.Close()
 	}
+	// stop waiting for resumption
+	if s.sm.resumeTm != nil {
+		s.sm.resumeTm.Stop()
+		s.sm.resumeTm = nil
+	}
+	if s.sm.resumable {
+		resumableStreams.Delete(s.sm.id)
+	}
+	// re-route non acknowledged messages to offline storage
+	if s.sm.enabled {
+		s.archiveUnackedMessages()
+	}
 	// unregister stream
 	if unbind {
 		s.router.Unbind(s.JID())
@@ -846,10 +962,23 @@ func (s *inStream) disconnectClosingSession(closeSession, unbind bool) {
 	}
 	s.setState(disconnected)
 	_ = s.cfg.transport.Close()
+	close(s.doneCh)
 
 	s.runQueue.Stop(nil) // stop processing messages
 }
 
+func isConnectionLossError(err error) bool {
+	switch err {
+	case nil, streamerror.ErrConnectionTimeout:
+		return true
+	}
+	switch err.(type) {
+	case *streamerror.Error, *xmpp.StanzaError:
+		return false
+	}
+	return true
+}
+
 func (s *inStream) isBlockedJID(j *jid.JID) bool {
 	if j.IsServer() && s.router.IsLocalHost(j.Domain()) {
 		return false
@@ -945,7 +1074,14 @@ func (s *inStream) setSessionStarted(sessStarted bool) {
 }
 
 func (s *inStream) setState(state uint32) {
-	atomic.StoreUint32(&s.state, state)
+	prevState := atomic.SwapUint32(&s.state, state)
+	if prevState == state || prevState == disconnected {
+		return
+	}
+	metrics.C2SStreams.WithLabelValues(s.cfg.listenerID, stateLabels[prevState]).Dec()
+	if state != disconnected {
+		metrics.C2SStreams.WithLabelValues(s.cfg.listenerID, stateLabels[state]).Inc()
+	}
 }
 
 func (s *inStream) getState() uint32 {
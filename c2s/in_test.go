@@ -6,6 +6,7 @@
 package c2s
 
 import (
+	"crypto/x509"
 	"testing"
 	"time"
 
@@ -71,7 +72,13 @@ func TestStream_Features(t *testing.T) {
 
 	elem = conn2.outboundRead()
 	require.Equal(t, "stream:features", elem.Name())
-	require.NotNil(t, elem.Elements().ChildNamespace("mechanisms", saslNamespace))
+	mechanisms := elem.Elements().ChildNamespace("mechanisms", saslNamespace)
+	require.NotNil(t, mechanisms)
+
+	// EXTERNAL is not offered if no client certificate has been presented
+	for _, mechanism := range mechanisms.Elements().All() {
+		require.NotEqual(t, "EXTERNAL", mechanism.Text())
+	}
 }
 
 func TestStream_TLS(t *testing.T) {
@@ -436,7 +443,8 @@ func tUtilInStreamDefaultConfig(tr transport.Transport) *streamConfig {
 		maxStanzaSize:    8192,
 		resourceConflict: Reject,
 		compression:      CompressConfig{Level: compress.DefaultCompression},
-		sasl:             []string{"plain", "digest_md5", "scram_sha_1", "scram_sha_256", "scram_sha_512"},
+		sasl:             []string{"plain", "digest_md5", "scram_sha_1", "scram_sha_256", "scram_sha_512", "external"},
+		clientCAs:        x509.NewCertPool(),
 	}
 }
 
@@ -8,6 +8,7 @@ package c2s
 import (
 	"context"
 	"crypto/tls"
+	"crypto/x509"
 	"fmt"
 	"net"
 	"net/http"
@@ -16,6 +17,7 @@ import (
 	"sync/atomic"
 
 	"github.com/gorilla/websocket"
+	"github.com/lucas-clemente/quic-go"
 	"github.com/ortuman/jackal/component"
 	streamerror "github.com/ortuman/jackal/errors"
 	"github.com/ortuman/jackal/log"
@@ -23,10 +25,18 @@ import (
 	"github.com/ortuman/jackal/router"
 	"github.com/ortuman/jackal/stream"
 	"github.com/ortuman/jackal/transport"
+	"github.com/scionproto/scion/go/lib/addr"
+	"github.com/scionproto/scion/go/lib/snet"
+	"github.com/scionproto/scion/go/lib/snet/squic"
+	"github.com/scionproto/scion/go/lib/sock/reliable"
 )
 
+const directTLSProtocol = "xmpp-client"
+
 var listenerProvider = net.Listen
 
+var quicListenerProvider = quic.ListenAddr
+
 type server struct {
 	cfg        *Config
 	mods       *module.Modules
@@ -34,8 +44,11 @@ type server struct {
 	router     *router.Router
 	inConns    sync.Map
 	ln         net.Listener
+	quicLn     quic.Listener
 	wsSrv      *http.Server
 	wsUpgrader *websocket.Upgrader
+	boshSrv    *http.Server
+	boshMgr    *transport.BOSHManager
 	stmSeq     uint64
 	listening  uint32
 }
@@ -54,6 +67,10 @@ func (s *server) start() {
 	case transport.WebSocket:
 		err = s.listenWebSocketConn(address)
 		break
+	case transport.BOSH:
+		err = s.listenBOSHConn(address)
+	case transport.QUIC:
+		err = s.listenQUICConn(address)
 	}
 	if err != nil {
 		log.Fatalf("%v", err)
@@ -65,6 +82,12 @@ func (s *server) listenSocketConn(address string) error {
 	if err != nil {
 		return err
 	}
+	if s.cfg.Transport.DirectTLS {
+		// XEP-0368: SRV records for XMPP over TLS
+		tlsCfg := tlsConfig(s.router, s.cfg.ClientCAs)
+		tlsCfg.NextProtos = []string{directTLSProtocol}
+		ln = tls.NewListener(ln, tlsCfg)
+	}
 	s.ln = ln
 
 	atomic.StoreUint32(&s.listening, 1)
@@ -81,7 +104,7 @@ func (s *server) listenSocketConn(address string) error {
 func (s *server) listenWebSocketConn(address string) error {
 	http.HandleFunc(s.cfg.Transport.URLPath, s.websocketUpgrade)
 
-	s.wsSrv = &http.Server{TLSConfig: &tls.Config{Certificates: s.router.Certificates()}}
+	s.wsSrv = &http.Server{TLSConfig: tlsConfig(s.router, s.cfg.ClientCAs)}
 	s.wsUpgrader = &websocket.Upgrader{
 		Subprotocols: []string{"xmpp"},
 		CheckOrigin:  func(r *http.Request) bool { return r.Header.Get("Sec-WebSocket-Protocol") == "xmpp" },
@@ -105,6 +128,81 @@ func (s *server) websocketUpgrade(w http.ResponseWriter, r *http.Request) {
 	s.startStream(transport.NewWebSocketTransport(conn, s.cfg.Transport.KeepAlive))
 }
 
+func (s *server) listenBOSHConn(address string) error {
+	s.boshMgr = transport.NewBOSHManager(&s.cfg.Transport.BOSH, s.startStream)
+
+	mux := http.NewServeMux()
+	mux.Handle(s.cfg.Transport.URLPath, s.boshMgr)
+
+	s.boshSrv = &http.Server{
+		Handler:   mux,
+		TLSConfig: tlsConfig(s.router, nil),
+	}
+	// start listening
+	ln, err := listenerProvider("tcp", address)
+	if err != nil {
+		return err
+	}
+	atomic.StoreUint32(&s.listening, 1)
+	return s.boshSrv.ServeTLS(ln, "", "")
+}
+
+func (s *server) listenQUICConn(address string) error {
+	quicCfg := &quic.Config{KeepAlive: true}
+
+	var ln quic.Listener
+	var err error
+	if scionCfg := s.cfg.Transport.Scion; scionCfg != nil {
+		ln, err = listenSCION(scionCfg, s.cfg.Transport.Port, quicCfg)
+	} else {
+		tlsCfg := tlsConfig(s.router, s.cfg.ClientCAs)
+		tlsCfg.NextProtos = []string{directTLSProtocol}
+		ln, err = quicListenerProvider(address, tlsCfg, quicCfg)
+	}
+	if err != nil {
+		return err
+	}
+	s.quicLn = ln
+
+	atomic.StoreUint32(&s.listening, 1)
+	for atomic.LoadUint32(&s.listening) == 1 {
+		sess, err := ln.Accept()
+		if err == nil {
+			go s.acceptQUICStream(sess)
+			continue
+		}
+	}
+	return nil
+}
+
+func (s *server) acceptQUICStream(sess quic.Session) {
+	// client opens a single bidirectional stream carrying the XML stream
+	stm, err := sess.AcceptStream()
+	if err != nil {
+		log.Error(err)
+		sess.Close()
+		return
+	}
+	s.startStream(transport.NewQUICSocketTransport(sess, stm, s.cfg.Transport.KeepAlive))
+}
+
+func listenSCION(cfg *ScionConfig, port int, quicCfg *quic.Config) (quic.Listener, error) {
+	address, err := snet.AddrFromString(cfg.Address)
+	if err != nil {
+		return nil, err
+	}
+	address.Host.L4 = addr.NewL4UDPInfo(uint16(port))
+
+	network, err := snet.NewNetwork(address.IA, cfg.Sciond, reliable.NewDispatcherService(cfg.Dispatcher))
+	if err != nil {
+		return nil, err
+	}
+	if err := squic.Init(cfg.Key, cfg.Cert); err != nil {
+		return nil, err
+	}
+	return squic.ListenSCION(network, address, quicCfg)
+}
+
 func (s *server) shutdown(ctx context.Context) error {
 	if atomic.CompareAndSwapUint32(&s.listening, 1, 0) {
 		// stop listening
@@ -117,6 +215,14 @@ func (s *server) shutdown(ctx context.Context) error {
 			if err := s.wsSrv.Shutdown(ctx); err != nil {
 				return err
 			}
+		case transport.QUIC:
+			if err := s.quicLn.Close(); err != nil {
+				return err
+			}
+		case transport.BOSH:
+			// held requests must still be answered while closing sessions,
+			// so HTTP server shutdown is deferred until then.
+			s.boshMgr.Close()
 		}
 		// close all connections
 		c, err := closeConnections(ctx, &s.inConns)
@@ -124,18 +230,29 @@ func (s *server) shutdown(ctx context.Context) error {
 			return err
 		}
 		log.Infof("%s: closed %d connection(s)", s.cfg.ID, c)
+
+		// held BOSH requests are answered once their sessions have been closed
+		if s.cfg.Transport.Type == transport.BOSH {
+			if err := s.boshSrv.Shutdown(ctx); err != nil {
+				return err
+			}
+		}
 	}
 	return nil
 }
 
 func (s *server) startStream(tr transport.Transport) {
 	cfg := &streamConfig{
+		listenerID:       s.cfg.ID,
 		transport:        tr,
 		resourceConflict: s.cfg.ResourceConflict,
 		connectTimeout:   s.cfg.ConnectTimeout,
 		maxStanzaSize:    s.cfg.MaxStanzaSize,
 		sasl:             s.cfg.SASL,
+		clientCAs:        s.cfg.ClientCAs,
+		directTLS:        s.cfg.Transport.DirectTLS,
 		compression:      s.cfg.Compression,
+		streamManagement: s.cfg.StreamManagement,
 		onDisconnect:     s.unregisterStream,
 	}
 	stm := newStream(s.nextID(), cfg, s.mods, s.comps, s.router)
@@ -156,6 +273,20 @@ func (s *server) nextID() string {
 	return fmt.Sprintf("c2s:%s:%d", s.cfg.ID, atomic.AddUint64(&s.stmSeq, 1))
 }
 
+func tlsConfig(r *router.Router, clientCAs *x509.CertPool) *tls.Config {
+	cfg := &tls.Config{
+		Certificates:   r.Certificates(),
+		GetCertificate: r.GetCertificate,
+	}
+	if clientCAs != nil {
+		// client certificates are verified during SASL EXTERNAL authentication,
+		// so that password based mechanisms remain available to any client.
+		cfg.ClientAuth = tls.RequestClientCert
+		cfg.ClientCAs = clientCAs
+	}
+	return cfg
+}
+
 func closeConnections(ctx context.Context, connections *sync.Map) (count int, err error) {
 	connections.Range(func(_, v interface{}) bool {
 		stm := v.(stream.InStream)
@@ -8,19 +8,26 @@ package c2s
 import (
 	"context"
 	"crypto/tls"
+	"errors"
+	"io"
+	"io/ioutil"
 	"net"
 	"net/http"
+	"strings"
 	"testing"
 	"time"
 
 	"github.com/gorilla/websocket"
+	"github.com/lucas-clemente/quic-go"
 	"github.com/ortuman/jackal/component"
+	"github.com/ortuman/jackal/model"
 	"github.com/ortuman/jackal/module"
 	"github.com/ortuman/jackal/router"
 	"github.com/ortuman/jackal/storage"
 	"github.com/ortuman/jackal/storage/memstorage"
 	"github.com/ortuman/jackal/transport"
 	"github.com/ortuman/jackal/util"
+	"github.com/ortuman/jackal/xmpp"
 	"github.com/stretchr/testify/require"
 )
 
@@ -71,6 +78,77 @@ func TestC2SSocketServer(t *testing.T) {
 	require.Nil(t, err)
 }
 
+func TestC2SDirectTLSServer(t *testing.T) {
+	privKeyFile := "../testdata/cert/test.server.key"
+	certFile := "../testdata/cert/test.server.crt"
+	cer, err := util.LoadCertificate(privKeyFile, certFile, "localhost")
+	require.Nil(t, err)
+
+	r, _ := router.New(&router.Config{
+		Hosts: []router.HostConfig{{Name: "localhost", Certificate: cer}},
+	})
+	s := memstorage.New()
+	storage.Set(s)
+	defer storage.Unset()
+
+	cfg := Config{
+		ID:               "srv-1234",
+		ConnectTimeout:   time.Second * time.Duration(5),
+		MaxStanzaSize:    8192,
+		ResourceConflict: Reject,
+		SASL:             []string{"plain"},
+		Transport: TransportConfig{
+			Type:      transport.Socket,
+			Port:      9996,
+			DirectTLS: true,
+		},
+	}
+	srv := server{cfg: &cfg, router: r, mods: &module.Modules{}, comps: &component.Components{}}
+	go srv.start()
+	defer func() {
+		ctx, cancel := context.WithDeadline(context.Background(), time.Now().Add(time.Second*5))
+		defer cancel()
+		srv.shutdown(ctx)
+	}()
+
+	time.Sleep(time.Millisecond * 150)
+
+	conn, err := tls.Dial("tcp", "127.0.0.1:9996", &tls.Config{
+		ServerName:         "localhost",
+		NextProtos:         []string{"xmpp-client"},
+		InsecureSkipVerify: true,
+	})
+	require.Nil(t, err)
+	defer conn.Close()
+
+	st := conn.ConnectionState()
+	require.Equal(t, "xmpp-client", st.NegotiatedProtocol)
+	require.Equal(t, 1, len(st.PeerCertificates))
+	require.Equal(t, "localhost", st.PeerCertificates[0].Subject.CommonName)
+
+	_, err = conn.Write([]byte(`<?xml version="1.0"?><stream:stream xmlns:stream="http://etherx.jabber.org/streams" xmlns="jabber:client" version="1.0" to="localhost">`))
+	require.Nil(t, err)
+
+	// stream starts already secured
+	p := xmpp.NewParser(conn, xmpp.SocketStream, 0)
+	readElement := func() xmpp.XElement {
+		for {
+			elem, err := p.ParseElement()
+			require.Nil(t, err)
+			if elem != nil {
+				return elem
+			}
+		}
+	}
+	elem := readElement()
+	require.Equal(t, "stream:stream", elem.Name())
+
+	elem = readElement()
+	require.Equal(t, "stream:features", elem.Name())
+	require.Nil(t, elem.Elements().ChildNamespace("starttls", tlsNamespace))
+	require.NotNil(t, elem.Elements().ChildNamespace("mechanisms", saslNamespace))
+}
+
 func TestC2SWebSocketServer(t *testing.T) {
 	privKeyFile := "../testdata/cert/test.server.key"
 	certFile := "../testdata/cert/test.server.crt"
@@ -129,3 +207,181 @@ func TestC2SWebSocketServer(t *testing.T) {
 	err = <-errCh
 	require.Nil(t, err)
 }
+
+func TestC2SBOSHServer(t *testing.T) {
+	privKeyFile := "../testdata/cert/test.server.key"
+	certFile := "../testdata/cert/test.server.crt"
+	cer, err := util.LoadCertificate(privKeyFile, certFile, "localhost")
+	require.Nil(t, err)
+
+	r, _ := router.New(&router.Config{
+		Hosts: []router.HostConfig{{Name: "localhost", Certificate: cer}},
+	})
+	s := memstorage.New()
+	storage.Set(s)
+	defer storage.Unset()
+
+	usr := model.User{Username: "ortuman"}
+	_ = usr.SetPassword("1234")
+	_ = storage.InsertOrUpdateUser(&usr)
+
+	cfg := Config{
+		ID:               "srv-1234",
+		ConnectTimeout:   time.Second * time.Duration(5),
+		MaxStanzaSize:    8192,
+		ResourceConflict: Reject,
+		SASL:             []string{"plain"},
+		Transport: TransportConfig{
+			Type:    transport.BOSH,
+			URLPath: "/http-bind",
+			Port:    9997,
+			BOSH:    transport.BOSHConfig{MaxWait: time.Second * 5, MaxHold: 1},
+		},
+	}
+	srv := server{cfg: &cfg, router: r, mods: &module.Modules{}, comps: &component.Components{}}
+	go srv.start()
+
+	time.Sleep(time.Millisecond * 150)
+
+	client := &http.Client{Transport: &http.Transport{TLSClientConfig: &tls.Config{InsecureSkipVerify: true}}}
+	post := func(body string) xmpp.XElement {
+		resp, err := client.Post("https://127.0.0.1:9997/http-bind", "text/xml; charset=utf-8", strings.NewReader(body))
+		require.Nil(t, err)
+		defer resp.Body.Close()
+		require.Equal(t, http.StatusOK, resp.StatusCode)
+
+		elem, err := xmpp.NewParser(resp.Body, xmpp.DefaultMode, 0).ParseElement()
+		require.Nil(t, err)
+		return elem
+	}
+	// session creation
+	resp := post(`<body xmlns="http://jabber.org/protocol/httpbind" rid="1" to="localhost" wait="5" hold="1" xmpp:version="1.0" xmlns:xmpp="urn:xmpp:xbosh"/>`)
+	sid := resp.Attributes().Get("sid")
+	require.NotEmpty(t, sid)
+	features := resp.Elements().Child("stream:features")
+	require.NotNil(t, features)
+	require.NotNil(t, features.Elements().ChildNamespace("mechanisms", saslNamespace))
+
+	// authenticate
+	resp = post(`<body xmlns="http://jabber.org/protocol/httpbind" rid="2" sid="` + sid + `"><auth xmlns="urn:ietf:params:xml:ns:xmpp-sasl" mechanism="PLAIN">AG9ydHVtYW4AMTIzNA==</auth></body>`)
+	require.NotNil(t, resp.Elements().ChildNamespace("success", saslNamespace))
+
+	// restart stream
+	resp = post(`<body xmlns="http://jabber.org/protocol/httpbind" rid="3" sid="` + sid + `" to="localhost" xmpp:restart="true" xmlns:xmpp="urn:xmpp:xbosh"/>`)
+	features = resp.Elements().Child("stream:features")
+	require.NotNil(t, features)
+	require.NotNil(t, features.Elements().ChildNamespace("bind", "urn:ietf:params:xml:ns:xmpp-bind"))
+
+	// bind resource
+	resp = post(`<body xmlns="http://jabber.org/protocol/httpbind" rid="4" sid="` + sid + `"><iq xmlns="jabber:client" type="set" id="bind_1"><bind xmlns="urn:ietf:params:xml:ns:xmpp-bind"><resource>balcony</resource></bind></iq></body>`)
+	iq := resp.Elements().Child("iq")
+	require.NotNil(t, iq)
+	require.Equal(t, xmpp.ResultType, iq.Type())
+	require.Equal(t, "ortuman@localhost/balcony", iq.Elements().Child("bind").Elements().Child("jid").Text())
+
+	// terminate session
+	resp = post(`<body xmlns="http://jabber.org/protocol/httpbind" rid="5" sid="` + sid + `" type="terminate"><presence xmlns="jabber:client" type="unavailable"/></body>`)
+	require.Equal(t, "terminate", resp.Type())
+
+	ctx, cancel := context.WithDeadline(context.Background(), time.Now().Add(time.Second*5))
+	defer cancel()
+	require.Nil(t, srv.shutdown(ctx))
+}
+
+type fakeQUICStream struct {
+	quic.Stream
+	conn net.Conn
+}
+
+func (s *fakeQUICStream) Read(b []byte) (int, error)        { return s.conn.Read(b) }
+func (s *fakeQUICStream) Write(b []byte) (int, error)       { return s.conn.Write(b) }
+func (s *fakeQUICStream) Close() error                      { return s.conn.Close() }
+func (s *fakeQUICStream) SetReadDeadline(t time.Time) error { return s.conn.SetReadDeadline(t) }
+
+type fakeQUICSession struct {
+	quic.Session
+	stm *fakeQUICStream
+}
+
+func (s *fakeQUICSession) AcceptStream() (quic.Stream, error)   { return s.stm, nil }
+func (s *fakeQUICSession) Close() error                         { return nil }
+func (s *fakeQUICSession) ConnectionState() tls.ConnectionState { return tls.ConnectionState{} }
+
+type fakeQUICListener struct {
+	sessCh  chan quic.Session
+	closeCh chan struct{}
+}
+
+func (l *fakeQUICListener) Accept() (quic.Session, error) {
+	select {
+	case sess := <-l.sessCh:
+		return sess, nil
+	case <-l.closeCh:
+		return nil, errors.New("listener closed")
+	}
+}
+
+func (l *fakeQUICListener) Close() error {
+	close(l.closeCh)
+	return nil
+}
+
+func (l *fakeQUICListener) Addr() net.Addr { return nil }
+
+func TestC2SQUICServer(t *testing.T) {
+	r, _, shutdown := setupTest("localhost")
+	defer shutdown()
+
+	ln := &fakeQUICListener{sessCh: make(chan quic.Session, 1), closeCh: make(chan struct{})}
+	var lnAddr string
+	quicListenerProvider = func(addr string, tlsConf *tls.Config, config *quic.Config) (quic.Listener, error) {
+		lnAddr = addr
+		require.Equal(t, []string{directTLSProtocol}, tlsConf.NextProtos)
+		return ln, nil
+	}
+	defer func() { quicListenerProvider = quic.ListenAddr }()
+
+	cfg := Config{
+		ID:               "srv-1234",
+		ConnectTimeout:   time.Second * time.Duration(5),
+		MaxStanzaSize:    8192,
+		ResourceConflict: Reject,
+		SASL:             []string{"plain"},
+		Transport: TransportConfig{
+			Type: transport.QUIC,
+			Port: 9994,
+		},
+	}
+	srv := server{cfg: &cfg, router: r, mods: &module.Modules{}, comps: &component.Components{}}
+	go srv.start()
+
+	cliConn, srvConn := net.Pipe()
+	defer cliConn.Close()
+	ln.sessCh <- &fakeQUICSession{stm: &fakeQUICStream{conn: srvConn}}
+
+	go func() {
+		_, _ = cliConn.Write([]byte(`<?xml version="1.0" encoding="UTF-8"?><stream:stream to="localhost" xmlns="jabber:client" xmlns:stream="http://etherx.jabber.org/streams" version="1.0">`))
+	}()
+	cliConn.SetReadDeadline(time.Now().Add(time.Second * 5))
+	p := xmpp.NewParser(cliConn, xmpp.SocketStream, 0)
+
+	var features xmpp.XElement
+	for features == nil {
+		elem, err := p.ParseElement()
+		require.Nil(t, err)
+		if elem != nil && elem.Name() == "stream:features" {
+			features = elem
+		}
+	}
+	require.Equal(t, ":9994", lnAddr)
+
+	// QUIC connections are secured from the very beginning...
+	require.Nil(t, features.Elements().ChildNamespace("starttls", tlsNamespace))
+	require.NotNil(t, features.Elements().ChildNamespace("mechanisms", saslNamespace))
+
+	go io.Copy(ioutil.Discard, cliConn)
+
+	ctx, cancel := context.WithDeadline(context.Background(), time.Now().Add(time.Second*5))
+	defer cancel()
+	require.Nil(t, srv.shutdown(ctx))
+}
@@ -0,0 +1,236 @@
+/*
+ * Copyright (c) 2018 Miguel Ángel Ortuño.
+ * See the LICENSE file for more information.
+ */
+
+package c2s
+
+import (
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/ortuman/jackal/log"
+	"github.com/ortuman/jackal/xmpp"
+	"github.com/pborman/uuid"
+)
+
+// resumableStreams holds every stream that can be resumed, indexed by its stream management identifier.
+var resumableStreams sync.Map
+
+type smQueueItem struct {
+	h    uint32
+	elem xmpp.XElement
+}
+
+// smState holds stream management (XEP-0198) state.
+// Every field must be accessed from the stream run queue.
+type smState struct {
+	enabled    bool
+	resumable  bool
+	id         string
+	inH        uint32
+	outH       uint32
+	queue      []smQueueItem
+	ackPending bool
+	resumeTm   *time.Timer
+}
+
+func (s *inStream) handleStreamManagement(elem xmpp.XElement) {
+	switch elem.Name() {
+	case "enable":
+		s.enableStreamManagement(elem)
+	case "r":
+		if !s.sm.enabled {
+			s.failStreamManagement("unexpected-request")
+			return
+		}
+		a := xmpp.NewElementNamespace("a", streamManagementNamespace)
+		a.SetAttribute("h", strconv.FormatUint(uint64(s.sm.inH), 10))
+		s.writeElement(a)
+	case "a":
+		if !s.sm.enabled {
+			s.failStreamManagement("unexpected-request")
+			return
+		}
+		h, err := strconv.ParseUint(elem.Attributes().Get("h"), 10, 32)
+		if err != nil {
+			return
+		}
+		s.ackStanzas(uint32(h))
+		s.sm.ackPending = false
+	default:
+		s.failStreamManagement("unexpected-request")
+	}
+}
+
+func (s *inStream) enableStreamManagement(elem xmpp.XElement) {
+	if s.sm.enabled || s.getState() != bound {
+		s.failStreamManagement("unexpected-request")
+		return
+	}
+	s.sm.enabled = true
+
+	enabled := xmpp.NewElementNamespace("enabled", streamManagementNamespace)
+	if resume := elem.Attributes().Get("resume"); resume == "true" || resume == "1" {
+		s.sm.resumable = true
+		s.sm.id = uuid.New()
+		resumableStreams.Store(s.sm.id, s)
+
+		enabled.SetAttribute("id", s.sm.id)
+		enabled.SetAttribute("resume", "true")
+		enabled.SetAttribute("max", strconv.Itoa(int(s.cfg.streamManagement.ResumeTimeout.Seconds())))
+	}
+	s.writeElement(enabled)
+
+	log.Infof("enabled stream management... id: %s (resumable: %v)", s.id, s.sm.resumable)
+}
+
+func (s *inStream) resumeStream(elem xmpp.XElement) {
+	previd := elem.Attributes().Get("previd")
+	h, err := strconv.ParseUint(elem.Attributes().Get("h"), 10, 32)
+	if err != nil {
+		s.failStreamManagement("bad-request")
+		return
+	}
+	v, ok := resumableStreams.Load(previd)
+	if !ok {
+		s.failStreamManagement("item-not-found")
+		return
+	}
+	stm := v.(*inStream)
+	if stm.Username() != s.Username() || stm.Domain() != s.Domain() {
+		s.failStreamManagement("item-not-found")
+		return
+	}
+	if !stm.resume(s, uint32(h)) {
+		s.failStreamManagement("item-not-found")
+		return
+	}
+	// transport has been handed over to the resumed stream...
+	s.setState(disconnected)
+	if s.cfg.onDisconnect != nil {
+		s.cfg.onDisconnect(s)
+	}
+	s.runQueue.Stop(nil)
+}
+
+// resume takes over newStm transport and session, retransmitting
+// every non acknowledged stanza.
+func (s *inStream) resume(newStm *inStream, h uint32) bool {
+	resCh := make(chan bool, 1)
+	s.runQueue.Run(func() {
+		switch s.getState() {
+		case bound, detached:
+			break
+		default:
+			resCh <- false
+			return
+		}
+		if s.sm.resumeTm != nil {
+			s.sm.resumeTm.Stop()
+			s.sm.resumeTm = nil
+		}
+		if s.getState() == bound {
+			// previous connection is still alive... close it.
+			_ = s.cfg.transport.Close()
+		}
+		s.cfg.transport = newStm.cfg.transport
+		s.sess = newStm.sess
+		s.sess.SetJID(s.JID())
+		s.setSecured(newStm.IsSecured())
+		s.setCompressed(newStm.isCompressed())
+		s.setState(bound)
+
+		s.ackStanzas(h)
+
+		resumed := xmpp.NewElementNamespace("resumed", streamManagementNamespace)
+		resumed.SetAttribute("previd", s.sm.id)
+		resumed.SetAttribute("h", strconv.FormatUint(uint64(s.sm.inH), 10))
+		s.sess.Send(resumed)
+
+		// retransmit non acknowledged stanzas
+		for _, itm := range s.sm.queue {
+			s.sess.Send(itm.elem)
+		}
+		s.sm.ackPending = false
+		if len(s.sm.queue) > 0 {
+			s.requestAck()
+		}
+		if p := s.mods.Ping; p != nil {
+			p.SchedulePing(s)
+		}
+		log.Infof("resumed stream... id: %s (transport stream: %s)", s.id, newStm.id)
+
+		resCh <- true
+		go s.doRead(s.sess)
+	})
+	select {
+	case ok := <-resCh:
+		return ok
+	case <-s.doneCh:
+		return false
+	}
+}
+
+func (s *inStream) detach() {
+	if p := s.mods.Ping; p != nil {
+		p.CancelPing(s)
+	}
+	_ = s.cfg.transport.Close()
+	s.setState(detached)
+
+	s.sm.resumeTm = time.AfterFunc(s.cfg.streamManagement.ResumeTimeout, s.resumeTimeout)
+
+	log.Infof("detached resumable stream... id: %s", s.id)
+}
+
+func (s *inStream) resumeTimeout() {
+	s.runQueue.Run(func() {
+		if s.getState() != detached {
+			return
+		}
+		log.Infof("stream resumption timed out... id: %s", s.id)
+		s.disconnectClosingSession(false, true)
+	})
+}
+
+func (s *inStream) enqueueStanza(elem xmpp.XElement) {
+	s.sm.outH++
+	s.sm.queue = append(s.sm.queue, smQueueItem{h: s.sm.outH, elem: elem})
+}
+
+func (s *inStream) ackStanzas(h uint32) {
+	var i int
+	for i < len(s.sm.queue) && int32(h-s.sm.queue[i].h) >= 0 {
+		i++
+	}
+	s.sm.queue = s.sm.queue[i:]
+}
+
+func (s *inStream) requestAck() {
+	if s.sm.ackPending {
+		return
+	}
+	s.sm.ackPending = true
+	s.sess.Send(xmpp.NewElementNamespace("r", streamManagementNamespace))
+}
+
+// archiveUnackedMessages sends every non acknowledged message to the offline storage.
+func (s *inStream) archiveUnackedMessages() {
+	off := s.mods.Offline
+	for _, itm := range s.sm.queue {
+		msg, ok := itm.elem.(*xmpp.Message)
+		if !ok || off == nil {
+			continue
+		}
+		off.ArchiveMessage(msg)
+	}
+	s.sm.queue = nil
+}
+
+func (s *inStream) failStreamManagement(reason string) {
+	failed := xmpp.NewElementNamespace("failed", streamManagementNamespace)
+	failed.AppendElement(xmpp.NewElementNamespace(reason, "urn:ietf:params:xml:ns:xmpp-stanzas"))
+	s.writeElement(failed)
+}
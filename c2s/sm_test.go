@@ -0,0 +1,268 @@
+/*
+ * Copyright (c) 2018 Miguel Ángel Ortuño.
+ * See the LICENSE file for more information.
+ */
+
+package c2s
+
+import (
+	"testing"
+	"time"
+
+	"github.com/ortuman/jackal/component"
+	streamerror "github.com/ortuman/jackal/errors"
+	"github.com/ortuman/jackal/model"
+	"github.com/ortuman/jackal/module"
+	"github.com/ortuman/jackal/module/offline"
+	"github.com/ortuman/jackal/router"
+	"github.com/ortuman/jackal/storage"
+	"github.com/ortuman/jackal/transport"
+	"github.com/ortuman/jackal/xmpp"
+	"github.com/ortuman/jackal/xmpp/jid"
+	"github.com/pborman/uuid"
+	"github.com/stretchr/testify/require"
+)
+
+func TestStream_StreamManagementFeature(t *testing.T) {
+	r, _, shutdown := setupTest("localhost")
+	defer shutdown()
+
+	storage.InsertOrUpdateUser(&model.User{Username: "user", Password: "pencil"})
+
+	_, conn := tUtilSMStreamInit(r, time.Minute)
+	tUtilStreamOpen(conn)
+	_ = conn.outboundRead() // read stream opening...
+	_ = conn.outboundRead() // read stream features...
+
+	tUtilStreamAuthenticate(conn, t)
+
+	tUtilStreamOpen(conn)
+	_ = conn.outboundRead() // read stream opening...
+
+	elem := conn.outboundRead()
+	require.Equal(t, "stream:features", elem.Name())
+	require.NotNil(t, elem.Elements().ChildNamespace("sm", streamManagementNamespace))
+
+	// enabling before binding a resource is not allowed
+	conn.inboundWrite([]byte(`<enable xmlns="urn:xmpp:sm:3"/>`))
+	elem = conn.outboundRead()
+	require.Equal(t, "failed", elem.Name())
+	require.NotNil(t, elem.Elements().Child("unexpected-request"))
+}
+
+func TestStream_StreamManagementAcks(t *testing.T) {
+	r, _, shutdown := setupTest("localhost")
+	defer shutdown()
+
+	stm, conn := tUtilSMStreamInit(r, time.Minute)
+	tUtilSMStreamBind(conn, t)
+
+	conn.inboundWrite([]byte(`<enable xmlns="urn:xmpp:sm:3"/>`))
+	elem := conn.outboundRead()
+	require.Equal(t, "enabled", elem.Name())
+	require.Equal(t, "", elem.Attributes().Get("id"))
+
+	// enabling twice
+	conn.inboundWrite([]byte(`<enable xmlns="urn:xmpp:sm:3"/>`))
+	elem = conn.outboundRead()
+	require.Equal(t, "failed", elem.Name())
+
+	// outgoing stanza must be followed by an ack request
+	msg := tUtilSMMessage(stm.JID())
+	require.Nil(t, r.Route(msg))
+
+	elem = conn.outboundRead()
+	require.Equal(t, "message", elem.Name())
+	elem = conn.outboundRead()
+	require.Equal(t, "r", elem.Name())
+	require.Equal(t, streamManagementNamespace, elem.Namespace())
+
+	conn.inboundWrite([]byte(`<a xmlns="urn:xmpp:sm:3" h="1"/>`))
+
+	// incoming stanzas must be counted
+	conn.inboundWrite([]byte(`<presence/>`))
+	conn.inboundWrite([]byte(`<r xmlns="urn:xmpp:sm:3"/>`))
+
+	elem = conn.outboundRead()
+	require.Equal(t, "a", elem.Name())
+	require.Equal(t, "1", elem.Attributes().Get("h"))
+
+	time.Sleep(time.Millisecond * 100)
+
+	stm.runQueue.Run(func() {
+		require.Equal(t, 0, len(stm.sm.queue))
+	})
+}
+
+func TestStream_StreamManagementResume(t *testing.T) {
+	r, _, shutdown := setupTest("localhost")
+	defer shutdown()
+
+	stm, conn := tUtilSMStreamInit(r, time.Minute)
+	tUtilSMStreamBind(conn, t)
+
+	conn.inboundWrite([]byte(`<enable xmlns="urn:xmpp:sm:3" resume="true"/>`))
+	elem := conn.outboundRead()
+	require.Equal(t, "enabled", elem.Name())
+	require.Equal(t, "true", elem.Attributes().Get("resume"))
+	require.Equal(t, "60", elem.Attributes().Get("max"))
+
+	smID := elem.Attributes().Get("id")
+	require.True(t, len(smID) > 0)
+
+	msg1 := tUtilSMMessage(stm.JID())
+	require.Nil(t, r.Route(msg1))
+	_ = conn.outboundRead() // read message...
+	_ = conn.outboundRead() // read ack request...
+
+	// simulate a connection loss
+	conn.Close()
+	time.Sleep(time.Millisecond * 100)
+	require.Equal(t, detached, stm.getState())
+
+	msg2 := tUtilSMMessage(stm.JID())
+	require.Nil(t, r.Route(msg2))
+
+	// invalid previd
+	_, conn2 := tUtilSMStreamInit(r, time.Minute)
+	tUtilSMStreamAuthenticate(conn2, t)
+
+	conn2.inboundWrite([]byte(`<resume xmlns="urn:xmpp:sm:3" previd="foo" h="0"/>`))
+	elem = conn2.outboundRead()
+	require.Equal(t, "failed", elem.Name())
+	require.NotNil(t, elem.Elements().Child("item-not-found"))
+
+	// resume the stream acknowledging the first message
+	stm3, conn3 := tUtilSMStreamInit(r, time.Minute)
+	tUtilSMStreamAuthenticate(conn3, t)
+
+	conn3.inboundWrite([]byte(`<resume xmlns="urn:xmpp:sm:3" previd="` + smID + `" h="1"/>`))
+	elem = conn3.outboundRead()
+	require.Equal(t, "resumed", elem.Name())
+	require.Equal(t, smID, elem.Attributes().Get("previd"))
+	require.Equal(t, "0", elem.Attributes().Get("h"))
+
+	elem = conn3.outboundRead()
+	require.Equal(t, "message", elem.Name())
+	require.Equal(t, msg2.ID(), elem.ID())
+
+	time.Sleep(time.Millisecond * 100)
+
+	require.Equal(t, bound, stm.getState())
+	require.Equal(t, disconnected, stm3.getState())
+
+	// resumed stream keeps on working
+	conn3.inboundWrite([]byte(`<r xmlns="urn:xmpp:sm:3"/>`))
+	elem = conn3.outboundRead()
+	require.Equal(t, "r", elem.Name()) // pending ack request
+	elem = conn3.outboundRead()
+	require.Equal(t, "a", elem.Name())
+}
+
+func TestStream_StreamManagementResumeTimeout(t *testing.T) {
+	r, _, shutdown := setupTest("localhost")
+	defer shutdown()
+
+	stm, conn := tUtilSMStreamInit(r, time.Millisecond*250)
+	tUtilSMStreamBind(conn, t)
+
+	conn.inboundWrite([]byte(`<enable xmlns="urn:xmpp:sm:3" resume="true"/>`))
+	elem := conn.outboundRead()
+	require.Equal(t, "enabled", elem.Name())
+	smID := elem.Attributes().Get("id")
+
+	require.Nil(t, r.Route(tUtilSMMessage(stm.JID())))
+	_ = conn.outboundRead() // read message...
+	_ = conn.outboundRead() // read ack request...
+
+	conn.Close()
+	time.Sleep(time.Millisecond * 100)
+	require.Equal(t, detached, stm.getState())
+
+	require.Nil(t, r.Route(tUtilSMMessage(stm.JID())))
+
+	time.Sleep(time.Millisecond * 500)
+	require.Equal(t, disconnected, stm.getState())
+
+	_, ok := resumableStreams.Load(smID)
+	require.False(t, ok)
+
+	// non acknowledged messages must have been archived
+	cnt, err := storage.CountOfflineMessages("user")
+	require.Nil(t, err)
+	require.Equal(t, 2, cnt)
+}
+
+func TestStream_StreamManagementDetach(t *testing.T) {
+	r, _, shutdown := setupTest("localhost")
+	defer shutdown()
+
+	// graceful stream close ends the session
+	stm, conn := tUtilSMStreamInit(r, time.Minute)
+	tUtilSMStreamBind(conn, t)
+	conn.inboundWrite([]byte(`<enable xmlns="urn:xmpp:sm:3" resume="true"/>`))
+	_ = conn.outboundRead()
+
+	conn.inboundWrite([]byte(`</stream:stream>`))
+	time.Sleep(time.Millisecond * 100)
+	require.Equal(t, disconnected, stm.getState())
+
+	// ping timeout waits for the client to resume the stream
+	stm, conn = tUtilSMStreamInit(r, time.Minute)
+	tUtilSMStreamBind(conn, t)
+	conn.inboundWrite([]byte(`<enable xmlns="urn:xmpp:sm:3" resume="true"/>`))
+	_ = conn.outboundRead()
+
+	stm.Disconnect(streamerror.ErrConnectionTimeout)
+	time.Sleep(time.Millisecond * 100)
+	require.Equal(t, detached, stm.getState())
+}
+
+func tUtilSMStreamInit(r *router.Router, resumeTimeout time.Duration) (*inStream, *fakeSocketConn) {
+	conn := newFakeSocketConn()
+	tr := transport.NewSocketTransport(conn, 4096)
+
+	cfg := tUtilInStreamDefaultConfig(tr)
+	cfg.streamManagement = StreamManagementConfig{
+		Enabled:       true,
+		ResumeTimeout: resumeTimeout,
+		MaxQueueSize:  10,
+	}
+	modules := map[string]struct{}{}
+	modules["roster"] = struct{}{}
+	modules["offline"] = struct{}{}
+	mods := module.New(&module.Config{Enabled: modules, Offline: offline.Config{QueueSize: 10}}, r)
+
+	stm := newStream(uuid.New(), cfg, mods, &component.Components{}, r)
+	return stm.(*inStream), conn
+}
+
+func tUtilSMStreamAuthenticate(conn *fakeSocketConn, t *testing.T) {
+	storage.InsertOrUpdateUser(&model.User{Username: "user", Password: "pencil"})
+
+	tUtilStreamOpen(conn)
+	_ = conn.outboundRead() // read stream opening...
+	_ = conn.outboundRead() // read stream features...
+
+	tUtilStreamAuthenticate(conn, t)
+
+	tUtilStreamOpen(conn)
+	_ = conn.outboundRead() // read stream opening...
+	_ = conn.outboundRead() // read stream features...
+}
+
+func tUtilSMStreamBind(conn *fakeSocketConn, t *testing.T) {
+	tUtilSMStreamAuthenticate(conn, t)
+	tUtilStreamBind(conn, t)
+}
+
+func tUtilSMMessage(to *jid.JID) *xmpp.Message {
+	from, _ := jid.New("ortuman", "localhost", "garden", true)
+	msg := xmpp.NewMessageType(uuid.New(), xmpp.ChatType)
+	msg.SetFromJID(from)
+	msg.SetToJID(to)
+	body := xmpp.NewElementName("body")
+	body.SetText("Hi buddy!")
+	msg.AppendElement(body)
+	return msg
+}
@@ -8,6 +8,8 @@ package cluster
 import (
 	"sync"
 
+	streamerror "github.com/ortuman/jackal/errors"
+	"github.com/ortuman/jackal/log"
 	"github.com/ortuman/jackal/xmpp"
 	"github.com/ortuman/jackal/xmpp/jid"
 )
@@ -15,6 +17,7 @@ import (
 type c2sCluster interface {
 	LocalNode() string
 	SendMessageTo(node string, msg *Message)
+	SendRequestTo(node string, msg *Message) error
 }
 
 // C2S represents a cluster c2s stream.
@@ -52,6 +55,11 @@ func (s *C2S) ID() string {
 	return s.identifier
 }
 
+// Node returns the name of the cluster node owning the stream.
+func (s *C2S) Node() string {
+	return s.node
+}
+
 // Context returns a copy of the stream associated context.
 func (s *C2S) Context() map[string]interface{} {
 	m := make(map[string]interface{})
@@ -64,7 +72,7 @@ func (s *C2S) Context() map[string]interface{} {
 }
 
 // SetString associates a string context value to a key.
-func (s *C2S) SetString(key string, value string) {}
+func (s *C2S) SetString(key string, value string) { s.setContextValue(key, value) }
 
 // GetString returns the context value associated with the key as a string.
 func (s *C2S) GetString(key string) string {
@@ -78,7 +86,7 @@ func (s *C2S) GetString(key string) string {
 }
 
 // SetInt associates an integer context value to a key.
-func (s *C2S) SetInt(key string, value int) {}
+func (s *C2S) SetInt(key string, value int) { s.setContextValue(key, value) }
 
 // GetInt returns the context value associated with the key as an integer.
 func (s *C2S) GetInt(key string) int {
@@ -92,7 +100,7 @@ func (s *C2S) GetInt(key string) int {
 }
 
 // SetFloat associates a float context value to a key.
-func (s *C2S) SetFloat(key string, value float64) {}
+func (s *C2S) SetFloat(key string, value float64) { s.setContextValue(key, value) }
 
 // GetFloat returns the context value associated with the key as a float64.
 func (s *C2S) GetFloat(key string) float64 {
@@ -106,7 +114,7 @@ func (s *C2S) GetFloat(key string) float64 {
 }
 
 // SetBool associates a boolean context value to a key.
-func (s *C2S) SetBool(key string, value bool) {}
+func (s *C2S) SetBool(key string, value bool) { s.setContextValue(key, value) }
 
 // GetBool returns the context value associated with the key as a boolean.
 func (s *C2S) GetBool(key string) bool {
@@ -168,8 +176,43 @@ func (s *C2S) SetPresence(presence *xmpp.Presence) {
 	s.mu.Unlock()
 }
 
-// Disconnect disconnects remote peer by closing the underlying TCP socket connection.
-func (s *C2S) Disconnect(err error) {}
+// Disconnect requests the owning cluster node to disconnect the stream, waiting until it's done.
+// Only stream errors are propagated, any other error will close the stream silently.
+func (s *C2S) Disconnect(err error) {
+	var reason string
+	if stmErr, ok := err.(*streamerror.Error); ok {
+		reason = stmErr.Error()
+	}
+	reqErr := s.cluster.SendRequestTo(s.node, &Message{
+		Type: MsgDisconnect,
+		Node: s.cluster.LocalNode(),
+		Payloads: []MessagePayload{{
+			JID:     s.jid,
+			Context: map[string]interface{}{DisconnectReasonContextKey: reason},
+		}},
+	})
+	if reqErr != nil {
+		log.Error(reqErr)
+	}
+}
+
+// setContextValue requests the owning cluster node to update the stream context,
+// applying the value locally once acknowledged.
+func (s *C2S) setContextValue(key string, value interface{}) {
+	err := s.cluster.SendRequestTo(s.node, &Message{
+		Type: MsgSetContext,
+		Node: s.cluster.LocalNode(),
+		Payloads: []MessagePayload{{
+			JID:     s.jid,
+			Context: map[string]interface{}{key: value},
+		}},
+	})
+	if err != nil {
+		log.Error(err)
+		return
+	}
+	s.UpdateContext(map[string]interface{}{key: value})
+}
 
 // SendElement writes an XMPP element to the stream.
 func (s *C2S) SendElement(elem xmpp.XElement) {
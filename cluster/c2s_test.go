@@ -6,9 +6,11 @@
 package cluster
 
 import (
+	"errors"
 	"testing"
 
 	"github.com/google/uuid"
+	streamerror "github.com/ortuman/jackal/errors"
 	"github.com/ortuman/jackal/xmpp"
 	"github.com/ortuman/jackal/xmpp/jid"
 	"github.com/stretchr/testify/require"
@@ -16,10 +18,25 @@ import (
 
 type fakeC2SCluster struct {
 	sendMessageToCalls int
+	sendRequestToCalls int
+	requestErr         error
+	lastNode           string
+	lastMessage        *Message
 }
 
-func (c *fakeC2SCluster) LocalNode() string                       { return "node1" }
-func (c *fakeC2SCluster) SendMessageTo(node string, msg *Message) { c.sendMessageToCalls++ }
+func (c *fakeC2SCluster) LocalNode() string { return "node1" }
+func (c *fakeC2SCluster) SendMessageTo(node string, msg *Message) {
+	c.sendMessageToCalls++
+	c.lastNode = node
+	c.lastMessage = msg
+}
+
+func (c *fakeC2SCluster) SendRequestTo(node string, msg *Message) error {
+	c.sendRequestToCalls++
+	c.lastNode = node
+	c.lastMessage = msg
+	return c.requestErr
+}
 
 func TestC2S_New(t *testing.T) {
 	var c fakeC2SCluster
@@ -72,13 +89,31 @@ func TestC2S_Context(t *testing.T) {
 	id := uuid.New().String()
 	stm := newTestClusterC2S(id, "ortuman@jackal.im/balcony", xmpp.AvailableType, context, "node1", &c)
 
-	// setters don't do anything
+	// setters are forwarded to owning node...
 	stm.SetBool("a2", true)
+	require.Equal(t, 1, c.sendRequestToCalls)
+	require.Equal(t, "node1", c.lastNode)
+	require.Equal(t, MsgSetContext, c.lastMessage.Type)
+	require.Equal(t, "ortuman@jackal.im/balcony", c.lastMessage.Payloads[0].JID.String())
+	require.Equal(t, map[string]interface{}{"a2": true}, c.lastMessage.Payloads[0].Context)
+
 	stm.SetFloat("b2", 3.14)
 	stm.SetInt("c2", 35)
 	stm.SetString("d2", "foo")
+	require.Equal(t, 4, c.sendRequestToCalls)
+
+	// ...and applied once acknowledged
+	require.Equal(t, contextLength+4, len(stm.Context()))
+	require.True(t, stm.GetBool("a2"))
+	require.Equal(t, 3.14, stm.GetFloat("b2"))
+	require.Equal(t, 35, stm.GetInt("c2"))
+	require.Equal(t, "foo", stm.GetString("d2"))
 
-	require.Equal(t, contextLength, len(stm.Context()))
+	c.requestErr = errors.New("cluster mocked error")
+	stm.SetString("d2", "bar")
+	require.Equal(t, "foo", stm.GetString("d2"))
+	c.requestErr = nil
+	contextLength += 4
 
 	require.True(t, stm.GetBool("a1"))
 	require.Equal(t, 3.14, stm.GetFloat("b1"))
@@ -106,6 +141,21 @@ func TestC2S_SendElement(t *testing.T) {
 	require.Equal(t, 1, c.sendMessageToCalls)
 }
 
+func TestC2S_Disconnect(t *testing.T) {
+	var c fakeC2SCluster
+
+	id := uuid.New().String()
+	stm := newTestClusterC2S(id, "ortuman@jackal.im/balcony", xmpp.AvailableType, map[string]interface{}{}, "node2", &c)
+	require.Equal(t, "node2", stm.Node())
+
+	stm.Disconnect(streamerror.ErrPolicyViolation)
+	require.Equal(t, 1, c.sendRequestToCalls)
+	require.Equal(t, "node2", c.lastNode)
+	require.Equal(t, MsgDisconnect, c.lastMessage.Type)
+	require.Equal(t, "ortuman@jackal.im/balcony", c.lastMessage.Payloads[0].JID.String())
+	require.Equal(t, "policy-violation", c.lastMessage.Payloads[0].Context[DisconnectReasonContextKey])
+}
+
 func newTestClusterC2S(id string, jidString string, presenceType string, context map[string]interface{}, node string, c2sCluster c2sCluster) *C2S {
 	j, _ := jid.NewWithString(jidString, true)
 	p := xmpp.NewPresence(j, j, xmpp.AvailableType)
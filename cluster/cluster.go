@@ -7,18 +7,28 @@ package cluster
 
 import (
 	"bytes"
+	"errors"
 	"sync"
+	"time"
 
 	"github.com/ortuman/jackal/runqueue"
 
 	"github.com/google/uuid"
 	"github.com/ortuman/jackal/log"
+	"github.com/ortuman/jackal/metrics"
 	"github.com/ortuman/jackal/xmpp"
 	"github.com/ortuman/jackal/xmpp/jid"
 )
 
 const clusterMailboxSize = 32768
 
+const defaultRequestTimeout = time.Second * 5
+
+var (
+	errRequestTimeout = errors.New("cluster: request timed out")
+	errNodeLeft       = errors.New("cluster: node left before acknowledging request")
+)
+
 var createMemberList = func(localName string, bindPort int, cluster *Cluster) (memberList, error) {
 	return newDefaultMemberList(localName, bindPort, cluster)
 }
@@ -63,6 +73,18 @@ type Cluster struct {
 	membersMu  sync.RWMutex
 	members    map[string]*Node
 	runQueue   *runqueue.RunQueue
+
+	// requestQueue processes incoming requests in arrival order
+	requestQueue   *runqueue.RunQueue
+	requestTimeout time.Duration
+	requestsMu     sync.Mutex
+	requests       map[string]*pendingRequest
+}
+
+// pendingRequest represents a request waiting to be acknowledged by a node.
+type pendingRequest struct {
+	node  string
+	ackCh chan error
 }
 
 // New returns an initialized c2s instance
@@ -76,6 +98,10 @@ func New(config *Config, delegate Delegate) (*Cluster, error) {
 		buf:      bytes.NewBuffer(nil),
 		members:  make(map[string]*Node),
 		runQueue: runqueue.New("cluster"),
+
+		requestQueue:   runqueue.New("cluster:requests"),
+		requestTimeout: defaultRequestTimeout,
+		requests:       make(map[string]*pendingRequest),
 	}
 	ml, err := createMemberList(config.Name, config.BindPort, c)
 	if err != nil {
@@ -97,6 +123,7 @@ func (c *Cluster) Join() error {
 		log.Infof("registered cluster node: %s", m.Name)
 		c.members[m.Name] = &m
 	}
+	metrics.ClusterMembers.Set(float64(len(c.members) + 1))
 	c.membersMu.Unlock()
 	return c.memberList.Join(c.cfg.Hosts)
 }
@@ -121,6 +148,32 @@ func (c *Cluster) SendMessageTo(node string, msg *Message) {
 	})
 }
 
+// SendRequestTo sends a cluster message to a concrete node,
+// waiting until the node acknowledges it has been processed.
+func (c *Cluster) SendRequestTo(node string, msg *Message) error {
+	msg.ID = uuid.New().String()
+	req := &pendingRequest{node: node, ackCh: make(chan error, 1)}
+
+	c.requestsMu.Lock()
+	c.requests[msg.ID] = req
+	c.requestsMu.Unlock()
+
+	c.runQueue.Run(func() {
+		if err := c.send(msg, node); err != nil {
+			c.resolveRequest(msg.ID, err)
+		}
+	})
+	select {
+	case err := <-req.ackCh:
+		return err
+	case <-time.After(c.requestTimeout):
+		c.requestsMu.Lock()
+		delete(c.requests, msg.ID)
+		c.requestsMu.Unlock()
+		return errRequestTimeout
+	}
+}
+
 // BroadcastMessage broadcasts a cluster message to all nodes.
 func (c *Cluster) BroadcastMessage(msg *Message) {
 	c.runQueue.Run(func() {
@@ -133,8 +186,10 @@ func (c *Cluster) BroadcastMessage(msg *Message) {
 // Shutdown shuts down cluster sub system.
 func (c *Cluster) Shutdown() error {
 	errCh := make(chan error, 1)
-	c.runQueue.Stop(func() {
-		errCh <- c.memberList.Shutdown()
+	c.requestQueue.Stop(func() {
+		c.runQueue.Stop(func() {
+			errCh <- c.memberList.Shutdown()
+		})
 	})
 	return <-errCh
 }
@@ -166,6 +221,7 @@ func (c *Cluster) handleNotifyJoin(n *Node) {
 	}
 	c.membersMu.Lock()
 	c.members[n.Name] = n
+	metrics.ClusterMembers.Set(float64(len(c.members) + 1))
 	c.membersMu.Unlock()
 
 	log.Infof("registered cluster node: %s", n.Name)
@@ -194,12 +250,25 @@ func (c *Cluster) handleNotifyLeave(n *Node) {
 	}
 	c.membersMu.Lock()
 	delete(c.members, n.Name)
+	metrics.ClusterMembers.Set(float64(len(c.members) + 1))
 	c.membersMu.Unlock()
 
 	log.Infof("unregistered cluster node: %s", n.Name)
 	if c.delegate != nil && n.Name != c.LocalNode() {
 		c.delegate.NodeLeft(n)
 	}
+	// node requests will never be acknowledged
+	c.requestsMu.Lock()
+	var ids []string
+	for id, req := range c.requests {
+		if req.node == n.Name {
+			ids = append(ids, id)
+		}
+	}
+	c.requestsMu.Unlock()
+	for _, id := range ids {
+		c.resolveRequest(id, errNodeLeft)
+	}
 }
 
 func (c *Cluster) handleNotifyMsg(msg []byte) {
@@ -212,11 +281,44 @@ func (c *Cluster) handleNotifyMsg(msg []byte) {
 		log.Error(err)
 		return
 	}
+	if m.Type == MsgAck {
+		c.resolveRequest(m.ID, nil)
+		return
+	}
+	if len(m.ID) > 0 {
+		// processing a request may block (eg. waiting for a stream to disconnect),
+		// so it must never be done within memberlist notification callback.
+		c.requestQueue.Run(func() { c.processRequest(&m) })
+		return
+	}
 	if c.delegate != nil {
 		c.delegate.NotifyMessage(&m)
 	}
 }
 
+func (c *Cluster) processRequest(m *Message) {
+	if c.delegate != nil {
+		c.delegate.NotifyMessage(m)
+	}
+	// acknowledge request once processed
+	c.SendMessageTo(m.Node, &Message{
+		Type: MsgAck,
+		Node: c.LocalNode(),
+		ID:   m.ID,
+	})
+}
+
+func (c *Cluster) resolveRequest(id string, err error) {
+	c.requestsMu.Lock()
+	req := c.requests[id]
+	delete(c.requests, id)
+	c.requestsMu.Unlock()
+
+	if req != nil {
+		req.ackCh <- err
+	}
+}
+
 func (c *Cluster) encodeMessage(msg *Message) []byte {
 	defer c.buf.Reset()
 
@@ -8,6 +8,7 @@ package cluster
 import (
 	"bytes"
 	"errors"
+	"strconv"
 	"testing"
 	"time"
 
@@ -22,12 +23,22 @@ type fakeClusterDelegate struct {
 	nodeUpdatedCalls   int
 	nodeLeftCalls      int
 	notifyMessageCalls int
+	notifyBlockCh      chan struct{}
+	notifiedIDs        []string
 }
 
-func (d *fakeClusterDelegate) NodeJoined(node *Node)      { d.nodeJoinedCalls++ }
-func (d *fakeClusterDelegate) NodeUpdated(node *Node)     { d.nodeUpdatedCalls++ }
-func (d *fakeClusterDelegate) NodeLeft(node *Node)        { d.nodeLeftCalls++ }
-func (d *fakeClusterDelegate) NotifyMessage(msg *Message) { d.notifyMessageCalls++ }
+func (d *fakeClusterDelegate) NodeJoined(node *Node)  { d.nodeJoinedCalls++ }
+func (d *fakeClusterDelegate) NodeUpdated(node *Node) { d.nodeUpdatedCalls++ }
+func (d *fakeClusterDelegate) NodeLeft(node *Node)    { d.nodeLeftCalls++ }
+func (d *fakeClusterDelegate) NotifyMessage(msg *Message) {
+	d.notifyMessageCalls++
+	if len(msg.ID) > 0 {
+		d.notifiedIDs = append(d.notifiedIDs, msg.ID)
+	}
+	if d.notifyBlockCh != nil {
+		<-d.notifyBlockCh
+	}
+}
 
 type fakeMemberList struct {
 	members           []Node
@@ -208,6 +219,126 @@ func TestCluster_Delegate(t *testing.T) {
 	require.Equal(t, 1, delegate.notifyMessageCalls)
 }
 
+func TestCluster_SendRequest(t *testing.T) {
+	var ml fakeMemberList
+	var delegate fakeClusterDelegate
+
+	createMemberList = func(_ string, _ int, _ *Cluster) (list memberList, e error) {
+		return &ml, nil
+	}
+	c, _ := New(testClusterConfig(), &delegate)
+	require.NotNil(t, c)
+
+	ml.sendCh = make(chan []byte)
+
+	// acknowledged request...
+	errCh := make(chan error, 1)
+	go func() { errCh <- c.SendRequestTo("node2", &Message{Type: MsgDisconnect, Node: "node1"}) }()
+
+	req := tUtilReceiveMessage(t, ml.sendCh)
+	require.Equal(t, MsgDisconnect, req.Type)
+	require.NotEqual(t, 0, len(req.ID))
+
+	c.handleNotifyMsg(tUtilMessageBytes(t, &Message{Type: MsgAck, Node: "node2", ID: req.ID}))
+	require.Nil(t, <-errCh)
+	require.Equal(t, 0, delegate.notifyMessageCalls) // acks are not delegated
+
+	// node leaves before acknowledging...
+	go func() { errCh <- c.SendRequestTo("node2", &Message{Type: MsgDisconnect, Node: "node1"}) }()
+	_ = tUtilReceiveMessage(t, ml.sendCh)
+
+	c.handleNotifyLeave(&Node{Name: "node2"})
+	require.Equal(t, errNodeLeft, <-errCh)
+
+	// request timeout...
+	c.requestTimeout = clusterOpTimeout
+	go func() { errCh <- c.SendRequestTo("node2", &Message{Type: MsgDisconnect, Node: "node1"}) }()
+	_ = tUtilReceiveMessage(t, ml.sendCh)
+	require.Equal(t, errRequestTimeout, <-errCh)
+
+	c.requestsMu.Lock()
+	require.Equal(t, 0, len(c.requests))
+	c.requestsMu.Unlock()
+
+	// send error...
+	ml.sendErr = errors.New("cluster: send error")
+	require.Equal(t, ml.sendErr, c.SendRequestTo("node2", &Message{Type: MsgDisconnect, Node: "node1"}))
+}
+
+func TestCluster_AckRequest(t *testing.T) {
+	var ml fakeMemberList
+	var delegate fakeClusterDelegate
+
+	createMemberList = func(_ string, _ int, _ *Cluster) (list memberList, e error) {
+		return &ml, nil
+	}
+	c, _ := New(testClusterConfig(), &delegate)
+	require.NotNil(t, c)
+
+	ml.sendCh = make(chan []byte)
+
+	j, _ := jid.NewWithString("ortuman@jackal.im/garden", true)
+	go c.handleNotifyMsg(tUtilMessageBytes(t, &Message{
+		Type:     MsgSetContext,
+		Node:     "node2",
+		ID:       "abcd",
+		Payloads: []MessagePayload{{JID: j, Context: map[string]interface{}{"requested": true}}},
+	}))
+	ack := tUtilReceiveMessage(t, ml.sendCh)
+	require.Equal(t, MsgAck, ack.Type)
+	require.Equal(t, "node1", ack.Node)
+	require.Equal(t, "abcd", ack.ID)
+	require.Equal(t, 1, delegate.notifyMessageCalls)
+
+	// blocking request does not block notification callback
+	delegate.notifyBlockCh = make(chan struct{})
+	c.handleNotifyMsg(tUtilMessageBytes(t, &Message{Type: MsgDisconnect, Node: "node2", ID: "efgh", Payloads: []MessagePayload{{JID: j}}}))
+	close(delegate.notifyBlockCh)
+
+	ack = tUtilReceiveMessage(t, ml.sendCh)
+	require.Equal(t, "efgh", ack.ID)
+	delegate.notifyBlockCh = nil
+
+	// requests are processed in arrival order
+	var ids []string
+	for i := 0; i < 10; i++ {
+		id := strconv.Itoa(i)
+		ids = append(ids, id)
+		c.handleNotifyMsg(tUtilMessageBytes(t, &Message{Type: MsgSetContext, Node: "node2", ID: id, Payloads: []MessagePayload{{JID: j}}}))
+	}
+	for _, id := range ids {
+		require.Equal(t, id, tUtilReceiveMessage(t, ml.sendCh).ID)
+	}
+	require.Equal(t, append([]string{"abcd", "efgh"}, ids...), delegate.notifiedIDs)
+
+	// not a request... no acknowledgement
+	go c.handleNotifyMsg(tUtilMessageBytes(t, &Message{Type: MsgUnbind, Node: "node2", Payloads: []MessagePayload{{JID: j}}}))
+	select {
+	case <-ml.sendCh:
+		require.Fail(t, "unexpected acknowledgement")
+	case <-time.After(clusterOpTimeout):
+		break
+	}
+}
+
+func tUtilMessageBytes(t *testing.T, m *Message) []byte {
+	buf := bytes.NewBuffer(nil)
+	require.Nil(t, m.ToBytes(buf))
+	return buf.Bytes()
+}
+
+func tUtilReceiveMessage(t *testing.T, sendCh <-chan []byte) *Message {
+	select {
+	case b := <-sendCh:
+		var m Message
+		require.Nil(t, m.FromBytes(bytes.NewBuffer(b)))
+		return &m
+	case <-time.After(clusterOpTimeout):
+		require.Fail(t, "cluster send message timeout")
+	}
+	return nil
+}
+
 func testClusterConfig() *Config {
 	return &Config{
 		Name:     "node1",
@@ -31,8 +31,23 @@ const (
 
 	// MsgRouteStanza represents a route stanza cluster message.
 	MsgRouteStanza
+
+	// MsgDisconnect represents a c2s stream disconnection cluster message.
+	MsgDisconnect
+
+	// MsgReloadBlockList represents a block list reload cluster message.
+	MsgReloadBlockList
+
+	// MsgSetContext represents a c2s stream context mutation cluster message.
+	MsgSetContext
+
+	// MsgAck represents a request acknowledgement cluster message.
+	MsgAck
 )
 
+// DisconnectReasonContextKey is the payload context key carrying a disconnection stream error reason.
+const DisconnectReasonContextKey = "disconnect:reason"
+
 const (
 	messageStanza = iota
 	presenceStanza
@@ -140,8 +155,12 @@ func (p *MessagePayload) ToBytes(buf *bytes.Buffer) error {
 // Message is the c2s message type.
 // A message can contain one or more payloads.
 type Message struct {
-	Type     int
-	Node     string
+	Type int
+	Node string
+
+	// ID identifies a request message, so that
+	// its acknowledgement can be matched.
+	ID       string
 	Payloads []MessagePayload
 }
 
@@ -154,6 +173,9 @@ func (m *Message) FromBytes(buf *bytes.Buffer) error {
 	if err := dec.Decode(&m.Node); err != nil {
 		return err
 	}
+	if err := dec.Decode(&m.ID); err != nil {
+		return err
+	}
 
 	var pLen int
 	if err := dec.Decode(&pLen); err != nil {
@@ -180,6 +202,9 @@ func (m *Message) ToBytes(buf *bytes.Buffer) error {
 	if err := enc.Encode(m.Node); err != nil {
 		return err
 	}
+	if err := enc.Encode(m.ID); err != nil {
+		return err
+	}
 	if err := enc.Encode(len(m.Payloads)); err != nil {
 		return err
 	}
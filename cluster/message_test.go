@@ -29,6 +29,18 @@ func TestMessageSerialization(t *testing.T) {
 	require.Equal(t, m1.Type, m2.Type)
 	require.Equal(t, m1.Node, m2.Node)
 
+	m1 = Message{
+		Type: MsgAck,
+		Node: "node2",
+		ID:   uuid.New().String(),
+	}
+	buf.Reset()
+	require.Nil(t, m1.ToBytes(buf))
+
+	require.Nil(t, m2.FromBytes(buf))
+	require.Equal(t, m1.Type, m2.Type)
+	require.Equal(t, m1.ID, m2.ID)
+
 	j, _ := jid.NewWithString("ortuman@jackal.im", true)
 	m1 = Message{
 		Type: MsgUpdatePresence,
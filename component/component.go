@@ -8,9 +8,14 @@ package component
 import (
 	"context"
 	"fmt"
+	"sync"
 
+	"github.com/ortuman/jackal/component/httpupload"
+	"github.com/ortuman/jackal/component/muc"
+	"github.com/ortuman/jackal/component/pubsub"
 	"github.com/ortuman/jackal/log"
 	"github.com/ortuman/jackal/module/xep0030"
+	"github.com/ortuman/jackal/router"
 	"github.com/ortuman/jackal/stream"
 	"github.com/ortuman/jackal/xmpp"
 )
@@ -18,21 +23,25 @@ import (
 // Component represents a generic component interface.
 type Component interface {
 	Host() string
+
+	// ProcessStanza processes a stanza addressed to component host.
+	// stm will be nil whenever stanza was not originated from a c2s stream.
 	ProcessStanza(stanza xmpp.Stanza, stm stream.C2S)
 }
 
 // Components represents a set of preconfigured components.
 type Components struct {
+	mu          sync.RWMutex
 	comps       map[string]Component
 	shutdownChs []chan<- chan bool
 }
 
 // New returns a set of components derived from a concrete configuration.
-func New(config *Config, discoInfo *xep0030.DiscoInfo) *Components {
+func New(config *Config, discoInfo *xep0030.DiscoInfo, router *router.Router) *Components {
 	comps := &Components{
 		comps: make(map[string]Component),
 	}
-	cs, shutdownChs := loadComponents(config, discoInfo)
+	cs, shutdownChs := loadComponents(config, discoInfo, router)
 	for _, c := range cs {
 		host := c.Host()
 		if _, ok := comps.comps[host]; ok {
@@ -46,11 +55,15 @@ func New(config *Config, discoInfo *xep0030.DiscoInfo) *Components {
 
 // Get returns a specific component associated to host name.
 func (cs *Components) Get(host string) Component {
+	cs.mu.RLock()
+	defer cs.mu.RUnlock()
 	return cs.comps[host]
 }
 
 // GetAll returns all initialized components.
 func (cs *Components) GetAll() []Component {
+	cs.mu.RLock()
+	defer cs.mu.RUnlock()
 	var ret []Component
 	for _, comp := range cs.comps {
 		ret = append(ret, comp)
@@ -58,6 +71,43 @@ func (cs *Components) GetAll() []Component {
 	return ret
 }
 
+// Register registers a new component at runtime.
+// An error will be returned in case its host name is already in use.
+func (cs *Components) Register(comp Component) error {
+	cs.mu.Lock()
+	defer cs.mu.Unlock()
+	host := comp.Host()
+	if _, ok := cs.comps[host]; ok {
+		return fmt.Errorf("component host name conflict: %s", host)
+	}
+	cs.comps[host] = comp
+	log.Infof("registered component... (host: %s)", host)
+	return nil
+}
+
+// Unregister unregisters a previously registered component.
+func (cs *Components) Unregister(comp Component) {
+	cs.mu.Lock()
+	defer cs.mu.Unlock()
+	host := comp.Host()
+	if cs.comps[host] != comp {
+		return
+	}
+	delete(cs.comps, host)
+	log.Infof("unregistered component... (host: %s)", host)
+}
+
+// RouteToComponent delivers a stanza to the component associated to its destination domain.
+// A false value is returned in case no component serves that domain.
+func (cs *Components) RouteToComponent(stanza xmpp.Stanza) bool {
+	comp := cs.Get(stanza.ToJID().Domain())
+	if comp == nil {
+		return false
+	}
+	comp.ProcessStanza(stanza, nil)
+	return true
+}
+
 // Shutdown gracefully shuts down components instance.
 func (cs *Components) Shutdown(ctx context.Context) error {
 	select {
@@ -83,16 +133,26 @@ func (cs *Components) shutdown() <-chan bool {
 	return c
 }
 
-func loadComponents(_ *Config, _ *xep0030.DiscoInfo) ([]Component, []chan<- chan bool) {
+func loadComponents(cfg *Config, discoInfo *xep0030.DiscoInfo, router *router.Router) ([]Component, []chan<- chan bool) {
 	var comps []Component
 	var shutdownChs []chan<- chan bool
-	/*
-		discoInfo := module.Modules().DiscoInfo
-		if cfg.HttpUpload != nil {
-			comp, shutdownCh := httpupload.New(cfg.HttpUpload, discoInfo)
-			comps = append(comps, comp)
-			shutdownChs = append(shutdownChs, shutdownCh)
+	if cfg.Muc != nil {
+		comp, shutdownCh := muc.New(cfg.Muc, discoInfo, router)
+		comps = append(comps, comp)
+		shutdownChs = append(shutdownChs, shutdownCh)
+	}
+	if cfg.HttpUpload != nil {
+		comp, shutdownCh, err := httpupload.New(cfg.HttpUpload, discoInfo, router)
+		if err != nil {
+			log.Fatal(err)
 		}
-	*/
+		comps = append(comps, comp)
+		shutdownChs = append(shutdownChs, shutdownCh)
+	}
+	if cfg.PubSub != nil {
+		comp, shutdownCh := pubsub.New(cfg.PubSub, discoInfo, router)
+		comps = append(comps, comp)
+		shutdownChs = append(shutdownChs, shutdownCh)
+	}
 	return comps, shutdownChs
 }
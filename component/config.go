@@ -5,7 +5,15 @@
 
 package component
 
+import (
+	"github.com/ortuman/jackal/component/httpupload"
+	"github.com/ortuman/jackal/component/muc"
+	"github.com/ortuman/jackal/component/pubsub"
+)
+
 // Config contains all components configuration.
 type Config struct {
-	// HttpUpload *httpupload.Config `yaml:"http_upload"`
+	HttpUpload *httpupload.Config `yaml:"http_upload"`
+	Muc        *muc.Config        `yaml:"muc"`
+	PubSub     *pubsub.Config     `yaml:"pubsub"`
 }
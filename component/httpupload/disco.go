@@ -0,0 +1,66 @@
+/*
+ * Copyright (c) 2018 Miguel Ángel Ortuño.
+ * See the LICENSE file for more information.
+ */
+
+package httpupload
+
+import (
+	"strconv"
+
+	"github.com/ortuman/jackal/module/xep0004"
+	"github.com/ortuman/jackal/module/xep0030"
+	"github.com/ortuman/jackal/xmpp"
+	"github.com/ortuman/jackal/xmpp/jid"
+)
+
+const (
+	discoInfoNamespace  = "http://jabber.org/protocol/disco#info"
+	discoItemsNamespace = "http://jabber.org/protocol/disco#items"
+)
+
+const (
+	formTypeField    = "FORM_TYPE"
+	maxFileSizeField = "max-file-size"
+)
+
+type discoInfoProvider struct {
+	cfg *Config
+}
+
+func (dp *discoInfoProvider) Identities(toJID, fromJID *jid.JID, node string) []xep0030.Identity {
+	if node != "" || !toJID.IsServer() {
+		return nil
+	}
+	return []xep0030.Identity{{Category: "store", Type: "file", Name: dp.cfg.Name}}
+}
+
+func (dp *discoInfoProvider) Items(toJID, fromJID *jid.JID, node string) ([]xep0030.Item, *xmpp.StanzaError) {
+	if !toJID.IsServer() {
+		return nil, xmpp.ErrItemNotFound
+	}
+	return nil, nil
+}
+
+func (dp *discoInfoProvider) Features(toJID, fromJID *jid.JID, node string) ([]xep0030.Feature, *xmpp.StanzaError) {
+	if !toJID.IsServer() {
+		return nil, xmpp.ErrItemNotFound
+	}
+	if node != "" {
+		return nil, nil
+	}
+	return []xep0030.Feature{discoInfoNamespace, discoItemsNamespace, uploadNamespace}, nil
+}
+
+func (dp *discoInfoProvider) Form(toJID, fromJID *jid.JID, node string) (*xep0004.DataForm, *xmpp.StanzaError) {
+	if node != "" || !toJID.IsServer() {
+		return nil, nil
+	}
+	return &xep0004.DataForm{
+		Type: xep0004.Result,
+		Fields: []xep0004.Field{
+			{Var: formTypeField, Type: xep0004.Hidden, Values: []string{uploadNamespace}},
+			{Var: maxFileSizeField, Values: []string{strconv.FormatInt(dp.cfg.MaxFileSize, 10)}},
+		},
+	}, nil
+}
@@ -0,0 +1,40 @@
+/*
+ * Copyright (c) 2018 Miguel Ángel Ortuño.
+ * See the LICENSE file for more information.
+ */
+
+package httpupload
+
+import (
+	"testing"
+
+	"github.com/ortuman/jackal/xmpp"
+	"github.com/ortuman/jackal/xmpp/jid"
+	"github.com/stretchr/testify/require"
+)
+
+func TestHTTPUpload_DiscoInfoProvider(t *testing.T) {
+	dp := &discoInfoProvider{cfg: &Config{Name: defaultServiceName, MaxFileSize: 1024}}
+
+	fromJID, _ := jid.New("ortuman", "jackal.im", "balcony", true)
+	fileJID, _ := jid.New("file", "upload.jackal.im", "", true)
+
+	ids := dp.Identities(serviceJID(), fromJID, "")
+	require.Equal(t, 1, len(ids))
+	require.Equal(t, "store", ids[0].Category)
+	require.Equal(t, "file", ids[0].Type)
+
+	features, sErr := dp.Features(serviceJID(), fromJID, "")
+	require.Nil(t, sErr)
+	require.Contains(t, features, uploadNamespace)
+
+	_, sErr = dp.Features(fileJID, fromJID, "")
+	require.Equal(t, xmpp.ErrItemNotFound, sErr)
+
+	form, sErr := dp.Form(serviceJID(), fromJID, "")
+	require.Nil(t, sErr)
+	require.Equal(t, 2, len(form.Fields))
+	require.Equal(t, uploadNamespace, form.Fields[0].Values[0])
+	require.Equal(t, maxFileSizeField, form.Fields[1].Var)
+	require.Equal(t, "1024", form.Fields[1].Values[0])
+}
@@ -0,0 +1,371 @@
+/*
+ * Copyright (c) 2018 Miguel Ángel Ortuño.
+ * See the LICENSE file for more information.
+ */
+
+package httpupload
+
+import (
+	"context"
+	"crypto/sha1"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ortuman/jackal/log"
+	"github.com/ortuman/jackal/module/xep0030"
+	"github.com/ortuman/jackal/router"
+	"github.com/ortuman/jackal/runqueue"
+	"github.com/ortuman/jackal/stream"
+	"github.com/ortuman/jackal/xmpp"
+	"github.com/pborman/uuid"
+)
+
+const uploadNamespace = "urn:xmpp:http:upload:0"
+
+const (
+	defaultServiceName     = "HTTP File Upload"
+	defaultBindAddr        = "0.0.0.0"
+	defaultPort            = 5443
+	defaultMaxFileSize     = 10 * 1024 * 1024
+	defaultSlotTimeout     = 300
+	defaultCleanupInterval = 3600
+)
+
+// Config represents HTTP file upload component configuration.
+type Config struct {
+	Host            string
+	Name            string
+	BaseURL         string
+	BindAddr        string
+	Port            int
+	UploadDir       string
+	MaxFileSize     int64
+	Quota           int64
+	SlotTimeout     time.Duration
+	ExpireAfter     time.Duration
+	CleanupInterval time.Duration
+}
+
+type configProxy struct {
+	Host            string `yaml:"host"`
+	Name            string `yaml:"name"`
+	BaseURL         string `yaml:"base_url"`
+	BindAddr        string `yaml:"bind_addr"`
+	Port            int    `yaml:"port"`
+	UploadDir       string `yaml:"upload_dir"`
+	MaxFileSize     int64  `yaml:"max_file_size"`
+	Quota           int64  `yaml:"quota"`
+	SlotTimeout     int    `yaml:"slot_timeout"`
+	ExpireAfter     int    `yaml:"expire_after"`
+	CleanupInterval int    `yaml:"cleanup_interval"`
+}
+
+// UnmarshalYAML satisfies Unmarshaler interface.
+func (c *Config) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	p := configProxy{}
+	if err := unmarshal(&p); err != nil {
+		return err
+	}
+	if len(p.Host) == 0 {
+		return errors.New("httpupload.Config: host must be specified")
+	}
+	if len(p.UploadDir) == 0 {
+		return errors.New("httpupload.Config: upload directory must be specified")
+	}
+	if p.MaxFileSize < 0 || p.Quota < 0 {
+		return errors.New("httpupload.Config: file size and quota values must be positive")
+	}
+	c.Host = p.Host
+	c.Name = p.Name
+	if len(c.Name) == 0 {
+		c.Name = defaultServiceName
+	}
+	c.BaseURL = strings.TrimSuffix(p.BaseURL, "/")
+	c.BindAddr = p.BindAddr
+	if len(c.BindAddr) == 0 {
+		c.BindAddr = defaultBindAddr
+	}
+	c.Port = p.Port
+	if c.Port == 0 {
+		c.Port = defaultPort
+	}
+	c.UploadDir = p.UploadDir
+	c.MaxFileSize = p.MaxFileSize
+	if c.MaxFileSize == 0 {
+		c.MaxFileSize = defaultMaxFileSize
+	}
+	c.Quota = p.Quota
+	c.SlotTimeout = time.Second * time.Duration(p.SlotTimeout)
+	if c.SlotTimeout == 0 {
+		c.SlotTimeout = time.Second * defaultSlotTimeout
+	}
+	c.ExpireAfter = time.Second * time.Duration(p.ExpireAfter)
+	c.CleanupInterval = time.Second * time.Duration(p.CleanupInterval)
+	if c.CleanupInterval == 0 {
+		c.CleanupInterval = time.Second * defaultCleanupInterval
+	}
+	return nil
+}
+
+type slot struct {
+	owner       string
+	size        int64
+	contentType string
+	expiresAt   time.Time
+}
+
+// HTTPUpload represents an HTTP file upload service component.
+type HTTPUpload struct {
+	cfg       *Config
+	discoInfo *xep0030.DiscoInfo
+	router    *router.Router
+	runQueue  *runqueue.RunQueue
+	baseURL   string
+	srv       *http.Server
+	doneCh    chan struct{}
+
+	mu    sync.Mutex
+	slots map[string]*slot
+}
+
+// New returns an HTTP file upload service component.
+func New(config *Config, discoInfo *xep0030.DiscoInfo, router *router.Router) (*HTTPUpload, chan<- chan bool, error) {
+	if err := os.MkdirAll(config.UploadDir, os.ModePerm); err != nil {
+		return nil, nil, err
+	}
+	ln, err := net.Listen("tcp", net.JoinHostPort(config.BindAddr, strconv.Itoa(config.Port)))
+	if err != nil {
+		return nil, nil, err
+	}
+	x := &HTTPUpload{
+		cfg:       config,
+		discoInfo: discoInfo,
+		router:    router,
+		runQueue:  runqueue.New("httpupload"),
+		baseURL:   config.BaseURL,
+		doneCh:    make(chan struct{}),
+		slots:     make(map[string]*slot),
+	}
+	if len(x.baseURL) == 0 {
+		x.baseURL = fmt.Sprintf("http://%s:%d", config.Host, ln.Addr().(*net.TCPAddr).Port)
+	}
+	x.srv = &http.Server{Handler: x}
+	go func() {
+		if err := x.srv.Serve(ln); err != nil && err != http.ErrServerClosed {
+			log.Error(err)
+		}
+	}()
+	go x.loop()
+
+	if discoInfo != nil {
+		discoInfo.RegisterServerItem(xep0030.Item{Jid: config.Host, Name: config.Name})
+		discoInfo.RegisterProvider(config.Host, &discoInfoProvider{cfg: config})
+	}
+	log.Infof("httpupload: listening at %s... (host: %s)", ln.Addr().String(), config.Host)
+
+	shutdownCh := make(chan chan bool)
+	go x.waitForShutdown(shutdownCh)
+	return x, shutdownCh, nil
+}
+
+// Host returns HTTP file upload service host name.
+func (x *HTTPUpload) Host() string {
+	return x.cfg.Host
+}
+
+// ProcessStanza processes a stanza addressed to the HTTP file upload service.
+func (x *HTTPUpload) ProcessStanza(stanza xmpp.Stanza, _ stream.C2S) {
+	x.runQueue.Run(func() {
+		x.processStanza(stanza)
+	})
+}
+
+func (x *HTTPUpload) processStanza(stanza xmpp.Stanza) {
+	iq, ok := stanza.(*xmpp.IQ)
+	if !ok || !(iq.IsGet() || iq.IsSet()) {
+		return
+	}
+	request := iq.Elements().ChildNamespace("request", uploadNamespace)
+	if !iq.IsGet() || request == nil || !iq.ToJID().IsServer() {
+		_ = x.router.Route(iq.ServiceUnavailableError())
+		return
+	}
+	x.requestSlot(iq, request)
+}
+
+func (x *HTTPUpload) requestSlot(iq *xmpp.IQ, request xmpp.XElement) {
+	filename := request.Attributes().Get("filename")
+	size, err := strconv.ParseInt(request.Attributes().Get("size"), 10, 64)
+	if err != nil || size <= 0 || !isValidFilename(filename) {
+		_ = x.router.Route(iq.BadRequestError())
+		return
+	}
+	if size > x.cfg.MaxFileSize {
+		maxSize := xmpp.NewElementName("max-file-size")
+		maxSize.SetText(strconv.FormatInt(x.cfg.MaxFileSize, 10))
+		tooLarge := xmpp.NewElementNamespace("file-too-large", uploadNamespace)
+		tooLarge.AppendElement(maxSize)
+		_ = x.router.Route(xmpp.NewErrorStanzaFromStanza(iq, xmpp.ErrNotAcceptable, []xmpp.XElement{tooLarge}))
+		return
+	}
+	owner := iq.FromJID().ToBareJID().String()
+
+	x.mu.Lock()
+	defer x.mu.Unlock()
+
+	if x.cfg.Quota > 0 {
+		usage, err := x.userUsage(owner)
+		if err != nil {
+			log.Error(err)
+			_ = x.router.Route(iq.InternalServerError())
+			return
+		}
+		if usage+size > x.cfg.Quota {
+			_ = x.router.Route(iq.ResourceConstraintError())
+			return
+		}
+	}
+	slotPath := path.Join(userDir(owner), uuid.New(), filename)
+	x.slots[slotPath] = &slot{
+		owner:       owner,
+		size:        size,
+		contentType: request.Attributes().Get("content-type"),
+		expiresAt:   time.Now().Add(x.cfg.SlotTimeout),
+	}
+	slotURL := x.baseURL + "/" + escapePath(slotPath)
+
+	put := xmpp.NewElementName("put")
+	put.SetAttribute("url", slotURL)
+	get := xmpp.NewElementName("get")
+	get.SetAttribute("url", slotURL)
+	slotElem := xmpp.NewElementNamespace("slot", uploadNamespace)
+	slotElem.AppendElement(put)
+	slotElem.AppendElement(get)
+
+	result := iq.ResultIQ()
+	result.AppendElement(slotElem)
+	_ = x.router.Route(result)
+
+	log.Infof("httpupload: assigned upload slot... (owner: %s, filename: %s, size: %d)", owner, filename, size)
+}
+
+// userUsage returns the amount of bytes stored or reserved by a user.
+func (x *HTTPUpload) userUsage(owner string) (int64, error) {
+	var usage int64
+	for _, s := range x.slots {
+		if s.owner == owner {
+			usage += s.size
+		}
+	}
+	err := filepath.Walk(filepath.Join(x.cfg.UploadDir, userDir(owner)), func(_ string, info os.FileInfo, err error) error {
+		if err != nil {
+			if os.IsNotExist(err) {
+				return nil
+			}
+			return err
+		}
+		if info.Mode().IsRegular() && info.Name() != contentTypeFile {
+			usage += info.Size()
+		}
+		return nil
+	})
+	return usage, err
+}
+
+func (x *HTTPUpload) loop() {
+	tc := time.NewTicker(x.cfg.CleanupInterval)
+	defer tc.Stop()
+	for {
+		select {
+		case <-tc.C:
+			x.cleanUp()
+		case <-x.doneCh:
+			return
+		}
+	}
+}
+
+// cleanUp discards expired slots and removes every upload older than configured expiration time.
+func (x *HTTPUpload) cleanUp() {
+	x.mu.Lock()
+	defer x.mu.Unlock()
+
+	now := time.Now()
+	for p, s := range x.slots {
+		if now.After(s.expiresAt) {
+			delete(x.slots, p)
+		}
+	}
+	if x.cfg.ExpireAfter == 0 {
+		return
+	}
+	slotDirs, err := filepath.Glob(filepath.Join(x.cfg.UploadDir, "*", "*"))
+	if err != nil {
+		log.Error(err)
+		return
+	}
+	for _, slotDir := range slotDirs {
+		info, err := os.Stat(slotDir)
+		if err != nil {
+			log.Error(err)
+			continue
+		}
+		if now.Sub(info.ModTime()) < x.cfg.ExpireAfter {
+			continue
+		}
+		if err := os.RemoveAll(slotDir); err != nil {
+			log.Error(err)
+			continue
+		}
+		// remove user directory once empty
+		_ = os.Remove(filepath.Dir(slotDir))
+
+		log.Infof("httpupload: removed expired upload... (path: %s)", slotDir)
+	}
+}
+
+func (x *HTTPUpload) waitForShutdown(shutdownCh <-chan chan bool) {
+	c := <-shutdownCh
+	close(x.doneCh)
+	if err := x.srv.Shutdown(context.Background()); err != nil {
+		log.Error(err)
+	}
+	x.runQueue.Stop(func() {
+		if x.discoInfo != nil {
+			x.discoInfo.UnregisterProvider(x.cfg.Host)
+			x.discoInfo.UnregisterServerItem(xep0030.Item{Jid: x.cfg.Host, Name: x.cfg.Name})
+		}
+		c <- true
+	})
+}
+
+func userDir(owner string) string {
+	h := sha1.Sum([]byte(owner))
+	return hex.EncodeToString(h[:])
+}
+
+func isValidFilename(filename string) bool {
+	if len(filename) == 0 || filename == "." || filename == ".." || filename == contentTypeFile {
+		return false
+	}
+	return !strings.ContainsAny(filename, "/\\\x00")
+}
+
+func escapePath(p string) string {
+	ss := strings.Split(p, "/")
+	for i := range ss {
+		ss[i] = url.PathEscape(ss[i])
+	}
+	return strings.Join(ss, "/")
+}
@@ -0,0 +1,188 @@
+/*
+ * Copyright (c) 2018 Miguel Ángel Ortuño.
+ * See the LICENSE file for more information.
+ */
+
+package httpupload
+
+import (
+	"crypto/tls"
+	"io/ioutil"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ortuman/jackal/model"
+	"github.com/ortuman/jackal/router"
+	"github.com/ortuman/jackal/storage"
+	"github.com/ortuman/jackal/storage/memstorage"
+	"github.com/ortuman/jackal/stream"
+	"github.com/ortuman/jackal/xmpp"
+	"github.com/ortuman/jackal/xmpp/jid"
+	"github.com/pborman/uuid"
+	"github.com/stretchr/testify/require"
+	yaml "gopkg.in/yaml.v2"
+)
+
+func TestHTTPUpload_Config(t *testing.T) {
+	cfg := Config{}
+	require.NotNil(t, yaml.Unmarshal([]byte(`upload_dir: /tmp`), &cfg))
+	require.NotNil(t, yaml.Unmarshal([]byte(`host: upload.jackal.im`), &cfg))
+	require.NotNil(t, yaml.Unmarshal([]byte("host: upload.jackal.im\nupload_dir: /tmp\nquota: -1"), &cfg))
+
+	require.Nil(t, yaml.Unmarshal([]byte("host: upload.jackal.im\nupload_dir: /tmp\nbase_url: https://upload.jackal.im/"), &cfg))
+	require.Equal(t, "upload.jackal.im", cfg.Host)
+	require.Equal(t, defaultServiceName, cfg.Name)
+	require.Equal(t, "https://upload.jackal.im", cfg.BaseURL)
+	require.Equal(t, defaultBindAddr, cfg.BindAddr)
+	require.Equal(t, defaultPort, cfg.Port)
+	require.Equal(t, int64(defaultMaxFileSize), cfg.MaxFileSize)
+	require.Equal(t, int64(0), cfg.Quota)
+	require.Equal(t, time.Second*defaultSlotTimeout, cfg.SlotTimeout)
+	require.Equal(t, time.Duration(0), cfg.ExpireAfter)
+	require.Equal(t, time.Second*defaultCleanupInterval, cfg.CleanupInterval)
+}
+
+func TestHTTPUpload_RequestSlot(t *testing.T) {
+	r, shutdown := setupTest("jackal.im")
+	defer shutdown()
+
+	stm := setupUser(t, r, "ortuman")
+
+	x, shutdownCh, dir := setupUpload(t, r, 1024, 0)
+	defer shutdownUpload(shutdownCh, dir)
+
+	require.Equal(t, "upload.jackal.im", x.Host())
+
+	x.ProcessStanza(newRequestIQ(stm.JID(), "photo.jpg", "512", "image/jpeg"), stm)
+	elem := stm.ReceiveElement()
+	require.Equal(t, xmpp.ResultType, elem.Type())
+
+	slotElem := elem.Elements().ChildNamespace("slot", uploadNamespace)
+	require.NotNil(t, slotElem)
+	putURL := slotElem.Elements().Child("put").Attributes().Get("url")
+	getURL := slotElem.Elements().Child("get").Attributes().Get("url")
+	require.Equal(t, putURL, getURL)
+	require.Contains(t, putURL, x.baseURL+"/"+userDir("ortuman@jackal.im")+"/")
+	require.Contains(t, putURL, "/photo.jpg")
+
+	// invalid requests
+	for _, req := range [][2]string{{"", "512"}, {"photo.jpg", ""}, {"../photo.jpg", "512"}, {"photo.jpg", "-1"}} {
+		x.ProcessStanza(newRequestIQ(stm.JID(), req[0], req[1], ""), stm)
+		elem = stm.ReceiveElement()
+		require.Equal(t, xmpp.ErrBadRequest.Error(), elem.Error().Elements().All()[0].Name())
+	}
+
+	// file too large
+	x.ProcessStanza(newRequestIQ(stm.JID(), "movie.mp4", "2048", ""), stm)
+	elem = stm.ReceiveElement()
+	require.Equal(t, xmpp.ErrNotAcceptable.Error(), elem.Error().Elements().All()[0].Name())
+	tooLarge := elem.Error().Elements().ChildNamespace("file-too-large", uploadNamespace)
+	require.NotNil(t, tooLarge)
+	require.Equal(t, "1024", tooLarge.Elements().Child("max-file-size").Text())
+
+	// not a slot request
+	iq := xmpp.NewIQType(uuid.New(), xmpp.SetType)
+	iq.SetFromJID(stm.JID())
+	iq.SetToJID(serviceJID())
+	x.ProcessStanza(iq, stm)
+	elem = stm.ReceiveElement()
+	require.Equal(t, xmpp.ErrServiceUnavailable.Error(), elem.Error().Elements().All()[0].Name())
+}
+
+func TestHTTPUpload_Quota(t *testing.T) {
+	r, shutdown := setupTest("jackal.im")
+	defer shutdown()
+
+	stm1 := setupUser(t, r, "ortuman")
+	stm2 := setupUser(t, r, "noelia")
+
+	x, shutdownCh, dir := setupUpload(t, r, 1024, 1536)
+	defer shutdownUpload(shutdownCh, dir)
+
+	x.ProcessStanza(newRequestIQ(stm1.JID(), "a.txt", "1024", ""), stm1)
+	elem := stm1.ReceiveElement()
+	require.Equal(t, xmpp.ResultType, elem.Type())
+
+	// reserved slots count towards user quota
+	x.ProcessStanza(newRequestIQ(stm1.JID(), "b.txt", "1024", ""), stm1)
+	elem = stm1.ReceiveElement()
+	require.Equal(t, xmpp.ErrResourceConstraint.Error(), elem.Error().Elements().All()[0].Name())
+
+	x.ProcessStanza(newRequestIQ(stm2.JID(), "b.txt", "1024", ""), stm2)
+	elem = stm2.ReceiveElement()
+	require.Equal(t, xmpp.ResultType, elem.Type())
+}
+
+func setupTest(domain string) (*router.Router, func()) {
+	r, _ := router.New(&router.Config{
+		Hosts: []router.HostConfig{{Name: domain, Certificate: tls.Certificate{}}},
+	})
+	storage.Set(memstorage.New())
+	return r, func() {
+		storage.Unset()
+	}
+}
+
+func setupUser(t *testing.T, r *router.Router, username string) *stream.MockC2S {
+	require.Nil(t, storage.InsertOrUpdateUser(&model.User{Username: username, Password: "plain"}))
+
+	j, _ := jid.New(username, "jackal.im", "balcony", true)
+	stm := stream.NewMockC2S(uuid.New(), j)
+	stm.SetPresence(xmpp.NewPresence(j, j, xmpp.AvailableType))
+	r.Bind(stm)
+	return stm
+}
+
+func setupUpload(t *testing.T, r *router.Router, maxFileSize, quota int64) (*HTTPUpload, chan<- chan bool, string) {
+	dir, err := ioutil.TempDir("", "httpupload")
+	require.Nil(t, err)
+
+	x, shutdownCh, err := New(&Config{
+		Host:            "upload.jackal.im",
+		Name:            defaultServiceName,
+		BindAddr:        "127.0.0.1",
+		UploadDir:       dir,
+		MaxFileSize:     maxFileSize,
+		Quota:           quota,
+		SlotTimeout:     time.Minute,
+		ExpireAfter:     time.Hour,
+		CleanupInterval: time.Hour,
+	}, nil, r)
+	require.Nil(t, err)
+
+	// service host name is not resolvable
+	x.baseURL = strings.Replace(x.baseURL, "upload.jackal.im", "127.0.0.1", 1)
+	return x, shutdownCh, dir
+}
+
+func shutdownUpload(shutdownCh chan<- chan bool, dir string) {
+	c := make(chan bool, 1)
+	shutdownCh <- c
+	<-c
+	os.RemoveAll(dir)
+}
+
+func serviceJID() *jid.JID {
+	j, _ := jid.NewWithString("upload.jackal.im", true)
+	return j
+}
+
+func newRequestIQ(from *jid.JID, filename, size, contentType string) *xmpp.IQ {
+	req := xmpp.NewElementNamespace("request", uploadNamespace)
+	if len(filename) > 0 {
+		req.SetAttribute("filename", filename)
+	}
+	if len(size) > 0 {
+		req.SetAttribute("size", size)
+	}
+	if len(contentType) > 0 {
+		req.SetAttribute("content-type", contentType)
+	}
+	iq := xmpp.NewIQType(uuid.New(), xmpp.GetType)
+	iq.SetFromJID(from)
+	iq.SetToJID(serviceJID())
+	iq.AppendElement(req)
+	return iq
+}
@@ -0,0 +1,170 @@
+/*
+ * Copyright (c) 2018 Miguel Ángel Ortuño.
+ * See the LICENSE file for more information.
+ */
+
+package httpupload
+
+import (
+	"io"
+	"io/ioutil"
+	"mime"
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/ortuman/jackal/log"
+)
+
+// contentTypeFile is the name of the file holding the declared
+// content type of an upload, stored next to it within its slot directory.
+const contentTypeFile = ".content-type"
+
+// ServeHTTP satisfies http.Handler interface.
+func (x *HTTPUpload) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Access-Control-Allow-Origin", "*")
+	w.Header().Set("Access-Control-Allow-Methods", "OPTIONS, HEAD, GET, PUT")
+	w.Header().Set("Access-Control-Allow-Headers", "Content-Type")
+
+	slotPath, ok := parseSlotPath(r.URL.Path)
+	if !ok {
+		http.NotFound(w, r)
+		return
+	}
+	switch r.Method {
+	case http.MethodOptions:
+		w.WriteHeader(http.StatusOK)
+	case http.MethodHead, http.MethodGet:
+		x.serveFile(w, r, slotPath)
+	case http.MethodPut:
+		x.storeFile(w, r, slotPath)
+	default:
+		w.WriteHeader(http.StatusMethodNotAllowed)
+	}
+}
+
+func (x *HTTPUpload) serveFile(w http.ResponseWriter, r *http.Request, slotPath string) {
+	f, err := os.Open(filepath.Join(x.cfg.UploadDir, filepath.FromSlash(slotPath)))
+	if err != nil {
+		http.NotFound(w, r)
+		return
+	}
+	defer f.Close()
+
+	info, err := f.Stat()
+	if err != nil || !info.Mode().IsRegular() {
+		http.NotFound(w, r)
+		return
+	}
+	// never let browsers render uploaded content within upload origin
+	contentType := readContentType(filepath.Dir(f.Name()))
+	w.Header().Set("Content-Type", contentType)
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	if !isInlineContentType(contentType) {
+		w.Header().Set("Content-Disposition", mime.FormatMediaType("attachment", map[string]string{"filename": info.Name()}))
+	}
+	http.ServeContent(w, r, info.Name(), info.ModTime(), f)
+}
+
+func (x *HTTPUpload) storeFile(w http.ResponseWriter, r *http.Request, slotPath string) {
+	x.mu.Lock()
+	s := x.slots[slotPath]
+	if status := validateUpload(r, s); status != 0 {
+		x.mu.Unlock()
+		w.WriteHeader(status)
+		return
+	}
+	// slots can only be used once
+	delete(x.slots, slotPath)
+	x.mu.Unlock()
+
+	filePath := filepath.Join(x.cfg.UploadDir, filepath.FromSlash(slotPath))
+	if err := writeFile(filePath, r.Body, s.size, s.contentType); err != nil {
+		log.Error(err)
+		_ = os.RemoveAll(filepath.Dir(filePath))
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	w.WriteHeader(http.StatusCreated)
+
+	log.Infof("httpupload: stored file... (owner: %s, path: %s)", s.owner, slotPath)
+}
+
+// validateUpload returns the HTTP status code an upload request has to be rejected with,
+// or zero if it matches its slot.
+func validateUpload(r *http.Request, s *slot) int {
+	if s == nil || time.Now().After(s.expiresAt) {
+		return http.StatusForbidden
+	}
+	switch {
+	case r.ContentLength > s.size:
+		return http.StatusRequestEntityTooLarge
+	case r.ContentLength != s.size:
+		return http.StatusBadRequest
+	}
+	if len(s.contentType) > 0 && r.Header.Get("Content-Type") != s.contentType {
+		return http.StatusBadRequest
+	}
+	return 0
+}
+
+func writeFile(filePath string, r io.Reader, size int64, contentType string) error {
+	if err := os.MkdirAll(filepath.Dir(filePath), os.ModePerm); err != nil {
+		return err
+	}
+	if len(contentType) > 0 {
+		if err := ioutil.WriteFile(filepath.Join(filepath.Dir(filePath), contentTypeFile), []byte(contentType), 0644); err != nil {
+			return err
+		}
+	}
+	f, err := os.Create(filePath)
+	if err != nil {
+		return err
+	}
+	if _, err := io.CopyN(f, r, size); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+func readContentType(slotDir string) string {
+	b, err := ioutil.ReadFile(filepath.Join(slotDir, contentTypeFile))
+	if err != nil {
+		return "application/octet-stream"
+	}
+	if _, _, err := mime.ParseMediaType(string(b)); err != nil {
+		return "application/octet-stream"
+	}
+	return string(b)
+}
+
+// isInlineContentType tells whether a content type can be safely displayed by browsers.
+func isInlineContentType(contentType string) bool {
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil || mediaType == "image/svg+xml" {
+		return false // svg images may contain scripts
+	}
+	return strings.HasPrefix(mediaType, "image/") || strings.HasPrefix(mediaType, "audio/") || strings.HasPrefix(mediaType, "video/")
+}
+
+// parseSlotPath validates a request URL path returning its
+// equivalent slot path (user directory, slot identifier and filename).
+func parseSlotPath(urlPath string) (string, bool) {
+	ss := strings.Split(strings.TrimPrefix(urlPath, "/"), "/")
+	if len(ss) != 3 {
+		return "", false
+	}
+	for _, s := range ss {
+		if len(s) == 0 || s == "." || s == ".." || strings.ContainsAny(s, "\\\x00") {
+			return "", false
+		}
+	}
+	if ss[2] == contentTypeFile {
+		return "", false
+	}
+	return path.Join(ss...), true
+}
@@ -0,0 +1,196 @@
+/*
+ * Copyright (c) 2018 Miguel Ángel Ortuño.
+ * See the LICENSE file for more information.
+ */
+
+package httpupload
+
+import (
+	"bytes"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ortuman/jackal/xmpp"
+	"github.com/stretchr/testify/require"
+)
+
+func TestHTTPUpload_PutAndGet(t *testing.T) {
+	r, shutdown := setupTest("jackal.im")
+	defer shutdown()
+
+	stm := setupUser(t, r, "ortuman")
+
+	x, shutdownCh, dir := setupUpload(t, r, 1024, 0)
+	defer shutdownUpload(shutdownCh, dir)
+
+	content := []byte("Hello world!")
+
+	x.ProcessStanza(newRequestIQ(stm.JID(), "hello world.txt", "12", "text/plain"), stm)
+	elem := stm.ReceiveElement()
+	require.Equal(t, xmpp.ResultType, elem.Type())
+	slotURL := elem.Elements().ChildNamespace("slot", uploadNamespace).Elements().Child("put").Attributes().Get("url")
+
+	// content type mismatch... slot remains valid
+	resp, err := doPut(slotURL, "application/octet-stream", content)
+	require.Nil(t, err)
+	require.Equal(t, http.StatusBadRequest, resp.StatusCode)
+
+	resp, err = doPut(slotURL, "text/plain", content)
+	require.Nil(t, err)
+	require.Equal(t, http.StatusCreated, resp.StatusCode)
+
+	// slot is no longer valid
+	resp, err = doPut(slotURL, "text/plain", content)
+	require.Nil(t, err)
+	require.Equal(t, http.StatusForbidden, resp.StatusCode)
+
+	resp, err = http.Get(slotURL)
+	require.Nil(t, err)
+	defer resp.Body.Close()
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	b, _ := ioutil.ReadAll(resp.Body)
+	require.Equal(t, content, b)
+	require.Equal(t, "text/plain", resp.Header.Get("Content-Type"))
+	require.Equal(t, "nosniff", resp.Header.Get("X-Content-Type-Options"))
+	require.Equal(t, `attachment; filename="hello world.txt"`, resp.Header.Get("Content-Disposition"))
+
+	// size mismatch
+	x.ProcessStanza(newRequestIQ(stm.JID(), "a.txt", "10", ""), stm)
+	elem = stm.ReceiveElement()
+	slotURL = elem.Elements().ChildNamespace("slot", uploadNamespace).Elements().Child("put").Attributes().Get("url")
+
+	resp, err = doPut(slotURL, "", content)
+	require.Nil(t, err)
+	require.Equal(t, http.StatusRequestEntityTooLarge, resp.StatusCode)
+
+	x.ProcessStanza(newRequestIQ(stm.JID(), "b.txt", "20", ""), stm)
+	elem = stm.ReceiveElement()
+	slotURL = elem.Elements().ChildNamespace("slot", uploadNamespace).Elements().Child("put").Attributes().Get("url")
+
+	resp, err = doPut(slotURL, "", content)
+	require.Nil(t, err)
+	require.Equal(t, http.StatusBadRequest, resp.StatusCode)
+
+	// unknown files
+	resp, err = http.Get(x.baseURL + "/foo/bar/a.txt")
+	require.Nil(t, err)
+	require.Equal(t, http.StatusNotFound, resp.StatusCode)
+
+	resp, err = http.Get(x.baseURL + "/a.txt")
+	require.Nil(t, err)
+	require.Equal(t, http.StatusNotFound, resp.StatusCode)
+}
+
+func TestHTTPUpload_ServedContentType(t *testing.T) {
+	r, shutdown := setupTest("jackal.im")
+	defer shutdown()
+
+	stm := setupUser(t, r, "ortuman")
+
+	x, shutdownCh, dir := setupUpload(t, r, 1024, 0)
+	defer shutdownUpload(shutdownCh, dir)
+
+	for _, tc := range []struct {
+		filename    string
+		contentType string
+		served      string
+		inline      bool
+	}{
+		{"a.png", "image/png", "image/png", true},
+		{"b.svg", "image/svg+xml", "image/svg+xml", false},
+		{"c.html", "", "application/octet-stream", false},
+	} {
+		x.ProcessStanza(newRequestIQ(stm.JID(), tc.filename, "4", tc.contentType), stm)
+		elem := stm.ReceiveElement()
+		slotURL := elem.Elements().ChildNamespace("slot", uploadNamespace).Elements().Child("put").Attributes().Get("url")
+
+		resp, err := doPut(slotURL, tc.contentType, []byte("test"))
+		require.Nil(t, err)
+		require.Equal(t, http.StatusCreated, resp.StatusCode)
+
+		resp, err = http.Get(slotURL)
+		require.Nil(t, err)
+		resp.Body.Close()
+		require.Equal(t, tc.served, resp.Header.Get("Content-Type"), tc.filename)
+		require.Equal(t, "nosniff", resp.Header.Get("X-Content-Type-Options"))
+		require.Equal(t, tc.inline, len(resp.Header.Get("Content-Disposition")) == 0, tc.filename)
+	}
+	// content type files are never served
+	slotDirs, _ := filepath.Glob(filepath.Join(dir, "*", "*"))
+	require.NotEmpty(t, slotDirs)
+	rel, _ := filepath.Rel(dir, slotDirs[0])
+	resp, err := http.Get(x.baseURL + "/" + filepath.ToSlash(rel) + "/" + contentTypeFile)
+	require.Nil(t, err)
+	require.Equal(t, http.StatusNotFound, resp.StatusCode)
+}
+
+func TestHTTPUpload_CleanUp(t *testing.T) {
+	r, shutdown := setupTest("jackal.im")
+	defer shutdown()
+
+	stm := setupUser(t, r, "ortuman")
+
+	x, shutdownCh, dir := setupUpload(t, r, 1024, 0)
+	defer shutdownUpload(shutdownCh, dir)
+
+	x.ProcessStanza(newRequestIQ(stm.JID(), "a.txt", "4", ""), stm)
+	elem := stm.ReceiveElement()
+	slotURL := elem.Elements().ChildNamespace("slot", uploadNamespace).Elements().Child("put").Attributes().Get("url")
+
+	resp, err := doPut(slotURL, "", []byte("test"))
+	require.Nil(t, err)
+	require.Equal(t, http.StatusCreated, resp.StatusCode)
+
+	// pending slot
+	x.ProcessStanza(newRequestIQ(stm.JID(), "b.txt", "4", ""), stm)
+	_ = stm.ReceiveElement()
+
+	x.cleanUp()
+	require.Equal(t, 1, len(x.slots))
+	files, _ := filepath.Glob(filepath.Join(dir, "*", "*"))
+	require.Equal(t, 1, len(files))
+
+	// age uploads and slots
+	old := time.Now().Add(-2 * time.Hour)
+	require.Nil(t, os.Chtimes(files[0], old, old))
+	for _, s := range x.slots {
+		s.expiresAt = old
+	}
+	x.cleanUp()
+	require.Equal(t, 0, len(x.slots))
+	files, _ = filepath.Glob(filepath.Join(dir, "*"))
+	require.Equal(t, 0, len(files))
+}
+
+func TestHTTPUpload_ParseSlotPath(t *testing.T) {
+	p, ok := parseSlotPath("/user/slot/file.txt")
+	require.True(t, ok)
+	require.Equal(t, "user/slot/file.txt", p)
+
+	for _, invalid := range []string{"/", "/file.txt", "/user//file.txt", "/user/../file.txt", "/a/b/c/d", "/a/b/c\\d"} {
+		_, ok := parseSlotPath(invalid)
+		require.False(t, ok, invalid)
+	}
+	require.True(t, isValidFilename("photo.jpg"))
+	require.False(t, isValidFilename(".."))
+	require.False(t, isValidFilename("a/b"))
+	require.Equal(t, "a/b%20c", strings.TrimSpace(escapePath("a/b c")))
+}
+
+func doPut(url, contentType string, content []byte) (*http.Response, error) {
+	req, _ := http.NewRequest(http.MethodPut, url, bytes.NewReader(content))
+	if len(contentType) > 0 {
+		req.Header.Set("Content-Type", contentType)
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	resp.Body.Close()
+	return resp, nil
+}
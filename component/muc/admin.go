@@ -0,0 +1,280 @@
+/*
+ * Copyright (c) 2018 Miguel Ángel Ortuño.
+ * See the LICENSE file for more information.
+ */
+
+package muc
+
+import (
+	"github.com/ortuman/jackal/log"
+	"github.com/ortuman/jackal/model/mucmodel"
+	"github.com/ortuman/jackal/module/xep0004"
+	"github.com/ortuman/jackal/storage"
+	"github.com/ortuman/jackal/xmpp"
+	"github.com/ortuman/jackal/xmpp/jid"
+)
+
+func (x *Muc) processAdminIQ(r *room, iq *xmpp.IQ, query xmpp.XElement) {
+	items := query.Elements().Children("item")
+	if len(items) == 0 {
+		_ = x.router.Route(iq.BadRequestError())
+		return
+	}
+	requester := r.m.Affiliation(iq.FromJID().ToBareJID().String())
+	if iq.IsGet() {
+		x.sendAdminList(r, iq, requester, items[0])
+		return
+	}
+	// validate every item before applying any change
+	for _, item := range items {
+		if sErr := x.validateAdminItem(r, iq.FromJID(), requester, item); sErr != nil {
+			_ = x.router.Route(xmpp.NewErrorStanzaFromStanza(iq, sErr, nil))
+			return
+		}
+	}
+	for _, item := range items {
+		if role := item.Attributes().Get("role"); len(role) > 0 {
+			if occ := r.occupants[item.Attributes().Get("nick")]; occ != nil {
+				x.setRole(r, occ, role)
+			}
+		} else {
+			j, _ := jid.NewWithString(item.Attributes().Get("jid"), false)
+			x.setAffiliation(r, j.ToBareJID().String(), item.Attributes().Get("affiliation"))
+		}
+	}
+	x.persistRoom(r)
+	_ = x.router.Route(iq.ResultIQ())
+}
+
+func (x *Muc) sendAdminList(r *room, iq *xmpp.IQ, requester string, item xmpp.XElement) {
+	q := xmpp.NewElementNamespace("query", mucAdminNamespace)
+
+	if affiliation := item.Attributes().Get("affiliation"); len(affiliation) > 0 {
+		if affiliationRank(requester) < affiliationRank(mucmodel.AffiliationAdmin) {
+			_ = x.router.Route(iq.ForbiddenError())
+			return
+		}
+		for j, aff := range r.m.Affiliations {
+			if aff != affiliation {
+				continue
+			}
+			itm := xmpp.NewElementName("item")
+			itm.SetAttribute("affiliation", aff)
+			itm.SetAttribute("jid", j)
+			q.AppendElement(itm)
+		}
+	} else if role := item.Attributes().Get("role"); len(role) > 0 {
+		if !isModerator(r.occupantByJID(iq.FromJID())) {
+			_ = x.router.Route(iq.ForbiddenError())
+			return
+		}
+		for _, occ := range r.occupants {
+			if occ.role != role {
+				continue
+			}
+			itm := xmpp.NewElementName("item")
+			itm.SetAttribute("affiliation", r.affiliation(occ))
+			itm.SetAttribute("role", occ.role)
+			itm.SetAttribute("nick", occ.nick)
+			itm.SetAttribute("jid", occ.jid.String())
+			q.AppendElement(itm)
+		}
+	} else {
+		_ = x.router.Route(iq.BadRequestError())
+		return
+	}
+	result := iq.ResultIQ()
+	result.AppendElement(q)
+	_ = x.router.Route(result)
+}
+
+func (x *Muc) validateAdminItem(r *room, fromJID *jid.JID, requester string, item xmpp.XElement) *xmpp.StanzaError {
+	if role := item.Attributes().Get("role"); len(role) > 0 {
+		switch role {
+		case mucmodel.RoleModerator, mucmodel.RoleParticipant, mucmodel.RoleVisitor, mucmodel.RoleNone:
+			break
+		default:
+			return xmpp.ErrBadRequest
+		}
+		if !isModerator(r.occupantByJID(fromJID)) {
+			return xmpp.ErrForbidden
+		}
+		target := r.occupants[item.Attributes().Get("nick")]
+		if target == nil {
+			return xmpp.ErrItemNotFound
+		}
+		if role == mucmodel.RoleModerator && affiliationRank(requester) < affiliationRank(mucmodel.AffiliationAdmin) {
+			return xmpp.ErrNotAllowed
+		}
+		// only owners can change admins and owners roles
+		if affiliationRank(r.affiliation(target)) >= affiliationRank(mucmodel.AffiliationAdmin) &&
+			requester != mucmodel.AffiliationOwner {
+			return xmpp.ErrNotAllowed
+		}
+		return nil
+	}
+	affiliation := item.Attributes().Get("affiliation")
+	switch affiliation {
+	case mucmodel.AffiliationOwner, mucmodel.AffiliationAdmin, mucmodel.AffiliationMember,
+		mucmodel.AffiliationOutcast, mucmodel.AffiliationNone:
+		break
+	default:
+		return xmpp.ErrBadRequest
+	}
+	j, err := jid.NewWithString(item.Attributes().Get("jid"), false)
+	if err != nil {
+		return xmpp.ErrJidMalformed
+	}
+	current := r.m.Affiliation(j.ToBareJID().String())
+
+	switch requester {
+	case mucmodel.AffiliationOwner:
+		// the last owner can't be removed
+		if current == mucmodel.AffiliationOwner && affiliation != mucmodel.AffiliationOwner && r.ownersCount() == 1 {
+			return xmpp.ErrConflict
+		}
+	case mucmodel.AffiliationAdmin:
+		if affiliationRank(current) >= affiliationRank(mucmodel.AffiliationAdmin) ||
+			affiliationRank(affiliation) >= affiliationRank(mucmodel.AffiliationAdmin) {
+			return xmpp.ErrNotAllowed
+		}
+	default:
+		return xmpp.ErrForbidden
+	}
+	return nil
+}
+
+func (x *Muc) setRole(r *room, occ *occupant, role string) {
+	if role == mucmodel.RoleNone {
+		x.leaveRoom(r, occ, statusKicked)
+		return
+	}
+	occ.role = role
+	x.broadcastPresence(r, occ, xmpp.AvailableType)
+}
+
+func (x *Muc) setAffiliation(r *room, bareJID string, affiliation string) {
+	r.m.SetAffiliation(bareJID, affiliation)
+
+	for _, occ := range r.occupants {
+		if occ.jid.ToBareJID().String() != bareJID {
+			continue
+		}
+		switch {
+		case affiliation == mucmodel.AffiliationOutcast:
+			x.leaveRoom(r, occ, statusBanned)
+		case affiliation == mucmodel.AffiliationNone && r.m.Config.MembersOnly:
+			x.leaveRoom(r, occ, statusMemberRemove)
+		default:
+			occ.role = r.defaultRole(affiliation)
+			x.broadcastPresence(r, occ, xmpp.AvailableType)
+		}
+	}
+	log.Infof("muc: updated affiliation... (room: %s, jid: %s, affiliation: %s)", r.jid.String(), bareJID, affiliation)
+}
+
+func (x *Muc) processOwnerIQ(r *room, iq *xmpp.IQ, query xmpp.XElement) {
+	if r.m.Affiliation(iq.FromJID().ToBareJID().String()) != mucmodel.AffiliationOwner {
+		_ = x.router.Route(iq.ForbiddenError())
+		return
+	}
+	if iq.IsGet() {
+		q := xmpp.NewElementNamespace("query", mucOwnerNamespace)
+		q.AppendElement(configForm(&r.m.Config).Element())
+
+		result := iq.ResultIQ()
+		result.AppendElement(q)
+		_ = x.router.Route(result)
+		return
+	}
+	if destroy := query.Elements().Child("destroy"); destroy != nil {
+		x.destroyRoomWithOccupants(r, destroy)
+		_ = x.router.Route(iq.ResultIQ())
+		return
+	}
+	formElem := query.Elements().ChildNamespace("x", formNamespace)
+	if formElem == nil {
+		_ = x.router.Route(iq.BadRequestError())
+		return
+	}
+	form, err := xep0004.NewFormFromElement(formElem)
+	if err != nil {
+		_ = x.router.Route(iq.BadRequestError())
+		return
+	}
+	switch form.Type {
+	case xep0004.Cancel:
+		if r.locked {
+			x.destroyRoomWithOccupants(r, nil)
+		}
+		_ = x.router.Route(iq.ResultIQ())
+		return
+	case xep0004.Submit:
+		break
+	default:
+		_ = x.router.Route(iq.BadRequestError())
+		return
+	}
+	cfg := r.m.Config
+	if err := applyConfigForm(&cfg, form); err != nil {
+		log.Error(err)
+		_ = x.router.Route(iq.NotAcceptableError())
+		return
+	}
+	wasPersistent := r.m.Config.Persistent
+	r.m.Config = cfg
+	r.locked = false
+
+	if wasPersistent && !cfg.Persistent {
+		if err := storage.DeleteRoom(r.m.JID); err != nil {
+			log.Error(err)
+		}
+	}
+	x.persistRoom(r)
+	_ = x.router.Route(iq.ResultIQ())
+
+	log.Infof("muc: configured room... (room: %s)", r.jid.String())
+}
+
+func (x *Muc) destroyRoomWithOccupants(r *room, destroy xmpp.XElement) {
+	for _, occ := range r.occupants {
+		occ.role = mucmodel.RoleNone
+
+		item := x.occupantItem(r, occ, occ)
+		item.SetAttribute("affiliation", mucmodel.AffiliationNone)
+		p := xmpp.NewPresence(r.occupantJID(occ.nick), occ.jid, xmpp.UnavailableType)
+		xu := xmpp.NewElementNamespace("x", mucUserNamespace)
+		xu.AppendElement(item)
+		if destroy != nil {
+			xu.AppendElement(destroy)
+		}
+		p.AppendElement(xu)
+		_ = x.router.Route(p)
+	}
+	r.occupants = make(map[string]*occupant)
+	x.destroyRoom(r)
+}
+
+func (r *room) ownersCount() int {
+	var count int
+	for _, aff := range r.m.Affiliations {
+		if aff == mucmodel.AffiliationOwner {
+			count++
+		}
+	}
+	return count
+}
+
+func affiliationRank(affiliation string) int {
+	switch affiliation {
+	case mucmodel.AffiliationOwner:
+		return 4
+	case mucmodel.AffiliationAdmin:
+		return 3
+	case mucmodel.AffiliationMember:
+		return 2
+	case mucmodel.AffiliationNone:
+		return 1
+	}
+	return 0
+}
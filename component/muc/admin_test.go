@@ -0,0 +1,159 @@
+/*
+ * Copyright (c) 2018 Miguel Ángel Ortuño.
+ * See the LICENSE file for more information.
+ */
+
+package muc
+
+import (
+	"testing"
+
+	"github.com/ortuman/jackal/model/mucmodel"
+	"github.com/ortuman/jackal/storage"
+	"github.com/ortuman/jackal/stream"
+	"github.com/ortuman/jackal/xmpp"
+	"github.com/ortuman/jackal/xmpp/jid"
+	"github.com/pborman/uuid"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMuc_KickOccupant(t *testing.T) {
+	r, _, shutdown := setupTest("jackal.im")
+	defer shutdown()
+
+	stm1 := setupUser(t, r, "ortuman")
+	stm2 := setupUser(t, r, "noelia")
+
+	x, shutdownCh := New(&Config{Host: "conference.jackal.im", MaxHistorySize: 10}, nil, r)
+	defer shutdownMuc(shutdownCh)
+
+	createInstantRoom(t, x, stm1, "lobby", "ortuman")
+	joinOccupant(x, stm1, stm2, "lobby", "noelia")
+
+	// participants can't kick
+	x.ProcessStanza(newAdminIQ(stm2.JID(), "lobby", "nick", "ortuman", "role", mucmodel.RoleNone), stm2)
+	elem := stm2.ReceiveElement()
+	require.Equal(t, xmpp.ErrForbidden.Error(), elem.Error().Elements().All()[0].Name())
+
+	x.ProcessStanza(newAdminIQ(stm1.JID(), "lobby", "nick", "noelia", "role", mucmodel.RoleNone), stm1)
+
+	elem = stm2.ReceiveElement()
+	require.Equal(t, xmpp.UnavailableType, elem.Type())
+	require.True(t, hasStatusCode(elem, statusKicked))
+
+	elem = stm1.ReceiveElement()
+	require.Equal(t, xmpp.UnavailableType, elem.Type())
+	require.True(t, hasStatusCode(elem, statusKicked))
+
+	elem = stm1.ReceiveElement()
+	require.Equal(t, "iq", elem.Name())
+	require.Equal(t, xmpp.ResultType, elem.Type())
+}
+
+func TestMuc_BanUser(t *testing.T) {
+	r, _, shutdown := setupTest("jackal.im")
+	defer shutdown()
+
+	stm1 := setupUser(t, r, "ortuman")
+	stm2 := setupUser(t, r, "noelia")
+
+	x, shutdownCh := New(&Config{Host: "conference.jackal.im", MaxHistorySize: 10}, nil, r)
+	defer shutdownMuc(shutdownCh)
+
+	createRoom(x, stm1, "lobby", "ortuman")
+	submitConfig(t, x, stm1, "lobby", map[string]string{persistentRoomField: "1"})
+	joinOccupant(x, stm1, stm2, "lobby", "noelia")
+
+	x.ProcessStanza(newAdminIQ(stm1.JID(), "lobby", "jid", "noelia@jackal.im", "affiliation", mucmodel.AffiliationOutcast), stm1)
+
+	elem := stm2.ReceiveElement()
+	require.Equal(t, xmpp.UnavailableType, elem.Type())
+	require.True(t, hasStatusCode(elem, statusBanned))
+
+	_ = stm1.ReceiveElement() // unavailable presence
+	elem = stm1.ReceiveElement()
+	require.Equal(t, xmpp.ResultType, elem.Type())
+
+	rm, _ := storage.FetchRoom("lobby@conference.jackal.im")
+	require.NotNil(t, rm)
+	require.Equal(t, mucmodel.AffiliationOutcast, rm.Affiliation("noelia@jackal.im"))
+
+	// outcasts can't join
+	joinRoom(x, stm2, "lobby", "noelia")
+	elem = stm2.ReceiveElement()
+	require.Equal(t, xmpp.ErrForbidden.Error(), elem.Error().Elements().All()[0].Name())
+
+	// the last owner can't be removed
+	x.ProcessStanza(newAdminIQ(stm1.JID(), "lobby", "jid", "ortuman@jackal.im", "affiliation", mucmodel.AffiliationMember), stm1)
+	elem = stm1.ReceiveElement()
+	require.Equal(t, xmpp.ErrConflict.Error(), elem.Error().Elements().All()[0].Name())
+
+	// fetch outcast list
+	iq := newAdminIQ(stm1.JID(), "lobby", "", "", "affiliation", mucmodel.AffiliationOutcast)
+	iq.SetType(xmpp.GetType)
+	x.ProcessStanza(iq, stm1)
+
+	elem = stm1.ReceiveElement()
+	items := elem.Elements().ChildNamespace("query", mucAdminNamespace).Elements().Children("item")
+	require.Equal(t, 1, len(items))
+	require.Equal(t, "noelia@jackal.im", items[0].Attributes().Get("jid"))
+}
+
+func TestMuc_DestroyRoom(t *testing.T) {
+	r, _, shutdown := setupTest("jackal.im")
+	defer shutdown()
+
+	stm1 := setupUser(t, r, "ortuman")
+
+	x, shutdownCh := New(&Config{Host: "conference.jackal.im", MaxHistorySize: 10}, nil, r)
+	defer shutdownMuc(shutdownCh)
+
+	createRoom(x, stm1, "lobby", "ortuman")
+	submitConfig(t, x, stm1, "lobby", map[string]string{persistentRoomField: "1"})
+
+	roomJID, _ := jid.New("lobby", "conference.jackal.im", "", true)
+	q := xmpp.NewElementNamespace("query", mucOwnerNamespace)
+	q.AppendElement(xmpp.NewElementName("destroy"))
+	iq := xmpp.NewIQType(uuid.New(), xmpp.SetType)
+	iq.SetFromJID(stm1.JID())
+	iq.SetToJID(roomJID)
+	iq.AppendElement(q)
+	x.ProcessStanza(iq, stm1)
+
+	elem := stm1.ReceiveElement()
+	require.Equal(t, xmpp.UnavailableType, elem.Type())
+	require.NotNil(t, elem.Elements().ChildNamespace("x", mucUserNamespace).Elements().Child("destroy"))
+
+	elem = stm1.ReceiveElement()
+	require.Equal(t, xmpp.ResultType, elem.Type())
+
+	rm, err := storage.FetchRoom("lobby@conference.jackal.im")
+	require.Nil(t, err)
+	require.Nil(t, rm)
+}
+
+func joinOccupant(x *Muc, owner, stm *stream.MockC2S, room, nick string) {
+	joinRoom(x, stm, room, nick)
+	_ = stm.ReceiveElement()   // owner presence
+	_ = stm.ReceiveElement()   // self presence
+	_ = stm.ReceiveElement()   // subject
+	_ = owner.ReceiveElement() // occupant presence
+}
+
+func newAdminIQ(from *jid.JID, room, targetAttr, target, attr, value string) *xmpp.IQ {
+	roomJID, _ := jid.New(room, "conference.jackal.im", "", true)
+
+	item := xmpp.NewElementName("item")
+	if len(targetAttr) > 0 {
+		item.SetAttribute(targetAttr, target)
+	}
+	item.SetAttribute(attr, value)
+	q := xmpp.NewElementNamespace("query", mucAdminNamespace)
+	q.AppendElement(item)
+
+	iq := xmpp.NewIQType(uuid.New(), xmpp.SetType)
+	iq.SetFromJID(from)
+	iq.SetToJID(roomJID)
+	iq.AppendElement(q)
+	return iq
+}
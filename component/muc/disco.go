@@ -0,0 +1,120 @@
+/*
+ * Copyright (c) 2018 Miguel Ángel Ortuño.
+ * See the LICENSE file for more information.
+ */
+
+package muc
+
+import (
+	"sort"
+	"strconv"
+
+	"github.com/ortuman/jackal/model/mucmodel"
+	"github.com/ortuman/jackal/module/xep0004"
+	"github.com/ortuman/jackal/module/xep0030"
+	"github.com/ortuman/jackal/xmpp"
+	"github.com/ortuman/jackal/xmpp/jid"
+)
+
+const (
+	discoInfoNamespace  = "http://jabber.org/protocol/disco#info"
+	discoItemsNamespace = "http://jabber.org/protocol/disco#items"
+)
+
+type discoInfoProvider struct {
+	muc *Muc
+}
+
+func (dp *discoInfoProvider) Identities(toJID, fromJID *jid.JID, node string) []xep0030.Identity {
+	if node != "" {
+		return nil
+	}
+	if toJID.IsServer() {
+		return []xep0030.Identity{{Category: "conference", Type: "text", Name: dp.muc.cfg.Name}}
+	}
+	dp.muc.mu.RLock()
+	defer dp.muc.mu.RUnlock()
+	r := dp.muc.rooms[toJID.Node()]
+	if r == nil {
+		return nil
+	}
+	return []xep0030.Identity{{Category: "conference", Type: "text", Name: r.m.Config.Name}}
+}
+
+func (dp *discoInfoProvider) Items(toJID, fromJID *jid.JID, node string) ([]xep0030.Item, *xmpp.StanzaError) {
+	if node != "" {
+		return nil, nil
+	}
+	dp.muc.mu.RLock()
+	defer dp.muc.mu.RUnlock()
+
+	if !toJID.IsServer() {
+		if dp.muc.rooms[toJID.Node()] == nil {
+			return nil, xmpp.ErrItemNotFound
+		}
+		return nil, nil // room occupants are not disclosed
+	}
+	var items []xep0030.Item
+	for _, r := range dp.muc.rooms {
+		if r.locked || !r.m.Config.Public {
+			continue
+		}
+		items = append(items, xep0030.Item{Jid: r.jid.String(), Name: r.m.Config.Name})
+	}
+	sort.Slice(items, func(i, j int) bool { return items[i].Jid < items[j].Jid })
+	return items, nil
+}
+
+func (dp *discoInfoProvider) Features(toJID, fromJID *jid.JID, node string) ([]xep0030.Feature, *xmpp.StanzaError) {
+	if node != "" {
+		return nil, nil
+	}
+	if toJID.IsServer() {
+		return []xep0030.Feature{discoInfoNamespace, discoItemsNamespace, mucNamespace}, nil
+	}
+	dp.muc.mu.RLock()
+	defer dp.muc.mu.RUnlock()
+	r := dp.muc.rooms[toJID.Node()]
+	if r == nil {
+		return nil, xmpp.ErrItemNotFound
+	}
+	cfg := &r.m.Config
+	features := []xep0030.Feature{
+		mucNamespace,
+		featureName(cfg.Persistent, "muc_persistent", "muc_temporary"),
+		featureName(cfg.Public, "muc_public", "muc_hidden"),
+		featureName(cfg.MembersOnly, "muc_membersonly", "muc_open"),
+		featureName(cfg.Moderated, "muc_moderated", "muc_unmoderated"),
+		featureName(cfg.PasswordProtected, "muc_passwordprotected", "muc_unsecured"),
+		featureName(cfg.Whois == mucmodel.WhoisAnyone, "muc_nonanonymous", "muc_semianonymous"),
+	}
+	return features, nil
+}
+
+func (dp *discoInfoProvider) Form(toJID, fromJID *jid.JID, node string) (*xep0004.DataForm, *xmpp.StanzaError) {
+	if node != "" || toJID.IsServer() {
+		return nil, nil
+	}
+	dp.muc.mu.RLock()
+	defer dp.muc.mu.RUnlock()
+	r := dp.muc.rooms[toJID.Node()]
+	if r == nil {
+		return nil, xmpp.ErrItemNotFound
+	}
+	return &xep0004.DataForm{
+		Type: xep0004.Result,
+		Fields: []xep0004.Field{
+			{Var: formTypeField, Type: xep0004.Hidden, Values: []string{mucRoomInfoNamespace}},
+			{Var: "muc#roominfo_description", Label: "Description", Values: []string{r.m.Config.Description}},
+			{Var: "muc#roominfo_subject", Label: "Subject", Values: []string{r.m.Subject}},
+			{Var: "muc#roominfo_occupants", Label: "Number of occupants", Values: []string{strconv.Itoa(len(r.occupants))}},
+		},
+	}, nil
+}
+
+func featureName(cond bool, trueFeature, falseFeature string) string {
+	if cond {
+		return trueFeature
+	}
+	return falseFeature
+}
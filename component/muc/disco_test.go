@@ -0,0 +1,65 @@
+/*
+ * Copyright (c) 2018 Miguel Ángel Ortuño.
+ * See the LICENSE file for more information.
+ */
+
+package muc
+
+import (
+	"testing"
+
+	"github.com/ortuman/jackal/module/xep0030"
+	"github.com/ortuman/jackal/xmpp"
+	"github.com/ortuman/jackal/xmpp/jid"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMuc_DiscoInfoProvider(t *testing.T) {
+	r, _, shutdown := setupTest("jackal.im")
+	defer shutdown()
+
+	stm1 := setupUser(t, r, "ortuman")
+
+	x, shutdownCh := New(&Config{Host: "conference.jackal.im", Name: "Chatrooms", MaxHistorySize: 10}, nil, r)
+	defer shutdownMuc(shutdownCh)
+
+	dp := &discoInfoProvider{muc: x}
+
+	serviceJID, _ := jid.NewWithString("conference.jackal.im", true)
+	roomJID, _ := jid.New("lobby", "conference.jackal.im", "", true)
+
+	ids := dp.Identities(serviceJID, stm1.JID(), "")
+	require.Equal(t, 1, len(ids))
+	require.Equal(t, "conference", ids[0].Category)
+	require.Equal(t, "Chatrooms", ids[0].Name)
+
+	features, sErr := dp.Features(serviceJID, stm1.JID(), "")
+	require.Nil(t, sErr)
+	require.Contains(t, features, mucNamespace)
+
+	_, sErr = dp.Features(roomJID, stm1.JID(), "")
+	require.Equal(t, xmpp.ErrItemNotFound, sErr)
+
+	createRoom(x, stm1, "lobby", "ortuman")
+
+	// locked rooms are not listed
+	syncMuc(x)
+	items, _ := dp.Items(serviceJID, stm1.JID(), "")
+	require.Equal(t, 0, len(items))
+
+	submitConfig(t, x, stm1, "lobby", map[string]string{roomNameField: "The Lobby", publicRoomField: "1"})
+
+	items, _ = dp.Items(serviceJID, stm1.JID(), "")
+	require.Equal(t, []xep0030.Item{{Jid: "lobby@conference.jackal.im", Name: "The Lobby"}}, items)
+
+	features, sErr = dp.Features(roomJID, stm1.JID(), "")
+	require.Nil(t, sErr)
+	require.Contains(t, features, "muc_temporary")
+	require.Contains(t, features, "muc_public")
+	require.Contains(t, features, "muc_semianonymous")
+
+	form, sErr := dp.Form(roomJID, stm1.JID(), "")
+	require.Nil(t, sErr)
+	require.NotNil(t, form)
+	require.Equal(t, mucRoomInfoNamespace, form.Fields[0].Values[0])
+}
@@ -0,0 +1,263 @@
+/*
+ * Copyright (c) 2018 Miguel Ángel Ortuño.
+ * See the LICENSE file for more information.
+ */
+
+package muc
+
+import (
+	"errors"
+	"sync"
+
+	"github.com/ortuman/jackal/log"
+	"github.com/ortuman/jackal/model/mucmodel"
+	"github.com/ortuman/jackal/module/xep0030"
+	"github.com/ortuman/jackal/router"
+	"github.com/ortuman/jackal/runqueue"
+	"github.com/ortuman/jackal/storage"
+	"github.com/ortuman/jackal/stream"
+	"github.com/ortuman/jackal/xmpp"
+	"github.com/ortuman/jackal/xmpp/jid"
+)
+
+const (
+	mucNamespace           = "http://jabber.org/protocol/muc"
+	mucUserNamespace       = "http://jabber.org/protocol/muc#user"
+	mucAdminNamespace      = "http://jabber.org/protocol/muc#admin"
+	mucOwnerNamespace      = "http://jabber.org/protocol/muc#owner"
+	mucRoomConfigNamespace = "http://jabber.org/protocol/muc#roomconfig"
+	mucRoomInfoNamespace   = "http://jabber.org/protocol/muc#roominfo"
+	delayNamespace         = "urn:xmpp:delay"
+	formNamespace          = "jabber:x:data"
+)
+
+const (
+	defaultServiceName    = "Chatrooms"
+	defaultMaxHistorySize = 20
+)
+
+// Config represents multi-user chat service configuration.
+type Config struct {
+	Host           string
+	Name           string
+	MaxHistorySize int
+}
+
+type configProxy struct {
+	Host           string `yaml:"host"`
+	Name           string `yaml:"name"`
+	MaxHistorySize *int   `yaml:"max_history_size"`
+}
+
+// UnmarshalYAML satisfies Unmarshaler interface.
+func (c *Config) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	p := configProxy{}
+	if err := unmarshal(&p); err != nil {
+		return err
+	}
+	if len(p.Host) == 0 {
+		return errors.New("muc.Config: host must be specified")
+	}
+	c.Host = p.Host
+	c.Name = p.Name
+	if len(c.Name) == 0 {
+		c.Name = defaultServiceName
+	}
+	// an explicit zero size disables room history
+	c.MaxHistorySize = defaultMaxHistorySize
+	if p.MaxHistorySize != nil {
+		c.MaxHistorySize = *p.MaxHistorySize
+	}
+	return nil
+}
+
+// Muc represents a multi-user chat service component.
+type Muc struct {
+	cfg       *Config
+	discoInfo *xep0030.DiscoInfo
+	router    *router.Router
+	runQueue  *runqueue.RunQueue
+
+	// mu guards rooms state, so that it can be inspected from disco info provider.
+	mu    sync.RWMutex
+	rooms map[string]*room
+}
+
+// New returns a multi-user chat service component.
+func New(config *Config, discoInfo *xep0030.DiscoInfo, router *router.Router) (*Muc, chan<- chan bool) {
+	x := &Muc{
+		cfg:       config,
+		discoInfo: discoInfo,
+		router:    router,
+		runQueue:  runqueue.New("muc"),
+		rooms:     make(map[string]*room),
+	}
+	x.loadRooms()
+
+	if discoInfo != nil {
+		discoInfo.RegisterServerItem(xep0030.Item{Jid: config.Host, Name: config.Name})
+		discoInfo.RegisterProvider(config.Host, &discoInfoProvider{muc: x})
+	}
+	shutdownCh := make(chan chan bool)
+	go x.waitForShutdown(shutdownCh)
+	return x, shutdownCh
+}
+
+// Host returns multi-user chat service host name.
+func (x *Muc) Host() string {
+	return x.cfg.Host
+}
+
+// ProcessStanza processes a stanza addressed to the
+// multi-user chat service or to any of its rooms.
+func (x *Muc) ProcessStanza(stanza xmpp.Stanza, _ stream.C2S) {
+	x.runQueue.Run(func() {
+		x.mu.Lock()
+		defer x.mu.Unlock()
+		x.processStanza(stanza)
+	})
+}
+
+func (x *Muc) processStanza(stanza xmpp.Stanza) {
+	if stanza.IsError() {
+		return
+	}
+	if stanza.ToJID().IsServer() {
+		// nothing but disco info is served by the service itself
+		if iq, ok := stanza.(*xmpp.IQ); ok && (iq.IsGet() || iq.IsSet()) {
+			_ = x.router.Route(iq.ServiceUnavailableError())
+		}
+		return
+	}
+	switch stanza := stanza.(type) {
+	case *xmpp.Presence:
+		x.processPresence(stanza)
+	case *xmpp.Message:
+		x.processMessage(stanza)
+	case *xmpp.IQ:
+		x.processIQ(stanza)
+	}
+}
+
+func (x *Muc) processPresence(presence *xmpp.Presence) {
+	toJID := presence.ToJID()
+	r := x.rooms[toJID.Node()]
+
+	switch {
+	case presence.IsUnavailable():
+		if r == nil {
+			return
+		}
+		if occ := r.occupantByJID(presence.FromJID()); occ != nil {
+			occ.presence = presence
+			x.leaveRoom(r, occ)
+		}
+
+	case presence.IsAvailable():
+		if len(toJID.Resource()) == 0 {
+			_ = x.router.Route(presence.JidMalformedError())
+			return
+		}
+		if r == nil {
+			r = x.createRoom(toJID.ToBareJID(), presence.FromJID())
+		} else if occ := r.occupantByJID(presence.FromJID()); occ != nil {
+			if occ.nick != toJID.Resource() {
+				x.changeNick(r, occ, presence)
+			} else {
+				occ.presence = presence
+				x.broadcastPresence(r, occ, xmpp.AvailableType)
+			}
+			return
+		}
+		x.joinRoom(r, presence)
+	}
+}
+
+func (x *Muc) processMessage(message *xmpp.Message) {
+	r := x.rooms[message.ToJID().Node()]
+	if r == nil {
+		_ = x.router.Route(message.ItemNotFoundError())
+		return
+	}
+	occ := r.occupantByJID(message.FromJID())
+
+	switch {
+	case message.IsGroupChat():
+		x.sendGroupChatMessage(r, occ, message)
+	case message.ToJID().IsFullWithUser():
+		x.sendPrivateMessage(r, occ, message)
+	default:
+		if xu := message.Elements().ChildNamespace("x", mucUserNamespace); xu != nil {
+			if invite := xu.Elements().Child("invite"); invite != nil {
+				x.sendInvitation(r, occ, message, invite)
+				return
+			}
+		}
+		_ = x.router.Route(message.BadRequestError())
+	}
+}
+
+func (x *Muc) processIQ(iq *xmpp.IQ) {
+	if !iq.IsGet() && !iq.IsSet() {
+		return
+	}
+	r := x.rooms[iq.ToJID().Node()]
+	if r == nil {
+		_ = x.router.Route(iq.ItemNotFoundError())
+		return
+	}
+	if iq.ToJID().IsFullWithUser() {
+		_ = x.router.Route(iq.ServiceUnavailableError())
+		return
+	}
+	if q := iq.Elements().ChildNamespace("query", mucAdminNamespace); q != nil {
+		x.processAdminIQ(r, iq, q)
+		return
+	}
+	if q := iq.Elements().ChildNamespace("query", mucOwnerNamespace); q != nil {
+		x.processOwnerIQ(r, iq, q)
+		return
+	}
+	_ = x.router.Route(iq.ServiceUnavailableError())
+}
+
+func (x *Muc) loadRooms() {
+	rooms, err := storage.FetchRooms(x.cfg.Host)
+	if err != nil {
+		log.Error(err)
+		return
+	}
+	for i := range rooms {
+		roomJID, err := jid.NewWithString(rooms[i].JID, true)
+		if err != nil {
+			log.Error(err)
+			continue
+		}
+		x.rooms[roomJID.Node()] = newRoom(roomJID, &rooms[i])
+	}
+	log.Infof("muc: loaded %d persistent rooms... (host: %s)", len(rooms), x.cfg.Host)
+}
+
+func (x *Muc) persistRoom(r *room) {
+	if !r.m.Config.Persistent {
+		return
+	}
+	if err := storage.InsertOrUpdateRoom(r.m); err != nil {
+		log.Error(err)
+	}
+}
+
+func (x *Muc) waitForShutdown(shutdownCh <-chan chan bool) {
+	c := <-shutdownCh
+	x.runQueue.Stop(func() {
+		if x.discoInfo != nil {
+			x.discoInfo.UnregisterProvider(x.cfg.Host)
+			x.discoInfo.UnregisterServerItem(xep0030.Item{Jid: x.cfg.Host, Name: x.cfg.Name})
+		}
+		c <- true
+	})
+}
+
+func isModerator(occ *occupant) bool {
+	return occ != nil && occ.role == mucmodel.RoleModerator
+}
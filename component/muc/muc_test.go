@@ -0,0 +1,342 @@
+/*
+ * Copyright (c) 2018 Miguel Ángel Ortuño.
+ * See the LICENSE file for more information.
+ */
+
+package muc
+
+import (
+	"crypto/tls"
+	"testing"
+
+	"github.com/ortuman/jackal/model"
+	"github.com/ortuman/jackal/model/mucmodel"
+	"github.com/ortuman/jackal/module/xep0004"
+	"github.com/ortuman/jackal/router"
+	"github.com/ortuman/jackal/storage"
+	"github.com/ortuman/jackal/storage/memstorage"
+	"github.com/ortuman/jackal/stream"
+	"github.com/ortuman/jackal/xmpp"
+	"github.com/ortuman/jackal/xmpp/jid"
+	"github.com/pborman/uuid"
+	"github.com/stretchr/testify/require"
+	yaml "gopkg.in/yaml.v2"
+)
+
+func TestMuc_Config(t *testing.T) {
+	cfg := Config{}
+	require.NotNil(t, yaml.Unmarshal([]byte(`name: Rooms`), &cfg))
+
+	require.Nil(t, yaml.Unmarshal([]byte(`host: conference.jackal.im`), &cfg))
+	require.Equal(t, "conference.jackal.im", cfg.Host)
+	require.Equal(t, defaultServiceName, cfg.Name)
+	require.Equal(t, defaultMaxHistorySize, cfg.MaxHistorySize)
+
+	cfg = Config{}
+	require.Nil(t, yaml.Unmarshal([]byte("host: conference.jackal.im\nmax_history_size: 0"), &cfg))
+	require.Equal(t, 0, cfg.MaxHistorySize)
+
+	cfg = Config{}
+	require.Nil(t, yaml.Unmarshal([]byte("host: conference.jackal.im\nmax_history_size: 5"), &cfg))
+	require.Equal(t, 5, cfg.MaxHistorySize)
+}
+
+func TestMuc_ServiceIQ(t *testing.T) {
+	r, _, shutdown := setupTest("jackal.im")
+	defer shutdown()
+
+	stm := setupUser(t, r, "ortuman")
+
+	x, shutdownCh := New(&Config{Host: "conference.jackal.im", Name: defaultServiceName}, nil, r)
+	defer shutdownMuc(shutdownCh)
+
+	require.Equal(t, "conference.jackal.im", x.Host())
+
+	serviceJID, _ := jid.NewWithString("conference.jackal.im", true)
+	iq := xmpp.NewIQType(uuid.New(), xmpp.GetType)
+	iq.SetFromJID(stm.JID())
+	iq.SetToJID(serviceJID)
+	x.ProcessStanza(iq, stm)
+
+	elem := stm.ReceiveElement()
+	require.Equal(t, xmpp.ErrorType, elem.Type())
+	require.Equal(t, xmpp.ErrServiceUnavailable.Error(), elem.Error().Elements().All()[0].Name())
+}
+
+func TestMuc_CreateRoom(t *testing.T) {
+	r, _, shutdown := setupTest("jackal.im")
+	defer shutdown()
+
+	stm1 := setupUser(t, r, "ortuman")
+	stm2 := setupUser(t, r, "noelia")
+
+	x, shutdownCh := New(&Config{Host: "conference.jackal.im", MaxHistorySize: 10}, nil, r)
+	defer shutdownMuc(shutdownCh)
+
+	// missing nick
+	roomJID, _ := jid.New("lobby", "conference.jackal.im", "", true)
+	x.ProcessStanza(newPresence(stm1.JID(), roomJID, xmpp.AvailableType), stm1)
+	elem := stm1.ReceiveElement()
+	require.Equal(t, xmpp.ErrJidMalformed.Error(), elem.Error().Elements().All()[0].Name())
+
+	joinRoom(x, stm1, "lobby", "ortuman")
+
+	presence := stm1.ReceiveElement()
+	require.Equal(t, "presence", presence.Name())
+	require.Equal(t, "lobby@conference.jackal.im/ortuman", presence.From())
+	require.True(t, hasStatusCode(presence, statusSelfPresence))
+	require.True(t, hasStatusCode(presence, statusRoomCreated))
+	item := presence.Elements().ChildNamespace("x", mucUserNamespace).Elements().Child("item")
+	require.Equal(t, mucmodel.AffiliationOwner, item.Attributes().Get("affiliation"))
+	require.Equal(t, mucmodel.RoleModerator, item.Attributes().Get("role"))
+
+	subject := stm1.ReceiveElement()
+	require.Equal(t, "message", subject.Name())
+	require.NotNil(t, subject.Elements().Child("subject"))
+
+	// room is locked until configured
+	joinRoom(x, stm2, "lobby", "noelia")
+	elem = stm2.ReceiveElement()
+	require.Equal(t, xmpp.ErrItemNotFound.Error(), elem.Error().Elements().All()[0].Name())
+
+	// accept default configuration (instant room)
+	submitConfig(t, x, stm1, "lobby", nil)
+
+	joinRoom(x, stm2, "lobby", "noelia")
+
+	// new occupant receives existing occupants, its own presence and room subject
+	elem = stm2.ReceiveElement()
+	require.Equal(t, "lobby@conference.jackal.im/ortuman", elem.From())
+	elem = stm2.ReceiveElement()
+	require.Equal(t, "lobby@conference.jackal.im/noelia", elem.From())
+	require.True(t, hasStatusCode(elem, statusSelfPresence))
+	elem = stm2.ReceiveElement()
+	require.Equal(t, "message", elem.Name())
+
+	// owner gets notified, including real JID as a moderator
+	elem = stm1.ReceiveElement()
+	require.Equal(t, "lobby@conference.jackal.im/noelia", elem.From())
+	item = elem.Elements().ChildNamespace("x", mucUserNamespace).Elements().Child("item")
+	require.Equal(t, stm2.JID().String(), item.Attributes().Get("jid"))
+
+	// nick conflict
+	stm3 := setupUser(t, r, "romeo")
+	joinRoom(x, stm3, "lobby", "noelia")
+	elem = stm3.ReceiveElement()
+	require.Equal(t, xmpp.ErrConflict.Error(), elem.Error().Elements().All()[0].Name())
+}
+
+func TestMuc_GroupChatAndHistory(t *testing.T) {
+	r, _, shutdown := setupTest("jackal.im")
+	defer shutdown()
+
+	stm1 := setupUser(t, r, "ortuman")
+	stm2 := setupUser(t, r, "noelia")
+
+	x, shutdownCh := New(&Config{Host: "conference.jackal.im", MaxHistorySize: 1}, nil, r)
+	defer shutdownMuc(shutdownCh)
+
+	createInstantRoom(t, x, stm1, "lobby", "ortuman")
+
+	roomJID, _ := jid.New("lobby", "conference.jackal.im", "", true)
+	for _, body := range []string{"first", "second"} {
+		x.ProcessStanza(newGroupChat(stm1.JID(), roomJID, body), stm1)
+
+		elem := stm1.ReceiveElement()
+		require.Equal(t, "message", elem.Name())
+		require.Equal(t, "lobby@conference.jackal.im/ortuman", elem.From())
+		require.Equal(t, body, elem.Elements().Child("body").Text())
+	}
+	joinRoom(x, stm2, "lobby", "noelia")
+	_ = stm2.ReceiveElement() // ortuman presence
+	_ = stm2.ReceiveElement() // self presence
+
+	// only the latest message is kept
+	elem := stm2.ReceiveElement()
+	require.Equal(t, "message", elem.Name())
+	require.Equal(t, "second", elem.Elements().Child("body").Text())
+	require.NotNil(t, elem.Elements().ChildNamespace("delay", delayNamespace))
+
+	elem = stm2.ReceiveElement()
+	require.NotNil(t, elem.Elements().Child("subject"))
+
+	_ = stm1.ReceiveElement() // noelia presence
+
+	// change subject
+	msg := xmpp.NewMessageType(uuid.New(), xmpp.GroupChatType)
+	msg.SetFromJID(stm1.JID())
+	msg.SetToJID(roomJID)
+	subject := xmpp.NewElementName("subject")
+	subject.SetText("Welcome!")
+	msg.AppendElement(subject)
+	x.ProcessStanza(msg, stm1)
+
+	elem = stm2.ReceiveElement()
+	require.Equal(t, "Welcome!", elem.Elements().Child("subject").Text())
+
+	// non occupants can't send messages
+	stm3 := setupUser(t, r, "romeo")
+	x.ProcessStanza(newGroupChat(stm3.JID(), roomJID, "hi"), stm3)
+	elem = stm3.ReceiveElement()
+	require.Equal(t, xmpp.ErrNotAcceptable.Error(), elem.Error().Elements().All()[0].Name())
+}
+
+func TestMuc_LeaveRoom(t *testing.T) {
+	r, _, shutdown := setupTest("jackal.im")
+	defer shutdown()
+
+	stm1 := setupUser(t, r, "ortuman")
+
+	x, shutdownCh := New(&Config{Host: "conference.jackal.im", MaxHistorySize: 10}, nil, r)
+	defer shutdownMuc(shutdownCh)
+
+	createInstantRoom(t, x, stm1, "lobby", "ortuman")
+
+	occJID, _ := jid.New("lobby", "conference.jackal.im", "ortuman", true)
+	x.ProcessStanza(newPresence(stm1.JID(), occJID, xmpp.UnavailableType), stm1)
+
+	elem := stm1.ReceiveElement()
+	require.Equal(t, xmpp.UnavailableType, elem.Type())
+	require.True(t, hasStatusCode(elem, statusSelfPresence))
+
+	// temporary rooms are destroyed once empty
+	syncMuc(x)
+	x.mu.RLock()
+	require.Nil(t, x.rooms["lobby"])
+	x.mu.RUnlock()
+}
+
+func TestMuc_PersistentRoom(t *testing.T) {
+	r, _, shutdown := setupTest("jackal.im")
+	defer shutdown()
+
+	stm1 := setupUser(t, r, "ortuman")
+
+	x, shutdownCh := New(&Config{Host: "conference.jackal.im", MaxHistorySize: 10}, nil, r)
+
+	createRoom(x, stm1, "lobby", "ortuman")
+	submitConfig(t, x, stm1, "lobby", map[string]string{
+		persistentRoomField: "1",
+		roomNameField:       "The Lobby",
+	})
+	rm, err := storage.FetchRoom("lobby@conference.jackal.im")
+	require.Nil(t, err)
+	require.NotNil(t, rm)
+	require.Equal(t, "The Lobby", rm.Config.Name)
+	require.Equal(t, mucmodel.AffiliationOwner, rm.Affiliation("ortuman@jackal.im"))
+
+	shutdownMuc(shutdownCh)
+
+	// room is restored on start up
+	x, shutdownCh = New(&Config{Host: "conference.jackal.im", MaxHistorySize: 10}, nil, r)
+	defer shutdownMuc(shutdownCh)
+
+	syncMuc(x)
+	require.NotNil(t, x.rooms["lobby"])
+	require.False(t, x.rooms["lobby"].locked)
+}
+
+func setupTest(domain string) (*router.Router, *memstorage.Storage, func()) {
+	r, _ := router.New(&router.Config{
+		Hosts: []router.HostConfig{{Name: domain, Certificate: tls.Certificate{}}},
+	})
+	s := memstorage.New()
+	storage.Set(s)
+	return r, s, func() {
+		storage.Unset()
+	}
+}
+
+func setupUser(t *testing.T, r *router.Router, username string) *stream.MockC2S {
+	require.Nil(t, storage.InsertOrUpdateUser(&model.User{Username: username, Password: "plain"}))
+
+	j, _ := jid.New(username, "jackal.im", "balcony", true)
+	stm := stream.NewMockC2S(uuid.New(), j)
+	stm.SetPresence(xmpp.NewPresence(j, j, xmpp.AvailableType))
+	r.Bind(stm)
+	return stm
+}
+
+func shutdownMuc(shutdownCh chan<- chan bool) {
+	c := make(chan bool, 1)
+	shutdownCh <- c
+	<-c
+}
+
+// syncMuc waits until every previously enqueued stanza has been processed.
+func syncMuc(x *Muc) {
+	c := make(chan struct{})
+	x.runQueue.Run(func() { close(c) })
+	<-c
+}
+
+func createRoom(x *Muc, stm *stream.MockC2S, room, nick string) {
+	joinRoom(x, stm, room, nick)
+	_ = stm.ReceiveElement() // self presence
+	_ = stm.ReceiveElement() // subject
+}
+
+func createInstantRoom(t *testing.T, x *Muc, stm *stream.MockC2S, room, nick string) {
+	createRoom(x, stm, room, nick)
+	submitConfig(t, x, stm, room, nil)
+}
+
+func joinRoom(x *Muc, stm *stream.MockC2S, room, nick string) {
+	occJID, _ := jid.New(room, "conference.jackal.im", nick, true)
+	p := newPresence(stm.JID(), occJID, xmpp.AvailableType)
+	p.AppendElement(xmpp.NewElementNamespace("x", mucNamespace))
+	x.ProcessStanza(p, stm)
+}
+
+func submitConfig(t *testing.T, x *Muc, stm *stream.MockC2S, room string, values map[string]string) {
+	roomJID, _ := jid.New(room, "conference.jackal.im", "", true)
+
+	form := configForm(&mucmodel.RoomConfig{Whois: mucmodel.WhoisModerators})
+	form.Type = xep0004.Submit
+	for i := range form.Fields {
+		if v, ok := values[form.Fields[i].Var]; ok {
+			form.Fields[i].Values = []string{v}
+		}
+	}
+	q := xmpp.NewElementNamespace("query", mucOwnerNamespace)
+	q.AppendElement(form.Element())
+
+	iq := xmpp.NewIQType(uuid.New(), xmpp.SetType)
+	iq.SetFromJID(stm.JID())
+	iq.SetToJID(roomJID)
+	iq.AppendElement(q)
+	x.ProcessStanza(iq, stm)
+
+	elem := stm.ReceiveElement()
+	require.Equal(t, "iq", elem.Name())
+	require.Equal(t, xmpp.ResultType, elem.Type())
+}
+
+func newPresence(from, to *jid.JID, presenceType string) *xmpp.Presence {
+	p := xmpp.NewPresence(from, to, presenceType)
+	p.SetID(uuid.New())
+	return p
+}
+
+func newGroupChat(from, to *jid.JID, body string) *xmpp.Message {
+	msg := xmpp.NewMessageType(uuid.New(), xmpp.GroupChatType)
+	msg.SetFromJID(from)
+	msg.SetToJID(to)
+	b := xmpp.NewElementName("body")
+	b.SetText(body)
+	msg.AppendElement(b)
+	return msg
+}
+
+func hasStatusCode(elem xmpp.XElement, code string) bool {
+	xu := elem.Elements().ChildNamespace("x", mucUserNamespace)
+	if xu == nil {
+		return false
+	}
+	for _, status := range xu.Elements().Children("status") {
+		if status.Attributes().Get("code") == code {
+			return true
+		}
+	}
+	return false
+}
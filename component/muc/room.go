@@ -0,0 +1,430 @@
+/*
+ * Copyright (c) 2018 Miguel Ángel Ortuño.
+ * See the LICENSE file for more information.
+ */
+
+package muc
+
+import (
+	"strconv"
+	"time"
+
+	"github.com/ortuman/jackal/log"
+	"github.com/ortuman/jackal/model/mucmodel"
+	"github.com/ortuman/jackal/router"
+	"github.com/ortuman/jackal/storage"
+	"github.com/ortuman/jackal/xmpp"
+	"github.com/ortuman/jackal/xmpp/jid"
+	"github.com/pborman/uuid"
+)
+
+// room presence status codes
+const (
+	statusNonAnonymous = "100"
+	statusSelfPresence = "110"
+	statusRoomCreated  = "201"
+	statusBanned       = "301"
+	statusNickChanged  = "303"
+	statusKicked       = "307"
+	statusMemberRemove = "321"
+)
+
+const stampLayout = "2006-01-02T15:04:05Z"
+
+type occupant struct {
+	nick     string
+	jid      *jid.JID
+	role     string
+	presence *xmpp.Presence
+}
+
+type historyItem struct {
+	message *xmpp.Message
+	at      time.Time
+}
+
+type room struct {
+	m         *mucmodel.Room
+	jid       *jid.JID
+	locked    bool
+	occupants map[string]*occupant
+	history   []historyItem
+}
+
+func newRoom(roomJID *jid.JID, m *mucmodel.Room) *room {
+	return &room{
+		m:         m,
+		jid:       roomJID,
+		occupants: make(map[string]*occupant),
+	}
+}
+
+func (r *room) occupantByJID(j *jid.JID) *occupant {
+	for _, occ := range r.occupants {
+		if occ.jid.Matches(j, jid.MatchesFull) {
+			return occ
+		}
+	}
+	return nil
+}
+
+func (r *room) occupantJID(nick string) *jid.JID {
+	j, _ := jid.New(r.jid.Node(), r.jid.Domain(), nick, true)
+	return j
+}
+
+func (r *room) affiliation(occ *occupant) string {
+	return r.m.Affiliation(occ.jid.ToBareJID().String())
+}
+
+func (r *room) defaultRole(affiliation string) string {
+	switch affiliation {
+	case mucmodel.AffiliationOwner, mucmodel.AffiliationAdmin:
+		return mucmodel.RoleModerator
+	case mucmodel.AffiliationMember:
+		return mucmodel.RoleParticipant
+	}
+	if r.m.Config.Moderated {
+		return mucmodel.RoleVisitor
+	}
+	return mucmodel.RoleParticipant
+}
+
+func (x *Muc) createRoom(roomJID *jid.JID, owner *jid.JID) *room {
+	m := &mucmodel.Room{
+		JID: roomJID.String(),
+		Config: mucmodel.RoomConfig{
+			Name:   roomJID.Node(),
+			Public: true,
+			Whois:  mucmodel.WhoisModerators,
+		},
+	}
+	m.SetAffiliation(owner.ToBareJID().String(), mucmodel.AffiliationOwner)
+
+	// new rooms remain locked until owner confirms its configuration
+	r := newRoom(roomJID, m)
+	r.locked = true
+	x.rooms[roomJID.Node()] = r
+
+	log.Infof("muc: created room... (room: %s, owner: %s)", roomJID.String(), owner.String())
+	return r
+}
+
+func (x *Muc) destroyRoom(r *room) {
+	delete(x.rooms, r.jid.Node())
+	if r.m.Config.Persistent {
+		if err := storage.DeleteRoom(r.m.JID); err != nil {
+			log.Error(err)
+		}
+	}
+	log.Infof("muc: destroyed room... (room: %s)", r.jid.String())
+}
+
+func (x *Muc) joinRoom(r *room, presence *xmpp.Presence) {
+	fromJID := presence.FromJID()
+	nick := presence.ToJID().Resource()
+	affiliation := r.m.Affiliation(fromJID.ToBareJID().String())
+
+	var password string
+	if xm := presence.Elements().ChildNamespace("x", mucNamespace); xm != nil {
+		if pwd := xm.Elements().Child("password"); pwd != nil {
+			password = pwd.Text()
+		}
+	}
+	switch {
+	case r.locked && affiliation != mucmodel.AffiliationOwner:
+		_ = x.router.Route(presence.ItemNotFoundError())
+		return
+	case affiliation == mucmodel.AffiliationOutcast:
+		_ = x.router.Route(presence.ForbiddenError())
+		return
+	case r.m.Config.MembersOnly && affiliation == mucmodel.AffiliationNone:
+		_ = x.router.Route(presence.RegistrationRequiredError())
+		return
+	case r.m.Config.PasswordProtected && password != r.m.Config.Password:
+		_ = x.router.Route(presence.NotAuthorizedError())
+		return
+	case r.occupants[nick] != nil:
+		_ = x.router.Route(presence.ConflictError())
+		return
+	case r.m.Config.MaxUsers > 0 && len(r.occupants) >= r.m.Config.MaxUsers &&
+		affiliation != mucmodel.AffiliationOwner && affiliation != mucmodel.AffiliationAdmin:
+		_ = x.router.Route(presence.ServiceUnavailableError())
+		return
+	}
+	occ := &occupant{
+		nick:     nick,
+		jid:      fromJID,
+		role:     r.defaultRole(affiliation),
+		presence: presence,
+	}
+	// send current occupants presences to the new one
+	for _, o := range r.occupants {
+		_ = x.router.Route(x.occupantPresence(r, o, occ, xmpp.AvailableType))
+	}
+	r.occupants[nick] = occ
+
+	var codes []string
+	if r.m.Config.Whois == mucmodel.WhoisAnyone {
+		codes = append(codes, statusNonAnonymous)
+	}
+	if r.locked && len(r.occupants) == 1 {
+		codes = append(codes, statusRoomCreated)
+	}
+	x.broadcastPresence(r, occ, xmpp.AvailableType, codes...)
+
+	x.sendHistory(r, occ, presence)
+	x.sendSubject(r, occ)
+
+	log.Infof("muc: occupant joined... (room: %s, nick: %s)", r.jid.String(), nick)
+}
+
+func (x *Muc) leaveRoom(r *room, occ *occupant, codes ...string) {
+	if r.occupants[occ.nick] != occ {
+		return
+	}
+	occ.role = mucmodel.RoleNone
+	delete(r.occupants, occ.nick)
+
+	// notify leaving occupant and remaining ones
+	_ = x.router.Route(x.occupantPresence(r, occ, occ, xmpp.UnavailableType, codes...))
+	x.broadcastPresence(r, occ, xmpp.UnavailableType, codes...)
+
+	log.Infof("muc: occupant left... (room: %s, nick: %s)", r.jid.String(), occ.nick)
+
+	if len(r.occupants) == 0 && !r.m.Config.Persistent {
+		x.destroyRoom(r)
+	}
+}
+
+func (x *Muc) changeNick(r *room, occ *occupant, presence *xmpp.Presence) {
+	newNick := presence.ToJID().Resource()
+	if r.occupants[newNick] != nil {
+		_ = x.router.Route(presence.ConflictError())
+		return
+	}
+	var gone []*occupant
+	for _, to := range r.occupants {
+		item := x.occupantItem(r, occ, to)
+		item.SetAttribute("nick", newNick)
+		p := x.mucUserPresence(r, occ, to, xmpp.UnavailableType, item, statusNickChanged)
+		if !x.sendToOccupant(p) && to != occ {
+			gone = append(gone, to)
+		}
+	}
+	delete(r.occupants, occ.nick)
+	occ.nick = newNick
+	occ.presence = presence
+	r.occupants[newNick] = occ
+
+	x.broadcastPresence(r, occ, xmpp.AvailableType)
+	x.removeOccupants(r, gone)
+}
+
+func (x *Muc) sendGroupChatMessage(r *room, occ *occupant, message *xmpp.Message) {
+	switch {
+	case occ == nil:
+		_ = x.router.Route(message.NotAcceptableError())
+		return
+	case message.ToJID().IsFullWithUser():
+		_ = x.router.Route(message.BadRequestError())
+		return
+	case occ.role == mucmodel.RoleVisitor:
+		_ = x.router.Route(message.ForbiddenError())
+		return
+	}
+	if subject := message.Elements().Child("subject"); subject != nil {
+		if !r.m.Config.ChangeSubject && !isModerator(occ) {
+			_ = x.router.Route(message.ForbiddenError())
+			return
+		}
+		r.m.Subject = subject.Text()
+		x.persistRoom(r)
+	}
+	fromJID := r.occupantJID(occ.nick)
+
+	var gone []*occupant
+	for _, to := range r.occupants {
+		msg, _ := xmpp.NewMessageFromElement(message, fromJID, to.jid)
+		if !x.sendToOccupant(msg) {
+			gone = append(gone, to)
+		}
+	}
+	if message.IsMessageWithBody() && x.cfg.MaxHistorySize > 0 {
+		msg, _ := xmpp.NewMessageFromElement(message, fromJID, r.jid)
+		r.history = append(r.history, historyItem{message: msg, at: time.Now().UTC()})
+		if len(r.history) > x.cfg.MaxHistorySize {
+			r.history = r.history[len(r.history)-x.cfg.MaxHistorySize:]
+		}
+	}
+	x.removeOccupants(r, gone)
+}
+
+func (x *Muc) sendPrivateMessage(r *room, occ *occupant, message *xmpp.Message) {
+	if occ == nil {
+		_ = x.router.Route(message.NotAcceptableError())
+		return
+	}
+	to := r.occupants[message.ToJID().Resource()]
+	if to == nil {
+		_ = x.router.Route(message.ItemNotFoundError())
+		return
+	}
+	msg, _ := xmpp.NewMessageFromElement(message, r.occupantJID(occ.nick), to.jid)
+	msg.AppendElement(xmpp.NewElementNamespace("x", mucUserNamespace))
+	if !x.sendToOccupant(msg) {
+		x.removeOccupants(r, []*occupant{to})
+	}
+}
+
+func (x *Muc) sendInvitation(r *room, occ *occupant, message *xmpp.Message, invite xmpp.XElement) {
+	if occ == nil {
+		_ = x.router.Route(message.NotAcceptableError())
+		return
+	}
+	inviteeJID, err := jid.NewWithString(invite.Attributes().Get("to"), false)
+	if err != nil {
+		_ = x.router.Route(message.JidMalformedError())
+		return
+	}
+	affiliation := r.affiliation(occ)
+	if r.m.Config.MembersOnly {
+		switch affiliation {
+		case mucmodel.AffiliationOwner, mucmodel.AffiliationAdmin:
+			// invited users become room members
+			if r.m.Affiliation(inviteeJID.ToBareJID().String()) == mucmodel.AffiliationNone {
+				r.m.SetAffiliation(inviteeJID.ToBareJID().String(), mucmodel.AffiliationMember)
+				x.persistRoom(r)
+			}
+		default:
+			_ = x.router.Route(message.ForbiddenError())
+			return
+		}
+	}
+	inv := xmpp.NewElementName("invite")
+	inv.SetAttribute("from", occ.jid.ToBareJID().String())
+	if reason := invite.Elements().Child("reason"); reason != nil {
+		inv.AppendElement(reason)
+	}
+	xu := xmpp.NewElementNamespace("x", mucUserNamespace)
+	xu.AppendElement(inv)
+	if r.m.Config.PasswordProtected {
+		pwd := xmpp.NewElementName("password")
+		pwd.SetText(r.m.Config.Password)
+		xu.AppendElement(pwd)
+	}
+	msg := xmpp.NewMessageType(uuid.New(), xmpp.NormalType)
+	msg.SetFromJID(r.jid)
+	msg.SetToJID(inviteeJID)
+	msg.AppendElement(xu)
+	_ = x.router.Route(msg)
+}
+
+func (x *Muc) sendHistory(r *room, occ *occupant, presence *xmpp.Presence) {
+	maxStanzas := len(r.history)
+	if xm := presence.Elements().ChildNamespace("x", mucNamespace); xm != nil {
+		if h := xm.Elements().Child("history"); h != nil {
+			if h.Attributes().Get("maxchars") == "0" {
+				return
+			}
+			if v, err := strconv.Atoi(h.Attributes().Get("maxstanzas")); err == nil && v < maxStanzas {
+				maxStanzas = v
+			}
+		}
+	}
+	if maxStanzas <= 0 {
+		return
+	}
+	for _, itm := range r.history[len(r.history)-maxStanzas:] {
+		msg, _ := xmpp.NewMessageFromElement(itm.message, itm.message.FromJID(), occ.jid)
+		delay := xmpp.NewElementNamespace("delay", delayNamespace)
+		delay.SetAttribute("from", r.jid.String())
+		delay.SetAttribute("stamp", itm.at.Format(stampLayout))
+		msg.AppendElement(delay)
+		_ = x.router.Route(msg)
+	}
+}
+
+func (x *Muc) sendSubject(r *room, occ *occupant) {
+	msg := xmpp.NewMessageType(uuid.New(), xmpp.GroupChatType)
+	msg.SetFromJID(r.jid)
+	msg.SetToJID(occ.jid)
+	subject := xmpp.NewElementName("subject")
+	subject.SetText(r.m.Subject)
+	msg.AppendElement(subject)
+	_ = x.router.Route(msg)
+}
+
+// broadcastPresence sends occupant's presence to every room occupant.
+func (x *Muc) broadcastPresence(r *room, occ *occupant, presenceType string, codes ...string) {
+	var gone []*occupant
+	for _, to := range r.occupants {
+		if !x.sendToOccupant(x.occupantPresence(r, occ, to, presenceType, codes...)) && to != occ {
+			gone = append(gone, to)
+		}
+	}
+	x.removeOccupants(r, gone)
+}
+
+func (x *Muc) occupantPresence(r *room, occ *occupant, to *occupant, presenceType string, codes ...string) *xmpp.Presence {
+	return x.mucUserPresence(r, occ, to, presenceType, x.occupantItem(r, occ, to), codes...)
+}
+
+func (x *Muc) mucUserPresence(r *room, occ *occupant, to *occupant, presenceType string, item xmpp.XElement, codes ...string) *xmpp.Presence {
+	p := xmpp.NewPresence(r.occupantJID(occ.nick), to.jid, presenceType)
+	if occ.presence != nil {
+		for _, elem := range occ.presence.Elements().All() {
+			switch elem.Namespace() {
+			case mucNamespace, mucUserNamespace:
+				continue
+			}
+			p.AppendElement(elem)
+		}
+	}
+	xu := xmpp.NewElementNamespace("x", mucUserNamespace)
+	xu.AppendElement(item)
+	for _, code := range codes {
+		if code == statusNonAnonymous && occ != to {
+			continue
+		}
+		xu.AppendElement(statusElement(code))
+	}
+	if occ == to {
+		xu.AppendElement(statusElement(statusSelfPresence))
+	}
+	p.AppendElement(xu)
+	return p
+}
+
+func (x *Muc) occupantItem(r *room, occ *occupant, to *occupant) *xmpp.Element {
+	item := xmpp.NewElementName("item")
+	item.SetAttribute("affiliation", r.affiliation(occ))
+	item.SetAttribute("role", occ.role)
+	if r.m.Config.Whois == mucmodel.WhoisAnyone || isModerator(to) {
+		item.SetAttribute("jid", occ.jid.String())
+	}
+	return item
+}
+
+// sendToOccupant routes a stanza to an occupant returning false
+// in case its stream is no longer available.
+func (x *Muc) sendToOccupant(stanza xmpp.Stanza) bool {
+	switch x.router.Route(stanza) {
+	case router.ErrResourceNotFound, router.ErrNotAuthenticated, router.ErrNotExistingAccount:
+		return false
+	}
+	return true
+}
+
+// removeOccupants removes from room every occupant whose stream is gone.
+func (x *Muc) removeOccupants(r *room, occupants []*occupant) {
+	for _, occ := range occupants {
+		x.leaveRoom(r, occ)
+	}
+}
+
+func statusElement(code string) xmpp.XElement {
+	status := xmpp.NewElementName("status")
+	status.SetAttribute("code", code)
+	return status
+}
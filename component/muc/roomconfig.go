@@ -0,0 +1,139 @@
+/*
+ * Copyright (c) 2018 Miguel Ángel Ortuño.
+ * See the LICENSE file for more information.
+ */
+
+package muc
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+
+	"github.com/ortuman/jackal/model/mucmodel"
+	"github.com/ortuman/jackal/module/xep0004"
+)
+
+// room configuration form fields
+const (
+	formTypeField          = "FORM_TYPE"
+	roomNameField          = "muc#roomconfig_roomname"
+	roomDescField          = "muc#roomconfig_roomdesc"
+	persistentRoomField    = "muc#roomconfig_persistentroom"
+	publicRoomField        = "muc#roomconfig_publicroom"
+	membersOnlyField       = "muc#roomconfig_membersonly"
+	moderatedRoomField     = "muc#roomconfig_moderatedroom"
+	passwordProtectedField = "muc#roomconfig_passwordprotectedroom"
+	roomSecretField        = "muc#roomconfig_roomsecret"
+	whoisField             = "muc#roomconfig_whois"
+	changeSubjectField     = "muc#roomconfig_changesubject"
+	maxUsersField          = "muc#roomconfig_maxusers"
+)
+
+const unlimitedUsers = "none"
+
+var maxUsersOptions = []string{"10", "20", "30", "50", "100", unlimitedUsers}
+
+func configForm(cfg *mucmodel.RoomConfig) *xep0004.DataForm {
+	maxUsers := unlimitedUsers
+	if cfg.MaxUsers > 0 {
+		maxUsers = strconv.Itoa(cfg.MaxUsers)
+	}
+	var maxUsersOpts []xep0004.Option
+	for _, opt := range maxUsersOptions {
+		maxUsersOpts = append(maxUsersOpts, xep0004.Option{Value: opt})
+	}
+	return &xep0004.DataForm{
+		Type:         xep0004.Form,
+		Title:        "Room configuration",
+		Instructions: "Complete this form to modify the configuration of your room.",
+		Fields: []xep0004.Field{
+			{Var: formTypeField, Type: xep0004.Hidden, Values: []string{mucRoomConfigNamespace}},
+			{Var: roomNameField, Type: xep0004.TextSingle, Label: "Natural-Language Room Name", Values: []string{cfg.Name}},
+			{Var: roomDescField, Type: xep0004.TextSingle, Label: "Short Description of Room", Values: []string{cfg.Description}},
+			{Var: persistentRoomField, Type: xep0004.Boolean, Label: "Make Room Persistent?", Values: []string{boolValue(cfg.Persistent)}},
+			{Var: publicRoomField, Type: xep0004.Boolean, Label: "Make Room Publicly Searchable?", Values: []string{boolValue(cfg.Public)}},
+			{Var: membersOnlyField, Type: xep0004.Boolean, Label: "Make Room Members-Only?", Values: []string{boolValue(cfg.MembersOnly)}},
+			{Var: moderatedRoomField, Type: xep0004.Boolean, Label: "Make Room Moderated?", Values: []string{boolValue(cfg.Moderated)}},
+			{Var: passwordProtectedField, Type: xep0004.Boolean, Label: "Password Required to Enter?", Values: []string{boolValue(cfg.PasswordProtected)}},
+			{Var: roomSecretField, Type: xep0004.TextPrivate, Label: "Password", Values: []string{cfg.Password}},
+			{
+				Var:    whoisField,
+				Type:   xep0004.ListSingle,
+				Label:  "Who May Discover Real JIDs?",
+				Values: []string{cfg.Whois},
+				Options: []xep0004.Option{
+					{Label: "Moderators Only", Value: mucmodel.WhoisModerators},
+					{Label: "Anyone", Value: mucmodel.WhoisAnyone},
+				},
+			},
+			{Var: changeSubjectField, Type: xep0004.Boolean, Label: "Allow Occupants to Change Subject?", Values: []string{boolValue(cfg.ChangeSubject)}},
+			{Var: maxUsersField, Type: xep0004.ListSingle, Label: "Maximum Number of Occupants", Values: []string{maxUsers}, Options: maxUsersOpts},
+		},
+	}
+}
+
+func applyConfigForm(cfg *mucmodel.RoomConfig, form *xep0004.DataForm) error {
+	for _, field := range form.Fields {
+		var value string
+		if len(field.Values) > 0 {
+			value = field.Values[0]
+		}
+		switch field.Var {
+		case formTypeField:
+			if value != mucRoomConfigNamespace {
+				return fmt.Errorf("muc: unexpected form type: %s", value)
+			}
+		case roomNameField:
+			cfg.Name = value
+		case roomDescField:
+			cfg.Description = value
+		case persistentRoomField:
+			cfg.Persistent = isTrue(value)
+		case publicRoomField:
+			cfg.Public = isTrue(value)
+		case membersOnlyField:
+			cfg.MembersOnly = isTrue(value)
+		case moderatedRoomField:
+			cfg.Moderated = isTrue(value)
+		case passwordProtectedField:
+			cfg.PasswordProtected = isTrue(value)
+		case roomSecretField:
+			cfg.Password = value
+		case whoisField:
+			switch value {
+			case mucmodel.WhoisModerators, mucmodel.WhoisAnyone:
+				cfg.Whois = value
+			default:
+				return fmt.Errorf("muc: unrecognized whois value: %s", value)
+			}
+		case changeSubjectField:
+			cfg.ChangeSubject = isTrue(value)
+		case maxUsersField:
+			if value == unlimitedUsers || len(value) == 0 {
+				cfg.MaxUsers = 0
+				break
+			}
+			maxUsers, err := strconv.Atoi(value)
+			if err != nil || maxUsers < 0 {
+				return fmt.Errorf("muc: invalid max users value: %s", value)
+			}
+			cfg.MaxUsers = maxUsers
+		}
+	}
+	if cfg.PasswordProtected && len(cfg.Password) == 0 {
+		return errors.New("muc: password protected room requires a password")
+	}
+	return nil
+}
+
+func boolValue(b bool) string {
+	if b {
+		return "1"
+	}
+	return "0"
+}
+
+func isTrue(value string) bool {
+	return value == "1" || value == "true"
+}
@@ -0,0 +1,62 @@
+/*
+ * Copyright (c) 2018 Miguel Ángel Ortuño.
+ * See the LICENSE file for more information.
+ */
+
+package muc
+
+import (
+	"testing"
+
+	"github.com/ortuman/jackal/model/mucmodel"
+	"github.com/ortuman/jackal/module/xep0004"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRoomConfig_Form(t *testing.T) {
+	cfg := mucmodel.RoomConfig{Name: "lobby", Whois: mucmodel.WhoisModerators, MaxUsers: 20}
+
+	form := configForm(&cfg)
+	require.Equal(t, xep0004.Form, form.Type)
+
+	form.Type = xep0004.Submit
+	setFormValue(form, roomDescField, "A place to chat")
+	setFormValue(form, membersOnlyField, "true")
+	setFormValue(form, whoisField, mucmodel.WhoisAnyone)
+	setFormValue(form, maxUsersField, unlimitedUsers)
+
+	var newCfg mucmodel.RoomConfig
+	require.Nil(t, applyConfigForm(&newCfg, form))
+	require.Equal(t, "lobby", newCfg.Name)
+	require.Equal(t, "A place to chat", newCfg.Description)
+	require.True(t, newCfg.MembersOnly)
+	require.Equal(t, mucmodel.WhoisAnyone, newCfg.Whois)
+	require.Equal(t, 0, newCfg.MaxUsers)
+
+	setFormValue(form, whoisField, "nobody")
+	require.NotNil(t, applyConfigForm(&newCfg, form))
+
+	setFormValue(form, whoisField, mucmodel.WhoisAnyone)
+	setFormValue(form, maxUsersField, "many")
+	require.NotNil(t, applyConfigForm(&newCfg, form))
+
+	setFormValue(form, maxUsersField, "10")
+	setFormValue(form, passwordProtectedField, "1")
+	require.NotNil(t, applyConfigForm(&newCfg, form))
+
+	setFormValue(form, roomSecretField, "secret")
+	require.Nil(t, applyConfigForm(&newCfg, form))
+	require.Equal(t, 10, newCfg.MaxUsers)
+	require.Equal(t, "secret", newCfg.Password)
+
+	setFormValue(form, formTypeField, "urn:xmpp:foo")
+	require.NotNil(t, applyConfigForm(&newCfg, form))
+}
+
+func setFormValue(form *xep0004.DataForm, fieldVar, value string) {
+	for i := range form.Fields {
+		if form.Fields[i].Var == fieldVar {
+			form.Fields[i].Values = []string{value}
+		}
+	}
+}
@@ -0,0 +1,101 @@
+/*
+ * Copyright (c) 2018 Miguel Ángel Ortuño.
+ * See the LICENSE file for more information.
+ */
+
+package pubsub
+
+import (
+	"github.com/ortuman/jackal/log"
+	"github.com/ortuman/jackal/model/pubsubmodel"
+	"github.com/ortuman/jackal/model/rostermodel"
+	"github.com/ortuman/jackal/storage"
+	"github.com/ortuman/jackal/xmpp"
+	"github.com/ortuman/jackal/xmpp/jid"
+)
+
+// AccessError represents a node access denial reason.
+type AccessError struct {
+	StanzaErr *xmpp.StanzaError
+	Condition string
+}
+
+var (
+	errAccessForbidden                    = &AccessError{StanzaErr: xmpp.ErrForbidden}
+	errAccessClosedNode                   = &AccessError{StanzaErr: xmpp.ErrNotAllowed, Condition: "closed-node"}
+	errAccessPresenceSubscriptionRequired = &AccessError{StanzaErr: xmpp.ErrNotAuthorized, Condition: "presence-subscription-required"}
+	errAccessNotInRosterGroup             = &AccessError{StanzaErr: xmpp.ErrNotAuthorized, Condition: "not-in-roster-group"}
+)
+
+// CheckAccess verifies whether or not an entity is allowed to subscribe to and
+// retrieve items from a node, according to its access model.
+// Rosters are only looked up for node owners whose domain is served by isLocalHost.
+func CheckAccess(n *pubsubmodel.Node, j *jid.JID, isLocalHost func(domain string) bool) *AccessError {
+	switch n.Affiliation(j.ToBareJID().String()) {
+	case pubsubmodel.AffiliationOwner, pubsubmodel.AffiliationPublisher:
+		return nil
+	case pubsubmodel.AffiliationOutcast:
+		return errAccessForbidden
+	}
+	switch n.Options.AccessModel {
+	case pubsubmodel.AccessModelPresence:
+		if !isInOwnerRoster(n, j, nil, isLocalHost) {
+			return errAccessPresenceSubscriptionRequired
+		}
+	case pubsubmodel.AccessModelRoster:
+		groups := n.Options.RosterGroupsAllowed
+		if len(groups) == 0 || !isInOwnerRoster(n, j, groups, isLocalHost) {
+			return errAccessNotInRosterGroup
+		}
+	case pubsubmodel.AccessModelWhitelist:
+		if n.Affiliation(j.ToBareJID().String()) != pubsubmodel.AffiliationMember {
+			return errAccessClosedNode
+		}
+	}
+	return nil
+}
+
+func (x *PubSub) checkAccess(n *pubsubmodel.Node, j *jid.JID) *AccessError {
+	return CheckAccess(n, j, x.router.IsLocalHost)
+}
+
+// isInOwnerRoster returns whether or not any of the node local owners is sharing
+// its presence with an entity, optionally restricted to a set of roster groups.
+func isInOwnerRoster(n *pubsubmodel.Node, j *jid.JID, groups []string, isLocalHost func(domain string) bool) bool {
+	for ownerJIDStr, aff := range n.Affiliations {
+		if aff != pubsubmodel.AffiliationOwner {
+			continue
+		}
+		ownerJID, err := jid.NewWithString(ownerJIDStr, true)
+		if err != nil || !isLocalHost(ownerJID.Domain()) {
+			continue
+		}
+		ri, err := storage.FetchRosterItem(ownerJID.Node(), j.ToBareJID().String())
+		if err != nil {
+			log.Error(err)
+			continue
+		}
+		if ri == nil || (ri.Subscription != rostermodel.SubscriptionFrom && ri.Subscription != rostermodel.SubscriptionBoth) {
+			continue
+		}
+		if len(groups) == 0 || hasAnyGroup(ri.Groups, groups) {
+			return true
+		}
+	}
+	return false
+}
+
+func hasAnyGroup(itemGroups, groups []string) bool {
+	for _, ig := range itemGroups {
+		for _, g := range groups {
+			if ig == g {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func (x *PubSub) accessDenied(iq *xmpp.IQ, aErr *AccessError) {
+	_ = x.router.Route(ErrorStanza(iq, aErr.StanzaErr, aErr.Condition))
+}
@@ -0,0 +1,141 @@
+/*
+ * Copyright (c) 2018 Miguel Ángel Ortuño.
+ * See the LICENSE file for more information.
+ */
+
+package pubsub
+
+import (
+	"sort"
+
+	"github.com/ortuman/jackal/log"
+	"github.com/ortuman/jackal/model/pubsubmodel"
+	"github.com/ortuman/jackal/module/xep0004"
+	"github.com/ortuman/jackal/module/xep0030"
+	"github.com/ortuman/jackal/storage"
+	"github.com/ortuman/jackal/xmpp"
+	"github.com/ortuman/jackal/xmpp/jid"
+)
+
+const (
+	discoInfoNamespace  = "http://jabber.org/protocol/disco#info"
+	discoItemsNamespace = "http://jabber.org/protocol/disco#items"
+)
+
+const metaDataNamespace = "http://jabber.org/protocol/pubsub#meta-data"
+
+var pubSubFeatures = []xep0030.Feature{
+	pubSubNamespace,
+	pubSubNamespace + "#access-open",
+	pubSubNamespace + "#access-presence",
+	pubSubNamespace + "#access-roster",
+	pubSubNamespace + "#access-whitelist",
+	pubSubNamespace + "#config-node",
+	pubSubNamespace + "#create-and-configure",
+	pubSubNamespace + "#create-nodes",
+	pubSubNamespace + "#delete-items",
+	pubSubNamespace + "#delete-nodes",
+	pubSubNamespace + "#instant-nodes",
+	pubSubNamespace + "#item-ids",
+	pubSubNamespace + "#manage-subscriptions",
+	pubSubNamespace + "#modify-affiliations",
+	pubSubNamespace + "#persistent-items",
+	pubSubNamespace + "#publish",
+	pubSubNamespace + "#purge-nodes",
+	pubSubNamespace + "#retract-items",
+	pubSubNamespace + "#retrieve-affiliations",
+	pubSubNamespace + "#retrieve-default",
+	pubSubNamespace + "#retrieve-items",
+	pubSubNamespace + "#retrieve-subscriptions",
+	pubSubNamespace + "#subscribe",
+}
+
+type discoInfoProvider struct {
+	pubSub *PubSub
+}
+
+func (dp *discoInfoProvider) Identities(toJID, fromJID *jid.JID, node string) []xep0030.Identity {
+	if !toJID.IsServer() {
+		return nil
+	}
+	if node != "" {
+		if n := dp.fetchNode(node); n != nil {
+			return []xep0030.Identity{{Category: "pubsub", Type: "leaf", Name: n.Options.Title}}
+		}
+		return nil
+	}
+	return []xep0030.Identity{{Category: "pubsub", Type: "service", Name: dp.pubSub.cfg.Name}}
+}
+
+func (dp *discoInfoProvider) Items(toJID, fromJID *jid.JID, node string) ([]xep0030.Item, *xmpp.StanzaError) {
+	if !toJID.IsServer() {
+		return nil, xmpp.ErrItemNotFound
+	}
+	if node != "" {
+		// published item identifiers are not disclosed
+		if dp.fetchNode(node) == nil {
+			return nil, xmpp.ErrItemNotFound
+		}
+		return nil, nil
+	}
+	nodes, err := storage.FetchPubSubNodes(dp.pubSub.cfg.Host)
+	if err != nil {
+		log.Error(err)
+		return nil, xmpp.ErrInternalServerError
+	}
+	var items []xep0030.Item
+	for _, n := range nodes {
+		items = append(items, xep0030.Item{Jid: dp.pubSub.cfg.Host, Node: n.Name, Name: n.Options.Title})
+	}
+	sort.Slice(items, func(i, j int) bool { return items[i].Node < items[j].Node })
+	return items, nil
+}
+
+func (dp *discoInfoProvider) Features(toJID, fromJID *jid.JID, node string) ([]xep0030.Feature, *xmpp.StanzaError) {
+	if !toJID.IsServer() {
+		return nil, xmpp.ErrItemNotFound
+	}
+	if node != "" {
+		if dp.fetchNode(node) == nil {
+			return nil, xmpp.ErrItemNotFound
+		}
+		return []xep0030.Feature{pubSubNamespace}, nil
+	}
+	return append([]xep0030.Feature{discoInfoNamespace, discoItemsNamespace}, pubSubFeatures...), nil
+}
+
+func (dp *discoInfoProvider) Form(toJID, fromJID *jid.JID, node string) (*xep0004.DataForm, *xmpp.StanzaError) {
+	if node == "" || !toJID.IsServer() {
+		return nil, nil
+	}
+	n := dp.fetchNode(node)
+	if n == nil {
+		return nil, xmpp.ErrItemNotFound
+	}
+	var owners []string
+	for j, aff := range n.Affiliations {
+		if aff == pubsubmodel.AffiliationOwner {
+			owners = append(owners, j)
+		}
+	}
+	sort.Strings(owners)
+	return &xep0004.DataForm{
+		Type: xep0004.Result,
+		Fields: []xep0004.Field{
+			{Var: formTypeField, Type: xep0004.Hidden, Values: []string{metaDataNamespace}},
+			{Var: titleField, Label: "A short name for the node", Values: []string{n.Options.Title}},
+			{Var: accessModelField, Label: "Access model", Values: []string{n.Options.AccessModel}},
+			{Var: publishModelField, Label: "Publisher model", Values: []string{n.Options.PublishModel}},
+			{Var: "pubsub#owner", Type: xep0004.JidMulti, Label: "Node owners", Values: owners},
+		},
+	}, nil
+}
+
+func (dp *discoInfoProvider) fetchNode(name string) *pubsubmodel.Node {
+	n, err := storage.FetchPubSubNode(dp.pubSub.cfg.Host, name)
+	if err != nil {
+		log.Error(err)
+		return nil
+	}
+	return n
+}
@@ -0,0 +1,62 @@
+/*
+ * Copyright (c) 2018 Miguel Ángel Ortuño.
+ * See the LICENSE file for more information.
+ */
+
+package pubsub
+
+import (
+	"testing"
+
+	"github.com/ortuman/jackal/module/xep0030"
+	"github.com/ortuman/jackal/xmpp"
+	"github.com/ortuman/jackal/xmpp/jid"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPubSub_DiscoInfoProvider(t *testing.T) {
+	r, _, shutdown := setupTest("jackal.im")
+	defer shutdown()
+
+	stm := setupUser(t, r, "ortuman")
+
+	x, shutdownCh := New(&Config{Host: "pubsub.jackal.im", Name: "Nodes", MaxItems: 10}, nil, r)
+	defer shutdownPubSub(shutdownCh)
+
+	dp := &discoInfoProvider{pubSub: x}
+
+	serviceJID, _ := jid.NewWithString("pubsub.jackal.im", true)
+
+	ids := dp.Identities(serviceJID, stm.JID(), "")
+	require.Equal(t, 1, len(ids))
+	require.Equal(t, "pubsub", ids[0].Category)
+	require.Equal(t, "service", ids[0].Type)
+	require.Equal(t, "Nodes", ids[0].Name)
+
+	features, sErr := dp.Features(serviceJID, stm.JID(), "")
+	require.Nil(t, sErr)
+	require.Contains(t, features, pubSubNamespace)
+	require.Contains(t, features, pubSubNamespace+"#access-whitelist")
+
+	_, sErr = dp.Features(serviceJID, stm.JID(), "princely_musings")
+	require.Equal(t, xmpp.ErrItemNotFound, sErr)
+
+	createNode(t, x, stm, "princely_musings")
+
+	items, sErr := dp.Items(serviceJID, stm.JID(), "")
+	require.Nil(t, sErr)
+	require.Equal(t, []xep0030.Item{{Jid: "pubsub.jackal.im", Node: "princely_musings"}}, items)
+
+	ids = dp.Identities(serviceJID, stm.JID(), "princely_musings")
+	require.Equal(t, 1, len(ids))
+	require.Equal(t, "leaf", ids[0].Type)
+
+	form, sErr := dp.Form(serviceJID, stm.JID(), "princely_musings")
+	require.Nil(t, sErr)
+	require.NotNil(t, form)
+	require.Equal(t, metaDataNamespace, form.Fields[0].Values[0])
+	require.Equal(t, []string{"ortuman@jackal.im"}, form.Fields[4].Values)
+
+	_, sErr = dp.Form(serviceJID, stm.JID(), "unknown")
+	require.Equal(t, xmpp.ErrItemNotFound, sErr)
+}
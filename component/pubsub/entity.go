@@ -0,0 +1,348 @@
+/*
+ * Copyright (c) 2018 Miguel Ángel Ortuño.
+ * See the LICENSE file for more information.
+ */
+
+package pubsub
+
+import (
+	"strconv"
+	"time"
+
+	"github.com/ortuman/jackal/log"
+	"github.com/ortuman/jackal/model/pubsubmodel"
+	"github.com/ortuman/jackal/storage"
+	"github.com/ortuman/jackal/xmpp"
+	"github.com/ortuman/jackal/xmpp/jid"
+	"github.com/pborman/uuid"
+)
+
+func (x *PubSub) publishItem(iq *xmpp.IQ, publish xmpp.XElement) {
+	n := x.fetchNode(iq, publish.Attributes().Get("node"))
+	if n == nil {
+		return
+	}
+	fromJID := iq.FromJID()
+	if !canPublish(n, fromJID) {
+		_ = x.router.Route(iq.ForbiddenError())
+		return
+	}
+	itemEl := publish.Elements().Child("item")
+	if itemEl == nil && (n.Options.PersistItems || n.Options.DeliverPayloads) {
+		_ = x.router.Route(ErrorStanza(iq, xmpp.ErrBadRequest, "item-required"))
+		return
+	}
+	item := pubsubmodel.Item{
+		Publisher: fromJID.ToBareJID().String(),
+		CreatedAt: time.Now(),
+	}
+	if itemEl != nil {
+		item.ID = itemEl.Attributes().Get("id")
+		if payloads := itemEl.Elements().All(); len(payloads) > 0 {
+			if len(payloads) > 1 {
+				_ = x.router.Route(ErrorStanza(iq, xmpp.ErrBadRequest, "invalid-payload"))
+				return
+			}
+			item.Payload = payloads[0]
+		}
+	}
+	if item.Payload == nil && n.Options.DeliverPayloads {
+		_ = x.router.Route(ErrorStanza(iq, xmpp.ErrBadRequest, "payload-required"))
+		return
+	}
+	if len(item.ID) == 0 {
+		item.ID = uuid.New()
+	}
+	if n.Options.PersistItems {
+		if err := storage.InsertOrUpdatePubSubItem(x.cfg.Host, n.Name, &item, n.Options.MaxItems); err != nil {
+			log.Error(err)
+			_ = x.router.Route(iq.InternalServerError())
+			return
+		}
+	}
+	publishEl := nodeElement("publish", n.Name)
+	publishEl.AppendElement(xmpp.NewElementName("item").SetAttribute("id", item.ID))
+
+	ps := xmpp.NewElementNamespace("pubsub", pubSubNamespace)
+	ps.AppendElement(publishEl)
+
+	result := iq.ResultIQ()
+	result.AppendElement(ps)
+	_ = x.router.Route(result)
+
+	if n.Options.DeliverNotifications {
+		x.notifySubscribers(n, ItemsEvent(n, []pubsubmodel.Item{item}))
+	}
+}
+
+func (x *PubSub) retractItem(iq *xmpp.IQ, retract xmpp.XElement) {
+	n := x.fetchNode(iq, retract.Attributes().Get("node"))
+	if n == nil {
+		return
+	}
+	itemEl := retract.Elements().Child("item")
+	if itemEl == nil || len(itemEl.Attributes().Get("id")) == 0 {
+		_ = x.router.Route(ErrorStanza(iq, xmpp.ErrBadRequest, "item-required"))
+		return
+	}
+	itemID := itemEl.Attributes().Get("id")
+
+	items, err := storage.FetchPubSubItems(x.cfg.Host, n.Name)
+	if err != nil {
+		log.Error(err)
+		_ = x.router.Route(iq.InternalServerError())
+		return
+	}
+	item := FindItem(items, itemID)
+	if item == nil {
+		_ = x.router.Route(iq.ItemNotFoundError())
+		return
+	}
+	// items can be retracted by node owners, publishers or the original publisher
+	fromBareJID := iq.FromJID().ToBareJID().String()
+	switch n.Affiliation(fromBareJID) {
+	case pubsubmodel.AffiliationOwner, pubsubmodel.AffiliationPublisher:
+		break
+	default:
+		if item.Publisher != fromBareJID {
+			_ = x.router.Route(iq.ForbiddenError())
+			return
+		}
+	}
+	if err := storage.DeletePubSubItem(x.cfg.Host, n.Name, itemID); err != nil {
+		log.Error(err)
+		_ = x.router.Route(iq.InternalServerError())
+		return
+	}
+	_ = x.router.Route(iq.ResultIQ())
+
+	if n.Options.NotifyRetract || isTrue(retract.Attributes().Get("notify")) {
+		itemsEl := nodeElement("items", n.Name)
+		itemsEl.AppendElement(xmpp.NewElementName("retract").SetAttribute("id", itemID))
+		x.notifySubscribers(n, itemsEl)
+	}
+}
+
+func (x *PubSub) sendItems(iq *xmpp.IQ, itemsReq xmpp.XElement) {
+	n := x.fetchNode(iq, itemsReq.Attributes().Get("node"))
+	if n == nil {
+		return
+	}
+	if aErr := x.checkAccess(n, iq.FromJID()); aErr != nil {
+		x.accessDenied(iq, aErr)
+		return
+	}
+	items, err := storage.FetchPubSubItems(x.cfg.Host, n.Name)
+	if err != nil {
+		log.Error(err)
+		_ = x.router.Route(iq.InternalServerError())
+		return
+	}
+	// requested items subset
+	if requested := itemsReq.Elements().Children("item"); len(requested) > 0 {
+		var filtered []pubsubmodel.Item
+		for _, r := range requested {
+			if item := FindItem(items, r.Attributes().Get("id")); item != nil {
+				filtered = append(filtered, *item)
+			}
+		}
+		items = filtered
+	}
+	if maxItems, err := strconv.Atoi(itemsReq.Attributes().Get("max_items")); err == nil && maxItems >= 0 && maxItems < len(items) {
+		items = items[len(items)-maxItems:]
+	}
+	itemsEl := nodeElement("items", n.Name)
+	for _, item := range items {
+		itemEl := xmpp.NewElementName("item")
+		itemEl.SetAttribute("id", item.ID)
+		if item.Payload != nil {
+			itemEl.AppendElement(item.Payload)
+		}
+		itemsEl.AppendElement(itemEl)
+	}
+	ps := xmpp.NewElementNamespace("pubsub", pubSubNamespace)
+	ps.AppendElement(itemsEl)
+
+	result := iq.ResultIQ()
+	result.AppendElement(ps)
+	_ = x.router.Route(result)
+}
+
+func (x *PubSub) subscribe(iq *xmpp.IQ, subscribe xmpp.XElement) {
+	n := x.fetchNode(iq, subscribe.Attributes().Get("node"))
+	if n == nil {
+		return
+	}
+	subJID, ok := x.subscriptionJID(iq, subscribe)
+	if !ok {
+		return
+	}
+	if aErr := x.checkAccess(n, subJID); aErr != nil {
+		x.accessDenied(iq, aErr)
+		return
+	}
+	n.SetSubscription(subJID.String(), pubsubmodel.SubscriptionSubscribed)
+	if !x.persistNode(iq, n) {
+		return
+	}
+	sub := nodeElement("subscription", n.Name)
+	sub.SetAttribute("jid", subJID.String())
+	sub.SetAttribute("subscription", pubsubmodel.SubscriptionSubscribed)
+
+	ps := xmpp.NewElementNamespace("pubsub", pubSubNamespace)
+	ps.AppendElement(sub)
+
+	result := iq.ResultIQ()
+	result.AppendElement(ps)
+	_ = x.router.Route(result)
+
+	if n.Options.SendLastPublishedItem == pubsubmodel.SendLastPublishedItemNever {
+		return
+	}
+	items, err := storage.FetchPubSubItems(x.cfg.Host, n.Name)
+	if err != nil {
+		log.Error(err)
+		return
+	}
+	x.sendLastPublishedItem(n, subJID, items)
+}
+
+func (x *PubSub) unsubscribe(iq *xmpp.IQ, unsubscribe xmpp.XElement) {
+	n := x.fetchNode(iq, unsubscribe.Attributes().Get("node"))
+	if n == nil {
+		return
+	}
+	subJID, ok := x.subscriptionJID(iq, unsubscribe)
+	if !ok {
+		return
+	}
+	if n.Subscription(subJID.String()) == pubsubmodel.SubscriptionNone {
+		_ = x.router.Route(ErrorStanza(iq, xmpp.ErrUnexpectedCondition, "not-subscribed"))
+		return
+	}
+	n.SetSubscription(subJID.String(), pubsubmodel.SubscriptionNone)
+	if !x.persistNode(iq, n) {
+		return
+	}
+	_ = x.router.Route(iq.ResultIQ())
+}
+
+// subscriptionJID returns the JID an entity is (un)subscribing,
+// which must match requester's bare JID.
+func (x *PubSub) subscriptionJID(iq *xmpp.IQ, elem xmpp.XElement) (*jid.JID, bool) {
+	subJID, err := jid.NewWithString(elem.Attributes().Get("jid"), false)
+	if err != nil {
+		_ = x.router.Route(ErrorStanza(iq, xmpp.ErrBadRequest, "jid-required"))
+		return nil, false
+	}
+	if !subJID.Matches(iq.FromJID(), jid.MatchesBare) {
+		_ = x.router.Route(ErrorStanza(iq, xmpp.ErrBadRequest, "invalid-jid"))
+		return nil, false
+	}
+	return subJID, true
+}
+
+func (x *PubSub) sendSubscriptions(iq *xmpp.IQ, subscriptions xmpp.XElement) {
+	nodes, ok := x.requestedNodes(iq, subscriptions.Attributes().Get("node"))
+	if !ok {
+		return
+	}
+	fromJID := iq.FromJID()
+
+	subsEl := xmpp.NewElementName("subscriptions")
+	for _, n := range nodes {
+		for _, j := range sortedKeys(n.Subscriptions) {
+			subJID, err := jid.NewWithString(j, true)
+			if err != nil || !subJID.Matches(fromJID, jid.MatchesBare) {
+				continue
+			}
+			sub := nodeElement("subscription", n.Name)
+			sub.SetAttribute("jid", j)
+			sub.SetAttribute("subscription", n.Subscriptions[j])
+			subsEl.AppendElement(sub)
+		}
+	}
+	ps := xmpp.NewElementNamespace("pubsub", pubSubNamespace)
+	ps.AppendElement(subsEl)
+
+	result := iq.ResultIQ()
+	result.AppendElement(ps)
+	_ = x.router.Route(result)
+}
+
+func (x *PubSub) sendAffiliations(iq *xmpp.IQ, affiliations xmpp.XElement) {
+	nodes, ok := x.requestedNodes(iq, affiliations.Attributes().Get("node"))
+	if !ok {
+		return
+	}
+	fromBareJID := iq.FromJID().ToBareJID().String()
+
+	affsEl := xmpp.NewElementName("affiliations")
+	for _, n := range nodes {
+		aff := n.Affiliation(fromBareJID)
+		if aff == pubsubmodel.AffiliationNone {
+			continue
+		}
+		affEl := nodeElement("affiliation", n.Name)
+		affEl.SetAttribute("affiliation", aff)
+		affsEl.AppendElement(affEl)
+	}
+	ps := xmpp.NewElementNamespace("pubsub", pubSubNamespace)
+	ps.AppendElement(affsEl)
+
+	result := iq.ResultIQ()
+	result.AppendElement(ps)
+	_ = x.router.Route(result)
+}
+
+// requestedNodes returns either a single node, or every service node in case no name was specified.
+func (x *PubSub) requestedNodes(iq *xmpp.IQ, name string) ([]pubsubmodel.Node, bool) {
+	if len(name) > 0 {
+		n := x.fetchNode(iq, name)
+		if n == nil {
+			return nil, false
+		}
+		return []pubsubmodel.Node{*n}, true
+	}
+	nodes, err := storage.FetchPubSubNodes(x.cfg.Host)
+	if err != nil {
+		log.Error(err)
+		_ = x.router.Route(iq.InternalServerError())
+		return nil, false
+	}
+	return nodes, true
+}
+
+func canPublish(n *pubsubmodel.Node, j *jid.JID) bool {
+	switch n.Affiliation(j.ToBareJID().String()) {
+	case pubsubmodel.AffiliationOwner, pubsubmodel.AffiliationPublisher:
+		return true
+	case pubsubmodel.AffiliationOutcast:
+		return false
+	}
+	switch n.Options.PublishModel {
+	case pubsubmodel.PublishModelOpen:
+		return true
+	case pubsubmodel.PublishModelSubscribers:
+		for subJIDStr, subscription := range n.Subscriptions {
+			subJID, err := jid.NewWithString(subJIDStr, true)
+			if err != nil {
+				continue
+			}
+			if subscription == pubsubmodel.SubscriptionSubscribed && subJID.Matches(j, jid.MatchesBare) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// FindItem returns the item identified by id, or nil if not found.
+func FindItem(items []pubsubmodel.Item, id string) *pubsubmodel.Item {
+	for i := range items {
+		if items[i].ID == id {
+			return &items[i]
+		}
+	}
+	return nil
+}
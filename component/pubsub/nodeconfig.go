@@ -0,0 +1,175 @@
+/*
+ * Copyright (c) 2018 Miguel Ángel Ortuño.
+ * See the LICENSE file for more information.
+ */
+
+package pubsub
+
+import (
+	"fmt"
+	"strconv"
+
+	"github.com/ortuman/jackal/model/pubsubmodel"
+	"github.com/ortuman/jackal/module/xep0004"
+)
+
+// node configuration form fields
+const (
+	formTypeField              = "FORM_TYPE"
+	titleField                 = "pubsub#title"
+	deliverNotificationsField  = "pubsub#deliver_notifications"
+	deliverPayloadsField       = "pubsub#deliver_payloads"
+	persistItemsField          = "pubsub#persist_items"
+	maxItemsField              = "pubsub#max_items"
+	accessModelField           = "pubsub#access_model"
+	publishModelField          = "pubsub#publish_model"
+	rosterGroupsAllowedField   = "pubsub#roster_groups_allowed"
+	notifyConfigField          = "pubsub#notify_config"
+	notifyDeleteField          = "pubsub#notify_delete"
+	notifyRetractField         = "pubsub#notify_retract"
+	sendLastPublishedItemField = "pubsub#send_last_published_item"
+)
+
+// defaultNodeOptions returns the configuration applied to newly created nodes.
+func defaultNodeOptions(maxItems int) pubsubmodel.Options {
+	return pubsubmodel.Options{
+		DeliverNotifications:  true,
+		DeliverPayloads:       true,
+		PersistItems:          true,
+		MaxItems:              maxItems,
+		AccessModel:           pubsubmodel.AccessModelOpen,
+		PublishModel:          pubsubmodel.PublishModelPublishers,
+		NotifyConfig:          false,
+		NotifyDelete:          true,
+		NotifyRetract:         true,
+		SendLastPublishedItem: pubsubmodel.SendLastPublishedItemOnSub,
+	}
+}
+
+// ConfigForm returns a node configuration form populated with the given options.
+func ConfigForm(opts *pubsubmodel.Options) *xep0004.DataForm {
+	return &xep0004.DataForm{
+		Type:         xep0004.Form,
+		Title:        "Node configuration",
+		Instructions: "Complete this form to modify the configuration of your node.",
+		Fields: []xep0004.Field{
+			{Var: formTypeField, Type: xep0004.Hidden, Values: []string{pubSubNodeConfigNamespace}},
+			{Var: titleField, Type: xep0004.TextSingle, Label: "A friendly name for the node", Values: []string{opts.Title}},
+			{Var: deliverNotificationsField, Type: xep0004.Boolean, Label: "Whether to deliver event notifications", Values: []string{boolValue(opts.DeliverNotifications)}},
+			{Var: deliverPayloadsField, Type: xep0004.Boolean, Label: "Whether to deliver payloads with event notifications", Values: []string{boolValue(opts.DeliverPayloads)}},
+			{Var: persistItemsField, Type: xep0004.Boolean, Label: "Persist items to storage", Values: []string{boolValue(opts.PersistItems)}},
+			{Var: maxItemsField, Type: xep0004.TextSingle, Label: "Max number of items to persist", Values: []string{strconv.Itoa(opts.MaxItems)}},
+			{
+				Var:    accessModelField,
+				Type:   xep0004.ListSingle,
+				Label:  "Specify the subscriber model",
+				Values: []string{opts.AccessModel},
+				Options: []xep0004.Option{
+					{Label: "Open", Value: pubsubmodel.AccessModelOpen},
+					{Label: "Presence Sharing", Value: pubsubmodel.AccessModelPresence},
+					{Label: "Roster Groups", Value: pubsubmodel.AccessModelRoster},
+					{Label: "Whitelist", Value: pubsubmodel.AccessModelWhitelist},
+				},
+			},
+			{
+				Var:    publishModelField,
+				Type:   xep0004.ListSingle,
+				Label:  "Specify the publisher model",
+				Values: []string{opts.PublishModel},
+				Options: []xep0004.Option{
+					{Label: "Only publishers may publish", Value: pubsubmodel.PublishModelPublishers},
+					{Label: "Subscribers may publish", Value: pubsubmodel.PublishModelSubscribers},
+					{Label: "Anyone may publish", Value: pubsubmodel.PublishModelOpen},
+				},
+			},
+			{Var: rosterGroupsAllowedField, Type: xep0004.TextMulti, Label: "Roster groups allowed to subscribe", Values: opts.RosterGroupsAllowed},
+			{Var: notifyConfigField, Type: xep0004.Boolean, Label: "Notify subscribers when the node configuration changes", Values: []string{boolValue(opts.NotifyConfig)}},
+			{Var: notifyDeleteField, Type: xep0004.Boolean, Label: "Notify subscribers when the node is deleted", Values: []string{boolValue(opts.NotifyDelete)}},
+			{Var: notifyRetractField, Type: xep0004.Boolean, Label: "Notify subscribers when items are removed from the node", Values: []string{boolValue(opts.NotifyRetract)}},
+			{
+				Var:    sendLastPublishedItemField,
+				Type:   xep0004.ListSingle,
+				Label:  "When to send the last published item",
+				Values: []string{opts.SendLastPublishedItem},
+				Options: []xep0004.Option{
+					{Label: "Never", Value: pubsubmodel.SendLastPublishedItemNever},
+					{Label: "When a new subscription is processed", Value: pubsubmodel.SendLastPublishedItemOnSub},
+					{Label: "When a new subscription is processed and whenever a subscriber comes online", Value: pubsubmodel.SendLastPublishedItemOnSubAndPresence},
+				},
+			},
+		},
+	}
+}
+
+// ApplyConfigForm updates node options with the values of a submitted configuration form.
+func ApplyConfigForm(opts *pubsubmodel.Options, form *xep0004.DataForm) error {
+	for _, field := range form.Fields {
+		var value string
+		if len(field.Values) > 0 {
+			value = field.Values[0]
+		}
+		switch field.Var {
+		case formTypeField:
+			if value != pubSubNodeConfigNamespace {
+				return fmt.Errorf("pubsub: unexpected form type: %s", value)
+			}
+		case titleField:
+			opts.Title = value
+		case deliverNotificationsField:
+			opts.DeliverNotifications = isTrue(value)
+		case deliverPayloadsField:
+			opts.DeliverPayloads = isTrue(value)
+		case persistItemsField:
+			opts.PersistItems = isTrue(value)
+		case maxItemsField:
+			maxItems, err := strconv.Atoi(value)
+			if err != nil || maxItems < 0 {
+				return fmt.Errorf("pubsub: invalid max items value: %s", value)
+			}
+			opts.MaxItems = maxItems
+		case accessModelField:
+			switch value {
+			case pubsubmodel.AccessModelOpen, pubsubmodel.AccessModelPresence,
+				pubsubmodel.AccessModelRoster, pubsubmodel.AccessModelWhitelist:
+				opts.AccessModel = value
+			default:
+				return fmt.Errorf("pubsub: unrecognized access model: %s", value)
+			}
+		case publishModelField:
+			switch value {
+			case pubsubmodel.PublishModelPublishers, pubsubmodel.PublishModelSubscribers, pubsubmodel.PublishModelOpen:
+				opts.PublishModel = value
+			default:
+				return fmt.Errorf("pubsub: unrecognized publish model: %s", value)
+			}
+		case rosterGroupsAllowedField:
+			opts.RosterGroupsAllowed = field.Values
+		case notifyConfigField:
+			opts.NotifyConfig = isTrue(value)
+		case notifyDeleteField:
+			opts.NotifyDelete = isTrue(value)
+		case notifyRetractField:
+			opts.NotifyRetract = isTrue(value)
+		case sendLastPublishedItemField:
+			switch value {
+			case pubsubmodel.SendLastPublishedItemNever, pubsubmodel.SendLastPublishedItemOnSub,
+				pubsubmodel.SendLastPublishedItemOnSubAndPresence:
+				opts.SendLastPublishedItem = value
+			default:
+				return fmt.Errorf("pubsub: unrecognized send last published item value: %s", value)
+			}
+		}
+	}
+	return nil
+}
+
+func boolValue(b bool) string {
+	if b {
+		return "1"
+	}
+	return "0"
+}
+
+func isTrue(value string) bool {
+	return value == "1" || value == "true"
+}
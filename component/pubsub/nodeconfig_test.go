@@ -0,0 +1,72 @@
+/*
+ * Copyright (c) 2018 Miguel Ángel Ortuño.
+ * See the LICENSE file for more information.
+ */
+
+package pubsub
+
+import (
+	"testing"
+
+	"github.com/ortuman/jackal/model/pubsubmodel"
+	"github.com/ortuman/jackal/module/xep0004"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNodeConfig_Form(t *testing.T) {
+	opts := defaultNodeOptions(10)
+
+	form := ConfigForm(&opts)
+	require.Equal(t, xep0004.Form, form.Type)
+
+	form.Type = xep0004.Submit
+	setFormValue(form, titleField, "Princely Musings")
+	setFormValue(form, maxItemsField, "20")
+	setFormValue(form, accessModelField, pubsubmodel.AccessModelRoster)
+	setFormValue(form, deliverPayloadsField, "false")
+	setFormValue(form, notifyConfigField, "true")
+	setFormValue(form, sendLastPublishedItemField, pubsubmodel.SendLastPublishedItemNever)
+	for i := range form.Fields {
+		if form.Fields[i].Var == rosterGroupsAllowedField {
+			form.Fields[i].Values = []string{"friends", "family"}
+		}
+	}
+	var newOpts pubsubmodel.Options
+	require.Nil(t, ApplyConfigForm(&newOpts, form))
+	require.Equal(t, "Princely Musings", newOpts.Title)
+	require.Equal(t, 20, newOpts.MaxItems)
+	require.Equal(t, pubsubmodel.AccessModelRoster, newOpts.AccessModel)
+	require.Equal(t, pubsubmodel.PublishModelPublishers, newOpts.PublishModel)
+	require.Equal(t, []string{"friends", "family"}, newOpts.RosterGroupsAllowed)
+	require.True(t, newOpts.DeliverNotifications)
+	require.False(t, newOpts.DeliverPayloads)
+	require.True(t, newOpts.NotifyConfig)
+	require.Equal(t, pubsubmodel.SendLastPublishedItemNever, newOpts.SendLastPublishedItem)
+
+	setFormValue(form, maxItemsField, "many")
+	require.NotNil(t, ApplyConfigForm(&newOpts, form))
+
+	setFormValue(form, maxItemsField, "20")
+	setFormValue(form, accessModelField, "authorize")
+	require.NotNil(t, ApplyConfigForm(&newOpts, form))
+
+	setFormValue(form, accessModelField, pubsubmodel.AccessModelOpen)
+	setFormValue(form, publishModelField, "nobody")
+	require.NotNil(t, ApplyConfigForm(&newOpts, form))
+
+	setFormValue(form, publishModelField, pubsubmodel.PublishModelOpen)
+	setFormValue(form, sendLastPublishedItemField, "always")
+	require.NotNil(t, ApplyConfigForm(&newOpts, form))
+
+	setFormValue(form, sendLastPublishedItemField, pubsubmodel.SendLastPublishedItemOnSub)
+	setFormValue(form, formTypeField, "urn:xmpp:unknown")
+	require.NotNil(t, ApplyConfigForm(&newOpts, form))
+}
+
+func setFormValue(form *xep0004.DataForm, fieldVar, value string) {
+	for i := range form.Fields {
+		if form.Fields[i].Var == fieldVar {
+			form.Fields[i].Values = []string{value}
+		}
+	}
+}
@@ -0,0 +1,71 @@
+/*
+ * Copyright (c) 2018 Miguel Ángel Ortuño.
+ * See the LICENSE file for more information.
+ */
+
+package pubsub
+
+import (
+	"github.com/ortuman/jackal/model/pubsubmodel"
+	"github.com/ortuman/jackal/xmpp"
+	"github.com/ortuman/jackal/xmpp/jid"
+	"github.com/pborman/uuid"
+)
+
+// notifySubscribers sends an event notification to every node subscriber
+// allowed to access it, according to the node access model.
+func (x *PubSub) notifySubscribers(n *pubsubmodel.Node, event xmpp.XElement) {
+	for subJIDStr, subscription := range n.Subscriptions {
+		if subscription != pubsubmodel.SubscriptionSubscribed {
+			continue
+		}
+		subJID, err := jid.NewWithString(subJIDStr, true)
+		if err != nil {
+			continue
+		}
+		if x.checkAccess(n, subJID) != nil {
+			continue
+		}
+		x.sendEvent(subJID, event)
+	}
+}
+
+// sendLastPublishedItem sends node last published item to a recently subscribed entity.
+func (x *PubSub) sendLastPublishedItem(n *pubsubmodel.Node, subJID *jid.JID, items []pubsubmodel.Item) {
+	if len(items) == 0 {
+		return
+	}
+	x.sendEvent(subJID, ItemsEvent(n, items[len(items)-1:]))
+}
+
+func (x *PubSub) sendEvent(to *jid.JID, event xmpp.XElement) {
+	ev := xmpp.NewElementNamespace("event", pubSubEventNamespace)
+	ev.AppendElement(event)
+
+	msg := xmpp.NewMessageType(uuid.New(), xmpp.HeadlineType)
+	msg.SetFromJID(x.serviceJID)
+	msg.SetToJID(to)
+	msg.AppendElement(ev)
+	_ = x.router.Route(msg)
+}
+
+// ItemsEvent returns the event element notifying a set of published items.
+func ItemsEvent(n *pubsubmodel.Node, items []pubsubmodel.Item) xmpp.XElement {
+	itemsEl := xmpp.NewElementName("items")
+	itemsEl.SetAttribute("node", n.Name)
+	for _, item := range items {
+		itemEl := xmpp.NewElementName("item")
+		itemEl.SetAttribute("id", item.ID)
+		if n.Options.DeliverPayloads && item.Payload != nil {
+			itemEl.AppendElement(item.Payload)
+		}
+		itemsEl.AppendElement(itemEl)
+	}
+	return itemsEl
+}
+
+func nodeElement(name, node string) *xmpp.Element {
+	e := xmpp.NewElementName(name)
+	e.SetAttribute("node", node)
+	return e
+}
@@ -0,0 +1,287 @@
+/*
+ * Copyright (c) 2018 Miguel Ángel Ortuño.
+ * See the LICENSE file for more information.
+ */
+
+package pubsub
+
+import (
+	"sort"
+
+	"github.com/ortuman/jackal/log"
+	"github.com/ortuman/jackal/model/pubsubmodel"
+	"github.com/ortuman/jackal/module/xep0004"
+	"github.com/ortuman/jackal/storage"
+	"github.com/ortuman/jackal/xmpp"
+	"github.com/ortuman/jackal/xmpp/jid"
+	"github.com/pborman/uuid"
+)
+
+func (x *PubSub) createNode(iq *xmpp.IQ, create, configure xmpp.XElement) {
+	fromJID := iq.FromJID()
+	if !x.router.IsLocalHost(fromJID.Domain()) {
+		_ = x.router.Route(iq.ForbiddenError())
+		return
+	}
+	name := create.Attributes().Get("node")
+	instant := len(name) == 0
+	if instant {
+		name = uuid.New()
+	}
+	n, err := storage.FetchPubSubNode(x.cfg.Host, name)
+	if err != nil {
+		log.Error(err)
+		_ = x.router.Route(iq.InternalServerError())
+		return
+	}
+	if n != nil {
+		_ = x.router.Route(iq.ConflictError())
+		return
+	}
+	n = &pubsubmodel.Node{
+		Host:    x.cfg.Host,
+		Name:    name,
+		Options: defaultNodeOptions(x.cfg.MaxItems),
+	}
+	if configure != nil {
+		if xEl := configure.Elements().ChildNamespace("x", formNamespace); xEl != nil {
+			form, err := xep0004.NewFormFromElement(xEl)
+			if err != nil || form.Type != xep0004.Submit {
+				_ = x.router.Route(iq.BadRequestError())
+				return
+			}
+			if err := ApplyConfigForm(&n.Options, form); err != nil {
+				_ = x.router.Route(iq.NotAcceptableError())
+				return
+			}
+		}
+	}
+	n.SetAffiliation(fromJID.ToBareJID().String(), pubsubmodel.AffiliationOwner)
+	if !x.persistNode(iq, n) {
+		return
+	}
+	log.Infof("pubsub: created node %s (host: %s)", name, x.cfg.Host)
+
+	result := iq.ResultIQ()
+	if instant {
+		ps := xmpp.NewElementNamespace("pubsub", pubSubNamespace)
+		ps.AppendElement(nodeElement("create", name))
+		result.AppendElement(ps)
+	}
+	_ = x.router.Route(result)
+}
+
+func (x *PubSub) sendConfiguration(iq *xmpp.IQ, n *pubsubmodel.Node) {
+	configure := nodeElement("configure", n.Name)
+	configure.AppendElement(ConfigForm(&n.Options).Element())
+
+	ps := xmpp.NewElementNamespace("pubsub", pubSubOwnerNamespace)
+	ps.AppendElement(configure)
+
+	result := iq.ResultIQ()
+	result.AppendElement(ps)
+	_ = x.router.Route(result)
+}
+
+func (x *PubSub) sendDefaultConfiguration(iq *xmpp.IQ) {
+	opts := defaultNodeOptions(x.cfg.MaxItems)
+
+	def := xmpp.NewElementName("default")
+	def.AppendElement(ConfigForm(&opts).Element())
+
+	ps := xmpp.NewElementNamespace("pubsub", pubSubOwnerNamespace)
+	ps.AppendElement(def)
+
+	result := iq.ResultIQ()
+	result.AppendElement(ps)
+	_ = x.router.Route(result)
+}
+
+func (x *PubSub) configureNode(iq *xmpp.IQ, n *pubsubmodel.Node, configure xmpp.XElement) {
+	xEl := configure.Elements().ChildNamespace("x", formNamespace)
+	if xEl == nil {
+		_ = x.router.Route(iq.BadRequestError())
+		return
+	}
+	form, err := xep0004.NewFormFromElement(xEl)
+	if err != nil {
+		_ = x.router.Route(iq.BadRequestError())
+		return
+	}
+	switch form.Type {
+	case xep0004.Cancel:
+		_ = x.router.Route(iq.ResultIQ())
+		return
+	case xep0004.Submit:
+		break
+	default:
+		_ = x.router.Route(iq.BadRequestError())
+		return
+	}
+	if err := ApplyConfigForm(&n.Options, form); err != nil {
+		_ = x.router.Route(iq.NotAcceptableError())
+		return
+	}
+	if !x.persistNode(iq, n) {
+		return
+	}
+	_ = x.router.Route(iq.ResultIQ())
+
+	if n.Options.NotifyConfig {
+		x.notifySubscribers(n, nodeElement("configuration", n.Name))
+	}
+}
+
+func (x *PubSub) deleteNode(iq *xmpp.IQ, n *pubsubmodel.Node) {
+	if err := storage.DeletePubSubNode(x.cfg.Host, n.Name); err != nil {
+		log.Error(err)
+		_ = x.router.Route(iq.InternalServerError())
+		return
+	}
+	log.Infof("pubsub: deleted node %s (host: %s)", n.Name, x.cfg.Host)
+
+	_ = x.router.Route(iq.ResultIQ())
+
+	if n.Options.NotifyDelete {
+		x.notifySubscribers(n, nodeElement("delete", n.Name))
+	}
+}
+
+func (x *PubSub) purgeNode(iq *xmpp.IQ, n *pubsubmodel.Node) {
+	items, err := storage.FetchPubSubItems(x.cfg.Host, n.Name)
+	if err != nil {
+		log.Error(err)
+		_ = x.router.Route(iq.InternalServerError())
+		return
+	}
+	for _, item := range items {
+		if err := storage.DeletePubSubItem(x.cfg.Host, n.Name, item.ID); err != nil {
+			log.Error(err)
+			_ = x.router.Route(iq.InternalServerError())
+			return
+		}
+	}
+	_ = x.router.Route(iq.ResultIQ())
+
+	if n.Options.NotifyRetract {
+		x.notifySubscribers(n, nodeElement("purge", n.Name))
+	}
+}
+
+func (x *PubSub) sendNodeSubscriptions(iq *xmpp.IQ, n *pubsubmodel.Node) {
+	subscriptions := nodeElement("subscriptions", n.Name)
+	for _, j := range sortedKeys(n.Subscriptions) {
+		sub := xmpp.NewElementName("subscription")
+		sub.SetAttribute("jid", j)
+		sub.SetAttribute("subscription", n.Subscriptions[j])
+		subscriptions.AppendElement(sub)
+	}
+	ps := xmpp.NewElementNamespace("pubsub", pubSubOwnerNamespace)
+	ps.AppendElement(subscriptions)
+
+	result := iq.ResultIQ()
+	result.AppendElement(ps)
+	_ = x.router.Route(result)
+}
+
+func (x *PubSub) updateNodeSubscriptions(iq *xmpp.IQ, n *pubsubmodel.Node, subscriptions xmpp.XElement) {
+	subs := subscriptions.Elements().Children("subscription")
+	// validate every subscription before applying any change
+	for _, sub := range subs {
+		if _, err := jid.NewWithString(sub.Attributes().Get("jid"), false); err != nil {
+			_ = x.router.Route(iq.JidMalformedError())
+			return
+		}
+		switch sub.Attributes().Get("subscription") {
+		case pubsubmodel.SubscriptionSubscribed, pubsubmodel.SubscriptionNone:
+			break
+		default:
+			_ = x.router.Route(iq.BadRequestError())
+			return
+		}
+	}
+	for _, sub := range subs {
+		j, _ := jid.NewWithString(sub.Attributes().Get("jid"), false)
+		n.SetSubscription(j.String(), sub.Attributes().Get("subscription"))
+	}
+	if !x.persistNode(iq, n) {
+		return
+	}
+	_ = x.router.Route(iq.ResultIQ())
+}
+
+func (x *PubSub) sendNodeAffiliations(iq *xmpp.IQ, n *pubsubmodel.Node) {
+	affiliations := nodeElement("affiliations", n.Name)
+	for _, j := range sortedKeys(n.Affiliations) {
+		aff := xmpp.NewElementName("affiliation")
+		aff.SetAttribute("jid", j)
+		aff.SetAttribute("affiliation", n.Affiliations[j])
+		affiliations.AppendElement(aff)
+	}
+	ps := xmpp.NewElementNamespace("pubsub", pubSubOwnerNamespace)
+	ps.AppendElement(affiliations)
+
+	result := iq.ResultIQ()
+	result.AppendElement(ps)
+	_ = x.router.Route(result)
+}
+
+func (x *PubSub) updateNodeAffiliations(iq *xmpp.IQ, n *pubsubmodel.Node, affiliations xmpp.XElement) {
+	affs := affiliations.Elements().Children("affiliation")
+	// validate every affiliation before applying any change
+	for _, aff := range affs {
+		if _, err := jid.NewWithString(aff.Attributes().Get("jid"), false); err != nil {
+			_ = x.router.Route(iq.JidMalformedError())
+			return
+		}
+		switch aff.Attributes().Get("affiliation") {
+		case pubsubmodel.AffiliationOwner, pubsubmodel.AffiliationPublisher, pubsubmodel.AffiliationMember,
+			pubsubmodel.AffiliationOutcast, pubsubmodel.AffiliationNone:
+			break
+		default:
+			_ = x.router.Route(iq.BadRequestError())
+			return
+		}
+	}
+	for _, aff := range affs {
+		j, _ := jid.NewWithString(aff.Attributes().Get("jid"), false)
+		n.SetAffiliation(j.ToBareJID().String(), aff.Attributes().Get("affiliation"))
+	}
+	// a node can never be left without owners
+	if !hasOwner(n) {
+		_ = x.router.Route(iq.NotAcceptableError())
+		return
+	}
+	// outcasts lose their subscriptions
+	for subJIDStr := range n.Subscriptions {
+		subJID, err := jid.NewWithString(subJIDStr, true)
+		if err != nil {
+			continue
+		}
+		if n.Affiliation(subJID.ToBareJID().String()) == pubsubmodel.AffiliationOutcast {
+			n.SetSubscription(subJIDStr, pubsubmodel.SubscriptionNone)
+		}
+	}
+	if !x.persistNode(iq, n) {
+		return
+	}
+	_ = x.router.Route(iq.ResultIQ())
+}
+
+func hasOwner(n *pubsubmodel.Node) bool {
+	for _, aff := range n.Affiliations {
+		if aff == pubsubmodel.AffiliationOwner {
+			return true
+		}
+	}
+	return false
+}
+
+func sortedKeys(m map[string]string) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -0,0 +1,286 @@
+/*
+ * Copyright (c) 2018 Miguel Ángel Ortuño.
+ * See the LICENSE file for more information.
+ */
+
+package pubsub
+
+import (
+	"errors"
+
+	"github.com/ortuman/jackal/log"
+	"github.com/ortuman/jackal/model/pubsubmodel"
+	"github.com/ortuman/jackal/module/xep0030"
+	"github.com/ortuman/jackal/router"
+	"github.com/ortuman/jackal/runqueue"
+	"github.com/ortuman/jackal/storage"
+	"github.com/ortuman/jackal/stream"
+	"github.com/ortuman/jackal/xmpp"
+	"github.com/ortuman/jackal/xmpp/jid"
+)
+
+const (
+	pubSubNamespace           = "http://jabber.org/protocol/pubsub"
+	pubSubOwnerNamespace      = "http://jabber.org/protocol/pubsub#owner"
+	pubSubEventNamespace      = "http://jabber.org/protocol/pubsub#event"
+	pubSubErrorsNamespace     = "http://jabber.org/protocol/pubsub#errors"
+	pubSubNodeConfigNamespace = "http://jabber.org/protocol/pubsub#node_config"
+	formNamespace             = "jabber:x:data"
+)
+
+const (
+	defaultServiceName = "Publish-Subscribe"
+	defaultMaxItems    = 10
+)
+
+// Config represents publish-subscribe service configuration.
+type Config struct {
+	Host     string
+	Name     string
+	MaxItems int
+}
+
+type configProxy struct {
+	Host     string `yaml:"host"`
+	Name     string `yaml:"name"`
+	MaxItems int    `yaml:"max_items"`
+}
+
+// UnmarshalYAML satisfies Unmarshaler interface.
+func (c *Config) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	p := configProxy{}
+	if err := unmarshal(&p); err != nil {
+		return err
+	}
+	if len(p.Host) == 0 {
+		return errors.New("pubsub.Config: host must be specified")
+	}
+	if p.MaxItems < 0 {
+		return errors.New("pubsub.Config: max items value must be positive")
+	}
+	c.Host = p.Host
+	c.Name = p.Name
+	if len(c.Name) == 0 {
+		c.Name = defaultServiceName
+	}
+	c.MaxItems = p.MaxItems
+	if c.MaxItems == 0 {
+		c.MaxItems = defaultMaxItems
+	}
+	return nil
+}
+
+// PubSub represents a publish-subscribe service component.
+type PubSub struct {
+	cfg        *Config
+	discoInfo  *xep0030.DiscoInfo
+	router     *router.Router
+	runQueue   *runqueue.RunQueue
+	serviceJID *jid.JID
+}
+
+// New returns a publish-subscribe service component.
+func New(config *Config, discoInfo *xep0030.DiscoInfo, router *router.Router) (*PubSub, chan<- chan bool) {
+	serviceJID, _ := jid.New("", config.Host, "", true)
+	x := &PubSub{
+		cfg:        config,
+		discoInfo:  discoInfo,
+		router:     router,
+		runQueue:   runqueue.New("pubsub"),
+		serviceJID: serviceJID,
+	}
+	if discoInfo != nil {
+		discoInfo.RegisterServerItem(xep0030.Item{Jid: config.Host, Name: config.Name})
+		discoInfo.RegisterProvider(config.Host, &discoInfoProvider{pubSub: x})
+	}
+	shutdownCh := make(chan chan bool)
+	go x.waitForShutdown(shutdownCh)
+	return x, shutdownCh
+}
+
+// Host returns publish-subscribe service host name.
+func (x *PubSub) Host() string {
+	return x.cfg.Host
+}
+
+// ProcessStanza processes a stanza addressed to the publish-subscribe service.
+func (x *PubSub) ProcessStanza(stanza xmpp.Stanza, _ stream.C2S) {
+	x.runQueue.Run(func() {
+		x.processStanza(stanza)
+	})
+}
+
+func (x *PubSub) processStanza(stanza xmpp.Stanza) {
+	iq, ok := stanza.(*xmpp.IQ)
+	if !ok || (!iq.IsGet() && !iq.IsSet()) {
+		return // only IQ requests are served
+	}
+	if !iq.ToJID().IsServer() {
+		_ = x.router.Route(iq.ServiceUnavailableError())
+		return
+	}
+	if ps := iq.Elements().ChildNamespace("pubsub", pubSubNamespace); ps != nil {
+		x.processPubSubIQ(iq, ps)
+		return
+	}
+	if ps := iq.Elements().ChildNamespace("pubsub", pubSubOwnerNamespace); ps != nil {
+		x.processOwnerIQ(iq, ps)
+		return
+	}
+	_ = x.router.Route(iq.ServiceUnavailableError())
+}
+
+func (x *PubSub) processPubSubIQ(iq *xmpp.IQ, ps xmpp.XElement) {
+	if iq.IsSet() {
+		if cmd := ps.Elements().Child("create"); cmd != nil {
+			x.createNode(iq, cmd, ps.Elements().Child("configure"))
+			return
+		}
+		if cmd := ps.Elements().Child("publish"); cmd != nil {
+			x.publishItem(iq, cmd)
+			return
+		}
+		if cmd := ps.Elements().Child("retract"); cmd != nil {
+			x.retractItem(iq, cmd)
+			return
+		}
+		if cmd := ps.Elements().Child("subscribe"); cmd != nil {
+			x.subscribe(iq, cmd)
+			return
+		}
+		if cmd := ps.Elements().Child("unsubscribe"); cmd != nil {
+			x.unsubscribe(iq, cmd)
+			return
+		}
+	} else {
+		if cmd := ps.Elements().Child("items"); cmd != nil {
+			x.sendItems(iq, cmd)
+			return
+		}
+		if cmd := ps.Elements().Child("subscriptions"); cmd != nil {
+			x.sendSubscriptions(iq, cmd)
+			return
+		}
+		if cmd := ps.Elements().Child("affiliations"); cmd != nil {
+			x.sendAffiliations(iq, cmd)
+			return
+		}
+	}
+	_ = x.router.Route(iq.FeatureNotImplementedError())
+}
+
+func (x *PubSub) processOwnerIQ(iq *xmpp.IQ, ps xmpp.XElement) {
+	if iq.IsGet() {
+		if cmd := ps.Elements().Child("default"); cmd != nil {
+			x.sendDefaultConfiguration(iq)
+			return
+		}
+	}
+	cmd := ps.Elements().Child("configure")
+	if cmd == nil {
+		cmd = ps.Elements().Child("delete")
+	}
+	if cmd == nil {
+		cmd = ps.Elements().Child("purge")
+	}
+	if cmd == nil {
+		cmd = ps.Elements().Child("subscriptions")
+	}
+	if cmd == nil {
+		cmd = ps.Elements().Child("affiliations")
+	}
+	if cmd == nil {
+		_ = x.router.Route(iq.FeatureNotImplementedError())
+		return
+	}
+	// every owner operation targets an existing node
+	n := x.fetchNode(iq, cmd.Attributes().Get("node"))
+	if n == nil {
+		return
+	}
+	if n.Affiliation(iq.FromJID().ToBareJID().String()) != pubsubmodel.AffiliationOwner {
+		_ = x.router.Route(iq.ForbiddenError())
+		return
+	}
+	switch cmd.Name() {
+	case "configure":
+		if iq.IsGet() {
+			x.sendConfiguration(iq, n)
+		} else {
+			x.configureNode(iq, n, cmd)
+		}
+	case "delete":
+		if iq.IsSet() {
+			x.deleteNode(iq, n)
+			return
+		}
+		_ = x.router.Route(iq.BadRequestError())
+	case "purge":
+		if iq.IsSet() {
+			x.purgeNode(iq, n)
+			return
+		}
+		_ = x.router.Route(iq.BadRequestError())
+	case "subscriptions":
+		if iq.IsGet() {
+			x.sendNodeSubscriptions(iq, n)
+		} else {
+			x.updateNodeSubscriptions(iq, n, cmd)
+		}
+	case "affiliations":
+		if iq.IsGet() {
+			x.sendNodeAffiliations(iq, n)
+		} else {
+			x.updateNodeAffiliations(iq, n, cmd)
+		}
+	}
+}
+
+// fetchNode retrieves a node from storage, replying with the
+// proper error stanza in case it couldn't be found.
+func (x *PubSub) fetchNode(iq *xmpp.IQ, name string) *pubsubmodel.Node {
+	if len(name) == 0 {
+		_ = x.router.Route(ErrorStanza(iq, xmpp.ErrBadRequest, "nodeid-required"))
+		return nil
+	}
+	n, err := storage.FetchPubSubNode(x.cfg.Host, name)
+	if err != nil {
+		log.Error(err)
+		_ = x.router.Route(iq.InternalServerError())
+		return nil
+	}
+	if n == nil {
+		_ = x.router.Route(iq.ItemNotFoundError())
+		return nil
+	}
+	return n
+}
+
+func (x *PubSub) persistNode(iq *xmpp.IQ, n *pubsubmodel.Node) bool {
+	if err := storage.InsertOrUpdatePubSubNode(n); err != nil {
+		log.Error(err)
+		_ = x.router.Route(iq.InternalServerError())
+		return false
+	}
+	return true
+}
+
+func (x *PubSub) waitForShutdown(shutdownCh <-chan chan bool) {
+	c := <-shutdownCh
+	x.runQueue.Stop(func() {
+		if x.discoInfo != nil {
+			x.discoInfo.UnregisterProvider(x.cfg.Host)
+			x.discoInfo.UnregisterServerItem(xep0030.Item{Jid: x.cfg.Host, Name: x.cfg.Name})
+		}
+		c <- true
+	})
+}
+
+// ErrorStanza returns an error stanza including a pubsub specific error condition.
+func ErrorStanza(iq *xmpp.IQ, stanzaErr *xmpp.StanzaError, condition string) xmpp.Stanza {
+	var errElements []xmpp.XElement
+	if len(condition) > 0 {
+		errElements = append(errElements, xmpp.NewElementNamespace(condition, pubSubErrorsNamespace))
+	}
+	return xmpp.NewErrorStanzaFromStanza(iq, stanzaErr, errElements)
+}
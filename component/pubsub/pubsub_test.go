@@ -0,0 +1,667 @@
+/*
+ * Copyright (c) 2018 Miguel Ángel Ortuño.
+ * See the LICENSE file for more information.
+ */
+
+package pubsub
+
+import (
+	"crypto/tls"
+	"testing"
+
+	"github.com/ortuman/jackal/model"
+	"github.com/ortuman/jackal/model/pubsubmodel"
+	"github.com/ortuman/jackal/model/rostermodel"
+	"github.com/ortuman/jackal/module/xep0004"
+	"github.com/ortuman/jackal/router"
+	"github.com/ortuman/jackal/storage"
+	"github.com/ortuman/jackal/storage/memstorage"
+	"github.com/ortuman/jackal/stream"
+	"github.com/ortuman/jackal/xmpp"
+	"github.com/ortuman/jackal/xmpp/jid"
+	"github.com/pborman/uuid"
+	"github.com/stretchr/testify/require"
+	yaml "gopkg.in/yaml.v2"
+)
+
+func TestPubSub_Config(t *testing.T) {
+	cfg := Config{}
+	require.NotNil(t, yaml.Unmarshal([]byte(`name: Nodes`), &cfg))
+	require.NotNil(t, yaml.Unmarshal([]byte("host: pubsub.jackal.im\nmax_items: -1"), &cfg))
+
+	require.Nil(t, yaml.Unmarshal([]byte(`host: pubsub.jackal.im`), &cfg))
+	require.Equal(t, "pubsub.jackal.im", cfg.Host)
+	require.Equal(t, defaultServiceName, cfg.Name)
+	require.Equal(t, defaultMaxItems, cfg.MaxItems)
+}
+
+func TestPubSub_ServiceIQ(t *testing.T) {
+	r, _, shutdown := setupTest("jackal.im")
+	defer shutdown()
+
+	stm := setupUser(t, r, "ortuman")
+
+	x, shutdownCh := New(&Config{Host: "pubsub.jackal.im", Name: defaultServiceName, MaxItems: 10}, nil, r)
+	defer shutdownPubSub(shutdownCh)
+
+	require.Equal(t, "pubsub.jackal.im", x.Host())
+
+	// not a pubsub request
+	serviceJID, _ := jid.NewWithString("pubsub.jackal.im", true)
+	iq := xmpp.NewIQType(uuid.New(), xmpp.GetType)
+	iq.SetFromJID(stm.JID())
+	iq.SetToJID(serviceJID)
+	x.ProcessStanza(iq, stm)
+
+	elem := stm.ReceiveElement()
+	require.Equal(t, xmpp.ErrServiceUnavailable.Error(), elem.Error().Elements().All()[0].Name())
+
+	// addressed to a non service JID
+	nodeJID, _ := jid.NewWithString("node@pubsub.jackal.im", true)
+	iq = pubSubIQ(stm, xmpp.GetType, pubSubNamespace, nodeElement("items", "princely_musings"))
+	iq.SetToJID(nodeJID)
+	x.ProcessStanza(iq, stm)
+
+	elem = stm.ReceiveElement()
+	require.Equal(t, xmpp.ErrServiceUnavailable.Error(), elem.Error().Elements().All()[0].Name())
+
+	// unsupported request
+	x.ProcessStanza(pubSubIQ(stm, xmpp.SetType, pubSubNamespace, xmpp.NewElementName("options")), stm)
+	elem = stm.ReceiveElement()
+	require.Equal(t, xmpp.ErrFeatureNotImplemented.Error(), elem.Error().Elements().All()[0].Name())
+
+	// missing node identifier
+	x.ProcessStanza(pubSubIQ(stm, xmpp.GetType, pubSubNamespace, xmpp.NewElementName("items")), stm)
+	elem = stm.ReceiveElement()
+	require.Equal(t, xmpp.ErrBadRequest.Error(), elem.Error().Elements().All()[0].Name())
+	require.NotNil(t, elem.Error().Elements().ChildNamespace("nodeid-required", pubSubErrorsNamespace))
+
+	// unknown node
+	x.ProcessStanza(pubSubIQ(stm, xmpp.GetType, pubSubNamespace, nodeElement("items", "princely_musings")), stm)
+	elem = stm.ReceiveElement()
+	require.Equal(t, xmpp.ErrItemNotFound.Error(), elem.Error().Elements().All()[0].Name())
+}
+
+func TestPubSub_CreateNode(t *testing.T) {
+	r, _, shutdown := setupTest("jackal.im")
+	defer shutdown()
+
+	stm := setupUser(t, r, "ortuman")
+
+	x, shutdownCh := New(&Config{Host: "pubsub.jackal.im", MaxItems: 10}, nil, r)
+	defer shutdownPubSub(shutdownCh)
+
+	createNode(t, x, stm, "princely_musings")
+
+	n, err := storage.FetchPubSubNode("pubsub.jackal.im", "princely_musings")
+	require.Nil(t, err)
+	require.NotNil(t, n)
+	require.Equal(t, pubsubmodel.AffiliationOwner, n.Affiliation("ortuman@jackal.im"))
+	require.Equal(t, defaultNodeOptions(10), n.Options)
+
+	// node already exists
+	x.ProcessStanza(pubSubIQ(stm, xmpp.SetType, pubSubNamespace, nodeElement("create", "princely_musings")), stm)
+	elem := stm.ReceiveElement()
+	require.Equal(t, xmpp.ErrConflict.Error(), elem.Error().Elements().All()[0].Name())
+
+	// instant node
+	x.ProcessStanza(pubSubIQ(stm, xmpp.SetType, pubSubNamespace, xmpp.NewElementName("create")), stm)
+	elem = stm.ReceiveElement()
+	require.Equal(t, xmpp.ResultType, elem.Type())
+	create := elem.Elements().ChildNamespace("pubsub", pubSubNamespace).Elements().Child("create")
+	require.NotNil(t, create)
+	instantName := create.Attributes().Get("node")
+	require.NotEmpty(t, instantName)
+
+	n, _ = storage.FetchPubSubNode("pubsub.jackal.im", instantName)
+	require.NotNil(t, n)
+
+	// create and configure
+	form := ConfigForm(&pubsubmodel.Options{})
+	form.Type = xep0004.Submit
+	form.Fields = []xep0004.Field{
+		{Var: formTypeField, Values: []string{pubSubNodeConfigNamespace}},
+		{Var: accessModelField, Values: []string{pubsubmodel.AccessModelWhitelist}},
+		{Var: maxItemsField, Values: []string{"5"}},
+	}
+	configure := xmpp.NewElementName("configure")
+	configure.AppendElement(form.Element())
+
+	iq := pubSubIQ(stm, xmpp.SetType, pubSubNamespace, nodeElement("create", "secret_musings"))
+	iq.Elements().ChildNamespace("pubsub", pubSubNamespace).(*xmpp.Element).AppendElement(configure)
+	x.ProcessStanza(iq, stm)
+	elem = stm.ReceiveElement()
+	require.Equal(t, xmpp.ResultType, elem.Type())
+
+	n, _ = storage.FetchPubSubNode("pubsub.jackal.im", "secret_musings")
+	require.NotNil(t, n)
+	require.Equal(t, pubsubmodel.AccessModelWhitelist, n.Options.AccessModel)
+	require.Equal(t, 5, n.Options.MaxItems)
+
+	// invalid configuration
+	form.Fields[1].Values = []string{"authorize"}
+	configure = xmpp.NewElementName("configure")
+	configure.AppendElement(form.Element())
+
+	iq = pubSubIQ(stm, xmpp.SetType, pubSubNamespace, nodeElement("create", "other_musings"))
+	iq.Elements().ChildNamespace("pubsub", pubSubNamespace).(*xmpp.Element).AppendElement(configure)
+	x.ProcessStanza(iq, stm)
+	elem = stm.ReceiveElement()
+	require.Equal(t, xmpp.ErrNotAcceptable.Error(), elem.Error().Elements().All()[0].Name())
+
+	// remote entities can't create nodes
+	remoteJID, _ := jid.New("romeo", "montague.lit", "garden", true)
+	iq = pubSubIQ(stm, xmpp.SetType, pubSubNamespace, nodeElement("create", "remote_musings"))
+	iq.SetFromJID(remoteJID)
+	x.ProcessStanza(iq, stm)
+
+	syncPubSub(x)
+	n, _ = storage.FetchPubSubNode("pubsub.jackal.im", "remote_musings")
+	require.Nil(t, n)
+}
+
+func TestPubSub_ConfigureNode(t *testing.T) {
+	r, _, shutdown := setupTest("jackal.im")
+	defer shutdown()
+
+	stm1 := setupUser(t, r, "ortuman")
+	stm2 := setupUser(t, r, "noelia")
+
+	x, shutdownCh := New(&Config{Host: "pubsub.jackal.im", MaxItems: 10}, nil, r)
+	defer shutdownPubSub(shutdownCh)
+
+	createNode(t, x, stm1, "princely_musings")
+	subscribe(t, x, stm2, "princely_musings")
+
+	// default configuration
+	x.ProcessStanza(pubSubIQ(stm1, xmpp.GetType, pubSubOwnerNamespace, xmpp.NewElementName("default")), stm1)
+	elem := stm1.ReceiveElement()
+	require.Equal(t, xmpp.ResultType, elem.Type())
+	require.NotNil(t, elem.Elements().ChildNamespace("pubsub", pubSubOwnerNamespace).Elements().Child("default"))
+
+	// only owners can configure a node
+	x.ProcessStanza(pubSubIQ(stm2, xmpp.GetType, pubSubOwnerNamespace, nodeElement("configure", "princely_musings")), stm2)
+	elem = stm2.ReceiveElement()
+	require.Equal(t, xmpp.ErrForbidden.Error(), elem.Error().Elements().All()[0].Name())
+
+	x.ProcessStanza(pubSubIQ(stm1, xmpp.GetType, pubSubOwnerNamespace, nodeElement("configure", "princely_musings")), stm1)
+	elem = stm1.ReceiveElement()
+	require.Equal(t, xmpp.ResultType, elem.Type())
+	configure := elem.Elements().ChildNamespace("pubsub", pubSubOwnerNamespace).Elements().Child("configure")
+	require.NotNil(t, configure)
+
+	form, err := xep0004.NewFormFromElement(configure.Elements().ChildNamespace("x", formNamespace))
+	require.Nil(t, err)
+	require.Equal(t, xep0004.Form, form.Type)
+
+	form.Type = xep0004.Submit
+	setFormValue(form, titleField, "Princely Musings (Atom)")
+	setFormValue(form, notifyConfigField, "1")
+	x.ProcessStanza(configureIQ(stm1, "princely_musings", form), stm1)
+
+	elem = stm1.ReceiveElement()
+	require.Equal(t, xmpp.ResultType, elem.Type())
+
+	// subscriber gets notified about configuration changes
+	elem = stm2.ReceiveElement()
+	require.Equal(t, "message", elem.Name())
+	require.Equal(t, "pubsub.jackal.im", elem.From())
+	ev := elem.Elements().ChildNamespace("event", pubSubEventNamespace)
+	require.NotNil(t, ev)
+	require.NotNil(t, ev.Elements().Child("configuration"))
+
+	n, _ := storage.FetchPubSubNode("pubsub.jackal.im", "princely_musings")
+	require.Equal(t, "Princely Musings (Atom)", n.Options.Title)
+
+	// invalid value
+	setFormValue(form, maxItemsField, "-1")
+	x.ProcessStanza(configureIQ(stm1, "princely_musings", form), stm1)
+	elem = stm1.ReceiveElement()
+	require.Equal(t, xmpp.ErrNotAcceptable.Error(), elem.Error().Elements().All()[0].Name())
+
+	// cancel
+	form.Type = xep0004.Cancel
+	x.ProcessStanza(configureIQ(stm1, "princely_musings", form), stm1)
+	elem = stm1.ReceiveElement()
+	require.Equal(t, xmpp.ResultType, elem.Type())
+}
+
+func TestPubSub_PublishAndRetract(t *testing.T) {
+	r, _, shutdown := setupTest("jackal.im")
+	defer shutdown()
+
+	stm1 := setupUser(t, r, "ortuman")
+	stm2 := setupUser(t, r, "noelia")
+
+	x, shutdownCh := New(&Config{Host: "pubsub.jackal.im", MaxItems: 2}, nil, r)
+	defer shutdownPubSub(shutdownCh)
+
+	createNode(t, x, stm1, "princely_musings")
+	subscribe(t, x, stm2, "princely_musings")
+
+	// only publishers can publish
+	x.ProcessStanza(publishIQ(stm2, "princely_musings", "i1", "To be, or not to be"), stm2)
+	elem := stm2.ReceiveElement()
+	require.Equal(t, xmpp.ErrForbidden.Error(), elem.Error().Elements().All()[0].Name())
+
+	// payload required
+	publish := nodeElement("publish", "princely_musings")
+	publish.AppendElement(xmpp.NewElementName("item"))
+	x.ProcessStanza(pubSubIQ(stm1, xmpp.SetType, pubSubNamespace, publish), stm1)
+	elem = stm1.ReceiveElement()
+	require.Equal(t, xmpp.ErrBadRequest.Error(), elem.Error().Elements().All()[0].Name())
+	require.NotNil(t, elem.Error().Elements().ChildNamespace("payload-required", pubSubErrorsNamespace))
+
+	for i, body := range []string{"To be", "or not", "to be"} {
+		itemID := []string{"i1", "i2", "i3"}[i]
+		x.ProcessStanza(publishIQ(stm1, "princely_musings", itemID, body), stm1)
+
+		elem = stm1.ReceiveElement()
+		require.Equal(t, xmpp.ResultType, elem.Type())
+		item := elem.Elements().ChildNamespace("pubsub", pubSubNamespace).Elements().Child("publish").Elements().Child("item")
+		require.Equal(t, itemID, item.Attributes().Get("id"))
+
+		// subscriber gets notified
+		elem = stm2.ReceiveElement()
+		require.Equal(t, xmpp.HeadlineType, elem.Type())
+		items := elem.Elements().ChildNamespace("event", pubSubEventNamespace).Elements().Child("items")
+		require.Equal(t, "princely_musings", items.Attributes().Get("node"))
+		item = items.Elements().Child("item")
+		require.Equal(t, itemID, item.Attributes().Get("id"))
+		require.Equal(t, body, item.Elements().Child("entry").Text())
+	}
+	// oldest item was trimmed
+	items, _ := storage.FetchPubSubItems("pubsub.jackal.im", "princely_musings")
+	require.Equal(t, 2, len(items))
+	require.Equal(t, "i2", items[0].ID)
+	require.Equal(t, "i3", items[1].ID)
+
+	// retrieve items
+	x.ProcessStanza(pubSubIQ(stm2, xmpp.GetType, pubSubNamespace, nodeElement("items", "princely_musings")), stm2)
+	elem = stm2.ReceiveElement()
+	require.Equal(t, xmpp.ResultType, elem.Type())
+	require.Equal(t, 2, len(elem.Elements().ChildNamespace("pubsub", pubSubNamespace).Elements().Child("items").Elements().Children("item")))
+
+	itemsReq := nodeElement("items", "princely_musings")
+	itemsReq.SetAttribute("max_items", "1")
+	x.ProcessStanza(pubSubIQ(stm2, xmpp.GetType, pubSubNamespace, itemsReq), stm2)
+	elem = stm2.ReceiveElement()
+	itemEls := elem.Elements().ChildNamespace("pubsub", pubSubNamespace).Elements().Child("items").Elements().Children("item")
+	require.Equal(t, 1, len(itemEls))
+	require.Equal(t, "i3", itemEls[0].Attributes().Get("id"))
+
+	// subscribers can't retract items
+	retract := nodeElement("retract", "princely_musings")
+	retract.AppendElement(xmpp.NewElementName("item").SetAttribute("id", "i2"))
+	x.ProcessStanza(pubSubIQ(stm2, xmpp.SetType, pubSubNamespace, retract), stm2)
+	elem = stm2.ReceiveElement()
+	require.Equal(t, xmpp.ErrForbidden.Error(), elem.Error().Elements().All()[0].Name())
+
+	x.ProcessStanza(pubSubIQ(stm1, xmpp.SetType, pubSubNamespace, retract), stm1)
+	elem = stm1.ReceiveElement()
+	require.Equal(t, xmpp.ResultType, elem.Type())
+
+	elem = stm2.ReceiveElement()
+	retracted := elem.Elements().ChildNamespace("event", pubSubEventNamespace).Elements().Child("items").Elements().Child("retract")
+	require.NotNil(t, retracted)
+	require.Equal(t, "i2", retracted.Attributes().Get("id"))
+
+	// unknown item
+	x.ProcessStanza(pubSubIQ(stm1, xmpp.SetType, pubSubNamespace, retract), stm1)
+	elem = stm1.ReceiveElement()
+	require.Equal(t, xmpp.ErrItemNotFound.Error(), elem.Error().Elements().All()[0].Name())
+}
+
+func TestPubSub_Subscriptions(t *testing.T) {
+	r, _, shutdown := setupTest("jackal.im")
+	defer shutdown()
+
+	stm1 := setupUser(t, r, "ortuman")
+	stm2 := setupUser(t, r, "noelia")
+
+	x, shutdownCh := New(&Config{Host: "pubsub.jackal.im", MaxItems: 10}, nil, r)
+	defer shutdownPubSub(shutdownCh)
+
+	createNode(t, x, stm1, "princely_musings")
+
+	x.ProcessStanza(publishIQ(stm1, "princely_musings", "i1", "To be, or not to be"), stm1)
+	_ = stm1.ReceiveElement()
+
+	// subscribing a different entity
+	sub := nodeElement("subscribe", "princely_musings")
+	sub.SetAttribute("jid", stm1.JID().ToBareJID().String())
+	x.ProcessStanza(pubSubIQ(stm2, xmpp.SetType, pubSubNamespace, sub), stm2)
+	elem := stm2.ReceiveElement()
+	require.Equal(t, xmpp.ErrBadRequest.Error(), elem.Error().Elements().All()[0].Name())
+	require.NotNil(t, elem.Error().Elements().ChildNamespace("invalid-jid", pubSubErrorsNamespace))
+
+	sub.SetAttribute("jid", stm2.JID().ToBareJID().String())
+	x.ProcessStanza(pubSubIQ(stm2, xmpp.SetType, pubSubNamespace, sub), stm2)
+	elem = stm2.ReceiveElement()
+	require.Equal(t, xmpp.ResultType, elem.Type())
+	subEl := elem.Elements().ChildNamespace("pubsub", pubSubNamespace).Elements().Child("subscription")
+	require.Equal(t, pubsubmodel.SubscriptionSubscribed, subEl.Attributes().Get("subscription"))
+
+	// last published item
+	elem = stm2.ReceiveElement()
+	require.Equal(t, "message", elem.Name())
+	item := elem.Elements().ChildNamespace("event", pubSubEventNamespace).Elements().Child("items").Elements().Child("item")
+	require.Equal(t, "i1", item.Attributes().Get("id"))
+
+	// entity subscriptions and affiliations
+	x.ProcessStanza(pubSubIQ(stm2, xmpp.GetType, pubSubNamespace, xmpp.NewElementName("subscriptions")), stm2)
+	elem = stm2.ReceiveElement()
+	subs := elem.Elements().ChildNamespace("pubsub", pubSubNamespace).Elements().Child("subscriptions").Elements().Children("subscription")
+	require.Equal(t, 1, len(subs))
+	require.Equal(t, "princely_musings", subs[0].Attributes().Get("node"))
+
+	x.ProcessStanza(pubSubIQ(stm1, xmpp.GetType, pubSubNamespace, xmpp.NewElementName("affiliations")), stm1)
+	elem = stm1.ReceiveElement()
+	affs := elem.Elements().ChildNamespace("pubsub", pubSubNamespace).Elements().Child("affiliations").Elements().Children("affiliation")
+	require.Equal(t, 1, len(affs))
+	require.Equal(t, pubsubmodel.AffiliationOwner, affs[0].Attributes().Get("affiliation"))
+
+	// owner view
+	x.ProcessStanza(pubSubIQ(stm1, xmpp.GetType, pubSubOwnerNamespace, nodeElement("subscriptions", "princely_musings")), stm1)
+	elem = stm1.ReceiveElement()
+	subs = elem.Elements().ChildNamespace("pubsub", pubSubOwnerNamespace).Elements().Child("subscriptions").Elements().Children("subscription")
+	require.Equal(t, 1, len(subs))
+	require.Equal(t, "noelia@jackal.im", subs[0].Attributes().Get("jid"))
+
+	// unsubscribe
+	unsub := nodeElement("unsubscribe", "princely_musings")
+	unsub.SetAttribute("jid", stm2.JID().ToBareJID().String())
+	x.ProcessStanza(pubSubIQ(stm2, xmpp.SetType, pubSubNamespace, unsub), stm2)
+	elem = stm2.ReceiveElement()
+	require.Equal(t, xmpp.ResultType, elem.Type())
+
+	x.ProcessStanza(pubSubIQ(stm2, xmpp.SetType, pubSubNamespace, unsub), stm2)
+	elem = stm2.ReceiveElement()
+	require.Equal(t, xmpp.ErrUnexpectedCondition.Error(), elem.Error().Elements().All()[0].Name())
+	require.NotNil(t, elem.Error().Elements().ChildNamespace("not-subscribed", pubSubErrorsNamespace))
+
+	// owner subscribes an entity
+	subscriptions := nodeElement("subscriptions", "princely_musings")
+	subscriptions.AppendElement(xmpp.NewElementName("subscription").
+		SetAttribute("jid", "noelia@jackal.im").
+		SetAttribute("subscription", pubsubmodel.SubscriptionSubscribed))
+	x.ProcessStanza(pubSubIQ(stm1, xmpp.SetType, pubSubOwnerNamespace, subscriptions), stm1)
+	elem = stm1.ReceiveElement()
+	require.Equal(t, xmpp.ResultType, elem.Type())
+
+	n, _ := storage.FetchPubSubNode("pubsub.jackal.im", "princely_musings")
+	require.Equal(t, pubsubmodel.SubscriptionSubscribed, n.Subscription("noelia@jackal.im"))
+}
+
+func TestPubSub_AccessModels(t *testing.T) {
+	r, _, shutdown := setupTest("jackal.im")
+	defer shutdown()
+
+	stm1 := setupUser(t, r, "ortuman")
+	stm2 := setupUser(t, r, "noelia")
+
+	x, shutdownCh := New(&Config{Host: "pubsub.jackal.im", MaxItems: 10}, nil, r)
+	defer shutdownPubSub(shutdownCh)
+
+	createNode(t, x, stm1, "princely_musings")
+
+	itemsReq := nodeElement("items", "princely_musings")
+
+	// presence
+	setAccessModel(t, x, stm1, "princely_musings", pubsubmodel.AccessModelPresence)
+
+	x.ProcessStanza(pubSubIQ(stm2, xmpp.GetType, pubSubNamespace, itemsReq), stm2)
+	elem := stm2.ReceiveElement()
+	require.Equal(t, xmpp.ErrNotAuthorized.Error(), elem.Error().Elements().All()[0].Name())
+	require.NotNil(t, elem.Error().Elements().ChildNamespace("presence-subscription-required", pubSubErrorsNamespace))
+
+	_, err := storage.InsertOrUpdateRosterItem(&rostermodel.Item{
+		Username:     "ortuman",
+		JID:          "noelia@jackal.im",
+		Subscription: rostermodel.SubscriptionFrom,
+		Groups:       []string{"friends"},
+	})
+	require.Nil(t, err)
+
+	x.ProcessStanza(pubSubIQ(stm2, xmpp.GetType, pubSubNamespace, itemsReq), stm2)
+	elem = stm2.ReceiveElement()
+	require.Equal(t, xmpp.ResultType, elem.Type())
+
+	// roster
+	setAccessModel(t, x, stm1, "princely_musings", pubsubmodel.AccessModelRoster)
+
+	x.ProcessStanza(pubSubIQ(stm2, xmpp.GetType, pubSubNamespace, itemsReq), stm2)
+	elem = stm2.ReceiveElement()
+	require.NotNil(t, elem.Error().Elements().ChildNamespace("not-in-roster-group", pubSubErrorsNamespace))
+
+	n, _ := storage.FetchPubSubNode("pubsub.jackal.im", "princely_musings")
+	n.Options.RosterGroupsAllowed = []string{"friends"}
+	require.Nil(t, storage.InsertOrUpdatePubSubNode(n))
+
+	x.ProcessStanza(pubSubIQ(stm2, xmpp.GetType, pubSubNamespace, itemsReq), stm2)
+	elem = stm2.ReceiveElement()
+	require.Equal(t, xmpp.ResultType, elem.Type())
+
+	// whitelist
+	setAccessModel(t, x, stm1, "princely_musings", pubsubmodel.AccessModelWhitelist)
+
+	x.ProcessStanza(pubSubIQ(stm2, xmpp.GetType, pubSubNamespace, itemsReq), stm2)
+	elem = stm2.ReceiveElement()
+	require.Equal(t, xmpp.ErrNotAllowed.Error(), elem.Error().Elements().All()[0].Name())
+	require.NotNil(t, elem.Error().Elements().ChildNamespace("closed-node", pubSubErrorsNamespace))
+
+	setAffiliation(t, x, stm1, "princely_musings", "noelia@jackal.im", pubsubmodel.AffiliationMember)
+
+	x.ProcessStanza(pubSubIQ(stm2, xmpp.GetType, pubSubNamespace, itemsReq), stm2)
+	elem = stm2.ReceiveElement()
+	require.Equal(t, xmpp.ResultType, elem.Type())
+
+	// outcasts are always denied
+	setAccessModel(t, x, stm1, "princely_musings", pubsubmodel.AccessModelOpen)
+	setAffiliation(t, x, stm1, "princely_musings", "noelia@jackal.im", pubsubmodel.AffiliationOutcast)
+
+	x.ProcessStanza(pubSubIQ(stm2, xmpp.GetType, pubSubNamespace, itemsReq), stm2)
+	elem = stm2.ReceiveElement()
+	require.Equal(t, xmpp.ErrForbidden.Error(), elem.Error().Elements().All()[0].Name())
+}
+
+func TestPubSub_Affiliations(t *testing.T) {
+	r, _, shutdown := setupTest("jackal.im")
+	defer shutdown()
+
+	stm1 := setupUser(t, r, "ortuman")
+	stm2 := setupUser(t, r, "noelia")
+
+	x, shutdownCh := New(&Config{Host: "pubsub.jackal.im", MaxItems: 10}, nil, r)
+	defer shutdownPubSub(shutdownCh)
+
+	createNode(t, x, stm1, "princely_musings")
+	subscribe(t, x, stm2, "princely_musings")
+
+	setAffiliation(t, x, stm1, "princely_musings", "noelia@jackal.im", pubsubmodel.AffiliationPublisher)
+
+	x.ProcessStanza(pubSubIQ(stm1, xmpp.GetType, pubSubOwnerNamespace, nodeElement("affiliations", "princely_musings")), stm1)
+	elem := stm1.ReceiveElement()
+	affs := elem.Elements().ChildNamespace("pubsub", pubSubOwnerNamespace).Elements().Child("affiliations").Elements().Children("affiliation")
+	require.Equal(t, 2, len(affs))
+	require.Equal(t, "noelia@jackal.im", affs[0].Attributes().Get("jid"))
+	require.Equal(t, pubsubmodel.AffiliationPublisher, affs[0].Attributes().Get("affiliation"))
+	require.Equal(t, "ortuman@jackal.im", affs[1].Attributes().Get("jid"))
+
+	// publishers can publish
+	x.ProcessStanza(publishIQ(stm2, "princely_musings", "i1", "To be, or not to be"), stm2)
+	elem = stm2.ReceiveElement()
+	require.Equal(t, xmpp.ResultType, elem.Type())
+	elem = stm2.ReceiveElement()
+	require.Equal(t, "message", elem.Name())
+
+	// node can't be left without owners
+	affiliations := nodeElement("affiliations", "princely_musings")
+	affiliations.AppendElement(xmpp.NewElementName("affiliation").
+		SetAttribute("jid", "ortuman@jackal.im").
+		SetAttribute("affiliation", pubsubmodel.AffiliationNone))
+	x.ProcessStanza(pubSubIQ(stm1, xmpp.SetType, pubSubOwnerNamespace, affiliations), stm1)
+	elem = stm1.ReceiveElement()
+	require.Equal(t, xmpp.ErrNotAcceptable.Error(), elem.Error().Elements().All()[0].Name())
+
+	// unknown affiliation
+	affiliations = nodeElement("affiliations", "princely_musings")
+	affiliations.AppendElement(xmpp.NewElementName("affiliation").
+		SetAttribute("jid", "noelia@jackal.im").
+		SetAttribute("affiliation", "king"))
+	x.ProcessStanza(pubSubIQ(stm1, xmpp.SetType, pubSubOwnerNamespace, affiliations), stm1)
+	elem = stm1.ReceiveElement()
+	require.Equal(t, xmpp.ErrBadRequest.Error(), elem.Error().Elements().All()[0].Name())
+
+	// outcasts lose their subscriptions
+	setAffiliation(t, x, stm1, "princely_musings", "noelia@jackal.im", pubsubmodel.AffiliationOutcast)
+
+	n, _ := storage.FetchPubSubNode("pubsub.jackal.im", "princely_musings")
+	require.Equal(t, pubsubmodel.SubscriptionNone, n.Subscription("noelia@jackal.im"))
+	require.Equal(t, pubsubmodel.AffiliationOwner, n.Affiliation("ortuman@jackal.im"))
+}
+
+func TestPubSub_PurgeAndDeleteNode(t *testing.T) {
+	r, _, shutdown := setupTest("jackal.im")
+	defer shutdown()
+
+	stm1 := setupUser(t, r, "ortuman")
+	stm2 := setupUser(t, r, "noelia")
+
+	x, shutdownCh := New(&Config{Host: "pubsub.jackal.im", MaxItems: 10}, nil, r)
+	defer shutdownPubSub(shutdownCh)
+
+	createNode(t, x, stm1, "princely_musings")
+	subscribe(t, x, stm2, "princely_musings")
+
+	x.ProcessStanza(publishIQ(stm1, "princely_musings", "i1", "To be, or not to be"), stm1)
+	_ = stm1.ReceiveElement()
+	_ = stm2.ReceiveElement()
+
+	// only owners can purge and delete nodes
+	x.ProcessStanza(pubSubIQ(stm2, xmpp.SetType, pubSubOwnerNamespace, nodeElement("purge", "princely_musings")), stm2)
+	elem := stm2.ReceiveElement()
+	require.Equal(t, xmpp.ErrForbidden.Error(), elem.Error().Elements().All()[0].Name())
+
+	x.ProcessStanza(pubSubIQ(stm1, xmpp.SetType, pubSubOwnerNamespace, nodeElement("purge", "princely_musings")), stm1)
+	elem = stm1.ReceiveElement()
+	require.Equal(t, xmpp.ResultType, elem.Type())
+
+	elem = stm2.ReceiveElement()
+	require.NotNil(t, elem.Elements().ChildNamespace("event", pubSubEventNamespace).Elements().Child("purge"))
+
+	items, _ := storage.FetchPubSubItems("pubsub.jackal.im", "princely_musings")
+	require.Equal(t, 0, len(items))
+
+	x.ProcessStanza(pubSubIQ(stm1, xmpp.SetType, pubSubOwnerNamespace, nodeElement("delete", "princely_musings")), stm1)
+	elem = stm1.ReceiveElement()
+	require.Equal(t, xmpp.ResultType, elem.Type())
+
+	elem = stm2.ReceiveElement()
+	require.NotNil(t, elem.Elements().ChildNamespace("event", pubSubEventNamespace).Elements().Child("delete"))
+
+	n, _ := storage.FetchPubSubNode("pubsub.jackal.im", "princely_musings")
+	require.Nil(t, n)
+}
+
+func setupTest(domain string) (*router.Router, *memstorage.Storage, func()) {
+	r, _ := router.New(&router.Config{
+		Hosts: []router.HostConfig{{Name: domain, Certificate: tls.Certificate{}}},
+	})
+	s := memstorage.New()
+	storage.Set(s)
+	return r, s, func() {
+		storage.Unset()
+	}
+}
+
+func setupUser(t *testing.T, r *router.Router, username string) *stream.MockC2S {
+	require.Nil(t, storage.InsertOrUpdateUser(&model.User{Username: username, Password: "plain"}))
+
+	j, _ := jid.New(username, "jackal.im", "balcony", true)
+	stm := stream.NewMockC2S(uuid.New(), j)
+	stm.SetPresence(xmpp.NewPresence(j, j, xmpp.AvailableType))
+	r.Bind(stm)
+	return stm
+}
+
+func shutdownPubSub(shutdownCh chan<- chan bool) {
+	c := make(chan bool, 1)
+	shutdownCh <- c
+	<-c
+}
+
+// syncPubSub waits until every previously enqueued stanza has been processed.
+func syncPubSub(x *PubSub) {
+	c := make(chan struct{})
+	x.runQueue.Run(func() { close(c) })
+	<-c
+}
+
+func createNode(t *testing.T, x *PubSub, stm *stream.MockC2S, node string) {
+	x.ProcessStanza(pubSubIQ(stm, xmpp.SetType, pubSubNamespace, nodeElement("create", node)), stm)
+	elem := stm.ReceiveElement()
+	require.Equal(t, xmpp.ResultType, elem.Type())
+}
+
+func subscribe(t *testing.T, x *PubSub, stm *stream.MockC2S, node string) {
+	sub := nodeElement("subscribe", node)
+	sub.SetAttribute("jid", stm.JID().ToBareJID().String())
+	x.ProcessStanza(pubSubIQ(stm, xmpp.SetType, pubSubNamespace, sub), stm)
+	elem := stm.ReceiveElement()
+	require.Equal(t, xmpp.ResultType, elem.Type())
+}
+
+func setAccessModel(t *testing.T, x *PubSub, stm *stream.MockC2S, node, accessModel string) {
+	form := &xep0004.DataForm{
+		Type: xep0004.Submit,
+		Fields: []xep0004.Field{
+			{Var: formTypeField, Values: []string{pubSubNodeConfigNamespace}},
+			{Var: accessModelField, Values: []string{accessModel}},
+		},
+	}
+	x.ProcessStanza(configureIQ(stm, node, form), stm)
+	elem := stm.ReceiveElement()
+	require.Equal(t, xmpp.ResultType, elem.Type())
+}
+
+func setAffiliation(t *testing.T, x *PubSub, stm *stream.MockC2S, node, affJID, affiliation string) {
+	affiliations := nodeElement("affiliations", node)
+	affiliations.AppendElement(xmpp.NewElementName("affiliation").
+		SetAttribute("jid", affJID).
+		SetAttribute("affiliation", affiliation))
+	x.ProcessStanza(pubSubIQ(stm, xmpp.SetType, pubSubOwnerNamespace, affiliations), stm)
+	elem := stm.ReceiveElement()
+	require.Equal(t, xmpp.ResultType, elem.Type())
+}
+
+func pubSubIQ(stm *stream.MockC2S, iqType, namespace string, cmd xmpp.XElement) *xmpp.IQ {
+	serviceJID, _ := jid.NewWithString("pubsub.jackal.im", true)
+	iq := xmpp.NewIQType(uuid.New(), iqType)
+	iq.SetFromJID(stm.JID())
+	iq.SetToJID(serviceJID)
+
+	ps := xmpp.NewElementNamespace("pubsub", namespace)
+	ps.AppendElement(cmd)
+	iq.AppendElement(ps)
+	return iq
+}
+
+func publishIQ(stm *stream.MockC2S, node, itemID, body string) *xmpp.IQ {
+	entry := xmpp.NewElementNamespace("entry", "http://www.w3.org/2005/Atom")
+	entry.SetText(body)
+
+	item := xmpp.NewElementName("item")
+	item.SetAttribute("id", itemID)
+	item.AppendElement(entry)
+
+	publish := nodeElement("publish", node)
+	publish.AppendElement(item)
+	return pubSubIQ(stm, xmpp.SetType, pubSubNamespace, publish)
+}
+
+func configureIQ(stm *stream.MockC2S, node string, form *xep0004.DataForm) *xmpp.IQ {
+	configure := nodeElement("configure", node)
+	configure.AppendElement(form.Element())
+	return pubSubIQ(stm, xmpp.SetType, pubSubOwnerNamespace, configure)
+}
@@ -0,0 +1,97 @@
+/*
+ * Copyright (c) 2018 Miguel Ángel Ortuño.
+ * See the LICENSE file for more information.
+ */
+
+package xep0114
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/ortuman/jackal/transport"
+	"github.com/pkg/errors"
+)
+
+const (
+	defaultTransportPort      = 5275
+	defaultTransportKeepAlive = time.Duration(120) * time.Second
+	defaultConnectTimeout     = time.Duration(5) * time.Second
+	defaultMaxStanzaSize      = 65536
+)
+
+// ComponentConfig represents an external component configuration.
+type ComponentConfig struct {
+	Host   string `yaml:"host"`
+	Name   string `yaml:"name"`
+	Secret string `yaml:"secret"`
+}
+
+// Config represents external component listener configuration.
+type Config struct {
+	BindAddress    string
+	Port           int
+	KeepAlive      time.Duration
+	ConnectTimeout time.Duration
+	MaxStanzaSize  int
+	Components     map[string]ComponentConfig
+}
+
+type configProxy struct {
+	BindAddress    string            `yaml:"bind_addr"`
+	Port           int               `yaml:"port"`
+	KeepAlive      int               `yaml:"keep_alive"`
+	ConnectTimeout int               `yaml:"connect_timeout"`
+	MaxStanzaSize  int               `yaml:"max_stanza_size"`
+	Components     []ComponentConfig `yaml:"components"`
+}
+
+// UnmarshalYAML satisfies Unmarshaler interface.
+func (c *Config) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	p := configProxy{}
+	if err := unmarshal(&p); err != nil {
+		return err
+	}
+	c.BindAddress = p.BindAddress
+	c.Port = p.Port
+	if c.Port == 0 {
+		c.Port = defaultTransportPort
+	}
+	c.KeepAlive = time.Duration(p.KeepAlive) * time.Second
+	if c.KeepAlive == 0 {
+		c.KeepAlive = defaultTransportKeepAlive
+	}
+	c.ConnectTimeout = time.Duration(p.ConnectTimeout) * time.Second
+	if c.ConnectTimeout == 0 {
+		c.ConnectTimeout = defaultConnectTimeout
+	}
+	c.MaxStanzaSize = p.MaxStanzaSize
+	if c.MaxStanzaSize == 0 {
+		c.MaxStanzaSize = defaultMaxStanzaSize
+	}
+	if len(p.Components) == 0 {
+		return errors.New("xep0114.Config: at least one component must be specified")
+	}
+	c.Components = make(map[string]ComponentConfig)
+	for _, comp := range p.Components {
+		if len(comp.Host) == 0 {
+			return errors.New("xep0114.Config: component host must be specified")
+		}
+		if len(comp.Secret) == 0 {
+			return fmt.Errorf("xep0114.Config: must specify a secret for component %s", comp.Host)
+		}
+		if _, ok := c.Components[comp.Host]; ok {
+			return fmt.Errorf("xep0114.Config: duplicated component host: %s", comp.Host)
+		}
+		c.Components[comp.Host] = comp
+	}
+	return nil
+}
+
+type streamConfig struct {
+	components     map[string]ComponentConfig
+	connectTimeout time.Duration
+	maxStanzaSize  int
+	transport      transport.Transport
+	onDisconnect   func(s *inStream)
+}
@@ -0,0 +1,47 @@
+/*
+ * Copyright (c) 2018 Miguel Ángel Ortuño.
+ * See the LICENSE file for more information.
+ */
+
+package xep0114
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	yaml "gopkg.in/yaml.v2"
+)
+
+func TestConfig(t *testing.T) {
+	cfg := Config{}
+	require.NotNil(t, yaml.Unmarshal([]byte(`port: 5275`), &cfg))
+	require.NotNil(t, yaml.Unmarshal([]byte(`
+components:
+  - host: gateway.jackal.im
+`), &cfg))
+	require.NotNil(t, yaml.Unmarshal([]byte(`
+components:
+  - secret: s3cr3t
+`), &cfg))
+	require.NotNil(t, yaml.Unmarshal([]byte(`
+components:
+  - host: gateway.jackal.im
+    secret: s3cr3t
+  - host: gateway.jackal.im
+    secret: s3cr3t
+`), &cfg))
+
+	require.Nil(t, yaml.Unmarshal([]byte(`
+components:
+  - host: gateway.jackal.im
+    name: IRC gateway
+    secret: s3cr3t
+`), &cfg))
+	require.Equal(t, defaultTransportPort, cfg.Port)
+	require.Equal(t, defaultTransportKeepAlive, cfg.KeepAlive)
+	require.Equal(t, defaultConnectTimeout, cfg.ConnectTimeout)
+	require.Equal(t, defaultMaxStanzaSize, cfg.MaxStanzaSize)
+	require.Equal(t, 1, len(cfg.Components))
+	require.Equal(t, "IRC gateway", cfg.Components["gateway.jackal.im"].Name)
+	require.Equal(t, "s3cr3t", cfg.Components["gateway.jackal.im"].Secret)
+}
@@ -0,0 +1,407 @@
+/*
+ * Copyright (c) 2018 Miguel Ángel Ortuño.
+ * See the LICENSE file for more information.
+ */
+
+package xep0114
+
+import (
+	"crypto/sha1"
+	"crypto/subtle"
+	"encoding/hex"
+	stdxml "encoding/xml"
+	"io"
+	"net"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/ortuman/jackal/component"
+	streamerror "github.com/ortuman/jackal/errors"
+	"github.com/ortuman/jackal/log"
+	"github.com/ortuman/jackal/module"
+	"github.com/ortuman/jackal/module/xep0030"
+	"github.com/ortuman/jackal/router"
+	"github.com/ortuman/jackal/runqueue"
+	"github.com/ortuman/jackal/stream"
+	"github.com/ortuman/jackal/xmpp"
+	"github.com/ortuman/jackal/xmpp/jid"
+	"github.com/pborman/uuid"
+)
+
+const (
+	inConnecting uint32 = iota
+	inHandshaking
+	inAuthenticated
+	inDisconnected
+)
+
+type inStream struct {
+	id        string
+	cfg       *streamConfig
+	mods      *module.Modules
+	comps     *component.Components
+	router    *router.Router
+	parser    *xmpp.Parser
+	streamID  string
+	comp      ComponentConfig
+	state     uint32
+	opened    bool
+	connectTm *time.Timer
+	runQueue  *runqueue.RunQueue
+}
+
+func newInStream(id string, config *streamConfig, mods *module.Modules, comps *component.Components, router *router.Router) *inStream {
+	s := &inStream{
+		id:       id,
+		cfg:      config,
+		mods:     mods,
+		comps:    comps,
+		router:   router,
+		parser:   xmpp.NewParser(config.transport, xmpp.SocketStream, config.maxStanzaSize),
+		streamID: uuid.New(),
+		runQueue: runqueue.New(id),
+	}
+	if config.connectTimeout > 0 {
+		// timer is only accessed from within the run queue
+		s.runQueue.Run(func() {
+			s.connectTm = time.AfterFunc(config.connectTimeout, s.connectTimeout)
+		})
+	}
+	go s.doRead() // start reading transport...
+	return s
+}
+
+// ID returns stream identifier.
+func (s *inStream) ID() string {
+	return s.id
+}
+
+// Host returns external component host name.
+func (s *inStream) Host() string {
+	return s.comp.Host
+}
+
+// ProcessStanza sends a stanza addressed to the external component over the stream.
+func (s *inStream) ProcessStanza(stanza xmpp.Stanza, _ stream.C2S) {
+	s.runQueue.Run(func() {
+		if s.getState() != inAuthenticated {
+			return
+		}
+		s.writeElement(stanza)
+	})
+}
+
+// Disconnect disconnects external component stream.
+func (s *inStream) Disconnect(err error) {
+	if s.getState() == inDisconnected {
+		return
+	}
+	waitCh := make(chan struct{})
+	s.runQueue.Run(func() {
+		s.disconnect(err)
+		close(waitCh)
+	})
+	<-waitCh
+}
+
+func (s *inStream) connectTimeout() {
+	s.runQueue.Run(func() { s.disconnect(streamerror.ErrConnectionTimeout) })
+}
+
+// runs on its own goroutine
+func (s *inStream) doRead() {
+	elem, err := s.parser.ParseElement()
+	s.runQueue.Run(func() {
+		if s.getState() == inDisconnected {
+			return // already disconnected...
+		}
+		if err != nil {
+			s.handleReadError(err)
+			return
+		}
+		if elem != nil {
+			log.Debugf("RECV(%s): %v", s.id, elem)
+			s.handleElement(elem)
+		}
+		if s.getState() != inDisconnected {
+			go s.doRead()
+		}
+	})
+}
+
+func (s *inStream) handleElement(elem xmpp.XElement) {
+	switch s.getState() {
+	case inConnecting:
+		s.handleConnecting(elem)
+	case inHandshaking:
+		s.handleHandshaking(elem)
+	case inAuthenticated:
+		s.handleAuthenticated(elem)
+	}
+}
+
+func (s *inStream) handleConnecting(elem xmpp.XElement) {
+	if elem.Name() != "stream:stream" {
+		s.disconnectWithStreamError(streamerror.ErrUnsupportedStanzaType)
+		return
+	}
+	if elem.Namespace() != componentAcceptNamespace || elem.Attributes().Get("xmlns:stream") != streamNamespace {
+		s.disconnectWithStreamError(streamerror.ErrInvalidNamespace)
+		return
+	}
+	comp, ok := s.cfg.components[elem.To()]
+	if !ok {
+		s.disconnectWithStreamError(streamerror.ErrHostUnknown)
+		return
+	}
+	s.comp = comp
+	s.openStream()
+	s.setState(inHandshaking)
+}
+
+func (s *inStream) handleHandshaking(elem xmpp.XElement) {
+	if elem.Name() != "handshake" {
+		s.disconnectWithStreamError(streamerror.ErrNotAuthorized)
+		return
+	}
+	h := sha1.Sum([]byte(s.streamID + s.comp.Secret))
+	digest := strings.ToLower(strings.TrimSpace(elem.Text()))
+	if subtle.ConstantTimeCompare([]byte(digest), []byte(hex.EncodeToString(h[:]))) != 1 {
+		log.Infof("component handshake failed... (host: %s)", s.comp.Host)
+		s.disconnectWithStreamError(streamerror.ErrNotAuthorized)
+		return
+	}
+	// component host can't be shared with any other local domain or component
+	if s.router.IsLocalHost(s.comp.Host) {
+		s.disconnectWithStreamError(streamerror.ErrConflict)
+		return
+	}
+	if err := s.comps.Register(s); err != nil {
+		log.Error(err)
+		s.disconnectWithStreamError(streamerror.ErrConflict)
+		return
+	}
+	if s.connectTm != nil {
+		s.connectTm.Stop()
+		s.connectTm = nil
+	}
+	if di := s.mods.DiscoInfo; di != nil {
+		di.RegisterServerItem(xep0030.Item{Jid: s.comp.Host, Name: s.comp.Name})
+	}
+	s.setState(inAuthenticated)
+	s.writeElement(xmpp.NewElementName("handshake"))
+
+	log.Infof("component authenticated... (host: %s)", s.comp.Host)
+}
+
+func (s *inStream) handleAuthenticated(elem xmpp.XElement) {
+	if !elem.IsStanza() {
+		s.disconnectWithStreamError(streamerror.ErrUnsupportedStanzaType)
+		return
+	}
+	if ns := elem.Namespace(); len(ns) > 0 && ns != componentAcceptNamespace {
+		s.disconnectWithStreamError(streamerror.ErrInvalidNamespace)
+		return
+	}
+	fromJID, err := jid.NewWithString(elem.From(), false)
+	if err != nil || fromJID.Domain() != s.comp.Host {
+		s.disconnectWithStreamError(streamerror.ErrInvalidFrom)
+		return
+	}
+	toJID, err := jid.NewWithString(elem.To(), false)
+	if err != nil || len(elem.To()) == 0 {
+		s.writeStanzaErrorResponse(elem, xmpp.ErrJidMalformed)
+		return
+	}
+	switch elem.Name() {
+	case xmpp.IQName:
+		iq, err := xmpp.NewIQFromElement(elem, fromJID, toJID)
+		if err != nil {
+			log.Error(err)
+			s.writeStanzaErrorResponse(elem, xmpp.ErrBadRequest)
+			return
+		}
+		s.processIQ(iq)
+
+	case xmpp.PresenceName:
+		presence, err := xmpp.NewPresenceFromElement(elem, fromJID, toJID)
+		if err != nil {
+			log.Error(err)
+			s.writeStanzaErrorResponse(elem, xmpp.ErrBadRequest)
+			return
+		}
+		s.processPresence(presence)
+
+	case xmpp.MessageName:
+		message, err := xmpp.NewMessageFromElement(elem, fromJID, toJID)
+		if err != nil {
+			log.Error(err)
+			s.writeStanzaErrorResponse(elem, xmpp.ErrBadRequest)
+			return
+		}
+		s.processMessage(message)
+	}
+}
+
+func (s *inStream) processPresence(presence *xmpp.Presence) {
+	// process roster presence
+	if presence.ToJID().IsBare() && s.router.IsLocalHost(presence.ToJID().Domain()) {
+		if r := s.mods.Roster; r != nil {
+			r.ProcessPresence(presence)
+		}
+		return
+	}
+	_ = s.router.Route(presence)
+}
+
+func (s *inStream) processIQ(iq *xmpp.IQ) {
+	toJID := iq.ToJID()
+
+	replyOnBehalf := !toJID.IsFullWithUser() && s.router.IsLocalHost(toJID.Domain())
+	if !replyOnBehalf {
+		switch s.router.Route(iq) {
+		case router.ErrResourceNotFound:
+			s.writeElement(iq.ServiceUnavailableError())
+		case router.ErrFailedRemoteConnect:
+			s.writeElement(iq.RemoteServerNotFoundError())
+		case router.ErrBlockedJID:
+			// Destination user is a blocked JID
+			if iq.IsGet() || iq.IsSet() {
+				s.writeElement(iq.ServiceUnavailableError())
+			}
+		}
+		return
+	}
+	s.mods.ProcessIQ(iq)
+}
+
+func (s *inStream) processMessage(message *xmpp.Message) {
+	switch s.mods.RouteMessage(message) {
+	case router.ErrNotAuthenticated, router.ErrNotExistingAccount, router.ErrBlockedJID:
+		s.writeElement(message.ServiceUnavailableError())
+	case router.ErrFailedRemoteConnect:
+		s.writeElement(message.RemoteServerNotFoundError())
+	}
+}
+
+func (s *inStream) openStream() {
+	ops := xmpp.NewElementName("stream:stream")
+	ops.SetAttribute("xmlns", componentAcceptNamespace)
+	ops.SetAttribute("xmlns:stream", streamNamespace)
+	ops.SetAttribute("from", s.comp.Host)
+	ops.SetAttribute("id", s.streamID)
+
+	buf := &strings.Builder{}
+	buf.WriteString(`<?xml version="1.0"?>`)
+	ops.ToXML(buf, false)
+	openStr := buf.String()
+
+	log.Debugf("SEND(%s): %s", s.id, openStr)
+	_, _ = io.WriteString(s.cfg.transport, openStr)
+	_ = s.cfg.transport.Flush()
+
+	s.opened = true
+}
+
+func (s *inStream) writeStanzaErrorResponse(elem xmpp.XElement, stanzaErr *xmpp.StanzaError) {
+	resp := xmpp.NewElementFromElement(elem)
+	resp.SetType(xmpp.ErrorType)
+	resp.SetFrom(elem.To())
+	resp.SetTo(elem.From())
+	resp.AppendElement(stanzaErr.Element())
+	s.writeElement(resp)
+}
+
+func (s *inStream) writeElement(elem xmpp.XElement) {
+	// stanzas are sent within component stream default namespace
+	if e, ok := elem.(interface{ SetNamespace(string) }); ok && elem.IsStanza() {
+		e.SetNamespace("")
+	}
+	log.Debugf("SEND(%s): %v", s.id, elem)
+
+	elem.ToXML(s.cfg.transport, true)
+	_ = s.cfg.transport.Flush()
+}
+
+func (s *inStream) handleReadError(err error) {
+	switch e := err.(type) {
+	case nil:
+		break
+	case net.Error:
+		if e.Timeout() {
+			s.disconnectWithStreamError(streamerror.ErrConnectionTimeout)
+			return
+		}
+		s.disconnect(nil)
+	case *stdxml.SyntaxError:
+		s.disconnectWithStreamError(streamerror.ErrInvalidXML)
+	default:
+		switch err {
+		case xmpp.ErrTooLargeStanza:
+			s.disconnectWithStreamError(streamerror.ErrPolicyViolation)
+		case xmpp.ErrStreamClosedByPeer:
+			s.disconnectClosingStream(true)
+		default:
+			s.disconnect(nil)
+		}
+	}
+}
+
+func (s *inStream) disconnect(err error) {
+	if s.getState() == inDisconnected {
+		return
+	}
+	switch err {
+	case nil:
+		s.disconnectClosingStream(false)
+	default:
+		if stmErr, ok := err.(*streamerror.Error); ok {
+			s.disconnectWithStreamError(stmErr)
+		} else {
+			log.Error(err)
+			s.disconnectClosingStream(false)
+		}
+	}
+}
+
+func (s *inStream) disconnectWithStreamError(err *streamerror.Error) {
+	if !s.opened {
+		s.openStream()
+	}
+	s.writeElement(err.Element())
+	s.disconnectClosingStream(true)
+}
+
+func (s *inStream) disconnectClosingStream(closeStream bool) {
+	if s.connectTm != nil {
+		s.connectTm.Stop()
+		s.connectTm = nil
+	}
+	if closeStream && s.opened {
+		_, _ = io.WriteString(s.cfg.transport, "</stream:stream>")
+		_ = s.cfg.transport.Flush()
+	}
+	if s.getState() == inAuthenticated {
+		s.comps.Unregister(s)
+		if di := s.mods.DiscoInfo; di != nil {
+			di.UnregisterServerItem(xep0030.Item{Jid: s.comp.Host, Name: s.comp.Name})
+		}
+		log.Infof("component disconnected... (host: %s)", s.comp.Host)
+	}
+	if s.cfg.onDisconnect != nil {
+		s.cfg.onDisconnect(s)
+	}
+	s.setState(inDisconnected)
+	_ = s.cfg.transport.Close()
+
+	s.runQueue.Stop(nil) // stop processing messages
+}
+
+func (s *inStream) setState(state uint32) {
+	atomic.StoreUint32(&s.state, state)
+}
+
+func (s *inStream) getState() uint32 {
+	return atomic.LoadUint32(&s.state)
+}
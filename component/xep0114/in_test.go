@@ -0,0 +1,278 @@
+/*
+ * Copyright (c) 2018 Miguel Ángel Ortuño.
+ * See the LICENSE file for more information.
+ */
+
+package xep0114
+
+import (
+	"context"
+	"crypto/sha1"
+	"encoding/hex"
+	"testing"
+	"time"
+
+	"github.com/ortuman/jackal/component"
+	"github.com/ortuman/jackal/model"
+	"github.com/ortuman/jackal/module"
+	"github.com/ortuman/jackal/module/offline"
+	"github.com/ortuman/jackal/module/xep0030"
+	"github.com/ortuman/jackal/router"
+	"github.com/ortuman/jackal/storage"
+	"github.com/ortuman/jackal/stream"
+	"github.com/ortuman/jackal/transport"
+	"github.com/ortuman/jackal/xmpp"
+	"github.com/ortuman/jackal/xmpp/jid"
+	"github.com/pborman/uuid"
+	"github.com/stretchr/testify/require"
+)
+
+func TestStream_ConnectTimeout(t *testing.T) {
+	r, _, shutdown := setupTest("jackal.im")
+	defer shutdown()
+
+	stm, conn := tUtilInStreamInit(r, component.New(&component.Config{}, nil, r))
+	require.True(t, conn.waitClose())
+	require.Equal(t, inDisconnected, stm.getState())
+}
+
+func TestStream_HostUnknown(t *testing.T) {
+	r, _, shutdown := setupTest("jackal.im")
+	defer shutdown()
+
+	stm, conn := tUtilInStreamInit(r, component.New(&component.Config{}, nil, r))
+	tUtilInStreamOpen(conn, "foo.jackal.im", componentAcceptNamespace)
+
+	elem := conn.outboundRead()
+	require.Equal(t, "stream:stream", elem.Name())
+	elem = conn.outboundRead()
+	require.Equal(t, "stream:error", elem.Name())
+	require.NotNil(t, elem.Elements().Child("host-unknown"))
+	require.True(t, conn.waitClose())
+	require.Equal(t, inDisconnected, stm.getState())
+
+	// invalid namespace
+	_, conn = tUtilInStreamInit(r, component.New(&component.Config{}, nil, r))
+	tUtilInStreamOpen(conn, "gateway.jackal.im", "jabber:client")
+
+	_ = conn.outboundRead()
+	elem = conn.outboundRead()
+	require.NotNil(t, elem.Elements().Child("invalid-namespace"))
+	require.True(t, conn.waitClose())
+}
+
+func TestStream_Handshake(t *testing.T) {
+	r, _, shutdown := setupTest("jackal.im")
+	defer shutdown()
+
+	comps := component.New(&component.Config{}, nil, r)
+
+	// invalid secret
+	_, conn := tUtilInStreamInit(r, comps)
+	tUtilInStreamOpen(conn, "gateway.jackal.im", componentAcceptNamespace)
+
+	elem := conn.outboundRead()
+	require.Equal(t, "stream:stream", elem.Name())
+	require.Equal(t, "gateway.jackal.im", elem.From())
+
+	conn.inboundWriteString("<handshake>" + handshakeDigest(elem.ID(), "foo") + "</handshake>")
+	elem = conn.outboundRead()
+	require.Equal(t, "stream:error", elem.Name())
+	require.NotNil(t, elem.Elements().Child("not-authorized"))
+	require.True(t, conn.waitClose())
+	require.Nil(t, comps.Get("gateway.jackal.im"))
+
+	// valid secret
+	stm, conn := tUtilInStreamInit(r, comps)
+	tUtilInStreamHandshake(t, conn)
+
+	require.Equal(t, inAuthenticated, stm.getState())
+	require.Equal(t, stm, comps.Get("gateway.jackal.im"))
+
+	// host already in use
+	_, conn2 := tUtilInStreamInit(r, comps)
+	tUtilInStreamOpen(conn2, "gateway.jackal.im", componentAcceptNamespace)
+	elem = conn2.outboundRead()
+	conn2.inboundWriteString("<handshake>" + handshakeDigest(elem.ID(), "s3cr3t") + "</handshake>")
+	elem = conn2.outboundRead()
+	require.NotNil(t, elem.Elements().Child("conflict"))
+	require.True(t, conn2.waitClose())
+
+	stm.Disconnect(nil)
+	require.True(t, conn.waitClose())
+	require.Nil(t, comps.Get("gateway.jackal.im"))
+}
+
+func TestStream_Routing(t *testing.T) {
+	r, _, shutdown := setupTest("jackal.im")
+	defer shutdown()
+
+	comps := component.New(&component.Config{}, nil, r)
+	r.SetComponentRouter(comps)
+
+	_ = storage.InsertOrUpdateUser(&model.User{Username: "ortuman", Password: "plain"})
+	j, _ := jid.New("ortuman", "jackal.im", "balcony", true)
+	userStm := stream.NewMockC2S(uuid.New(), j)
+	r.Bind(userStm)
+
+	stm, conn := tUtilInStreamInit(r, comps)
+	tUtilInStreamHandshake(t, conn)
+
+	// component to user
+	msgID := uuid.New()
+	msg := xmpp.NewElementName("message")
+	msg.SetID(msgID)
+	msg.SetFrom("irc@gateway.jackal.im")
+	msg.SetTo(j.String())
+	conn.inboundWriteString(msg.String())
+
+	elem := userStm.ReceiveElement()
+	require.Equal(t, msgID, elem.ID())
+	require.Equal(t, "irc@gateway.jackal.im", elem.From())
+
+	// user to component
+	compJID, _ := jid.NewWithString("irc@gateway.jackal.im", true)
+	iqID := uuid.New()
+	iq := xmpp.NewIQType(iqID, xmpp.GetType)
+	iq.SetFromJID(j)
+	iq.SetToJID(compJID)
+	iq.AppendElement(xmpp.NewElementNamespace("query", "jabber:iq:version"))
+	require.Nil(t, r.Route(iq))
+
+	elem = conn.outboundRead()
+	require.Equal(t, "iq", elem.Name())
+	require.Equal(t, iqID, elem.ID())
+	require.Equal(t, "", elem.Namespace())
+
+	// missing 'to' address
+	msg.SetTo("")
+	conn.inboundWriteString(msg.String())
+	elem = conn.outboundRead()
+	require.Equal(t, xmpp.ErrorType, elem.Type())
+	require.NotNil(t, elem.Error().Elements().Child("jid-malformed"))
+
+	// invalid 'from' address
+	msg.SetFrom("ortuman@jackal.im")
+	msg.SetTo(j.String())
+	conn.inboundWriteString(msg.String())
+	elem = conn.outboundRead()
+	require.Equal(t, "stream:error", elem.Name())
+	require.NotNil(t, elem.Elements().Child("invalid-from"))
+	require.True(t, conn.waitClose())
+	require.Equal(t, inDisconnected, stm.getState())
+}
+
+func TestStream_OfflineRouting(t *testing.T) {
+	r, _, shutdown := setupTest("jackal.im")
+	defer shutdown()
+
+	comps := component.New(&component.Config{}, nil, r)
+	r.SetComponentRouter(comps)
+
+	mods := module.New(&module.Config{
+		Enabled: map[string]struct{}{"offline": {}},
+		Offline: offline.Config{QueueSize: 10},
+	}, r)
+	defer func() { _ = mods.Shutdown(context.Background()) }()
+
+	_ = storage.InsertOrUpdateUser(&model.User{Username: "ortuman", Password: "plain"})
+
+	_, conn := newInStreamWithModules(r, comps, mods)
+	tUtilInStreamHandshake(t, conn)
+
+	// user not connected... message gets stored offline
+	msg := xmpp.NewElementName("message")
+	msg.SetID(uuid.New())
+	msg.SetFrom("irc@gateway.jackal.im")
+	msg.SetTo("ortuman@jackal.im/balcony")
+	msg.AppendElement(xmpp.NewElementName("body").SetText("Hi!"))
+	conn.inboundWriteString(msg.String())
+
+	time.Sleep(time.Millisecond * 100)
+	cnt, err := storage.CountOfflineMessages("ortuman")
+	require.Nil(t, err)
+	require.Equal(t, 1, cnt)
+
+	// not existing account
+	msg.SetTo("noelia@jackal.im")
+	conn.inboundWriteString(msg.String())
+	elem := conn.outboundRead()
+	require.Equal(t, xmpp.ErrorType, elem.Type())
+	require.NotNil(t, elem.Error().Elements().Child("service-unavailable"))
+}
+
+func TestStream_DiscoItem(t *testing.T) {
+	r, _, shutdown := setupTest("jackal.im")
+	defer shutdown()
+
+	di := xep0030.New(r)
+	defer di.Shutdown()
+
+	comps := component.New(&component.Config{}, di, r)
+
+	stm, conn := newInStreamWithModules(r, comps, &module.Modules{DiscoInfo: di})
+	tUtilInStreamHandshake(t, conn)
+
+	_ = storage.InsertOrUpdateUser(&model.User{Username: "ortuman", Password: "plain"})
+	j, _ := jid.New("ortuman", "jackal.im", "balcony", true)
+	userStm := stream.NewMockC2S(uuid.New(), j)
+	r.Bind(userStm)
+
+	srvJID, _ := jid.NewWithString("jackal.im", true)
+	iq := xmpp.NewIQType(uuid.New(), xmpp.GetType)
+	iq.SetFromJID(j)
+	iq.SetToJID(srvJID)
+	iq.AppendElement(xmpp.NewElementNamespace("query", "http://jabber.org/protocol/disco#items"))
+	di.ProcessIQ(iq)
+
+	elem := userStm.ReceiveElement()
+	items := elem.Elements().Child("query").Elements().Children("item")
+	require.Equal(t, 2, len(items))
+	require.Equal(t, "gateway.jackal.im", items[1].Attributes().Get("jid"))
+
+	stm.Disconnect(nil)
+
+	di.ProcessIQ(iq)
+	elem = userStm.ReceiveElement()
+	require.Equal(t, 1, len(elem.Elements().Child("query").Elements().Children("item")))
+}
+
+func tUtilInStreamInit(r *router.Router, comps *component.Components) (*inStream, *fakeSocketConn) {
+	return newInStreamWithModules(r, comps, module.New(&module.Config{}, r))
+}
+
+func newInStreamWithModules(r *router.Router, comps *component.Components, mods *module.Modules) (*inStream, *fakeSocketConn) {
+	conn := newFakeSocketConn()
+	cfg := &streamConfig{
+		components: map[string]ComponentConfig{
+			"gateway.jackal.im": {Host: "gateway.jackal.im", Name: "Gateway", Secret: "s3cr3t"},
+		},
+		connectTimeout: time.Second,
+		maxStanzaSize:  8192,
+		transport:      transport.NewSocketTransport(conn, 4096),
+	}
+	return newInStream(uuid.New(), cfg, mods, comps, r), conn
+}
+
+func tUtilInStreamOpen(conn *fakeSocketConn, to, namespace string) {
+	s := `<?xml version="1.0"?>
+	<stream:stream xmlns:stream="http://etherx.jabber.org/streams" xmlns="` + namespace + `" to="` + to + `">
+`
+	conn.inboundWriteString(s)
+}
+
+func tUtilInStreamHandshake(t *testing.T, conn *fakeSocketConn) {
+	tUtilInStreamOpen(conn, "gateway.jackal.im", componentAcceptNamespace)
+
+	elem := conn.outboundRead()
+	require.Equal(t, "stream:stream", elem.Name())
+
+	conn.inboundWriteString("<handshake>" + handshakeDigest(elem.ID(), "s3cr3t") + "</handshake>")
+	elem = conn.outboundRead()
+	require.Equal(t, "handshake", elem.Name())
+}
+
+func handshakeDigest(streamID, secret string) string {
+	h := sha1.Sum([]byte(streamID + secret))
+	return hex.EncodeToString(h[:])
+}
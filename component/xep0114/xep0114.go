@@ -0,0 +1,148 @@
+/*
+ * Copyright (c) 2018 Miguel Ángel Ortuño.
+ * See the LICENSE file for more information.
+ */
+
+package xep0114
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"strconv"
+	"sync"
+	"sync/atomic"
+
+	"github.com/ortuman/jackal/component"
+	streamerror "github.com/ortuman/jackal/errors"
+	"github.com/ortuman/jackal/log"
+	"github.com/ortuman/jackal/module"
+	"github.com/ortuman/jackal/router"
+	"github.com/ortuman/jackal/transport"
+)
+
+const (
+	streamNamespace          = "http://etherx.jabber.org/streams"
+	componentAcceptNamespace = "jabber:component:accept"
+)
+
+var listenerProvider = net.Listen
+
+// Listener represents an external component connection manager.
+// (https://xmpp.org/extensions/xep-0114.html)
+type Listener struct {
+	cfg       *Config
+	mods      *module.Modules
+	comps     *component.Components
+	router    *router.Router
+	inConns   sync.Map
+	ln        net.Listener
+	stmSeq    uint64
+	listening uint32
+}
+
+// New returns a new instance of an external component connection manager.
+func New(config *Config, mods *module.Modules, comps *component.Components, router *router.Router) *Listener {
+	return &Listener{cfg: config, mods: mods, comps: comps, router: router}
+}
+
+// Start starts accepting external component connections.
+func (l *Listener) Start() {
+	go l.start()
+}
+
+func (l *Listener) start() {
+	address := l.cfg.BindAddress + ":" + strconv.Itoa(l.cfg.Port)
+
+	log.Infof("component: listening at %s", address)
+
+	if err := l.listenConn(address); err != nil {
+		log.Fatalf("%v", err)
+	}
+}
+
+// Shutdown gracefully shuts down external component connection manager.
+func (l *Listener) Shutdown(ctx context.Context) error {
+	if atomic.CompareAndSwapUint32(&l.listening, 1, 0) {
+		// stop listening
+		if err := l.ln.Close(); err != nil {
+			return err
+		}
+		// close all connections
+		c, err := closeConnections(ctx, &l.inConns)
+		if err != nil {
+			return err
+		}
+		log.Infof("component: closed %d connection(s)", c)
+	}
+	return nil
+}
+
+func (l *Listener) listenConn(address string) error {
+	ln, err := listenerProvider("tcp", address)
+	if err != nil {
+		return err
+	}
+	l.ln = ln
+
+	atomic.StoreUint32(&l.listening, 1)
+	for atomic.LoadUint32(&l.listening) == 1 {
+		conn, err := ln.Accept()
+		if err == nil {
+			go l.startStream(transport.NewSocketTransport(conn, l.cfg.KeepAlive))
+			continue
+		}
+	}
+	return nil
+}
+
+func (l *Listener) startStream(tr transport.Transport) {
+	cfg := &streamConfig{
+		components:     l.cfg.Components,
+		connectTimeout: l.cfg.ConnectTimeout,
+		maxStanzaSize:  l.cfg.MaxStanzaSize,
+		transport:      tr,
+		onDisconnect:   l.unregisterStream,
+	}
+	stm := newInStream(l.nextID(), cfg, l.mods, l.comps, l.router)
+	l.registerStream(stm)
+}
+
+func (l *Listener) registerStream(stm *inStream) {
+	l.inConns.Store(stm.ID(), stm)
+	log.Infof("registered component stream... (id: %s)", stm.ID())
+}
+
+func (l *Listener) unregisterStream(stm *inStream) {
+	l.inConns.Delete(stm.ID())
+	log.Infof("unregistered component stream... (id: %s)", stm.ID())
+}
+
+func (l *Listener) nextID() string {
+	return fmt.Sprintf("component:%d", atomic.AddUint64(&l.stmSeq, 1))
+}
+
+func closeConnections(ctx context.Context, connections *sync.Map) (count int, err error) {
+	connections.Range(func(_, v interface{}) bool {
+		stm := v.(*inStream)
+		select {
+		case <-closeConn(stm):
+			count++
+			return true
+		case <-ctx.Done():
+			count = 0
+			err = ctx.Err()
+			return false
+		}
+	})
+	return
+}
+
+func closeConn(stm *inStream) <-chan bool {
+	c := make(chan bool, 1)
+	go func() {
+		stm.Disconnect(streamerror.ErrSystemShutdown)
+		c <- true
+	}()
+	return c
+}
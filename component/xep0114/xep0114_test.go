@@ -0,0 +1,229 @@
+/*
+ * Copyright (c) 2018 Miguel Ángel Ortuño.
+ * See the LICENSE file for more information.
+ */
+
+package xep0114
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"io"
+	"net"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/ortuman/jackal/component"
+	"github.com/ortuman/jackal/module"
+	"github.com/ortuman/jackal/router"
+	"github.com/ortuman/jackal/storage"
+	"github.com/ortuman/jackal/storage/memstorage"
+	"github.com/ortuman/jackal/xmpp"
+	"github.com/stretchr/testify/require"
+)
+
+var errFakeSockAlreadyClosed = errors.New("fakeSockReaderWriter: already closed")
+
+type fakeSockReaderWriter struct {
+	r *io.PipeReader
+	w *io.PipeWriter
+}
+
+func newFakeSockReaderWriter() *fakeSockReaderWriter {
+	pr, pw := io.Pipe()
+	return &fakeSockReaderWriter{r: pr, w: pw}
+}
+
+func (frw *fakeSockReaderWriter) Write(b []byte) (n int, err error) {
+	return frw.w.Write(b)
+}
+
+func (frw *fakeSockReaderWriter) Read(b []byte) (n int, err error) {
+	return frw.r.Read(b)
+}
+
+func (frw *fakeSockReaderWriter) Close() error {
+	frw.w.Close()
+	frw.r.Close()
+	return nil
+}
+
+type fakeSocketConn struct {
+	rd      *fakeSockReaderWriter
+	wr      *fakeSockReaderWriter
+	wrCh    chan []byte
+	p       *xmpp.Parser
+	closeCh chan struct{}
+	closed  uint32
+}
+
+func newFakeSocketConn() *fakeSocketConn {
+	fc := &fakeSocketConn{
+		rd:      newFakeSockReaderWriter(),
+		wr:      newFakeSockReaderWriter(),
+		wrCh:    make(chan []byte, 256),
+		closeCh: make(chan struct{}, 1),
+	}
+	fc.p = xmpp.NewParser(fc.wr, xmpp.SocketStream, 0)
+	go fc.loop()
+	return fc
+}
+
+func (c *fakeSocketConn) Read(b []byte) (n int, err error) {
+	if atomic.LoadUint32(&c.closed) == 1 {
+		return 0, errFakeSockAlreadyClosed
+	}
+	return c.rd.Read(b)
+}
+
+func (c *fakeSocketConn) Write(b []byte) (n int, err error) {
+	if atomic.LoadUint32(&c.closed) == 1 {
+		return 0, errFakeSockAlreadyClosed
+	}
+	wb := make([]byte, len(b))
+	copy(wb, b)
+	c.wrCh <- wb
+	return len(wb), nil
+}
+
+func (c *fakeSocketConn) Close() error {
+	if atomic.CompareAndSwapUint32(&c.closed, 0, 1) {
+		c.rd.Close()
+		close(c.closeCh)
+		return nil
+	}
+	return errFakeSockAlreadyClosed
+}
+
+func (c *fakeSocketConn) LocalAddr() net.Addr                { return localAddr }
+func (c *fakeSocketConn) RemoteAddr() net.Addr               { return remoteAddr }
+func (c *fakeSocketConn) SetDeadline(t time.Time) error      { return nil }
+func (c *fakeSocketConn) SetReadDeadline(t time.Time) error  { return nil }
+func (c *fakeSocketConn) SetWriteDeadline(t time.Time) error { return nil }
+
+func (c *fakeSocketConn) inboundWriteString(s string) (n int, err error) {
+	return c.rd.Write([]byte(s))
+}
+
+func (c *fakeSocketConn) outboundRead() xmpp.XElement {
+	var elem xmpp.XElement
+	var err error
+	for err == nil {
+		elem, err = c.p.ParseElement()
+		if elem != nil {
+			return elem
+		}
+	}
+	return &xmpp.Element{}
+}
+
+func (c *fakeSocketConn) waitClose() bool {
+	select {
+	case <-c.closeCh:
+		return true
+	case <-time.After(time.Second * 5):
+		return false // timed out
+	}
+}
+
+func (c *fakeSocketConn) loop() {
+	for {
+		select {
+		case b := <-c.wrCh:
+			c.wr.Write(b)
+		case <-c.closeCh:
+			// flush pending writes before closing outbound pipe
+			for {
+				select {
+				case b := <-c.wrCh:
+					c.wr.Write(b)
+				default:
+					c.wr.Close()
+					return
+				}
+			}
+		}
+	}
+}
+
+type fakeAddr int
+
+var (
+	localAddr  = fakeAddr(1)
+	remoteAddr = fakeAddr(2)
+)
+
+func (a fakeAddr) Network() string { return "net" }
+func (a fakeAddr) String() string  { return "str" }
+
+func TestListener_StartAndShutdown(t *testing.T) {
+	r, _, shutdown := setupTest("jackal.im")
+	defer shutdown()
+
+	lnCh := make(chan net.Listener, 1)
+	listenerProvider = func(network, address string) (net.Listener, error) {
+		ln, err := net.Listen(network, address)
+		lnCh <- ln
+		return ln, err
+	}
+	defer func() { listenerProvider = net.Listen }()
+
+	comps := component.New(&component.Config{}, nil, r)
+	l := New(&Config{
+		BindAddress:    "127.0.0.1",
+		ConnectTimeout: time.Second,
+		MaxStanzaSize:  defaultMaxStanzaSize,
+		Components:     map[string]ComponentConfig{"gateway.jackal.im": {Host: "gateway.jackal.im", Secret: "s3cr3t"}},
+	}, &module.Modules{}, comps, r)
+	l.Start()
+
+	var ln net.Listener
+	select {
+	case ln = <-lnCh:
+		break
+	case <-time.After(time.Second):
+		require.Fail(t, "listener start timeout")
+	}
+	conn, err := net.Dial("tcp", ln.Addr().String())
+	require.Nil(t, err)
+	defer conn.Close()
+
+	_, err = io.WriteString(conn, `<?xml version="1.0"?><stream:stream xmlns:stream="http://etherx.jabber.org/streams" xmlns="jabber:component:accept" to="gateway.jackal.im">`)
+	require.Nil(t, err)
+
+	p := xmpp.NewParser(conn, xmpp.SocketStream, 0)
+	elem := tUtilParseElement(p)
+	require.Equal(t, "stream:stream", elem.Name())
+	require.Equal(t, "gateway.jackal.im", elem.From())
+
+	require.Nil(t, l.Shutdown(context.Background()))
+
+	elem = tUtilParseElement(p)
+	require.Equal(t, "stream:error", elem.Name())
+	require.NotNil(t, elem.Elements().Child("system-shutdown"))
+}
+
+func tUtilParseElement(p *xmpp.Parser) xmpp.XElement {
+	var elem xmpp.XElement
+	var err error
+	for err == nil {
+		elem, err = p.ParseElement()
+		if elem != nil {
+			return elem
+		}
+	}
+	return &xmpp.Element{}
+}
+
+func setupTest(domain string) (*router.Router, *memstorage.Storage, func()) {
+	r, _ := router.New(&router.Config{
+		Hosts: []router.HostConfig{{Name: domain, Certificate: tls.Certificate{}}},
+	})
+	s := memstorage.New()
+	storage.Set(s)
+	return r, s, func() {
+		storage.Unset()
+	}
+}
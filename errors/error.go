@@ -42,6 +42,9 @@ var (
 	// ErrUnsupportedVersion represents 'unsupported-version' stream error.
 	ErrUnsupportedVersion = newStreamError("unsupported-version")
 
+	// ErrConflict represents 'conflict' stream error.
+	ErrConflict = newStreamError("conflict")
+
 	// ErrNotAuthorized represents 'not-authorized' stream error.
 	ErrNotAuthorized = newStreamError("not-authorized")
 
@@ -58,8 +61,21 @@ var (
 	ErrInternalServerError = newStreamError("internal-server-error")
 )
 
+var errorsByReason = map[string]*Error{}
+
+// ErrorWithReason returns the stream error associated to a given reason.
+// In case reason is unknown 'undefined-condition' stream error will be returned.
+func ErrorWithReason(reason string) *Error {
+	if err, ok := errorsByReason[reason]; ok {
+		return err
+	}
+	return ErrUndefinedCondition
+}
+
 func newStreamError(reason string) *Error {
-	return &Error{reason: reason}
+	err := &Error{reason: reason}
+	errorsByReason[reason] = err
+	return err
 }
 
 // Element returns stream error XML node.
@@ -33,6 +33,9 @@ func TestStreamError(t *testing.T) {
 	require.Equal(t, "unsupported-version", ErrUnsupportedVersion.Error())
 	require.Equal(t, "unsupported-version", ErrUnsupportedVersion.Element().Elements().All()[0].Name())
 
+	require.Equal(t, "conflict", ErrConflict.Error())
+	require.Equal(t, "conflict", ErrConflict.Element().Elements().All()[0].Name())
+
 	require.Equal(t, "not-authorized", ErrNotAuthorized.Error())
 	require.Equal(t, "not-authorized", ErrNotAuthorized.Element().Elements().All()[0].Name())
 
@@ -45,3 +48,9 @@ func TestStreamError(t *testing.T) {
 	require.Equal(t, "internal-server-error", ErrInternalServerError.Error())
 	require.Equal(t, "internal-server-error", ErrInternalServerError.Element().Elements().All()[0].Name())
 }
+
+func TestStreamErrorWithReason(t *testing.T) {
+	require.Equal(t, ErrPolicyViolation, ErrorWithReason("policy-violation"))
+	require.Equal(t, ErrConflict, ErrorWithReason("conflict"))
+	require.Equal(t, ErrUndefinedCondition, ErrorWithReason("foo"))
+}
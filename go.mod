@@ -41,6 +41,7 @@ require (
 	github.com/pierrec/lz4 v1.0.1 // indirect
 	github.com/pierrec/xxHash v0.1.5 // indirect
 	github.com/pkg/errors v0.8.1
+	github.com/prometheus/client_golang v0.9.2
 	github.com/scionproto/scion v0.0.0-00010101000000-000000000000
 	github.com/smartystreets/goconvey v0.0.0-20190731233626-505e41936337 // indirect
 	github.com/sony/gobreaker v0.0.0-20190329013020-a9b2a3fc7395
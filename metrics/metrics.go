@@ -0,0 +1,127 @@
+/*
+ * Copyright (c) 2018 Miguel Ángel Ortuño.
+ * See the LICENSE file for more information.
+ */
+
+package metrics
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+const namespace = "jackal"
+
+var (
+	// C2SStreams tracks the number of c2s streams per listener and state.
+	C2SStreams = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Subsystem: "c2s",
+		Name:      "streams",
+		Help:      "Number of c2s streams per listener and state.",
+	}, []string{"listener", "state"})
+
+	// BoundResources tracks the number of locally bound c2s resources.
+	BoundResources = prometheus.NewGauge(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Subsystem: "router",
+		Name:      "bound_resources",
+		Help:      "Number of locally bound c2s resources.",
+	})
+
+	// S2SStreams tracks the number of s2s streams per direction and remote domain.
+	S2SStreams = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Subsystem: "s2s",
+		Name:      "streams",
+		Help:      "Number of s2s streams per direction and remote domain.",
+	}, []string{"direction", "domain"})
+
+	// RoutedStanzas counts the stanzas routed per stanza type.
+	RoutedStanzas = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Subsystem: "router",
+		Name:      "routed_stanzas_total",
+		Help:      "Number of routed stanzas per stanza type.",
+	}, []string{"type"})
+
+	// RouteErrors counts the stanzas that couldn't be routed per router error.
+	RouteErrors = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Subsystem: "router",
+		Name:      "route_errors_total",
+		Help:      "Number of stanzas that couldn't be routed per router error.",
+	}, []string{"error"})
+
+	// SASLAuthentications counts the SASL authentication attempts per mechanism and result.
+	SASLAuthentications = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Subsystem: "c2s",
+		Name:      "sasl_authentications_total",
+		Help:      "Number of SASL authentications per mechanism and result.",
+	}, []string{"mechanism", "result"})
+
+	// StorageLatency tracks storage calls duration per operation.
+	StorageLatency = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Subsystem: "storage",
+		Name:      "operation_duration_seconds",
+		Help:      "Storage operations latency in seconds.",
+		Buckets:   prometheus.ExponentialBuckets(0.0005, 2, 14),
+	}, []string{"operation"})
+
+	// ClusterMembers tracks the number of cluster members, including local node.
+	ClusterMembers = prometheus.NewGauge(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Subsystem: "cluster",
+		Name:      "members",
+		Help:      "Number of cluster members, including local node.",
+	})
+
+	// RunQueueBacklog tracks the number of pending run queue messages per queue class.
+	RunQueueBacklog = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Subsystem: "runqueue",
+		Name:      "backlog",
+		Help:      "Number of pending run queue messages per queue class.",
+	}, []string{"queue"})
+)
+
+const (
+	// SASLSuccess represents a successful SASL authentication result label.
+	SASLSuccess = "success"
+
+	// SASLFailure represents a failed SASL authentication result label.
+	SASLFailure = "failure"
+)
+
+var registry = prometheus.NewRegistry()
+
+func init() {
+	registry.MustRegister(
+		prometheus.NewGoCollector(),
+		prometheus.NewProcessCollector(prometheus.ProcessCollectorOpts{}),
+		C2SStreams,
+		BoundResources,
+		S2SStreams,
+		RoutedStanzas,
+		RouteErrors,
+		SASLAuthentications,
+		StorageLatency,
+		ClusterMembers,
+		RunQueueBacklog,
+	)
+}
+
+// Handler returns an HTTP handler serving registered metrics in Prometheus text format.
+func Handler() http.Handler {
+	return promhttp.HandlerFor(registry, promhttp.HandlerOpts{})
+}
+
+// ObserveStorageLatency records the time elapsed since start for a storage operation.
+func ObserveStorageLatency(operation string, start time.Time) {
+	StorageLatency.WithLabelValues(operation).Observe(time.Since(start).Seconds())
+}
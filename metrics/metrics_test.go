@@ -0,0 +1,44 @@
+/*
+ * Copyright (c) 2018 Miguel Ángel Ortuño.
+ * See the LICENSE file for more information.
+ */
+
+package metrics
+
+import (
+	"io/ioutil"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestMetricsHandler(t *testing.T) {
+	C2SStreams.WithLabelValues("default", "bound").Inc()
+	BoundResources.Set(1)
+	S2SStreams.WithLabelValues("in", "jabber.org").Inc()
+	RoutedStanzas.WithLabelValues("message").Inc()
+	RouteErrors.WithLabelValues("blocked_jid").Inc()
+	SASLAuthentications.WithLabelValues("PLAIN", SASLSuccess).Inc()
+	ObserveStorageLatency("FetchUser", time.Now())
+	ClusterMembers.Set(3)
+	RunQueueBacklog.WithLabelValues("c2s:default").Set(0)
+
+	rec := httptest.NewRecorder()
+	Handler().ServeHTTP(rec, httptest.NewRequest("GET", "/metrics", nil))
+	require.Equal(t, 200, rec.Code)
+
+	b, _ := ioutil.ReadAll(rec.Body)
+	body := string(b)
+	require.Contains(t, body, `jackal_c2s_streams{listener="default",state="bound"} 1`)
+	require.Contains(t, body, `jackal_router_bound_resources 1`)
+	require.Contains(t, body, `jackal_s2s_streams{direction="in",domain="jabber.org"} 1`)
+	require.Contains(t, body, `jackal_router_routed_stanzas_total{type="message"} 1`)
+	require.Contains(t, body, `jackal_router_route_errors_total{error="blocked_jid"} 1`)
+	require.Contains(t, body, `jackal_c2s_sasl_authentications_total{mechanism="PLAIN",result="success"} 1`)
+	require.Contains(t, body, `jackal_storage_operation_duration_seconds_count{operation="FetchUser"} 1`)
+	require.Contains(t, body, `jackal_cluster_members 3`)
+	require.Contains(t, body, `jackal_runqueue_backlog{queue="c2s:default"} 0`)
+	require.Contains(t, body, `go_goroutines`)
+}
@@ -0,0 +1,186 @@
+/*
+ * Copyright (c) 2018 Miguel Ángel Ortuño.
+ * See the LICENSE file for more information.
+ */
+
+package model
+
+import (
+	"bytes"
+	"encoding/gob"
+	"time"
+
+	"github.com/ortuman/jackal/xmpp"
+)
+
+// Archiving default preferences.
+const (
+	// ArchiveAlways represents 'always' archiving default preference.
+	ArchiveAlways = "always"
+
+	// ArchiveNever represents 'never' archiving default preference.
+	ArchiveNever = "never"
+
+	// ArchiveRoster represents 'roster' archiving default preference.
+	ArchiveRoster = "roster"
+)
+
+// ArchiveMessage represents a message archive storage entity.
+type ArchiveMessage struct {
+	Username  string
+	ID        string
+	With      string
+	Message   *xmpp.Message
+	CreatedAt time.Time
+}
+
+// FromBytes deserializes a ArchiveMessage entity from it's gob binary representation.
+func (am *ArchiveMessage) FromBytes(buf *bytes.Buffer) error {
+	dec := gob.NewDecoder(buf)
+	if err := dec.Decode(&am.Username); err != nil {
+		return err
+	}
+	if err := dec.Decode(&am.ID); err != nil {
+		return err
+	}
+	if err := dec.Decode(&am.With); err != nil {
+		return err
+	}
+	if err := dec.Decode(&am.CreatedAt); err != nil {
+		return err
+	}
+	msg, err := xmpp.NewMessageFromBytes(buf)
+	if err != nil {
+		return err
+	}
+	am.Message = msg
+	return nil
+}
+
+// ToBytes converts a ArchiveMessage entity to it's gob binary representation.
+func (am *ArchiveMessage) ToBytes(buf *bytes.Buffer) error {
+	enc := gob.NewEncoder(buf)
+	if err := enc.Encode(&am.Username); err != nil {
+		return err
+	}
+	if err := enc.Encode(&am.ID); err != nil {
+		return err
+	}
+	if err := enc.Encode(&am.With); err != nil {
+		return err
+	}
+	if err := enc.Encode(&am.CreatedAt); err != nil {
+		return err
+	}
+	return am.Message.ToBytes(buf)
+}
+
+// ArchivePrefs represents user's message archiving preferences storage entity.
+type ArchivePrefs struct {
+	Username string
+	Default  string
+	Always   []string
+	Never    []string
+}
+
+// FromBytes deserializes a ArchivePrefs entity from it's gob binary representation.
+func (ap *ArchivePrefs) FromBytes(buf *bytes.Buffer) error {
+	dec := gob.NewDecoder(buf)
+	if err := dec.Decode(&ap.Username); err != nil {
+		return err
+	}
+	if err := dec.Decode(&ap.Default); err != nil {
+		return err
+	}
+	if err := dec.Decode(&ap.Always); err != nil {
+		return err
+	}
+	return dec.Decode(&ap.Never)
+}
+
+// ToBytes converts a ArchivePrefs entity to it's gob binary representation.
+func (ap *ArchivePrefs) ToBytes(buf *bytes.Buffer) error {
+	enc := gob.NewEncoder(buf)
+	if err := enc.Encode(&ap.Username); err != nil {
+		return err
+	}
+	if err := enc.Encode(&ap.Default); err != nil {
+		return err
+	}
+	if err := enc.Encode(&ap.Always); err != nil {
+		return err
+	}
+	return enc.Encode(&ap.Never)
+}
+
+// ArchiveFilter represents a message archive query filter.
+type ArchiveFilter struct {
+	// With restricts results to those exchanged with a given bare JID.
+	With string
+
+	// Start and End restrict results to a given time interval.
+	Start time.Time
+	End   time.Time
+
+	// AfterID and BeforeID restrict results to those archived after
+	// or before a given archive identifier.
+	AfterID  string
+	BeforeID string
+
+	// LastPage requests the last page of results.
+	LastPage bool
+
+	// Max defines the maximum number of results to be returned.
+	// A zero value means no limit.
+	Max int
+}
+
+// Matches returns whether or not an archived message satisfies
+// filter's with, start and end constraints.
+func (f *ArchiveFilter) Matches(am *ArchiveMessage) bool {
+	if len(f.With) > 0 && am.With != f.With {
+		return false
+	}
+	if !f.Start.IsZero() && am.CreatedAt.Before(f.Start) {
+		return false
+	}
+	if !f.End.IsZero() && am.CreatedAt.After(f.End) {
+		return false
+	}
+	return true
+}
+
+// Page applies filter's paging constraints to a chronologically
+// ordered set of archived messages.
+func (f *ArchiveFilter) Page(messages []ArchiveMessage) []ArchiveMessage {
+	if len(f.AfterID) > 0 {
+		idx := archiveMessageIndex(messages, f.AfterID)
+		if idx == -1 {
+			return nil
+		}
+		messages = messages[idx+1:]
+	}
+	if len(f.BeforeID) > 0 {
+		idx := archiveMessageIndex(messages, f.BeforeID)
+		if idx == -1 {
+			return nil
+		}
+		messages = messages[:idx]
+	}
+	if f.Max > 0 && len(messages) > f.Max {
+		if f.LastPage || len(f.BeforeID) > 0 {
+			return messages[len(messages)-f.Max:]
+		}
+		return messages[:f.Max]
+	}
+	return messages
+}
+
+func archiveMessageIndex(messages []ArchiveMessage, id string) int {
+	for i := range messages {
+		if messages[i].ID == id {
+			return i
+		}
+	}
+	return -1
+}
@@ -0,0 +1,103 @@
+/*
+ * Copyright (c) 2018 Miguel Ángel Ortuño.
+ * See the LICENSE file for more information.
+ */
+
+package model
+
+import (
+	"bytes"
+	"testing"
+	"time"
+
+	"github.com/ortuman/jackal/xmpp"
+	"github.com/ortuman/jackal/xmpp/jid"
+	"github.com/stretchr/testify/require"
+)
+
+func TestModelArchiveMessage(t *testing.T) {
+	j1, _ := jid.NewWithString("ortuman@jackal.im/balcony", true)
+	j2, _ := jid.NewWithString("noelia@jackal.im/yard", true)
+
+	msg := xmpp.NewMessageType("abc", xmpp.ChatType)
+	msg.SetFromJID(j1)
+	msg.SetToJID(j2)
+
+	am1 := ArchiveMessage{
+		Username:  "ortuman",
+		ID:        "1234",
+		With:      "noelia@jackal.im",
+		Message:   msg,
+		CreatedAt: time.Now().UTC(),
+	}
+	buf := new(bytes.Buffer)
+	require.Nil(t, am1.ToBytes(buf))
+	am2 := ArchiveMessage{}
+	require.Nil(t, am2.FromBytes(buf))
+	require.Equal(t, am1.Username, am2.Username)
+	require.Equal(t, am1.ID, am2.ID)
+	require.Equal(t, am1.With, am2.With)
+	require.Equal(t, am1.Message.String(), am2.Message.String())
+	require.True(t, am1.CreatedAt.Equal(am2.CreatedAt))
+}
+
+func TestModelArchivePrefs(t *testing.T) {
+	var ap1, ap2 ArchivePrefs
+	ap1 = ArchivePrefs{
+		Username: "ortuman",
+		Default:  ArchiveRoster,
+		Always:   []string{"noelia@jackal.im"},
+		Never:    []string{"romeo@example.net"},
+	}
+	buf := new(bytes.Buffer)
+	require.Nil(t, ap1.ToBytes(buf))
+	require.Nil(t, ap2.FromBytes(buf))
+	require.Equal(t, ap1, ap2)
+}
+
+func TestModelArchiveFilter(t *testing.T) {
+	now := time.Now()
+
+	var messages []ArchiveMessage
+	for i := 0; i < 5; i++ {
+		messages = append(messages, ArchiveMessage{
+			ID:        string(rune('a' + i)),
+			With:      "noelia@jackal.im",
+			CreatedAt: now.Add(time.Duration(i) * time.Minute),
+		})
+	}
+	messages[4].With = "romeo@example.net"
+
+	f := ArchiveFilter{With: "noelia@jackal.im"}
+	require.True(t, f.Matches(&messages[0]))
+	require.False(t, f.Matches(&messages[4]))
+
+	f = ArchiveFilter{Start: now.Add(time.Minute), End: now.Add(time.Minute * 2)}
+	require.False(t, f.Matches(&messages[0]))
+	require.True(t, f.Matches(&messages[1]))
+	require.True(t, f.Matches(&messages[2]))
+	require.False(t, f.Matches(&messages[3]))
+
+	f = ArchiveFilter{Max: 2}
+	page := f.Page(messages)
+	require.Equal(t, 2, len(page))
+	require.Equal(t, "a", page[0].ID)
+
+	f = ArchiveFilter{Max: 2, AfterID: "b"}
+	page = f.Page(messages)
+	require.Equal(t, 2, len(page))
+	require.Equal(t, "c", page[0].ID)
+
+	f = ArchiveFilter{Max: 2, BeforeID: "d"}
+	page = f.Page(messages)
+	require.Equal(t, 2, len(page))
+	require.Equal(t, "b", page[0].ID)
+
+	f = ArchiveFilter{Max: 2, LastPage: true}
+	page = f.Page(messages)
+	require.Equal(t, 2, len(page))
+	require.Equal(t, "d", page[0].ID)
+
+	f = ArchiveFilter{AfterID: "unknown"}
+	require.Nil(t, f.Page(messages))
+}
@@ -0,0 +1,112 @@
+/*
+ * Copyright (c) 2018 Miguel Ángel Ortuño.
+ * See the LICENSE file for more information.
+ */
+
+package mucmodel
+
+import (
+	"bytes"
+	"encoding/gob"
+)
+
+// room occupant affiliation values
+const (
+	AffiliationOwner   = "owner"
+	AffiliationAdmin   = "admin"
+	AffiliationMember  = "member"
+	AffiliationOutcast = "outcast"
+	AffiliationNone    = "none"
+)
+
+// room occupant role values
+const (
+	RoleModerator   = "moderator"
+	RoleParticipant = "participant"
+	RoleVisitor     = "visitor"
+	RoleNone        = "none"
+)
+
+// room 'whois' values
+const (
+	WhoisModerators = "moderators"
+	WhoisAnyone     = "anyone"
+)
+
+// RoomConfig represents a room configuration.
+type RoomConfig struct {
+	Name              string
+	Description       string
+	Persistent        bool
+	Public            bool
+	MembersOnly       bool
+	Moderated         bool
+	PasswordProtected bool
+	Password          string
+	Whois             string
+	ChangeSubject     bool
+	MaxUsers          int
+}
+
+// Room represents a multi-user chat room storage entity.
+type Room struct {
+	// JID is the room bare JID.
+	JID string
+
+	Config  RoomConfig
+	Subject string
+
+	// Affiliations maps user bare JIDs to its room affiliation.
+	// Users not present in the map are considered to have no affiliation.
+	Affiliations map[string]string
+}
+
+// Affiliation returns the affiliation associated to a user bare JID.
+func (r *Room) Affiliation(bareJID string) string {
+	if aff, ok := r.Affiliations[bareJID]; ok {
+		return aff
+	}
+	return AffiliationNone
+}
+
+// SetAffiliation sets the affiliation associated to a user bare JID.
+func (r *Room) SetAffiliation(bareJID, affiliation string) {
+	if affiliation == AffiliationNone {
+		delete(r.Affiliations, bareJID)
+		return
+	}
+	if r.Affiliations == nil {
+		r.Affiliations = make(map[string]string)
+	}
+	r.Affiliations[bareJID] = affiliation
+}
+
+// FromBytes deserializes a Room entity from it's gob binary representation.
+func (r *Room) FromBytes(buf *bytes.Buffer) error {
+	dec := gob.NewDecoder(buf)
+	if err := dec.Decode(&r.JID); err != nil {
+		return err
+	}
+	if err := dec.Decode(&r.Config); err != nil {
+		return err
+	}
+	if err := dec.Decode(&r.Subject); err != nil {
+		return err
+	}
+	return dec.Decode(&r.Affiliations)
+}
+
+// ToBytes converts a Room entity to it's gob binary representation.
+func (r *Room) ToBytes(buf *bytes.Buffer) error {
+	enc := gob.NewEncoder(buf)
+	if err := enc.Encode(&r.JID); err != nil {
+		return err
+	}
+	if err := enc.Encode(&r.Config); err != nil {
+		return err
+	}
+	if err := enc.Encode(&r.Subject); err != nil {
+		return err
+	}
+	return enc.Encode(&r.Affiliations)
+}
@@ -0,0 +1,57 @@
+/*
+ * Copyright (c) 2018 Miguel Ángel Ortuño.
+ * See the LICENSE file for more information.
+ */
+
+package mucmodel
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestRoomAffiliations(t *testing.T) {
+	r := Room{JID: "room@conference.jackal.im"}
+	require.Equal(t, AffiliationNone, r.Affiliation("ortuman@jackal.im"))
+
+	r.SetAffiliation("ortuman@jackal.im", AffiliationOwner)
+	require.Equal(t, AffiliationOwner, r.Affiliation("ortuman@jackal.im"))
+
+	r.SetAffiliation("ortuman@jackal.im", AffiliationNone)
+	require.Equal(t, AffiliationNone, r.Affiliation("ortuman@jackal.im"))
+	require.Equal(t, 0, len(r.Affiliations))
+}
+
+func TestRoomSerialization(t *testing.T) {
+	r1 := Room{
+		JID: "room@conference.jackal.im",
+		Config: RoomConfig{
+			Name:       "Room",
+			Persistent: true,
+			Whois:      WhoisModerators,
+			MaxUsers:   50,
+		},
+		Subject: "Hi there!",
+	}
+	r1.SetAffiliation("ortuman@jackal.im", AffiliationOwner)
+	r1.SetAffiliation("romeo@jackal.im", AffiliationOutcast)
+
+	buf := new(bytes.Buffer)
+	require.Nil(t, r1.ToBytes(buf))
+
+	r2 := Room{}
+	require.Nil(t, r2.FromBytes(buf))
+	require.Equal(t, r1, r2)
+
+	// no affiliations
+	r3 := Room{JID: "room2@conference.jackal.im"}
+	buf.Reset()
+	require.Nil(t, r3.ToBytes(buf))
+
+	r4 := Room{}
+	require.Nil(t, r4.FromBytes(buf))
+	require.Equal(t, r3.JID, r4.JID)
+	require.Equal(t, 0, len(r4.Affiliations))
+}
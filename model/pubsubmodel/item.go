@@ -0,0 +1,72 @@
+/*
+ * Copyright (c) 2018 Miguel Ángel Ortuño.
+ * See the LICENSE file for more information.
+ */
+
+package pubsubmodel
+
+import (
+	"bytes"
+	"encoding/gob"
+	"time"
+
+	"github.com/ortuman/jackal/xmpp"
+)
+
+// Item represents a published node item storage entity.
+type Item struct {
+	ID        string
+	Publisher string
+	Payload   xmpp.XElement
+	CreatedAt time.Time
+}
+
+// FromBytes deserializes an Item entity from it's gob binary representation.
+func (i *Item) FromBytes(buf *bytes.Buffer) error {
+	dec := gob.NewDecoder(buf)
+	if err := dec.Decode(&i.ID); err != nil {
+		return err
+	}
+	if err := dec.Decode(&i.Publisher); err != nil {
+		return err
+	}
+	if err := dec.Decode(&i.CreatedAt); err != nil {
+		return err
+	}
+	var hasPayload bool
+	if err := dec.Decode(&hasPayload); err != nil {
+		return err
+	}
+	if !hasPayload {
+		i.Payload = nil
+		return nil
+	}
+	payload, err := xmpp.NewElementFromBytes(buf)
+	if err != nil {
+		return err
+	}
+	i.Payload = payload
+	return nil
+}
+
+// ToBytes converts an Item entity to it's gob binary representation.
+func (i *Item) ToBytes(buf *bytes.Buffer) error {
+	enc := gob.NewEncoder(buf)
+	if err := enc.Encode(&i.ID); err != nil {
+		return err
+	}
+	if err := enc.Encode(&i.Publisher); err != nil {
+		return err
+	}
+	if err := enc.Encode(&i.CreatedAt); err != nil {
+		return err
+	}
+	hasPayload := i.Payload != nil
+	if err := enc.Encode(&hasPayload); err != nil {
+		return err
+	}
+	if !hasPayload {
+		return nil
+	}
+	return i.Payload.ToBytes(buf)
+}
@@ -0,0 +1,46 @@
+/*
+ * Copyright (c) 2018 Miguel Ángel Ortuño.
+ * See the LICENSE file for more information.
+ */
+
+package pubsubmodel
+
+import (
+	"bytes"
+	"testing"
+	"time"
+
+	"github.com/ortuman/jackal/xmpp"
+	"github.com/stretchr/testify/require"
+)
+
+func TestItemSerialization(t *testing.T) {
+	entry := xmpp.NewElementNamespace("entry", "http://www.w3.org/2005/Atom")
+	entry.AppendElement(xmpp.NewElementName("title").SetText("Soliloquy"))
+
+	i1 := Item{
+		ID:        "ae890ac52d0df67ed7cfdf51b644e901",
+		Publisher: "ortuman@jackal.im",
+		Payload:   entry,
+		CreatedAt: time.Unix(1546300800, 0).UTC(),
+	}
+	buf := new(bytes.Buffer)
+	require.Nil(t, i1.ToBytes(buf))
+
+	i2 := Item{}
+	require.Nil(t, i2.FromBytes(buf))
+	require.Equal(t, i1.ID, i2.ID)
+	require.Equal(t, i1.Publisher, i2.Publisher)
+	require.True(t, i1.CreatedAt.Equal(i2.CreatedAt))
+	require.Equal(t, i1.Payload.String(), i2.Payload.String())
+
+	// notification-only item
+	i3 := Item{ID: "1", Publisher: "ortuman@jackal.im"}
+	buf.Reset()
+	require.Nil(t, i3.ToBytes(buf))
+
+	i4 := Item{}
+	require.Nil(t, i4.FromBytes(buf))
+	require.Equal(t, "1", i4.ID)
+	require.Nil(t, i4.Payload)
+}
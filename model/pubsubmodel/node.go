@@ -0,0 +1,157 @@
+/*
+ * Copyright (c) 2018 Miguel Ángel Ortuño.
+ * See the LICENSE file for more information.
+ */
+
+package pubsubmodel
+
+import (
+	"bytes"
+	"encoding/gob"
+)
+
+// node access model values
+const (
+	AccessModelOpen      = "open"
+	AccessModelPresence  = "presence"
+	AccessModelRoster    = "roster"
+	AccessModelWhitelist = "whitelist"
+)
+
+// node publish model values
+const (
+	PublishModelPublishers  = "publishers"
+	PublishModelSubscribers = "subscribers"
+	PublishModelOpen        = "open"
+)
+
+// node 'send last published item' values
+const (
+	SendLastPublishedItemNever            = "never"
+	SendLastPublishedItemOnSub            = "on_sub"
+	SendLastPublishedItemOnSubAndPresence = "on_sub_and_presence"
+)
+
+// node entity affiliation values
+const (
+	AffiliationOwner     = "owner"
+	AffiliationPublisher = "publisher"
+	AffiliationMember    = "member"
+	AffiliationOutcast   = "outcast"
+	AffiliationNone      = "none"
+)
+
+// node subscription state values
+const (
+	SubscriptionSubscribed = "subscribed"
+	SubscriptionNone       = "none"
+)
+
+// Options represents a node configuration.
+type Options struct {
+	Title                 string
+	DeliverNotifications  bool
+	DeliverPayloads       bool
+	PersistItems          bool
+	MaxItems              int
+	AccessModel           string
+	PublishModel          string
+	RosterGroupsAllowed   []string
+	NotifyConfig          bool
+	NotifyDelete          bool
+	NotifyRetract         bool
+	SendLastPublishedItem string
+}
+
+// Node represents a publish-subscribe node storage entity.
+type Node struct {
+	// Host is the entity hosting the node, that is, either
+	// the pubsub service domain or the owner bare JID.
+	Host string
+
+	Name    string
+	Options Options
+
+	// Affiliations maps entity bare JIDs to its node affiliation.
+	// Entities not present in the map are considered to have no affiliation.
+	Affiliations map[string]string
+
+	// Subscriptions maps subscribed entity JIDs to its subscription state.
+	Subscriptions map[string]string
+}
+
+// Affiliation returns the affiliation associated to an entity bare JID.
+func (n *Node) Affiliation(bareJID string) string {
+	if aff, ok := n.Affiliations[bareJID]; ok {
+		return aff
+	}
+	return AffiliationNone
+}
+
+// SetAffiliation sets the affiliation associated to an entity bare JID.
+func (n *Node) SetAffiliation(bareJID, affiliation string) {
+	if affiliation == AffiliationNone {
+		delete(n.Affiliations, bareJID)
+		return
+	}
+	if n.Affiliations == nil {
+		n.Affiliations = make(map[string]string)
+	}
+	n.Affiliations[bareJID] = affiliation
+}
+
+// Subscription returns the subscription state associated to an entity JID.
+func (n *Node) Subscription(jid string) string {
+	if sub, ok := n.Subscriptions[jid]; ok {
+		return sub
+	}
+	return SubscriptionNone
+}
+
+// SetSubscription sets the subscription state associated to an entity JID.
+func (n *Node) SetSubscription(jid, subscription string) {
+	if subscription == SubscriptionNone {
+		delete(n.Subscriptions, jid)
+		return
+	}
+	if n.Subscriptions == nil {
+		n.Subscriptions = make(map[string]string)
+	}
+	n.Subscriptions[jid] = subscription
+}
+
+// FromBytes deserializes a Node entity from it's gob binary representation.
+func (n *Node) FromBytes(buf *bytes.Buffer) error {
+	dec := gob.NewDecoder(buf)
+	if err := dec.Decode(&n.Host); err != nil {
+		return err
+	}
+	if err := dec.Decode(&n.Name); err != nil {
+		return err
+	}
+	if err := dec.Decode(&n.Options); err != nil {
+		return err
+	}
+	if err := dec.Decode(&n.Affiliations); err != nil {
+		return err
+	}
+	return dec.Decode(&n.Subscriptions)
+}
+
+// ToBytes converts a Node entity to it's gob binary representation.
+func (n *Node) ToBytes(buf *bytes.Buffer) error {
+	enc := gob.NewEncoder(buf)
+	if err := enc.Encode(&n.Host); err != nil {
+		return err
+	}
+	if err := enc.Encode(&n.Name); err != nil {
+		return err
+	}
+	if err := enc.Encode(&n.Options); err != nil {
+		return err
+	}
+	if err := enc.Encode(&n.Affiliations); err != nil {
+		return err
+	}
+	return enc.Encode(&n.Subscriptions)
+}
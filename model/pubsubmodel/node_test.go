@@ -0,0 +1,72 @@
+/*
+ * Copyright (c) 2018 Miguel Ángel Ortuño.
+ * See the LICENSE file for more information.
+ */
+
+package pubsubmodel
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestNodeAffiliations(t *testing.T) {
+	n := Node{Host: "pubsub.jackal.im", Name: "princely_musings"}
+	require.Equal(t, AffiliationNone, n.Affiliation("ortuman@jackal.im"))
+
+	n.SetAffiliation("ortuman@jackal.im", AffiliationOwner)
+	require.Equal(t, AffiliationOwner, n.Affiliation("ortuman@jackal.im"))
+
+	n.SetAffiliation("ortuman@jackal.im", AffiliationNone)
+	require.Equal(t, AffiliationNone, n.Affiliation("ortuman@jackal.im"))
+	require.Equal(t, 0, len(n.Affiliations))
+}
+
+func TestNodeSubscriptions(t *testing.T) {
+	n := Node{Host: "pubsub.jackal.im", Name: "princely_musings"}
+	require.Equal(t, SubscriptionNone, n.Subscription("ortuman@jackal.im/balcony"))
+
+	n.SetSubscription("ortuman@jackal.im/balcony", SubscriptionSubscribed)
+	require.Equal(t, SubscriptionSubscribed, n.Subscription("ortuman@jackal.im/balcony"))
+	require.Equal(t, SubscriptionNone, n.Subscription("ortuman@jackal.im"))
+
+	n.SetSubscription("ortuman@jackal.im/balcony", SubscriptionNone)
+	require.Equal(t, 0, len(n.Subscriptions))
+}
+
+func TestNodeSerialization(t *testing.T) {
+	n1 := Node{
+		Host: "pubsub.jackal.im",
+		Name: "princely_musings",
+		Options: Options{
+			Title:               "Princely Musings",
+			DeliverPayloads:     true,
+			MaxItems:            10,
+			AccessModel:         AccessModelRoster,
+			PublishModel:        PublishModelPublishers,
+			RosterGroupsAllowed: []string{"Friends"},
+		},
+	}
+	n1.SetAffiliation("ortuman@jackal.im", AffiliationOwner)
+	n1.SetSubscription("noelia@jackal.im", SubscriptionSubscribed)
+
+	buf := new(bytes.Buffer)
+	require.Nil(t, n1.ToBytes(buf))
+
+	n2 := Node{}
+	require.Nil(t, n2.FromBytes(buf))
+	require.Equal(t, n1, n2)
+
+	// no affiliations nor subscriptions
+	n3 := Node{Host: "pubsub.jackal.im", Name: "news"}
+	buf.Reset()
+	require.Nil(t, n3.ToBytes(buf))
+
+	n4 := Node{}
+	require.Nil(t, n4.FromBytes(buf))
+	require.Equal(t, n3.Name, n4.Name)
+	require.Equal(t, 0, len(n4.Affiliations))
+	require.Equal(t, 0, len(n4.Subscriptions))
+}
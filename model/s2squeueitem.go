@@ -0,0 +1,62 @@
+/*
+ * Copyright (c) 2018 Miguel Ángel Ortuño.
+ * See the LICENSE file for more information.
+ */
+
+package model
+
+import (
+	"bytes"
+	"encoding/gob"
+	"time"
+
+	"github.com/ortuman/jackal/xmpp"
+)
+
+// S2SQueueItem represents an outgoing s2s queue storage entity,
+// that is, a stanza pending to be delivered to a remote domain.
+type S2SQueueItem struct {
+	ID           string
+	RemoteDomain string
+	Stanza       xmpp.Stanza
+	EnqueuedAt   time.Time
+}
+
+// FromBytes deserializes a S2SQueueItem entity from it's gob binary representation.
+func (qi *S2SQueueItem) FromBytes(buf *bytes.Buffer) error {
+	dec := gob.NewDecoder(buf)
+	if err := dec.Decode(&qi.ID); err != nil {
+		return err
+	}
+	if err := dec.Decode(&qi.RemoteDomain); err != nil {
+		return err
+	}
+	if err := dec.Decode(&qi.EnqueuedAt); err != nil {
+		return err
+	}
+	elem, err := xmpp.NewElementFromBytes(buf)
+	if err != nil {
+		return err
+	}
+	stanza, err := xmpp.NewStanzaFromElement(elem)
+	if err != nil {
+		return err
+	}
+	qi.Stanza = stanza
+	return nil
+}
+
+// ToBytes converts a S2SQueueItem entity to it's gob binary representation.
+func (qi *S2SQueueItem) ToBytes(buf *bytes.Buffer) error {
+	enc := gob.NewEncoder(buf)
+	if err := enc.Encode(&qi.ID); err != nil {
+		return err
+	}
+	if err := enc.Encode(&qi.RemoteDomain); err != nil {
+		return err
+	}
+	if err := enc.Encode(&qi.EnqueuedAt); err != nil {
+		return err
+	}
+	return qi.Stanza.ToBytes(buf)
+}
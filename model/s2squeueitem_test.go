@@ -0,0 +1,43 @@
+/*
+ * Copyright (c) 2018 Miguel Ángel Ortuño.
+ * See the LICENSE file for more information.
+ */
+
+package model
+
+import (
+	"bytes"
+	"testing"
+	"time"
+
+	"github.com/ortuman/jackal/xmpp"
+	"github.com/ortuman/jackal/xmpp/jid"
+	"github.com/stretchr/testify/require"
+)
+
+func TestModelS2SQueueItem(t *testing.T) {
+	j1, _ := jid.NewWithString("ortuman@jackal.im/balcony", true)
+	j2, _ := jid.NewWithString("romeo@example.net/garden", true)
+
+	msg := xmpp.NewMessageType("abc", xmpp.ChatType)
+	msg.SetFromJID(j1)
+	msg.SetToJID(j2)
+
+	qi1 := S2SQueueItem{
+		ID:           "1234",
+		RemoteDomain: "example.net",
+		Stanza:       msg,
+		EnqueuedAt:   time.Now().UTC(),
+	}
+	buf := new(bytes.Buffer)
+	require.Nil(t, qi1.ToBytes(buf))
+	qi2 := S2SQueueItem{}
+	require.Nil(t, qi2.FromBytes(buf))
+	require.Equal(t, qi1.ID, qi2.ID)
+	require.Equal(t, qi1.RemoteDomain, qi2.RemoteDomain)
+	require.Equal(t, qi1.Stanza.String(), qi2.Stanza.String())
+	require.True(t, qi1.EnqueuedAt.Equal(qi2.EnqueuedAt))
+
+	_, ok := qi2.Stanza.(*xmpp.Message)
+	require.True(t, ok)
+}
@@ -7,20 +7,102 @@ package model
 
 import (
 	"bytes"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/sha512"
+	"crypto/subtle"
 	"encoding/gob"
+	"hash"
+	"io"
 	"time"
 
 	"github.com/ortuman/jackal/xmpp"
+	"golang.org/x/crypto/pbkdf2"
 )
 
+const (
+	// ScramIterationCount represents the number of iterations used to derive SCRAM credentials.
+	ScramIterationCount = 4096
+
+	scramSaltLength = 32
+)
+
+// ScramKeys represents the SCRAM keys derived from a salted password using a concrete hash function.
+type ScramKeys struct {
+	StoredKey []byte
+	ServerKey []byte
+}
+
 // User represents a user storage entity.
 type User struct {
-	Username       string
-	Password       string
+	Username string
+
+	// Password contains user plaintext password, and it's only kept
+	// until salted SCRAM credentials are derived from it.
+	Password string
+
+	Salt           []byte
+	IterationCount int
+	SHA1           ScramKeys
+	SHA256         ScramKeys
+	SHA512         ScramKeys
+
 	LastPresence   *xmpp.Presence
 	LastPresenceAt time.Time
 }
 
+// SetPassword derives a new set of salted SCRAM credentials from a password,
+// discarding any previously stored plaintext password.
+func (u *User) SetPassword(password string) error {
+	salt := make([]byte, scramSaltLength)
+	if _, err := rand.Read(salt); err != nil {
+		return err
+	}
+	u.Password = ""
+	u.Salt = salt
+	u.IterationCount = ScramIterationCount
+	u.SHA1 = DeriveScramKeys(sha1.New, password, salt, ScramIterationCount)
+	u.SHA256 = DeriveScramKeys(sha256.New, password, salt, ScramIterationCount)
+	u.SHA512 = DeriveScramKeys(sha512.New, password, salt, ScramIterationCount)
+	return nil
+}
+
+// HasScramCredentials returns whether or not user password has been already stored as salted SCRAM credentials.
+func (u *User) HasScramCredentials() bool {
+	return len(u.Salt) > 0
+}
+
+// VerifyPassword returns whether or not a password matches user credentials.
+func (u *User) VerifyPassword(password string) bool {
+	if !u.HasScramCredentials() {
+		return len(u.Password) > 0 && subtle.ConstantTimeCompare([]byte(u.Password), []byte(password)) == 1
+	}
+	keys := DeriveScramKeys(sha256.New, password, u.Salt, u.IterationCount)
+	return subtle.ConstantTimeCompare(keys.StoredKey, u.SHA256.StoredKey) == 1
+}
+
+// DeriveScramKeys derives SCRAM stored and server keys from a password, as defined in RFC 5802.
+func DeriveScramKeys(h func() hash.Hash, password string, salt []byte, iterationCount int) ScramKeys {
+	saltedPassword := pbkdf2.Key([]byte(password), salt, iterationCount, h().Size(), h)
+
+	clientKey := hmacSum(h, saltedPassword, []byte("Client Key"))
+	storedKey := h()
+	storedKey.Write(clientKey)
+
+	return ScramKeys{
+		StoredKey: storedKey.Sum(nil),
+		ServerKey: hmacSum(h, saltedPassword, []byte("Server Key")),
+	}
+}
+
+func hmacSum(h func() hash.Hash, key, b []byte) []byte {
+	m := hmac.New(h, key)
+	m.Write(b)
+	return m.Sum(nil)
+}
+
 // FromBytes deserializes a User entity from it's gob binary representation.
 func (u *User) FromBytes(buf *bytes.Buffer) error {
 	dec := gob.NewDecoder(buf)
@@ -44,6 +126,25 @@ func (u *User) FromBytes(buf *bytes.Buffer) error {
 			return err
 		}
 	}
+	// entities stored before SCRAM credentials were introduced
+	// contain no further data
+	if err := dec.Decode(&u.Salt); err != nil {
+		if err == io.EOF {
+			return nil
+		}
+		return err
+	}
+	if err := dec.Decode(&u.IterationCount); err != nil {
+		return err
+	}
+	for _, keys := range []*ScramKeys{&u.SHA1, &u.SHA256, &u.SHA512} {
+		if err := dec.Decode(&keys.StoredKey); err != nil {
+			return err
+		}
+		if err := dec.Decode(&keys.ServerKey); err != nil {
+			return err
+		}
+	}
 	return nil
 }
 
@@ -65,7 +166,23 @@ func (u *User) ToBytes(buf *bytes.Buffer) error {
 			return err
 		}
 		u.LastPresenceAt = time.Now()
-		return enc.Encode(&u.LastPresenceAt)
+		if err := enc.Encode(&u.LastPresenceAt); err != nil {
+			return err
+		}
+	}
+	if err := enc.Encode(&u.Salt); err != nil {
+		return err
+	}
+	if err := enc.Encode(&u.IterationCount); err != nil {
+		return err
+	}
+	for _, keys := range []*ScramKeys{&u.SHA1, &u.SHA256, &u.SHA512} {
+		if err := enc.Encode(&keys.StoredKey); err != nil {
+			return err
+		}
+		if err := enc.Encode(&keys.ServerKey); err != nil {
+			return err
+		}
 	}
 	return nil
 }
@@ -34,3 +34,28 @@ func TestModelUser(t *testing.T) {
 	require.Equal(t, usr1.LastPresence.String(), usr2.LastPresence.String())
 	require.NotEqual(t, time.Time{}, usr2.LastPresenceAt)
 }
+
+func TestModelUserCredentials(t *testing.T) {
+	usr1 := User{Username: "ortuman", Password: "1234"}
+	require.False(t, usr1.HasScramCredentials())
+	require.True(t, usr1.VerifyPassword("1234"))
+	require.False(t, usr1.VerifyPassword("12345"))
+
+	require.Nil(t, usr1.SetPassword("abcd"))
+	require.True(t, usr1.HasScramCredentials())
+	require.Equal(t, "", usr1.Password)
+	require.Equal(t, ScramIterationCount, usr1.IterationCount)
+	require.True(t, usr1.VerifyPassword("abcd"))
+	require.False(t, usr1.VerifyPassword("1234"))
+
+	buf := new(bytes.Buffer)
+	require.Nil(t, usr1.ToBytes(buf))
+	usr2 := User{}
+	require.Nil(t, usr2.FromBytes(buf))
+	require.Equal(t, usr1.Salt, usr2.Salt)
+	require.Equal(t, usr1.IterationCount, usr2.IterationCount)
+	require.Equal(t, usr1.SHA1, usr2.SHA1)
+	require.Equal(t, usr1.SHA256, usr2.SHA256)
+	require.Equal(t, usr1.SHA512, usr2.SHA512)
+	require.True(t, usr2.VerifyPassword("abcd"))
+}
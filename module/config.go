@@ -6,13 +6,16 @@
 package module
 
 import (
+	"errors"
 	"fmt"
 
 	"github.com/ortuman/jackal/module/offline"
 	"github.com/ortuman/jackal/module/roster"
 	"github.com/ortuman/jackal/module/xep0077"
 	"github.com/ortuman/jackal/module/xep0092"
+	"github.com/ortuman/jackal/module/xep0133"
 	"github.com/ortuman/jackal/module/xep0199"
+	"github.com/ortuman/jackal/module/xep0313"
 )
 
 // Config represents C2S modules configuration.
@@ -22,7 +25,9 @@ type Config struct {
 	Offline      offline.Config
 	Registration xep0077.Config
 	Version      xep0092.Config
+	ServiceAdmin xep0133.Config
 	Ping         xep0199.Config
+	Mam          xep0313.Config
 }
 
 type configProxy struct {
@@ -31,7 +36,9 @@ type configProxy struct {
 	Offline      offline.Config `yaml:"mod_offline"`
 	Registration xep0077.Config `yaml:"mod_registration"`
 	Version      xep0092.Config `yaml:"mod_version"`
+	ServiceAdmin xep0133.Config `yaml:"mod_service_admin"`
 	Ping         xep0199.Config `yaml:"mod_ping"`
+	Mam          xep0313.Config `yaml:"mod_mam"`
 }
 
 // UnmarshalYAML satisfies Unmarshaler interface.
@@ -45,18 +52,25 @@ func (cfg *Config) UnmarshalYAML(unmarshal func(interface{}) error) error {
 	for _, mod := range p.Enabled {
 		switch mod {
 		case "roster", "last_activity", "private", "vcard", "registration", "version", "blocking_command",
-			"ping", "offline":
+			"ping", "offline", "mam", "carbons", "pep", "adhoc_commands", "service_admin":
 			break
 		default:
 			return fmt.Errorf("module.Config: unrecognized module: %s", mod)
 		}
 		enabled[mod] = struct{}{}
 	}
+	if _, ok := enabled["service_admin"]; ok {
+		if _, ok := enabled["adhoc_commands"]; !ok {
+			return errors.New("module.Config: service_admin module requires adhoc_commands to be enabled")
+		}
+	}
 	cfg.Enabled = enabled
 	cfg.Roster = p.Roster
 	cfg.Offline = p.Offline
 	cfg.Registration = p.Registration
 	cfg.Version = p.Version
+	cfg.ServiceAdmin = p.ServiceAdmin
 	cfg.Ping = p.Ping
+	cfg.Mam = p.Mam
 	return nil
 }
@@ -23,4 +23,11 @@ func TestModuleConfig(t *testing.T) {
 	validMod := `enabled: [roster]`
 	err = yaml.Unmarshal([]byte(validMod), &cfg)
 	require.Nil(t, err)
+	missingDep := `enabled: [service_admin]`
+	err = yaml.Unmarshal([]byte(missingDep), &cfg)
+	require.NotNil(t, err)
+	validDep := "enabled: [adhoc_commands, service_admin]\nmod_service_admin:\n  admins: [admin@jackal.im]"
+	err = yaml.Unmarshal([]byte(validDep), &cfg)
+	require.Nil(t, err)
+	require.Equal(t, []string{"admin@jackal.im"}, cfg.ServiceAdmin.Admins)
 }
@@ -14,11 +14,16 @@ import (
 	"github.com/ortuman/jackal/module/xep0012"
 	"github.com/ortuman/jackal/module/xep0030"
 	"github.com/ortuman/jackal/module/xep0049"
+	"github.com/ortuman/jackal/module/xep0050"
 	"github.com/ortuman/jackal/module/xep0054"
 	"github.com/ortuman/jackal/module/xep0077"
 	"github.com/ortuman/jackal/module/xep0092"
+	"github.com/ortuman/jackal/module/xep0133"
+	"github.com/ortuman/jackal/module/xep0163"
 	"github.com/ortuman/jackal/module/xep0191"
 	"github.com/ortuman/jackal/module/xep0199"
+	"github.com/ortuman/jackal/module/xep0280"
+	"github.com/ortuman/jackal/module/xep0313"
 	"github.com/ortuman/jackal/router"
 	"github.com/ortuman/jackal/xmpp"
 )
@@ -49,11 +54,16 @@ type Modules struct {
 	LastActivity *xep0012.LastActivity
 	Private      *xep0049.Private
 	DiscoInfo    *xep0030.DiscoInfo
+	AdHoc        *xep0050.AdHoc
 	VCard        *xep0054.VCard
 	Register     *xep0077.Register
 	Version      *xep0092.Version
+	ServiceAdmin *xep0133.ServiceAdmin
+	Pep          *xep0163.Pep
 	BlockingCmd  *xep0191.BlockingCommand
 	Ping         *xep0199.Ping
+	Carbons      *xep0280.Carbons
+	Mam          *xep0313.Mam
 
 	router     *router.Router
 	iqHandlers []IQHandler
@@ -90,6 +100,13 @@ func New(config *Config, router *router.Router) *Modules {
 		m.all = append(m.all, m.Private)
 	}
 
+	// XEP-0050: Ad-Hoc Commands (https://xmpp.org/extensions/xep-0050.html)
+	if _, ok := config.Enabled["adhoc_commands"]; ok {
+		m.AdHoc = xep0050.New(m.DiscoInfo, router)
+		m.iqHandlers = append(m.iqHandlers, m.AdHoc)
+		m.all = append(m.all, m.AdHoc)
+	}
+
 	// XEP-0054: vcard-temp (https://xmpp.org/extensions/xep-0054.html)
 	if _, ok := config.Enabled["vcard"]; ok {
 		m.VCard = xep0054.New(m.DiscoInfo, router)
@@ -111,12 +128,25 @@ func New(config *Config, router *router.Router) *Modules {
 		m.all = append(m.all, m.Version)
 	}
 
+	// XEP-0133: Service Administration (https://xmpp.org/extensions/xep-0133.html)
+	if _, ok := config.Enabled["service_admin"]; ok {
+		m.ServiceAdmin = xep0133.New(&config.ServiceAdmin, m.AdHoc, router)
+		m.all = append(m.all, m.ServiceAdmin)
+	}
+
 	// XEP-0160: Offline message storage (https://xmpp.org/extensions/xep-0160.html)
 	if _, ok := config.Enabled["offline"]; ok {
 		m.Offline = offline.New(&config.Offline, m.DiscoInfo, router)
 		m.all = append(m.all, m.Offline)
 	}
 
+	// XEP-0163: Personal Eventing Protocol (https://xmpp.org/extensions/xep-0163.html)
+	if _, ok := config.Enabled["pep"]; ok {
+		m.Pep = xep0163.New(m.DiscoInfo, m.Roster, router)
+		m.iqHandlers = append(m.iqHandlers, m.Pep)
+		m.all = append(m.all, m.Pep)
+	}
+
 	// XEP-0191: Blocking Command (https://xmpp.org/extensions/xep-0191.html)
 	if _, ok := config.Enabled["blocking_command"]; ok {
 		m.BlockingCmd = xep0191.New(m.DiscoInfo, m.Roster, router)
@@ -130,6 +160,20 @@ func New(config *Config, router *router.Router) *Modules {
 		m.iqHandlers = append(m.iqHandlers, m.Ping)
 		m.all = append(m.all, m.Ping)
 	}
+
+	// XEP-0280: Message Carbons (https://xmpp.org/extensions/xep-0280.html)
+	if _, ok := config.Enabled["carbons"]; ok {
+		m.Carbons = xep0280.New(m.DiscoInfo, router)
+		m.iqHandlers = append(m.iqHandlers, m.Carbons)
+		m.all = append(m.all, m.Carbons)
+	}
+
+	// XEP-0313: Message Archive Management (https://xmpp.org/extensions/xep-0313.html)
+	if _, ok := config.Enabled["mam"]; ok {
+		m.Mam = xep0313.New(&config.Mam, m.DiscoInfo, router)
+		m.iqHandlers = append(m.iqHandlers, m.Mam)
+		m.all = append(m.all, m.Mam)
+	}
 	return m
 }
 
@@ -150,6 +194,36 @@ func (m *Modules) ProcessIQ(iq *xmpp.IQ) {
 	}
 }
 
+// RouteMessage routes a message stanza applying server delivery rules.
+// Messages addressed to an unavailable resource are delivered to the bare JID,
+// and those addressed to a not connected user are stored offline.
+// Every delivered message gets archived.
+func (m *Modules) RouteMessage(message *xmpp.Message) error {
+	msg := message
+
+	err := m.router.Route(msg)
+	if err == router.ErrResourceNotFound {
+		// treat the stanza as if it were addressed to <node@domain>
+		msg, _ = xmpp.NewMessageFromElement(msg, msg.FromJID(), msg.ToJID().ToBareJID())
+		err = m.router.Route(msg)
+	}
+	switch err {
+	case nil:
+		if m.Mam != nil {
+			m.Mam.ArchiveMessage(message)
+		}
+	case router.ErrNotAuthenticated:
+		if m.Offline != nil {
+			if m.Mam != nil {
+				m.Mam.ArchiveMessage(message)
+			}
+			m.Offline.ArchiveMessage(message)
+			return nil
+		}
+	}
+	return err
+}
+
 // Shutdown gracefully shuts down modules instance.
 func (m *Modules) Shutdown(ctx context.Context) error {
 	select {
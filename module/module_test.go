@@ -36,7 +36,7 @@ func TestModules_New(t *testing.T) {
 	mods := setupModules(t)
 	defer mods.Shutdown(context.Background())
 
-	require.Equal(t, 10, len(mods.all))
+	require.Equal(t, 14, len(mods.all))
 }
 
 func TestModules_ProcessIQ(t *testing.T) {
@@ -11,7 +11,6 @@ import (
 	"sync"
 
 	"github.com/ortuman/jackal/log"
-	"github.com/ortuman/jackal/model"
 	"github.com/ortuman/jackal/model/rostermodel"
 	"github.com/ortuman/jackal/router"
 	"github.com/ortuman/jackal/runqueue"
@@ -93,6 +92,26 @@ func (x *Roster) OnlinePresencesMatchingJID(j *jid.JID) []*xmpp.Presence {
 	return ret
 }
 
+// UpdateItem inserts or updates a user roster item, pushing
+// the change to every user resource that requested the roster.
+func (x *Roster) UpdateItem(userJID *jid.JID, ri *rostermodel.Item) error {
+	errCh := make(chan error, 1)
+	x.runQueue.Run(func() {
+		errCh <- x.updateItem(ri, userJID.ToBareJID())
+	})
+	return <-errCh
+}
+
+// RemoveItem removes a user roster item, cancelling
+// any existing subscription between both entities.
+func (x *Roster) RemoveItem(userJID *jid.JID, contactJID *jid.JID) error {
+	errCh := make(chan error, 1)
+	x.runQueue.Run(func() {
+		errCh <- x.removeItem(&rostermodel.Item{JID: contactJID.ToBareJID().String()}, userJID.ToBareJID())
+	})
+	return <-errCh
+}
+
 // Shutdown shuts down roster module.
 func (x *Roster) Shutdown() error {
 	c := make(chan struct{})
@@ -173,12 +192,12 @@ func (x *Roster) updateRoster(iq *xmpp.IQ, query xmpp.XElement, stm stream.C2S)
 	}
 	switch ri.Subscription {
 	case rostermodel.SubscriptionRemove:
-		if err := x.removeItem(ri, stm); err != nil {
+		if err := x.removeItem(ri, stm.JID().ToBareJID()); err != nil {
 			stm.SendElement(iq.InternalServerError())
 			return err
 		}
 	default:
-		if err := x.updateItem(ri, stm); err != nil {
+		if err := x.updateItem(ri, stm.JID().ToBareJID()); err != nil {
 			stm.SendElement(iq.InternalServerError())
 			return err
 		}
@@ -187,8 +206,7 @@ func (x *Roster) updateRoster(iq *xmpp.IQ, query xmpp.XElement, stm stream.C2S)
 	return nil
 }
 
-func (x *Roster) updateItem(ri *rostermodel.Item, stm stream.C2S) error {
-	userJID := stm.JID().ToBareJID()
+func (x *Roster) updateItem(ri *rostermodel.Item, userJID *jid.JID) error {
 	contactJID := ri.ContactJID()
 
 	log.Infof("updating roster item - contact: %s (%s)", contactJID, userJID)
@@ -217,10 +235,9 @@ func (x *Roster) updateItem(ri *rostermodel.Item, stm stream.C2S) error {
 	return x.insertItem(usrRi, userJID)
 }
 
-func (x *Roster) removeItem(ri *rostermodel.Item, stm stream.C2S) error {
+func (x *Roster) removeItem(ri *rostermodel.Item, userJID *jid.JID) error {
 	var unsubscribe, unsubscribed *xmpp.Presence
 
-	userJID := stm.JID().ToBareJID()
 	contactJID := ri.ContactJID()
 
 	log.Infof("removing roster item: %v (%s)", contactJID, userJID)
@@ -648,11 +665,8 @@ func (x *Roster) broadcastPresence(presence *xmpp.Presence) error {
 	if usr, err := storage.FetchUser(fromJID.Node()); err != nil {
 		return err
 	} else if usr != nil {
-		return storage.InsertOrUpdateUser(&model.User{
-			Username:     usr.Username,
-			Password:     usr.Password,
-			LastPresence: presence,
-		})
+		usr.LastPresence = presence
+		return storage.InsertOrUpdateUser(usr)
 	}
 	return nil
 }
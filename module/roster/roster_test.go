@@ -251,6 +251,40 @@ func TestRoster_RemoveItem(t *testing.T) {
 	require.Nil(t, ri)
 }
 
+func TestRoster_UpdateAndRemoveItemWithoutStream(t *testing.T) {
+	rtr, _, shutdown := setupTest("jackal.im")
+	defer shutdown()
+
+	j, _ := jid.New("ortuman", "jackal.im", "balcony", true)
+
+	stm := stream.NewMockC2S(uuid.New(), j)
+	stm.SetBool(rosterRequestedCtxKey, true)
+	rtr.Bind(stm)
+
+	r := New(&Config{}, rtr)
+	defer r.Shutdown()
+
+	err := r.UpdateItem(j, &rostermodel.Item{JID: "noelia@jackal.im", Name: "My Juliet", Groups: []string{"friends"}})
+	require.Nil(t, err)
+
+	elem := stm.ReceiveElement()
+	require.Equal(t, "iq", elem.Name())
+	require.NotNil(t, elem.Elements().ChildNamespace("query", rosterNamespace))
+
+	ri, err := storage.FetchRosterItem("ortuman", "noelia@jackal.im")
+	require.Nil(t, err)
+	require.NotNil(t, ri)
+	require.Equal(t, "My Juliet", ri.Name)
+	require.Equal(t, rostermodel.SubscriptionNone, ri.Subscription)
+
+	cj, _ := jid.NewWithString("noelia@jackal.im", true)
+	require.Nil(t, r.RemoveItem(j, cj))
+
+	ri, err = storage.FetchRosterItem("ortuman", "noelia@jackal.im")
+	require.Nil(t, err)
+	require.Nil(t, ri)
+}
+
 func TestRoster_OnlineJIDs(t *testing.T) {
 	rtr, _, shutdown := setupTest("jackal.im")
 	defer shutdown()
@@ -73,6 +73,21 @@ func (x *DiscoInfo) UnregisterAccountFeature(feature string) {
 	x.srvProvider.unregisterAccountFeature(feature)
 }
 
+// RegisterAccountIdentity registers a new identity associated to all account domains.
+func (x *DiscoInfo) RegisterAccountIdentity(identity Identity) {
+	x.srvProvider.registerAccountIdentity(identity)
+}
+
+// RegisterServerNodeProvider registers a disco info provider handling a server domain node.
+func (x *DiscoInfo) RegisterServerNodeProvider(node string, provider InfoProvider) {
+	x.srvProvider.registerNodeProvider(node, provider)
+}
+
+// UnregisterServerNodeProvider unregisters a previously registered server node provider.
+func (x *DiscoInfo) UnregisterServerNodeProvider(node string) {
+	x.srvProvider.unregisterNodeProvider(node)
+}
+
 // RegisterProvider registers a new disco info provider associated to a domain.
 func (x *DiscoInfo) RegisterProvider(domain string, provider InfoProvider) {
 	x.mu.Lock()
@@ -87,6 +102,14 @@ func (x *DiscoInfo) UnregisterProvider(domain string) {
 	delete(x.providers, domain)
 }
 
+// IsProviderRegistered returns whether or not a disco info provider has been registered for a domain.
+func (x *DiscoInfo) IsProviderRegistered(domain string) bool {
+	x.mu.RLock()
+	defer x.mu.RUnlock()
+	_, ok := x.providers[domain]
+	return ok
+}
+
 // MatchesIQ returns whether or not an IQ should be
 // processed by the disco info module.
 func (x *DiscoInfo) MatchesIQ(iq *xmpp.IQ) bool {
@@ -173,7 +173,9 @@ func TestXEP0030_Provider(t *testing.T) {
 	require.True(t, elem.IsError())
 	require.Equal(t, xmpp.ErrItemNotFound.Error(), elem.Error().Elements().All()[0].Name())
 
+	require.False(t, x.IsProviderRegistered(compJID.String()))
 	x.RegisterProvider(compJID.String(), &testDiscoInfoProvider{})
+	require.True(t, x.IsProviderRegistered(compJID.String()))
 
 	x.ProcessIQ(iq1)
 	elem = stm.ReceiveElement()
@@ -183,6 +185,7 @@ func TestXEP0030_Provider(t *testing.T) {
 	require.Equal(t, 1, len(q.Elements().Children("item")))
 
 	x.UnregisterProvider(compJID.String())
+	require.False(t, x.IsProviderRegistered(compJID.String()))
 
 	x.ProcessIQ(iq1)
 	elem = stm.ReceiveElement()
@@ -23,20 +23,30 @@ type serverProvider struct {
 	serverItems     []Item
 	serverFeatures  []Feature
 	accountFeatures []Feature
+	accountIdents   []Identity
+	nodeProviders   map[string]InfoProvider
 }
 
 func (sp *serverProvider) Identities(toJID, fromJID *jid.JID, node string) []Identity {
 	if node != "" {
+		if prov := sp.nodeProvider(toJID, node); prov != nil {
+			return prov.Identities(toJID, fromJID, node)
+		}
 		return nil
 	}
 	if toJID.IsServer() {
 		return []Identity{{Type: "im", Category: "server", Name: "jackal"}}
 	}
-	return []Identity{{Type: "registered", Category: "account"}}
+	sp.mu.RLock()
+	defer sp.mu.RUnlock()
+	return append([]Identity{{Type: "registered", Category: "account"}}, sp.accountIdents...)
 }
 
 func (sp *serverProvider) Items(toJID, fromJID *jid.JID, node string) ([]Item, *xmpp.StanzaError) {
 	if node != "" {
+		if prov := sp.nodeProvider(toJID, node); prov != nil {
+			return prov.Items(toJID, fromJID, node)
+		}
 		return nil, nil
 	}
 	var itms []Item
@@ -58,11 +68,14 @@ func (sp *serverProvider) Items(toJID, fromJID *jid.JID, node string) ([]Item, *
 }
 
 func (sp *serverProvider) Features(toJID, fromJID *jid.JID, node string) ([]Feature, *xmpp.StanzaError) {
-	sp.mu.RLock()
-	defer sp.mu.RUnlock()
 	if node != "" {
+		if prov := sp.nodeProvider(toJID, node); prov != nil {
+			return prov.Features(toJID, fromJID, node)
+		}
 		return nil, nil
 	}
+	sp.mu.RLock()
+	defer sp.mu.RUnlock()
 	if toJID.IsServer() {
 		return sp.serverFeatures, nil
 	}
@@ -73,9 +86,38 @@ func (sp *serverProvider) Features(toJID, fromJID *jid.JID, node string) ([]Feat
 }
 
 func (sp *serverProvider) Form(toJID, fromJID *jid.JID, node string) (*xep0004.DataForm, *xmpp.StanzaError) {
+	if node != "" {
+		if prov := sp.nodeProvider(toJID, node); prov != nil {
+			return prov.Form(toJID, fromJID, node)
+		}
+	}
 	return nil, nil
 }
 
+func (sp *serverProvider) registerNodeProvider(node string, provider InfoProvider) {
+	sp.mu.Lock()
+	defer sp.mu.Unlock()
+	if sp.nodeProviders == nil {
+		sp.nodeProviders = make(map[string]InfoProvider)
+	}
+	sp.nodeProviders[node] = provider
+}
+
+func (sp *serverProvider) unregisterNodeProvider(node string) {
+	sp.mu.Lock()
+	defer sp.mu.Unlock()
+	delete(sp.nodeProviders, node)
+}
+
+func (sp *serverProvider) nodeProvider(toJID *jid.JID, node string) InfoProvider {
+	if !toJID.IsServer() {
+		return nil
+	}
+	sp.mu.RLock()
+	defer sp.mu.RUnlock()
+	return sp.nodeProviders[node]
+}
+
 func (sp *serverProvider) registerServerItem(item Item) {
 	sp.mu.Lock()
 	defer sp.mu.Unlock()
@@ -142,6 +184,17 @@ func (sp *serverProvider) unregisterAccountFeature(feature Feature) {
 	}
 }
 
+func (sp *serverProvider) registerAccountIdentity(identity Identity) {
+	sp.mu.Lock()
+	defer sp.mu.Unlock()
+	for _, ident := range sp.accountIdents {
+		if ident == identity {
+			return
+		}
+	}
+	sp.accountIdents = append(sp.accountIdents, identity)
+}
+
 func (sp *serverProvider) isSubscribedTo(contact *jid.JID, userJID *jid.JID) bool {
 	if contact.Matches(userJID, jid.MatchesBare) {
 		return true
@@ -10,6 +10,7 @@ import (
 	"testing"
 
 	"github.com/ortuman/jackal/model/rostermodel"
+	"github.com/ortuman/jackal/module/xep0004"
 	"github.com/ortuman/jackal/storage"
 	"github.com/ortuman/jackal/stream"
 	"github.com/ortuman/jackal/xmpp"
@@ -68,6 +69,13 @@ func TestServerProvider_Identities(t *testing.T) {
 	require.Equal(t, sp.Identities(accJID.ToBareJID(), accJID, ""), []Identity{
 		{Type: "registered", Category: "account"},
 	})
+
+	sp.registerAccountIdentity(Identity{Type: "pep", Category: "pubsub"})
+	sp.registerAccountIdentity(Identity{Type: "pep", Category: "pubsub"})
+	require.Equal(t, sp.Identities(accJID.ToBareJID(), accJID, ""), []Identity{
+		{Type: "registered", Category: "account"},
+		{Type: "pep", Category: "pubsub"},
+	})
 }
 
 func TestServerProvider_Items(t *testing.T) {
@@ -117,3 +125,47 @@ func TestServerProvider_Items(t *testing.T) {
 	})
 	require.Nil(t, sErr)
 }
+
+type testNodeProvider struct{}
+
+func (tp *testNodeProvider) Identities(toJID, fromJID *jid.JID, node string) []Identity {
+	return []Identity{{Category: "automation", Type: "command-list"}}
+}
+
+func (tp *testNodeProvider) Items(toJID, fromJID *jid.JID, node string) ([]Item, *xmpp.StanzaError) {
+	return []Item{{Jid: toJID.String(), Node: node + "#cmd"}}, nil
+}
+
+func (tp *testNodeProvider) Features(toJID, fromJID *jid.JID, node string) ([]Feature, *xmpp.StanzaError) {
+	return []Feature{"nf0"}, nil
+}
+
+func (tp *testNodeProvider) Form(toJID, fromJID *jid.JID, node string) (*xep0004.DataForm, *xmpp.StanzaError) {
+	return nil, nil
+}
+
+func TestServerProvider_NodeProviders(t *testing.T) {
+	var sp serverProvider
+	sp.registerNodeProvider("node", &testNodeProvider{})
+
+	srvJID, _ := jid.New("", "jackal.im", "", true)
+	accJID, _ := jid.New("ortuman", "jackal.im", "garden", true)
+
+	require.Equal(t, []Identity{{Category: "automation", Type: "command-list"}}, sp.Identities(srvJID, accJID, "node"))
+
+	items, sErr := sp.Items(srvJID, accJID, "node")
+	require.Nil(t, sErr)
+	require.Equal(t, []Item{{Jid: "jackal.im", Node: "node#cmd"}}, items)
+
+	features, sErr := sp.Features(srvJID, accJID, "node")
+	require.Nil(t, sErr)
+	require.Equal(t, []Feature{"nf0"}, features)
+
+	// node providers are bound to server domain
+	features, _ = sp.Features(accJID.ToBareJID(), accJID, "node")
+	require.Nil(t, features)
+
+	sp.unregisterNodeProvider("node")
+	items, _ = sp.Items(srvJID, accJID, "node")
+	require.Nil(t, items)
+}
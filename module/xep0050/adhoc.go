@@ -0,0 +1,274 @@
+/*
+ * Copyright (c) 2018 Miguel Ángel Ortuño.
+ * See the LICENSE file for more information.
+ */
+
+package xep0050
+
+import (
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/ortuman/jackal/module/xep0004"
+	"github.com/ortuman/jackal/module/xep0030"
+	"github.com/ortuman/jackal/router"
+	"github.com/ortuman/jackal/runqueue"
+	"github.com/ortuman/jackal/xmpp"
+	"github.com/ortuman/jackal/xmpp/jid"
+	"github.com/pborman/uuid"
+)
+
+const (
+	commandsNamespace = "http://jabber.org/protocol/commands"
+	formNamespace     = "jabber:x:data"
+)
+
+const sessionTimeout = time.Minute * 10
+
+// AdHoc represents an ad-hoc commands server stream module.
+type AdHoc struct {
+	router    *router.Router
+	discoInfo *xep0030.DiscoInfo
+	mu        sync.RWMutex
+	commands  map[string]*Command
+	sessions  map[string]*Session
+	runQueue  *runqueue.RunQueue
+}
+
+// New returns an ad-hoc commands IQ handler module.
+func New(disco *xep0030.DiscoInfo, router *router.Router) *AdHoc {
+	x := &AdHoc{
+		router:    router,
+		discoInfo: disco,
+		commands:  make(map[string]*Command),
+		sessions:  make(map[string]*Session),
+		runQueue:  runqueue.New("xep0050"),
+	}
+	if disco != nil {
+		disco.RegisterServerFeature(commandsNamespace)
+		disco.RegisterServerNodeProvider(commandsNamespace, &commandsProvider{x: x})
+	}
+	return x
+}
+
+// RegisterCommand registers a new ad-hoc command making it available to authorized requesters.
+func (x *AdHoc) RegisterCommand(cmd *Command) {
+	x.mu.Lock()
+	x.commands[cmd.Node] = cmd
+	x.mu.Unlock()
+
+	if x.discoInfo != nil {
+		x.discoInfo.RegisterServerNodeProvider(cmd.Node, &commandsProvider{x: x})
+	}
+}
+
+// UnregisterCommand unregisters a previously registered ad-hoc command.
+func (x *AdHoc) UnregisterCommand(node string) {
+	x.mu.Lock()
+	delete(x.commands, node)
+	x.mu.Unlock()
+
+	if x.discoInfo != nil {
+		x.discoInfo.UnregisterServerNodeProvider(node)
+	}
+}
+
+// MatchesIQ returns whether or not an IQ should be
+// processed by the ad-hoc commands module.
+func (x *AdHoc) MatchesIQ(iq *xmpp.IQ) bool {
+	return iq.IsSet() && iq.ToJID().IsServer() && iq.Elements().ChildNamespace("command", commandsNamespace) != nil
+}
+
+// ProcessIQ processes an ad-hoc command IQ taking according actions
+// over the associated stream.
+func (x *AdHoc) ProcessIQ(iq *xmpp.IQ) {
+	x.runQueue.Run(func() {
+		x.processIQ(iq)
+	})
+}
+
+// Shutdown shuts down ad-hoc commands module.
+func (x *AdHoc) Shutdown() error {
+	c := make(chan struct{})
+	x.runQueue.Stop(func() {
+		if x.discoInfo != nil {
+			x.discoInfo.UnregisterServerFeature(commandsNamespace)
+			x.discoInfo.UnregisterServerNodeProvider(commandsNamespace)
+			for _, cmd := range x.allowedCommands(nil) {
+				x.discoInfo.UnregisterServerNodeProvider(cmd.Node)
+			}
+		}
+		close(c)
+	})
+	<-c
+	return nil
+}
+
+func (x *AdHoc) processIQ(iq *xmpp.IQ) {
+	cmdEl := iq.Elements().ChildNamespace("command", commandsNamespace)
+	node := cmdEl.Attributes().Get("node")
+	sessionID := cmdEl.Attributes().Get("sessionid")
+	action := cmdEl.Attributes().Get("action")
+
+	fromJID := iq.FromJID()
+	if !x.router.IsLocalHost(fromJID.Domain()) {
+		_ = x.router.Route(iq.ForbiddenError())
+		return
+	}
+	x.mu.RLock()
+	cmd := x.commands[node]
+	x.mu.RUnlock()
+	if cmd == nil {
+		_ = x.router.Route(iq.ItemNotFoundError())
+		return
+	}
+	if cmd.IsAllowed != nil && !cmd.IsAllowed(fromJID) {
+		_ = x.router.Route(iq.ForbiddenError())
+		return
+	}
+	var form *xep0004.DataForm
+	if formEl := cmdEl.Elements().ChildNamespace("x", formNamespace); formEl != nil {
+		f, err := xep0004.NewFormFromElement(formEl)
+		if err != nil {
+			_ = x.router.Route(iq.BadRequestError())
+			return
+		}
+		form = f
+	}
+	x.purgeExpiredSessions()
+
+	// start a new command execution
+	if len(sessionID) == 0 {
+		if action != "" && action != ActionExecute {
+			_ = x.router.Route(commandError(iq, xmpp.ErrBadRequest, "bad-action"))
+			return
+		}
+		sess := &Session{
+			ID:        uuid.New(),
+			Node:      node,
+			Requester: fromJID,
+			Values:    make(map[string][]string),
+		}
+		x.sessions[sess.ID] = sess
+		x.execute(iq, cmd, sess, nil)
+		return
+	}
+	sess := x.sessions[sessionID]
+	if sess == nil || sess.Node != node || !sess.Requester.Matches(fromJID, jid.MatchesFull) {
+		_ = x.router.Route(commandError(iq, xmpp.ErrBadRequest, "bad-sessionid"))
+		return
+	}
+	if form != nil && form.Type == xep0004.Cancel {
+		action = ActionCancel
+	}
+	switch action {
+	case ActionCancel:
+		delete(x.sessions, sess.ID)
+		x.sendResponse(iq, sess, &Response{Status: StatusCanceled})
+		return
+
+	case ActionPrev:
+		if !x.isAllowedAction(sess, action) || sess.Stage == 0 {
+			_ = x.router.Route(commandError(iq, xmpp.ErrBadRequest, "bad-action"))
+			return
+		}
+		sess.Stage--
+		x.execute(iq, cmd, sess, nil)
+
+	case "", ActionExecute, ActionNext, ActionComplete:
+		if !x.isAllowedAction(sess, action) {
+			_ = x.router.Route(commandError(iq, xmpp.ErrBadRequest, "bad-action"))
+			return
+		}
+		if form != nil {
+			for _, field := range form.Fields {
+				sess.Values[field.Var] = field.Values
+			}
+		}
+		sess.Stage++
+		x.execute(iq, cmd, sess, form)
+
+	default:
+		_ = x.router.Route(commandError(iq, xmpp.ErrBadRequest, "malformed-action"))
+	}
+}
+
+func (x *AdHoc) execute(iq *xmpp.IQ, cmd *Command, sess *Session, form *xep0004.DataForm) {
+	resp, sErr := cmd.Execute(sess, form)
+	if sErr != nil {
+		delete(x.sessions, sess.ID)
+		_ = x.router.Route(xmpp.NewErrorStanzaFromStanza(iq, sErr, nil))
+		return
+	}
+	if resp.Status != StatusExecuting {
+		delete(x.sessions, sess.ID)
+	} else {
+		sess.actions = resp.Actions
+		sess.expiresAt = time.Now().Add(sessionTimeout)
+	}
+	x.sendResponse(iq, sess, resp)
+}
+
+func (x *AdHoc) sendResponse(iq *xmpp.IQ, sess *Session, resp *Response) {
+	cmdEl := resp.element()
+	cmdEl.SetAttribute("node", sess.Node)
+	cmdEl.SetAttribute("sessionid", sess.ID)
+	cmdEl.SetAttribute("status", resp.Status)
+
+	res := iq.ResultIQ()
+	res.AppendElement(cmdEl)
+	_ = x.router.Route(res)
+}
+
+func (x *AdHoc) isAllowedAction(sess *Session, action string) bool {
+	switch action {
+	case "", ActionExecute:
+		return true
+	}
+	for _, allowed := range sess.actions {
+		if allowed == action {
+			return true
+		}
+	}
+	// completing a command is always allowed whenever no actions were offered
+	return action == ActionComplete && len(sess.actions) == 0
+}
+
+func (x *AdHoc) purgeExpiredSessions() {
+	now := time.Now()
+	for id, sess := range x.sessions {
+		if !sess.expiresAt.IsZero() && now.After(sess.expiresAt) {
+			delete(x.sessions, id)
+		}
+	}
+}
+
+// allowedCommands returns all registered commands a requester is allowed to execute, sorted by node.
+// A nil requester returns every registered command.
+func (x *AdHoc) allowedCommands(requester *jid.JID) []*Command {
+	x.mu.RLock()
+	defer x.mu.RUnlock()
+	var ret []*Command
+	for _, cmd := range x.commands {
+		if requester != nil && cmd.IsAllowed != nil && !cmd.IsAllowed(requester) {
+			continue
+		}
+		ret = append(ret, cmd)
+	}
+	sort.Slice(ret, func(i, j int) bool { return ret[i].Node < ret[j].Node })
+	return ret
+}
+
+func (x *AdHoc) command(node string) *Command {
+	x.mu.RLock()
+	defer x.mu.RUnlock()
+	return x.commands[node]
+}
+
+// commandError returns an error stanza including an ad-hoc command specific error condition.
+func commandError(iq *xmpp.IQ, stanzaErr *xmpp.StanzaError, condition string) xmpp.Stanza {
+	return xmpp.NewErrorStanzaFromStanza(iq, stanzaErr, []xmpp.XElement{
+		xmpp.NewElementNamespace(condition, commandsNamespace),
+	})
+}
@@ -0,0 +1,282 @@
+/*
+ * Copyright (c) 2018 Miguel Ángel Ortuño.
+ * See the LICENSE file for more information.
+ */
+
+package xep0050
+
+import (
+	"crypto/tls"
+	"testing"
+
+	"github.com/ortuman/jackal/module/xep0004"
+	"github.com/ortuman/jackal/module/xep0030"
+	"github.com/ortuman/jackal/router"
+	"github.com/ortuman/jackal/storage"
+	"github.com/ortuman/jackal/storage/memstorage"
+	"github.com/ortuman/jackal/stream"
+	"github.com/ortuman/jackal/xmpp"
+	"github.com/ortuman/jackal/xmpp/jid"
+	"github.com/pborman/uuid"
+	"github.com/stretchr/testify/require"
+)
+
+const testNode = "http://jackal.im/commands#echo"
+
+func TestXEP0050_Matching(t *testing.T) {
+	rtr, shutdown := setupTest("jackal.im")
+	defer shutdown()
+
+	x := New(nil, rtr)
+	defer x.Shutdown()
+
+	j, _ := jid.New("ortuman", "jackal.im", "balcony", true)
+	srvJID, _ := jid.New("", "jackal.im", "", true)
+
+	iq := xmpp.NewIQType(uuid.New(), xmpp.GetType)
+	iq.SetFromJID(j)
+	iq.SetToJID(srvJID)
+	iq.AppendElement(xmpp.NewElementNamespace("command", commandsNamespace))
+	require.False(t, x.MatchesIQ(iq))
+
+	iq.SetType(xmpp.SetType)
+	require.True(t, x.MatchesIQ(iq))
+
+	iq.SetToJID(j.ToBareJID())
+	require.False(t, x.MatchesIQ(iq))
+}
+
+func TestXEP0050_DiscoItems(t *testing.T) {
+	rtr, shutdown := setupTest("jackal.im")
+	defer shutdown()
+
+	disco := xep0030.New(rtr)
+	defer disco.Shutdown()
+
+	x := New(disco, rtr)
+	defer x.Shutdown()
+
+	x.RegisterCommand(testCommand())
+	x.RegisterCommand(&Command{
+		Node:      "http://jackal.im/commands#restricted",
+		Name:      "Restricted",
+		IsAllowed: func(requester *jid.JID) bool { return requester.Node() == "admin" },
+		Execute:   func(sess *Session, form *xep0004.DataForm) (*Response, *xmpp.StanzaError) { return nil, nil },
+	})
+
+	j, _ := jid.New("ortuman", "jackal.im", "balcony", true)
+	srvJID, _ := jid.New("", "jackal.im", "", true)
+
+	stm := stream.NewMockC2S(uuid.New(), j)
+	rtr.Bind(stm)
+
+	iq := xmpp.NewIQType(uuid.New(), xmpp.GetType)
+	iq.SetFromJID(j)
+	iq.SetToJID(srvJID)
+	q := xmpp.NewElementNamespace("query", "http://jabber.org/protocol/disco#items")
+	q.SetAttribute("node", commandsNamespace)
+	iq.AppendElement(q)
+
+	disco.ProcessIQ(iq)
+	elem := stm.ReceiveElement()
+	require.Equal(t, xmpp.ResultType, elem.Type())
+	items := elem.Elements().Child("query").Elements().Children("item")
+	require.Len(t, items, 1)
+	require.Equal(t, testNode, items[0].Attributes().Get("node"))
+	require.Equal(t, "Echo", items[0].Attributes().Get("name"))
+
+	iq = xmpp.NewIQType(uuid.New(), xmpp.GetType)
+	iq.SetFromJID(j)
+	iq.SetToJID(srvJID)
+	q = xmpp.NewElementNamespace("query", "http://jabber.org/protocol/disco#info")
+	q.SetAttribute("node", testNode)
+	iq.AppendElement(q)
+
+	disco.ProcessIQ(iq)
+	elem = stm.ReceiveElement()
+	require.Equal(t, xmpp.ResultType, elem.Type())
+	identity := elem.Elements().Child("query").Elements().Child("identity")
+	require.NotNil(t, identity)
+	require.Equal(t, "command-node", identity.Attributes().Get("type"))
+
+	x.UnregisterCommand(testNode)
+
+	disco.ProcessIQ(iq)
+	elem = stm.ReceiveElement()
+	require.Equal(t, xmpp.ErrorType, elem.Type())
+}
+
+func TestXEP0050_Execute(t *testing.T) {
+	rtr, shutdown := setupTest("jackal.im")
+	defer shutdown()
+
+	x := New(nil, rtr)
+	defer x.Shutdown()
+
+	x.RegisterCommand(testCommand())
+
+	j, _ := jid.New("ortuman", "jackal.im", "balcony", true)
+	stm := stream.NewMockC2S(uuid.New(), j)
+	rtr.Bind(stm)
+
+	// unknown node
+	x.ProcessIQ(commandIQ(j, "http://jackal.im/commands#foo", "", "", nil))
+	elem := stm.ReceiveElement()
+	require.Equal(t, xmpp.ErrorType, elem.Type())
+	require.Equal(t, xmpp.ErrItemNotFound.Error(), elem.Error().Elements().All()[0].Name())
+
+	// first stage
+	x.ProcessIQ(commandIQ(j, testNode, "", "", nil))
+	elem = stm.ReceiveElement()
+	require.Equal(t, xmpp.ResultType, elem.Type())
+	cmdEl := elem.Elements().ChildNamespace("command", commandsNamespace)
+	require.Equal(t, StatusExecuting, cmdEl.Attributes().Get("status"))
+	require.Equal(t, ActionComplete, cmdEl.Elements().Child("actions").Attributes().Get("execute"))
+	require.NotNil(t, cmdEl.Elements().ChildNamespace("x", formNamespace))
+
+	sessionID := cmdEl.Attributes().Get("sessionid")
+	require.NotEmpty(t, sessionID)
+
+	// not offered action
+	x.ProcessIQ(commandIQ(j, testNode, sessionID, ActionNext, nil))
+	elem = stm.ReceiveElement()
+	require.Equal(t, xmpp.ErrorType, elem.Type())
+	require.NotNil(t, elem.Error().Elements().ChildNamespace("bad-action", commandsNamespace))
+
+	// session owned by another requester
+	j2, _ := jid.New("ortuman", "jackal.im", "garden", true)
+	stm2 := stream.NewMockC2S(uuid.New(), j2)
+	rtr.Bind(stm2)
+
+	x.ProcessIQ(commandIQ(j2, testNode, sessionID, ActionComplete, nil))
+	elem = stm2.ReceiveElement()
+	require.Equal(t, xmpp.ErrorType, elem.Type())
+	require.NotNil(t, elem.Error().Elements().ChildNamespace("bad-sessionid", commandsNamespace))
+
+	// complete
+	form := &xep0004.DataForm{
+		Type:   xep0004.Submit,
+		Fields: []xep0004.Field{{Var: "text", Values: []string{"hi!"}}},
+	}
+	x.ProcessIQ(commandIQ(j, testNode, sessionID, ActionComplete, form))
+	elem = stm.ReceiveElement()
+	require.Equal(t, xmpp.ResultType, elem.Type())
+	cmdEl = elem.Elements().ChildNamespace("command", commandsNamespace)
+	require.Equal(t, StatusCompleted, cmdEl.Attributes().Get("status"))
+	require.Equal(t, "hi!", cmdEl.Elements().Child("note").Text())
+
+	// session already finished
+	x.ProcessIQ(commandIQ(j, testNode, sessionID, ActionComplete, form))
+	elem = stm.ReceiveElement()
+	require.Equal(t, xmpp.ErrorType, elem.Type())
+	require.NotNil(t, elem.Error().Elements().ChildNamespace("bad-sessionid", commandsNamespace))
+}
+
+func TestXEP0050_Cancel(t *testing.T) {
+	rtr, shutdown := setupTest("jackal.im")
+	defer shutdown()
+
+	x := New(nil, rtr)
+	defer x.Shutdown()
+
+	x.RegisterCommand(testCommand())
+
+	j, _ := jid.New("ortuman", "jackal.im", "balcony", true)
+	stm := stream.NewMockC2S(uuid.New(), j)
+	rtr.Bind(stm)
+
+	x.ProcessIQ(commandIQ(j, testNode, "", ActionExecute, nil))
+	elem := stm.ReceiveElement()
+	sessionID := elem.Elements().ChildNamespace("command", commandsNamespace).Attributes().Get("sessionid")
+
+	x.ProcessIQ(commandIQ(j, testNode, sessionID, ActionCancel, nil))
+	elem = stm.ReceiveElement()
+	require.Equal(t, xmpp.ResultType, elem.Type())
+	require.Equal(t, StatusCanceled, elem.Elements().ChildNamespace("command", commandsNamespace).Attributes().Get("status"))
+
+	x.ProcessIQ(commandIQ(j, testNode, sessionID, ActionComplete, nil))
+	elem = stm.ReceiveElement()
+	require.Equal(t, xmpp.ErrorType, elem.Type())
+
+	// malformed action
+	x.ProcessIQ(commandIQ(j, testNode, "", "foo", nil))
+	elem = stm.ReceiveElement()
+	require.Equal(t, xmpp.ErrorType, elem.Type())
+	require.NotNil(t, elem.Error().Elements().ChildNamespace("bad-action", commandsNamespace))
+}
+
+func TestXEP0050_Forbidden(t *testing.T) {
+	rtr, shutdown := setupTest("jackal.im")
+	defer shutdown()
+
+	x := New(nil, rtr)
+	defer x.Shutdown()
+
+	cmd := testCommand()
+	cmd.IsAllowed = func(requester *jid.JID) bool { return false }
+	x.RegisterCommand(cmd)
+
+	j, _ := jid.New("ortuman", "jackal.im", "balcony", true)
+	stm := stream.NewMockC2S(uuid.New(), j)
+	rtr.Bind(stm)
+
+	x.ProcessIQ(commandIQ(j, testNode, "", "", nil))
+	elem := stm.ReceiveElement()
+	require.Equal(t, xmpp.ErrorType, elem.Type())
+	require.Equal(t, xmpp.ErrForbidden.Error(), elem.Error().Elements().All()[0].Name())
+}
+
+func testCommand() *Command {
+	return &Command{
+		Node: testNode,
+		Name: "Echo",
+		Execute: func(sess *Session, form *xep0004.DataForm) (*Response, *xmpp.StanzaError) {
+			if sess.Stage == 0 {
+				return &Response{
+					Status:  StatusExecuting,
+					Actions: []string{ActionComplete},
+					Form: &xep0004.DataForm{
+						Type:   xep0004.Form,
+						Fields: []xep0004.Field{{Var: "text", Type: xep0004.TextSingle}},
+					},
+				}, nil
+			}
+			return &Response{
+				Status: StatusCompleted,
+				Notes:  []Note{{Type: NoteInfo, Text: sess.Value("text")}},
+			}, nil
+		},
+	}
+}
+
+func commandIQ(from *jid.JID, node, sessionID, action string, form *xep0004.DataForm) *xmpp.IQ {
+	srvJID, _ := jid.New("", from.Domain(), "", true)
+
+	cmd := xmpp.NewElementNamespace("command", commandsNamespace)
+	cmd.SetAttribute("node", node)
+	if len(sessionID) > 0 {
+		cmd.SetAttribute("sessionid", sessionID)
+	}
+	if len(action) > 0 {
+		cmd.SetAttribute("action", action)
+	}
+	if form != nil {
+		cmd.AppendElement(form.Element())
+	}
+	iq := xmpp.NewIQType(uuid.New(), xmpp.SetType)
+	iq.SetFromJID(from)
+	iq.SetToJID(srvJID)
+	iq.AppendElement(cmd)
+	return iq
+}
+
+func setupTest(domain string) (*router.Router, func()) {
+	r, _ := router.New(&router.Config{
+		Hosts: []router.HostConfig{{Name: domain, Certificate: tls.Certificate{}}},
+	})
+	s := memstorage.New()
+	storage.Set(s)
+	return r, func() {
+		storage.Unset()
+	}
+}
@@ -0,0 +1,146 @@
+/*
+ * Copyright (c) 2018 Miguel Ángel Ortuño.
+ * See the LICENSE file for more information.
+ */
+
+package xep0050
+
+import (
+	"time"
+
+	"github.com/ortuman/jackal/module/xep0004"
+	"github.com/ortuman/jackal/xmpp"
+	"github.com/ortuman/jackal/xmpp/jid"
+)
+
+const (
+	// ActionExecute represents 'execute' command action.
+	ActionExecute = "execute"
+
+	// ActionNext represents 'next' command action.
+	ActionNext = "next"
+
+	// ActionPrev represents 'prev' command action.
+	ActionPrev = "prev"
+
+	// ActionComplete represents 'complete' command action.
+	ActionComplete = "complete"
+
+	// ActionCancel represents 'cancel' command action.
+	ActionCancel = "cancel"
+)
+
+const (
+	// StatusExecuting represents 'executing' command status.
+	StatusExecuting = "executing"
+
+	// StatusCompleted represents 'completed' command status.
+	StatusCompleted = "completed"
+
+	// StatusCanceled represents 'canceled' command status.
+	StatusCanceled = "canceled"
+)
+
+const (
+	// NoteInfo represents an 'info' command note.
+	NoteInfo = "info"
+
+	// NoteWarn represents a 'warn' command note.
+	NoteWarn = "warn"
+
+	// NoteError represents an 'error' command note.
+	NoteError = "error"
+)
+
+// Command represents an ad-hoc command entity.
+type Command struct {
+	// Node is the command node identifier.
+	Node string
+
+	// Name is the command human readable name.
+	Name string
+
+	// IsAllowed returns whether or not a requester is allowed to execute the command.
+	// A nil value allows every local user to execute it.
+	IsAllowed func(requester *jid.JID) bool
+
+	// Execute processes a command execution stage.
+	// Submitted form will be nil for the initial stage and whenever
+	// the requester goes back to a previous one.
+	Execute func(sess *Session, form *xep0004.DataForm) (*Response, *xmpp.StanzaError)
+}
+
+// Session represents an ongoing multi-stage command execution.
+type Session struct {
+	// ID is the command session identifier.
+	ID string
+
+	// Node is the executing command node.
+	Node string
+
+	// Requester is the command requester full JID.
+	Requester *jid.JID
+
+	// Stage is the current execution stage, starting at zero.
+	Stage int
+
+	// Values contains all field values submitted so far.
+	Values map[string][]string
+
+	actions   []string
+	expiresAt time.Time
+}
+
+// Value returns the first submitted value associated to a form field.
+func (s *Session) Value(field string) string {
+	if values := s.Values[field]; len(values) > 0 {
+		return values[0]
+	}
+	return ""
+}
+
+// Note represents an ad-hoc command note.
+type Note struct {
+	Type string
+	Text string
+}
+
+// Response represents an ad-hoc command execution stage response.
+type Response struct {
+	// Status is the command execution status.
+	Status string
+
+	// Form is the data form sent back to the requester.
+	Form *xep0004.DataForm
+
+	// Actions contains the actions the requester can take next,
+	// being the first one the default action.
+	Actions []string
+
+	// Notes contains the notes sent back to the requester.
+	Notes []Note
+}
+
+func (r *Response) element() *xmpp.Element {
+	var elems []xmpp.XElement
+	if r.Status == StatusExecuting && len(r.Actions) > 0 {
+		actions := xmpp.NewElementName("actions")
+		actions.SetAttribute("execute", r.Actions[0])
+		for _, action := range r.Actions {
+			actions.AppendElement(xmpp.NewElementName(action))
+		}
+		elems = append(elems, actions)
+	}
+	for _, note := range r.Notes {
+		noteEl := xmpp.NewElementName("note")
+		noteEl.SetAttribute("type", note.Type)
+		noteEl.SetText(note.Text)
+		elems = append(elems, noteEl)
+	}
+	if r.Form != nil {
+		elems = append(elems, r.Form.Element())
+	}
+	cmd := xmpp.NewElementNamespace("command", commandsNamespace)
+	cmd.AppendElements(elems)
+	return cmd
+}
@@ -0,0 +1,48 @@
+/*
+ * Copyright (c) 2018 Miguel Ángel Ortuño.
+ * See the LICENSE file for more information.
+ */
+
+package xep0050
+
+import (
+	"testing"
+
+	"github.com/ortuman/jackal/module/xep0004"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSession_Value(t *testing.T) {
+	sess := &Session{Values: map[string][]string{"a": {"1", "2"}, "b": {}}}
+	require.Equal(t, "1", sess.Value("a"))
+	require.Equal(t, "", sess.Value("b"))
+	require.Equal(t, "", sess.Value("c"))
+}
+
+func TestResponse_Element(t *testing.T) {
+	resp := &Response{
+		Status:  StatusExecuting,
+		Actions: []string{ActionNext, ActionPrev},
+		Notes:   []Note{{Type: NoteWarn, Text: "careful"}},
+		Form:    &xep0004.DataForm{Type: xep0004.Form},
+	}
+	elem := resp.element()
+	require.Equal(t, "command", elem.Name())
+	require.Equal(t, commandsNamespace, elem.Namespace())
+
+	actions := elem.Elements().Child("actions")
+	require.NotNil(t, actions)
+	require.Equal(t, ActionNext, actions.Attributes().Get("execute"))
+	require.Len(t, actions.Elements().All(), 2)
+
+	note := elem.Elements().Child("note")
+	require.NotNil(t, note)
+	require.Equal(t, NoteWarn, note.Attributes().Get("type"))
+	require.Equal(t, "careful", note.Text())
+
+	require.NotNil(t, elem.Elements().ChildNamespace("x", formNamespace))
+
+	// completed commands don't offer actions
+	resp.Status = StatusCompleted
+	require.Nil(t, resp.element().Elements().Child("actions"))
+}
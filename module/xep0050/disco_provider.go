@@ -0,0 +1,61 @@
+/*
+ * Copyright (c) 2018 Miguel Ángel Ortuño.
+ * See the LICENSE file for more information.
+ */
+
+package xep0050
+
+import (
+	"github.com/ortuman/jackal/module/xep0004"
+	"github.com/ortuman/jackal/module/xep0030"
+	"github.com/ortuman/jackal/xmpp"
+	"github.com/ortuman/jackal/xmpp/jid"
+)
+
+type commandsProvider struct {
+	x *AdHoc
+}
+
+func (p *commandsProvider) Identities(toJID, fromJID *jid.JID, node string) []xep0030.Identity {
+	if node == commandsNamespace {
+		return []xep0030.Identity{{Category: "automation", Type: "command-list"}}
+	}
+	cmd := p.allowedCommand(fromJID, node)
+	if cmd == nil {
+		return nil
+	}
+	return []xep0030.Identity{{Category: "automation", Type: "command-node", Name: cmd.Name}}
+}
+
+func (p *commandsProvider) Items(toJID, fromJID *jid.JID, node string) ([]xep0030.Item, *xmpp.StanzaError) {
+	if node != commandsNamespace {
+		return nil, nil
+	}
+	var items []xep0030.Item
+	for _, cmd := range p.x.allowedCommands(fromJID) {
+		items = append(items, xep0030.Item{Jid: toJID.String(), Node: cmd.Node, Name: cmd.Name})
+	}
+	return items, nil
+}
+
+func (p *commandsProvider) Features(toJID, fromJID *jid.JID, node string) ([]xep0030.Feature, *xmpp.StanzaError) {
+	if node == commandsNamespace {
+		return []xep0030.Feature{commandsNamespace}, nil
+	}
+	if p.allowedCommand(fromJID, node) == nil {
+		return nil, xmpp.ErrItemNotFound
+	}
+	return []xep0030.Feature{commandsNamespace, formNamespace}, nil
+}
+
+func (p *commandsProvider) Form(toJID, fromJID *jid.JID, node string) (*xep0004.DataForm, *xmpp.StanzaError) {
+	return nil, nil
+}
+
+func (p *commandsProvider) allowedCommand(fromJID *jid.JID, node string) *Command {
+	cmd := p.x.command(node)
+	if cmd == nil || (cmd.IsAllowed != nil && !cmd.IsAllowed(fromJID)) {
+		return nil
+	}
+	return cmd
+}
@@ -156,9 +156,13 @@ func (x *Register) registerNewUser(iq *xmpp.IQ, query xmpp.XElement, stm stream.
 	}
 	user := model.User{
 		Username:     userEl.Text(),
-		Password:     passwordEl.Text(),
 		LastPresence: xmpp.NewPresence(stm.JID(), stm.JID(), xmpp.UnavailableType),
 	}
+	if err := user.SetPassword(passwordEl.Text()); err != nil {
+		log.Error(err)
+		stm.SendElement(iq.InternalServerError())
+		return
+	}
 	if err := storage.InsertOrUpdateUser(&user); err != nil {
 		log.Error(err)
 		stm.SendElement(iq.InternalServerError())
@@ -209,8 +213,12 @@ func (x *Register) changePassword(password string, username string, iq *xmpp.IQ,
 		stm.SendElement(iq.ResultIQ())
 		return
 	}
-	if user.Password != password {
-		user.Password = password
+	if !user.HasScramCredentials() || !user.VerifyPassword(password) {
+		if err := user.SetPassword(password); err != nil {
+			log.Error(err)
+			stm.SendElement(iq.InternalServerError())
+			return
+		}
 		if err := storage.InsertOrUpdateUser(user); err != nil {
 			log.Error(err)
 			stm.SendElement(iq.InternalServerError())
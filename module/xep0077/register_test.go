@@ -197,6 +197,12 @@ func TestXEP0077_RegisterUser(t *testing.T) {
 
 	usr, _ := storage.FetchUser("ortuman")
 	require.NotNil(t, usr)
+
+	usr, _ = storage.FetchUser("juliet")
+	require.NotNil(t, usr)
+	require.True(t, usr.HasScramCredentials())
+	require.Equal(t, "", usr.Password)
+	require.True(t, usr.VerifyPassword("5678"))
 }
 
 func TestXEP0077_CancelRegistration(t *testing.T) {
@@ -315,7 +321,7 @@ func TestXEP0077_ChangePassword(t *testing.T) {
 
 	usr, _ := storage.FetchUser("ortuman")
 	require.NotNil(t, usr)
-	require.Equal(t, "5678", usr.Password)
+	require.True(t, usr.VerifyPassword("5678"))
 }
 
 func setupTest(domain string) (*router.Router, *memstorage.Storage, func()) {
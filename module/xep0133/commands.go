@@ -0,0 +1,240 @@
+/*
+ * Copyright (c) 2018 Miguel Ángel Ortuño.
+ * See the LICENSE file for more information.
+ */
+
+package xep0133
+
+import (
+	"fmt"
+	"strings"
+
+	streamerror "github.com/ortuman/jackal/errors"
+	"github.com/ortuman/jackal/log"
+	"github.com/ortuman/jackal/model"
+	"github.com/ortuman/jackal/module/xep0004"
+	"github.com/ortuman/jackal/module/xep0050"
+	"github.com/ortuman/jackal/storage"
+	"github.com/ortuman/jackal/stream"
+	"github.com/ortuman/jackal/xmpp"
+	"github.com/ortuman/jackal/xmpp/jid"
+)
+
+func (x *ServiceAdmin) commands() []*xep0050.Command {
+	return []*xep0050.Command{
+		x.formCommand("add-user", "Add a User", []xep0004.Field{
+			{Var: "accountjid", Type: xep0004.JidSingle, Label: "The Jabber ID for the account to be added", Required: true},
+			{Var: "password", Type: xep0004.TextPrivate, Label: "The password for this account", Required: true},
+			{Var: "password-verify", Type: xep0004.TextPrivate, Label: "Retype password", Required: true},
+		}, x.addUser),
+
+		x.formCommand("delete-user", "Delete a User", []xep0004.Field{
+			{Var: "accountjids", Type: xep0004.JidMulti, Label: "The Jabber ID(s) to delete", Required: true},
+		}, x.deleteUser),
+
+		x.formCommand("change-user-password", "Change User Password", []xep0004.Field{
+			{Var: "accountjid", Type: xep0004.JidSingle, Label: "The Jabber ID for this account", Required: true},
+			{Var: "password", Type: xep0004.TextPrivate, Label: "The new password for this account", Required: true},
+		}, x.changeUserPassword),
+
+		{
+			Node:      adminNamespace + "#get-online-users-list",
+			Name:      "Get List of Online Users",
+			IsAllowed: x.IsAdmin,
+			Execute: func(sess *xep0050.Session, _ *xep0004.DataForm) (*xep0050.Response, *xmpp.StanzaError) {
+				return x.getOnlineUsers(sess)
+			},
+		},
+
+		x.formCommand("end-user-session", "End User Session", []xep0004.Field{
+			{Var: "accountjids", Type: xep0004.JidMulti, Label: "The Jabber ID(s) for which to end sessions", Required: true},
+		}, x.endUserSession),
+
+		x.formCommand("announce", "Send Announcement to Online Users", []xep0004.Field{
+			{Var: "subject", Type: xep0004.TextSingle, Label: "Subject"},
+			{Var: "announcement", Type: xep0004.TextMulti, Label: "Announcement", Required: true},
+		}, x.announce),
+
+		x.formCommand("set-motd", "Set Message of the Day", []xep0004.Field{
+			{Var: "motd", Type: xep0004.TextMulti, Label: "Message of the Day", Required: true},
+		}, x.setMOTD),
+
+		{
+			Node:      adminNamespace + "#delete-motd",
+			Name:      "Delete Message of the Day",
+			IsAllowed: x.IsAdmin,
+			Execute: func(_ *xep0050.Session, _ *xep0004.DataForm) (*xep0050.Response, *xmpp.StanzaError) {
+				x.setMessageOfTheDay("")
+				return completed("Message of the day has been deleted."), nil
+			},
+		},
+	}
+}
+
+func (x *ServiceAdmin) addUser(sess *xep0050.Session) (*xep0050.Response, *xmpp.StanzaError) {
+	accountJID, sErr := x.localAccountJID(sess.Value("accountjid"))
+	if sErr != nil {
+		return nil, sErr
+	}
+	password := sess.Value("password")
+	if password != sess.Value("password-verify") {
+		return nil, xmpp.ErrNotAcceptable
+	}
+	exists, err := storage.UserExists(accountJID.Node())
+	if err != nil {
+		log.Error(err)
+		return nil, xmpp.ErrInternalServerError
+	}
+	if exists {
+		return nil, xmpp.ErrConflict
+	}
+	user := model.User{
+		Username:     accountJID.Node(),
+		LastPresence: xmpp.NewPresence(accountJID, accountJID, xmpp.UnavailableType),
+	}
+	if err := user.SetPassword(password); err != nil {
+		log.Error(err)
+		return nil, xmpp.ErrInternalServerError
+	}
+	if err := storage.InsertOrUpdateUser(&user); err != nil {
+		log.Error(err)
+		return nil, xmpp.ErrInternalServerError
+	}
+	log.Infof("xep0133: %s added user %s", sess.Requester.ToBareJID().String(), user.Username)
+	return completed(fmt.Sprintf("User %s has been added.", accountJID.String())), nil
+}
+
+func (x *ServiceAdmin) deleteUser(sess *xep0050.Session) (*xep0050.Response, *xmpp.StanzaError) {
+	accountJIDs, sErr := x.localAccountJIDs(sess.Values["accountjids"])
+	if sErr != nil {
+		return nil, sErr
+	}
+	for _, accountJID := range accountJIDs {
+		if err := storage.DeleteUser(accountJID.Node()); err != nil {
+			log.Error(err)
+			return nil, xmpp.ErrInternalServerError
+		}
+		x.disconnectStreams(accountJID, streamerror.ErrNotAuthorized)
+		log.Infof("xep0133: %s deleted user %s", sess.Requester.ToBareJID().String(), accountJID.Node())
+	}
+	return completed(fmt.Sprintf("%d user(s) have been deleted.", len(accountJIDs))), nil
+}
+
+func (x *ServiceAdmin) changeUserPassword(sess *xep0050.Session) (*xep0050.Response, *xmpp.StanzaError) {
+	accountJID, sErr := x.localAccountJID(sess.Value("accountjid"))
+	if sErr != nil {
+		return nil, sErr
+	}
+	user, err := storage.FetchUser(accountJID.Node())
+	if err != nil {
+		log.Error(err)
+		return nil, xmpp.ErrInternalServerError
+	}
+	if user == nil {
+		return nil, xmpp.ErrItemNotFound
+	}
+	if err := user.SetPassword(sess.Value("password")); err != nil {
+		log.Error(err)
+		return nil, xmpp.ErrInternalServerError
+	}
+	if err := storage.InsertOrUpdateUser(user); err != nil {
+		log.Error(err)
+		return nil, xmpp.ErrInternalServerError
+	}
+	log.Infof("xep0133: %s changed password for user %s", sess.Requester.ToBareJID().String(), user.Username)
+	return completed(fmt.Sprintf("Password for %s has been changed.", accountJID.String())), nil
+}
+
+func (x *ServiceAdmin) getOnlineUsers(sess *xep0050.Session) (*xep0050.Response, *xmpp.StanzaError) {
+	usernames, err := storage.FetchUsernames()
+	if err != nil {
+		log.Error(err)
+		return nil, xmpp.ErrInternalServerError
+	}
+	var onlineJIDs []string
+	for _, username := range usernames {
+		if len(x.router.UserStreams(username)) == 0 {
+			continue
+		}
+		onlineJIDs = append(onlineJIDs, username+"@"+sess.Requester.Domain())
+	}
+	form := adminForm("Online Users", []xep0004.Field{
+		{Var: "onlineuserjids", Type: xep0004.JidMulti, Label: "The list of all online users", Values: onlineJIDs},
+	})
+	form.Type = xep0004.Result
+	return &xep0050.Response{Status: xep0050.StatusCompleted, Form: form}, nil
+}
+
+func (x *ServiceAdmin) endUserSession(sess *xep0050.Session) (*xep0050.Response, *xmpp.StanzaError) {
+	accountJIDs, sErr := x.localAccountJIDs(sess.Values["accountjids"])
+	if sErr != nil {
+		return nil, sErr
+	}
+	for _, accountJID := range accountJIDs {
+		x.disconnectStreams(accountJID, streamerror.ErrPolicyViolation)
+	}
+	return completed("User session(s) have been ended."), nil
+}
+
+func (x *ServiceAdmin) announce(sess *xep0050.Session) (*xep0050.Response, *xmpp.StanzaError) {
+	usernames, err := storage.FetchUsernames()
+	if err != nil {
+		log.Error(err)
+		return nil, xmpp.ErrInternalServerError
+	}
+	srvJID, _ := jid.New("", sess.Requester.Domain(), "", true)
+	subject := sess.Value("subject")
+	text := strings.Join(sess.Values["announcement"], "\n")
+
+	var count int
+	for _, username := range usernames {
+		for _, stm := range x.router.UserStreams(username) {
+			x.sendMessage(srvJID, stm.JID(), subject, text)
+			count++
+		}
+	}
+	return completed(fmt.Sprintf("Announcement has been sent to %d session(s).", count)), nil
+}
+
+func (x *ServiceAdmin) setMOTD(sess *xep0050.Session) (*xep0050.Response, *xmpp.StanzaError) {
+	x.setMessageOfTheDay(strings.Join(sess.Values["motd"], "\n"))
+	return completed("Message of the day has been set."), nil
+}
+
+// disconnectStreams ends every session matching an account JID.
+// A bare JID ends all account sessions.
+func (x *ServiceAdmin) disconnectStreams(accountJID *jid.JID, err error) {
+	stms := append([]stream.C2S(nil), x.router.UserStreams(accountJID.Node())...)
+	for _, stm := range stms {
+		if accountJID.IsFull() && stm.Resource() != accountJID.Resource() {
+			continue
+		}
+		stm.Disconnect(err)
+	}
+}
+
+func (x *ServiceAdmin) localAccountJIDs(values []string) ([]*jid.JID, *xmpp.StanzaError) {
+	var ret []*jid.JID
+	for _, value := range values {
+		if len(value) == 0 {
+			continue
+		}
+		accountJID, sErr := x.localAccountJID(value)
+		if sErr != nil {
+			return nil, sErr
+		}
+		ret = append(ret, accountJID)
+	}
+	return ret, nil
+}
+
+func (x *ServiceAdmin) localAccountJID(value string) (*jid.JID, *xmpp.StanzaError) {
+	accountJID, err := jid.NewWithString(value, false)
+	if err != nil || len(accountJID.Node()) == 0 {
+		return nil, xmpp.ErrJidMalformed
+	}
+	if !x.router.IsLocalHost(accountJID.Domain()) {
+		return nil, xmpp.ErrNotAllowed
+	}
+	return accountJID, nil
+}
@@ -0,0 +1,227 @@
+/*
+ * Copyright (c) 2018 Miguel Ángel Ortuño.
+ * See the LICENSE file for more information.
+ */
+
+package xep0133
+
+import (
+	"testing"
+
+	"github.com/ortuman/jackal/model"
+	"github.com/ortuman/jackal/module/xep0004"
+	"github.com/ortuman/jackal/module/xep0050"
+	"github.com/ortuman/jackal/router"
+	"github.com/ortuman/jackal/storage"
+	"github.com/ortuman/jackal/stream"
+	"github.com/ortuman/jackal/xmpp"
+	"github.com/ortuman/jackal/xmpp/jid"
+	"github.com/pborman/uuid"
+	"github.com/stretchr/testify/require"
+)
+
+func TestXEP0133_AddUser(t *testing.T) {
+	rtr, _, shutdown := setupTest("jackal.im")
+	defer shutdown()
+
+	adHoc, adminStm, x := setupAdmin(rtr)
+	defer adHoc.Shutdown()
+	defer x.Shutdown()
+
+	elem := executeCommand(t, adHoc, adminStm, "add-user", map[string][]string{
+		"accountjid":      {"ortuman@jackal.im"},
+		"password":        {"1234"},
+		"password-verify": {"4321"},
+	})
+	require.Equal(t, xmpp.ErrorType, elem.Type())
+	require.Equal(t, xmpp.ErrNotAcceptable.Error(), elem.Error().Elements().All()[0].Name())
+
+	elem = executeCommand(t, adHoc, adminStm, "add-user", map[string][]string{
+		"accountjid":      {"ortuman@jabber.org"},
+		"password":        {"1234"},
+		"password-verify": {"1234"},
+	})
+	require.Equal(t, xmpp.ErrorType, elem.Type())
+	require.Equal(t, xmpp.ErrNotAllowed.Error(), elem.Error().Elements().All()[0].Name())
+
+	elem = executeCommand(t, adHoc, adminStm, "add-user", map[string][]string{
+		"accountjid":      {"ortuman@jackal.im"},
+		"password":        {"1234"},
+		"password-verify": {"1234"},
+	})
+	require.Equal(t, xmpp.ResultType, elem.Type())
+	require.Equal(t, xep0050.StatusCompleted, elem.Elements().ChildNamespace("command", commandsNamespace).Attributes().Get("status"))
+
+	usr, _ := storage.FetchUser("ortuman")
+	require.NotNil(t, usr)
+
+	elem = executeCommand(t, adHoc, adminStm, "add-user", map[string][]string{
+		"accountjid":      {"ortuman@jackal.im"},
+		"password":        {"1234"},
+		"password-verify": {"1234"},
+	})
+	require.Equal(t, xmpp.ErrorType, elem.Type())
+	require.Equal(t, xmpp.ErrConflict.Error(), elem.Error().Elements().All()[0].Name())
+
+	// missing required field
+	elem = executeCommand(t, adHoc, adminStm, "add-user", map[string][]string{
+		"accountjid": {"noelia@jackal.im"},
+	})
+	require.Equal(t, xmpp.ErrorType, elem.Type())
+}
+
+func TestXEP0133_DeleteUser(t *testing.T) {
+	rtr, _, shutdown := setupTest("jackal.im")
+	defer shutdown()
+
+	adHoc, adminStm, x := setupAdmin(rtr)
+	defer adHoc.Shutdown()
+	defer x.Shutdown()
+
+	storage.InsertOrUpdateUser(&model.User{Username: "ortuman", Password: "1234"})
+
+	j, _ := jid.New("ortuman", "jackal.im", "balcony", true)
+	stm := stream.NewMockC2S(uuid.New(), j)
+	rtr.Bind(stm)
+
+	elem := executeCommand(t, adHoc, adminStm, "delete-user", map[string][]string{
+		"accountjids": {"ortuman@jackal.im"},
+	})
+	require.Equal(t, xmpp.ResultType, elem.Type())
+	require.True(t, stm.IsDisconnected())
+
+	exists, _ := storage.UserExists("ortuman")
+	require.False(t, exists)
+}
+
+func TestXEP0133_ChangeUserPassword(t *testing.T) {
+	rtr, _, shutdown := setupTest("jackal.im")
+	defer shutdown()
+
+	adHoc, adminStm, x := setupAdmin(rtr)
+	defer adHoc.Shutdown()
+	defer x.Shutdown()
+
+	elem := executeCommand(t, adHoc, adminStm, "change-user-password", map[string][]string{
+		"accountjid": {"ortuman@jackal.im"},
+		"password":   {"4321"},
+	})
+	require.Equal(t, xmpp.ErrorType, elem.Type())
+	require.Equal(t, xmpp.ErrItemNotFound.Error(), elem.Error().Elements().All()[0].Name())
+
+	usr := model.User{Username: "ortuman"}
+	_ = usr.SetPassword("1234")
+	storage.InsertOrUpdateUser(&usr)
+
+	elem = executeCommand(t, adHoc, adminStm, "change-user-password", map[string][]string{
+		"accountjid": {"ortuman@jackal.im"},
+		"password":   {"4321"},
+	})
+	require.Equal(t, xmpp.ResultType, elem.Type())
+
+	updated, _ := storage.FetchUser("ortuman")
+	require.NotNil(t, updated)
+	require.NotEqual(t, usr.Salt, updated.Salt)
+}
+
+func TestXEP0133_GetOnlineUsers(t *testing.T) {
+	rtr, _, shutdown := setupTest("jackal.im")
+	defer shutdown()
+
+	adHoc, adminStm, x := setupAdmin(rtr)
+	defer adHoc.Shutdown()
+	defer x.Shutdown()
+
+	storage.InsertOrUpdateUser(&model.User{Username: "admin", Password: "1234"})
+	storage.InsertOrUpdateUser(&model.User{Username: "noelia", Password: "1234"})
+	storage.InsertOrUpdateUser(&model.User{Username: "ortuman", Password: "1234"})
+
+	j, _ := jid.New("ortuman", "jackal.im", "balcony", true)
+	rtr.Bind(stream.NewMockC2S(uuid.New(), j))
+
+	adHoc.ProcessIQ(commandIQ(adminStm.JID(), "get-online-users-list", "", nil))
+	elem := adminStm.ReceiveElement()
+	require.Equal(t, xmpp.ResultType, elem.Type())
+	cmd := elem.Elements().ChildNamespace("command", commandsNamespace)
+	require.Equal(t, xep0050.StatusCompleted, cmd.Attributes().Get("status"))
+
+	form, err := xep0004.NewFormFromElement(cmd.Elements().ChildNamespace("x", "jabber:x:data"))
+	require.Nil(t, err)
+	require.Equal(t, xep0004.Result, form.Type)
+	for _, field := range form.Fields {
+		if field.Var == "onlineuserjids" {
+			require.Equal(t, []string{"admin@jackal.im", "ortuman@jackal.im"}, field.Values)
+			return
+		}
+	}
+	require.Fail(t, "onlineuserjids field not found")
+}
+
+func TestXEP0133_EndUserSession(t *testing.T) {
+	rtr, _, shutdown := setupTest("jackal.im")
+	defer shutdown()
+
+	adHoc, adminStm, x := setupAdmin(rtr)
+	defer adHoc.Shutdown()
+	defer x.Shutdown()
+
+	j1, _ := jid.New("ortuman", "jackal.im", "balcony", true)
+	j2, _ := jid.New("ortuman", "jackal.im", "garden", true)
+	stm1 := stream.NewMockC2S(uuid.New(), j1)
+	stm2 := stream.NewMockC2S(uuid.New(), j2)
+	rtr.Bind(stm1)
+	rtr.Bind(stm2)
+
+	elem := executeCommand(t, adHoc, adminStm, "end-user-session", map[string][]string{
+		"accountjids": {"ortuman@jackal.im/garden"},
+	})
+	require.Equal(t, xmpp.ResultType, elem.Type())
+	require.True(t, stm2.IsDisconnected())
+	require.False(t, stm1.IsDisconnected())
+
+	rtr.Unbind(j2)
+
+	// a bare JID ends all sessions
+	elem = executeCommand(t, adHoc, adminStm, "end-user-session", map[string][]string{
+		"accountjids": {"ortuman@jackal.im"},
+	})
+	require.Equal(t, xmpp.ResultType, elem.Type())
+	require.True(t, stm1.IsDisconnected())
+}
+
+func TestXEP0133_Announce(t *testing.T) {
+	rtr, _, shutdown := setupTest("jackal.im")
+	defer shutdown()
+
+	adHoc, adminStm, x := setupAdmin(rtr)
+	defer adHoc.Shutdown()
+	defer x.Shutdown()
+
+	storage.InsertOrUpdateUser(&model.User{Username: "ortuman", Password: "1234"})
+
+	j, _ := jid.New("ortuman", "jackal.im", "balcony", true)
+	stm := stream.NewMockC2S(uuid.New(), j)
+	rtr.Bind(stm)
+
+	elem := executeCommand(t, adHoc, adminStm, "announce", map[string][]string{
+		"subject":      {"Maintenance"},
+		"announcement": {"Server will be restarted", "in 5 minutes."},
+	})
+	require.Equal(t, xmpp.ResultType, elem.Type())
+
+	elem = stm.ReceiveElement()
+	require.Equal(t, "message", elem.Name())
+	require.Equal(t, "jackal.im", elem.From())
+	require.Equal(t, "Maintenance", elem.Elements().Child("subject").Text())
+	require.Equal(t, "Server will be restarted\nin 5 minutes.", elem.Elements().Child("body").Text())
+}
+
+func setupAdmin(rtr *router.Router) (*xep0050.AdHoc, *stream.MockC2S, *ServiceAdmin) {
+	adHoc := xep0050.New(nil, rtr)
+	x := New(&Config{Admins: []string{"admin@jackal.im"}}, adHoc, rtr)
+
+	adminJID, _ := jid.New("admin", "jackal.im", "balcony", true)
+	adminStm := stream.NewMockC2S(uuid.New(), adminJID)
+	rtr.Bind(adminStm)
+	return adHoc, adminStm, x
+}
@@ -0,0 +1,194 @@
+/*
+ * Copyright (c) 2018 Miguel Ángel Ortuño.
+ * See the LICENSE file for more information.
+ */
+
+package xep0133
+
+import (
+	"strings"
+	"sync"
+
+	"github.com/ortuman/jackal/log"
+	"github.com/ortuman/jackal/module/xep0004"
+	"github.com/ortuman/jackal/module/xep0050"
+	"github.com/ortuman/jackal/router"
+	"github.com/ortuman/jackal/runqueue"
+	"github.com/ortuman/jackal/xmpp"
+	"github.com/ortuman/jackal/xmpp/jid"
+	"github.com/pborman/uuid"
+)
+
+const adminNamespace = "http://jabber.org/protocol/admin"
+
+const formTypeField = "FORM_TYPE"
+
+// Config represents service administration module configuration.
+type Config struct {
+	Admins []string `yaml:"admins"`
+}
+
+// ServiceAdmin represents a service administration server stream module.
+type ServiceAdmin struct {
+	router     *router.Router
+	adHoc      *xep0050.AdHoc
+	admins     map[string]struct{}
+	mu         sync.RWMutex
+	motd       string
+	onlineJIDs map[string]struct{}
+	runQueue   *runqueue.RunQueue
+}
+
+// New returns a service administration module registering
+// its commands into the ad-hoc commands module.
+func New(config *Config, adHoc *xep0050.AdHoc, router *router.Router) *ServiceAdmin {
+	x := &ServiceAdmin{
+		router:     router,
+		adHoc:      adHoc,
+		admins:     make(map[string]struct{}),
+		onlineJIDs: make(map[string]struct{}),
+		runQueue:   runqueue.New("xep0133"),
+	}
+	for _, admin := range config.Admins {
+		adminJID, err := jid.NewWithString(admin, false)
+		if err != nil {
+			log.Warnf("xep0133: ignoring malformed admin jid: %s", admin)
+			continue
+		}
+		x.admins[adminJID.ToBareJID().String()] = struct{}{}
+	}
+	for _, cmd := range x.commands() {
+		adHoc.RegisterCommand(cmd)
+	}
+	return x
+}
+
+// IsAdmin returns whether or not a JID belongs to a service administrator.
+func (x *ServiceAdmin) IsAdmin(j *jid.JID) bool {
+	_, ok := x.admins[j.ToBareJID().String()]
+	return ok
+}
+
+// MessageOfTheDay returns current message of the day.
+func (x *ServiceAdmin) MessageOfTheDay() string {
+	x.mu.RLock()
+	defer x.mu.RUnlock()
+	return x.motd
+}
+
+// ProcessPresence delivers the message of the day to
+// a local resource as soon as it becomes available.
+func (x *ServiceAdmin) ProcessPresence(presence *xmpp.Presence) {
+	x.runQueue.Run(func() {
+		x.processPresence(presence)
+	})
+}
+
+// Shutdown shuts down service administration module.
+func (x *ServiceAdmin) Shutdown() error {
+	c := make(chan struct{})
+	x.runQueue.Stop(func() {
+		for _, cmd := range x.commands() {
+			x.adHoc.UnregisterCommand(cmd.Node)
+		}
+		close(c)
+	})
+	<-c
+	return nil
+}
+
+func (x *ServiceAdmin) processPresence(presence *xmpp.Presence) {
+	fromJID := presence.FromJID()
+	if !fromJID.IsFullWithUser() {
+		return
+	}
+	if presence.IsUnavailable() {
+		delete(x.onlineJIDs, fromJID.String())
+		return
+	}
+	if !presence.IsAvailable() {
+		return
+	}
+	// message of the day is only sent once per available resource
+	if _, ok := x.onlineJIDs[fromJID.String()]; ok {
+		return
+	}
+	x.onlineJIDs[fromJID.String()] = struct{}{}
+
+	motd := x.MessageOfTheDay()
+	if len(motd) == 0 {
+		return
+	}
+	srvJID, _ := jid.New("", fromJID.Domain(), "", true)
+	x.sendMessage(srvJID, fromJID, "", motd)
+}
+
+func (x *ServiceAdmin) setMessageOfTheDay(motd string) {
+	x.mu.Lock()
+	x.motd = motd
+	x.mu.Unlock()
+}
+
+func (x *ServiceAdmin) sendMessage(fromJID, toJID *jid.JID, subject, text string) {
+	msg := xmpp.NewMessageType(uuid.New(), xmpp.NormalType)
+	msg.SetFromJID(fromJID)
+	msg.SetToJID(toJID)
+	if len(subject) > 0 {
+		subjectEl := xmpp.NewElementName("subject")
+		subjectEl.SetText(subject)
+		msg.AppendElement(subjectEl)
+	}
+	body := xmpp.NewElementName("body")
+	body.SetText(text)
+	msg.AppendElement(body)
+	_ = x.router.Route(msg)
+}
+
+// formCommand returns a two-stage admin command that first sends a form to the requester
+// and invokes complete handler once it has been submitted.
+func (x *ServiceAdmin) formCommand(node, name string, fields []xep0004.Field, complete func(sess *xep0050.Session) (*xep0050.Response, *xmpp.StanzaError)) *xep0050.Command {
+	return &xep0050.Command{
+		Node:      adminNamespace + "#" + node,
+		Name:      name,
+		IsAllowed: x.IsAdmin,
+		Execute: func(sess *xep0050.Session, form *xep0004.DataForm) (*xep0050.Response, *xmpp.StanzaError) {
+			if sess.Stage == 0 {
+				return &xep0050.Response{
+					Status:  xep0050.StatusExecuting,
+					Actions: []string{xep0050.ActionComplete},
+					Form:    adminForm(name, fields),
+				}, nil
+			}
+			if form == nil || form.Type != xep0004.Submit {
+				return nil, xmpp.ErrBadRequest
+			}
+			for _, field := range fields {
+				if field.Required && len(strings.Join(sess.Values[field.Var], "")) == 0 {
+					return nil, xmpp.ErrNotAcceptable
+				}
+			}
+			return complete(sess)
+		},
+	}
+}
+
+func adminForm(title string, fields []xep0004.Field) *xep0004.DataForm {
+	form := &xep0004.DataForm{
+		Type:  xep0004.Form,
+		Title: title,
+	}
+	form.Fields = append(form.Fields, xep0004.Field{
+		Var:    formTypeField,
+		Type:   xep0004.Hidden,
+		Values: []string{adminNamespace},
+	})
+	form.Fields = append(form.Fields, fields...)
+	return form
+}
+
+func completed(text string) *xep0050.Response {
+	return &xep0050.Response{
+		Status: xep0050.StatusCompleted,
+		Notes:  []xep0050.Note{{Type: xep0050.NoteInfo, Text: text}},
+	}
+}
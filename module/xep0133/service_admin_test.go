@@ -0,0 +1,139 @@
+/*
+ * Copyright (c) 2018 Miguel Ángel Ortuño.
+ * See the LICENSE file for more information.
+ */
+
+package xep0133
+
+import (
+	"crypto/tls"
+	"testing"
+
+	"github.com/ortuman/jackal/module/xep0004"
+	"github.com/ortuman/jackal/module/xep0050"
+	"github.com/ortuman/jackal/router"
+	"github.com/ortuman/jackal/storage"
+	"github.com/ortuman/jackal/storage/memstorage"
+	"github.com/ortuman/jackal/stream"
+	"github.com/ortuman/jackal/xmpp"
+	"github.com/ortuman/jackal/xmpp/jid"
+	"github.com/pborman/uuid"
+	"github.com/stretchr/testify/require"
+)
+
+const commandsNamespace = "http://jabber.org/protocol/commands"
+
+func TestXEP0133_IsAdmin(t *testing.T) {
+	rtr, _, shutdown := setupTest("jackal.im")
+	defer shutdown()
+
+	adHoc := xep0050.New(nil, rtr)
+	defer adHoc.Shutdown()
+
+	x := New(&Config{Admins: []string{"admin@jackal.im", "@@"}}, adHoc, rtr)
+	defer x.Shutdown()
+
+	j1, _ := jid.New("admin", "jackal.im", "balcony", true)
+	j2, _ := jid.New("ortuman", "jackal.im", "balcony", true)
+	require.True(t, x.IsAdmin(j1))
+	require.True(t, x.IsAdmin(j1.ToBareJID()))
+	require.False(t, x.IsAdmin(j2))
+
+	// non-admin users are not allowed to execute commands
+	stm := stream.NewMockC2S(uuid.New(), j2)
+	rtr.Bind(stm)
+
+	adHoc.ProcessIQ(commandIQ(j2, "add-user", "", nil))
+	elem := stm.ReceiveElement()
+	require.Equal(t, xmpp.ErrorType, elem.Type())
+	require.Equal(t, xmpp.ErrForbidden.Error(), elem.Error().Elements().All()[0].Name())
+}
+
+func TestXEP0133_MessageOfTheDay(t *testing.T) {
+	rtr, _, shutdown := setupTest("jackal.im")
+	defer shutdown()
+
+	adHoc := xep0050.New(nil, rtr)
+	defer adHoc.Shutdown()
+
+	x := New(&Config{Admins: []string{"admin@jackal.im"}}, adHoc, rtr)
+	defer x.Shutdown()
+
+	adminJID, _ := jid.New("admin", "jackal.im", "balcony", true)
+	adminStm := stream.NewMockC2S(uuid.New(), adminJID)
+	rtr.Bind(adminStm)
+
+	executeCommand(t, adHoc, adminStm, "set-motd", map[string][]string{"motd": {"Welcome", "to jackal!"}})
+	require.Equal(t, "Welcome\nto jackal!", x.MessageOfTheDay())
+
+	j, _ := jid.New("ortuman", "jackal.im", "balcony", true)
+	stm := stream.NewMockC2S(uuid.New(), j)
+	rtr.Bind(stm)
+
+	x.ProcessPresence(xmpp.NewPresence(j, j.ToBareJID(), xmpp.AvailableType))
+	elem := stm.ReceiveElement()
+	require.Equal(t, "message", elem.Name())
+	require.Equal(t, "jackal.im", elem.From())
+	require.Equal(t, "Welcome\nto jackal!", elem.Elements().Child("body").Text())
+
+	// only once per available resource
+	x.ProcessPresence(xmpp.NewPresence(j, j.ToBareJID(), xmpp.AvailableType))
+	x.ProcessPresence(xmpp.NewPresence(j, j.ToBareJID(), xmpp.UnavailableType))
+	x.ProcessPresence(xmpp.NewPresence(j, j.ToBareJID(), xmpp.AvailableType))
+	elem = stm.ReceiveElement()
+	require.Equal(t, "message", elem.Name())
+
+	adHoc.ProcessIQ(commandIQ(adminJID, "delete-motd", "", nil))
+	elem = adminStm.ReceiveElement()
+	require.Equal(t, xmpp.ResultType, elem.Type())
+	require.Equal(t, "", x.MessageOfTheDay())
+}
+
+// executeCommand runs a two-stage admin command submitting provided values,
+// and returns command completion element.
+func executeCommand(t *testing.T, adHoc *xep0050.AdHoc, stm *stream.MockC2S, node string, values map[string][]string) xmpp.XElement {
+	adHoc.ProcessIQ(commandIQ(stm.JID(), node, "", nil))
+	elem := stm.ReceiveElement()
+	require.Equal(t, xmpp.ResultType, elem.Type())
+	cmd := elem.Elements().ChildNamespace("command", commandsNamespace)
+	require.NotNil(t, cmd)
+	require.Equal(t, xep0050.StatusExecuting, cmd.Attributes().Get("status"))
+
+	form := &xep0004.DataForm{Type: xep0004.Submit}
+	form.Fields = append(form.Fields, xep0004.Field{Var: formTypeField, Type: xep0004.Hidden, Values: []string{adminNamespace}})
+	for k, v := range values {
+		form.Fields = append(form.Fields, xep0004.Field{Var: k, Values: v})
+	}
+	adHoc.ProcessIQ(commandIQ(stm.JID(), node, cmd.Attributes().Get("sessionid"), form))
+	return stm.ReceiveElement()
+}
+
+func commandIQ(from *jid.JID, node, sessionID string, form *xep0004.DataForm) *xmpp.IQ {
+	srvJID, _ := jid.New("", from.Domain(), "", true)
+
+	cmd := xmpp.NewElementNamespace("command", commandsNamespace)
+	cmd.SetAttribute("node", adminNamespace+"#"+node)
+	if len(sessionID) > 0 {
+		cmd.SetAttribute("sessionid", sessionID)
+		cmd.SetAttribute("action", xep0050.ActionComplete)
+	}
+	if form != nil {
+		cmd.AppendElement(form.Element())
+	}
+	iq := xmpp.NewIQType(uuid.New(), xmpp.SetType)
+	iq.SetFromJID(from)
+	iq.SetToJID(srvJID)
+	iq.AppendElement(cmd)
+	return iq
+}
+
+func setupTest(domain string) (*router.Router, *memstorage.Storage, func()) {
+	r, _ := router.New(&router.Config{
+		Hosts: []router.HostConfig{{Name: domain, Certificate: tls.Certificate{}}},
+	})
+	s := memstorage.New()
+	storage.Set(s)
+	return r, s, func() {
+		storage.Unset()
+	}
+}
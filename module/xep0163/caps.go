@@ -0,0 +1,382 @@
+/*
+ * Copyright (c) 2018 Miguel Ángel Ortuño.
+ * See the LICENSE file for more information.
+ */
+
+package xep0163
+
+import (
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/base64"
+	"hash"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/ortuman/jackal/component/pubsub"
+	"github.com/ortuman/jackal/log"
+	"github.com/ortuman/jackal/model/pubsubmodel"
+	"github.com/ortuman/jackal/model/rostermodel"
+	"github.com/ortuman/jackal/module/xep0004"
+	"github.com/ortuman/jackal/storage"
+	"github.com/ortuman/jackal/xmpp"
+	"github.com/ortuman/jackal/xmpp/jid"
+	"github.com/pborman/uuid"
+)
+
+const (
+	capsNamespace      = "http://jabber.org/protocol/caps"
+	discoInfoNamespace = "http://jabber.org/protocol/disco#info"
+)
+
+const notifySuffix = "+notify"
+
+const defaultCapsRequestTimeout = time.Second * 15
+
+// capsRequest represents an in-flight entity capabilities disco info request.
+type capsRequest struct {
+	key   string
+	hash  string
+	ver   string
+	to    *jid.JID
+	timer *time.Timer
+
+	// deliveries waiting for capabilities to be resolved
+	waiters []capsWaiter
+}
+
+// capsWaiter represents a delivery to an available entity
+// held until its capabilities are resolved.
+type capsWaiter struct {
+	from     *jid.JID
+	presence *xmpp.Presence
+	deliver  func(features []string)
+}
+
+func (x *Pep) processPresence(presence *xmpp.Presence) {
+	fromJID := presence.FromJID()
+	if !fromJID.IsFullWithUser() {
+		return
+	}
+	if presence.IsUnavailable() {
+		prefix := fromJID.String() + " "
+		for k := range x.onlineJIDs {
+			if strings.HasPrefix(k, prefix) {
+				delete(x.onlineJIDs, k)
+			}
+		}
+		return
+	}
+	if !presence.IsAvailable() {
+		return
+	}
+	// last published items are only sent once per available resource
+	k := fromJID.String() + " " + presence.ToJID().ToBareJID().String()
+	if _, ok := x.onlineJIDs[k]; ok {
+		return
+	}
+	x.onlineJIDs[k] = struct{}{}
+
+	features, ok := x.capsFeatures(presence)
+	if !ok {
+		x.requestCaps(capsWaiter{
+			from:     presence.ToJID().ToBareJID(),
+			presence: presence,
+			deliver:  func(features []string) { x.sendLastPublishedItems(presence, features) },
+		})
+		return
+	}
+	x.sendLastPublishedItems(presence, features)
+}
+
+// sendLastPublishedItems sends last published items to a recently available entity
+// for every node it's interested in, as stated by its capabilities.
+func (x *Pep) sendLastPublishedItems(presence *xmpp.Presence, features []string) {
+	if len(features) == 0 {
+		return
+	}
+	fromJID := presence.FromJID()
+	toJID := presence.ToJID().ToBareJID()
+	if !x.router.IsLocalHost(toJID.Domain()) {
+		return
+	}
+	var owners []*jid.JID
+	if fromJID.Matches(toJID, jid.MatchesBare) {
+		// initial presence: own nodes and those of local contacts the user is subscribed to
+		owners = append(owners, toJID)
+
+		ris, _, err := storage.FetchRosterItems(toJID.Node())
+		if err != nil {
+			log.Error(err)
+			return
+		}
+		for _, ri := range ris {
+			switch ri.Subscription {
+			case rostermodel.SubscriptionTo, rostermodel.SubscriptionBoth:
+				if contactJID := ri.ContactJID(); x.router.IsLocalHost(contactJID.Domain()) {
+					owners = append(owners, contactJID)
+				}
+			}
+		}
+	} else {
+		// directed presence: presence subscribed contact became available
+		ri, err := storage.FetchRosterItem(toJID.Node(), fromJID.ToBareJID().String())
+		if err != nil {
+			log.Error(err)
+			return
+		}
+		if ri == nil || (ri.Subscription != rostermodel.SubscriptionFrom && ri.Subscription != rostermodel.SubscriptionBoth) {
+			return
+		}
+		owners = append(owners, toJID)
+	}
+	for _, ownerJID := range owners {
+		nodes, err := storage.FetchPubSubNodes(ownerJID.String())
+		if err != nil {
+			log.Error(err)
+			continue
+		}
+		for i := range nodes {
+			n := &nodes[i]
+			if n.Options.SendLastPublishedItem != pubsubmodel.SendLastPublishedItemOnSubAndPresence {
+				continue
+			}
+			if !hasFeature(features, n.Name+notifySuffix) {
+				continue
+			}
+			if x.checkAccess(n, fromJID) != nil {
+				continue
+			}
+			items, err := storage.FetchPubSubItems(ownerJID.String(), n.Name)
+			if err != nil {
+				log.Error(err)
+				continue
+			}
+			if len(items) == 0 {
+				continue
+			}
+			x.sendEvent(ownerJID, fromJID, pubsub.ItemsEvent(n, items[len(items)-1:]))
+		}
+	}
+}
+
+// notifyIfInterested sends an event notification to an available entity in case it wants
+// to be notified about node events. Notification is held until entity capabilities
+// are resolved whenever they're unknown.
+func (x *Pep) notifyIfInterested(ownerJID *jid.JID, presence *xmpp.Presence, n *pubsubmodel.Node, event xmpp.XElement) {
+	deliver := func(features []string) {
+		if hasFeature(features, n.Name+notifySuffix) {
+			x.sendEvent(ownerJID, presence.FromJID(), event)
+		}
+	}
+	features, ok := x.capsFeatures(presence)
+	if !ok {
+		x.requestCaps(capsWaiter{from: ownerJID, presence: presence, deliver: deliver})
+		return
+	}
+	deliver(features)
+}
+
+// capsFeatures returns the cached features associated to presence capabilities,
+// and whether or not they're already known.
+func (x *Pep) capsFeatures(presence *xmpp.Presence) ([]string, bool) {
+	key := capsKey(presence)
+	if len(key) == 0 {
+		return nil, true // no capabilities advertised
+	}
+	features, ok := x.caps[key]
+	return features, ok
+}
+
+func (x *Pep) requestCaps(w capsWaiter) {
+	presence := w.presence
+	key := capsKey(presence)
+
+	// avoid requesting the same capabilities twice
+	if reqID, ok := x.capsKeys[key]; ok {
+		if v, ok := x.capsReqs.Load(reqID); ok {
+			req := v.(*capsRequest)
+			req.waiters = append(req.waiters, w)
+		}
+		return
+	}
+	c := presence.Elements().ChildNamespace("c", capsNamespace)
+
+	query := xmpp.NewElementNamespace("query", discoInfoNamespace)
+	query.SetAttribute("node", c.Attributes().Get("node")+"#"+c.Attributes().Get("ver"))
+
+	iq := xmpp.NewIQType(uuid.New(), xmpp.GetType)
+	iq.SetFromJID(w.from)
+	iq.SetToJID(presence.FromJID())
+	iq.AppendElement(query)
+
+	req := &capsRequest{
+		key:  key,
+		hash: c.Attributes().Get("hash"),
+		ver:  c.Attributes().Get("ver"),
+		to:   presence.FromJID(),
+	}
+	req.waiters = append(req.waiters, w)
+	reqID := iq.ID()
+	req.timer = time.AfterFunc(x.capsTimeout, func() {
+		x.runQueue.Run(func() { x.capsRequestTimeout(reqID) })
+	})
+	x.capsReqs.Store(reqID, req)
+	x.capsKeys[key] = reqID
+
+	_ = x.router.Route(iq)
+}
+
+// capsRequestTimeout gives up on an unanswered capabilities request,
+// asking any other entity advertising the same capabilities instead.
+func (x *Pep) capsRequestTimeout(reqID string) {
+	v, ok := x.capsReqs.Load(reqID)
+	if !ok {
+		return
+	}
+	req := v.(*capsRequest)
+	x.capsReqs.Delete(reqID)
+	delete(x.capsKeys, req.key)
+
+	log.Warnf("xep0163: capabilities request timed out... (key: %s, to: %s)", req.key, req.to)
+
+	for _, w := range req.waiters {
+		if w.presence.FromJID().Matches(req.to, jid.MatchesNode|jid.MatchesDomain|jid.MatchesResource) {
+			continue
+		}
+		x.requestCaps(w)
+	}
+}
+
+func (x *Pep) processCapsResponse(iq *xmpp.IQ) {
+	v, ok := x.capsReqs.Load(iq.ID())
+	if !ok {
+		return
+	}
+	req := v.(*capsRequest)
+	if !iq.FromJID().Matches(req.to, jid.MatchesNode|jid.MatchesDomain|jid.MatchesResource) {
+		return
+	}
+	req.timer.Stop()
+	x.capsReqs.Delete(iq.ID())
+	delete(x.capsKeys, req.key)
+
+	if !iq.IsResult() {
+		return
+	}
+	q := iq.Elements().ChildNamespace("query", discoInfoNamespace)
+	if q == nil {
+		return
+	}
+	features := []string{}
+	for _, f := range q.Elements().Children("feature") {
+		features = append(features, f.Attributes().Get("var"))
+	}
+	// only verified capabilities are shared among entities
+	if h := capsHash(req.hash); h != nil && capsVerificationString(q, h) == req.ver {
+		x.caps[req.key] = features
+	} else {
+		log.Warnf("xep0163: unverified capabilities... (key: %s, from: %s)", req.key, req.to)
+	}
+
+	for _, w := range req.waiters {
+		w.deliver(features)
+	}
+}
+
+func capsKey(presence *xmpp.Presence) string {
+	c := presence.Elements().ChildNamespace("c", capsNamespace)
+	if c == nil {
+		return ""
+	}
+	node := c.Attributes().Get("node")
+	ver := c.Attributes().Get("ver")
+	if len(node) == 0 || len(ver) == 0 {
+		return ""
+	}
+	return node + "#" + ver
+}
+
+// capsHash returns the hash function associated to an entity capabilities hash name.
+func capsHash(name string) func() hash.Hash {
+	switch name {
+	case "sha-1":
+		return sha1.New
+	case "sha-256":
+		return sha256.New
+	case "sha-512":
+		return sha512.New
+	}
+	return nil
+}
+
+// capsVerificationString generates a disco info query verification string.
+// (https://xmpp.org/extensions/xep-0115.html#ver-gen)
+func capsVerificationString(query xmpp.XElement, h func() hash.Hash) string {
+	var identities, features []string
+	for _, identity := range query.Elements().Children("identity") {
+		attrs := identity.Attributes()
+		identities = append(identities, attrs.Get("category")+"/"+attrs.Get("type")+"/"+attrs.Get("xml:lang")+"/"+attrs.Get("name"))
+	}
+	for _, feature := range query.Elements().Children("feature") {
+		features = append(features, feature.Attributes().Get("var"))
+	}
+	type extendedForm struct {
+		formType string
+		fields   []xep0004.Field
+	}
+	var forms []extendedForm
+	for _, x := range query.Elements().ChildrenNamespace("x", formNamespace) {
+		form, err := xep0004.NewFormFromElement(x)
+		if err != nil || form.Type != xep0004.Result {
+			continue
+		}
+		var ef extendedForm
+		for _, field := range form.Fields {
+			if field.Var == formTypeField {
+				if len(field.Values) > 0 {
+					ef.formType = field.Values[0]
+				}
+				continue
+			}
+			ef.fields = append(ef.fields, field)
+		}
+		forms = append(forms, ef)
+	}
+	sort.Strings(identities)
+	sort.Strings(features)
+	sort.Slice(forms, func(i, j int) bool { return forms[i].formType < forms[j].formType })
+
+	var sb strings.Builder
+	for _, s := range append(identities, features...) {
+		sb.WriteString(s + "<")
+	}
+	for _, form := range forms {
+		sb.WriteString(form.formType + "<")
+
+		sort.Slice(form.fields, func(i, j int) bool { return form.fields[i].Var < form.fields[j].Var })
+		for _, field := range form.fields {
+			sb.WriteString(field.Var + "<")
+
+			values := append([]string(nil), field.Values...)
+			sort.Strings(values)
+			for _, value := range values {
+				sb.WriteString(value + "<")
+			}
+		}
+	}
+	hs := h()
+	_, _ = hs.Write([]byte(sb.String()))
+	return base64.StdEncoding.EncodeToString(hs.Sum(nil))
+}
+
+func hasFeature(features []string, feature string) bool {
+	for _, f := range features {
+		if f == feature {
+			return true
+		}
+	}
+	return false
+}
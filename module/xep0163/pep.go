@@ -0,0 +1,609 @@
+/*
+ * Copyright (c) 2018 Miguel Ángel Ortuño.
+ * See the LICENSE file for more information.
+ */
+
+package xep0163
+
+import (
+	"reflect"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/ortuman/jackal/component/pubsub"
+	"github.com/ortuman/jackal/log"
+	"github.com/ortuman/jackal/model/pubsubmodel"
+	"github.com/ortuman/jackal/model/rostermodel"
+	"github.com/ortuman/jackal/module/roster"
+	"github.com/ortuman/jackal/module/xep0004"
+	"github.com/ortuman/jackal/module/xep0030"
+	"github.com/ortuman/jackal/router"
+	"github.com/ortuman/jackal/runqueue"
+	"github.com/ortuman/jackal/storage"
+	"github.com/ortuman/jackal/xmpp"
+	"github.com/ortuman/jackal/xmpp/jid"
+	"github.com/pborman/uuid"
+)
+
+const (
+	pubSubNamespace               = "http://jabber.org/protocol/pubsub"
+	pubSubOwnerNamespace          = "http://jabber.org/protocol/pubsub#owner"
+	pubSubEventNamespace          = "http://jabber.org/protocol/pubsub#event"
+	pubSubErrorsNamespace         = "http://jabber.org/protocol/pubsub#errors"
+	pubSubPublishOptionsNamespace = "http://jabber.org/protocol/pubsub#publish-options"
+	formNamespace                 = "jabber:x:data"
+)
+
+const (
+	formTypeField   = "FORM_TYPE"
+	defaultMaxItems = 1
+)
+
+var pepFeatures = []string{
+	pubSubNamespace,
+	pubSubNamespace + "#access-open",
+	pubSubNamespace + "#access-presence",
+	pubSubNamespace + "#access-roster",
+	pubSubNamespace + "#access-whitelist",
+	pubSubNamespace + "#auto-create",
+	pubSubNamespace + "#config-node",
+	pubSubNamespace + "#create-and-configure",
+	pubSubNamespace + "#create-nodes",
+	pubSubNamespace + "#delete-items",
+	pubSubNamespace + "#delete-nodes",
+	pubSubNamespace + "#filtered-notifications",
+	pubSubNamespace + "#item-ids",
+	pubSubNamespace + "#last-published",
+	pubSubNamespace + "#persistent-items",
+	pubSubNamespace + "#publish",
+	pubSubNamespace + "#publish-options",
+	pubSubNamespace + "#retract-items",
+	pubSubNamespace + "#retrieve-items",
+}
+
+// Pep represents a personal eventing protocol module.
+type Pep struct {
+	router      *router.Router
+	roster      *roster.Roster
+	runQueue    *runqueue.RunQueue
+	capsReqs    sync.Map
+	capsTimeout time.Duration
+	caps        map[string][]string
+	capsKeys    map[string]string
+	onlineJIDs  map[string]struct{}
+}
+
+// New returns a personal eventing protocol IQ handler module.
+func New(disco *xep0030.DiscoInfo, roster *roster.Roster, router *router.Router) *Pep {
+	x := &Pep{
+		router:      router,
+		roster:      roster,
+		runQueue:    runqueue.New("xep0163"),
+		capsTimeout: defaultCapsRequestTimeout,
+		caps:        make(map[string][]string),
+		capsKeys:    make(map[string]string),
+		onlineJIDs:  make(map[string]struct{}),
+	}
+	if disco != nil {
+		disco.RegisterAccountIdentity(xep0030.Identity{Category: "pubsub", Type: "pep"})
+		for _, feature := range pepFeatures {
+			disco.RegisterAccountFeature(feature)
+		}
+	}
+	return x
+}
+
+// MatchesIQ returns whether or not an IQ should be
+// processed by the personal eventing protocol module.
+func (x *Pep) MatchesIQ(iq *xmpp.IQ) bool {
+	if iq.IsResult() || iq.Type() == xmpp.ErrorType {
+		_, ok := x.capsReqs.Load(iq.ID())
+		return ok
+	}
+	if !iq.ToJID().IsBare() {
+		return false
+	}
+	e := iq.Elements()
+	return e.ChildNamespace("pubsub", pubSubNamespace) != nil || e.ChildNamespace("pubsub", pubSubOwnerNamespace) != nil
+}
+
+// ProcessIQ processes a personal eventing protocol IQ
+// taking according actions over the associated stream.
+func (x *Pep) ProcessIQ(iq *xmpp.IQ) {
+	x.runQueue.Run(func() {
+		x.processIQ(iq)
+	})
+}
+
+// ProcessPresence delivers last published items to an entity
+// that becomes available, and keeps track of its capabilities.
+func (x *Pep) ProcessPresence(presence *xmpp.Presence) {
+	x.runQueue.Run(func() {
+		x.processPresence(presence)
+	})
+}
+
+// Shutdown shuts down personal eventing protocol module.
+func (x *Pep) Shutdown() error {
+	c := make(chan struct{})
+	x.runQueue.Stop(func() { close(c) })
+	<-c
+	return nil
+}
+
+func (x *Pep) processIQ(iq *xmpp.IQ) {
+	if iq.IsResult() || iq.Type() == xmpp.ErrorType {
+		x.processCapsResponse(iq)
+		return
+	}
+	ownerJID := iq.ToJID().ToBareJID()
+	if !x.router.IsLocalHost(ownerJID.Domain()) {
+		_ = x.router.Route(iq.ServiceUnavailableError())
+		return
+	}
+	if ps := iq.Elements().ChildNamespace("pubsub", pubSubNamespace); ps != nil {
+		x.processPubSubIQ(iq, ownerJID, ps)
+		return
+	}
+	if ps := iq.Elements().ChildNamespace("pubsub", pubSubOwnerNamespace); ps != nil {
+		x.processOwnerIQ(iq, ownerJID, ps)
+	}
+}
+
+func (x *Pep) processPubSubIQ(iq *xmpp.IQ, ownerJID *jid.JID, ps xmpp.XElement) {
+	if iq.IsGet() {
+		if cmd := ps.Elements().Child("items"); cmd != nil {
+			x.sendItems(iq, ownerJID, cmd)
+			return
+		}
+		_ = x.router.Route(iq.FeatureNotImplementedError())
+		return
+	}
+	// only account owner is allowed to modify its nodes
+	if !iq.FromJID().Matches(ownerJID, jid.MatchesBare) {
+		_ = x.router.Route(iq.ForbiddenError())
+		return
+	}
+	if cmd := ps.Elements().Child("create"); cmd != nil {
+		x.createNode(iq, ownerJID, cmd, ps.Elements().Child("configure"))
+		return
+	}
+	if cmd := ps.Elements().Child("publish"); cmd != nil {
+		x.publishItem(iq, ownerJID, cmd, ps.Elements().Child("publish-options"))
+		return
+	}
+	if cmd := ps.Elements().Child("retract"); cmd != nil {
+		x.retractItem(iq, ownerJID, cmd)
+		return
+	}
+	_ = x.router.Route(iq.FeatureNotImplementedError())
+}
+
+func (x *Pep) processOwnerIQ(iq *xmpp.IQ, ownerJID *jid.JID, ps xmpp.XElement) {
+	if !iq.FromJID().Matches(ownerJID, jid.MatchesBare) {
+		_ = x.router.Route(iq.ForbiddenError())
+		return
+	}
+	if cmd := ps.Elements().Child("configure"); cmd != nil {
+		n := x.fetchNode(iq, ownerJID, cmd.Attributes().Get("node"))
+		if n == nil {
+			return
+		}
+		if iq.IsGet() {
+			x.sendConfiguration(iq, n)
+		} else {
+			x.configureNode(iq, n, cmd)
+		}
+		return
+	}
+	if cmd := ps.Elements().Child("delete"); cmd != nil && iq.IsSet() {
+		n := x.fetchNode(iq, ownerJID, cmd.Attributes().Get("node"))
+		if n == nil {
+			return
+		}
+		x.deleteNode(iq, ownerJID, n)
+		return
+	}
+	_ = x.router.Route(iq.FeatureNotImplementedError())
+}
+
+func (x *Pep) createNode(iq *xmpp.IQ, ownerJID *jid.JID, create, configure xmpp.XElement) {
+	name := create.Attributes().Get("node")
+	if len(name) == 0 {
+		// instant nodes are not supported
+		_ = x.router.Route(pubsub.ErrorStanza(iq, xmpp.ErrNotAcceptable, "nodeid-required"))
+		return
+	}
+	n, err := storage.FetchPubSubNode(ownerJID.String(), name)
+	if err != nil {
+		log.Error(err)
+		_ = x.router.Route(iq.InternalServerError())
+		return
+	}
+	if n != nil {
+		_ = x.router.Route(iq.ConflictError())
+		return
+	}
+	n = newNode(ownerJID, name)
+	if configure != nil {
+		if xEl := configure.Elements().ChildNamespace("x", formNamespace); xEl != nil {
+			form, err := xep0004.NewFormFromElement(xEl)
+			if err != nil || form.Type != xep0004.Submit {
+				_ = x.router.Route(iq.BadRequestError())
+				return
+			}
+			if err := pubsub.ApplyConfigForm(&n.Options, form); err != nil {
+				_ = x.router.Route(iq.NotAcceptableError())
+				return
+			}
+		}
+	}
+	if !x.persistNode(iq, n) {
+		return
+	}
+	_ = x.router.Route(iq.ResultIQ())
+}
+
+func (x *Pep) publishItem(iq *xmpp.IQ, ownerJID *jid.JID, publish, publishOptions xmpp.XElement) {
+	name := publish.Attributes().Get("node")
+	if len(name) == 0 {
+		_ = x.router.Route(pubsub.ErrorStanza(iq, xmpp.ErrBadRequest, "nodeid-required"))
+		return
+	}
+	var options *xep0004.DataForm
+	if publishOptions != nil {
+		var ok bool
+		if options, ok = publishOptionsForm(publishOptions); !ok {
+			_ = x.router.Route(iq.BadRequestError())
+			return
+		}
+	}
+	n, err := storage.FetchPubSubNode(ownerJID.String(), name)
+	if err != nil {
+		log.Error(err)
+		_ = x.router.Route(iq.InternalServerError())
+		return
+	}
+	if n == nil {
+		// auto-create node
+		n = newNode(ownerJID, name)
+		if options != nil {
+			if err := pubsub.ApplyConfigForm(&n.Options, options); err != nil {
+				_ = x.router.Route(pubsub.ErrorStanza(iq, xmpp.ErrConflict, "precondition-not-met"))
+				return
+			}
+		}
+		if !x.persistNode(iq, n) {
+			return
+		}
+		log.Infof("pep: created node %s (owner: %s)", name, ownerJID)
+	} else if options != nil && !meetsPreconditions(&n.Options, options) {
+		_ = x.router.Route(pubsub.ErrorStanza(iq, xmpp.ErrConflict, "precondition-not-met"))
+		return
+	}
+	itemEl := publish.Elements().Child("item")
+	if itemEl == nil {
+		_ = x.router.Route(pubsub.ErrorStanza(iq, xmpp.ErrBadRequest, "item-required"))
+		return
+	}
+	payloads := itemEl.Elements().All()
+	if len(payloads) != 1 {
+		_ = x.router.Route(pubsub.ErrorStanza(iq, xmpp.ErrBadRequest, "invalid-payload"))
+		return
+	}
+	item := pubsubmodel.Item{
+		ID:        itemEl.Attributes().Get("id"),
+		Publisher: ownerJID.String(),
+		Payload:   payloads[0],
+		CreatedAt: time.Now(),
+	}
+	if len(item.ID) == 0 {
+		item.ID = uuid.New()
+	}
+	if n.Options.PersistItems {
+		if err := storage.InsertOrUpdatePubSubItem(ownerJID.String(), name, &item, n.Options.MaxItems); err != nil {
+			log.Error(err)
+			_ = x.router.Route(iq.InternalServerError())
+			return
+		}
+	}
+	publishEl := xmpp.NewElementName("publish")
+	publishEl.SetAttribute("node", name)
+	publishEl.AppendElement(xmpp.NewElementName("item").SetAttribute("id", item.ID))
+
+	ps := xmpp.NewElementNamespace("pubsub", pubSubNamespace)
+	ps.AppendElement(publishEl)
+
+	result := iq.ResultIQ()
+	result.AppendElement(ps)
+	_ = x.router.Route(result)
+
+	if n.Options.DeliverNotifications {
+		x.notify(ownerJID, n, pubsub.ItemsEvent(n, []pubsubmodel.Item{item}))
+	}
+}
+
+func (x *Pep) retractItem(iq *xmpp.IQ, ownerJID *jid.JID, retract xmpp.XElement) {
+	n := x.fetchNode(iq, ownerJID, retract.Attributes().Get("node"))
+	if n == nil {
+		return
+	}
+	itemEl := retract.Elements().Child("item")
+	if itemEl == nil || len(itemEl.Attributes().Get("id")) == 0 {
+		_ = x.router.Route(pubsub.ErrorStanza(iq, xmpp.ErrBadRequest, "item-required"))
+		return
+	}
+	itemID := itemEl.Attributes().Get("id")
+
+	items, err := storage.FetchPubSubItems(ownerJID.String(), n.Name)
+	if err != nil {
+		log.Error(err)
+		_ = x.router.Route(iq.InternalServerError())
+		return
+	}
+	if pubsub.FindItem(items, itemID) == nil {
+		_ = x.router.Route(iq.ItemNotFoundError())
+		return
+	}
+	if err := storage.DeletePubSubItem(ownerJID.String(), n.Name, itemID); err != nil {
+		log.Error(err)
+		_ = x.router.Route(iq.InternalServerError())
+		return
+	}
+	_ = x.router.Route(iq.ResultIQ())
+
+	if n.Options.NotifyRetract || retract.Attributes().Get("notify") == "true" || retract.Attributes().Get("notify") == "1" {
+		itemsEl := xmpp.NewElementName("items")
+		itemsEl.SetAttribute("node", n.Name)
+		itemsEl.AppendElement(xmpp.NewElementName("retract").SetAttribute("id", itemID))
+		x.notify(ownerJID, n, itemsEl)
+	}
+}
+
+func (x *Pep) sendItems(iq *xmpp.IQ, ownerJID *jid.JID, itemsReq xmpp.XElement) {
+	n := x.fetchNode(iq, ownerJID, itemsReq.Attributes().Get("node"))
+	if n == nil {
+		return
+	}
+	if aErr := x.checkAccess(n, iq.FromJID()); aErr != nil {
+		_ = x.router.Route(pubsub.ErrorStanza(iq, aErr.StanzaErr, aErr.Condition))
+		return
+	}
+	items, err := storage.FetchPubSubItems(ownerJID.String(), n.Name)
+	if err != nil {
+		log.Error(err)
+		_ = x.router.Route(iq.InternalServerError())
+		return
+	}
+	if requested := itemsReq.Elements().Children("item"); len(requested) > 0 {
+		var filtered []pubsubmodel.Item
+		for _, r := range requested {
+			if item := pubsub.FindItem(items, r.Attributes().Get("id")); item != nil {
+				filtered = append(filtered, *item)
+			}
+		}
+		items = filtered
+	}
+	if maxItems, err := strconv.Atoi(itemsReq.Attributes().Get("max_items")); err == nil && maxItems >= 0 && maxItems < len(items) {
+		items = items[len(items)-maxItems:]
+	}
+	itemsEl := xmpp.NewElementName("items")
+	itemsEl.SetAttribute("node", n.Name)
+	for _, item := range items {
+		itemEl := xmpp.NewElementName("item")
+		itemEl.SetAttribute("id", item.ID)
+		if item.Payload != nil {
+			itemEl.AppendElement(item.Payload)
+		}
+		itemsEl.AppendElement(itemEl)
+	}
+	ps := xmpp.NewElementNamespace("pubsub", pubSubNamespace)
+	ps.AppendElement(itemsEl)
+
+	result := iq.ResultIQ()
+	result.AppendElement(ps)
+	_ = x.router.Route(result)
+}
+
+func (x *Pep) sendConfiguration(iq *xmpp.IQ, n *pubsubmodel.Node) {
+	configure := xmpp.NewElementName("configure")
+	configure.SetAttribute("node", n.Name)
+	configure.AppendElement(pubsub.ConfigForm(&n.Options).Element())
+
+	ps := xmpp.NewElementNamespace("pubsub", pubSubOwnerNamespace)
+	ps.AppendElement(configure)
+
+	result := iq.ResultIQ()
+	result.AppendElement(ps)
+	_ = x.router.Route(result)
+}
+
+func (x *Pep) configureNode(iq *xmpp.IQ, n *pubsubmodel.Node, configure xmpp.XElement) {
+	xEl := configure.Elements().ChildNamespace("x", formNamespace)
+	if xEl == nil {
+		_ = x.router.Route(iq.BadRequestError())
+		return
+	}
+	form, err := xep0004.NewFormFromElement(xEl)
+	if err != nil {
+		_ = x.router.Route(iq.BadRequestError())
+		return
+	}
+	switch form.Type {
+	case xep0004.Cancel:
+		_ = x.router.Route(iq.ResultIQ())
+		return
+	case xep0004.Submit:
+		break
+	default:
+		_ = x.router.Route(iq.BadRequestError())
+		return
+	}
+	if err := pubsub.ApplyConfigForm(&n.Options, form); err != nil {
+		_ = x.router.Route(iq.NotAcceptableError())
+		return
+	}
+	if !x.persistNode(iq, n) {
+		return
+	}
+	_ = x.router.Route(iq.ResultIQ())
+}
+
+func (x *Pep) deleteNode(iq *xmpp.IQ, ownerJID *jid.JID, n *pubsubmodel.Node) {
+	if err := storage.DeletePubSubNode(ownerJID.String(), n.Name); err != nil {
+		log.Error(err)
+		_ = x.router.Route(iq.InternalServerError())
+		return
+	}
+	log.Infof("pep: deleted node %s (owner: %s)", n.Name, ownerJID)
+
+	_ = x.router.Route(iq.ResultIQ())
+
+	if n.Options.NotifyDelete {
+		deleteEl := xmpp.NewElementName("delete")
+		deleteEl.SetAttribute("node", n.Name)
+		x.notify(ownerJID, n, deleteEl)
+	}
+}
+
+// notify sends an event notification to every available owner resource and
+// presence subscribed contact allowed to access the node, as long as the
+// receiving entity showed interest in it by means of its entity capabilities.
+func (x *Pep) notify(ownerJID *jid.JID, n *pubsubmodel.Node, event xmpp.XElement) {
+	recipients := []*jid.JID{ownerJID}
+
+	ris, _, err := storage.FetchRosterItems(ownerJID.Node())
+	if err != nil {
+		log.Error(err)
+		return
+	}
+	for _, ri := range ris {
+		switch ri.Subscription {
+		case rostermodel.SubscriptionFrom, rostermodel.SubscriptionBoth:
+			recipients = append(recipients, ri.ContactJID())
+		}
+	}
+	for _, recipient := range recipients {
+		for _, presence := range x.onlinePresences(recipient) {
+			if x.checkAccess(n, presence.FromJID()) != nil {
+				continue
+			}
+			x.notifyIfInterested(ownerJID, presence, n, event)
+		}
+	}
+}
+
+// onlinePresences returns current available presences of a given bare JID.
+func (x *Pep) onlinePresences(j *jid.JID) []*xmpp.Presence {
+	if x.roster != nil {
+		return x.roster.OnlinePresencesMatchingJID(j)
+	}
+	// roster disabled: only local resources can be reached
+	var ret []*xmpp.Presence
+	if x.router.IsLocalHost(j.Domain()) {
+		for _, stm := range x.router.UserStreams(j.Node()) {
+			if p := stm.Presence(); p != nil && p.IsAvailable() {
+				ret = append(ret, p)
+			}
+		}
+	}
+	return ret
+}
+
+// checkAccess verifies whether or not an entity is allowed to
+// retrieve items from a node, according to its access model.
+func (x *Pep) checkAccess(n *pubsubmodel.Node, j *jid.JID) *pubsub.AccessError {
+	return pubsub.CheckAccess(n, j, x.router.IsLocalHost)
+}
+
+func (x *Pep) sendEvent(from, to *jid.JID, event xmpp.XElement) {
+	ev := xmpp.NewElementNamespace("event", pubSubEventNamespace)
+	ev.AppendElement(event)
+
+	msg := xmpp.NewMessageType(uuid.New(), xmpp.HeadlineType)
+	msg.SetFromJID(from)
+	msg.SetToJID(to)
+	msg.AppendElement(ev)
+	_ = x.router.Route(msg)
+}
+
+func (x *Pep) fetchNode(iq *xmpp.IQ, ownerJID *jid.JID, name string) *pubsubmodel.Node {
+	if len(name) == 0 {
+		_ = x.router.Route(pubsub.ErrorStanza(iq, xmpp.ErrBadRequest, "nodeid-required"))
+		return nil
+	}
+	n, err := storage.FetchPubSubNode(ownerJID.String(), name)
+	if err != nil {
+		log.Error(err)
+		_ = x.router.Route(iq.InternalServerError())
+		return nil
+	}
+	if n == nil {
+		_ = x.router.Route(iq.ItemNotFoundError())
+		return nil
+	}
+	return n
+}
+
+func (x *Pep) persistNode(iq *xmpp.IQ, n *pubsubmodel.Node) bool {
+	if err := storage.InsertOrUpdatePubSubNode(n); err != nil {
+		log.Error(err)
+		_ = x.router.Route(iq.InternalServerError())
+		return false
+	}
+	return true
+}
+
+func newNode(ownerJID *jid.JID, name string) *pubsubmodel.Node {
+	n := &pubsubmodel.Node{
+		Host: ownerJID.String(),
+		Name: name,
+		Options: pubsubmodel.Options{
+			DeliverNotifications:  true,
+			DeliverPayloads:       true,
+			PersistItems:          true,
+			MaxItems:              defaultMaxItems,
+			AccessModel:           pubsubmodel.AccessModelPresence,
+			PublishModel:          pubsubmodel.PublishModelPublishers,
+			NotifyDelete:          true,
+			NotifyRetract:         true,
+			SendLastPublishedItem: pubsubmodel.SendLastPublishedItemOnSubAndPresence,
+		},
+	}
+	n.SetAffiliation(ownerJID.String(), pubsubmodel.AffiliationOwner)
+	return n
+}
+
+// publishOptionsForm returns publish options as a node configuration form.
+func publishOptionsForm(publishOptions xmpp.XElement) (*xep0004.DataForm, bool) {
+	xEl := publishOptions.Elements().ChildNamespace("x", formNamespace)
+	if xEl == nil {
+		return nil, true
+	}
+	form, err := xep0004.NewFormFromElement(xEl)
+	if err != nil || form.Type != xep0004.Submit {
+		return nil, false
+	}
+	var fields []xep0004.Field
+	for _, f := range form.Fields {
+		if f.Var == formTypeField {
+			if len(f.Values) == 0 || f.Values[0] != pubSubPublishOptionsNamespace {
+				return nil, false
+			}
+			continue
+		}
+		fields = append(fields, f)
+	}
+	return &xep0004.DataForm{Type: xep0004.Submit, Fields: fields}, true
+}
+
+// meetsPreconditions returns whether or not current node options
+// already match those specified in a publish options form.
+func meetsPreconditions(opts *pubsubmodel.Options, form *xep0004.DataForm) bool {
+	updated := *opts
+	if err := pubsub.ApplyConfigForm(&updated, form); err != nil {
+		return false
+	}
+	return reflect.DeepEqual(updated, *opts)
+}
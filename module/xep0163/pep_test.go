@@ -0,0 +1,499 @@
+/*
+ * Copyright (c) 2018 Miguel Ángel Ortuño.
+ * See the LICENSE file for more information.
+ */
+
+package xep0163
+
+import (
+	"crypto/tls"
+	"testing"
+	"time"
+
+	"github.com/ortuman/jackal/model/pubsubmodel"
+	"github.com/ortuman/jackal/model/rostermodel"
+	"github.com/ortuman/jackal/module/xep0004"
+	"github.com/ortuman/jackal/router"
+	"github.com/ortuman/jackal/storage"
+	"github.com/ortuman/jackal/storage/memstorage"
+	"github.com/ortuman/jackal/stream"
+	"github.com/ortuman/jackal/xmpp"
+	"github.com/ortuman/jackal/xmpp/jid"
+	"github.com/pborman/uuid"
+	"github.com/stretchr/testify/require"
+)
+
+const avatarMetadataNamespace = "urn:xmpp:avatar:metadata"
+
+// avatarNotifyVer is the verification string of an entity
+// only supporting avatar metadata notifications.
+const avatarNotifyVer = "8F45SedAeGgjMY9+xBHkXbHaW9k="
+
+func TestXEP0163_Matching(t *testing.T) {
+	r, _, shutdown := setupTest("jackal.im")
+	defer shutdown()
+
+	x := New(nil, nil, r)
+	defer func() { _ = x.Shutdown() }()
+
+	j, _ := jid.New("ortuman", "jackal.im", "balcony", true)
+	srvJID, _ := jid.New("", "jackal.im", "", true)
+
+	iq := xmpp.NewIQType(uuid.New(), xmpp.SetType)
+	iq.SetFromJID(j)
+	iq.SetToJID(j.ToBareJID())
+	require.False(t, x.MatchesIQ(iq))
+
+	iq.AppendElement(xmpp.NewElementNamespace("pubsub", pubSubNamespace))
+	require.True(t, x.MatchesIQ(iq))
+
+	iq.SetToJID(srvJID)
+	require.False(t, x.MatchesIQ(iq))
+
+	// unrequested responses
+	res := xmpp.NewIQType(uuid.New(), xmpp.ResultType)
+	res.SetFromJID(j)
+	res.SetToJID(j.ToBareJID())
+	require.False(t, x.MatchesIQ(res))
+}
+
+func TestXEP0163_PublishAndNotify(t *testing.T) {
+	r, _, shutdown := setupTest("jackal.im")
+	defer shutdown()
+
+	x := New(nil, nil, r)
+	defer func() { _ = x.Shutdown() }()
+
+	x.caps["http://jackal.im#v1"] = []string{avatarMetadataNamespace + notifySuffix}
+
+	stm1 := setupStream(r, "ortuman", "balcony", "v1")
+	stm2 := setupStream(r, "ortuman", "garden", "v1")
+	stm3 := setupStream(r, "noelia", "yard", "v1")
+	stm4 := setupStream(r, "romeo", "orchard", "v1")
+
+	setupRosterItems(t, "ortuman", "noelia")
+
+	x.ProcessIQ(publishIQ(stm1, "ortuman@jackal.im", "i1", nil))
+
+	elem := stm1.ReceiveElement()
+	require.Equal(t, xmpp.ResultType, elem.Type())
+	item := elem.Elements().ChildNamespace("pubsub", pubSubNamespace).Elements().Child("publish").Elements().Child("item")
+	require.Equal(t, "i1", item.Attributes().Get("id"))
+
+	// node was auto-created
+	n, err := storage.FetchPubSubNode("ortuman@jackal.im", avatarMetadataNamespace)
+	require.Nil(t, err)
+	require.NotNil(t, n)
+	require.Equal(t, pubsubmodel.AccessModelPresence, n.Options.AccessModel)
+	require.Equal(t, pubsubmodel.AffiliationOwner, n.Affiliation("ortuman@jackal.im"))
+
+	// owner resources and presence subscribed contacts get notified
+	for _, stm := range []*stream.MockC2S{stm1, stm2, stm3} {
+		elem = stm.ReceiveElement()
+		require.Equal(t, "message", elem.Name())
+		require.Equal(t, "ortuman@jackal.im", elem.From())
+		require.Equal(t, stm.JID().String(), elem.To())
+		items := elem.Elements().ChildNamespace("event", pubSubEventNamespace).Elements().Child("items")
+		require.Equal(t, avatarMetadataNamespace, items.Attributes().Get("node"))
+		require.NotNil(t, items.Elements().Child("item").Elements().ChildNamespace("metadata", avatarMetadataNamespace))
+	}
+
+	// only account owner can publish
+	x.ProcessIQ(publishIQ(stm3, "ortuman@jackal.im", "i2", nil))
+	elem = stm3.ReceiveElement()
+	require.Equal(t, xmpp.ErrForbidden.Error(), elem.Error().Elements().All()[0].Name())
+
+	// items retrieval
+	x.ProcessIQ(itemsIQ(stm3, "ortuman@jackal.im"))
+	elem = stm3.ReceiveElement()
+	require.Equal(t, xmpp.ResultType, elem.Type())
+	items := elem.Elements().ChildNamespace("pubsub", pubSubNamespace).Elements().Child("items").Elements().Children("item")
+	require.Equal(t, 1, len(items))
+	require.Equal(t, "i1", items[0].Attributes().Get("id"))
+
+	x.ProcessIQ(itemsIQ(stm4, "ortuman@jackal.im"))
+	elem = stm4.ReceiveElement()
+	require.Equal(t, xmpp.ErrNotAuthorized.Error(), elem.Error().Elements().All()[0].Name())
+	require.NotNil(t, elem.Error().Elements().ChildNamespace("presence-subscription-required", pubSubErrorsNamespace))
+
+	// retract
+	retract := xmpp.NewElementName("retract")
+	retract.SetAttribute("node", avatarMetadataNamespace)
+	retract.AppendElement(xmpp.NewElementName("item").SetAttribute("id", "i1"))
+	x.ProcessIQ(pubSubIQ(stm1, "ortuman@jackal.im", xmpp.SetType, pubSubNamespace, retract))
+
+	elem = stm1.ReceiveElement()
+	require.Equal(t, xmpp.ResultType, elem.Type())
+
+	elem = stm3.ReceiveElement()
+	require.NotNil(t, elem.Elements().ChildNamespace("event", pubSubEventNamespace).Elements().Child("items").Elements().Child("retract"))
+
+	itms, _ := storage.FetchPubSubItems("ortuman@jackal.im", avatarMetadataNamespace)
+	require.Equal(t, 0, len(itms))
+}
+
+func TestXEP0163_PublishOptions(t *testing.T) {
+	r, _, shutdown := setupTest("jackal.im")
+	defer shutdown()
+
+	x := New(nil, nil, r)
+	defer func() { _ = x.Shutdown() }()
+
+	stm := setupStream(r, "ortuman", "balcony", "")
+
+	options := &xep0004.DataForm{
+		Type: xep0004.Submit,
+		Fields: []xep0004.Field{
+			{Var: formTypeField, Type: xep0004.Hidden, Values: []string{pubSubPublishOptionsNamespace}},
+			{Var: "pubsub#access_model", Values: []string{pubsubmodel.AccessModelOpen}},
+		},
+	}
+	x.ProcessIQ(publishIQ(stm, "ortuman@jackal.im", "i1", options))
+	elem := stm.ReceiveElement()
+	require.Equal(t, xmpp.ResultType, elem.Type())
+
+	n, _ := storage.FetchPubSubNode("ortuman@jackal.im", avatarMetadataNamespace)
+	require.NotNil(t, n)
+	require.Equal(t, pubsubmodel.AccessModelOpen, n.Options.AccessModel)
+
+	// preconditions are met
+	x.ProcessIQ(publishIQ(stm, "ortuman@jackal.im", "i2", options))
+	elem = stm.ReceiveElement()
+	require.Equal(t, xmpp.ResultType, elem.Type())
+
+	options.Fields[1].Values = []string{pubsubmodel.AccessModelWhitelist}
+	x.ProcessIQ(publishIQ(stm, "ortuman@jackal.im", "i3", options))
+	elem = stm.ReceiveElement()
+	require.Equal(t, xmpp.ErrConflict.Error(), elem.Error().Elements().All()[0].Name())
+	require.NotNil(t, elem.Error().Elements().ChildNamespace("precondition-not-met", pubSubErrorsNamespace))
+
+	// invalid form type
+	options.Fields[0].Values = []string{"urn:xmpp:unknown"}
+	x.ProcessIQ(publishIQ(stm, "ortuman@jackal.im", "i4", options))
+	elem = stm.ReceiveElement()
+	require.Equal(t, xmpp.ErrBadRequest.Error(), elem.Error().Elements().All()[0].Name())
+}
+
+func TestXEP0163_LastPublishedItem(t *testing.T) {
+	r, _, shutdown := setupTest("jackal.im")
+	defer shutdown()
+
+	x := New(nil, nil, r)
+	defer func() { _ = x.Shutdown() }()
+
+	stm1 := setupStream(r, "ortuman", "balcony", "")
+	setupRosterItems(t, "ortuman", "noelia")
+
+	x.ProcessIQ(publishIQ(stm1, "ortuman@jackal.im", "i1", nil))
+	elem := stm1.ReceiveElement()
+	require.Equal(t, xmpp.ResultType, elem.Type())
+
+	// contact becomes available advertising unknown capabilities
+	stm2 := setupStream(r, "noelia", "yard", avatarNotifyVer)
+	x.ProcessPresence(stm2.Presence())
+
+	elem = stm2.ReceiveElement()
+	require.Equal(t, "iq", elem.Name())
+	require.Equal(t, xmpp.GetType, elem.Type())
+	q := elem.Elements().ChildNamespace("query", discoInfoNamespace)
+	require.NotNil(t, q)
+	require.Equal(t, "http://jackal.im#"+avatarNotifyVer, q.Attributes().Get("node"))
+
+	iq, _ := xmpp.NewIQFromElement(elem, elem.(xmpp.Stanza).FromJID(), elem.(xmpp.Stanza).ToJID())
+	res := iq.ResultIQ()
+	query := xmpp.NewElementNamespace("query", discoInfoNamespace)
+	query.AppendElement(xmpp.NewElementName("feature").SetAttribute("var", avatarMetadataNamespace+notifySuffix))
+	res.AppendElement(query)
+
+	require.True(t, x.MatchesIQ(res))
+	x.ProcessIQ(res)
+
+	elem = stm2.ReceiveElement()
+	require.Equal(t, "message", elem.Name())
+	require.Equal(t, "ortuman@jackal.im", elem.From())
+	item := elem.Elements().ChildNamespace("event", pubSubEventNamespace).Elements().Child("items").Elements().Child("item")
+	require.Equal(t, "i1", item.Attributes().Get("id"))
+
+	require.Equal(t, []string{avatarMetadataNamespace + notifySuffix}, x.caps["http://jackal.im#"+avatarNotifyVer])
+}
+
+func TestXEP0163_NotifyPendingCaps(t *testing.T) {
+	r, _, shutdown := setupTest("jackal.im")
+	defer shutdown()
+
+	x := New(nil, nil, r)
+	defer func() { _ = x.Shutdown() }()
+
+	stm1 := setupStream(r, "ortuman", "balcony", "")
+	stm2 := setupStream(r, "noelia", "yard", avatarNotifyVer)
+	setupRosterItems(t, "ortuman", "noelia")
+
+	// contact capabilities are unknown... event is held until they're resolved
+	x.ProcessIQ(publishIQ(stm1, "ortuman@jackal.im", "i1", nil))
+	elem := stm1.ReceiveElement()
+	require.Equal(t, xmpp.ResultType, elem.Type())
+
+	elem = stm2.ReceiveElement()
+	require.Equal(t, "iq", elem.Name())
+	require.Equal(t, "ortuman@jackal.im", elem.From())
+
+	iq, _ := xmpp.NewIQFromElement(elem, elem.(xmpp.Stanza).FromJID(), elem.(xmpp.Stanza).ToJID())
+	res := iq.ResultIQ()
+	query := xmpp.NewElementNamespace("query", discoInfoNamespace)
+	query.AppendElement(xmpp.NewElementName("feature").SetAttribute("var", avatarMetadataNamespace+notifySuffix))
+	res.AppendElement(query)
+	x.ProcessIQ(res)
+
+	elem = stm2.ReceiveElement()
+	require.Equal(t, "message", elem.Name())
+	item := elem.Elements().ChildNamespace("event", pubSubEventNamespace).Elements().Child("items").Elements().Child("item")
+	require.Equal(t, "i1", item.Attributes().Get("id"))
+}
+
+func TestXEP0163_UnverifiedCaps(t *testing.T) {
+	r, _, shutdown := setupTest("jackal.im")
+	defer shutdown()
+
+	x := New(nil, nil, r)
+	defer func() { _ = x.Shutdown() }()
+
+	stm1 := setupStream(r, "ortuman", "balcony", "")
+	setupRosterItems(t, "ortuman", "noelia")
+
+	x.ProcessIQ(publishIQ(stm1, "ortuman@jackal.im", "i1", nil))
+	elem := stm1.ReceiveElement()
+	require.Equal(t, xmpp.ResultType, elem.Type())
+
+	// advertised verification string does not match disco info
+	stm2 := setupStream(r, "noelia", "yard", "v2")
+	x.ProcessPresence(stm2.Presence())
+
+	elem = stm2.ReceiveElement()
+	iq, _ := xmpp.NewIQFromElement(elem, elem.(xmpp.Stanza).FromJID(), elem.(xmpp.Stanza).ToJID())
+	res := iq.ResultIQ()
+	query := xmpp.NewElementNamespace("query", discoInfoNamespace)
+	query.AppendElement(xmpp.NewElementName("feature").SetAttribute("var", avatarMetadataNamespace+notifySuffix))
+	res.AppendElement(query)
+	x.ProcessIQ(res)
+
+	// items are delivered, but capabilities are not cached
+	elem = stm2.ReceiveElement()
+	require.Equal(t, "message", elem.Name())
+
+	tUtilWaitRunQueue(x)
+	_, ok := x.caps["http://jackal.im#v2"]
+	require.False(t, ok)
+}
+
+func TestXEP0163_CapsRequestTimeout(t *testing.T) {
+	r, _, shutdown := setupTest("jackal.im")
+	defer shutdown()
+
+	x := New(nil, nil, r)
+	x.capsTimeout = time.Millisecond * 100
+	defer func() { _ = x.Shutdown() }()
+
+	stm1 := setupStream(r, "noelia", "yard", avatarNotifyVer)
+	stm2 := setupStream(r, "noelia", "garden", avatarNotifyVer)
+	x.ProcessPresence(stm1.Presence())
+	x.ProcessPresence(stm2.Presence())
+
+	// first advertiser does not answer...
+	elem := stm1.ReceiveElement()
+	require.Equal(t, "iq", elem.Name())
+
+	// ...so capabilities are requested to the next one
+	elem = stm2.ReceiveElement()
+	require.Equal(t, "iq", elem.Name())
+	require.Equal(t, "noelia@jackal.im/garden", elem.To())
+
+	// no one answered... pending request is released
+	time.Sleep(time.Millisecond * 250)
+	tUtilWaitRunQueue(x)
+	_, ok := x.capsReqs.Load(elem.ID())
+	require.False(t, ok)
+	require.Len(t, x.capsKeys, 0)
+}
+
+func TestXEP0163_CapsVerificationString(t *testing.T) {
+	// https://xmpp.org/extensions/xep-0115.html#ver-gen-simple
+	query := xmpp.NewElementNamespace("query", discoInfoNamespace)
+	query.AppendElement(xmpp.NewElementName("identity").SetAttribute("category", "client").SetAttribute("type", "pc").SetAttribute("name", "Exodus 0.9.1"))
+	for _, f := range []string{"http://jabber.org/protocol/disco#info", "http://jabber.org/protocol/disco#items", "http://jabber.org/protocol/muc", "http://jabber.org/protocol/caps"} {
+		query.AppendElement(xmpp.NewElementName("feature").SetAttribute("var", f))
+	}
+	require.Equal(t, "QgayPKawpkPSDYmwT/WM94uAlu0=", capsVerificationString(query, capsHash("sha-1")))
+
+	// https://xmpp.org/extensions/xep-0115.html#ver-gen-complex
+	query = xmpp.NewElementNamespace("query", discoInfoNamespace)
+	query.AppendElement(xmpp.NewElementName("identity").SetAttribute("xml:lang", "en").SetAttribute("category", "client").SetAttribute("name", "Psi 0.11").SetAttribute("type", "pc"))
+	query.AppendElement(xmpp.NewElementName("identity").SetAttribute("xml:lang", "el").SetAttribute("category", "client").SetAttribute("name", "Ψ 0.11").SetAttribute("type", "pc"))
+	for _, f := range []string{"http://jabber.org/protocol/caps", "http://jabber.org/protocol/disco#info", "http://jabber.org/protocol/disco#items", "http://jabber.org/protocol/muc"} {
+		query.AppendElement(xmpp.NewElementName("feature").SetAttribute("var", f))
+	}
+	form := xep0004.DataForm{
+		Type: xep0004.Result,
+		Fields: []xep0004.Field{
+			{Var: formTypeField, Type: xep0004.Hidden, Values: []string{"urn:xmpp:dataforms:softwareinfo"}},
+			{Var: "ip_version", Values: []string{"ipv4", "ipv6"}},
+			{Var: "os", Values: []string{"Mac"}},
+			{Var: "os_version", Values: []string{"10.5.1"}},
+			{Var: "software", Values: []string{"Psi"}},
+			{Var: "software_version", Values: []string{"0.11"}},
+		},
+	}
+	query.AppendElement(form.Element())
+	require.Equal(t, "q07IKJEyjvHSyhy//CH0CxmKi8w=", capsVerificationString(query, capsHash("sha-1")))
+	require.Nil(t, capsHash("md5"))
+}
+
+func TestXEP0163_ConfigureAndDelete(t *testing.T) {
+	r, _, shutdown := setupTest("jackal.im")
+	defer shutdown()
+
+	x := New(nil, nil, r)
+	defer func() { _ = x.Shutdown() }()
+
+	x.caps["http://jackal.im#v1"] = []string{avatarMetadataNamespace + notifySuffix}
+
+	stm1 := setupStream(r, "ortuman", "balcony", "")
+	stm2 := setupStream(r, "noelia", "yard", "v1")
+	setupRosterItems(t, "ortuman", "noelia")
+
+	create := xmpp.NewElementName("create")
+	create.SetAttribute("node", avatarMetadataNamespace)
+	x.ProcessIQ(pubSubIQ(stm1, "ortuman@jackal.im", xmpp.SetType, pubSubNamespace, create))
+	elem := stm1.ReceiveElement()
+	require.Equal(t, xmpp.ResultType, elem.Type())
+
+	x.ProcessIQ(pubSubIQ(stm1, "ortuman@jackal.im", xmpp.SetType, pubSubNamespace, create))
+	elem = stm1.ReceiveElement()
+	require.Equal(t, xmpp.ErrConflict.Error(), elem.Error().Elements().All()[0].Name())
+
+	configure := xmpp.NewElementName("configure")
+	configure.SetAttribute("node", avatarMetadataNamespace)
+
+	// only owner can configure its nodes
+	x.ProcessIQ(pubSubIQ(stm2, "ortuman@jackal.im", xmpp.GetType, pubSubOwnerNamespace, configure))
+	elem = stm2.ReceiveElement()
+	require.Equal(t, xmpp.ErrForbidden.Error(), elem.Error().Elements().All()[0].Name())
+
+	x.ProcessIQ(pubSubIQ(stm1, "ortuman@jackal.im", xmpp.GetType, pubSubOwnerNamespace, configure))
+	elem = stm1.ReceiveElement()
+	require.Equal(t, xmpp.ResultType, elem.Type())
+	xEl := elem.Elements().ChildNamespace("pubsub", pubSubOwnerNamespace).Elements().Child("configure").Elements().ChildNamespace("x", formNamespace)
+	require.NotNil(t, xEl)
+
+	form := &xep0004.DataForm{
+		Type: xep0004.Submit,
+		Fields: []xep0004.Field{
+			{Var: "pubsub#max_items", Values: []string{"5"}},
+		},
+	}
+	configure.AppendElement(form.Element())
+	x.ProcessIQ(pubSubIQ(stm1, "ortuman@jackal.im", xmpp.SetType, pubSubOwnerNamespace, configure))
+	elem = stm1.ReceiveElement()
+	require.Equal(t, xmpp.ResultType, elem.Type())
+
+	n, _ := storage.FetchPubSubNode("ortuman@jackal.im", avatarMetadataNamespace)
+	require.Equal(t, 5, n.Options.MaxItems)
+
+	del := xmpp.NewElementName("delete")
+	del.SetAttribute("node", avatarMetadataNamespace)
+	x.ProcessIQ(pubSubIQ(stm1, "ortuman@jackal.im", xmpp.SetType, pubSubOwnerNamespace, del))
+	elem = stm1.ReceiveElement()
+	require.Equal(t, xmpp.ResultType, elem.Type())
+
+	elem = stm2.ReceiveElement()
+	require.NotNil(t, elem.Elements().ChildNamespace("event", pubSubEventNamespace).Elements().Child("delete"))
+
+	n, _ = storage.FetchPubSubNode("ortuman@jackal.im", avatarMetadataNamespace)
+	require.Nil(t, n)
+}
+
+func setupTest(domain string) (*router.Router, *memstorage.Storage, func()) {
+	r, _ := router.New(&router.Config{
+		Hosts: []router.HostConfig{{Name: domain, Certificate: tls.Certificate{}}},
+	})
+	s := memstorage.New()
+	storage.Set(s)
+	return r, s, func() {
+		storage.Unset()
+	}
+}
+
+// tUtilWaitRunQueue waits until every module enqueued task has been processed.
+func tUtilWaitRunQueue(x *Pep) {
+	done := make(chan struct{})
+	x.runQueue.Run(func() { close(done) })
+	<-done
+}
+
+func setupStream(r *router.Router, username, resource, capsVer string) *stream.MockC2S {
+	j, _ := jid.New(username, "jackal.im", resource, true)
+	stm := stream.NewMockC2S(uuid.New(), j)
+
+	p := xmpp.NewPresence(j, j.ToBareJID(), xmpp.AvailableType)
+	if len(capsVer) > 0 {
+		c := xmpp.NewElementNamespace("c", capsNamespace)
+		c.SetAttribute("hash", "sha-1")
+		c.SetAttribute("node", "http://jackal.im")
+		c.SetAttribute("ver", capsVer)
+		p.AppendElement(c)
+	}
+	stm.SetPresence(p)
+	r.Bind(stm)
+	return stm
+}
+
+// setupRosterItems makes contact subscribed to user presence.
+func setupRosterItems(t *testing.T, username, contact string) {
+	_, err := storage.InsertOrUpdateRosterItem(&rostermodel.Item{
+		Username:     username,
+		JID:          contact + "@jackal.im",
+		Subscription: rostermodel.SubscriptionFrom,
+	})
+	require.Nil(t, err)
+	_, err = storage.InsertOrUpdateRosterItem(&rostermodel.Item{
+		Username:     contact,
+		JID:          username + "@jackal.im",
+		Subscription: rostermodel.SubscriptionTo,
+	})
+	require.Nil(t, err)
+}
+
+func pubSubIQ(stm *stream.MockC2S, to, iqType, namespace string, cmd xmpp.XElement) *xmpp.IQ {
+	toJID, _ := jid.NewWithString(to, true)
+	iq := xmpp.NewIQType(uuid.New(), iqType)
+	iq.SetFromJID(stm.JID())
+	iq.SetToJID(toJID)
+
+	ps := xmpp.NewElementNamespace("pubsub", namespace)
+	ps.AppendElement(cmd)
+	iq.AppendElement(ps)
+	return iq
+}
+
+func publishIQ(stm *stream.MockC2S, to, itemID string, options *xep0004.DataForm) *xmpp.IQ {
+	item := xmpp.NewElementName("item")
+	item.SetAttribute("id", itemID)
+	item.AppendElement(xmpp.NewElementNamespace("metadata", avatarMetadataNamespace))
+
+	publish := xmpp.NewElementName("publish")
+	publish.SetAttribute("node", avatarMetadataNamespace)
+	publish.AppendElement(item)
+
+	iq := pubSubIQ(stm, to, xmpp.SetType, pubSubNamespace, publish)
+	if options != nil {
+		publishOptions := xmpp.NewElementName("publish-options")
+		publishOptions.AppendElement(options.Element())
+		iq.Elements().ChildNamespace("pubsub", pubSubNamespace).(*xmpp.Element).AppendElement(publishOptions)
+	}
+	return iq
+}
+
+func itemsIQ(stm *stream.MockC2S, to string) *xmpp.IQ {
+	items := xmpp.NewElementName("items")
+	items.SetAttribute("node", avatarMetadataNamespace)
+	return pubSubIQ(stm, to, xmpp.GetType, pubSubNamespace, items)
+}
@@ -77,6 +77,37 @@ func (x *BlockingCommand) Shutdown() error {
 	return nil
 }
 
+// Block adds a set of JIDs to a user block list, notifying
+// every user resource that previously requested it.
+func (x *BlockingCommand) Block(userJID *jid.JID, jds []*jid.JID) error {
+	errCh := make(chan error, 1)
+	x.runQueue.Run(func() {
+		if err := x.blockJIDs(userJID.ToBareJID(), jds); err != nil {
+			errCh <- err
+			return
+		}
+		x.pushIQ(x.itemsElement("block", jds), userJID.Node())
+		errCh <- nil
+	})
+	return <-errCh
+}
+
+// Unblock removes a set of JIDs from a user block list, notifying
+// every user resource that previously requested it.
+// An empty JID set clears the whole block list.
+func (x *BlockingCommand) Unblock(userJID *jid.JID, jds []*jid.JID) error {
+	errCh := make(chan error, 1)
+	x.runQueue.Run(func() {
+		if err := x.unblockJIDs(userJID.ToBareJID(), jds); err != nil {
+			errCh <- err
+			return
+		}
+		x.pushIQ(x.itemsElement("unblock", jds), userJID.Node())
+		errCh <- nil
+	})
+	return <-errCh
+}
+
 func (x *BlockingCommand) processIQ(iq *xmpp.IQ, stm stream.C2S) {
 	if iq.IsGet() {
 		x.sendBlockList(iq, stm)
@@ -112,8 +143,6 @@ func (x *BlockingCommand) sendBlockList(iq *xmpp.IQ, stm stream.C2S) {
 }
 
 func (x *BlockingCommand) block(iq *xmpp.IQ, block xmpp.XElement, stm stream.C2S) {
-	var bl []model.BlockListItem
-
 	items := block.Elements().Children("item")
 	if len(items) == 0 {
 		stm.SendElement(iq.BadRequestError())
@@ -125,28 +154,13 @@ func (x *BlockingCommand) block(iq *xmpp.IQ, block xmpp.XElement, stm stream.C2S
 		stm.SendElement(iq.JidMalformedError())
 		return
 	}
-	blItems, ris, err := x.fetchBlockListAndRosterItems(stm)
-	if err != nil {
+	if err := x.blockJIDs(stm.JID().ToBareJID(), jds); err != nil {
 		log.Error(err)
 		stm.SendElement(iq.InternalServerError())
 		return
 	}
-	username := stm.Username()
-	for _, j := range jds {
-		if !x.isJIDInBlockList(j, blItems) {
-			x.broadcastPresenceMatchingJID(j, ris, xmpp.UnavailableType, stm)
-			bl = append(bl, model.BlockListItem{Username: username, JID: j.String()})
-		}
-	}
-	if err := storage.InsertBlockListItems(bl); err != nil {
-		log.Error(err)
-		stm.SendElement(iq.InternalServerError())
-		return
-	}
-	x.router.ReloadBlockList(username)
-
 	stm.SendElement(iq.ResultIQ())
-	x.pushIQ(block, stm)
+	x.pushIQ(block, stm.Username())
 }
 
 func (x *BlockingCommand) unblock(iq *xmpp.IQ, unblock xmpp.XElement, stm stream.C2S) {
@@ -157,42 +171,67 @@ func (x *BlockingCommand) unblock(iq *xmpp.IQ, unblock xmpp.XElement, stm stream
 		stm.SendElement(iq.JidMalformedError())
 		return
 	}
-	blItems, ris, err := x.fetchBlockListAndRosterItems(stm)
-	if err != nil {
+	if err := x.unblockJIDs(stm.JID().ToBareJID(), jds); err != nil {
 		log.Error(err)
 		stm.SendElement(iq.InternalServerError())
 		return
 	}
-	username := stm.Username()
+	stm.SendElement(iq.ResultIQ())
+	x.pushIQ(unblock, stm.Username())
+}
+
+func (x *BlockingCommand) blockJIDs(userJID *jid.JID, jds []*jid.JID) error {
+	var bl []model.BlockListItem
+
+	blItems, ris, err := x.fetchBlockListAndRosterItems(userJID.Node())
+	if err != nil {
+		return err
+	}
+	username := userJID.Node()
+	for _, j := range jds {
+		if !x.isJIDInBlockList(j, blItems) {
+			x.broadcastPresenceMatchingJID(j, ris, xmpp.UnavailableType, userJID)
+			bl = append(bl, model.BlockListItem{Username: username, JID: j.String()})
+		}
+	}
+	if err := storage.InsertBlockListItems(bl); err != nil {
+		return err
+	}
+	x.router.ReloadBlockList(userJID)
+	return nil
+}
+
+func (x *BlockingCommand) unblockJIDs(userJID *jid.JID, jds []*jid.JID) error {
+	blItems, ris, err := x.fetchBlockListAndRosterItems(userJID.Node())
+	if err != nil {
+		return err
+	}
+	username := userJID.Node()
 	var bl []model.BlockListItem
 	if len(jds) == 0 {
 		for _, blItem := range blItems {
 			j, _ := jid.NewWithString(blItem.JID, true)
-			x.broadcastPresenceMatchingJID(j, ris, xmpp.AvailableType, stm)
+			x.broadcastPresenceMatchingJID(j, ris, xmpp.AvailableType, userJID)
 		}
 		bl = blItems
 
 	} else {
 		for _, j := range jds {
 			if x.isJIDInBlockList(j, blItems) {
-				x.broadcastPresenceMatchingJID(j, ris, xmpp.AvailableType, stm)
+				x.broadcastPresenceMatchingJID(j, ris, xmpp.AvailableType, userJID)
 				bl = append(bl, model.BlockListItem{Username: username, JID: j.String()})
 			}
 		}
 	}
 	if err := storage.DeleteBlockListItems(bl); err != nil {
-		log.Error(err)
-		stm.SendElement(iq.InternalServerError())
-		return
+		return err
 	}
-	x.router.ReloadBlockList(username)
-
-	stm.SendElement(iq.ResultIQ())
-	x.pushIQ(unblock, stm)
+	x.router.ReloadBlockList(userJID)
+	return nil
 }
 
-func (x *BlockingCommand) pushIQ(elem xmpp.XElement, stm stream.C2S) {
-	stms := x.router.UserStreams(stm.Username())
+func (x *BlockingCommand) pushIQ(elem xmpp.XElement, username string) {
+	stms := x.router.UserStreams(username)
 	for _, stm := range stms {
 		if !stm.GetBool(xep191RequestedContextKey) {
 			continue
@@ -203,7 +242,7 @@ func (x *BlockingCommand) pushIQ(elem xmpp.XElement, stm stream.C2S) {
 	}
 }
 
-func (x *BlockingCommand) broadcastPresenceMatchingJID(jid *jid.JID, ris []rostermodel.Item, presenceType string, stm stream.C2S) {
+func (x *BlockingCommand) broadcastPresenceMatchingJID(jid *jid.JID, ris []rostermodel.Item, presenceType string, userJID *jid.JID) {
 	if x.roster == nil {
 		// roster disabled
 		return
@@ -213,7 +252,7 @@ func (x *BlockingCommand) broadcastPresenceMatchingJID(jid *jid.JID, ris []roste
 		if !x.isSubscribedTo(presence.FromJID().ToBareJID(), ris) {
 			continue
 		}
-		p := xmpp.NewPresence(presence.FromJID(), stm.JID().ToBareJID(), presenceType)
+		p := xmpp.NewPresence(presence.FromJID(), userJID, presenceType)
 		if presenceType == xmpp.AvailableType {
 			p.AppendElements(presence.Elements().All())
 		}
@@ -240,8 +279,7 @@ func (x *BlockingCommand) isSubscribedTo(jid *jid.JID, ris []rostermodel.Item) b
 	return false
 }
 
-func (x *BlockingCommand) fetchBlockListAndRosterItems(stm stream.C2S) ([]model.BlockListItem, []rostermodel.Item, error) {
-	username := stm.Username()
+func (x *BlockingCommand) fetchBlockListAndRosterItems(username string) ([]model.BlockListItem, []rostermodel.Item, error) {
 	blItms, err := storage.FetchBlockListItems(username)
 	if err != nil {
 		return nil, nil, err
@@ -253,6 +291,16 @@ func (x *BlockingCommand) fetchBlockListAndRosterItems(stm stream.C2S) ([]model.
 	return blItms, ris, nil
 }
 
+func (x *BlockingCommand) itemsElement(name string, jds []*jid.JID) xmpp.XElement {
+	elem := xmpp.NewElementNamespace(name, blockingCommandNamespace)
+	for _, j := range jds {
+		itElem := xmpp.NewElementName("item")
+		itElem.SetAttribute("jid", j.String())
+		elem.AppendElement(itElem)
+	}
+	return elem
+}
+
 func (x *BlockingCommand) extractItemJIDs(items []xmpp.XElement) ([]*jid.JID, error) {
 	var ret []*jid.JID
 	for _, item := range items {
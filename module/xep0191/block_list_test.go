@@ -277,6 +277,40 @@ func TestXEP191_BlockAndUnblock(t *testing.T) {
 	require.Equal(t, 0, len(blItems))
 }
 
+func TestXEP191_BlockAndUnblockWithoutStream(t *testing.T) {
+	rtr, _, shutdown := setupTest("jackal.im")
+	defer shutdown()
+
+	x := New(nil, nil, rtr)
+	defer x.Shutdown()
+
+	j1, _ := jid.New("ortuman", "jackal.im", "balcony", true)
+	stm1 := stream.NewMockC2S(uuid.New(), j1)
+	stm1.SetAuthenticated(true)
+	stm1.SetBool(xep191RequestedContextKey, true)
+	rtr.Bind(stm1)
+
+	bj, _ := jid.NewWithString("romeo@jackal.im", true)
+
+	require.Nil(t, x.Block(j1.ToBareJID(), []*jid.JID{bj}))
+
+	elem := stm1.ReceiveElement()
+	block := elem.Elements().ChildNamespace("block", blockingCommandNamespace)
+	require.NotNil(t, block)
+	require.Equal(t, "romeo@jackal.im", block.Elements().Child("item").Attributes().Get("jid"))
+
+	blItems, _ := storage.FetchBlockListItems("ortuman")
+	require.Equal(t, []model.BlockListItem{{Username: "ortuman", JID: "romeo@jackal.im"}}, blItems)
+
+	require.Nil(t, x.Unblock(j1.ToBareJID(), []*jid.JID{bj}))
+
+	elem = stm1.ReceiveElement()
+	require.NotNil(t, elem.Elements().ChildNamespace("unblock", blockingCommandNamespace))
+
+	blItems, _ = storage.FetchBlockListItems("ortuman")
+	require.Equal(t, 0, len(blItems))
+}
+
 func setupTest(domain string) (*router.Router, *memstorage.Storage, func()) {
 	r, _ := router.New(&router.Config{
 		Hosts: []router.HostConfig{{Name: domain, Certificate: tls.Certificate{}}},
@@ -0,0 +1,80 @@
+/*
+ * Copyright (c) 2018 Miguel Ángel Ortuño.
+ * See the LICENSE file for more information.
+ */
+
+package xep0280
+
+import (
+	"github.com/ortuman/jackal/log"
+	"github.com/ortuman/jackal/module/xep0030"
+	"github.com/ortuman/jackal/router"
+	"github.com/ortuman/jackal/runqueue"
+	"github.com/ortuman/jackal/stream"
+	"github.com/ortuman/jackal/xmpp"
+	"github.com/ortuman/jackal/xmpp/jid"
+)
+
+const carbonsNamespace = "urn:xmpp:carbons:2"
+
+// Carbons represents a message carbons stream module.
+type Carbons struct {
+	router   *router.Router
+	runQueue *runqueue.RunQueue
+}
+
+// New returns a message carbons IQ handler module.
+func New(disco *xep0030.DiscoInfo, router *router.Router) *Carbons {
+	x := &Carbons{
+		router:   router,
+		runQueue: runqueue.New("xep0280"),
+	}
+	if disco != nil {
+		disco.RegisterServerFeature(carbonsNamespace)
+		disco.RegisterAccountFeature(carbonsNamespace)
+	}
+	return x
+}
+
+// MatchesIQ returns whether or not an IQ should be
+// processed by the message carbons module.
+func (x *Carbons) MatchesIQ(iq *xmpp.IQ) bool {
+	e := iq.Elements()
+	return iq.IsSet() && (e.ChildNamespace("enable", carbonsNamespace) != nil || e.ChildNamespace("disable", carbonsNamespace) != nil)
+}
+
+// ProcessIQ processes a message carbons IQ
+// taking according actions over the associated stream.
+func (x *Carbons) ProcessIQ(iq *xmpp.IQ) {
+	x.runQueue.Run(func() {
+		stm := x.router.UserStream(iq.FromJID())
+		if stm == nil {
+			return
+		}
+		x.processIQ(iq, stm)
+	})
+}
+
+// Shutdown shuts down message carbons module.
+func (x *Carbons) Shutdown() error {
+	c := make(chan struct{})
+	x.runQueue.Stop(func() { close(c) })
+	<-c
+	return nil
+}
+
+func (x *Carbons) processIQ(iq *xmpp.IQ, stm stream.C2S) {
+	toJID := iq.ToJID()
+	if !toJID.IsServer() && !(toJID.IsBare() && toJID.Matches(iq.FromJID(), jid.MatchesBare)) {
+		stm.SendElement(iq.ForbiddenError())
+		return
+	}
+	if iq.Elements().ChildNamespace("enable", carbonsNamespace) != nil {
+		stm.SetBool(router.CarbonsEnabledCtxKey, true)
+		log.Infof("enabled message carbons... (%s/%s)", stm.Username(), stm.Resource())
+	} else {
+		stm.SetBool(router.CarbonsEnabledCtxKey, false)
+		log.Infof("disabled message carbons... (%s/%s)", stm.Username(), stm.Resource())
+	}
+	stm.SendElement(iq.ResultIQ())
+}
@@ -0,0 +1,107 @@
+/*
+ * Copyright (c) 2018 Miguel Ángel Ortuño.
+ * See the LICENSE file for more information.
+ */
+
+package xep0280
+
+import (
+	"crypto/tls"
+	"testing"
+
+	"github.com/ortuman/jackal/router"
+	"github.com/ortuman/jackal/storage"
+	"github.com/ortuman/jackal/storage/memstorage"
+	"github.com/ortuman/jackal/stream"
+	"github.com/ortuman/jackal/xmpp"
+	"github.com/ortuman/jackal/xmpp/jid"
+	"github.com/pborman/uuid"
+	"github.com/stretchr/testify/require"
+)
+
+func TestXEP0280_Matching(t *testing.T) {
+	r, _, shutdown := setupTest("jackal.im")
+	defer shutdown()
+
+	x := New(nil, r)
+	defer x.Shutdown()
+
+	j, _ := jid.New("ortuman", "jackal.im", "balcony", true)
+
+	iq := xmpp.NewIQType(uuid.New(), xmpp.SetType)
+	iq.SetFromJID(j)
+	iq.SetToJID(j.ToBareJID())
+	require.False(t, x.MatchesIQ(iq))
+
+	iq.AppendElement(xmpp.NewElementNamespace("enable", carbonsNamespace))
+	require.True(t, x.MatchesIQ(iq))
+
+	iq2 := xmpp.NewIQType(uuid.New(), xmpp.SetType)
+	iq2.SetFromJID(j)
+	iq2.SetToJID(j.ToBareJID())
+	iq2.AppendElement(xmpp.NewElementNamespace("disable", carbonsNamespace))
+	require.True(t, x.MatchesIQ(iq2))
+
+	iq3 := xmpp.NewIQType(uuid.New(), xmpp.GetType)
+	iq3.SetFromJID(j)
+	iq3.SetToJID(j.ToBareJID())
+	iq3.AppendElement(xmpp.NewElementNamespace("enable", carbonsNamespace))
+	require.False(t, x.MatchesIQ(iq3))
+}
+
+func TestXEP0280_EnableDisable(t *testing.T) {
+	r, _, shutdown := setupTest("jackal.im")
+	defer shutdown()
+
+	x := New(nil, r)
+	defer x.Shutdown()
+
+	j1, _ := jid.New("ortuman", "jackal.im", "balcony", true)
+	j2, _ := jid.New("noelia", "jackal.im", "yard", true)
+	stm := stream.NewMockC2S(uuid.New(), j1)
+	r.Bind(stm)
+
+	// forbidden
+	iq := xmpp.NewIQType(uuid.New(), xmpp.SetType)
+	iq.SetFromJID(j1)
+	iq.SetToJID(j2.ToBareJID())
+	iq.AppendElement(xmpp.NewElementNamespace("enable", carbonsNamespace))
+	x.ProcessIQ(iq)
+
+	elem := stm.ReceiveElement()
+	require.Equal(t, xmpp.ErrorType, elem.Type())
+	require.Equal(t, xmpp.ErrForbidden.Error(), elem.Error().Elements().All()[0].Name())
+	require.False(t, stm.GetBool(router.CarbonsEnabledCtxKey))
+
+	// enable
+	iq.SetToJID(j1.ToBareJID())
+	x.ProcessIQ(iq)
+
+	elem = stm.ReceiveElement()
+	require.Equal(t, xmpp.ResultType, elem.Type())
+	require.Equal(t, iq.ID(), elem.ID())
+	require.True(t, stm.GetBool(router.CarbonsEnabledCtxKey))
+
+	// disable
+	iq2 := xmpp.NewIQType(uuid.New(), xmpp.SetType)
+	iq2.SetFromJID(j1)
+	srvJID, _ := jid.New("", "jackal.im", "", true)
+	iq2.SetToJID(srvJID)
+	iq2.AppendElement(xmpp.NewElementNamespace("disable", carbonsNamespace))
+	x.ProcessIQ(iq2)
+
+	elem = stm.ReceiveElement()
+	require.Equal(t, xmpp.ResultType, elem.Type())
+	require.False(t, stm.GetBool(router.CarbonsEnabledCtxKey))
+}
+
+func setupTest(domain string) (*router.Router, *memstorage.Storage, func()) {
+	r, _ := router.New(&router.Config{
+		Hosts: []router.HostConfig{{Name: domain, Certificate: tls.Certificate{}}},
+	})
+	s := memstorage.New()
+	storage.Set(s)
+	return r, s, func() {
+		storage.Unset()
+	}
+}
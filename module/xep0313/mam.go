@@ -0,0 +1,471 @@
+/*
+ * Copyright (c) 2018 Miguel Ángel Ortuño.
+ * See the LICENSE file for more information.
+ */
+
+package xep0313
+
+import (
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/ortuman/jackal/log"
+	"github.com/ortuman/jackal/model"
+	"github.com/ortuman/jackal/module/xep0004"
+	"github.com/ortuman/jackal/module/xep0030"
+	"github.com/ortuman/jackal/router"
+	"github.com/ortuman/jackal/runqueue"
+	"github.com/ortuman/jackal/storage"
+	"github.com/ortuman/jackal/xmpp"
+	"github.com/ortuman/jackal/xmpp/jid"
+	"github.com/pborman/uuid"
+)
+
+const (
+	mamNamespace     = "urn:xmpp:mam:2"
+	rsmNamespace     = "http://jabber.org/protocol/rsm"
+	forwardNamespace = "urn:xmpp:forward:0"
+	delayNamespace   = "urn:xmpp:delay"
+	hintsNamespace   = "urn:xmpp:hints"
+	formNamespace    = "jabber:x:data"
+)
+
+const formTypeField = "FORM_TYPE"
+
+const (
+	defaultMaxPageSize = 50
+	stampLayout        = "2006-01-02T15:04:05Z"
+)
+
+// Config represents Message Archive Management module (XEP-0313) configuration.
+type Config struct {
+	Default     string
+	MaxPageSize int
+}
+
+type configProxy struct {
+	Default     string `yaml:"default"`
+	MaxPageSize int    `yaml:"max_page_size"`
+}
+
+// UnmarshalYAML satisfies Unmarshaler interface.
+func (c *Config) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	p := configProxy{}
+	if err := unmarshal(&p); err != nil {
+		return err
+	}
+	switch p.Default {
+	case "":
+		c.Default = model.ArchiveAlways
+	case model.ArchiveAlways, model.ArchiveNever, model.ArchiveRoster:
+		c.Default = p.Default
+	default:
+		return fmt.Errorf("xep0313.Config: unrecognized default archiving mode: %s", p.Default)
+	}
+	c.MaxPageSize = p.MaxPageSize
+	if c.MaxPageSize == 0 {
+		c.MaxPageSize = defaultMaxPageSize
+	}
+	return nil
+}
+
+// Mam represents a message archive management server stream module.
+type Mam struct {
+	cfg      *Config
+	router   *router.Router
+	runQueue *runqueue.RunQueue
+}
+
+// New returns a message archive management IQ handler module.
+func New(config *Config, disco *xep0030.DiscoInfo, router *router.Router) *Mam {
+	x := &Mam{
+		cfg:      config,
+		router:   router,
+		runQueue: runqueue.New("xep0313"),
+	}
+	if disco != nil {
+		disco.RegisterAccountFeature(mamNamespace)
+	}
+	return x
+}
+
+// MatchesIQ returns whether or not an IQ should be
+// processed by the message archive management module.
+func (x *Mam) MatchesIQ(iq *xmpp.IQ) bool {
+	return iq.Elements().ChildNamespace("query", mamNamespace) != nil ||
+		iq.Elements().ChildNamespace("prefs", mamNamespace) != nil
+}
+
+// ProcessIQ processes a message archive management IQ
+// taking according actions over the associated stream.
+func (x *Mam) ProcessIQ(iq *xmpp.IQ) {
+	x.runQueue.Run(func() {
+		x.processIQ(iq)
+	})
+}
+
+// ArchiveMessage stores a message into the archive of
+// every local user involved in the conversation.
+func (x *Mam) ArchiveMessage(message *xmpp.Message) {
+	if !isMessageArchivable(message) {
+		return
+	}
+	createdAt := time.Now().UTC()
+	x.runQueue.Run(func() {
+		fromJID := message.FromJID()
+		toJID := message.ToJID()
+		if x.router.IsLocalHost(fromJID.Domain()) && len(fromJID.Node()) > 0 {
+			x.archiveMessage(message, fromJID.Node(), toJID.ToBareJID().String(), createdAt)
+		}
+		if x.router.IsLocalHost(toJID.Domain()) && len(toJID.Node()) > 0 && !fromJID.Matches(toJID, jid.MatchesBare) {
+			x.archiveMessage(message, toJID.Node(), fromJID.ToBareJID().String(), createdAt)
+		}
+	})
+}
+
+// Shutdown shuts down message archive management module.
+func (x *Mam) Shutdown() error {
+	c := make(chan struct{})
+	x.runQueue.Stop(func() { close(c) })
+	<-c
+	return nil
+}
+
+func (x *Mam) processIQ(iq *xmpp.IQ) {
+	fromJID := iq.FromJID()
+	toJID := iq.ToJID()
+	validTo := toJID.IsServer() || toJID.Node() == fromJID.Node()
+	if !validTo {
+		_ = x.router.Route(iq.ForbiddenError())
+		return
+	}
+	if q := iq.Elements().ChildNamespace("query", mamNamespace); q != nil {
+		switch {
+		case iq.IsGet():
+			x.sendQueryForm(iq)
+		case iq.IsSet():
+			x.queryArchive(iq, q)
+		default:
+			_ = x.router.Route(iq.BadRequestError())
+		}
+		return
+	}
+	prefs := iq.Elements().ChildNamespace("prefs", mamNamespace)
+	switch {
+	case iq.IsGet():
+		x.sendPrefs(iq)
+	case iq.IsSet():
+		x.setPrefs(iq, prefs)
+	default:
+		_ = x.router.Route(iq.BadRequestError())
+	}
+}
+
+func (x *Mam) archiveMessage(message *xmpp.Message, username, with string, createdAt time.Time) {
+	ok, err := x.shouldArchive(username, with)
+	if err != nil {
+		log.Error(err)
+		return
+	}
+	if !ok {
+		return
+	}
+	am := &model.ArchiveMessage{
+		Username:  username,
+		ID:        uuid.New(),
+		With:      with,
+		Message:   message,
+		CreatedAt: createdAt,
+	}
+	if err := storage.InsertArchiveMessage(am); err != nil {
+		log.Error(err)
+		return
+	}
+	log.Infof("archived message... (username: %s, id: %s)", username, am.ID)
+}
+
+func (x *Mam) shouldArchive(username, with string) (bool, error) {
+	prefs, err := x.fetchPrefs(username)
+	if err != nil {
+		return false, err
+	}
+	for _, j := range prefs.Never {
+		if j == with {
+			return false, nil
+		}
+	}
+	for _, j := range prefs.Always {
+		if j == with {
+			return true, nil
+		}
+	}
+	switch prefs.Default {
+	case model.ArchiveAlways:
+		return true, nil
+	case model.ArchiveRoster:
+		ri, err := storage.FetchRosterItem(username, with)
+		if err != nil {
+			return false, err
+		}
+		return ri != nil, nil
+	}
+	return false, nil
+}
+
+func (x *Mam) sendQueryForm(iq *xmpp.IQ) {
+	form := &xep0004.DataForm{
+		Type: xep0004.Form,
+		Fields: []xep0004.Field{
+			{Var: formTypeField, Type: xep0004.Hidden, Values: []string{mamNamespace}},
+			{Var: "with", Type: xep0004.JidSingle},
+			{Var: "start", Type: xep0004.TextSingle},
+			{Var: "end", Type: xep0004.TextSingle},
+		},
+	}
+	q := xmpp.NewElementNamespace("query", mamNamespace)
+	q.AppendElement(form.Element())
+
+	result := iq.ResultIQ()
+	result.AppendElement(q)
+	_ = x.router.Route(result)
+}
+
+func (x *Mam) queryArchive(iq *xmpp.IQ, query xmpp.XElement) {
+	filter, err := x.queryFilter(query)
+	if err != nil {
+		log.Error(err)
+		_ = x.router.Route(iq.BadRequestError())
+		return
+	}
+	fromJID := iq.FromJID()
+	username := fromJID.Node()
+
+	count, err := storage.CountArchiveMessages(username, filter)
+	if err != nil {
+		log.Error(err)
+		_ = x.router.Route(iq.InternalServerError())
+		return
+	}
+	// fetch an extra message to determine whether or not the result set is complete
+	max := filter.Max
+	filter.Max++
+
+	messages, err := storage.FetchArchiveMessages(username, filter)
+	if err != nil {
+		log.Error(err)
+		_ = x.router.Route(iq.InternalServerError())
+		return
+	}
+	complete := len(messages) <= max
+	if !complete {
+		if filter.LastPage || len(filter.BeforeID) > 0 {
+			messages = messages[1:]
+		} else {
+			messages = messages[:max]
+		}
+	}
+	queryID := query.Attributes().Get("queryid")
+	for i := range messages {
+		_ = x.router.Route(x.resultMessage(&messages[i], queryID, fromJID))
+	}
+	fin := xmpp.NewElementNamespace("fin", mamNamespace)
+	if complete {
+		fin.SetAttribute("complete", "true")
+	}
+	set := xmpp.NewElementNamespace("set", rsmNamespace)
+	if len(messages) > 0 {
+		first := xmpp.NewElementName("first")
+		first.SetText(messages[0].ID)
+		last := xmpp.NewElementName("last")
+		last.SetText(messages[len(messages)-1].ID)
+		set.AppendElement(first)
+		set.AppendElement(last)
+	}
+	countElem := xmpp.NewElementName("count")
+	countElem.SetText(strconv.Itoa(count))
+	set.AppendElement(countElem)
+	fin.AppendElement(set)
+
+	result := iq.ResultIQ()
+	result.AppendElement(fin)
+	_ = x.router.Route(result)
+}
+
+func (x *Mam) queryFilter(query xmpp.XElement) (*model.ArchiveFilter, error) {
+	filter := &model.ArchiveFilter{Max: x.cfg.MaxPageSize}
+
+	if formElem := query.Elements().ChildNamespace("x", formNamespace); formElem != nil {
+		form, err := xep0004.NewFormFromElement(formElem)
+		if err != nil {
+			return nil, err
+		}
+		for _, field := range form.Fields {
+			if len(field.Values) == 0 {
+				continue
+			}
+			value := field.Values[0]
+			switch field.Var {
+			case formTypeField:
+				if value != mamNamespace {
+					return nil, fmt.Errorf("xep0313: unexpected form type: %s", value)
+				}
+			case "with":
+				j, err := jid.NewWithString(value, false)
+				if err != nil {
+					return nil, err
+				}
+				filter.With = j.ToBareJID().String()
+			case "start":
+				t, err := time.Parse(time.RFC3339, value)
+				if err != nil {
+					return nil, err
+				}
+				filter.Start = t
+			case "end":
+				t, err := time.Parse(time.RFC3339, value)
+				if err != nil {
+					return nil, err
+				}
+				filter.End = t
+			default:
+				return nil, fmt.Errorf("xep0313: unrecognized form field: %s", field.Var)
+			}
+		}
+	}
+	if set := query.Elements().ChildNamespace("set", rsmNamespace); set != nil {
+		if maxElem := set.Elements().Child("max"); maxElem != nil {
+			max, err := strconv.Atoi(maxElem.Text())
+			if err != nil || max < 0 {
+				return nil, fmt.Errorf("xep0313: invalid max value: %s", maxElem.Text())
+			}
+			if max < filter.Max {
+				filter.Max = max
+			}
+		}
+		if after := set.Elements().Child("after"); after != nil {
+			filter.AfterID = after.Text()
+		}
+		if before := set.Elements().Child("before"); before != nil {
+			if len(before.Text()) > 0 {
+				filter.BeforeID = before.Text()
+			} else {
+				filter.LastPage = true
+			}
+		}
+	}
+	return filter, nil
+}
+
+func (x *Mam) resultMessage(am *model.ArchiveMessage, queryID string, to *jid.JID) *xmpp.Message {
+	delay := xmpp.NewElementNamespace("delay", delayNamespace)
+	delay.SetAttribute("stamp", am.CreatedAt.UTC().Format(stampLayout))
+
+	forwarded := xmpp.NewElementNamespace("forwarded", forwardNamespace)
+	forwarded.AppendElement(delay)
+	forwarded.AppendElement(am.Message)
+
+	result := xmpp.NewElementNamespace("result", mamNamespace)
+	if len(queryID) > 0 {
+		result.SetAttribute("queryid", queryID)
+	}
+	result.SetAttribute("id", am.ID)
+	result.AppendElement(forwarded)
+
+	msg := xmpp.NewMessageType(uuid.New(), xmpp.NormalType)
+	msg.SetFromJID(to.ToBareJID())
+	msg.SetToJID(to)
+	msg.AppendElement(result)
+	return msg
+}
+
+func (x *Mam) sendPrefs(iq *xmpp.IQ) {
+	prefs, err := x.fetchPrefs(iq.FromJID().Node())
+	if err != nil {
+		log.Error(err)
+		_ = x.router.Route(iq.InternalServerError())
+		return
+	}
+	result := iq.ResultIQ()
+	result.AppendElement(prefsElement(prefs))
+	_ = x.router.Route(result)
+}
+
+func (x *Mam) setPrefs(iq *xmpp.IQ, prefsElem xmpp.XElement) {
+	prefs := &model.ArchivePrefs{
+		Username: iq.FromJID().Node(),
+		Default:  prefsElem.Attributes().Get("default"),
+	}
+	switch prefs.Default {
+	case model.ArchiveAlways, model.ArchiveNever, model.ArchiveRoster:
+		break
+	default:
+		_ = x.router.Route(iq.BadRequestError())
+		return
+	}
+	if always := prefsElem.Elements().Child("always"); always != nil {
+		prefs.Always = prefsJIDs(always)
+	}
+	if never := prefsElem.Elements().Child("never"); never != nil {
+		prefs.Never = prefsJIDs(never)
+	}
+	if err := storage.InsertOrUpdateArchivePrefs(prefs); err != nil {
+		log.Error(err)
+		_ = x.router.Route(iq.InternalServerError())
+		return
+	}
+	result := iq.ResultIQ()
+	result.AppendElement(prefsElement(prefs))
+	_ = x.router.Route(result)
+}
+
+func (x *Mam) fetchPrefs(username string) (*model.ArchivePrefs, error) {
+	prefs, err := storage.FetchArchivePrefs(username)
+	if err != nil {
+		return nil, err
+	}
+	if prefs == nil {
+		prefs = &model.ArchivePrefs{Username: username, Default: x.cfg.Default}
+	}
+	return prefs, nil
+}
+
+func prefsElement(prefs *model.ArchivePrefs) xmpp.XElement {
+	elem := xmpp.NewElementNamespace("prefs", mamNamespace)
+	elem.SetAttribute("default", prefs.Default)
+
+	always := xmpp.NewElementName("always")
+	for _, j := range prefs.Always {
+		jElem := xmpp.NewElementName("jid")
+		jElem.SetText(j)
+		always.AppendElement(jElem)
+	}
+	never := xmpp.NewElementName("never")
+	for _, j := range prefs.Never {
+		jElem := xmpp.NewElementName("jid")
+		jElem.SetText(j)
+		never.AppendElement(jElem)
+	}
+	elem.AppendElement(always)
+	elem.AppendElement(never)
+	return elem
+}
+
+func prefsJIDs(elem xmpp.XElement) []string {
+	var ret []string
+	for _, jElem := range elem.Elements().Children("jid") {
+		j, err := jid.NewWithString(jElem.Text(), false)
+		if err != nil {
+			continue
+		}
+		ret = append(ret, j.ToBareJID().String())
+	}
+	return ret
+}
+
+func isMessageArchivable(message *xmpp.Message) bool {
+	if message.Elements().ChildNamespace("no-store", hintsNamespace) != nil {
+		return false
+	}
+	return (message.IsNormal() || message.IsChat()) && message.IsMessageWithBody()
+}
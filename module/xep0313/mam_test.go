@@ -0,0 +1,323 @@
+/*
+ * Copyright (c) 2018 Miguel Ángel Ortuño.
+ * See the LICENSE file for more information.
+ */
+
+package xep0313
+
+import (
+	"crypto/tls"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/ortuman/jackal/model"
+	"github.com/ortuman/jackal/router"
+	"github.com/ortuman/jackal/storage"
+	"github.com/ortuman/jackal/storage/memstorage"
+	"github.com/ortuman/jackal/stream"
+	"github.com/ortuman/jackal/xmpp"
+	"github.com/ortuman/jackal/xmpp/jid"
+	"github.com/pborman/uuid"
+	"github.com/stretchr/testify/require"
+	yaml "gopkg.in/yaml.v2"
+)
+
+func TestXEP0313_Config(t *testing.T) {
+	cfg := Config{}
+	require.NotNil(t, yaml.Unmarshal([]byte(`default: sometimes`), &cfg))
+
+	require.Nil(t, yaml.Unmarshal([]byte(`max_page_size: 10`), &cfg))
+	require.Equal(t, model.ArchiveAlways, cfg.Default)
+	require.Equal(t, 10, cfg.MaxPageSize)
+
+	cfg = Config{}
+	require.Nil(t, yaml.Unmarshal([]byte(`default: roster`), &cfg))
+	require.Equal(t, model.ArchiveRoster, cfg.Default)
+	require.Equal(t, defaultMaxPageSize, cfg.MaxPageSize)
+}
+
+func TestXEP0313_Matching(t *testing.T) {
+	r, _, shutdown := setupTest("jackal.im")
+	defer shutdown()
+
+	j, _ := jid.New("ortuman", "jackal.im", "balcony", true)
+
+	x := New(&Config{Default: model.ArchiveAlways, MaxPageSize: 50}, nil, r)
+	defer x.Shutdown()
+
+	iq := xmpp.NewIQType(uuid.New(), xmpp.GetType)
+	iq.SetFromJID(j)
+	iq.SetToJID(j.ToBareJID())
+	require.False(t, x.MatchesIQ(iq))
+
+	iq.AppendElement(xmpp.NewElementNamespace("query", mamNamespace))
+	require.True(t, x.MatchesIQ(iq))
+
+	iq.ClearElements()
+	iq.AppendElement(xmpp.NewElementNamespace("prefs", mamNamespace))
+	require.True(t, x.MatchesIQ(iq))
+}
+
+func TestXEP0313_Forbidden(t *testing.T) {
+	r, _, shutdown := setupTest("jackal.im")
+	defer shutdown()
+
+	j1, _ := jid.New("ortuman", "jackal.im", "balcony", true)
+	j2, _ := jid.New("romeo", "jackal.im", "balcony", true)
+
+	stm := stream.NewMockC2S(uuid.New(), j1)
+	r.Bind(stm)
+
+	x := New(&Config{Default: model.ArchiveAlways, MaxPageSize: 50}, nil, r)
+	defer x.Shutdown()
+
+	iq := xmpp.NewIQType(uuid.New(), xmpp.SetType)
+	iq.SetFromJID(j1)
+	iq.SetToJID(j2.ToBareJID())
+	iq.AppendElement(xmpp.NewElementNamespace("query", mamNamespace))
+
+	x.ProcessIQ(iq)
+	elem := stm.ReceiveElement()
+	require.Equal(t, xmpp.ErrForbidden.Error(), elem.Error().Elements().All()[0].Name())
+}
+
+func TestXEP0313_ArchiveMessage(t *testing.T) {
+	r, s, shutdown := setupTest("jackal.im")
+	defer shutdown()
+
+	j1, _ := jid.New("ortuman", "jackal.im", "balcony", true)
+	j2, _ := jid.New("romeo", "jackal.im", "garden", true)
+	j3, _ := jid.New("juliet", "example.org", "garden", true)
+
+	x := New(&Config{Default: model.ArchiveAlways, MaxPageSize: 50}, nil, r)
+	defer x.Shutdown()
+
+	x.ArchiveMessage(tUtilMessage(j1, j2, "Hi!"))
+	x.ArchiveMessage(tUtilMessage(j3, j1, "Hello!"))
+
+	// messages without body must not be archived
+	msg := xmpp.NewMessageType(uuid.New(), xmpp.ChatType)
+	msg.SetFromJID(j1)
+	msg.SetToJID(j2)
+	x.ArchiveMessage(msg)
+
+	// honor no-store hint
+	msg = tUtilMessage(j1, j2, "Secret")
+	msg.AppendElement(xmpp.NewElementNamespace("no-store", hintsNamespace))
+	x.ArchiveMessage(msg)
+
+	// wait until archived
+	_ = x.Shutdown()
+
+	cnt, _ := s.CountArchiveMessages("ortuman", &model.ArchiveFilter{})
+	require.Equal(t, 2, cnt)
+	cnt, _ = s.CountArchiveMessages("ortuman", &model.ArchiveFilter{With: "juliet@example.org"})
+	require.Equal(t, 1, cnt)
+	cnt, _ = s.CountArchiveMessages("romeo", &model.ArchiveFilter{})
+	require.Equal(t, 1, cnt)
+
+	// never archive conversations with romeo
+	_ = s.InsertOrUpdateArchivePrefs(&model.ArchivePrefs{
+		Username: "ortuman",
+		Default:  model.ArchiveAlways,
+		Never:    []string{"romeo@jackal.im"},
+	})
+	x = New(&Config{Default: model.ArchiveAlways, MaxPageSize: 50}, nil, r)
+	x.ArchiveMessage(tUtilMessage(j1, j2, "Hi again!"))
+	_ = x.Shutdown()
+
+	cnt, _ = s.CountArchiveMessages("ortuman", &model.ArchiveFilter{})
+	require.Equal(t, 2, cnt)
+	cnt, _ = s.CountArchiveMessages("romeo", &model.ArchiveFilter{})
+	require.Equal(t, 2, cnt)
+}
+
+func TestXEP0313_QueryArchive(t *testing.T) {
+	r, _, shutdown := setupTest("jackal.im")
+	defer shutdown()
+
+	j1, _ := jid.New("ortuman", "jackal.im", "balcony", true)
+	j2, _ := jid.New("romeo", "jackal.im", "garden", true)
+
+	stm := stream.NewMockC2S(uuid.New(), j1)
+	r.Bind(stm)
+
+	x := New(&Config{Default: model.ArchiveAlways, MaxPageSize: 50}, nil, r)
+	defer x.Shutdown()
+
+	for i := 0; i < 5; i++ {
+		x.ArchiveMessage(tUtilMessage(j2, j1, "message "+strconv.Itoa(i)))
+	}
+
+	// request query form
+	iq := xmpp.NewIQType(uuid.New(), xmpp.GetType)
+	iq.SetFromJID(j1)
+	iq.SetToJID(j1.ToBareJID())
+	iq.AppendElement(xmpp.NewElementNamespace("query", mamNamespace))
+
+	x.ProcessIQ(iq)
+	elem := stm.ReceiveElement()
+	require.Equal(t, xmpp.ResultType, elem.Type())
+	q := elem.Elements().ChildNamespace("query", mamNamespace)
+	require.NotNil(t, q)
+	require.NotNil(t, q.Elements().ChildNamespace("x", formNamespace))
+
+	// fetch first page
+	iq = tUtilQueryIQ(j1, "q1", `<max>2</max>`)
+	x.ProcessIQ(iq)
+
+	var ids []string
+	for i := 0; i < 2; i++ {
+		elem = stm.ReceiveElement()
+		require.Equal(t, "message", elem.Name())
+		res := elem.Elements().ChildNamespace("result", mamNamespace)
+		require.NotNil(t, res)
+		require.Equal(t, "q1", res.Attributes().Get("queryid"))
+
+		fwd := res.Elements().ChildNamespace("forwarded", forwardNamespace)
+		require.NotNil(t, fwd)
+		require.NotNil(t, fwd.Elements().ChildNamespace("delay", delayNamespace))
+		orig := fwd.Elements().Child("message")
+		require.NotNil(t, orig)
+		require.Equal(t, "message "+strconv.Itoa(i), orig.Elements().Child("body").Text())
+
+		ids = append(ids, res.Attributes().Get("id"))
+	}
+	elem = stm.ReceiveElement()
+	require.Equal(t, xmpp.ResultType, elem.Type())
+	fin := elem.Elements().ChildNamespace("fin", mamNamespace)
+	require.NotNil(t, fin)
+	require.Equal(t, "", fin.Attributes().Get("complete"))
+	set := fin.Elements().ChildNamespace("set", rsmNamespace)
+	require.Equal(t, ids[0], set.Elements().Child("first").Text())
+	require.Equal(t, ids[1], set.Elements().Child("last").Text())
+	require.Equal(t, "5", set.Elements().Child("count").Text())
+
+	// fetch remaining messages
+	iq = tUtilQueryIQ(j1, "q2", `<max>10</max><after>`+ids[1]+`</after>`)
+	x.ProcessIQ(iq)
+	for i := 0; i < 3; i++ {
+		elem = stm.ReceiveElement()
+		require.Equal(t, "message", elem.Name())
+	}
+	elem = stm.ReceiveElement()
+	fin = elem.Elements().ChildNamespace("fin", mamNamespace)
+	require.Equal(t, "true", fin.Attributes().Get("complete"))
+
+	// fetch last page
+	iq = tUtilQueryIQ(j1, "q3", `<max>1</max><before/>`)
+	x.ProcessIQ(iq)
+	elem = stm.ReceiveElement()
+	res := elem.Elements().ChildNamespace("result", mamNamespace)
+	orig := res.Elements().ChildNamespace("forwarded", forwardNamespace).Elements().Child("message")
+	require.Equal(t, "message 4", orig.Elements().Child("body").Text())
+	elem = stm.ReceiveElement()
+	fin = elem.Elements().ChildNamespace("fin", mamNamespace)
+	require.Equal(t, "", fin.Attributes().Get("complete"))
+
+	// invalid rsm set
+	iq = tUtilQueryIQ(j1, "q4", `<max>foo</max>`)
+	x.ProcessIQ(iq)
+	elem = stm.ReceiveElement()
+	require.Equal(t, xmpp.ErrBadRequest.Error(), elem.Error().Elements().All()[0].Name())
+}
+
+func TestXEP0313_Prefs(t *testing.T) {
+	r, s, shutdown := setupTest("jackal.im")
+	defer shutdown()
+
+	j, _ := jid.New("ortuman", "jackal.im", "balcony", true)
+
+	stm := stream.NewMockC2S(uuid.New(), j)
+	r.Bind(stm)
+
+	x := New(&Config{Default: model.ArchiveRoster, MaxPageSize: 50}, nil, r)
+	defer x.Shutdown()
+
+	// default preferences
+	iq := xmpp.NewIQType(uuid.New(), xmpp.GetType)
+	iq.SetFromJID(j)
+	iq.SetToJID(j.ToBareJID())
+	iq.AppendElement(xmpp.NewElementNamespace("prefs", mamNamespace))
+
+	x.ProcessIQ(iq)
+	elem := stm.ReceiveElement()
+	require.Equal(t, xmpp.ResultType, elem.Type())
+	prefs := elem.Elements().ChildNamespace("prefs", mamNamespace)
+	require.Equal(t, model.ArchiveRoster, prefs.Attributes().Get("default"))
+
+	// update preferences
+	prefsElem := xmpp.NewElementNamespace("prefs", mamNamespace)
+	prefsElem.SetAttribute("default", model.ArchiveNever)
+	always := xmpp.NewElementName("always")
+	jElem := xmpp.NewElementName("jid")
+	jElem.SetText("romeo@jackal.im/garden")
+	always.AppendElement(jElem)
+	prefsElem.AppendElement(always)
+
+	iq = xmpp.NewIQType(uuid.New(), xmpp.SetType)
+	iq.SetFromJID(j)
+	iq.SetToJID(j.ToBareJID())
+	iq.AppendElement(prefsElem)
+
+	x.ProcessIQ(iq)
+	elem = stm.ReceiveElement()
+	require.Equal(t, xmpp.ResultType, elem.Type())
+
+	p, err := s.FetchArchivePrefs("ortuman")
+	require.Nil(t, err)
+	require.NotNil(t, p)
+	require.Equal(t, model.ArchiveNever, p.Default)
+	require.Equal(t, []string{"romeo@jackal.im"}, p.Always)
+
+	// invalid default mode
+	prefsElem.SetAttribute("default", "sometimes")
+	x.ProcessIQ(iq)
+	elem = stm.ReceiveElement()
+	require.Equal(t, xmpp.ErrBadRequest.Error(), elem.Error().Elements().All()[0].Name())
+
+	// storage error
+	prefsElem.SetAttribute("default", model.ArchiveAlways)
+	s.EnableMockedError()
+	x.ProcessIQ(iq)
+	elem = stm.ReceiveElement()
+	require.Equal(t, xmpp.ErrInternalServerError.Error(), elem.Error().Elements().All()[0].Name())
+	s.DisableMockedError()
+}
+
+func tUtilMessage(from, to *jid.JID, text string) *xmpp.Message {
+	msg := xmpp.NewMessageType(uuid.New(), xmpp.ChatType)
+	msg.SetFromJID(from)
+	msg.SetToJID(to)
+	body := xmpp.NewElementName("body")
+	body.SetText(text)
+	msg.AppendElement(body)
+	return msg
+}
+
+func tUtilQueryIQ(j *jid.JID, queryID string, rsm string) *xmpp.IQ {
+	iq := xmpp.NewIQType(uuid.New(), xmpp.SetType)
+	iq.SetFromJID(j)
+	iq.SetToJID(j.ToBareJID())
+
+	q := xmpp.NewElementNamespace("query", mamNamespace)
+	q.SetAttribute("queryid", queryID)
+
+	parser := xmpp.NewParser(strings.NewReader(`<set xmlns="`+rsmNamespace+`">`+rsm+`</set>`), xmpp.DefaultMode, 0)
+	set, _ := parser.ParseElement()
+	q.AppendElement(set)
+	iq.AppendElement(q)
+	return iq
+}
+
+func setupTest(domain string) (*router.Router, *memstorage.Storage, func()) {
+	r, _ := router.New(&router.Config{
+		Hosts: []router.HostConfig{{Name: domain, Certificate: tls.Certificate{}}},
+	})
+	s := memstorage.New()
+	storage.Set(s)
+	return r, s, func() {
+		storage.Unset()
+	}
+}
@@ -0,0 +1,86 @@
+/*
+ * Copyright (c) 2018 Miguel Ángel Ortuño.
+ * See the LICENSE file for more information.
+ */
+
+package router
+
+import (
+	"github.com/ortuman/jackal/stream"
+	"github.com/ortuman/jackal/xmpp"
+)
+
+const (
+	carbonsNamespace = "urn:xmpp:carbons:2"
+	forwardNamespace = "urn:xmpp:forward:0"
+	hintsNamespace   = "urn:xmpp:hints"
+)
+
+// CarbonsEnabledCtxKey represents the stream context key used to flag
+// carbon-enabled resources.
+// (https://xmpp.org/extensions/xep-0280.html)
+const CarbonsEnabledCtxKey = "carbons:enabled"
+
+// sendReceivedCarbons forwards a copy of an incoming message to every other
+// carbon-enabled resource of the recipient.
+func (r *Router) sendReceivedCarbons(msg *xmpp.Message, recipients []stream.C2S, deliveredTo stream.C2S) {
+	if !isCarbonsEligible(msg) {
+		return
+	}
+	for _, stm := range recipients {
+		if stm == deliveredTo || !stm.GetBool(CarbonsEnabledCtxKey) {
+			continue
+		}
+		stm.SendElement(carbonCopy(msg, "received", stm))
+	}
+}
+
+// SendSentCarbons forwards a copy of a message sent by a local client to every other
+// carbon-enabled resource of the sender.
+func (r *Router) SendSentCarbons(msg *xmpp.Message) {
+	fromJID := msg.FromJID()
+	if fromJID == nil || !fromJID.IsFullWithUser() || !r.IsLocalHost(fromJID.Domain()) || !isCarbonsEligible(msg) {
+		return
+	}
+	toJID := msg.ToJID()
+	for _, stm := range r.UserStreams(fromJID.Node()) {
+		res := stm.Resource()
+		if res == fromJID.Resource() || !stm.GetBool(CarbonsEnabledCtxKey) {
+			continue
+		}
+		if toJID.Node() == fromJID.Node() && toJID.Domain() == fromJID.Domain() && toJID.Resource() == res {
+			continue // already addressed to this resource
+		}
+		stm.SendElement(carbonCopy(msg, "sent", stm))
+	}
+}
+
+func isCarbonsEligible(msg *xmpp.Message) bool {
+	if !msg.IsChat() && !(msg.IsNormal() && msg.IsMessageWithBody()) {
+		return false
+	}
+	e := msg.Elements()
+	if e.ChildNamespace("private", carbonsNamespace) != nil || e.ChildNamespace("no-copy", hintsNamespace) != nil {
+		return false
+	}
+	// avoid forwarding carbon copies
+	return e.ChildNamespace("received", carbonsNamespace) == nil && e.ChildNamespace("sent", carbonsNamespace) == nil
+}
+
+func carbonCopy(msg *xmpp.Message, name string, to stream.C2S) *xmpp.Message {
+	forwarded := xmpp.NewElementNamespace("forwarded", forwardNamespace)
+	forwarded.AppendElement(msg)
+	carbon := xmpp.NewElementNamespace(name, carbonsNamespace)
+	carbon.AppendElement(forwarded)
+
+	fromJID := to.JID().ToBareJID()
+	toJID := to.JID()
+
+	e := xmpp.NewElementName("message")
+	if tp := msg.Type(); len(tp) > 0 {
+		e.SetType(tp)
+	}
+	e.AppendElement(carbon)
+	cp, _ := xmpp.NewMessageFromElement(e, fromJID, toJID)
+	return cp
+}
@@ -0,0 +1,253 @@
+/*
+ * Copyright (c) 2018 Miguel Ángel Ortuño.
+ * See the LICENSE file for more information.
+ */
+
+package router
+
+import (
+	"testing"
+	"time"
+
+	"github.com/ortuman/jackal/cluster"
+	"github.com/ortuman/jackal/model"
+	"github.com/ortuman/jackal/storage"
+	"github.com/ortuman/jackal/stream"
+	"github.com/ortuman/jackal/xmpp"
+	"github.com/ortuman/jackal/xmpp/jid"
+	"github.com/pborman/uuid"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRouter_ReceivedCarbons(t *testing.T) {
+	r, _, shutdown := setupTest()
+	defer shutdown()
+
+	_ = storage.InsertOrUpdateUser(&model.User{Username: "ortuman", Password: "plain"})
+
+	j1, _ := jid.NewWithString("ortuman@jackal.im/balcony", false)
+	j2, _ := jid.NewWithString("ortuman@jackal.im/garden", false)
+	j3, _ := jid.NewWithString("ortuman@jackal.im/yard", false)
+	j4, _ := jid.NewWithString("hamlet@jackal.im/balcony", false)
+	stm1 := stream.NewMockC2S(uuid.New(), j1)
+	stm2 := stream.NewMockC2S(uuid.New(), j2)
+	stm3 := stream.NewMockC2S(uuid.New(), j3)
+	stm1.SetBool(CarbonsEnabledCtxKey, true)
+	stm2.SetBool(CarbonsEnabledCtxKey, true)
+
+	r.Bind(stm1)
+	r.Bind(stm2)
+	r.Bind(stm3)
+
+	msgID := uuid.New()
+	msg := xmpp.NewMessageType(msgID, xmpp.ChatType)
+	msg.SetFromJID(j4)
+	msg.SetToJID(j1)
+	msg.AppendElement(xmpp.NewElementName("body"))
+	require.Nil(t, r.Route(msg))
+
+	elem := stm1.ReceiveElement()
+	require.Equal(t, msgID, elem.ID())
+
+	elem = stm2.ReceiveElement()
+	require.Equal(t, "ortuman@jackal.im", elem.From())
+	require.Equal(t, j2.String(), elem.To())
+	received := elem.Elements().ChildNamespace("received", carbonsNamespace)
+	require.NotNil(t, received)
+	forwarded := received.Elements().ChildNamespace("forwarded", forwardNamespace)
+	require.NotNil(t, forwarded)
+	require.Equal(t, msgID, forwarded.Elements().Child("message").ID())
+
+	// private messages
+	msg2 := xmpp.NewMessageType(uuid.New(), xmpp.ChatType)
+	msg2.SetFromJID(j4)
+	msg2.SetToJID(j1)
+	msg2.AppendElement(xmpp.NewElementNamespace("private", carbonsNamespace))
+	require.Nil(t, r.Route(msg2))
+	_ = stm1.ReceiveElement()
+
+	msg3 := xmpp.NewMessageType(uuid.New(), xmpp.ChatType)
+	msg3.SetFromJID(j4)
+	msg3.SetToJID(j2)
+	require.Nil(t, r.Route(msg3))
+
+	elem = stm2.ReceiveElement()
+	require.Equal(t, msg3.ID(), elem.ID()) // no carbon copy received
+
+	// non eligible messages
+	msg4 := xmpp.NewMessageType(uuid.New(), xmpp.HeadlineType)
+	msg4.SetFromJID(j4)
+	msg4.SetToJID(j1)
+	require.False(t, isCarbonsEligible(msg4))
+
+	msg5 := xmpp.NewMessageType(uuid.New(), xmpp.ChatType)
+	msg5.SetFromJID(j4)
+	msg5.SetToJID(j1)
+	msg5.AppendElement(xmpp.NewElementNamespace("no-copy", hintsNamespace))
+	require.False(t, isCarbonsEligible(msg5))
+}
+
+func TestRouter_SentCarbons(t *testing.T) {
+	r, _, shutdown := setupTest()
+	defer shutdown()
+
+	_ = storage.InsertOrUpdateUser(&model.User{Username: "ortuman", Password: "plain"})
+	_ = storage.InsertOrUpdateUser(&model.User{Username: "hamlet", Password: "plain"})
+
+	j1, _ := jid.NewWithString("ortuman@jackal.im/balcony", false)
+	j2, _ := jid.NewWithString("ortuman@jackal.im/garden", false)
+	j3, _ := jid.NewWithString("hamlet@jackal.im/balcony", false)
+	stm1 := stream.NewMockC2S(uuid.New(), j1)
+	stm2 := stream.NewMockC2S(uuid.New(), j2)
+	stm3 := stream.NewMockC2S(uuid.New(), j3)
+	stm1.SetBool(CarbonsEnabledCtxKey, true)
+	stm2.SetBool(CarbonsEnabledCtxKey, true)
+
+	r.Bind(stm1)
+	r.Bind(stm2)
+	r.Bind(stm3)
+
+	msgID := uuid.New()
+	msg := xmpp.NewMessageType(msgID, xmpp.ChatType)
+	msg.SetFromJID(j1)
+	msg.SetToJID(j3.ToBareJID())
+	msg.AppendElement(xmpp.NewElementName("body"))
+	require.Nil(t, r.Route(msg))
+
+	elem := stm3.ReceiveElement()
+	require.Equal(t, msgID, elem.ID())
+
+	r.SendSentCarbons(msg)
+	elem = stm2.ReceiveElement()
+	require.Equal(t, "ortuman@jackal.im", elem.From())
+	sent := elem.Elements().ChildNamespace("sent", carbonsNamespace)
+	require.NotNil(t, sent)
+	forwarded := sent.Elements().ChildNamespace("forwarded", forwardNamespace)
+	require.NotNil(t, forwarded)
+	require.Equal(t, msgID, forwarded.Elements().Child("message").ID())
+
+	// disabled carbons
+	stm2.SetBool(CarbonsEnabledCtxKey, false)
+
+	msg2 := xmpp.NewMessageType(uuid.New(), xmpp.ChatType)
+	msg2.SetFromJID(j1)
+	msg2.SetToJID(j3)
+	require.Nil(t, r.Route(msg2))
+	r.SendSentCarbons(msg2)
+	_ = stm3.ReceiveElement()
+
+	msg3 := xmpp.NewMessageType(uuid.New(), xmpp.ChatType)
+	msg3.SetFromJID(j3)
+	msg3.SetToJID(j2)
+	require.Nil(t, r.Route(msg3))
+
+	elem = stm2.ReceiveElement()
+	require.Equal(t, msg3.ID(), elem.ID()) // no carbon copy received
+}
+
+func TestRouter_ClusterCarbons(t *testing.T) {
+	r, _, shutdown := setupTest()
+	defer shutdown()
+
+	_ = storage.InsertOrUpdateUser(&model.User{Username: "ortuman", Password: "plain"})
+
+	var del fakeClusterDelegate
+	r.SetCluster(&del)
+
+	j1, _ := jid.NewWithString("ortuman@jackal.im/balcony", false)
+	j2, _ := jid.NewWithString("ortuman@jackal.im/garden", false)
+	j3, _ := jid.NewWithString("hamlet@jackal.im/balcony", false)
+	stm1 := stream.NewMockC2S(uuid.New(), j1)
+	stm1.SetBool(CarbonsEnabledCtxKey, true)
+	r.Bind(stm1)
+
+	// cluster stream carbons state
+	r.handleNotifyMessage(&cluster.Message{
+		Type: cluster.MsgBind,
+		Node: "node2",
+		Payloads: []cluster.MessagePayload{{
+			JID:     j2,
+			Stanza:  xmpp.NewPresence(j2, j2, xmpp.AvailableType),
+			Context: map[string]interface{}{},
+		}},
+	})
+	r.handleNotifyMessage(&cluster.Message{
+		Type: cluster.MsgUpdateContext,
+		Node: "node2",
+		Payloads: []cluster.MessagePayload{{
+			JID:     j2,
+			Context: map[string]interface{}{CarbonsEnabledCtxKey: true},
+		}},
+	})
+	r.mu.RLock()
+	stm2 := r.clusterStreams["node2"][j2.String()]
+	require.NotNil(t, stm2)
+	require.True(t, stm2.GetBool(CarbonsEnabledCtxKey))
+	r.mu.RUnlock()
+
+	r.handleNotifyMessage(&cluster.Message{
+		Type: cluster.MsgUnbind,
+		Node: "node2",
+		Payloads: []cluster.MessagePayload{{
+			JID: j2,
+		}},
+	})
+
+	// cluster routed stanzas are delivered straight to the recipient stream
+	stm3 := stream.NewMockC2S(uuid.New(), j3)
+	stm3.SetBool(CarbonsEnabledCtxKey, true)
+	r.Bind(stm3)
+
+	j4, _ := jid.NewWithString("hamlet@jackal.im/garden", false)
+	msg := xmpp.NewMessageType(uuid.New(), xmpp.ChatType)
+	msg.SetFromJID(j4)
+	msg.SetToJID(j1.ToBareJID())
+	r.handleNotifyMessage(&cluster.Message{
+		Type: cluster.MsgRouteStanza,
+		Node: "node2",
+		Payloads: []cluster.MessagePayload{{
+			JID:    j1,
+			Stanza: msg,
+		}},
+	})
+	elem := stm1.ReceiveElement()
+	require.Equal(t, msg.ID(), elem.ID())
+
+	msg2 := xmpp.NewMessageType(uuid.New(), xmpp.ChatType)
+	msg2.SetFromJID(j1)
+	msg2.SetToJID(j3)
+	require.Nil(t, r.Route(msg2))
+
+	elem = stm3.ReceiveElement()
+	require.Equal(t, msg2.ID(), elem.ID()) // no sent carbon copy received
+
+	// routing a cluster message to a local user with no bound streams
+	// must not take router lock twice while a writer is waiting
+	_ = storage.InsertOrUpdateUser(&model.User{Username: "romeo", Password: "plain"})
+	j5, _ := jid.NewWithString("romeo@jackal.im", false)
+	msg3 := xmpp.NewMessageType(uuid.New(), xmpp.ChatType)
+	msg3.SetFromJID(j1)
+	msg3.SetToJID(j5)
+
+	doneCh := make(chan struct{})
+	go func() {
+		for i := 0; i < 100; i++ {
+			r.handleNotifyMessage(&cluster.Message{
+				Type:     cluster.MsgRouteStanza,
+				Node:     "node2",
+				Payloads: []cluster.MessagePayload{{JID: j5, Stanza: msg3}},
+			})
+		}
+		close(doneCh)
+	}()
+	j6, _ := jid.NewWithString("juliet@jackal.im/garden", false)
+	for i := 0; i < 100; i++ {
+		r.Bind(stream.NewMockC2S(uuid.New(), j6))
+		r.Unbind(j6)
+	}
+	select {
+	case <-doneCh:
+	case <-time.After(time.Second * 5):
+		require.Fail(t, "router deadlock")
+	}
+}
@@ -28,3 +28,21 @@ var (
 	// couldn't establish a connection to the remote server.
 	ErrFailedRemoteConnect = errors.New("router: failed remote connection")
 )
+
+// errorLabel returns the metrics label associated to a routing error.
+func errorLabel(err error) string {
+	switch err {
+	case ErrNotExistingAccount:
+		return "not_existing_account"
+	case ErrResourceNotFound:
+		return "resource_not_found"
+	case ErrNotAuthenticated:
+		return "not_authenticated"
+	case ErrBlockedJID:
+		return "blocked_jid"
+	case ErrFailedRemoteConnect:
+		return "failed_remote_connect"
+	default:
+		return "internal"
+	}
+}
@@ -11,7 +11,9 @@ import (
 	"sync"
 
 	"github.com/ortuman/jackal/cluster"
+	streamerror "github.com/ortuman/jackal/errors"
 	"github.com/ortuman/jackal/log"
+	"github.com/ortuman/jackal/metrics"
 	"github.com/ortuman/jackal/storage"
 	"github.com/ortuman/jackal/stream"
 	"github.com/ortuman/jackal/util"
@@ -30,6 +32,13 @@ type OutS2SProvider interface {
 	GetOut(localDomain, remoteDomain string) (stream.S2SOut, error)
 }
 
+// ComponentRouter delivers stanzas addressed to a server component.
+type ComponentRouter interface {
+	// RouteToComponent delivers a stanza to the component associated to its destination domain.
+	// A false value is returned in case no component serves that domain.
+	RouteToComponent(stanza xmpp.Stanza) bool
+}
+
 // Cluster represents the generic cluster interface used by router type.
 type Cluster interface {
 	// LocalNode returns local node name.
@@ -46,6 +55,7 @@ type Cluster interface {
 type Router struct {
 	mu             sync.RWMutex
 	outS2SProvider OutS2SProvider
+	compRouter     ComponentRouter
 	hosts          map[string]tls.Certificate
 	streams        map[string][]stream.C2S
 	cluster        Cluster
@@ -109,6 +119,18 @@ func (r *Router) Certificates() []tls.Certificate {
 	return certs
 }
 
+// GetCertificate returns the certificate associated to the server name
+// indicated (SNI) by a TLS client hello.
+// A nil certificate is returned if server name doesn't match any configured domain.
+func (r *Router) GetCertificate(hello *tls.ClientHelloInfo) (*tls.Certificate, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	if cer, ok := r.hosts[hello.ServerName]; ok {
+		return &cer, nil
+	}
+	return nil, nil
+}
+
 // SetOutS2SProvider sets the s2s out provider to be used when routing stanzas remotely.
 func (r *Router) SetOutS2SProvider(provider OutS2SProvider) {
 	r.mu.Lock()
@@ -116,6 +138,13 @@ func (r *Router) SetOutS2SProvider(provider OutS2SProvider) {
 	r.outS2SProvider = provider
 }
 
+// SetComponentRouter sets the component router to be used when routing stanzas to component domains.
+func (r *Router) SetComponentRouter(compRouter ComponentRouter) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.compRouter = compRouter
+}
+
 // SetCluster sets router cluster interface.
 func (r *Router) SetCluster(cluster Cluster) {
 	r.mu.Lock()
@@ -147,6 +176,7 @@ func (r *Router) Bind(stm stream.C2S) {
 
 	r.bind(stm)
 	r.localStreams[stm.JID().String()] = stm
+	metrics.BoundResources.Set(float64(len(r.localStreams)))
 
 	log.Infof("bound c2s stream... (%s/%s)", stm.Username(), stm.Resource())
 
@@ -179,6 +209,7 @@ func (r *Router) Unbind(stmJID *jid.JID) {
 		return
 	}
 	delete(r.localStreams, stmJID.String())
+	metrics.BoundResources.Set(float64(len(r.localStreams)))
 
 	log.Infof("unbound c2s stream... (%s/%s)", stmJID.Node(), stmJID.Resource())
 
@@ -227,12 +258,20 @@ func (r *Router) IsBlockedJID(jid *jid.JID, username string) bool {
 }
 
 // ReloadBlockList reloads in memory block list for a given user and starts applying it for future stanza routing.
-func (r *Router) ReloadBlockList(username string) {
-	r.blockListsMu.Lock()
-	defer r.blockListsMu.Unlock()
+func (r *Router) ReloadBlockList(userJID *jid.JID) {
+	r.reloadBlockList(userJID.Node())
 
-	delete(r.blockLists, username)
-	log.Infof("block list reloaded... (username: %s)", username)
+	// broadcast cluster 'reload block list' message
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	if r.cluster == nil {
+		return
+	}
+	r.cluster.BroadcastMessage(&cluster.Message{
+		Type:     cluster.MsgReloadBlockList,
+		Node:     r.cluster.LocalNode(),
+		Payloads: []cluster.MessagePayload{{JID: userJID.ToBareJID()}},
+	})
 }
 
 // Route routes a stanza applying server rules for handling XML stanzas.
@@ -258,6 +297,14 @@ func (r *Router) jidMatchesBlockedJID(j, blockedJID *jid.JID) bool {
 	return j.Matches(blockedJID, jid.MatchesDomain)
 }
 
+func (r *Router) reloadBlockList(username string) {
+	r.blockListsMu.Lock()
+	defer r.blockListsMu.Unlock()
+
+	delete(r.blockLists, username)
+	log.Infof("block list reloaded... (username: %s)", username)
+}
+
 func (r *Router) getBlockList(username string) []*jid.JID {
 	r.blockListsMu.RLock()
 	bl := r.blockLists[username]
@@ -316,6 +363,15 @@ func (r *Router) unbind(jid *jid.JID) bool {
 }
 
 func (r *Router) route(element xmpp.Stanza, ignoreBlocking bool) error {
+	err := r.routeStanza(element, ignoreBlocking)
+	metrics.RoutedStanzas.WithLabelValues(element.Name()).Inc()
+	if err != nil {
+		metrics.RouteErrors.WithLabelValues(errorLabel(err)).Inc()
+	}
+	return err
+}
+
+func (r *Router) routeStanza(element xmpp.Stanza, ignoreBlocking bool) error {
 	toJID := element.ToJID()
 	if !ignoreBlocking && !toJID.IsServer() {
 		if r.IsBlockedJID(element.FromJID(), toJID.Node()) {
@@ -323,6 +379,9 @@ func (r *Router) route(element xmpp.Stanza, ignoreBlocking bool) error {
 		}
 	}
 	if !r.IsLocalHost(toJID.Domain()) {
+		if r.routeToComponent(element) {
+			return nil
+		}
 		return r.remoteRoute(element)
 	}
 	recipients := r.streams[toJID.Node()]
@@ -340,12 +399,15 @@ func (r *Router) route(element xmpp.Stanza, ignoreBlocking bool) error {
 		for _, stm := range recipients {
 			if stm.Resource() == toJID.Resource() {
 				stm.SendElement(element)
+				if msg, ok := element.(*xmpp.Message); ok {
+					r.sendReceivedCarbons(msg, recipients, stm)
+				}
 				return nil
 			}
 		}
 		return ErrResourceNotFound
 	}
-	switch element.(type) {
+	switch msg := element.(type) {
 	case *xmpp.Message:
 		// send to highest priority stream
 		stm := recipients[0]
@@ -361,6 +423,7 @@ func (r *Router) route(element xmpp.Stanza, ignoreBlocking bool) error {
 			}
 		}
 		stm.SendElement(element)
+		r.sendReceivedCarbons(msg, recipients, stm)
 
 	default:
 		// broadcast toJID all streams
@@ -371,6 +434,13 @@ func (r *Router) route(element xmpp.Stanza, ignoreBlocking bool) error {
 	return nil
 }
 
+func (r *Router) routeToComponent(elem xmpp.Stanza) bool {
+	r.mu.RLock()
+	compRouter := r.compRouter
+	r.mu.RUnlock()
+	return compRouter != nil && compRouter.RouteToComponent(elem)
+}
+
 func (r *Router) remoteRoute(elem xmpp.Stanza) error {
 	if r.outS2SProvider == nil {
 		return ErrFailedRemoteConnect
@@ -399,6 +469,12 @@ func (r *Router) handleNotifyMessage(msg *cluster.Message) {
 		r.processUpdateContext(msg)
 	case cluster.MsgRouteStanza:
 		r.processRouteStanzaMessage(msg)
+	case cluster.MsgDisconnect:
+		r.processDisconnectMessage(msg)
+	case cluster.MsgReloadBlockList:
+		r.processReloadBlockListMessage(msg)
+	case cluster.MsgSetContext:
+		r.processSetContextMessage(msg)
 	}
 }
 
@@ -542,17 +618,93 @@ func (r *Router) processUpdatePresenceMessage(msg *cluster.Message) {
 
 func (r *Router) processRouteStanzaMessage(msg *cluster.Message) {
 	r.mu.RLock()
-	defer r.mu.RUnlock()
 	if r.cluster == nil {
+		r.mu.RUnlock()
 		return
 	}
 	j := msg.Payloads[0].JID
 	stanza := msg.Payloads[0].Stanza
 
 	log.Debugf("routing cluster stanza: %s\n%v", j.String(), stanza)
+
+	// deliver straight to local stream whenever it's the stanza recipient
+	if stm := r.localStreams[j.String()]; stm != nil && stanza.ToJID().Matches(j, jid.MatchesBare) {
+		r.mu.RUnlock()
+		stm.SendElement(stanza)
+		return
+	}
+	r.mu.RUnlock()
+
+	// route may take router lock, so it must not be held at this point
 	_ = r.route(stanza, false)
 }
 
+func (r *Router) processDisconnectMessage(msg *cluster.Message) {
+	if len(msg.Payloads) == 0 {
+		return
+	}
+	r.mu.RLock()
+	if r.cluster == nil {
+		r.mu.RUnlock()
+		return
+	}
+	j := msg.Payloads[0].JID
+	stm := r.localStreams[j.String()]
+	r.mu.RUnlock()
+
+	if stm == nil {
+		return
+	}
+	log.Debugf("disconnecting c2s stream by cluster request: %s (node: %s)", j.String(), msg.Node)
+
+	// stream disconnection unbinds it, so router lock must not be held at this point
+	var err error
+	if reason, _ := msg.Payloads[0].Context[cluster.DisconnectReasonContextKey].(string); len(reason) > 0 {
+		err = streamerror.ErrorWithReason(reason)
+	}
+	stm.Disconnect(err)
+}
+
+func (r *Router) processSetContextMessage(msg *cluster.Message) {
+	if len(msg.Payloads) == 0 {
+		return
+	}
+	r.mu.RLock()
+	if r.cluster == nil {
+		r.mu.RUnlock()
+		return
+	}
+	j := msg.Payloads[0].JID
+	stm := r.localStreams[j.String()]
+	r.mu.RUnlock()
+
+	if stm == nil {
+		return
+	}
+	log.Debugf("setting c2s stream context by cluster request: %s (node: %s)", j.String(), msg.Node)
+
+	// context updates are broadcasted, so router lock must not be held at this point
+	for k, v := range msg.Payloads[0].Context {
+		switch v := v.(type) {
+		case string:
+			stm.SetString(k, v)
+		case int:
+			stm.SetInt(k, v)
+		case float64:
+			stm.SetFloat(k, v)
+		case bool:
+			stm.SetBool(k, v)
+		}
+	}
+}
+
+func (r *Router) processReloadBlockListMessage(msg *cluster.Message) {
+	username := msg.Payloads[0].JID.Node()
+
+	log.Debugf("reloading block list by cluster request: %s (node: %s)", username, msg.Node)
+	r.reloadBlockList(username)
+}
+
 func (r *Router) registerClusterC2S(stm *cluster.C2S, node string) {
 	if streams := r.clusterStreams[node]; streams != nil {
 		streams[stm.JID().String()] = stm
@@ -13,6 +13,7 @@ import (
 	"time"
 
 	"github.com/ortuman/jackal/cluster"
+	streamerror "github.com/ortuman/jackal/errors"
 	"github.com/ortuman/jackal/model"
 	"github.com/ortuman/jackal/storage"
 	"github.com/ortuman/jackal/storage/memstorage"
@@ -21,6 +22,7 @@ import (
 	"github.com/ortuman/jackal/xmpp"
 	"github.com/ortuman/jackal/xmpp/jid"
 	"github.com/pborman/uuid"
+	"github.com/pkg/errors"
 	"github.com/stretchr/testify/require"
 )
 
@@ -31,6 +33,7 @@ type fakeClusterDelegate struct {
 	sendCh                chan *cluster.Message
 	sendMessageToCalls    int
 	broadcastMessageCalls int
+	lastBroadcast         *cluster.Message
 }
 
 func (d *fakeClusterDelegate) LocalNode() string {
@@ -50,6 +53,7 @@ func (d *fakeClusterDelegate) SendMessageTo(node string, message *cluster.Messag
 
 func (d *fakeClusterDelegate) BroadcastMessage(msg *cluster.Message) {
 	d.broadcastMessageCalls++
+	d.lastBroadcast = msg
 }
 
 type fakeS2SOut struct {
@@ -66,6 +70,19 @@ func (f *fakeOutS2SProvider) GetOut(localDomain, remoteDomain string) (stream.S2
 	return f.s2sOut, nil
 }
 
+type fakeComponentRouter struct {
+	host   string
+	stanza xmpp.Stanza
+}
+
+func (f *fakeComponentRouter) RouteToComponent(stanza xmpp.Stanza) bool {
+	if stanza.ToJID().Domain() != f.host {
+		return false
+	}
+	f.stanza = stanza
+	return true
+}
+
 func TestRouter_EmptyConfig(t *testing.T) {
 	defer os.RemoveAll("./.cert")
 
@@ -73,6 +90,14 @@ func TestRouter_EmptyConfig(t *testing.T) {
 	require.True(t, r.IsLocalHost("localhost"))
 	require.Equal(t, 1, len(r.HostNames()))
 	require.Equal(t, 1, len(r.Certificates()))
+
+	cer, err := r.GetCertificate(&tls.ClientHelloInfo{ServerName: "localhost"})
+	require.Nil(t, err)
+	require.NotNil(t, cer)
+
+	cer, err = r.GetCertificate(&tls.ClientHelloInfo{ServerName: "jackal.im"})
+	require.Nil(t, err)
+	require.Nil(t, cer)
 }
 
 func TestRouter_SetCluster(t *testing.T) {
@@ -231,6 +256,63 @@ func TestRouter_Routing(t *testing.T) {
 	require.Equal(t, msgID, elem.ID())
 }
 
+func TestRouter_ComponentRouting(t *testing.T) {
+	outS2S := fakeS2SOut{}
+	s2sOutProvider := fakeOutS2SProvider{s2sOut: &outS2S}
+	compRouter := fakeComponentRouter{host: "gateway.jackal.im"}
+
+	r, _, shutdown := setupTest()
+	defer shutdown()
+
+	r.SetOutS2SProvider(&s2sOutProvider)
+	r.SetComponentRouter(&compRouter)
+
+	j1, _ := jid.NewWithString("ortuman@jackal.im/balcony", false)
+	j2, _ := jid.NewWithString("gateway.jackal.im", false)
+	j3, _ := jid.NewWithString("juliet@example.org/garden", false)
+
+	iq := xmpp.NewIQType(uuid.New(), xmpp.GetType)
+	iq.SetFromJID(j1)
+	iq.SetToJID(j2)
+	require.Nil(t, r.Route(iq))
+	require.Equal(t, iq, compRouter.stanza)
+	require.Equal(t, 0, len(outS2S.elems))
+
+	iq.SetToJID(j3)
+	require.Nil(t, r.Route(iq))
+	require.Equal(t, 1, len(outS2S.elems))
+
+	// cluster routed stanzas reach components while router writers are waiting
+	var del fakeClusterDelegate
+	r.SetCluster(&del)
+
+	iq2 := xmpp.NewIQType(uuid.New(), xmpp.GetType)
+	iq2.SetFromJID(j1)
+	iq2.SetToJID(j2)
+
+	doneCh := make(chan struct{})
+	go func() {
+		for i := 0; i < 100; i++ {
+			r.handleNotifyMessage(&cluster.Message{
+				Type:     cluster.MsgRouteStanza,
+				Node:     "node2",
+				Payloads: []cluster.MessagePayload{{JID: j2, Stanza: iq2}},
+			})
+		}
+		close(doneCh)
+	}()
+	for i := 0; i < 100; i++ {
+		r.Bind(stream.NewMockC2S(uuid.New(), j1))
+		r.Unbind(j1)
+	}
+	select {
+	case <-doneCh:
+	case <-time.After(time.Second * 5):
+		require.Fail(t, "router deadlock")
+	}
+	require.Equal(t, iq2, compRouter.stanza)
+}
+
 func TestRouter_BlockedJID(t *testing.T) {
 	r, _, shutdown := setupTest()
 	defer shutdown()
@@ -262,7 +344,7 @@ func TestRouter_BlockedJID(t *testing.T) {
 		JID:      "hamlet@jackal.im",
 	}}
 	_ = storage.InsertBlockListItems(bl2)
-	r.ReloadBlockList("ortuman")
+	r.ReloadBlockList(j1)
 
 	require.True(t, r.IsBlockedJID(j2, "ortuman"))
 	require.True(t, r.IsBlockedJID(j3, "ortuman"))
@@ -276,7 +358,7 @@ func TestRouter_BlockedJID(t *testing.T) {
 		JID:      "jackal.im/balcony",
 	}}
 	_ = storage.InsertBlockListItems(bl3)
-	r.ReloadBlockList("ortuman")
+	r.ReloadBlockList(j1)
 
 	require.True(t, r.IsBlockedJID(j2, "ortuman"))
 	require.False(t, r.IsBlockedJID(j3, "ortuman"))
@@ -290,7 +372,7 @@ func TestRouter_BlockedJID(t *testing.T) {
 		JID:      "jackal.im",
 	}}
 	_ = storage.InsertBlockListItems(bl4)
-	r.ReloadBlockList("ortuman")
+	r.ReloadBlockList(j1)
 
 	require.True(t, r.IsBlockedJID(j2, "ortuman"))
 	require.True(t, r.IsBlockedJID(j3, "ortuman"))
@@ -467,6 +549,53 @@ func TestRouter_Cluster(t *testing.T) {
 	elem := stm3.ReceiveElement()
 	require.NotNil(t, elem)
 	require.Equal(t, elem, iq)
+
+	// test cluster block list reload
+	r.getBlockList("hamlet")
+	r.handleNotifyMessage(&cluster.Message{
+		Type: cluster.MsgReloadBlockList,
+		Node: "node2",
+		Payloads: []cluster.MessagePayload{{
+			JID: j3.ToBareJID(),
+		}},
+	})
+	r.blockListsMu.RLock()
+	require.Nil(t, r.blockLists["hamlet"])
+	r.blockListsMu.RUnlock()
+
+	bcCalls := del.broadcastMessageCalls
+	r.ReloadBlockList(j3)
+	require.Equal(t, bcCalls+1, del.broadcastMessageCalls)
+	require.Equal(t, j3.ToBareJID().String(), del.lastBroadcast.Payloads[0].JID.String())
+
+	// test payload-less cluster requests
+	r.handleNotifyMessage(&cluster.Message{Type: cluster.MsgSetContext, Node: "node2"})
+	r.handleNotifyMessage(&cluster.Message{Type: cluster.MsgDisconnect, Node: "node2"})
+
+	// test cluster stream context mutation
+	r.handleNotifyMessage(&cluster.Message{
+		Type: cluster.MsgSetContext,
+		Node: "node2",
+		Payloads: []cluster.MessagePayload{{
+			JID:     j3,
+			Context: map[string]interface{}{"a": "foo", "b": 35, "c": 3.14, "d": true},
+		}},
+	})
+	require.Equal(t, "foo", stm3.GetString("a"))
+	require.Equal(t, 35, stm3.GetInt("b"))
+	require.Equal(t, 3.14, stm3.GetFloat("c"))
+	require.True(t, stm3.GetBool("d"))
+
+	// test cluster stream disconnection
+	go r.handleNotifyMessage(&cluster.Message{
+		Type: cluster.MsgDisconnect,
+		Node: "node2",
+		Payloads: []cluster.MessagePayload{{
+			JID:     j3,
+			Context: map[string]interface{}{cluster.DisconnectReasonContextKey: "policy-violation"},
+		}},
+	})
+	require.Equal(t, streamerror.ErrPolicyViolation, stm3.WaitDisconnection())
 }
 
 func setupTest() (*Router, *memstorage.Storage, func()) {
@@ -479,3 +608,12 @@ func setupTest() (*Router, *memstorage.Storage, func()) {
 		storage.Unset()
 	}
 }
+
+func TestRouter_ErrorLabel(t *testing.T) {
+	require.Equal(t, "not_existing_account", errorLabel(ErrNotExistingAccount))
+	require.Equal(t, "resource_not_found", errorLabel(ErrResourceNotFound))
+	require.Equal(t, "not_authenticated", errorLabel(ErrNotAuthenticated))
+	require.Equal(t, "blocked_jid", errorLabel(ErrBlockedJID))
+	require.Equal(t, "failed_remote_connect", errorLabel(ErrFailedRemoteConnect))
+	require.Equal(t, "internal", errorLabel(errors.New("storage failure")))
+}
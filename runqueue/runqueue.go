@@ -1,10 +1,14 @@
 package runqueue
 
 import (
+	"strconv"
+	"strings"
 	"sync/atomic"
 
 	"github.com/ortuman/jackal/log"
+	"github.com/ortuman/jackal/metrics"
 	"github.com/ortuman/jackal/runqueue/mpsc"
+	"github.com/prometheus/client_golang/prometheus"
 )
 
 const (
@@ -18,6 +22,7 @@ type RunQueue struct {
 	messageCount int32
 	state        int32
 	stopped      int32
+	backlog      prometheus.Gauge
 }
 
 type funcMessage struct{ fn func() }
@@ -25,8 +30,9 @@ type stopMessage struct{ stopCb func() }
 
 func New(name string) *RunQueue {
 	return &RunQueue{
-		name:  name,
-		queue: mpsc.New(),
+		name:    name,
+		queue:   mpsc.New(),
+		backlog: metrics.RunQueueBacklog.WithLabelValues(queueClass(name)),
 	}
 }
 
@@ -36,6 +42,7 @@ func (m *RunQueue) Run(fn func()) {
 	}
 	m.queue.Push(&funcMessage{fn: fn})
 	atomic.AddInt32(&m.messageCount, 1)
+	m.backlog.Inc()
 	m.schedule()
 }
 
@@ -85,15 +92,38 @@ func (m *RunQueue) run() {
 	for {
 		switch msg := m.queue.Pop().(type) {
 		case *funcMessage:
-			msg.fn()
-			atomic.AddInt32(&m.messageCount, -1)
+			m.runMessage(msg)
 		case *stopMessage:
 			if cb := msg.stopCb; cb != nil {
 				cb()
 			}
+			// messages enqueued behind stop one are discarded
+			discarded := atomic.SwapInt32(&m.messageCount, 0)
+			m.backlog.Sub(float64(discarded))
 			return
 		default:
 			return
 		}
 	}
 }
+
+func (m *RunQueue) runMessage(msg *funcMessage) {
+	defer func() {
+		atomic.AddInt32(&m.messageCount, -1)
+		m.backlog.Dec()
+	}()
+	msg.fn()
+}
+
+// queueClass strips trailing sequence number from a run queue name,
+// so that per stream queues get aggregated under the same metric label.
+func queueClass(name string) string {
+	i := strings.LastIndexByte(name, ':')
+	if i == -1 {
+		return name
+	}
+	if _, err := strconv.ParseUint(name[i+1:], 10, 64); err != nil {
+		return name
+	}
+	return name[:i]
+}
@@ -2,9 +2,11 @@ package runqueue
 
 import (
 	"sync"
+	"sync/atomic"
 	"testing"
 	"time"
 
+	"github.com/prometheus/client_golang/prometheus/testutil"
 	"github.com/stretchr/testify/require"
 )
 
@@ -48,3 +50,39 @@ func TestRunQueueStop(t *testing.T) {
 		break
 	}
 }
+
+func TestRunQueueBacklog(t *testing.T) {
+	rq := New("backlog")
+
+	waitBacklog := func(expected float64) {
+		for i := 0; i < 100 && testutil.ToFloat64(rq.backlog) != expected; i++ {
+			time.Sleep(time.Millisecond * 10)
+		}
+		require.Equal(t, expected, testutil.ToFloat64(rq.backlog))
+	}
+	// panicking message
+	rq.Run(func() { panic("run queue panic") })
+	waitBacklog(0)
+
+	// message discarded after stop
+	blockCh := make(chan struct{})
+	rq.Run(func() { <-blockCh })
+
+	stopCh := make(chan struct{})
+	rq.Stop(func() { close(stopCh) })
+
+	rq.queue.Push(&funcMessage{fn: func() {}})
+	atomic.AddInt32(&rq.messageCount, 1)
+	rq.backlog.Inc()
+
+	close(blockCh)
+	<-stopCh
+	waitBacklog(0)
+}
+
+func TestRunQueueClass(t *testing.T) {
+	require.Equal(t, "xep0030", queueClass("xep0030"))
+	require.Equal(t, "c2s:default", queueClass("c2s:default:12"))
+	require.Equal(t, "s2s:out", queueClass("s2s:out:3"))
+	require.Equal(t, "jackal.im:jabber.org", queueClass("jackal.im:jabber.org"))
+}
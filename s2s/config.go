@@ -7,15 +7,19 @@ package s2s
 
 import (
 	"crypto/tls"
+	"crypto/x509"
 	"fmt"
+	"net"
 	"time"
 
 	"github.com/netsec-ethz/scion-apps/lib/scionutil"
 	"github.com/ortuman/jackal/module"
 	"github.com/ortuman/jackal/stream"
 	"github.com/ortuman/jackal/transport"
+	"github.com/ortuman/jackal/util"
 	"github.com/ortuman/jackal/xmpp"
 	"github.com/pkg/errors"
+	libaddr "github.com/scionproto/scion/go/lib/addr"
 	"github.com/scionproto/scion/go/lib/sciond"
 	"github.com/scionproto/scion/go/lib/sock/reliable"
 )
@@ -23,23 +27,31 @@ import (
 const (
 	defaultTransportPort      = 5269
 	defaultScionTransportPort = 52690
+	defaultQUICTransportPort  = 5269
+	defaultQUICSRVService     = "xmpp-server-quic"
+	defaultResolverCacheTTL   = time.Duration(5) * time.Minute
 	defaultTransportKeepAlive = time.Duration(10) * time.Minute
 	defaultDialTimeout        = time.Duration(15) * time.Second
 	defaultConnectTimeout     = time.Duration(5) * time.Second
 	defaultMaxStanzaSize      = 131072
+	defaultQueueMinBackoff    = time.Duration(5) * time.Second
+	defaultQueueMaxBackoff    = time.Duration(10) * time.Minute
+	defaultQueueMaxAge        = time.Duration(1) * time.Hour
 )
 
 // TransportConfig represents s2s transport configuration.
 type TransportConfig struct {
-	BindAddress string
-	Port        int
-	KeepAlive   time.Duration
+	BindAddress   string
+	Port          int
+	DirectTLSPort int
+	KeepAlive     time.Duration
 }
 
 type transportConfigProxy struct {
-	BindAddress string `yaml:"bind_addr"`
-	Port        int    `yaml:"port"`
-	KeepAlive   int    `yaml:"keep_alive"`
+	BindAddress   string `yaml:"bind_addr"`
+	Port          int    `yaml:"port"`
+	DirectTLSPort int    `yaml:"direct_tls_port"`
+	KeepAlive     int    `yaml:"keep_alive"`
 }
 
 // UnmarshalYAML satisfies Unmarshaler interface.
@@ -53,6 +65,10 @@ func (c *TransportConfig) UnmarshalYAML(unmarshal func(interface{}) error) error
 	if c.Port == 0 {
 		c.Port = defaultTransportPort
 	}
+	if p.DirectTLSPort < 0 {
+		return fmt.Errorf("s2s.TransportConfig: invalid direct TLS port: %d", p.DirectTLSPort)
+	}
+	c.DirectTLSPort = p.DirectTLSPort
 	if p.KeepAlive > 0 {
 		c.KeepAlive = time.Duration(p.KeepAlive) * time.Second
 	} else {
@@ -62,23 +78,25 @@ func (c *TransportConfig) UnmarshalYAML(unmarshal func(interface{}) error) error
 }
 
 type ScionConfig struct {
-	Address    string
-	Port       int
-	Dispatcher string
-	Sciond     string
-	KeepAlive  time.Duration
-	Key        string
-	Cert       string
+	Address      string
+	Port         int
+	Dispatcher   string
+	Sciond       string
+	KeepAlive    time.Duration
+	Key          string
+	Cert         string
+	PathPolicies map[string]PathPolicy
 }
 
 type scionConfigProxy struct {
-	Address    string `yaml:"addr"`
-	Port       int    `yaml:"port"`
-	Dispatcher string `yaml:"dispatcher_path"`
-	Sciond     string `yaml:"sciond_path"`
-	KeepAlive  int    `yaml:"keep_alive"`
-	Key        string `yaml:"privkey_path"`
-	Cert       string `yaml:"cert_path"`
+	Address      string                `yaml:"addr"`
+	Port         int                   `yaml:"port"`
+	Dispatcher   string                `yaml:"dispatcher_path"`
+	Sciond       string                `yaml:"sciond_path"`
+	KeepAlive    int                   `yaml:"keep_alive"`
+	Key          string                `yaml:"privkey_path"`
+	Cert         string                `yaml:"cert_path"`
+	PathPolicies map[string]PathPolicy `yaml:"path_policies"`
 }
 
 // UnmarshalYAML satisfies Unmarshaler interface.
@@ -123,6 +141,191 @@ func (c *ScionConfig) UnmarshalYAML(unmarshal func(interface{}) error) error {
 	if len(c.Sciond) == 0 {
 		c.Sciond = sciond.DefaultSCIONDPath
 	}
+	c.PathPolicies = p.PathPolicies
+	return nil
+}
+
+type pathPolicyProxy struct {
+	Allow  []string `yaml:"allow"`
+	Deny   []string `yaml:"deny"`
+	Prefer string   `yaml:"prefer"`
+}
+
+// UnmarshalYAML satisfies Unmarshaler interface.
+func (c *PathPolicy) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	p := pathPolicyProxy{}
+	if err := unmarshal(&p); err != nil {
+		return err
+	}
+	allow, err := parseIAList(p.Allow)
+	if err != nil {
+		return err
+	}
+	deny, err := parseIAList(p.Deny)
+	if err != nil {
+		return err
+	}
+	c.Allow = allow
+	c.Deny = deny
+
+	switch p.Prefer {
+	case "", "hops":
+		c.Prefer = PreferHops
+	case "latency":
+		c.Prefer = PreferLatency
+	case "mtu":
+		c.Prefer = PreferMTU
+	default:
+		return fmt.Errorf("s2s.PathPolicy: unrecognized path preference: %s", p.Prefer)
+	}
+	return nil
+}
+
+func parseIAList(list []string) ([]libaddr.IA, error) {
+	var ret []libaddr.IA
+	for _, s := range list {
+		ia, err := libaddr.IAFromString(s)
+		if err != nil {
+			return nil, fmt.Errorf("s2s.PathPolicy: invalid ISD-AS %s: %v", s, err)
+		}
+		ret = append(ret, ia)
+	}
+	return ret, nil
+}
+
+// QUICConfig represents s2s UDP/IP QUIC transport configuration.
+type QUICConfig struct {
+	BindAddress string
+	Port        int
+	KeepAlive   time.Duration
+	SRVService  string
+	Peers       map[string]string
+}
+
+type quicConfigProxy struct {
+	BindAddress string            `yaml:"bind_addr"`
+	Port        int               `yaml:"port"`
+	KeepAlive   int               `yaml:"keep_alive"`
+	SRVService  string            `yaml:"srv_service"`
+	Peers       map[string]string `yaml:"peers"`
+}
+
+// UnmarshalYAML satisfies Unmarshaler interface.
+func (c *QUICConfig) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	p := quicConfigProxy{}
+	if err := unmarshal(&p); err != nil {
+		return err
+	}
+	c.BindAddress = p.BindAddress
+	c.Port = p.Port
+	if c.Port == 0 {
+		c.Port = defaultQUICTransportPort
+	}
+	if p.KeepAlive > 0 {
+		c.KeepAlive = time.Duration(p.KeepAlive) * time.Second
+	} else {
+		c.KeepAlive = defaultTransportKeepAlive
+	}
+	c.SRVService = p.SRVService
+	if len(c.SRVService) == 0 {
+		c.SRVService = defaultQUICSRVService
+	}
+	// validate static peers addresses
+	for domain, address := range p.Peers {
+		if _, _, err := net.SplitHostPort(address); err != nil {
+			return fmt.Errorf("s2s.QUICConfig: invalid peer address for %s: %v", domain, err)
+		}
+	}
+	c.Peers = p.Peers
+	return nil
+}
+
+// ResolverConfig represents s2s remote domain resolution configuration.
+type ResolverConfig struct {
+	Order    []string
+	CacheTTL time.Duration
+	Hosts    map[string][]string
+}
+
+type resolverConfigProxy struct {
+	Order    []string            `yaml:"order"`
+	CacheTTL int                 `yaml:"cache_ttl"`
+	Hosts    map[string][]string `yaml:"hosts"`
+}
+
+// UnmarshalYAML satisfies Unmarshaler interface.
+func (c *ResolverConfig) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	p := resolverConfigProxy{}
+	if err := unmarshal(&p); err != nil {
+		return err
+	}
+	for _, name := range p.Order {
+		switch name {
+		case staticResolverName, rainsResolverName, srvResolverName:
+			break
+		default:
+			return fmt.Errorf("s2s.ResolverConfig: unrecognized resolver: %s", name)
+		}
+	}
+	c.Order = p.Order
+	if len(c.Order) == 0 {
+		c.Order = defaultResolverOrder
+	}
+	if p.CacheTTL < 0 {
+		return fmt.Errorf("s2s.ResolverConfig: invalid cache TTL: %d", p.CacheTTL)
+	}
+	c.CacheTTL = time.Duration(p.CacheTTL) * time.Second
+	if c.CacheTTL == 0 {
+		c.CacheTTL = defaultResolverCacheTTL
+	}
+	for domain, addresses := range p.Hosts {
+		for _, address := range addresses {
+			if _, err := parseStaticEndpoint(address); err != nil {
+				return fmt.Errorf("s2s.ResolverConfig: %s: %v", domain, err)
+			}
+		}
+	}
+	c.Hosts = p.Hosts
+	return nil
+}
+
+// QueueConfig represents s2s outgoing queue configuration.
+type QueueConfig struct {
+	MinBackoff time.Duration
+	MaxBackoff time.Duration
+	MaxAge     time.Duration
+}
+
+type queueConfigProxy struct {
+	MinBackoff int `yaml:"min_backoff"`
+	MaxBackoff int `yaml:"max_backoff"`
+	MaxAge     int `yaml:"max_age"`
+}
+
+// UnmarshalYAML satisfies Unmarshaler interface.
+func (c *QueueConfig) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	p := queueConfigProxy{}
+	if err := unmarshal(&p); err != nil {
+		return err
+	}
+	if p.MinBackoff < 0 || p.MaxBackoff < 0 || p.MaxAge < 0 {
+		return errors.New("s2s.QueueConfig: backoff and max age values must be positive")
+	}
+	c.MinBackoff = time.Duration(p.MinBackoff) * time.Second
+	if c.MinBackoff == 0 {
+		c.MinBackoff = defaultQueueMinBackoff
+	}
+	c.MaxBackoff = time.Duration(p.MaxBackoff) * time.Second
+	if c.MaxBackoff == 0 {
+		c.MaxBackoff = defaultQueueMaxBackoff
+	}
+	if c.MaxBackoff < c.MinBackoff {
+		return fmt.Errorf("s2s.QueueConfig: max backoff (%v) lower than min backoff (%v)", c.MaxBackoff, c.MinBackoff)
+	}
+	c.MaxAge = time.Duration(p.MaxAge) * time.Second
+	if c.MaxAge == 0 {
+		c.MaxAge = defaultQueueMaxAge
+	}
 	return nil
 }
 
@@ -130,6 +333,7 @@ func (c *ScionConfig) UnmarshalYAML(unmarshal func(interface{}) error) error {
 type TLSConfig struct {
 	CertFile    string `yaml:"cert_path"`
 	PrivKeyFile string `yaml:"privkey_path"`
+	CAFile      string `yaml:"ca_path"`
 }
 
 // Config represents an s2s configuration.
@@ -139,8 +343,25 @@ type Config struct {
 	ConnectTimeout time.Duration
 	DialbackSecret string
 	MaxStanzaSize  int
+	RootCAs        *x509.CertPool
+	RequireTLSAuth []string
 	Transport      TransportConfig
 	Scion          *ScionConfig
+	QUIC           *QUICConfig
+	Resolver       ResolverConfig
+	Queue          *QueueConfig
+
+	// PingInterval is the XEP-0199 ping interval of outgoing streams (0 disables pinging),
+	// stream gets disconnected if remote server does not reply within PingTimeout.
+	PingInterval time.Duration
+	PingTimeout  time.Duration
+
+	// WhitespaceInterval is the interval at which whitespace keepalives are sent (0 disables them).
+	WhitespaceInterval time.Duration
+
+	// IdleTimeout is the period after which an outgoing stream
+	// not carrying any stanza is closed (0 disables it).
+	IdleTimeout time.Duration
 }
 
 type configProxy struct {
@@ -149,8 +370,17 @@ type configProxy struct {
 	ConnectTimeout int             `yaml:"connect_timeout"`
 	DialbackSecret string          `yaml:"dialback_secret"`
 	MaxStanzaSize  int             `yaml:"max_stanza_size"`
+	TLS            TLSConfig       `yaml:"tls"`
+	RequireTLSAuth []string        `yaml:"require_tls_auth"`
 	Transport      TransportConfig `yaml:"transport"`
 	Scion          *ScionConfig    `yaml:"scion_transport"`
+	QUIC           *QUICConfig     `yaml:"quic_transport"`
+	Resolver       *ResolverConfig `yaml:"resolver"`
+	Queue          *QueueConfig    `yaml:"queue"`
+	PingInterval   int             `yaml:"ping_interval"`
+	PingTimeout    int             `yaml:"ping_timeout"`
+	Whitespace     int             `yaml:"whitespace_interval"`
+	IdleTimeout    int             `yaml:"idle_timeout"`
 }
 
 // UnmarshalYAML satisfies Unmarshaler interface.
@@ -177,7 +407,35 @@ func (c *Config) UnmarshalYAML(unmarshal func(interface{}) error) error {
 	if c.MaxStanzaSize == 0 {
 		c.MaxStanzaSize = defaultMaxStanzaSize
 	}
+	// peer certificates trust store (system roots if not specified)
+	c.RootCAs = nil
+	if len(p.TLS.CAFile) > 0 {
+		rootCAs, err := util.LoadCertPool(p.TLS.CAFile)
+		if err != nil {
+			return err
+		}
+		c.RootCAs = rootCAs
+	}
+	c.RequireTLSAuth = p.RequireTLSAuth
 	c.Scion = p.Scion
+	c.QUIC = p.QUIC
+	if p.Resolver != nil {
+		c.Resolver = *p.Resolver
+	} else {
+		c.Resolver = ResolverConfig{Order: defaultResolverOrder, CacheTTL: defaultResolverCacheTTL}
+	}
+	c.Queue = p.Queue
+
+	if p.PingInterval < 0 || p.PingTimeout < 0 || p.Whitespace < 0 || p.IdleTimeout < 0 {
+		return errors.New("s2s.Config: ping, whitespace and idle values must be positive")
+	}
+	c.PingInterval = time.Duration(p.PingInterval) * time.Second
+	c.PingTimeout = time.Duration(p.PingTimeout) * time.Second
+	if c.PingTimeout == 0 {
+		c.PingTimeout = c.PingInterval / 3
+	}
+	c.WhitespaceInterval = time.Duration(p.Whitespace) * time.Second
+	c.IdleTimeout = time.Duration(p.IdleTimeout) * time.Second
 	return nil
 }
 
@@ -188,10 +446,30 @@ type streamConfig struct {
 	remoteDomain    string
 	connectTimeout  time.Duration
 	tls             *tls.Config
+	rootCAs         *x509.CertPool
+	requireTLSAuth  []string
+	directTLS       bool
 	transport       transport.Transport
 	maxStanzaSize   int
 	dbVerify        xmpp.XElement
+	scion           bool
 	dialer          *dialer
+	pingInterval    time.Duration
+	pingTimeout     time.Duration
+	whitespace      time.Duration
+	idleTimeout     time.Duration
+	onPong          func(iq *xmpp.IQ) bool
 	onInDisconnect  func(s stream.S2SIn)
 	onOutDisconnect func(s stream.S2SOut)
 }
+
+// isTLSAuthRequired returns whether or not remote domain
+// must be authenticated by means of its TLS certificate.
+func (c *streamConfig) isTLSAuthRequired(remoteDomain string) bool {
+	for _, domain := range c.requireTLSAuth {
+		if domain == remoteDomain {
+			return true
+		}
+	}
+	return false
+}
@@ -41,7 +41,15 @@ keep_alive: 200
 	require.Nil(t, err)
 	require.Equal(t, "127.0.0.1", trCfg.BindAddress)
 	require.Equal(t, 5999, trCfg.Port)
+	require.Equal(t, 0, trCfg.DirectTLSPort)
 	require.Equal(t, time.Duration(200)*time.Second, trCfg.KeepAlive)
+
+	err = yaml.Unmarshal([]byte("{port: 5269, direct_tls_port: 5270}"), &trCfg)
+	require.Nil(t, err)
+	require.Equal(t, 5270, trCfg.DirectTLSPort)
+
+	err = yaml.Unmarshal([]byte("{direct_tls_port: -1}"), &trCfg)
+	require.NotNil(t, err)
 }
 
 func TestConfig(t *testing.T) {
@@ -75,6 +83,49 @@ max_stanza_size: 8192
 	require.Equal(t, time.Duration(250)*time.Second, cfg.ConnectTimeout)
 	require.Equal(t, 8192, cfg.MaxStanzaSize)
 	require.Nil(t, cfg.Scion)
+	require.Nil(t, cfg.QUIC)
+	require.Nil(t, cfg.RootCAs)
+	require.Equal(t, defaultResolverOrder, cfg.Resolver.Order)
+	require.Equal(t, defaultResolverCacheTTL, cfg.Resolver.CacheTTL)
+	require.Equal(t, time.Duration(0), cfg.PingInterval)
+	require.Equal(t, time.Duration(0), cfg.IdleTimeout)
+
+	rawCfg2 := rawCfg + `
+ping_interval: 60
+whitespace_interval: 30
+idle_timeout: 600
+`
+	err = yaml.Unmarshal([]byte(rawCfg2), &cfg)
+	require.Nil(t, err)
+	require.Equal(t, time.Minute, cfg.PingInterval)
+	require.Equal(t, 20*time.Second, cfg.PingTimeout)
+	require.Equal(t, 30*time.Second, cfg.WhitespaceInterval)
+	require.Equal(t, 10*time.Minute, cfg.IdleTimeout)
+
+	err = yaml.Unmarshal([]byte(rawCfg+"ping_timeout: 5\n"), &cfg)
+	require.Nil(t, err)
+	require.Equal(t, 5*time.Second, cfg.PingTimeout)
+
+	err = yaml.Unmarshal([]byte(rawCfg+"idle_timeout: -1\n"), &cfg)
+	require.NotNil(t, err)
+
+	rawCfg2 = rawCfg + `
+tls:
+  ca_path: "../testdata/cert/unknown.crt"
+`
+	err = yaml.Unmarshal([]byte(rawCfg2), &cfg)
+	require.NotNil(t, err)
+
+	rawCfg2 = rawCfg + `
+tls:
+  ca_path: "../testdata/cert/test.server.crt"
+require_tls_auth: [jabber.org]
+`
+	err = yaml.Unmarshal([]byte(rawCfg2), &cfg)
+	require.Nil(t, err)
+	require.NotNil(t, cfg.RootCAs)
+	require.Equal(t, []string{"jabber.org"}, cfg.RequireTLSAuth)
+
 	rawCfg += `
 scion_transport:
   addr: "my_scion_address"
@@ -85,6 +136,116 @@ scion_transport:
 	require.NotNil(t, cfg.Scion)
 }
 
+func TestResolverConfig(t *testing.T) {
+	cfg := ResolverConfig{}
+	err := yaml.Unmarshal([]byte(`{}`), &cfg)
+	require.Nil(t, err)
+	require.Equal(t, defaultResolverOrder, cfg.Order)
+	require.Equal(t, defaultResolverCacheTTL, cfg.CacheTTL)
+
+	rawCfg := `
+order: [static, srv]
+cache_ttl: 60
+hosts:
+  jabber.org: ["1-ff00:0:110,[127.0.0.1]:52690", "127.0.0.1:5269"]
+`
+	err = yaml.Unmarshal([]byte(rawCfg), &cfg)
+	require.Nil(t, err)
+	require.Equal(t, []string{"static", "srv"}, cfg.Order)
+	require.Equal(t, time.Minute, cfg.CacheTTL)
+	require.Len(t, cfg.Hosts["jabber.org"], 2)
+
+	err = yaml.Unmarshal([]byte(`{order: [static, mdns]}`), &cfg)
+	require.NotNil(t, err)
+	err = yaml.Unmarshal([]byte(`{cache_ttl: -1}`), &cfg)
+	require.NotNil(t, err)
+	err = yaml.Unmarshal([]byte(`{hosts: {jabber.org: [jabber.org]}}`), &cfg)
+	require.NotNil(t, err)
+}
+
+func TestQueueConfig(t *testing.T) {
+	cfg := QueueConfig{}
+	err := yaml.Unmarshal([]byte(`{}`), &cfg)
+	require.Nil(t, err)
+	require.Equal(t, defaultQueueMinBackoff, cfg.MinBackoff)
+	require.Equal(t, defaultQueueMaxBackoff, cfg.MaxBackoff)
+	require.Equal(t, defaultQueueMaxAge, cfg.MaxAge)
+
+	rawCfg := `
+min_backoff: 2
+max_backoff: 60
+max_age: 600
+`
+	err = yaml.Unmarshal([]byte(rawCfg), &cfg)
+	require.Nil(t, err)
+	require.Equal(t, 2*time.Second, cfg.MinBackoff)
+	require.Equal(t, time.Minute, cfg.MaxBackoff)
+	require.Equal(t, 10*time.Minute, cfg.MaxAge)
+
+	err = yaml.Unmarshal([]byte(`{max_age: -1}`), &cfg)
+	require.NotNil(t, err)
+	err = yaml.Unmarshal([]byte(`{min_backoff: 60, max_backoff: 30}`), &cfg)
+	require.NotNil(t, err)
+}
+
+func TestQUICConfig(t *testing.T) {
+	cfg := QUICConfig{}
+	err := yaml.Unmarshal([]byte(`{}`), &cfg)
+	require.Nil(t, err)
+	require.Equal(t, defaultQUICTransportPort, cfg.Port)
+	require.Equal(t, defaultTransportKeepAlive, cfg.KeepAlive)
+	require.Equal(t, defaultQUICSRVService, cfg.SRVService)
+
+	rawCfg := `
+bind_addr: 127.0.0.1
+port: 5271
+keep_alive: 30
+srv_service: xmpp-quic
+peers:
+  jabber.org: "127.0.0.1:5272"
+`
+	err = yaml.Unmarshal([]byte(rawCfg), &cfg)
+	require.Nil(t, err)
+	require.Equal(t, "127.0.0.1", cfg.BindAddress)
+	require.Equal(t, 5271, cfg.Port)
+	require.Equal(t, 30*time.Second, cfg.KeepAlive)
+	require.Equal(t, "xmpp-quic", cfg.SRVService)
+	require.Equal(t, "127.0.0.1:5272", cfg.Peers["jabber.org"])
+
+	err = yaml.Unmarshal([]byte(`{peers: {jabber.org: "127.0.0.1"}}`), &cfg)
+	require.NotNil(t, err)
+}
+
+func TestPathPolicyConfig(t *testing.T) {
+	cfg := ScionConfig{}
+	rawCfg := `
+addr: "1-ff00:0:110,[127.0.0.1]"
+privkey_path: "key_path"
+cert_path: "c_path"
+path_policies:
+  jabber.org:
+    allow: ["1-0", "2-ff00:0:210"]
+    deny: ["1-ff00:0:111"]
+    prefer: latency
+  "*":
+    prefer: mtu
+`
+	err := yaml.Unmarshal([]byte(rawCfg), &cfg)
+	require.Nil(t, err)
+	require.Len(t, cfg.PathPolicies, 2)
+	policy := cfg.PathPolicies["jabber.org"]
+	require.Len(t, policy.Allow, 2)
+	require.Equal(t, "1-ff00:0:111", policy.Deny[0].String())
+	require.Equal(t, PreferLatency, policy.Prefer)
+	require.Equal(t, PreferMTU, cfg.PathPolicies["*"].Prefer)
+
+	p := PathPolicy{}
+	require.Nil(t, yaml.Unmarshal([]byte(`{}`), &p))
+	require.Equal(t, PreferHops, p.Prefer)
+	require.NotNil(t, yaml.Unmarshal([]byte(`{prefer: bandwidth}`), &p))
+	require.NotNil(t, yaml.Unmarshal([]byte(`{deny: [ff00:0:110]}`), &p))
+}
+
 func TestScionConfig(t *testing.T) {
 	cfg := ScionConfig{}
 	rawCfg := `empty`
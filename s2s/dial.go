@@ -7,9 +7,10 @@ package s2s
 
 import (
 	"crypto/tls"
+	"errors"
 	"net"
-	"strconv"
-	"strings"
+	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/ortuman/jackal/log"
@@ -22,122 +23,295 @@ import (
 	"github.com/scionproto/scion/go/lib/snet"
 	"github.com/scionproto/scion/go/lib/snet/squic"
 	"github.com/scionproto/scion/go/lib/sock/reliable"
+)
 
-	libaddr "github.com/scionproto/scion/go/lib/addr"
+var (
+	errScionNotConfigured = errors.New("s2s: SCION transport not configured")
+	errQUICNotConfigured  = errors.New("s2s: QUIC transport not configured")
 )
 
 type dialer struct {
 	cfg         *Config
 	router      *router.Router
-	srvResolve  func(service, proto, name string) (cname string, addrs []*net.SRV, err error)
+	resolver    resolver
 	dialTimeout func(network, address string, timeout time.Duration) (net.Conn, error)
+	quicDial    func(address string, tlsConf *tls.Config, config *quic.Config) (quic.Session, error)
+	scionInit   func(local *snet.Addr) error
+	scionDial   func(local, remote *snet.Addr, config *quic.Config) (quic.Session, error)
+	paths       *pathSelector
+	sessions    *quicSessionPool
 }
 
 func newDialer(cfg *Config, router *router.Router) *dialer {
-	return &dialer{cfg: cfg, router: router, srvResolve: net.LookupSRV, dialTimeout: net.DialTimeout}
+	d := &dialer{
+		cfg:         cfg,
+		router:      router,
+		resolver:    newResolver(cfg, net.LookupSRV),
+		dialTimeout: net.DialTimeout,
+		quicDial:    quic.DialAddr,
+		sessions:    newQUICSessionPool(),
+		scionDial: func(local, remote *snet.Addr, config *quic.Config) (quic.Session, error) {
+			return squic.DialSCION(nil, local, remote, config)
+		},
+	}
+	d.scionInit = d.initSCIONNetwork
+	if cfg.Scion != nil {
+		d.paths = newPathSelector(&sciondPathProvider{}, cfg.Scion.PathPolicies)
+	}
+	return d
 }
 
-func (d *dialer) dialQUIC(remote *snet.Addr, localDomain, remoteDomain string) (*streamConfig, error) {
-	var local *snet.Addr
-	var err error
-	if d.cfg.Scion.Address == "localhost" {
-		local, err = scionutil.GetLocalhost()
-	} else {
-		local, err = snet.AddrFromString(d.cfg.Scion.Address)
+var scionInitMu sync.Mutex
+
+func (d *dialer) initSCIONNetwork(local *snet.Addr) error {
+	scionInitMu.Lock()
+	defer scionInitMu.Unlock()
+	if snet.DefNetwork != nil {
+		return nil // already initialized
 	}
+	sciondPath := sciond.GetDefaultSCIONDPath(nil)
+	dispatcherPath := d.cfg.Scion.Dispatcher
+	return snet.Init(local.IA, sciondPath, reliable.NewDispatcherService(dispatcherPath))
+}
+
+func (d *dialer) dial(localDomain, remoteDomain string) (*streamConfig, error) {
+	endpoints, err := d.resolver.resolve(remoteDomain)
 	if err != nil {
 		return nil, err
 	}
+	if len(endpoints) == 0 {
+		return nil, errNoEndpoints
+	}
+	// try every resolved endpoint in order of preference
+	for _, ep := range endpoints {
+		var ret *streamConfig
+		ret, err = d.dialEndpoint(ep, localDomain, remoteDomain)
+		if err != nil {
+			log.Warnf("s2s: failed to dial %s (%s): %v", remoteDomain, ep, err)
+			continue
+		}
+		ret.rootCAs = d.cfg.RootCAs
+		ret.requireTLSAuth = d.cfg.RequireTLSAuth
+		return ret, nil
+	}
+	return nil, err
+}
 
-	sciondPath := sciond.GetDefaultSCIONDPath(nil)
-	dispatcherPath := d.cfg.Scion.Dispatcher
-	snet.Init(local.IA, sciondPath, reliable.NewDispatcherService(dispatcherPath))
-	quicConfig := &quic.Config{
-		KeepAlive: true,
+func (d *dialer) dialEndpoint(ep endpoint, localDomain, remoteDomain string) (*streamConfig, error) {
+	switch ep.typ {
+	case scionEndpoint:
+		return d.dialSCION(ep.scionAddr, localDomain, remoteDomain)
+	case quicEndpoint:
+		return d.dialQUIC(ep.address, localDomain, remoteDomain)
+	case directTLSEndpoint:
+		return d.dialDirectTLS(ep.address, localDomain, remoteDomain)
+	default:
+		return d.dialTCP(ep.address, localDomain, remoteDomain)
+	}
+}
+
+func (d *dialer) dialSCION(remote *snet.Addr, localDomain, remoteDomain string) (*streamConfig, error) {
+	if d.cfg.Scion == nil {
+		return nil, errScionNotConfigured
+	}
+	ep := endpoint{typ: scionEndpoint, scionAddr: remote}
+	reusable := func(sess quic.Session) bool {
+		scionSess, ok := sess.(*scionSession)
+		return ok && d.paths.allows(remoteDomain, scionSess.path)
 	}
-	sess, err := squic.DialSCION(nil, local, remote, quicConfig)
+	sess, stm, reused, err := d.sessions.openStream(ep.String(), reusable, func() (quic.Session, error) {
+		return d.dialSCIONSession(remote, remoteDomain)
+	})
 	if err != nil {
 		return nil, err
 	}
-	biStream, err := sess.OpenStreamSync()
-	if err != nil {
-		log.Infof("Couldn't open a new QUIC Stream")
+	if reused {
+		log.Infof("s2s: %s stream multiplexed over SCION session to %s", remoteDomain, remote)
 	}
-
-	tr := transport.NewQUICSocketTransport(sess, biStream,
+	tr := transport.NewQUICSocketTransport(sess, stm,
 		d.cfg.Transport.KeepAlive)
 	return &streamConfig{
 		keyGen:        &keyGen{secret: d.cfg.DialbackSecret},
 		localDomain:   localDomain,
 		remoteDomain:  remoteDomain,
 		transport:     tr,
+		scion:         true,
 		maxStanzaSize: d.cfg.MaxStanzaSize,
 	}, nil
 }
 
-func (d *dialer) dialTCP(localDomain, remoteDomain string) (*streamConfig, error) {
-	_, addrs, err := d.srvResolve("xmpp-server", "tcp", remoteDomain)
-	if err != nil {
-		log.Warnf("srv lookup error: %v", err)
+// scionSession represents a QUIC session established over a SCION path.
+type scionSession struct {
+	quic.Session
+	path   *scionPath // nil within local AS
+	closed uint32
+}
+
+func (s *scionSession) Close() error {
+	atomic.StoreUint32(&s.closed, 1)
+	return s.Session.Close()
+}
+
+// watchSCIONSession marks session path as down in case session gets closed with an error,
+// so that streams to remote domain are re-dialed through an alternate path.
+func (d *dialer) watchSCIONSession(sess *scionSession, remoteDomain string) {
+	<-sess.Context().Done()
+	if atomic.LoadUint32(&sess.closed) == 1 {
+		return // closed by us
+	}
+	// once closed, session reports its close error
+	_, err := sess.AcceptStream()
+	if isGracefulClose(err) {
+		return
 	}
-	var target string
+	log.Warnf("s2s: %s session through SCION path %v closed: %v", remoteDomain, sess.path, err)
+	d.paths.markDown(sess.path)
+}
 
-	if err != nil || len(addrs) == 1 && addrs[0].Target == "." {
-		target = remoteDomain + ":5269"
+// isGracefulClose tells whether a QUIC session has been closed by peer without error.
+// quic-go does not export its error codes, so it has to be told apart by description.
+func isGracefulClose(err error) bool {
+	return err == nil || err.Error() == "NO_ERROR"
+}
+
+func (d *dialer) dialSCIONSession(remote *snet.Addr, remoteDomain string) (quic.Session, error) {
+	var local *snet.Addr
+	var err error
+	if d.cfg.Scion.Address == "localhost" {
+		local, err = scionutil.GetLocalhost()
 	} else {
-		target = strings.TrimSuffix(addrs[0].Target, ".") + ":" + strconv.Itoa(int(addrs[0].Port))
+		local, err = snet.AddrFromString(d.cfg.Scion.Address)
 	}
-	conn, err := d.dialTimeout("tcp", target, d.cfg.DialTimeout)
 	if err != nil {
 		return nil, err
 	}
-	tlsConfig := &tls.Config{
-		ServerName:   remoteDomain,
-		Certificates: d.router.Certificates(),
+	if err := d.scionInit(local); err != nil {
+		return nil, err
 	}
-	tr := transport.NewSocketTransport(conn, d.cfg.Transport.KeepAlive)
+	quicConfig := &quic.Config{
+		HandshakeTimeout: d.cfg.DialTimeout,
+		KeepAlive:        true,
+	}
+	if local.IA.Equal(remote.IA) {
+		// no path needed within local AS
+		sess, err := d.scionDial(local, remote, quicConfig)
+		if err != nil {
+			return nil, err
+		}
+		return &scionSession{Session: sess}, nil
+	}
+	paths, err := d.paths.selectPaths(remoteDomain, local.IA, remote.IA)
+	if err != nil {
+		return nil, err
+	}
+	// fail over to alternate paths until a session is established
+	for _, p := range paths {
+		raddr := remote.Copy()
+		raddr.Path = p.path
+		raddr.NextHop = p.nextHop
+
+		start := time.Now()
+		var sess quic.Session
+		sess, err = d.scionDial(local, raddr, quicConfig)
+		if err != nil {
+			log.Warnf("s2s: SCION path %v to %s failed: %v", p, remoteDomain, err)
+			d.paths.markDown(p)
+			continue
+		}
+		d.paths.observe(p, time.Since(start))
+		log.Infof("s2s: %s session established through SCION path %v", remoteDomain, p)
+
+		scionSess := &scionSession{Session: sess, path: p}
+		go d.watchSCIONSession(scionSess, remoteDomain)
+		return scionSess, nil
+	}
+	return nil, err
+}
+
+func (d *dialer) dialQUIC(address, localDomain, remoteDomain string) (*streamConfig, error) {
+	if d.cfg.QUIC == nil {
+		return nil, errQUICNotConfigured
+	}
+	ep := endpoint{typ: quicEndpoint, address: address}
+	// only share sessions whose peer certificate is valid for remote domain
+	reusable := func(sess quic.Session) bool {
+		return verifyPeerCertificate(sess.ConnectionState().PeerCertificates, d.cfg.RootCAs, remoteDomain) == nil
+	}
+	sess, stm, reused, err := d.sessions.openStream(ep.String(), reusable, func() (quic.Session, error) {
+		return d.quicDial(address, &tls.Config{
+			ServerName:   remoteDomain,
+			Certificates: d.router.Certificates(),
+			RootCAs:      d.cfg.RootCAs,
+			NextProtos:   []string{directTLSProtocol},
+		}, &quic.Config{
+			HandshakeTimeout: d.cfg.DialTimeout,
+			KeepAlive:        true,
+		})
+	})
+	if err != nil {
+		return nil, err
+	}
+	if reused {
+		log.Infof("s2s: %s stream multiplexed over QUIC session to %s", remoteDomain, address)
+	}
+	tr := transport.NewQUICSocketTransport(sess, stm, d.cfg.QUIC.KeepAlive)
 	return &streamConfig{
 		keyGen:        &keyGen{secret: d.cfg.DialbackSecret},
 		localDomain:   localDomain,
 		remoteDomain:  remoteDomain,
 		transport:     tr,
-		tls:           tlsConfig,
+		directTLS:     true,
 		maxStanzaSize: d.cfg.MaxStanzaSize,
 	}, nil
 }
 
-func (d *dialer) dial(localDomain, remoteDomain string) (*streamConfig, error) {
-	var ret *streamConfig
-	var err error
-	isSCIONAddress, remote := rainsLookup(remoteDomain)
-	if isSCIONAddress {
-		ret, err = d.dialQUIC(remote, localDomain, remoteDomain)
-	} else {
-		ret, err = d.dialTCP(localDomain, remoteDomain)
-	}
+// XEP-0368: SRV records for XMPP over TLS
+func (d *dialer) dialDirectTLS(address, localDomain, remoteDomain string) (*streamConfig, error) {
+	conn, err := d.dialTimeout("tcp", address, d.cfg.DialTimeout)
 	if err != nil {
 		return nil, err
 	}
-	return ret, nil
+	tlsConn := tls.Client(conn, &tls.Config{
+		ServerName:   remoteDomain,
+		Certificates: d.router.Certificates(),
+		RootCAs:      d.cfg.RootCAs,
+		NextProtos:   []string{directTLSProtocol},
+	})
+	_ = conn.SetDeadline(time.Now().Add(d.cfg.DialTimeout))
+	if err := tlsConn.Handshake(); err != nil {
+		_ = conn.Close()
+		return nil, err
+	}
+	_ = conn.SetDeadline(time.Time{})
+
+	tr := transport.NewSocketTransport(tlsConn, d.cfg.Transport.KeepAlive)
+	return &streamConfig{
+		keyGen:        &keyGen{secret: d.cfg.DialbackSecret},
+		localDomain:   localDomain,
+		remoteDomain:  remoteDomain,
+		transport:     tr,
+		directTLS:     true,
+		maxStanzaSize: d.cfg.MaxStanzaSize,
+	}, nil
 }
 
-func rainsLookup(remoteDomain string) (bool, *snet.Addr) {
-	host, port, err := net.SplitHostPort(remoteDomain)
+func (d *dialer) dialTCP(address, localDomain, remoteDomain string) (*streamConfig, error) {
+	conn, err := d.dialTimeout("tcp", address, d.cfg.DialTimeout)
 	if err != nil {
-		host = remoteDomain
-		port = "52690"
-	}
-	ia, l3, err := scionutil.GetHostByName(host)
-	if err != nil {
-		return false, nil
+		return nil, err
 	}
-
-	p, err := strconv.ParseUint(port, 10, 16)
-	if err != nil {
-		p = 52690
+	tlsConfig := &tls.Config{
+		ServerName:   remoteDomain,
+		Certificates: d.router.Certificates(),
+		RootCAs:      d.cfg.RootCAs,
 	}
-	l4 := libaddr.NewL4UDPInfo(uint16(p))
-	raddr := &snet.Addr{IA: ia, Host: &libaddr.AppAddr{L3: l3, L4: l4}}
-
-	return true, raddr
+	tr := transport.NewSocketTransport(conn, d.cfg.Transport.KeepAlive)
+	return &streamConfig{
+		keyGen:        &keyGen{secret: d.cfg.DialbackSecret},
+		localDomain:   localDomain,
+		remoteDomain:  remoteDomain,
+		transport:     tr,
+		tls:           tlsConfig,
+		maxStanzaSize: d.cfg.MaxStanzaSize,
+	}, nil
 }
@@ -6,11 +6,17 @@
 package s2s
 
 import (
+	"crypto/tls"
+	"crypto/x509"
 	"errors"
 	"net"
+	"sync"
 	"testing"
 	"time"
 
+	"github.com/lucas-clemente/quic-go"
+	"github.com/ortuman/jackal/transport"
+	"github.com/scionproto/scion/go/lib/snet"
 	"github.com/stretchr/testify/require"
 )
 
@@ -26,37 +32,387 @@ func TestS2SDial(t *testing.T) {
 			KeepAlive: time.Duration(600) * time.Second,
 		},
 	}
-
-	// not enabled
 	d := newDialer(cfg, r)
 
-	// resolver error...
+	// resolver error... fall back to domain address
 	mockedErr := errors.New("dialer mocked error")
-	d.srvResolve = func(_, _, _ string) (cname string, addrs []*net.SRV, err error) {
+	d.resolver = newResolver(cfg, func(_, _, _ string) (cname string, addrs []*net.SRV, err error) {
 		return "", nil, mockedErr
+	})
+	var dialed []string
+	d.dialTimeout = func(_, address string, _ time.Duration) (net.Conn, error) {
+		dialed = append(dialed, address)
+		return newFakeSocketConn(), nil
 	}
 	out, err := d.dial("jackal.im", "jabber.org")
 	require.NotNil(t, out)
 	require.Nil(t, err)
+	require.Equal(t, []string{"jabber.org:5269"}, dialed)
+
+	// dialer error... every target is tried
+	d.resolver = newResolver(cfg, tUtilSRVLookup(map[string][]*net.SRV{
+		"xmpp-server": {{Target: "xmpp1.jabber.org.", Port: 5269, Priority: 10}, {Target: "xmpp2.jabber.org.", Port: 5269, Priority: 20}},
+	}))
+	dialed = nil
+	d.dialTimeout = func(_, address string, _ time.Duration) (net.Conn, error) {
+		dialed = append(dialed, address)
+		return nil, mockedErr
+	}
+	out, err = d.dial("jackal.im", "jabber.org")
+	require.Nil(t, out)
+	require.Equal(t, mockedErr, err)
+	require.Equal(t, []string{"xmpp1.jabber.org:5269", "xmpp2.jabber.org:5269"}, dialed)
+
+	// success after failing over to second target
+	dialed = nil
+	d.dialTimeout = func(_, address string, _ time.Duration) (net.Conn, error) {
+		dialed = append(dialed, address)
+		if len(dialed) == 1 {
+			return nil, mockedErr
+		}
+		return newFakeSocketConn(), nil
+	}
+	out, err = d.dial("jackal.im", "jabber.org")
+	require.NotNil(t, out)
+	require.Nil(t, err)
+	require.Equal(t, []string{"xmpp1.jabber.org:5269", "xmpp2.jabber.org:5269"}, dialed)
+	require.NotNil(t, out.tls)
+}
+
+func TestS2SDialSCIONFailover(t *testing.T) {
+	r, _, shutdown := setupTest(jackaDomain)
+	defer shutdown()
+
+	cfg := &Config{
+		DialTimeout:   time.Second * time.Duration(5),
+		MaxStanzaSize: 8192,
+		Resolver: ResolverConfig{
+			Hosts: map[string][]string{"jabber.org": {"1-ff00:0:110,[127.0.0.1]:52690", "127.0.0.1:5269"}},
+		},
+	}
+	d := newDialer(cfg, r)
+	d.resolver = newResolver(cfg, tUtilSRVLookup(nil))
+
+	var dialed []string
+	d.dialTimeout = func(_, address string, _ time.Duration) (net.Conn, error) {
+		dialed = append(dialed, address)
+		return newFakeSocketConn(), nil
+	}
+	// SCION transport not available... fall back to TCP
+	out, err := d.dial("jackal.im", "jabber.org")
+	require.Nil(t, err)
+	require.False(t, out.scion)
+	require.Equal(t, transport.Socket, out.transport.Type())
+	require.Equal(t, []string{"127.0.0.1:5269"}, dialed)
+}
+
+func TestS2SDialSCIONPaths(t *testing.T) {
+	r, _, shutdown := setupTest(jackaDomain)
+	defer shutdown()
+
+	cfg := &Config{
+		DialTimeout:   time.Second * time.Duration(5),
+		MaxStanzaSize: 8192,
+		Scion:         &ScionConfig{Address: "1-ff00:0:110,[127.0.0.1]"},
+		Resolver: ResolverConfig{
+			Hosts: map[string][]string{
+				"jabber.org":  {"1-ff00:0:112,[127.0.0.2]:52690"},
+				"example.org": {"1-ff00:0:112,[127.0.0.2]:52690"},
+			},
+		},
+	}
+	ln := newFakeQUICListener()
+	defer ln.Close()
+
+	p1 := tUtilSCIONPath(t, "p1", 1472, "1-ff00:0:110", "1-ff00:0:112")
+	p2 := tUtilSCIONPath(t, "p2", 1472, "1-ff00:0:110", "1-ff00:0:111", "1-ff00:0:112")
+	p3 := tUtilSCIONPath(t, "p3", 1472, "1-ff00:0:110", "2-ff00:0:210", "1-ff00:0:112")
 
-	// dialer error...
-	d.srvResolve = func(service, proto, name string) (cname string, addrs []*net.SRV, err error) {
-		return "", []*net.SRV{{Target: "xmpp.jabber.org", Port: 5269}}, nil
+	d := newDialer(cfg, r)
+	d.resolver = newResolver(cfg, tUtilSRVLookup(nil))
+	d.scionInit = func(_ *snet.Addr) error { return nil }
+	d.paths = newPathSelector(&fakePathProvider{list: []*scionPath{p1, p2, p3}}, map[string]PathPolicy{
+		"jabber.org":  {Deny: tUtilIAs(t, "2-0")},
+		"example.org": {Deny: tUtilIAs(t, "1-ff00:0:111")},
+	})
+	mockedErr := errors.New("dialer mocked error")
+	var dialed []string
+	d.scionDial = func(local, remote *snet.Addr, _ *quic.Config) (quic.Session, error) {
+		require.Equal(t, "1-ff00:0:112", remote.IA.String())
+		dialed = append(dialed, remote.IA.String())
+		if len(dialed) == 1 {
+			return nil, mockedErr // first path is broken
+		}
+		return ln.dial(), nil
 	}
 	d.dialTimeout = func(_, _ string, _ time.Duration) (net.Conn, error) {
 		return nil, mockedErr
 	}
+	out, err := d.dial("jackal.im", "jabber.org")
+	require.Nil(t, err)
+	require.True(t, out.scion)
+	require.Equal(t, transport.QUIC, out.transport.Type())
+	require.Len(t, dialed, 2)
+	<-ln.sessCh
+
+	// session path is not allowed by remote domain policy... dial a new one
+	out2, err := d.dial("jackal.im", "example.org")
+	require.Nil(t, err)
+	require.Len(t, dialed, 3)
+	<-ln.sessCh
+
+	// session path is allowed... share it
+	out3, err := d.dial("jackal.net", "jabber.org")
+	require.Nil(t, err)
+	require.Len(t, dialed, 3)
+	_ = out2.transport.Close()
+	_ = out3.transport.Close()
+
+	// broken path is tried last from now on
+	paths, err := d.paths.selectPaths("jabber.org", p1.ases[0], p1.ases[1])
+	require.Nil(t, err)
+	require.Equal(t, []string{"p2", "p1"}, tUtilPathKeys(paths))
+
+	// every allowed path fails... fall back to TCP endpoints
+	_ = out.transport.Close()
+	d.scionDial = func(_, _ *snet.Addr, _ *quic.Config) (quic.Session, error) {
+		return nil, mockedErr
+	}
+	_, err = d.dial("jackal.im", "jabber.org")
+	require.Equal(t, mockedErr, err)
+}
+
+func TestS2SDialSCIONPathFailure(t *testing.T) {
+	r, _, shutdown := setupTest(jackaDomain)
+	defer shutdown()
+
+	cfg := &Config{
+		DialTimeout:   time.Second * time.Duration(5),
+		MaxStanzaSize: 8192,
+		Scion:         &ScionConfig{Address: "1-ff00:0:110,[127.0.0.1]"},
+		Resolver: ResolverConfig{
+			Hosts: map[string][]string{
+				"jabber.org": {"1-ff00:0:112,[127.0.0.2]:52690"},
+			},
+		},
+	}
+	p1 := tUtilSCIONPath(t, "p1", 1472, "1-ff00:0:110", "1-ff00:0:112")
+	p2 := tUtilSCIONPath(t, "p2", 1472, "1-ff00:0:110", "1-ff00:0:111", "1-ff00:0:112")
+
+	d := newDialer(cfg, r)
+	d.resolver = newResolver(cfg, tUtilSRVLookup(nil))
+	d.scionInit = func(_ *snet.Addr) error { return nil }
+	d.paths = newPathSelector(&fakePathProvider{list: []*scionPath{p1, p2}}, nil)
+
+	var mu sync.Mutex
+	var sessions []*fakeQUICSession
+	d.scionDial = func(_, _ *snet.Addr, _ *quic.Config) (quic.Session, error) {
+		mu.Lock()
+		defer mu.Unlock()
+		cli, _ := newFakeQUICSessionPair()
+		sessions = append(sessions, cli)
+		return cli, nil
+	}
+	out, err := d.dial("jackal.im", "jabber.org")
+	require.Nil(t, err)
+	require.True(t, out.scion)
+
+	// established session is lost... its path gets marked as down
+	mu.Lock()
+	sessions[0].closeWithError(errors.New("no recent network activity"))
+	mu.Unlock()
+	tUtilWaitFor(t, func() bool {
+		paths, _ := d.paths.selectPaths("jabber.org", p1.ases[0], p1.ases[1])
+		return len(paths) == 2 && paths[0].key == "p2"
+	})
+	defer out.transport.Close()
+
+	// broken session is not shared anymore... re-dial through alternate path
+	out2, err := d.dial("jackal.net", "jabber.org")
+	require.Nil(t, err)
+	defer out2.transport.Close()
+
+	mu.Lock()
+	require.Len(t, sessions, 2)
+	mu.Unlock()
+}
+
+func TestS2SDialDirectTLS(t *testing.T) {
+	r, _, shutdown := setupTest(jackaDomain)
+	defer shutdown()
+
+	ca, caKey := tUtilGenerateCA(t)
+	cert, key := tUtilGenerateCert(t, ca, caKey, []string{"jabber.org"}, "")
+
+	ln, err := tls.Listen("tcp", "127.0.0.1:0", &tls.Config{
+		Certificates: []tls.Certificate{{Certificate: [][]byte{cert.Raw}, PrivateKey: key}},
+		NextProtos:   []string{directTLSProtocol},
+	})
+	require.Nil(t, err)
+	defer ln.Close()
+
+	go func() {
+		conn, err := ln.Accept()
+		if err != nil {
+			return
+		}
+		_ = conn.(*tls.Conn).Handshake()
+	}()
+	rootCAs := x509.NewCertPool()
+	rootCAs.AddCert(ca)
+
+	cfg := &Config{
+		DialTimeout:   time.Second * time.Duration(5),
+		MaxStanzaSize: 8192,
+		RootCAs:       rootCAs,
+	}
+	port := uint16(ln.Addr().(*net.TCPAddr).Port)
+
+	d := newDialer(cfg, r)
+	d.resolver = newResolver(cfg, tUtilSRVLookup(map[string][]*net.SRV{
+		"xmpps-server": {{Target: "127.0.0.1.", Port: port}},
+	}))
+	out, err := d.dial("jackal.im", "jabber.org")
+	require.Nil(t, err)
+	require.NotNil(t, out)
+	require.True(t, out.directTLS)
+	require.Nil(t, out.tls)
+	_ = out.transport.Close()
+
+	// untrusted certificate... fall back to xmpp-server
+	mockedErr := errors.New("dialer mocked error")
+	d.cfg.RootCAs = x509.NewCertPool()
+	d.resolver = newResolver(cfg, tUtilSRVLookup(map[string][]*net.SRV{
+		"xmpps-server": {{Target: "127.0.0.1.", Port: port}},
+		"xmpp-server":  {{Target: "127.0.0.1.", Port: port}},
+	}))
+	var dialed []string
+	d.dialTimeout = func(network, address string, timeout time.Duration) (net.Conn, error) {
+		dialed = append(dialed, address)
+		if len(dialed) == 1 {
+			return net.DialTimeout(network, address, timeout)
+		}
+		return nil, mockedErr
+	}
+	go func() {
+		conn, err := ln.Accept()
+		if err != nil {
+			return
+		}
+		_ = conn.(*tls.Conn).Handshake()
+	}()
 	out, err = d.dial("jackal.im", "jabber.org")
 	require.Nil(t, out)
 	require.Equal(t, mockedErr, err)
+	require.Len(t, dialed, 2)
+}
+
+func TestS2SDialQUIC(t *testing.T) {
+	r, _, shutdown := setupTest(jackaDomain)
+	defer shutdown()
 
-	// success
+	cfg := &Config{
+		DialTimeout:   time.Second * time.Duration(5),
+		MaxStanzaSize: 8192,
+		QUIC: &QUICConfig{
+			KeepAlive:  time.Duration(600) * time.Second,
+			SRVService: defaultQUICSRVService,
+		},
+	}
+	ca, caKey := tUtilGenerateCA(t)
+	cfg.RootCAs = x509.NewCertPool()
+	cfg.RootCAs.AddCert(ca)
+	cert, _ := tUtilGenerateCert(t, ca, caKey, []string{"jabber.org"}, "")
+
+	ln := newFakeQUICListener()
+	ln.peerCerts = []*x509.Certificate{cert}
+	defer ln.Close()
+
+	d := newDialer(cfg, r)
+	var dialed []string
+	d.quicDial = func(addr string, tlsConf *tls.Config, config *quic.Config) (quic.Session, error) {
+		require.Equal(t, "jabber.org", tlsConf.ServerName)
+		require.Equal(t, []string{directTLSProtocol}, tlsConf.NextProtos)
+		dialed = append(dialed, addr)
+		return ln.dial(), nil
+	}
+	d.resolver = newResolver(cfg, tUtilSRVLookup(map[string][]*net.SRV{
+		defaultQUICSRVService: {{Target: "quic.jabber.org.", Port: 5269}},
+	}))
+	out, err := d.dial("jackal.im", "jabber.org")
+	require.Nil(t, err)
+	require.True(t, out.directTLS)
+	require.Equal(t, transport.QUIC, out.transport.Type())
+	require.Equal(t, []string{"quic.jabber.org:5269"}, dialed)
+	<-ln.sessCh
+
+	// static peer...
+	cfg.QUIC.Peers = map[string]string{"jabber.org": "127.0.0.1:5271"}
+	d.resolver = newResolver(cfg, tUtilSRVLookup(nil))
+	out, err = d.dial("jackal.im", "jabber.org")
+	require.Nil(t, err)
+	require.Equal(t, "127.0.0.1:5271", dialed[1])
+	<-ln.sessCh
+
+	// session is shared among domain pairs...
+	out2, err := d.dial("jackal.net", "jabber.org")
+	require.Nil(t, err)
+	require.Len(t, dialed, 2)
+
+	// ...as long as peer certificate is valid for remote domain
+	cfg.QUIC.Peers["example.org"] = "127.0.0.1:5271"
+	d.resolver = newResolver(cfg, tUtilSRVLookup(nil))
+	d.quicDial = func(addr string, tlsConf *tls.Config, config *quic.Config) (quic.Session, error) {
+		require.Equal(t, "example.org", tlsConf.ServerName)
+		dialed = append(dialed, addr)
+		return ln.dial(), nil
+	}
+	out3, err := d.dial("jackal.im", "example.org")
+	require.Nil(t, err)
+	require.Len(t, dialed, 3)
+	<-ln.sessCh
+	_ = out.transport.Close()
+	_ = out2.transport.Close()
+	_ = out3.transport.Close()
+
+	// no QUIC service... fall back to TCP
+	cfg.QUIC.Peers = nil
+	mockedErr := errors.New("dialer mocked error")
+	d.resolver = newResolver(cfg, tUtilSRVLookup(nil))
 	d.dialTimeout = func(_, _ string, _ time.Duration) (net.Conn, error) {
 		return newFakeSocketConn(), nil
 	}
 	out, err = d.dial("jackal.im", "jabber.org")
-	require.NotNil(t, out)
 	require.Nil(t, err)
+	require.Equal(t, transport.Socket, out.transport.Type())
+	require.Len(t, dialed, 3)
+
+	// QUIC dial error... fall back to TCP
+	cfg.QUIC.Peers = map[string]string{"jabber.org": "127.0.0.1:5271"}
+	d.resolver = newResolver(cfg, tUtilSRVLookup(nil))
+	d.quicDial = func(addr string, tlsConf *tls.Config, config *quic.Config) (quic.Session, error) {
+		return nil, mockedErr
+	}
+	out, err = d.dial("jackal.im", "jabber.org")
+	require.Nil(t, err)
+	require.Equal(t, transport.Socket, out.transport.Type())
+}
+
+// fakeResolver resolves any domain to the same set of endpoints.
+type fakeResolver []endpoint
+
+func (r fakeResolver) resolve(_ string) ([]endpoint, error) { return r, nil }
+
+// tUtilSRVLookup returns an SRV lookup function answering
+// with the given records per service name.
+func tUtilSRVLookup(records map[string][]*net.SRV) srvLookupFunc {
+	return func(service, _, name string) (string, []*net.SRV, error) {
+		addrs, ok := records[service]
+		if !ok {
+			return "", nil, &net.DNSError{Err: "no such host", Name: name}
+		}
+		return "", addrs, nil
+	}
 }
 
 // TODO (mmalesev): Once there is a stable xmpp server deployed (RAINS resolvable), add UTs
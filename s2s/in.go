@@ -13,6 +13,7 @@ import (
 
 	streamerror "github.com/ortuman/jackal/errors"
 	"github.com/ortuman/jackal/log"
+	"github.com/ortuman/jackal/metrics"
 	"github.com/ortuman/jackal/module"
 	"github.com/ortuman/jackal/router"
 	"github.com/ortuman/jackal/runqueue"
@@ -36,9 +37,11 @@ type inStream struct {
 	remoteDomain  string
 	state         uint32
 	connectTm     *time.Timer
+	whitespaceTm  *time.Timer
 	sess          *session.Session
 	secured       uint32
 	authenticated uint32
+	metricsDomain string // authenticated domain the stream is accounted to
 	runQueue      *runqueue.RunQueue
 }
 
@@ -56,6 +59,8 @@ func newInStream(config *streamConfig, mods *module.Modules, router *router.Rout
 	if alreadySecuredAndAuthd {
 		s.secured = 1
 		s.authenticated = 1
+	} else if config.directTLS {
+		s.secured = 1
 	}
 	// start s2s in session
 	s.restartSession()
@@ -63,6 +68,9 @@ func newInStream(config *streamConfig, mods *module.Modules, router *router.Rout
 	if config.connectTimeout > 0 {
 		s.connectTm = time.AfterFunc(config.connectTimeout, s.connectTimeout)
 	}
+	if config.whitespace > 0 {
+		s.scheduleWhitespace()
+	}
 	go s.doRead() // start reading transport...
 	return s
 }
@@ -87,6 +95,23 @@ func (s *inStream) connectTimeout() {
 	s.runQueue.Run(func() { s.disconnect(streamerror.ErrConnectionTimeout) })
 }
 
+func (s *inStream) scheduleWhitespace() {
+	s.whitespaceTm = time.AfterFunc(s.cfg.whitespace, func() {
+		s.runQueue.Run(s.sendWhitespace)
+	})
+}
+
+func (s *inStream) sendWhitespace() {
+	if s.getState() == inDisconnected {
+		return
+	}
+	if s.getState() == inConnected && s.isAuthenticated() {
+		_, _ = s.cfg.transport.WriteString(" ")
+		_ = s.cfg.transport.Flush()
+	}
+	s.scheduleWhitespace()
+}
+
 // runs on its own goroutine
 func (s *inStream) doRead() {
 	if elem, sErr := s.sess.Receive(); sErr == nil {
@@ -121,6 +146,9 @@ func (s *inStream) handleConnecting(elem xmpp.XElement) {
 	// assign domain pair
 	s.localDomain = elem.To()
 	s.remoteDomain = elem.From()
+	if s.isAuthenticated() {
+		s.countStream(s.remoteDomain)
+	}
 
 	// open stream session
 	s.sess.SetRemoteDomain(s.remoteDomain)
@@ -141,20 +169,33 @@ func (s *inStream) handleConnecting(elem xmpp.XElement) {
 		return
 	}
 
-	_ = s.sess.Open(nil)
-
+	tlsAuthRequired := s.cfg.isTLSAuthRequired(s.remoteDomain)
 	if !s.isAuthenticated() {
-		// offer external authentication
-		mechanisms := xmpp.NewElementName("mechanisms")
-		mechanisms.SetNamespace(saslNamespace)
-		extMech := xmpp.NewElementName("mechanism")
-		extMech.SetText("EXTERNAL")
-		mechanisms.AppendElement(extMech)
-		features.AppendElement(mechanisms)
-	}
-	dbBack := xmpp.NewElementNamespace("dialback", dialbackNamespace)
-	dbBack.AppendElement(xmpp.NewElementName("errors"))
-	features.AppendElement(dbBack)
+		err := s.verifyPeerCertificate()
+		if err != nil && tlsAuthRequired {
+			log.Infof("s2s in stream rejected... (domain: %s, reason: %v)", s.remoteDomain, err)
+			s.disconnectWithStreamError(streamerror.ErrPolicyViolation)
+			return
+		}
+		_ = s.sess.Open(nil)
+
+		if err == nil {
+			// offer external authentication
+			mechanisms := xmpp.NewElementName("mechanisms")
+			mechanisms.SetNamespace(saslNamespace)
+			extMech := xmpp.NewElementName("mechanism")
+			extMech.SetText("EXTERNAL")
+			mechanisms.AppendElement(extMech)
+			features.AppendElement(mechanisms)
+		}
+	} else {
+		_ = s.sess.Open(nil)
+	}
+	if !tlsAuthRequired {
+		dbBack := xmpp.NewElementNamespace("dialback", dialbackNamespace)
+		dbBack.AppendElement(xmpp.NewElementName("errors"))
+		features.AppendElement(dbBack)
+	}
 
 	s.setState(inConnected)
 	s.writeElement(features)
@@ -171,6 +212,11 @@ func (s *inStream) handleConnected(elem xmpp.XElement) {
 	}
 	switch elem.Name() {
 	case "db:result":
+		if !s.isAuthenticated() && s.cfg.isTLSAuthRequired(elem.From()) {
+			// dialback not allowed for this domain
+			s.disconnectWithStreamError(streamerror.ErrPolicyViolation)
+			return
+		}
 		s.authorizeDialbackKey(elem)
 
 	case "db:verify":
@@ -201,6 +247,9 @@ func (s *inStream) processPresence(presence *xmpp.Presence) {
 		if r := s.mods.Roster; r != nil {
 			s.mods.Roster.ProcessPresence(presence)
 		}
+		if pep := s.mods.Pep; pep != nil {
+			pep.ProcessPresence(presence)
+		}
 		return
 	}
 	_ = s.router.Route(presence)
@@ -209,6 +258,17 @@ func (s *inStream) processPresence(presence *xmpp.Presence) {
 func (s *inStream) processIQ(iq *xmpp.IQ) {
 	toJID := iq.ToJID()
 
+	if toJID.IsServer() && s.router.IsLocalHost(toJID.Domain()) {
+		// XEP-0199: server to server ping
+		if iq.IsGet() && iq.Elements().ChildNamespace("ping", pingNamespace) != nil {
+			_ = s.router.Route(iq.ResultIQ())
+			return
+		}
+		if (iq.IsResult() || iq.Type() == xmpp.ErrorType) && s.cfg.onPong != nil && s.cfg.onPong(iq) {
+			return
+		}
+	}
+
 	replyOnBehalf := !toJID.IsFullWithUser() && s.router.IsLocalHost(toJID.Domain())
 	if !replyOnBehalf {
 		switch s.router.Route(iq) {
@@ -228,26 +288,8 @@ func (s *inStream) processIQ(iq *xmpp.IQ) {
 }
 
 func (s *inStream) processMessage(message *xmpp.Message) {
-	msg := message
-
-sendMessage:
-	err := s.router.Route(msg)
-	switch err {
-	case nil:
-		break
-	case router.ErrResourceNotFound:
-		// treat the stanza as if it were addressed to <node@domain>
-		msg, _ = xmpp.NewMessageFromElement(msg, msg.FromJID(), msg.ToJID().ToBareJID())
-		goto sendMessage
-	case router.ErrNotAuthenticated:
-		if off := s.mods.Offline; off != nil {
-			off.ArchiveMessage(message)
-			return
-		}
-	default:
-		// silently ignore it...
-		break
-	}
+	// silently ignore delivery errors...
+	_ = s.mods.RouteMessage(message)
 }
 
 func (s *inStream) proceedStartTLS(elem xmpp.XElement) {
@@ -261,9 +303,11 @@ func (s *inStream) proceedStartTLS(elem xmpp.XElement) {
 	}
 	s.writeElement(xmpp.NewElementNamespace("proceed", tlsNamespace))
 
+	// peer certificate gets validated afterwards, so that dialback
+	// can still be used if it cannot be authenticated.
 	s.cfg.transport.StartTLS(&tls.Config{
 		ServerName:   s.localDomain,
-		ClientAuth:   tls.VerifyClientCertIfGiven,
+		ClientAuth:   tls.RequestClientCert,
 		Certificates: s.router.Certificates(),
 	}, false)
 	atomic.StoreUint32(&s.secured, 1)
@@ -282,27 +326,36 @@ func (s *inStream) startAuthentication(elem xmpp.XElement) {
 		return
 	}
 	// validate initiating server certificate
-	certs := s.cfg.transport.PeerCertificates()
-	for _, cert := range certs {
-		for _, dnsName := range cert.DNSNames {
-			if dnsName == s.remoteDomain {
-				s.finishAuthentication()
-				return
-			}
-		}
+	if err := s.verifyPeerCertificate(); err != nil {
+		s.failAuthentication("not-authorized", err.Error())
+		return
 	}
-	s.failAuthentication("bad-protocol", "failed to get peer certificate")
+	s.finishAuthentication()
+}
+
+func (s *inStream) verifyPeerCertificate() error {
+	return verifyPeerCertificate(s.cfg.transport.PeerCertificates(), s.cfg.rootCAs, s.remoteDomain)
 }
 
 func (s *inStream) finishAuthentication() {
 	log.Infof("s2s in stream authenticated")
 	atomic.StoreUint32(&s.authenticated, 1)
+	s.countStream(s.remoteDomain)
 
 	success := xmpp.NewElementNamespace("success", saslNamespace)
 	s.writeElement(success)
 	s.restartSession()
 }
 
+// countStream accounts the stream to its first authenticated remote domain.
+func (s *inStream) countStream(domain string) {
+	if len(s.metricsDomain) > 0 {
+		return
+	}
+	s.metricsDomain = domain
+	metrics.S2SStreams.WithLabelValues("in", domain).Inc()
+}
+
 func (s *inStream) failAuthentication(reason, text string) {
 	log.Infof("failed s2s in stream authentication: %s (text: %s)", reason, text)
 	failure := xmpp.NewElementNamespace("failure", saslNamespace)
@@ -336,8 +389,7 @@ func (s *inStream) authorizeDialbackKey(elem xmpp.XElement) {
 	dbVerify.SetText(elem.Text())
 	outCfg.dbVerify = dbVerify
 
-	isScionAddress, _ := rainsLookup(elem.From())
-	outStm := newOutStream(s.router, isScionAddress)
+	outStm := newOutStream(s.router)
 	_ = outStm.start(outCfg)
 
 	// wait remote server verification
@@ -349,6 +401,7 @@ func (s *inStream) authorizeDialbackKey(elem xmpp.XElement) {
 		if valid {
 			reply.SetType("valid")
 			atomic.StoreUint32(&s.authenticated, 1)
+			s.countStream(elem.From())
 
 		} else {
 			reply.SetType("invalid")
@@ -452,6 +505,12 @@ func (s *inStream) disconnectClosingSession(closeSession bool) {
 	if s.cfg.onInDisconnect != nil {
 		s.cfg.onInDisconnect(s)
 	}
+	if s.whitespaceTm != nil {
+		s.whitespaceTm.Stop()
+	}
+	if len(s.metricsDomain) > 0 {
+		metrics.S2SStreams.WithLabelValues("in", s.metricsDomain).Dec()
+	}
 
 	s.setState(inDisconnected)
 	_ = s.cfg.transport.Close()
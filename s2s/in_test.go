@@ -13,6 +13,7 @@ import (
 	"testing"
 	"time"
 
+	"github.com/ortuman/jackal/metrics"
 	"github.com/ortuman/jackal/module"
 	"github.com/ortuman/jackal/module/offline"
 	"github.com/ortuman/jackal/module/xep0077"
@@ -25,6 +26,7 @@ import (
 	"github.com/ortuman/jackal/xmpp"
 	"github.com/ortuman/jackal/xmpp/jid"
 	"github.com/pborman/uuid"
+	"github.com/prometheus/client_golang/prometheus/testutil"
 	"github.com/stretchr/testify/require"
 )
 
@@ -65,7 +67,7 @@ func TestStream_Features(t *testing.T) {
 	require.Equal(t, inConnected, stm.getState())
 
 	// secured features
-	stm, conn = tUtilInStreamInit(t, r, false)
+	stm, conn = tUtilInStreamInit(t, r, true)
 	atomic.StoreUint32(&stm.secured, 1)
 	tUtilInStreamOpen(conn)
 
@@ -77,6 +79,46 @@ func TestStream_Features(t *testing.T) {
 	require.NotNil(t, elem.Elements().ChildNamespace("dialback", dialbackNamespace))
 	require.Equal(t, inConnected, stm.getState())
 
+	// secured features (no valid peer certificate)
+	stm, conn = tUtilInStreamInit(t, r, false)
+	atomic.StoreUint32(&stm.secured, 1)
+	tUtilInStreamOpen(conn)
+
+	elem = conn.outboundRead()
+	require.Equal(t, "stream:stream", elem.Name())
+
+	elem = conn.outboundRead()
+	require.Nil(t, elem.Elements().ChildNamespace("mechanisms", saslNamespace))
+	require.NotNil(t, elem.Elements().ChildNamespace("dialback", dialbackNamespace))
+
+	// secured features (TLS authentication required)
+	cfg, conn := tUtilInStreamDefaultConfig(t, true)
+	cfg.requireTLSAuth = []string{"localhost"}
+	stm = newInStream(cfg, &module.Modules{}, r, false)
+	atomic.StoreUint32(&stm.secured, 1)
+	tUtilInStreamOpen(conn)
+
+	elem = conn.outboundRead()
+	require.Equal(t, "stream:stream", elem.Name())
+
+	elem = conn.outboundRead()
+	require.NotNil(t, elem.Elements().ChildNamespace("mechanisms", saslNamespace))
+	require.Nil(t, elem.Elements().ChildNamespace("dialback", dialbackNamespace))
+
+	// dialback is not allowed...
+	conn.inboundWriteString(`<db:result from="localhost" to="jackal.im">abcd</db:result>`)
+	require.True(t, conn.waitClose())
+
+	// secured features (TLS authentication required, no valid peer certificate)
+	cfg, conn = tUtilInStreamDefaultConfig(t, false)
+	cfg.requireTLSAuth = []string{"localhost"}
+	stm = newInStream(cfg, &module.Modules{}, r, false)
+	atomic.StoreUint32(&stm.secured, 1)
+	tUtilInStreamOpen(conn)
+
+	require.True(t, conn.waitClose())
+	require.Equal(t, inDisconnected, stm.getState())
+
 	// secured features (authenticated)
 	stm, conn = tUtilInStreamInit(t, r, false)
 	atomic.StoreUint32(&stm.secured, 1)
@@ -173,11 +215,19 @@ func TestStream_Authenticate(t *testing.T) {
 	require.Equal(t, "failure", elem.Name())
 	require.Equal(t, saslNamespace, elem.Namespace())
 
+	// unauthenticated streams are not accounted
+	gauge := metrics.S2SStreams.WithLabelValues("in", "localhost")
+	streams := testutil.ToFloat64(gauge)
+
 	// valid auth...
 	conn.inboundWriteString(`<auth xmlns="urn:ietf:params:xml:ns:xmpp-sasl" mechanism="EXTERNAL">=</auth>`)
 	elem = conn.outboundRead()
 	require.Equal(t, "success", elem.Name())
 	require.Equal(t, saslNamespace, elem.Namespace())
+	require.Equal(t, streams+1, testutil.ToFloat64(gauge))
+
+	stm.Disconnect(nil)
+	require.Equal(t, streams, testutil.ToFloat64(gauge))
 }
 
 func TestStream_DialbackVerify(t *testing.T) {
@@ -233,9 +283,7 @@ func TestStream_DialbackAuthorize(t *testing.T) {
 
 	cfg, conn := tUtilInStreamDefaultConfig(t, false)
 	cfg.dialer = &dialer{cfg: &Config{DialTimeout: time.Second}, router: r}
-	cfg.dialer.srvResolve = func(_, _, _ string) (cname string, addrs []*net.SRV, err error) {
-		return "", []*net.SRV{{Target: "jackal.im", Port: 5269}}, nil
-	}
+	cfg.dialer.resolver = fakeResolver{{typ: tcpEndpoint, address: "jackal.im:5269"}}
 	outConn := newFakeSocketConn()
 	cfg.dialer.dialTimeout = func(_, _ string, _ time.Duration) (net.Conn, error) {
 		return outConn, nil
@@ -259,9 +307,7 @@ func TestStream_DialbackAuthorize(t *testing.T) {
 	// authorize dialback key
 	cfg, conn = tUtilInStreamDefaultConfig(t, false)
 	cfg.dialer = &dialer{cfg: &Config{DialTimeout: time.Second}, router: r}
-	cfg.dialer.srvResolve = func(_, _, _ string) (cname string, addrs []*net.SRV, err error) {
-		return "", []*net.SRV{{Target: "jackal.im", Port: 5269}}, nil
-	}
+	cfg.dialer.resolver = fakeResolver{{typ: tcpEndpoint, address: "jackal.im:5269"}}
 	outConn = newFakeSocketConn()
 	cfg.dialer.dialTimeout = func(_, _ string, _ time.Duration) (net.Conn, error) {
 		return outConn, nil
@@ -350,6 +396,49 @@ func TestStream_SendElement(t *testing.T) {
 	require.True(t, conn.waitClose())
 }
 
+func TestStream_Ping(t *testing.T) {
+	r, _, shutdown := setupTest(jackaDomain)
+	defer shutdown()
+
+	out := &fakeRoutedOut{elemCh: make(chan xmpp.XElement, 1)}
+	r.SetOutS2SProvider(out)
+
+	cfg, conn := tUtilInStreamDefaultConfig(t, false)
+	pongCh := make(chan string, 1)
+	cfg.onPong = func(iq *xmpp.IQ) bool {
+		pongCh <- iq.ID()
+		return true
+	}
+	stm := newInStream(cfg, &module.Modules{}, r, false)
+	tUtilInStreamOpen(conn)
+	_ = conn.outboundRead() // read stream opening...
+	_ = conn.outboundRead() // read stream features...
+	atomic.StoreUint32(&stm.secured, 1)
+	atomic.StoreUint32(&stm.authenticated, 1)
+
+	// remote server ping...
+	iqID := uuid.New()
+	conn.inboundWriteString(`<iq type="get" id="` + iqID + `" from="localhost" to="jackal.im"><ping xmlns="urn:xmpp:ping"/></iq>`)
+	select {
+	case elem := <-out.elemCh:
+		require.Equal(t, xmpp.ResultType, elem.Type())
+		require.Equal(t, iqID, elem.ID())
+		require.Equal(t, "jackal.im", elem.From())
+		require.Equal(t, "localhost", elem.To())
+	case <-time.After(time.Second):
+		require.Fail(t, "expecting ping reply")
+	}
+
+	// ...and reply to an outgoing stream ping
+	conn.inboundWriteString(`<iq type="result" id="abcd" from="localhost" to="jackal.im"/>`)
+	select {
+	case id := <-pongCh:
+		require.Equal(t, "abcd", id)
+	case <-time.After(time.Second):
+		require.Fail(t, "expecting pong")
+	}
+}
+
 func tUtilInStreamInit(t *testing.T, router *router.Router, loadPeerCertificate bool) (*inStream, *fakeSocketConn) {
 	cfg, conn := tUtilInStreamDefaultConfig(t, loadPeerCertificate)
 	stm := newInStream(cfg, &module.Modules{}, router, false)
@@ -382,10 +471,13 @@ func tUtilInStreamDefaultConfig(t *testing.T, loadPeerCertificate bool) (*stream
 	require.Nil(t, err)
 
 	var peerCerts []*x509.Certificate
-	if loadPeerCertificate {
-		for _, asn1Data := range cer.Certificate {
-			cr, err := x509.ParseCertificate(asn1Data)
-			require.Nil(t, err)
+	rootCAs := x509.NewCertPool()
+	for _, asn1Data := range cer.Certificate {
+		cr, err := x509.ParseCertificate(asn1Data)
+		require.Nil(t, err)
+		rootCAs.AddCert(cr)
+
+		if loadPeerCertificate {
 			cr.DNSNames = []string{"localhost"}
 			peerCerts = append(peerCerts, cr)
 		}
@@ -404,6 +496,7 @@ func tUtilInStreamDefaultConfig(t *testing.T, loadPeerCertificate bool) (*stream
 		connectTimeout: time.Second,
 		transport:      tr,
 		maxStanzaSize:  8192,
+		rootCAs:        rootCAs,
 		keyGen:         &keyGen{secret: "s3cr3t"},
 	}, conn
 }
@@ -7,17 +7,21 @@ package s2s
 
 import (
 	"fmt"
+	"sync"
 	"sync/atomic"
+	"time"
 
 	"github.com/ortuman/jackal/runqueue"
 
 	streamerror "github.com/ortuman/jackal/errors"
 	"github.com/ortuman/jackal/log"
+	"github.com/ortuman/jackal/metrics"
 	"github.com/ortuman/jackal/router"
 	"github.com/ortuman/jackal/session"
 	"github.com/ortuman/jackal/stream"
 	"github.com/ortuman/jackal/xmpp"
 	"github.com/ortuman/jackal/xmpp/jid"
+	"github.com/pborman/uuid"
 )
 
 const (
@@ -31,6 +35,11 @@ const (
 	outDisconnected
 )
 
+type pendingElement struct {
+	elem xmpp.XElement
+	sent func(ok bool)
+}
+
 type outStream struct {
 	started       uint32
 	id            string
@@ -40,27 +49,34 @@ type outStream struct {
 	sess          *session.Session
 	secured       uint32
 	authenticated uint32
-	sendQueue     []xmpp.XElement
+	dialbackAvail bool
+	sendQueue     []pendingElement
 	verified      chan xmpp.XElement
 	verifyCh      chan bool
+	establishedCh chan struct{}
 	discCh        chan *streamerror.Error
 	runQueue      *runqueue.RunQueue
 	onDisconnect  func(s stream.S2SOut)
+	lastActivity  int64
+	pendingPing   atomic.Value
+	pingTm        *time.Timer
+	whitespaceTm  *time.Timer
+	idleTm        *time.Timer
+	mu            sync.RWMutex
+	idleClosed    bool
 }
 
-func newOutStream(router *router.Router, alreadySecuredAndAuthd bool) *outStream {
+func newOutStream(router *router.Router) *outStream {
 	id := nextOutID()
 	s := &outStream{
-		id:       id,
-		router:   router,
-		verifyCh: make(chan bool, 1),
-		discCh:   make(chan *streamerror.Error, 1),
-		runQueue: runqueue.New(id),
-	}
-	if alreadySecuredAndAuthd {
-		s.secured = 1
-		s.authenticated = 1
+		id:            id,
+		router:        router,
+		verifyCh:      make(chan bool, 1),
+		establishedCh: make(chan struct{}),
+		discCh:        make(chan *streamerror.Error, 1),
+		runQueue:      runqueue.New(id),
 	}
+	s.pendingPing.Store("")
 	return s
 }
 
@@ -69,19 +85,54 @@ func (s *outStream) ID() string {
 }
 
 func (s *outStream) SendElement(elem xmpp.XElement) {
+	s.sendElement(elem, nil)
+}
+
+// sendElement sends an element through the stream. If not nil, sent callback
+// reports whether or not the element has been written to the transport.
+// Elements with a sent callback are never rerouted; it's up to the caller
+// to deliver them again when not sent.
+func (s *outStream) sendElement(elem xmpp.XElement, sent func(ok bool)) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	if s.idleClosed {
+		s.discardElement(elem, sent)
+		return
+	}
 	if s.getState() == outDisconnected {
+		notifySent(sent, false)
 		return
 	}
+	atomic.StoreInt64(&s.lastActivity, time.Now().UnixNano())
+
 	s.runQueue.Run(func() {
-		if s.getState() != outVerified {
+		switch s.getState() {
+		case outVerified:
+			notifySent(sent, s.writeElement(elem) == nil)
+		case outDisconnected:
+			s.discardElement(elem, sent)
+		default:
 			// send element after verification has been completed
-			s.sendQueue = append(s.sendQueue, elem)
-			return
+			s.sendQueue = append(s.sendQueue, pendingElement{elem: elem, sent: sent})
 		}
-		s.writeElement(elem)
 	})
 }
 
+func (s *outStream) discardElement(elem xmpp.XElement, sent func(ok bool)) {
+	switch {
+	case sent != nil:
+		sent(false)
+	case s.idleClosed:
+		s.reroute(elem)
+	}
+}
+
+func notifySent(sent func(ok bool), ok bool) {
+	if sent != nil {
+		sent(ok)
+	}
+}
+
 func (s *outStream) Disconnect(err error) {
 	if s.getState() == outDisconnected {
 		return
@@ -102,6 +153,14 @@ func (s *outStream) start(cfg *streamConfig) error {
 		return fmt.Errorf("stream already started (domainpair: %s)", s.ID())
 	}
 	s.cfg = cfg
+	if cfg.scion {
+		// SCION connections are already secured and authenticated
+		atomic.StoreUint32(&s.secured, 1)
+		atomic.StoreUint32(&s.authenticated, 1)
+	} else if cfg.directTLS {
+		atomic.StoreUint32(&s.secured, 1)
+	}
+	metrics.S2SStreams.WithLabelValues("out", cfg.remoteDomain).Inc()
 
 	// start s2s out session
 	s.restartSession()
@@ -115,6 +174,7 @@ func (s *outStream) start(cfg *streamConfig) error {
 }
 
 func (s *outStream) verify() <-chan bool             { return s.verifyCh }
+func (s *outStream) established() <-chan struct{}    { return s.establishedCh }
 func (s *outStream) done() <-chan *streamerror.Error { return s.discCh }
 
 // runs on its own goroutine
@@ -185,24 +245,17 @@ func (s *outStream) handleConnected(elem xmpp.XElement) {
 					}
 				}
 			}
+			s.dialbackAvail = elem.Elements().ChildrenNamespace("dialback", dialbackNamespace) != nil
+
+			// prefer external authentication over dialback
 			if hasExternalAuth {
 				s.setState(outAuthenticating)
 				auth := xmpp.NewElementNamespace("auth", saslNamespace)
 				auth.SetAttribute("mechanism", "EXTERNAL")
 				auth.SetText("=")
 				s.writeElement(auth)
-
-			} else if elem.Elements().ChildrenNamespace("dialback", dialbackNamespace) != nil {
-				s.setState(outValidatingDialbackKey)
-				db := xmpp.NewElementName("db:result")
-				db.SetFrom(s.cfg.localDomain)
-				db.SetTo(s.cfg.remoteDomain)
-				db.SetText(s.cfg.keyGen.generate(s.cfg.remoteDomain, s.cfg.localDomain, s.sess.StreamID()))
-				s.writeElement(db)
-
 			} else {
-				// no verification mechanism found... do not allow remote connection
-				s.disconnectWithStreamError(streamerror.ErrRemoteConnectionFailed)
+				s.startDialback()
 			}
 		} else {
 			s.finishVerification()
@@ -237,13 +290,33 @@ func (s *outStream) handleAuthenticating(elem xmpp.XElement) {
 		_ = s.sess.Open(nil)
 
 	case "failure":
-		s.disconnectWithStreamError(streamerror.ErrRemoteConnectionFailed)
+		log.Infof("s2s out stream external authentication failed... (domainpair: %s)", s.ID())
+		s.startDialback()
 
 	default:
 		s.disconnectWithStreamError(streamerror.ErrUnsupportedStanzaType)
 	}
 }
 
+func (s *outStream) startDialback() {
+	if s.cfg.isTLSAuthRequired(s.cfg.remoteDomain) {
+		// remote domain must be authenticated by its certificate
+		s.disconnectWithStreamError(streamerror.ErrPolicyViolation)
+		return
+	}
+	if !s.dialbackAvail {
+		// no verification mechanism found... do not allow remote connection
+		s.disconnectWithStreamError(streamerror.ErrRemoteConnectionFailed)
+		return
+	}
+	s.setState(outValidatingDialbackKey)
+	db := xmpp.NewElementName("db:result")
+	db.SetFrom(s.cfg.localDomain)
+	db.SetTo(s.cfg.remoteDomain)
+	db.SetText(s.cfg.keyGen.generate(s.cfg.remoteDomain, s.cfg.localDomain, s.sess.StreamID()))
+	s.writeElement(db)
+}
+
 func (s *outStream) handleValidatingDialbackKey(elem xmpp.XElement) {
 	switch elem.Name() {
 	case "db:result":
@@ -276,10 +349,117 @@ func (s *outStream) handleAuthorizingDialbackKey(elem xmpp.XElement) {
 func (s *outStream) finishVerification() {
 	// send pending elements...
 	for _, el := range s.sendQueue {
-		s.writeElement(el)
+		notifySent(el.sent, s.writeElement(el.elem) == nil)
 	}
 	s.sendQueue = nil
 	s.setState(outVerified)
+	close(s.establishedCh)
+
+	atomic.StoreInt64(&s.lastActivity, time.Now().UnixNano())
+	if s.cfg.pingInterval > 0 {
+		s.schedulePing()
+	}
+	if s.cfg.whitespace > 0 {
+		s.scheduleWhitespace()
+	}
+	if s.cfg.idleTimeout > 0 {
+		s.scheduleIdleCheck(s.cfg.idleTimeout)
+	}
+}
+
+// XEP-0199: XMPP Ping
+func (s *outStream) schedulePing() {
+	s.pingTm = time.AfterFunc(s.cfg.pingInterval, func() {
+		s.runQueue.Run(s.sendPing)
+	})
+}
+
+func (s *outStream) sendPing() {
+	if s.getState() != outVerified {
+		return
+	}
+	id := uuid.New()
+	iq := xmpp.NewIQType(id, xmpp.GetType)
+	iq.SetFrom(s.cfg.localDomain)
+	iq.SetTo(s.cfg.remoteDomain)
+	iq.AppendElement(xmpp.NewElementNamespace("ping", pingNamespace))
+
+	s.pendingPing.Store(id)
+	s.writeElement(iq)
+
+	s.pingTm = time.AfterFunc(s.cfg.pingTimeout, func() {
+		s.runQueue.Run(func() { s.pingTimeout(id) })
+	})
+}
+
+func (s *outStream) pingTimeout(id string) {
+	if s.getState() != outVerified || s.pendingPing.Load() != id {
+		return
+	}
+	log.Infof("s2s out stream ping timeout... (domainpair: %s)", s.ID())
+	s.disconnectWithStreamError(streamerror.ErrConnectionTimeout)
+}
+
+// pong reports whether or not id matches the pending ping identifier,
+// scheduling next ping in such case.
+func (s *outStream) pong(id string) bool {
+	if len(id) == 0 || s.pendingPing.Load() != id {
+		return false
+	}
+	s.runQueue.Run(func() {
+		if s.getState() != outVerified || s.pendingPing.Load() != id {
+			return
+		}
+		s.pendingPing.Store("")
+		s.pingTm.Stop()
+		s.schedulePing()
+	})
+	return true
+}
+
+func (s *outStream) scheduleWhitespace() {
+	s.whitespaceTm = time.AfterFunc(s.cfg.whitespace, func() {
+		s.runQueue.Run(s.sendWhitespace)
+	})
+}
+
+func (s *outStream) sendWhitespace() {
+	if s.getState() != outVerified {
+		return
+	}
+	_, _ = s.cfg.transport.WriteString(" ")
+	_ = s.cfg.transport.Flush()
+	s.scheduleWhitespace()
+}
+
+func (s *outStream) scheduleIdleCheck(d time.Duration) {
+	s.idleTm = time.AfterFunc(d, func() {
+		s.runQueue.Run(s.checkIdle)
+	})
+}
+
+func (s *outStream) checkIdle() {
+	if s.getState() != outVerified {
+		return
+	}
+	idle := time.Since(time.Unix(0, atomic.LoadInt64(&s.lastActivity)))
+	if idle < s.cfg.idleTimeout {
+		s.scheduleIdleCheck(s.cfg.idleTimeout - idle)
+		return
+	}
+	log.Infof("closing idle s2s out stream... (domainpair: %s)", s.ID())
+
+	// from now on elements are handed back to router, so that a new stream gets dialed
+	s.mu.Lock()
+	s.idleClosed = true
+	s.closeStream(true)
+	s.mu.Unlock()
+}
+
+func (s *outStream) reroute(elem xmpp.XElement) {
+	if stanza, ok := elem.(xmpp.Stanza); ok {
+		_ = s.router.Route(stanza)
+	}
 }
 
 func (s *outStream) writeStanzaErrorResponse(elem xmpp.XElement, stanzaErr *xmpp.StanzaError) {
@@ -291,8 +471,8 @@ func (s *outStream) writeStanzaErrorResponse(elem xmpp.XElement, stanzaErr *xmpp
 	s.writeElement(resp)
 }
 
-func (s *outStream) writeElement(elem xmpp.XElement) {
-	s.sess.Send(elem)
+func (s *outStream) writeElement(elem xmpp.XElement) error {
+	return s.sess.Send(elem)
 }
 
 func (s *outStream) readElement(elem xmpp.XElement) {
@@ -339,16 +519,35 @@ func (s *outStream) disconnectWithStreamError(err *streamerror.Error) {
 }
 
 func (s *outStream) disconnectClosingSession(closeSession bool) {
+	// hold write lock so that no element can be accepted once state is set to disconnected
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.closeStream(closeSession)
+}
+
+func (s *outStream) closeStream(closeSession bool) {
 	if closeSession {
 		_ = s.sess.Close()
 	}
 	if s.cfg.onOutDisconnect != nil {
 		s.cfg.onOutDisconnect(s)
 	}
+	for _, tm := range []*time.Timer{s.pingTm, s.whitespaceTm, s.idleTm} {
+		if tm != nil {
+			tm.Stop()
+		}
+	}
+	metrics.S2SStreams.WithLabelValues("out", s.cfg.remoteDomain).Dec()
 
 	s.setState(outDisconnected)
 	_ = s.cfg.transport.Close()
 
+	// report elements that never made it to the wire
+	for _, el := range s.sendQueue {
+		s.discardElement(el.elem, el.sent)
+	}
+	s.sendQueue = nil
+
 	s.runQueue.Stop(nil) // stop processing messages
 
 	close(s.discCh)
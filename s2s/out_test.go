@@ -16,6 +16,7 @@ import (
 	"github.com/ortuman/jackal/module/xep0092"
 	"github.com/ortuman/jackal/module/xep0199"
 	"github.com/ortuman/jackal/router"
+	"github.com/ortuman/jackal/stream"
 	"github.com/ortuman/jackal/transport"
 	"github.com/ortuman/jackal/xmpp"
 	"github.com/pborman/uuid"
@@ -27,7 +28,7 @@ func TestOutStream_Start(t *testing.T) {
 	defer shutdown()
 
 	cfg, _ := tUtilOutStreamDefaultConfig()
-	stm := newOutStream(r, false)
+	stm := newOutStream(r)
 	defer stm.Disconnect(nil)
 
 	// wrong verification name...
@@ -46,7 +47,7 @@ func TestOutStream_Disconnect(t *testing.T) {
 	defer shutdown()
 
 	cfg, conn := tUtilOutStreamDefaultConfig()
-	stm := newOutStream(r, false)
+	stm := newOutStream(r)
 	stm.start(cfg)
 	stm.Disconnect(nil)
 	require.True(t, conn.waitClose())
@@ -54,6 +55,25 @@ func TestOutStream_Disconnect(t *testing.T) {
 	require.Equal(t, outDisconnected, stm.getState())
 }
 
+func TestOutStream_DisconnectPending(t *testing.T) {
+	r, _, shutdown := setupTest(jackaDomain)
+	defer shutdown()
+
+	stm, conn := tUtilOutStreamInit(t, r)
+	tUtilOutStreamOpen(conn)
+
+	// not verified yet... element is reported as unsent on disconnect
+	sentCh := make(chan bool, 1)
+	stm.sendElement(tUtilQueueMessage("jabber.org"), func(ok bool) { sentCh <- ok })
+	stm.Disconnect(nil)
+	require.True(t, conn.waitClose())
+	require.False(t, <-sentCh)
+
+	// already disconnected
+	stm.sendElement(tUtilQueueMessage("jabber.org"), func(ok bool) { sentCh <- ok })
+	require.False(t, <-sentCh)
+}
+
 func TestOutStream_BadConnect(t *testing.T) {
 	r, _, shutdown := setupTest(jackaDomain)
 	defer shutdown()
@@ -230,9 +250,34 @@ func TestOutStream_Authenticate(t *testing.T) {
 	conn.inboundWriteString(securedFeaturesWithExternal)
 	_ = conn.outboundRead()
 
+	// falls back to dialback...
 	conn.inboundWriteString(`
 <failure xmlns="urn:ietf:params:xml:ns:xmpp-sasl"/>
 `)
+	elem = conn.outboundRead()
+	require.Equal(t, "db:result", elem.Name())
+	require.Equal(t, outValidatingDialbackKey, stm.getState())
+
+	// TLS authentication required...
+	cfg, conn := tUtilOutStreamDefaultConfig()
+	cfg.requireTLSAuth = []string{"jabber.org"}
+	stm = tUtilOutStreamInitWithConfig(t, r, cfg, conn)
+	tUtilOutStreamOpen(conn)
+	atomic.StoreUint32(&stm.secured, 1)
+	conn.inboundWriteString(securedFeaturesWithExternal)
+	_ = conn.outboundRead()
+
+	conn.inboundWriteString(`
+<failure xmlns="urn:ietf:params:xml:ns:xmpp-sasl"/>
+`)
+	require.True(t, conn.waitClose())
+
+	cfg, conn = tUtilOutStreamDefaultConfig()
+	cfg.requireTLSAuth = []string{"jabber.org"}
+	stm = tUtilOutStreamInitWithConfig(t, r, cfg, conn)
+	tUtilOutStreamOpen(conn)
+	atomic.StoreUint32(&stm.secured, 1)
+	conn.inboundWriteString(securedFeatures)
 	require.True(t, conn.waitClose())
 
 	stm, conn = tUtilOutStreamInit(t, r)
@@ -312,6 +357,106 @@ func TestOutStream_Dialback(t *testing.T) {
 	require.Equal(t, iqID, elem.ID())
 }
 
+func TestOutStream_Ping(t *testing.T) {
+	r, _, shutdown := setupTest(jackaDomain)
+	defer shutdown()
+
+	cfg, conn := tUtilOutStreamDefaultConfig()
+	cfg.pingInterval = time.Millisecond * 50
+	cfg.pingTimeout = time.Millisecond * 250
+	stm := tUtilOutStreamInitVerified(t, r, cfg, conn)
+
+	elem := conn.outboundRead()
+	require.Equal(t, "iq", elem.Name())
+	require.Equal(t, xmpp.GetType, elem.Type())
+	require.Equal(t, "jackal.im", elem.From())
+	require.Equal(t, "jabber.org", elem.To())
+	require.NotNil(t, elem.Elements().ChildNamespace("ping", pingNamespace))
+
+	require.False(t, stm.pong(uuid.New()))
+	require.True(t, stm.pong(elem.ID()))
+
+	// next ping...
+	elem2 := conn.outboundRead()
+	require.Equal(t, "iq", elem2.Name())
+	require.NotEqual(t, elem.ID(), elem2.ID())
+
+	// ...remote server does not reply
+	require.True(t, conn.waitClose())
+	require.Equal(t, outDisconnected, stm.getState())
+}
+
+func TestOutStream_IdleTimeout(t *testing.T) {
+	r, _, shutdown := setupTest(jackaDomain)
+	defer shutdown()
+
+	out := &fakeRoutedOut{elemCh: make(chan xmpp.XElement, 1)}
+	r.SetOutS2SProvider(out)
+
+	cfg, conn := tUtilOutStreamDefaultConfig()
+	cfg.idleTimeout = time.Millisecond * 250
+
+	var unregistered int32
+	cfg.onOutDisconnect = func(_ stream.S2SOut) { atomic.StoreInt32(&unregistered, 1) }
+	stm := tUtilOutStreamInitVerified(t, r, cfg, conn)
+
+	// sending stanzas keeps stream alive...
+	for i := 0; i < 3; i++ {
+		time.Sleep(time.Millisecond * 100)
+		stm.SendElement(tUtilQueueMessage("jabber.org"))
+		_ = conn.outboundRead()
+	}
+	require.Equal(t, outVerified, stm.getState())
+
+	require.True(t, conn.waitClose())
+	require.Equal(t, outDisconnected, stm.getState())
+	require.Equal(t, int32(1), atomic.LoadInt32(&unregistered))
+
+	// elements sent through an idle closed stream get routed again
+	msg := tUtilQueueMessage("jabber.org")
+	stm.SendElement(msg)
+	select {
+	case elem := <-out.elemCh:
+		require.Equal(t, msg.ID(), elem.ID())
+	case <-time.After(time.Second):
+		require.Fail(t, "expecting rerouted element")
+	}
+}
+
+func tUtilOutStreamInitVerified(t *testing.T, r *router.Router, cfg *streamConfig, conn *fakeSocketConn) *outStream {
+	cfg.localDomain = "jackal.im"
+	stm := tUtilOutStreamInitWithConfig(t, r, cfg, conn)
+	tUtilOutStreamVerify(t, stm, conn)
+	return stm
+}
+
+// tUtilOutStreamVerify drives an opened out stream through dialback verification.
+func tUtilOutStreamVerify(t *testing.T, stm *outStream, conn *fakeSocketConn) {
+	tUtilOutStreamOpen(conn)
+	atomic.StoreUint32(&stm.secured, 1)
+	conn.inboundWriteString(securedFeatures)
+	_ = conn.outboundRead() // db:result
+
+	conn.inboundWriteString(`
+<db:result from="jabber.org" to="jackal.im" type="valid"/>
+`)
+	select {
+	case <-stm.established():
+	case <-time.After(time.Second):
+		require.Fail(t, "expecting verified stream")
+	}
+}
+
+type fakeRoutedOut struct {
+	elemCh chan xmpp.XElement
+}
+
+func (o *fakeRoutedOut) ID() string                     { return "jackal.im:jabber.org" }
+func (o *fakeRoutedOut) SendElement(elem xmpp.XElement) { o.elemCh <- elem }
+func (o *fakeRoutedOut) Disconnect(err error)           {}
+
+func (o *fakeRoutedOut) GetOut(_, _ string) (stream.S2SOut, error) { return o, nil }
+
 func tUtilOutStreamOpen(conn *fakeSocketConn) {
 	// open stream from remote server...
 	conn.inboundWriteString(`
@@ -323,7 +468,7 @@ func tUtilOutStreamOpen(conn *fakeSocketConn) {
 }
 
 func tUtilOutStreamInitWithConfig(t *testing.T, r *router.Router, cfg *streamConfig, conn *fakeSocketConn) *outStream {
-	stm := newOutStream(r, false)
+	stm := newOutStream(r)
 	stm.start(cfg)
 
 	elem := conn.outboundRead()
@@ -335,7 +480,7 @@ func tUtilOutStreamInitWithConfig(t *testing.T, r *router.Router, cfg *streamCon
 
 func tUtilOutStreamInit(t *testing.T, r *router.Router) (*outStream, *fakeSocketConn) {
 	cfg, conn := tUtilOutStreamDefaultConfig()
-	stm := newOutStream(r, false)
+	stm := newOutStream(r)
 	stm.start(cfg)
 
 	elem := conn.outboundRead()
@@ -0,0 +1,49 @@
+/*
+ * Copyright (c) 2018 Miguel Ángel Ortuño.
+ * See the LICENSE file for more information.
+ */
+
+package s2s
+
+import (
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/ortuman/jackal/util"
+)
+
+var errNoPeerCertificate = errors.New("no peer certificate presented")
+
+// verifyPeerCertificate validates a peer certificate chain (PKIX) against roots
+// and checks that the leaf certificate identifies domain either by means of
+// an id-on-xmppAddr or a DNS subject alternative name.
+// If roots is nil the system certificate pool will be used.
+func verifyPeerCertificate(certs []*x509.Certificate, roots *x509.CertPool, domain string) error {
+	if len(certs) == 0 {
+		return errNoPeerCertificate
+	}
+	intermediates := x509.NewCertPool()
+	for _, cert := range certs[1:] {
+		intermediates.AddCert(cert)
+	}
+	opts := x509.VerifyOptions{
+		Roots:         roots,
+		Intermediates: intermediates,
+		KeyUsages:     []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth},
+	}
+	leaf := certs[0]
+	if _, err := leaf.Verify(opts); err != nil {
+		return err
+	}
+	for _, addr := range util.XMPPAddresses(leaf) {
+		if strings.EqualFold(addr, domain) {
+			return nil
+		}
+	}
+	if err := leaf.VerifyHostname(domain); err != nil {
+		return fmt.Errorf("peer certificate is not valid for domain %s", domain)
+	}
+	return nil
+}
@@ -0,0 +1,97 @@
+/*
+ * Copyright (c) 2018 Miguel Ángel Ortuño.
+ * See the LICENSE file for more information.
+ */
+
+package s2s
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"math/big"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestVerifyPeerCertificate(t *testing.T) {
+	ca, caKey := tUtilGenerateCA(t)
+	roots := x509.NewCertPool()
+	roots.AddCert(ca)
+
+	// no certificate...
+	require.Equal(t, errNoPeerCertificate, verifyPeerCertificate(nil, roots, "jabber.org"))
+
+	// DNS identity...
+	cert, _ := tUtilGenerateCert(t, ca, caKey, []string{"jabber.org"}, "")
+	require.Nil(t, verifyPeerCertificate([]*x509.Certificate{cert}, roots, "jabber.org"))
+	require.NotNil(t, verifyPeerCertificate([]*x509.Certificate{cert}, roots, "jackal.im"))
+
+	// wildcard DNS identity...
+	cert, _ = tUtilGenerateCert(t, ca, caKey, []string{"*.jabber.org"}, "")
+	require.Nil(t, verifyPeerCertificate([]*x509.Certificate{cert}, roots, "conference.jabber.org"))
+
+	// XmppAddr identity...
+	cert, _ = tUtilGenerateCert(t, ca, caKey, nil, "jabber.org")
+	require.Nil(t, verifyPeerCertificate([]*x509.Certificate{cert}, roots, "jabber.org"))
+
+	// untrusted certificate...
+	otherCA, otherKey := tUtilGenerateCA(t)
+	cert, _ = tUtilGenerateCert(t, otherCA, otherKey, []string{"jabber.org"}, "")
+	require.NotNil(t, verifyPeerCertificate([]*x509.Certificate{cert}, roots, "jabber.org"))
+}
+
+func tUtilGenerateCA(t *testing.T) (*x509.Certificate, *ecdsa.PrivateKey) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.Nil(t, err)
+
+	tmpl := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "jackal test CA"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		KeyUsage:              x509.KeyUsageCertSign,
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	require.Nil(t, err)
+	cert, err := x509.ParseCertificate(der)
+	require.Nil(t, err)
+	return cert, key
+}
+
+func tUtilGenerateCert(t *testing.T, ca *x509.Certificate, caKey *ecdsa.PrivateKey, dnsNames []string, xmppAddr string) (*x509.Certificate, *ecdsa.PrivateKey) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.Nil(t, err)
+
+	tmpl := &x509.Certificate{
+		SerialNumber: big.NewInt(2),
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth},
+		DNSNames:     dnsNames,
+	}
+	if len(xmppAddr) > 0 {
+		// otherName [0] { id-on-xmppAddr, [0] EXPLICIT UTF8String }
+		value, _ := asn1.MarshalWithParams(xmppAddr, "utf8")
+		typeID, _ := asn1.Marshal(asn1.ObjectIdentifier{1, 3, 6, 1, 5, 5, 7, 8, 5})
+		explicitValue, _ := asn1.Marshal(asn1.RawValue{Class: asn1.ClassContextSpecific, Tag: 0, IsCompound: true, Bytes: value})
+		san, err := asn1.Marshal([]asn1.RawValue{
+			{Class: asn1.ClassContextSpecific, Tag: 0, IsCompound: true, Bytes: append(typeID, explicitValue...)},
+		})
+		require.Nil(t, err)
+		tmpl.ExtraExtensions = []pkix.Extension{{Id: asn1.ObjectIdentifier{2, 5, 29, 17}, Value: san}}
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, ca, &key.PublicKey, caKey)
+	require.Nil(t, err)
+	cert, err := x509.ParseCertificate(der)
+	require.Nil(t, err)
+	return cert, key
+}
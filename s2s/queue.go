@@ -0,0 +1,346 @@
+/*
+ * Copyright (c) 2018 Miguel Ángel Ortuño.
+ * See the LICENSE file for more information.
+ */
+
+package s2s
+
+import (
+	"errors"
+	"sort"
+	"sync"
+	"time"
+
+	streamerror "github.com/ortuman/jackal/errors"
+	"github.com/ortuman/jackal/log"
+	"github.com/ortuman/jackal/model"
+	"github.com/ortuman/jackal/router"
+	"github.com/ortuman/jackal/runqueue"
+	"github.com/ortuman/jackal/storage"
+	"github.com/ortuman/jackal/xmpp"
+	"github.com/pborman/uuid"
+)
+
+var errEstablishTimeout = errors.New("s2s: timed out waiting for out stream verification")
+
+// deliveryStream represents an outgoing stream able to report
+// whether or not it has been verified by the remote server.
+type deliveryStream interface {
+	// sendElement sends an element, reporting through sent callback
+	// whether or not it has been written to the wire.
+	sendElement(elem xmpp.XElement, sent func(ok bool))
+
+	established() <-chan struct{}
+	done() <-chan *streamerror.Error
+}
+
+// outProvider provides the outgoing streams used to deliver queued stanzas.
+type outProvider interface {
+	// lookupOut returns the registered stream of a domain pair, or nil if there's none.
+	lookupOut(localDomain, remoteDomain string) deliveryStream
+
+	// dialOut returns the stream of a domain pair, dialing remote server if needed.
+	dialOut(localDomain, remoteDomain string) (deliveryStream, error)
+}
+
+// outQueues keeps a persistent outgoing queue per remote domain.
+type outQueues struct {
+	cfg              *QueueConfig
+	router           *router.Router
+	outs             outProvider
+	establishTimeout time.Duration
+	queues           sync.Map
+}
+
+func newOutQueues(cfg *QueueConfig, router *router.Router, outs outProvider, establishTimeout time.Duration) *outQueues {
+	return &outQueues{cfg: cfg, router: router, outs: outs, establishTimeout: establishTimeout}
+}
+
+// getOut returns the stream.S2SOut through which router sends
+// stanzas of a domain pair.
+func (qs *outQueues) getOut(localDomain, remoteDomain string) *queuedOut {
+	return &queuedOut{id: localDomain + ":" + remoteDomain, q: qs.queue(remoteDomain)}
+}
+
+// restore resumes delivery of the items persisted by a previous run.
+func (qs *outQueues) restore() error {
+	items, err := storage.FetchS2SQueueItems()
+	if err != nil {
+		return err
+	}
+	byDomain := make(map[string][]model.S2SQueueItem)
+	for _, item := range items {
+		byDomain[item.RemoteDomain] = append(byDomain[item.RemoteDomain], item)
+	}
+	for remoteDomain, items := range byDomain {
+		log.Infof("s2s: restoring %d queued stanza(s) to %s", len(items), remoteDomain)
+		qs.queue(remoteDomain).restore(items)
+	}
+	return nil
+}
+
+func (qs *outQueues) queue(remoteDomain string) *outQueue {
+	if q, ok := qs.queues.Load(remoteDomain); ok {
+		return q.(*outQueue)
+	}
+	q, _ := qs.queues.LoadOrStore(remoteDomain, newOutQueue(remoteDomain, qs))
+	return q.(*outQueue)
+}
+
+// outQueue represents a remote domain outgoing queue.
+// Stanzas that cannot be handed over to a verified stream straight away are persisted,
+// and delivery is retried with exponential backoff until they're older than configured max age.
+type outQueue struct {
+	remoteDomain string
+	cfg          *QueueConfig
+	qs           *outQueues
+	now          func() time.Time
+	afterFunc    func(d time.Duration, f func()) *time.Timer
+	runQueue     *runqueue.RunQueue
+	items        []model.S2SQueueItem
+	delivering   bool
+	backoff      time.Duration
+	retryTm      *time.Timer
+}
+
+func newOutQueue(remoteDomain string, qs *outQueues) *outQueue {
+	return &outQueue{
+		remoteDomain: remoteDomain,
+		cfg:          qs.cfg,
+		qs:           qs,
+		now:          time.Now,
+		afterFunc:    time.AfterFunc,
+		runQueue:     runqueue.New("s2s:queue"),
+	}
+}
+
+func (q *outQueue) enqueue(stanza xmpp.Stanza) {
+	q.runQueue.Run(func() {
+		if len(q.items) == 0 && q.sendIfEstablished(stanza) {
+			return
+		}
+		q.persist(stanza)
+	})
+}
+
+func (q *outQueue) persist(stanza xmpp.Stanza) {
+	item := model.S2SQueueItem{
+		ID:           uuid.New(),
+		RemoteDomain: q.remoteDomain,
+		Stanza:       stanza,
+		EnqueuedAt:   q.now(),
+	}
+	if err := storage.InsertS2SQueueItem(&item); err != nil {
+		log.Error(err)
+	}
+	q.items = append(q.items, item)
+	if !q.delivering && q.retryTm == nil {
+		q.deliver()
+	}
+}
+
+func (q *outQueue) restore(items []model.S2SQueueItem) {
+	q.runQueue.Run(func() {
+		q.items = append(items, q.items...)
+		if !q.delivering && q.retryTm == nil {
+			q.deliver()
+		}
+	})
+}
+
+// sendIfEstablished hands stanza over to an already verified stream, skipping persistence.
+// Stanza gets persisted anyway if it couldn't be written.
+func (q *outQueue) sendIfEstablished(stanza xmpp.Stanza) bool {
+	out := q.qs.outs.lookupOut(stanza.FromJID().Domain(), q.remoteDomain)
+	if out == nil || !isEstablished(out) {
+		return false
+	}
+	out.sendElement(stanza, func(ok bool) {
+		if !ok {
+			q.runQueue.Run(func() { q.persist(stanza) })
+		}
+	})
+	return true
+}
+
+// deliver expires stale items and tries to obtain a verified stream for every
+// local domain with pending items.
+func (q *outQueue) deliver() {
+	q.expire()
+	if len(q.items) == 0 {
+		q.backoff = 0
+		return
+	}
+	var localDomains []string
+	seen := make(map[string]bool)
+	for _, item := range q.items {
+		if localDomain := item.Stanza.FromJID().Domain(); !seen[localDomain] {
+			seen[localDomain] = true
+			localDomains = append(localDomains, localDomain)
+		}
+	}
+	q.delivering = true
+	go func() {
+		outs := make(map[string]deliveryStream)
+		for _, localDomain := range localDomains {
+			out, err := q.establish(localDomain)
+			if err != nil {
+				log.Warnf("s2s: failed to establish stream to %s (domainpair: %s:%s): %v", q.remoteDomain, localDomain, q.remoteDomain, err)
+				continue
+			}
+			outs[localDomain] = out
+		}
+		q.runQueue.Run(func() { q.flush(localDomains, outs) })
+	}()
+}
+
+func (q *outQueue) establish(localDomain string) (deliveryStream, error) {
+	out, err := q.qs.outs.dialOut(localDomain, q.remoteDomain)
+	if err != nil {
+		return nil, err
+	}
+	select {
+	case <-out.established():
+		return out, nil
+	case <-out.done():
+		return nil, streamerror.ErrRemoteConnectionFailed
+	case <-time.After(q.qs.establishTimeout):
+		return nil, errEstablishTimeout
+	}
+}
+
+// flush sends pending items through the established streams,
+// and schedules a new delivery attempt for the remaining ones.
+// Sent items remain persisted until they've been written to the wire.
+func (q *outQueue) flush(localDomains []string, outs map[string]deliveryStream) {
+	q.delivering = false
+
+	attempted := make(map[string]bool, len(localDomains))
+	for _, localDomain := range localDomains {
+		attempted[localDomain] = true
+	}
+	var pending []model.S2SQueueItem
+	var notAttempted bool
+	for _, item := range q.items {
+		localDomain := item.Stanza.FromJID().Domain()
+		out := outs[localDomain]
+		if out == nil || !isEstablished(out) {
+			pending = append(pending, item)
+			notAttempted = notAttempted || !attempted[localDomain]
+			continue
+		}
+		item := item
+		out.sendElement(item.Stanza, func(ok bool) {
+			q.runQueue.Run(func() { q.sent(item, ok) })
+		})
+	}
+	q.items = pending
+	if len(q.items) == 0 {
+		q.backoff = 0
+		return
+	}
+	if notAttempted {
+		// items of a local domain enqueued while delivering
+		q.deliver()
+		return
+	}
+	q.scheduleRetry()
+}
+
+// sent removes a written item from storage, or puts it back
+// into the queue if the stream went away before writing it.
+func (q *outQueue) sent(item model.S2SQueueItem, ok bool) {
+	if ok {
+		if err := storage.DeleteS2SQueueItem(item.RemoteDomain, item.ID); err != nil {
+			log.Error(err)
+		}
+		return
+	}
+	q.items = append(q.items, item)
+	sort.SliceStable(q.items, func(i, j int) bool {
+		return q.items[i].EnqueuedAt.Before(q.items[j].EnqueuedAt)
+	})
+	if !q.delivering && q.retryTm == nil {
+		q.scheduleRetry()
+	}
+}
+
+func (q *outQueue) scheduleRetry() {
+	switch {
+	case q.backoff == 0:
+		q.backoff = q.cfg.MinBackoff
+	case q.backoff < q.cfg.MaxBackoff:
+		q.backoff *= 2
+		if q.backoff > q.cfg.MaxBackoff {
+			q.backoff = q.cfg.MaxBackoff
+		}
+	}
+	// do not wait beyond oldest item expiration
+	delay := q.backoff
+	if expiresIn := q.items[0].EnqueuedAt.Add(q.cfg.MaxAge).Sub(q.now()); expiresIn < delay {
+		delay = expiresIn
+	}
+	log.Infof("s2s: %d stanza(s) queued to %s, retrying in %v", len(q.items), q.remoteDomain, delay)
+
+	q.retryTm = q.afterFunc(delay, func() {
+		q.runQueue.Run(func() {
+			q.retryTm = nil
+			q.deliver()
+		})
+	})
+}
+
+// expire removes items older than configured max age,
+// bouncing a 'remote-server-timeout' error to their senders.
+func (q *outQueue) expire() {
+	now := q.now()
+	var pending []model.S2SQueueItem
+	for _, item := range q.items {
+		if now.Sub(item.EnqueuedAt) < q.cfg.MaxAge {
+			pending = append(pending, item)
+			continue
+		}
+		if err := storage.DeleteS2SQueueItem(item.RemoteDomain, item.ID); err != nil {
+			log.Error(err)
+		}
+		if item.Stanza.Type() == xmpp.ErrorType {
+			continue // never bounce an error
+		}
+		_ = q.qs.router.Route(xmpp.NewErrorStanzaFromStanza(item.Stanza, xmpp.ErrRemoteServerTimeout, nil))
+	}
+	q.items = pending
+}
+
+func isEstablished(out deliveryStream) bool {
+	select {
+	case <-out.done():
+		return false
+	default:
+	}
+	select {
+	case <-out.established():
+		return true
+	default:
+		return false
+	}
+}
+
+// queuedOut is the outgoing stream handed over to router when s2s queue is enabled.
+type queuedOut struct {
+	id string
+	q  *outQueue
+}
+
+func (o *queuedOut) ID() string { return o.id }
+
+func (o *queuedOut) SendElement(elem xmpp.XElement) {
+	stanza, ok := elem.(xmpp.Stanza)
+	if !ok {
+		log.Warnf("s2s: discarding non stanza element: %s", elem.Name())
+		return
+	}
+	o.q.enqueue(stanza)
+}
+
+// Disconnect is a no-op, since queued stanzas outlive streams.
+func (o *queuedOut) Disconnect(err error) {}
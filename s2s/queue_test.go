@@ -0,0 +1,379 @@
+/*
+ * Copyright (c) 2018 Miguel Ángel Ortuño.
+ * See the LICENSE file for more information.
+ */
+
+package s2s
+
+import (
+	"errors"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	streamerror "github.com/ortuman/jackal/errors"
+	"github.com/ortuman/jackal/model"
+	"github.com/ortuman/jackal/storage"
+	"github.com/ortuman/jackal/stream"
+	"github.com/ortuman/jackal/xmpp"
+	"github.com/ortuman/jackal/xmpp/jid"
+	"github.com/pborman/uuid"
+	"github.com/stretchr/testify/require"
+)
+
+func TestOutQueue_Established(t *testing.T) {
+	r, s, shutdown := setupTest(jackaDomain)
+	defer shutdown()
+
+	outs := newFakeOutProvider()
+	out := outs.add("jackal.im:jabber.org")
+	close(out.establishedCh)
+
+	qs := newOutQueues(tUtilQueueConfig(), r, outs, time.Second)
+	qs.getOut("jackal.im", "jabber.org").SendElement(tUtilQueueMessage("jabber.org"))
+
+	// verified stream... stanza is not persisted
+	require.NotNil(t, out.receive())
+	items, _ := s.FetchS2SQueueItems()
+	require.Len(t, items, 0)
+	require.Equal(t, 0, outs.dialCount())
+}
+
+func TestOutQueue_RetryBackoff(t *testing.T) {
+	r, s, shutdown := setupTest(jackaDomain)
+	defer shutdown()
+
+	outs := newFakeOutProvider()
+	outs.dialErr = errors.New("dialer mocked error")
+
+	qs := newOutQueues(tUtilQueueConfig(), r, outs, time.Second)
+	q, retryCh := tUtilOutQueue(qs, "jabber.org", time.Now)
+
+	msg := tUtilQueueMessage("jabber.org")
+	qs.getOut("jackal.im", "jabber.org").SendElement(msg)
+
+	// exponential backoff, capped to max backoff
+	var retry tUtilRetry
+	for _, delay := range []time.Duration{time.Second, time.Second * 2, time.Second * 4, time.Second * 4} {
+		retry = <-retryCh
+		require.Equal(t, delay, retry.delay)
+
+		items, _ := s.FetchS2SQueueItems()
+		require.Len(t, items, 1)
+		require.Equal(t, msg.String(), items[0].Stanza.String())
+		retry.fn()
+	}
+	retry = <-retryCh
+
+	// remote server is reachable again...
+	outs.mu.Lock()
+	outs.dialErr = nil
+	outs.mu.Unlock()
+	out := outs.add("jackal.im:jabber.org")
+	close(out.establishedCh)
+
+	retry.fn()
+	require.Equal(t, msg.String(), out.receive().String())
+	tUtilWaitFor(t, func() bool {
+		items, _ := s.FetchS2SQueueItems()
+		return len(items) == 0
+	})
+	waitCh := make(chan time.Duration)
+	q.runQueue.Run(func() { waitCh <- q.backoff })
+	require.Equal(t, time.Duration(0), <-waitCh)
+}
+
+func TestOutQueue_Expire(t *testing.T) {
+	r, s, shutdown := setupTest(jackaDomain)
+	defer shutdown()
+
+	j, _ := jid.New("ortuman", "jackal.im", "balcony", true)
+	stm := stream.NewMockC2S(uuid.New(), j)
+	r.Bind(stm)
+
+	outs := newFakeOutProvider()
+	outs.dialErr = errors.New("dialer mocked error")
+
+	var mu sync.Mutex
+	now := time.Now()
+	nowFn := func() time.Time {
+		mu.Lock()
+		defer mu.Unlock()
+		return now
+	}
+	qs := newOutQueues(tUtilQueueConfig(), r, outs, time.Second)
+	_, retryCh := tUtilOutQueue(qs, "jabber.org", nowFn)
+
+	msg := tUtilQueueMessage("jabber.org")
+	qs.getOut("jackal.im", "jabber.org").SendElement(msg)
+	retry := <-retryCh
+
+	// retry is never scheduled beyond oldest item expiration
+	mu.Lock()
+	now = now.Add(time.Second*10 - time.Millisecond*500)
+	mu.Unlock()
+
+	errMsg := tUtilQueueMessage("jabber.org")
+	errMsg.SetType(xmpp.ErrorType)
+	qs.getOut("jackal.im", "jabber.org").SendElement(errMsg)
+
+	retry.fn()
+	retry = <-retryCh
+	require.Equal(t, time.Millisecond*500, retry.delay)
+
+	// expired... sender gets bounced, but errors are never bounced
+	mu.Lock()
+	now = now.Add(time.Minute)
+	mu.Unlock()
+	retry.fn()
+
+	elem := stm.ReceiveElement()
+	require.Equal(t, xmpp.ErrorType, elem.Type())
+	require.Equal(t, msg.ID(), elem.ID())
+	require.Equal(t, msg.To(), elem.From())
+	require.NotNil(t, elem.Error().Elements().Child("remote-server-timeout"))
+
+	tUtilWaitFor(t, func() bool {
+		items, _ := s.FetchS2SQueueItems()
+		return len(items) == 0
+	})
+	select {
+	case <-retryCh:
+		require.Fail(t, "unexpected delivery attempt")
+	case <-time.After(time.Millisecond * 50):
+	}
+}
+
+func TestOutQueue_Restore(t *testing.T) {
+	r, s, shutdown := setupTest(jackaDomain)
+	defer shutdown()
+
+	msg1 := tUtilQueueMessage("jabber.org")
+	msg2 := tUtilQueueMessage("example.net")
+	_ = storage.InsertS2SQueueItem(&model.S2SQueueItem{ID: uuid.New(), RemoteDomain: "jabber.org", Stanza: msg1, EnqueuedAt: time.Now()})
+	_ = storage.InsertS2SQueueItem(&model.S2SQueueItem{ID: uuid.New(), RemoteDomain: "example.net", Stanza: msg2, EnqueuedAt: time.Now()})
+
+	outs := newFakeOutProvider()
+	out1 := outs.add("jackal.im:jabber.org")
+	out2 := outs.add("jackal.im:example.net")
+	close(out1.establishedCh)
+	close(out2.establishedCh)
+
+	qs := newOutQueues(tUtilQueueConfig(), r, outs, time.Second)
+	require.Nil(t, qs.restore())
+
+	require.Equal(t, msg1.String(), out1.receive().String())
+	require.Equal(t, msg2.String(), out2.receive().String())
+	tUtilWaitFor(t, func() bool {
+		items, _ := s.FetchS2SQueueItems()
+		return len(items) == 0
+	})
+	require.Equal(t, 2, outs.dialCount())
+}
+
+func TestOutQueue_StreamFailure(t *testing.T) {
+	r, s, shutdown := setupTest(jackaDomain)
+	defer shutdown()
+
+	outs := newFakeOutProvider()
+	out := outs.add("jackal.im:jabber.org")
+	close(out.doneCh) // remote server rejects stream
+
+	qs := newOutQueues(tUtilQueueConfig(), r, outs, time.Second)
+	_, retryCh := tUtilOutQueue(qs, "jabber.org", time.Now)
+
+	qs.getOut("jackal.im", "jabber.org").SendElement(tUtilQueueMessage("jabber.org"))
+	retry := <-retryCh
+	require.Equal(t, time.Second, retry.delay)
+
+	items, _ := s.FetchS2SQueueItems()
+	require.Len(t, items, 1)
+}
+
+func TestOutQueue_WriteFailure(t *testing.T) {
+	r, s, shutdown := setupTest(jackaDomain)
+	defer shutdown()
+
+	outs := newFakeOutProvider()
+	out := outs.add("jackal.im:jabber.org")
+	close(out.establishedCh)
+	atomic.StoreUint32(&out.writeFailed, 1)
+
+	qs := newOutQueues(tUtilQueueConfig(), r, outs, time.Second)
+	_, retryCh := tUtilOutQueue(qs, "jabber.org", time.Now)
+
+	// stream went away before writing the stanza... it gets persisted and retried
+	msg := tUtilQueueMessage("jabber.org")
+	qs.getOut("jackal.im", "jabber.org").SendElement(msg)
+	require.Equal(t, msg.String(), out.receive().String())
+
+	tUtilWaitFor(t, func() bool {
+		items, _ := s.FetchS2SQueueItems()
+		return len(items) == 1
+	})
+	require.Equal(t, msg.String(), out.receive().String()) // delivery attempt
+	retry := <-retryCh
+	require.Equal(t, time.Second, retry.delay)
+
+	items, _ := s.FetchS2SQueueItems()
+	require.Len(t, items, 1)
+
+	// written on next attempt... item is removed
+	atomic.StoreUint32(&out.writeFailed, 0)
+	retry.fn()
+	require.Equal(t, msg.String(), out.receive().String())
+	tUtilWaitFor(t, func() bool {
+		items, _ := s.FetchS2SQueueItems()
+		return len(items) == 0
+	})
+}
+
+func TestOutQueue_StreamLostBeforeFlush(t *testing.T) {
+	r, s, shutdown := setupTest(jackaDomain)
+	defer shutdown()
+
+	outs := newFakeOutProvider()
+	outs.dialErr = errors.New("dialer mocked error")
+
+	qs := newOutQueues(tUtilQueueConfig(), r, outs, time.Second)
+	q, retryCh := tUtilOutQueue(qs, "jabber.org", time.Now)
+
+	qs.getOut("jackal.im", "jabber.org").SendElement(tUtilQueueMessage("jabber.org"))
+	retry := <-retryCh
+	require.Equal(t, time.Second, retry.delay)
+	require.Equal(t, 1, outs.dialCount())
+
+	// stream got established, but went away before flushing... retry is deferred
+	out := outs.add("jackal.im:jabber.org")
+	close(out.establishedCh)
+	close(out.doneCh)
+
+	q.runQueue.Run(func() {
+		q.retryTm = nil
+		q.flush([]string{"jackal.im"}, map[string]deliveryStream{"jackal.im": out})
+	})
+	retry = <-retryCh
+	require.Equal(t, time.Second*2, retry.delay)
+	require.Equal(t, 1, outs.dialCount())
+
+	items, _ := s.FetchS2SQueueItems()
+	require.Len(t, items, 1)
+}
+
+type tUtilRetry struct {
+	delay time.Duration
+	fn    func()
+}
+
+// tUtilOutQueue creates a remote domain queue whose retries are handed over to the returned channel.
+func tUtilOutQueue(qs *outQueues, remoteDomain string, now func() time.Time) (*outQueue, <-chan tUtilRetry) {
+	retryCh := make(chan tUtilRetry, 8)
+	q := newOutQueue(remoteDomain, qs)
+	q.now = now
+	q.afterFunc = func(d time.Duration, f func()) *time.Timer {
+		retryCh <- tUtilRetry{delay: d, fn: f}
+		return time.NewTimer(time.Hour)
+	}
+	qs.queues.Store(remoteDomain, q)
+	return q, retryCh
+}
+
+func tUtilQueueConfig() *QueueConfig {
+	return &QueueConfig{MinBackoff: time.Second, MaxBackoff: time.Second * 4, MaxAge: time.Second * 10}
+}
+
+func tUtilQueueMessage(remoteDomain string) *xmpp.Message {
+	from, _ := jid.New("ortuman", "jackal.im", "balcony", true)
+	to, _ := jid.New("romeo", remoteDomain, "", true)
+	msg := xmpp.NewMessageType(uuid.New(), xmpp.ChatType)
+	msg.SetFromJID(from)
+	msg.SetToJID(to)
+	return msg
+}
+
+func tUtilWaitFor(t *testing.T, cond func() bool) {
+	for i := 0; i < 100; i++ {
+		if cond() {
+			return
+		}
+		time.Sleep(time.Millisecond * 10)
+	}
+	require.Fail(t, "condition not satisfied")
+}
+
+type fakeDeliveryStream struct {
+	establishedCh chan struct{}
+	doneCh        chan *streamerror.Error
+	elemCh        chan xmpp.XElement
+	writeFailed   uint32
+}
+
+func (s *fakeDeliveryStream) sendElement(elem xmpp.XElement, sent func(ok bool)) {
+	s.elemCh <- elem
+	sent(atomic.LoadUint32(&s.writeFailed) == 0)
+}
+
+func (s *fakeDeliveryStream) established() <-chan struct{}    { return s.establishedCh }
+func (s *fakeDeliveryStream) done() <-chan *streamerror.Error { return s.doneCh }
+
+func (s *fakeDeliveryStream) receive() xmpp.XElement {
+	select {
+	case elem := <-s.elemCh:
+		return elem
+	case <-time.After(time.Second):
+		return nil
+	}
+}
+
+type fakeOutProvider struct {
+	mu      sync.Mutex
+	outs    map[string]*fakeDeliveryStream
+	dialErr error
+	dials   int
+}
+
+func newFakeOutProvider() *fakeOutProvider {
+	return &fakeOutProvider{outs: make(map[string]*fakeDeliveryStream)}
+}
+
+func (p *fakeOutProvider) add(domainPair string) *fakeDeliveryStream {
+	out := &fakeDeliveryStream{
+		establishedCh: make(chan struct{}),
+		doneCh:        make(chan *streamerror.Error),
+		elemCh:        make(chan xmpp.XElement, 8),
+	}
+	p.mu.Lock()
+	p.outs[domainPair] = out
+	p.mu.Unlock()
+	return out
+}
+
+func (p *fakeOutProvider) lookupOut(localDomain, remoteDomain string) deliveryStream {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if out := p.outs[localDomain+":"+remoteDomain]; out != nil {
+		return out
+	}
+	return nil
+}
+
+func (p *fakeOutProvider) dialOut(localDomain, remoteDomain string) (deliveryStream, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.dials++
+	if p.dialErr != nil {
+		return nil, p.dialErr
+	}
+	out := p.outs[localDomain+":"+remoteDomain]
+	if out == nil {
+		return nil, errors.New("no such stream")
+	}
+	return out, nil
+}
+
+func (p *fakeOutProvider) dialCount() int {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.dials
+}
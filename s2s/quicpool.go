@@ -0,0 +1,207 @@
+/*
+ * Copyright (c) 2018 Miguel Ángel Ortuño.
+ * See the LICENSE file for more information.
+ */
+
+package s2s
+
+import (
+	"sync"
+	"time"
+
+	"github.com/lucas-clemente/quic-go"
+	"github.com/ortuman/jackal/transport"
+)
+
+// sharedSession represents a QUIC session multiplexing several XMPP streams,
+// one per domain pair. Underlying session is closed once the last of them is released.
+type sharedSession struct {
+	quic.Session
+	mu      sync.Mutex
+	refs    int
+	invalid bool
+	closed  bool
+	onDone  func() // invoked once session can no longer be shared
+}
+
+func newSharedSession(sess quic.Session) *sharedSession {
+	return &sharedSession{Session: sess}
+}
+
+// acquire returns a new session reference, or nil in case
+// the session is no longer shareable.
+func (s *sharedSession) acquire() *sessionRef {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.invalid || s.closed {
+		return nil
+	}
+	s.refs++
+	return &sessionRef{sharedSession: s}
+}
+
+func (s *sharedSession) release() {
+	s.mu.Lock()
+	s.refs--
+	if s.refs > 0 || s.closed {
+		s.mu.Unlock()
+		return
+	}
+	s.closed = true
+	s.mu.Unlock()
+
+	s.done()
+	_ = s.Session.Close()
+}
+
+// invalidate prevents session from being handed over to new streams.
+func (s *sharedSession) invalidate() {
+	s.mu.Lock()
+	s.invalid = true
+	s.mu.Unlock()
+
+	s.done()
+}
+
+func (s *sharedSession) done() {
+	if s.onDone != nil {
+		s.onDone()
+	}
+}
+
+// sessionRef is the view of a shared session owned by a single XMPP stream,
+// so that closing its transport does not tear down the rest of them.
+type sessionRef struct {
+	*sharedSession
+	once sync.Once
+}
+
+func (r *sessionRef) Close() error {
+	r.once.Do(r.sharedSession.release)
+	return nil
+}
+
+// quicSessionPool keeps the established QUIC sessions per remote server address.
+type quicSessionPool struct {
+	mu      sync.Mutex
+	entries map[string]*poolEntry
+}
+
+type poolEntry struct {
+	mu       sync.Mutex // serializes dials to the same address
+	sessions []*sharedSession
+}
+
+func newQUICSessionPool() *quicSessionPool {
+	return &quicSessionPool{entries: make(map[string]*poolEntry)}
+}
+
+// openStream opens a new bidirectional stream towards address, reusing an
+// established session if any is accepted by reusable. Otherwise a new session
+// is obtained through dial.
+func (p *quicSessionPool) openStream(address string, reusable func(sess quic.Session) bool, dial func() (quic.Session, error)) (sess quic.Session, stm quic.Stream, reused bool, err error) {
+	p.mu.Lock()
+	e := p.entries[address]
+	if e == nil {
+		e = &poolEntry{}
+		p.entries[address] = e
+	}
+	p.mu.Unlock()
+
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	for _, shared := range p.sessions(address) {
+		if reusable != nil && !reusable(shared.Session) {
+			continue
+		}
+		ref := shared.acquire()
+		if ref == nil {
+			continue
+		}
+		stm, err := ref.OpenStreamSync()
+		if err == nil {
+			return ref, stm, true, nil
+		}
+		// session is no longer usable... stop sharing it
+		shared.invalidate()
+		_ = ref.Close()
+	}
+	qSess, err := dial()
+	if err != nil {
+		p.remove(address, nil)
+		return nil, nil, false, err
+	}
+	shared := p.add(address, e, qSess)
+	ref := shared.acquire()
+	stm, err = ref.OpenStreamSync()
+	if err != nil {
+		shared.invalidate()
+		_ = ref.Close()
+		return nil, nil, false, err
+	}
+	return ref, stm, false, nil
+}
+
+func (p *quicSessionPool) sessions(address string) []*sharedSession {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if e := p.entries[address]; e != nil {
+		return append([]*sharedSession(nil), e.sessions...)
+	}
+	return nil
+}
+
+func (p *quicSessionPool) add(address string, e *poolEntry, sess quic.Session) *sharedSession {
+	shared := newSharedSession(sess)
+	shared.onDone = func() { p.remove(address, shared) }
+
+	p.mu.Lock()
+	if p.entries[address] == nil {
+		p.entries[address] = e // entry was removed while dialing
+	}
+	cur := p.entries[address]
+	cur.sessions = append(cur.sessions, shared)
+	p.mu.Unlock()
+
+	go func() {
+		<-sess.Context().Done()
+		shared.invalidate() // closed sessions are not handed over anymore
+	}()
+	return shared
+}
+
+// remove takes shared out of the address entry,
+// which is dropped once it holds no more sessions.
+func (p *quicSessionPool) remove(address string, shared *sharedSession) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	e := p.entries[address]
+	if e == nil {
+		return
+	}
+	for i, s := range e.sessions {
+		if s == shared {
+			e.sessions = append(e.sessions[:i], e.sessions[i+1:]...)
+			break
+		}
+	}
+	if len(e.sessions) == 0 {
+		delete(p.entries, address)
+	}
+}
+
+// acceptQUICStreams starts an incoming XMPP stream for every QUIC stream
+// opened by remote server over sess, until session gets closed.
+func acceptQUICStreams(sess quic.Session, keepAlive time.Duration, startInStream func(tr transport.Transport)) {
+	shared := newSharedSession(sess)
+	ref := shared.acquire()
+	defer ref.Close()
+
+	for {
+		stm, err := sess.AcceptStream()
+		if err != nil {
+			return // session closed
+		}
+		go startInStream(transport.NewQUICSocketTransport(shared.acquire(), stm, keepAlive))
+	}
+}
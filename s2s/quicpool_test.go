@@ -0,0 +1,153 @@
+/*
+ * Copyright (c) 2018 Miguel Ángel Ortuño.
+ * See the LICENSE file for more information.
+ */
+
+package s2s
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/lucas-clemente/quic-go"
+	"github.com/ortuman/jackal/transport"
+	"github.com/stretchr/testify/require"
+)
+
+func TestQUICSessionPool_Multiplexing(t *testing.T) {
+	var sessions []*fakeQUICSession
+	dial := func() (quic.Session, error) {
+		cli, _ := newFakeQUICSessionPair()
+		sessions = append(sessions, cli)
+		return cli, nil
+	}
+	p := newQUICSessionPool()
+
+	sess1, stm1, reused, err := p.openStream("quic://127.0.0.1:5269", nil, dial)
+	require.Nil(t, err)
+	require.NotNil(t, stm1)
+	require.False(t, reused)
+
+	sess2, _, reused, err := p.openStream("quic://127.0.0.1:5269", nil, dial)
+	require.Nil(t, err)
+	require.True(t, reused)
+	require.Len(t, sessions, 1)
+	require.Equal(t, int32(2), sessions[0].opened)
+
+	// different remote address...
+	_, _, reused, err = p.openStream("quic://127.0.0.2:5269", nil, dial)
+	require.Nil(t, err)
+	require.False(t, reused)
+	require.Len(t, sessions, 2)
+
+	// closing a stream session keeps the rest of them alive
+	require.Nil(t, sess1.Close())
+	require.Nil(t, sess1.Close())
+	require.False(t, sessions[0].isClosed())
+
+	require.Nil(t, sess2.Close())
+	require.True(t, sessions[0].isClosed())
+
+	// closed session is dialed again
+	_, _, reused, err = p.openStream("quic://127.0.0.1:5269", nil, dial)
+	require.Nil(t, err)
+	require.False(t, reused)
+	require.Len(t, sessions, 3)
+}
+
+func TestQUICSessionPool_Reusable(t *testing.T) {
+	var sessions []*fakeQUICSession
+	dial := func() (quic.Session, error) {
+		cli, _ := newFakeQUICSessionPair()
+		sessions = append(sessions, cli)
+		return cli, nil
+	}
+	p := newQUICSessionPool()
+
+	sess1, _, _, err := p.openStream("quic://127.0.0.1:5269", nil, dial)
+	require.Nil(t, err)
+
+	// established session is not suitable... dial a new one
+	var checked []quic.Session
+	sess2, _, reused, err := p.openStream("quic://127.0.0.1:5269", func(sess quic.Session) bool {
+		checked = append(checked, sess)
+		return false
+	}, dial)
+	require.Nil(t, err)
+	require.False(t, reused)
+	require.Len(t, sessions, 2)
+	require.Equal(t, []quic.Session{sessions[0]}, checked)
+
+	// both of them remain shareable
+	sess3, _, reused, err := p.openStream("quic://127.0.0.1:5269", func(sess quic.Session) bool {
+		return sess == sessions[1]
+	}, dial)
+	require.Nil(t, err)
+	require.True(t, reused)
+	require.Equal(t, int32(2), sessions[1].opened)
+
+	// released sessions are removed from pool
+	_ = sess1.Close()
+	_ = sess2.Close()
+	_ = sess3.Close()
+	require.Len(t, p.entries, 0)
+
+	_, _, _, err = p.openStream("quic://127.0.0.2:5269", nil, func() (quic.Session, error) {
+		return nil, errors.New("dialer mocked error")
+	})
+	require.NotNil(t, err)
+	require.Len(t, p.entries, 0)
+}
+
+func TestQUICSessionPool_BrokenSession(t *testing.T) {
+	var sessions []*fakeQUICSession
+	dial := func() (quic.Session, error) {
+		cli, _ := newFakeQUICSessionPair()
+		sessions = append(sessions, cli)
+		return cli, nil
+	}
+	p := newQUICSessionPool()
+
+	sess, _, _, err := p.openStream("quic://127.0.0.1:5269", nil, dial)
+	require.Nil(t, err)
+
+	// remote peer closed the session... new stream triggers a new dial
+	_ = sessions[0].peer.Close()
+	_, _, reused, err := p.openStream("quic://127.0.0.1:5269", nil, dial)
+	require.Nil(t, err)
+	require.False(t, reused)
+	require.Len(t, sessions, 2)
+	_ = sess.Close()
+
+	mockedErr := errors.New("dialer mocked error")
+	_, _, _, err = p.openStream("quic://127.0.0.2:5269", nil, func() (quic.Session, error) {
+		return nil, mockedErr
+	})
+	require.Equal(t, mockedErr, err)
+}
+
+func TestAcceptQUICStreams(t *testing.T) {
+	cli, srv := newFakeQUICSessionPair()
+
+	trCh := make(chan transport.Transport, 2)
+	done := make(chan struct{})
+	go func() {
+		acceptQUICStreams(srv, time.Second, func(tr transport.Transport) { trCh <- tr })
+		close(done)
+	}()
+	_, _ = cli.OpenStreamSync()
+	_, _ = cli.OpenStreamSync()
+
+	tr1, tr2 := <-trCh, <-trCh
+	require.Equal(t, transport.QUIC, tr1.Type())
+
+	// closing an incoming stream does not tear down its session
+	_ = tr1.Close()
+	require.False(t, srv.isClosed())
+	_ = tr2.Close()
+	require.False(t, srv.isClosed())
+
+	_ = cli.Close()
+	<-done
+}
@@ -0,0 +1,318 @@
+/*
+ * Copyright (c) 2018 Miguel Ángel Ortuño.
+ * See the LICENSE file for more information.
+ */
+
+package s2s
+
+import (
+	"errors"
+	"fmt"
+	"math/rand"
+	"net"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/netsec-ethz/scion-apps/lib/scionutil"
+	libaddr "github.com/scionproto/scion/go/lib/addr"
+	"github.com/scionproto/scion/go/lib/snet"
+)
+
+const (
+	staticResolverName = "static"
+	rainsResolverName  = "rains"
+	srvResolverName    = "srv"
+)
+
+var defaultResolverOrder = []string{staticResolverName, rainsResolverName, srvResolverName}
+
+var errNoEndpoints = errors.New("s2s: no endpoints found")
+
+// endpointType represents the transport used to reach a remote endpoint.
+type endpointType int
+
+const (
+	scionEndpoint endpointType = iota
+	quicEndpoint
+	directTLSEndpoint
+	tcpEndpoint
+)
+
+// String returns endpointType string representation.
+func (t endpointType) String() string {
+	switch t {
+	case scionEndpoint:
+		return "scion"
+	case quicEndpoint:
+		return "quic"
+	case directTLSEndpoint:
+		return "direct_tls"
+	case tcpEndpoint:
+		return "tcp"
+	}
+	return ""
+}
+
+// endpoint represents a resolved remote server address.
+type endpoint struct {
+	typ       endpointType
+	address   string
+	scionAddr *snet.Addr
+}
+
+func (e endpoint) String() string {
+	if e.typ == scionEndpoint {
+		return e.typ.String() + "://" + e.scionAddr.String()
+	}
+	return e.typ.String() + "://" + e.address
+}
+
+// resolver resolves the endpoints through which a remote domain can be reached,
+// sorted by preference.
+type resolver interface {
+	resolve(domain string) ([]endpoint, error)
+}
+
+// newResolver builds the resolution chain described by s2s configuration.
+func newResolver(cfg *Config, srvResolve srvLookupFunc) resolver {
+	order := cfg.Resolver.Order
+	if len(order) == 0 {
+		order = defaultResolverOrder
+	}
+	var chain chainResolver
+	for _, name := range order {
+		switch name {
+		case staticResolverName:
+			chain = append(chain, newStaticResolver(cfg))
+		case rainsResolverName:
+			// SCION addresses are useless without a local SCION stack
+			if cfg.Scion != nil {
+				chain = append(chain, &rainsResolver{lookup: scionutil.GetHostByName})
+			}
+		case srvResolverName:
+			chain = append(chain, &srvResolver{cfg: cfg, lookup: srvResolve})
+		}
+	}
+	if cfg.Resolver.CacheTTL > 0 {
+		return newCachedResolver(chain, cfg.Resolver.CacheTTL)
+	}
+	return chain
+}
+
+// chainResolver aggregates the endpoints returned by all its strategies,
+// in order, so that dialer can fail over to next one.
+type chainResolver []resolver
+
+func (c chainResolver) resolve(domain string) ([]endpoint, error) {
+	var ret []endpoint
+	var lastErr error
+	for _, r := range c {
+		endpoints, err := r.resolve(domain)
+		if err != nil {
+			lastErr = err
+			continue
+		}
+		ret = append(ret, endpoints...)
+	}
+	if len(ret) == 0 {
+		if lastErr != nil {
+			return nil, lastErr
+		}
+		return nil, errNoEndpoints
+	}
+	return ret, nil
+}
+
+// staticResolver resolves domains from configured hosts map.
+type staticResolver struct {
+	hosts map[string][]endpoint
+}
+
+func newStaticResolver(cfg *Config) *staticResolver {
+	r := &staticResolver{hosts: make(map[string][]endpoint)}
+	if cfg.QUIC != nil {
+		for domain, address := range cfg.QUIC.Peers {
+			r.hosts[domain] = append(r.hosts[domain], endpoint{typ: quicEndpoint, address: address})
+		}
+	}
+	for domain, addresses := range cfg.Resolver.Hosts {
+		for _, address := range addresses {
+			// addresses are validated while loading configuration
+			ep, _ := parseStaticEndpoint(address)
+			r.hosts[domain] = append(r.hosts[domain], ep)
+		}
+	}
+	return r
+}
+
+func (r *staticResolver) resolve(domain string) ([]endpoint, error) {
+	return r.hosts[domain], nil
+}
+
+// parseStaticEndpoint parses either a SCION address (e.g. 1-ff00:0:110,[10.0.0.1]:52690)
+// or an IP host and port pair (e.g. 10.0.0.1:5269).
+func parseStaticEndpoint(address string) (endpoint, error) {
+	if scionAddr, err := snet.AddrFromString(address); err == nil {
+		if scionAddr.Host.L4 == nil {
+			scionAddr.Host.L4 = libaddr.NewL4UDPInfo(defaultScionTransportPort)
+		}
+		return endpoint{typ: scionEndpoint, scionAddr: scionAddr}, nil
+	}
+	if _, _, err := net.SplitHostPort(address); err != nil {
+		return endpoint{}, fmt.Errorf("invalid host address %s: %v", address, err)
+	}
+	return endpoint{typ: tcpEndpoint, address: address}, nil
+}
+
+// rainsResolver resolves domains SCION addresses by means of RAINS.
+type rainsResolver struct {
+	lookup func(host string) (libaddr.IA, libaddr.HostAddr, error)
+}
+
+func (r *rainsResolver) resolve(domain string) ([]endpoint, error) {
+	host, port, err := net.SplitHostPort(domain)
+	if err != nil {
+		host = domain
+		port = strconv.Itoa(defaultScionTransportPort)
+	}
+	ia, l3, err := r.lookup(host)
+	if err != nil {
+		return nil, nil // not a SCION domain
+	}
+	p, err := strconv.ParseUint(port, 10, 16)
+	if err != nil {
+		p = defaultScionTransportPort
+	}
+	l4 := libaddr.NewL4UDPInfo(uint16(p))
+	return []endpoint{{typ: scionEndpoint, scionAddr: &snet.Addr{IA: ia, Host: &libaddr.AppAddr{L3: l3, L4: l4}}}}, nil
+}
+
+type srvLookupFunc func(service, proto, name string) (cname string, addrs []*net.SRV, err error)
+
+// srvResolver resolves domains by means of DNS SRV records, trying
+// QUIC (if enabled), XEP-0368 direct TLS and STARTTLS services in that order.
+type srvResolver struct {
+	cfg    *Config
+	lookup srvLookupFunc
+}
+
+func (r *srvResolver) resolve(domain string) ([]endpoint, error) {
+	var ret []endpoint
+	if r.cfg.QUIC != nil {
+		ret = append(ret, r.lookupService(r.cfg.QUIC.SRVService, "udp", domain, quicEndpoint)...)
+	}
+	ret = append(ret, r.lookupService("xmpps-server", "tcp", domain, directTLSEndpoint)...)
+
+	tcpEndpoints := r.lookupService("xmpp-server", "tcp", domain, tcpEndpoint)
+	if len(tcpEndpoints) == 0 {
+		// RFC 6120: fall back to domain's A/AAAA records
+		tcpEndpoints = []endpoint{{typ: tcpEndpoint, address: net.JoinHostPort(domain, strconv.Itoa(defaultTransportPort))}}
+	}
+	return append(ret, tcpEndpoints...), nil
+}
+
+func (r *srvResolver) lookupService(service, proto, domain string, typ endpointType) []endpoint {
+	_, addrs, err := r.lookup(service, proto, domain)
+	if err != nil || len(addrs) == 0 || len(addrs) == 1 && addrs[0].Target == "." {
+		return nil
+	}
+	var ret []endpoint
+	for _, addr := range orderSRV(addrs) {
+		target := strings.TrimSuffix(addr.Target, ".")
+		ret = append(ret, endpoint{typ: typ, address: net.JoinHostPort(target, strconv.Itoa(int(addr.Port)))})
+	}
+	return ret
+}
+
+// orderSRV sorts SRV records as described in RFC 2782: lowest priority first,
+// randomly choosing among same priority records in proportion to their weight.
+func orderSRV(addrs []*net.SRV) []*net.SRV {
+	sorted := make([]*net.SRV, len(addrs))
+	copy(sorted, addrs)
+	sort.SliceStable(sorted, func(i, j int) bool { return sorted[i].Priority < sorted[j].Priority })
+
+	ret := make([]*net.SRV, 0, len(sorted))
+	for i := 0; i < len(sorted); {
+		j := i
+		for j < len(sorted) && sorted[j].Priority == sorted[i].Priority {
+			j++
+		}
+		ret = append(ret, shuffleByWeight(sorted[i:j])...)
+		i = j
+	}
+	return ret
+}
+
+func shuffleByWeight(addrs []*net.SRV) []*net.SRV {
+	// zero weight records are placed at the beginning, so that they
+	// have a very small chance of being selected (RFC 2782)
+	pending := make([]*net.SRV, 0, len(addrs))
+	for _, addr := range addrs {
+		if addr.Weight == 0 {
+			pending = append(pending, addr)
+		}
+	}
+	for _, addr := range addrs {
+		if addr.Weight > 0 {
+			pending = append(pending, addr)
+		}
+	}
+	ret := make([]*net.SRV, 0, len(addrs))
+	for len(pending) > 0 {
+		var sum int
+		for _, addr := range pending {
+			sum += int(addr.Weight)
+		}
+		var idx int
+		if sum > 0 {
+			n := rand.Intn(sum + 1)
+			for idx = 0; idx < len(pending)-1; idx++ {
+				n -= int(pending[idx].Weight)
+				if n <= 0 {
+					break
+				}
+			}
+		}
+		ret = append(ret, pending[idx])
+		pending = append(pending[:idx], pending[idx+1:]...)
+	}
+	return ret
+}
+
+type cacheEntry struct {
+	endpoints []endpoint
+	expiresAt time.Time
+}
+
+// cachedResolver caches successful resolutions for a given amount of time.
+type cachedResolver struct {
+	r       resolver
+	ttl     time.Duration
+	now     func() time.Time
+	mu      sync.RWMutex
+	entries map[string]cacheEntry
+}
+
+func newCachedResolver(r resolver, ttl time.Duration) *cachedResolver {
+	return &cachedResolver{r: r, ttl: ttl, now: time.Now, entries: make(map[string]cacheEntry)}
+}
+
+func (c *cachedResolver) resolve(domain string) ([]endpoint, error) {
+	c.mu.RLock()
+	entry, ok := c.entries[domain]
+	c.mu.RUnlock()
+	if ok && c.now().Before(entry.expiresAt) {
+		return entry.endpoints, nil
+	}
+	endpoints, err := c.r.resolve(domain)
+	if err != nil {
+		return nil, err
+	}
+	c.mu.Lock()
+	c.entries[domain] = cacheEntry{endpoints: endpoints, expiresAt: c.now().Add(c.ttl)}
+	c.mu.Unlock()
+	return endpoints, nil
+}
@@ -0,0 +1,198 @@
+/*
+ * Copyright (c) 2018 Miguel Ángel Ortuño.
+ * See the LICENSE file for more information.
+ */
+
+package s2s
+
+import (
+	"errors"
+	"net"
+	"testing"
+	"time"
+
+	libaddr "github.com/scionproto/scion/go/lib/addr"
+	"github.com/stretchr/testify/require"
+)
+
+func TestResolver_Static(t *testing.T) {
+	_, err := parseStaticEndpoint("jabber.org")
+	require.NotNil(t, err)
+
+	ep, err := parseStaticEndpoint("127.0.0.1:5269")
+	require.Nil(t, err)
+	require.Equal(t, tcpEndpoint, ep.typ)
+	require.Equal(t, "tcp://127.0.0.1:5269", ep.String())
+
+	ep, err = parseStaticEndpoint("1-ff00:0:110,[127.0.0.1]")
+	require.Nil(t, err)
+	require.Equal(t, scionEndpoint, ep.typ)
+	require.Equal(t, uint16(defaultScionTransportPort), ep.scionAddr.Host.L4.Port())
+
+	r := newStaticResolver(&Config{
+		QUIC: &QUICConfig{Peers: map[string]string{"jabber.org": "127.0.0.1:5271"}},
+		Resolver: ResolverConfig{
+			Hosts: map[string][]string{"jabber.org": {"1-ff00:0:110,[127.0.0.1]:52690", "127.0.0.1:5269"}},
+		},
+	})
+	endpoints, err := r.resolve("jabber.org")
+	require.Nil(t, err)
+	require.Len(t, endpoints, 3)
+	require.Equal(t, quicEndpoint, endpoints[0].typ)
+	require.Equal(t, scionEndpoint, endpoints[1].typ)
+	require.Equal(t, tcpEndpoint, endpoints[2].typ)
+
+	endpoints, err = r.resolve("jackal.im")
+	require.Nil(t, err)
+	require.Len(t, endpoints, 0)
+}
+
+func TestResolver_RAINS(t *testing.T) {
+	ia, _ := libaddr.IAFromString("1-ff00:0:110")
+	r := &rainsResolver{lookup: func(host string) (libaddr.IA, libaddr.HostAddr, error) {
+		if host != "jabber.org" {
+			return libaddr.IA{}, nil, errors.New("not found")
+		}
+		return ia, libaddr.HostFromIPStr("127.0.0.1"), nil
+	}}
+	endpoints, err := r.resolve("jackal.im")
+	require.Nil(t, err)
+	require.Len(t, endpoints, 0)
+
+	endpoints, err = r.resolve("jabber.org")
+	require.Nil(t, err)
+	require.Len(t, endpoints, 1)
+	require.Equal(t, scionEndpoint, endpoints[0].typ)
+	require.Equal(t, ia, endpoints[0].scionAddr.IA)
+	require.Equal(t, uint16(defaultScionTransportPort), endpoints[0].scionAddr.Host.L4.Port())
+
+	endpoints, err = r.resolve("jabber.org:1234")
+	require.Nil(t, err)
+	require.Equal(t, uint16(1234), endpoints[0].scionAddr.Host.L4.Port())
+}
+
+func TestResolver_SRV(t *testing.T) {
+	cfg := &Config{QUIC: &QUICConfig{SRVService: defaultQUICSRVService}}
+	r := &srvResolver{cfg: cfg, lookup: tUtilSRVLookup(map[string][]*net.SRV{
+		defaultQUICSRVService: {{Target: "quic.jabber.org.", Port: 5269}},
+		"xmpps-server":        {{Target: "tls.jabber.org.", Port: 5270}},
+		"xmpp-server": {
+			{Target: "xmpp2.jabber.org.", Port: 5269, Priority: 20},
+			{Target: "xmpp1.jabber.org.", Port: 5269, Priority: 10},
+		},
+	})}
+	endpoints, err := r.resolve("jabber.org")
+	require.Nil(t, err)
+	require.Equal(t, []endpoint{
+		{typ: quicEndpoint, address: "quic.jabber.org:5269"},
+		{typ: directTLSEndpoint, address: "tls.jabber.org:5270"},
+		{typ: tcpEndpoint, address: "xmpp1.jabber.org:5269"},
+		{typ: tcpEndpoint, address: "xmpp2.jabber.org:5269"},
+	}, endpoints)
+
+	// no records... fall back to domain address
+	r = &srvResolver{cfg: &Config{}, lookup: tUtilSRVLookup(map[string][]*net.SRV{
+		"xmpps-server": {{Target: ".", Port: 0}},
+	})}
+	endpoints, err = r.resolve("jabber.org")
+	require.Nil(t, err)
+	require.Equal(t, []endpoint{{typ: tcpEndpoint, address: "jabber.org:5269"}}, endpoints)
+}
+
+func TestResolver_OrderSRV(t *testing.T) {
+	addrs := []*net.SRV{
+		{Target: "c", Priority: 30, Weight: 10},
+		{Target: "b1", Priority: 20, Weight: 0},
+		{Target: "a", Priority: 10, Weight: 5},
+		{Target: "b2", Priority: 20, Weight: 50},
+	}
+	for i := 0; i < 20; i++ {
+		sorted := orderSRV(addrs)
+		require.Len(t, sorted, 4)
+		require.Equal(t, "a", sorted[0].Target)
+		require.Contains(t, []string{"b1", "b2"}, sorted[1].Target)
+		require.Contains(t, []string{"b1", "b2"}, sorted[2].Target)
+		require.NotEqual(t, sorted[1].Target, sorted[2].Target)
+		require.Equal(t, "c", sorted[3].Target)
+	}
+	// heavier records are selected first most of the time
+	var heavierFirst int
+	for i := 0; i < 1000; i++ {
+		if orderSRV(addrs)[1].Target == "b2" {
+			heavierFirst++
+		}
+	}
+	require.True(t, heavierFirst > 900)
+
+	// input slice is left untouched
+	require.Equal(t, "c", addrs[0].Target)
+}
+
+func TestResolver_Chain(t *testing.T) {
+	mockedErr := errors.New("resolver mocked error")
+	c := chainResolver{
+		fakeResolver{{typ: scionEndpoint}},
+		&errResolver{err: mockedErr},
+		fakeResolver{{typ: tcpEndpoint, address: "127.0.0.1:5269"}},
+	}
+	endpoints, err := c.resolve("jabber.org")
+	require.Nil(t, err)
+	require.Len(t, endpoints, 2)
+	require.Equal(t, scionEndpoint, endpoints[0].typ)
+	require.Equal(t, tcpEndpoint, endpoints[1].typ)
+
+	_, err = chainResolver{&errResolver{err: mockedErr}}.resolve("jabber.org")
+	require.Equal(t, mockedErr, err)
+
+	_, err = chainResolver{fakeResolver{}}.resolve("jabber.org")
+	require.Equal(t, errNoEndpoints, err)
+
+	// RAINS strategy requires SCION transport
+	r := newResolver(&Config{Resolver: ResolverConfig{Order: []string{rainsResolverName, srvResolverName}}}, tUtilSRVLookup(nil))
+	require.Len(t, r.(chainResolver), 1)
+
+	r = newResolver(&Config{Scion: &ScionConfig{}, Resolver: ResolverConfig{CacheTTL: time.Minute}}, tUtilSRVLookup(nil))
+	require.Len(t, r.(*cachedResolver).r.(chainResolver), 3)
+}
+
+func TestResolver_Cache(t *testing.T) {
+	er := &errResolver{endpoints: []endpoint{{typ: tcpEndpoint, address: "127.0.0.1:5269"}}}
+	now := time.Now()
+	c := newCachedResolver(er, time.Minute)
+	c.now = func() time.Time { return now }
+
+	endpoints, err := c.resolve("jabber.org")
+	require.Nil(t, err)
+	require.Len(t, endpoints, 1)
+	require.Equal(t, 1, er.calls)
+
+	_, _ = c.resolve("jabber.org")
+	require.Equal(t, 1, er.calls)
+
+	// expired entry...
+	now = now.Add(time.Minute)
+	_, _ = c.resolve("jabber.org")
+	require.Equal(t, 2, er.calls)
+
+	// errors are not cached
+	er.err = errors.New("resolver mocked error")
+	_, err = c.resolve("jackal.im")
+	require.NotNil(t, err)
+	_, err = c.resolve("jackal.im")
+	require.NotNil(t, err)
+	require.Equal(t, 4, er.calls)
+}
+
+type errResolver struct {
+	endpoints []endpoint
+	err       error
+	calls     int
+}
+
+func (r *errResolver) resolve(_ string) ([]endpoint, error) {
+	r.calls++
+	if r.err != nil {
+		return nil, r.err
+	}
+	return r.endpoints, nil
+}
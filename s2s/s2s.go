@@ -21,6 +21,10 @@ const (
 	tlsNamespace      = "urn:ietf:params:xml:ns:xmpp-tls"
 	saslNamespace     = "urn:ietf:params:xml:ns:xmpp-sasl"
 	dialbackNamespace = "urn:xmpp:features:dialback"
+	pingNamespace     = "urn:xmpp:ping"
+
+	// XEP-0368 ALPN protocol name
+	directTLSProtocol = "xmpp-server"
 )
 
 type s2sServer interface {
@@ -32,18 +36,21 @@ type s2sServer interface {
 }
 
 var createS2SServer = func(config *Config, mods *module.Modules, router *router.Router) s2sServer {
-	s := server{
+	s := &server{
 		cfg:    config,
 		router: router,
 		mods:   mods,
 		dialer: newDialer(config, router),
 	}
+	if config.Queue != nil {
+		s.queues = newOutQueues(config.Queue, router, s, config.DialTimeout)
+	}
 	if config.Scion != nil {
 		return &scionServer{
 			server: s,
 		}
 	}
-	return &s
+	return s
 }
 
 // S2S represents a server-to-server connection manager.
@@ -0,0 +1,268 @@
+/*
+ * Copyright (c) 2018 Miguel Ángel Ortuño.
+ * See the LICENSE file for more information.
+ */
+
+package s2s
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	libaddr "github.com/scionproto/scion/go/lib/addr"
+	"github.com/scionproto/scion/go/lib/overlay"
+	"github.com/scionproto/scion/go/lib/sciond"
+	"github.com/scionproto/scion/go/lib/snet"
+	"github.com/scionproto/scion/go/lib/spath"
+)
+
+const (
+	pathQueryTimeout = time.Duration(5) * time.Second
+	pathDownTimeout  = time.Duration(1) * time.Minute
+)
+
+// default path policy key
+const defaultPathPolicyDomain = "*"
+
+var errSCIONNetworkNotInitialized = errors.New("s2s: SCION network not initialized")
+
+// PathPreference represents a SCION path ordering criteria.
+type PathPreference int
+
+const (
+	// PreferHops prefers paths traversing fewer ASes.
+	PreferHops PathPreference = iota
+
+	// PreferLatency prefers paths with lowest latency.
+	PreferLatency
+
+	// PreferMTU prefers paths with highest MTU.
+	PreferMTU
+)
+
+// String returns PathPreference string representation.
+func (p PathPreference) String() string {
+	switch p {
+	case PreferHops:
+		return "hops"
+	case PreferLatency:
+		return "latency"
+	case PreferMTU:
+		return "mtu"
+	}
+	return ""
+}
+
+// PathPolicy represents a SCION path selection policy.
+type PathPolicy struct {
+	Allow  []libaddr.IA
+	Deny   []libaddr.IA
+	Prefer PathPreference
+}
+
+// allows returns whether or not every AS traversed by path
+// is allowed by the policy.
+func (p *PathPolicy) allows(path *scionPath) bool {
+	for _, ia := range path.ases {
+		if matchesIA(p.Deny, ia) {
+			return false
+		}
+		if len(p.Allow) > 0 && !matchesIA(p.Allow, ia) {
+			return false
+		}
+	}
+	return true
+}
+
+// matchesIA reports whether ia matches any of the patterns,
+// where a zero ISD or AS acts as a wildcard.
+func matchesIA(patterns []libaddr.IA, ia libaddr.IA) bool {
+	for _, pattern := range patterns {
+		if (pattern.I == 0 || pattern.I == ia.I) && (pattern.A == 0 || pattern.A == ia.A) {
+			return true
+		}
+	}
+	return false
+}
+
+// scionPath represents a candidate SCION path towards a remote AS.
+type scionPath struct {
+	key     string
+	ases    []libaddr.IA
+	mtu     uint16
+	latency time.Duration // zero if unknown
+	path    *spath.Path
+	nextHop *overlay.OverlayAddr
+}
+
+func (p *scionPath) hops() int {
+	return len(p.ases)
+}
+
+func (p *scionPath) String() string {
+	ases := make([]string, len(p.ases))
+	for i, ia := range p.ases {
+		ases[i] = ia.String()
+	}
+	return fmt.Sprintf("[%s] mtu=%d", strings.Join(ases, " > "), p.mtu)
+}
+
+// pathProvider provides the available SCION paths between two ASes.
+type pathProvider interface {
+	paths(src, dst libaddr.IA) ([]*scionPath, error)
+}
+
+// sciondPathProvider queries paths to SCION daemon
+// through the default SCION network.
+type sciondPathProvider struct{}
+
+func (p *sciondPathProvider) paths(src, dst libaddr.IA) ([]*scionPath, error) {
+	if snet.DefNetwork == nil {
+		return nil, errSCIONNetworkNotInitialized
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), pathQueryTimeout)
+	defer cancel()
+
+	var ret []*scionPath
+	aps := snet.DefNetwork.PathResolver().Query(ctx, src, dst, sciond.PathReqFlags{})
+	for _, ap := range aps {
+		entry := ap.Entry
+		nextHop, err := entry.HostInfo.Overlay()
+		if err != nil {
+			continue
+		}
+		path := spath.New(entry.Path.FwdPath)
+		if err := path.InitOffsets(); err != nil {
+			continue
+		}
+		var ases []libaddr.IA
+		for _, iface := range entry.Path.Interfaces {
+			if ia := iface.IA(); len(ases) == 0 || !ases[len(ases)-1].Equal(ia) {
+				ases = append(ases, ia)
+			}
+		}
+		ret = append(ret, &scionPath{
+			key:     string(ap.Key()),
+			ases:    ases,
+			mtu:     entry.Path.Mtu,
+			path:    path,
+			nextHop: nextHop,
+		})
+	}
+	return ret, nil
+}
+
+// pathSelector selects the SCION paths used to reach remote domains
+// according to configured path policies.
+type pathSelector struct {
+	provider pathProvider
+	policies map[string]PathPolicy
+	now      func() time.Time
+
+	mu      sync.RWMutex
+	down    map[string]time.Time
+	latency map[string]time.Duration
+}
+
+func newPathSelector(provider pathProvider, policies map[string]PathPolicy) *pathSelector {
+	return &pathSelector{
+		provider: provider,
+		policies: policies,
+		now:      time.Now,
+		down:     make(map[string]time.Time),
+		latency:  make(map[string]time.Duration),
+	}
+}
+
+// selectPaths returns remote domain allowed paths sorted by preference.
+// Paths that recently failed are placed at the end of the list.
+func (s *pathSelector) selectPaths(domain string, src, dst libaddr.IA) ([]*scionPath, error) {
+	paths, err := s.provider.paths(src, dst)
+	if err != nil {
+		return nil, err
+	}
+	policy := s.policy(domain)
+
+	var allowed, down []*scionPath
+	s.mu.RLock()
+	for _, p := range paths {
+		if !policy.allows(p) {
+			continue
+		}
+		cp := *p
+		p = &cp
+		if p.latency == 0 {
+			p.latency = s.latency[p.key]
+		}
+		if t, ok := s.down[p.key]; ok && s.now().Sub(t) < pathDownTimeout {
+			down = append(down, p)
+			continue
+		}
+		allowed = append(allowed, p)
+	}
+	s.mu.RUnlock()
+
+	if len(allowed)+len(down) == 0 {
+		return nil, fmt.Errorf("s2s: no SCION path to %s allowed by path policy", domain)
+	}
+	sortPaths(allowed, policy.Prefer)
+	sortPaths(down, policy.Prefer)
+	return append(allowed, down...), nil
+}
+
+// markDown flags path as broken, so that alternate paths are preferred.
+func (s *pathSelector) markDown(p *scionPath) {
+	s.mu.Lock()
+	s.down[p.key] = s.now()
+	s.mu.Unlock()
+}
+
+// observe records a successful use of path along with its measured latency.
+func (s *pathSelector) observe(p *scionPath, latency time.Duration) {
+	s.mu.Lock()
+	delete(s.down, p.key)
+	s.latency[p.key] = latency
+	s.mu.Unlock()
+}
+
+// allows tells whether path satisfies remote domain path policy.
+// A nil path (same AS) is always allowed.
+func (s *pathSelector) allows(domain string, p *scionPath) bool {
+	return p == nil || s.policy(domain).allows(p)
+}
+
+func (s *pathSelector) policy(domain string) *PathPolicy {
+	if policy, ok := s.policies[domain]; ok {
+		return &policy
+	}
+	if policy, ok := s.policies[defaultPathPolicyDomain]; ok {
+		return &policy
+	}
+	return &PathPolicy{}
+}
+
+func sortPaths(paths []*scionPath, prefer PathPreference) {
+	sort.SliceStable(paths, func(i, j int) bool {
+		pi, pj := paths[i], paths[j]
+		switch prefer {
+		case PreferLatency:
+			// paths of unknown latency go after measured ones
+			if pi.latency != pj.latency {
+				if pi.latency == 0 || pj.latency == 0 {
+					return pj.latency == 0
+				}
+				return pi.latency < pj.latency
+			}
+		case PreferMTU:
+			if pi.mtu != pj.mtu {
+				return pi.mtu > pj.mtu
+			}
+		}
+		return pi.hops() < pj.hops()
+	})
+}
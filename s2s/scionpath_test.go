@@ -0,0 +1,138 @@
+/*
+ * Copyright (c) 2018 Miguel Ángel Ortuño.
+ * See the LICENSE file for more information.
+ */
+
+package s2s
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	libaddr "github.com/scionproto/scion/go/lib/addr"
+	"github.com/stretchr/testify/require"
+)
+
+type fakePathProvider struct {
+	list []*scionPath
+	err  error
+}
+
+func (p *fakePathProvider) paths(_, _ libaddr.IA) ([]*scionPath, error) {
+	return p.list, p.err
+}
+
+func TestPathPolicy_Allows(t *testing.T) {
+	path := tUtilSCIONPath(t, "a", 1472, "1-ff00:0:110", "1-ff00:0:111", "2-ff00:0:210")
+
+	require.True(t, (&PathPolicy{}).allows(path))
+
+	// deny lists
+	require.False(t, (&PathPolicy{Deny: tUtilIAs(t, "1-ff00:0:111")}).allows(path))
+	require.False(t, (&PathPolicy{Deny: tUtilIAs(t, "2-0")}).allows(path))
+	require.True(t, (&PathPolicy{Deny: tUtilIAs(t, "3-0")}).allows(path))
+
+	// allow lists (every traversed AS must be allowed)
+	require.False(t, (&PathPolicy{Allow: tUtilIAs(t, "1-0")}).allows(path))
+	require.True(t, (&PathPolicy{Allow: tUtilIAs(t, "1-0", "2-ff00:0:210")}).allows(path))
+	require.True(t, (&PathPolicy{Allow: tUtilIAs(t, "0-0")}).allows(path))
+
+	// deny takes precedence over allow
+	require.False(t, (&PathPolicy{Allow: tUtilIAs(t, "0-0"), Deny: tUtilIAs(t, "1-ff00:0:111")}).allows(path))
+}
+
+func TestPathSelector_Preference(t *testing.T) {
+	short := tUtilSCIONPath(t, "short", 1280, "1-ff00:0:110", "1-ff00:0:112")
+	long := tUtilSCIONPath(t, "long", 1472, "1-ff00:0:110", "1-ff00:0:111", "1-ff00:0:112")
+	fast := tUtilSCIONPath(t, "fast", 1400, "1-ff00:0:110", "1-ff00:0:113", "1-ff00:0:114", "1-ff00:0:112")
+	fast.latency = time.Millisecond * 10
+	provider := &fakePathProvider{list: []*scionPath{fast, long, short}}
+
+	src, dst := tUtilIAs(t, "1-ff00:0:110")[0], tUtilIAs(t, "1-ff00:0:112")[0]
+	s := newPathSelector(provider, map[string]PathPolicy{
+		"jabber.org":  {Prefer: PreferMTU},
+		"jackal.im":   {Prefer: PreferLatency},
+		"example.org": {Deny: tUtilIAs(t, "1-ff00:0:112")},
+		"*":           {Deny: tUtilIAs(t, "1-ff00:0:113")},
+	})
+	// default policy (fewest hops)...
+	paths, err := s.selectPaths("default.org", src, dst)
+	require.Nil(t, err)
+	require.Equal(t, []string{"short", "long"}, tUtilPathKeys(paths))
+
+	// highest MTU...
+	paths, err = s.selectPaths("jabber.org", src, dst)
+	require.Nil(t, err)
+	require.Equal(t, []string{"long", "fast", "short"}, tUtilPathKeys(paths))
+
+	// lowest latency... unknown latency paths ranked by hops
+	paths, err = s.selectPaths("jackal.im", src, dst)
+	require.Nil(t, err)
+	require.Equal(t, []string{"fast", "short", "long"}, tUtilPathKeys(paths))
+
+	s.observe(long, time.Millisecond*5)
+	paths, err = s.selectPaths("jackal.im", src, dst)
+	require.Nil(t, err)
+	require.Equal(t, []string{"long", "fast", "short"}, tUtilPathKeys(paths))
+	require.Equal(t, time.Duration(0), long.latency) // provider paths are left untouched
+
+	// geofenced destination...
+	_, err = s.selectPaths("example.org", src, dst)
+	require.NotNil(t, err)
+
+	// provider error...
+	provider.err = errors.New("path provider mocked error")
+	_, err = s.selectPaths("jabber.org", src, dst)
+	require.Equal(t, provider.err, err)
+}
+
+func TestPathSelector_Failover(t *testing.T) {
+	p1 := tUtilSCIONPath(t, "p1", 1472, "1-ff00:0:110", "1-ff00:0:112")
+	p2 := tUtilSCIONPath(t, "p2", 1472, "1-ff00:0:110", "1-ff00:0:111", "1-ff00:0:112")
+
+	now := time.Now()
+	s := newPathSelector(&fakePathProvider{list: []*scionPath{p1, p2}}, nil)
+	s.now = func() time.Time { return now }
+
+	src, dst := tUtilIAs(t, "1-ff00:0:110")[0], tUtilIAs(t, "1-ff00:0:112")[0]
+	paths, _ := s.selectPaths("jabber.org", src, dst)
+	require.Equal(t, []string{"p1", "p2"}, tUtilPathKeys(paths))
+
+	// broken path is tried last
+	s.markDown(p1)
+	paths, _ = s.selectPaths("jabber.org", src, dst)
+	require.Equal(t, []string{"p2", "p1"}, tUtilPathKeys(paths))
+
+	// ...until it's considered up again
+	now = now.Add(pathDownTimeout)
+	paths, _ = s.selectPaths("jabber.org", src, dst)
+	require.Equal(t, []string{"p1", "p2"}, tUtilPathKeys(paths))
+
+	s.markDown(p1)
+	s.observe(p1, time.Millisecond)
+	paths, _ = s.selectPaths("jabber.org", src, dst)
+	require.Equal(t, []string{"p1", "p2"}, tUtilPathKeys(paths))
+}
+
+func tUtilSCIONPath(t *testing.T, key string, mtu uint16, ases ...string) *scionPath {
+	return &scionPath{key: key, mtu: mtu, ases: tUtilIAs(t, ases...)}
+}
+
+func tUtilIAs(t *testing.T, ias ...string) []libaddr.IA {
+	var ret []libaddr.IA
+	for _, s := range ias {
+		ia, err := libaddr.IAFromString(s)
+		require.Nil(t, err)
+		ret = append(ret, ia)
+	}
+	return ret
+}
+
+func tUtilPathKeys(paths []*scionPath) []string {
+	var ret []string
+	for _, p := range paths {
+		ret = append(ret, p.key)
+	}
+	return ret
+}
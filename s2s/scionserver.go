@@ -18,7 +18,7 @@ import (
 )
 
 type scionServer struct {
-	server
+	*server
 	lnQUIC         quic.Listener
 	listeningSCION uint32
 }
@@ -64,12 +64,7 @@ func (s *scionServer) listenScionConn(address *snet.Addr) error {
 		conn, err := s.lnQUIC.Accept()
 		if err == nil {
 			log.Infof("New SCION connection")
-			accStream, err := conn.AcceptStream()
-			if err != nil {
-				log.Infof("No streams opened by the dialer")
-			}
-			go s.startInStream(transport.NewQUICSocketTransport(conn, accStream,
-				s.cfg.Scion.KeepAlive))
+			go acceptQUICStreams(conn, s.cfg.Scion.KeepAlive, s.startInStream)
 			continue
 		}
 	}
@@ -83,7 +78,11 @@ func (s *scionServer) startInStream(tr transport.Transport) {
 		transport:      tr,
 		connectTimeout: s.cfg.ConnectTimeout,
 		maxStanzaSize:  s.cfg.MaxStanzaSize,
+		rootCAs:        s.cfg.RootCAs,
+		requireTLSAuth: s.cfg.RequireTLSAuth,
 		dialer:         s.dialer,
+		whitespace:     s.cfg.WhitespaceInterval,
+		onPong:         s.handlePong,
 		onInDisconnect: s.unregisterInStream,
 	}, s.mods, s.router, true)
 	s.registerInStream(stm)
@@ -7,37 +7,67 @@ package s2s
 
 import (
 	"context"
+	"crypto/tls"
 	"net"
 	"strconv"
 	"sync"
 	"sync/atomic"
 
+	"github.com/lucas-clemente/quic-go"
 	streamerror "github.com/ortuman/jackal/errors"
 	"github.com/ortuman/jackal/log"
 	"github.com/ortuman/jackal/module"
 	"github.com/ortuman/jackal/router"
 	"github.com/ortuman/jackal/stream"
 	"github.com/ortuman/jackal/transport"
+	"github.com/ortuman/jackal/xmpp"
 )
 
 var listenerProvider = net.Listen
 
+var quicListenerProvider = quic.ListenAddr
+
 type server struct {
 	cfg       *Config
 	router    *router.Router
 	mods      *module.Modules
 	dialer    *dialer
+	queues    *outQueues
 	inConns   sync.Map
 	outConns  sync.Map
 	ln        net.Listener
+	tlsLn     net.Listener
+	quicLn    quic.Listener
 	listening uint32
 }
 
 func (s *server) start() {
+	if s.queues != nil {
+		// resume delivery of stanzas queued before last shutdown
+		if err := s.queues.restore(); err != nil {
+			log.Error(err)
+		}
+	}
 	bindAddr := s.cfg.Transport.BindAddress
 	port := s.cfg.Transport.Port
 	address := bindAddr + ":" + strconv.Itoa(port)
 
+	if tlsPort := s.cfg.Transport.DirectTLSPort; tlsPort > 0 {
+		tlsAddress := bindAddr + ":" + strconv.Itoa(tlsPort)
+		log.Infof("s2s_in: listening at %s [direct TLS]", tlsAddress)
+
+		if err := s.listenDirectTLSConn(tlsAddress); err != nil {
+			log.Fatalf("%v", err)
+		}
+	}
+	if quicCfg := s.cfg.QUIC; quicCfg != nil {
+		quicAddress := quicCfg.BindAddress + ":" + strconv.Itoa(quicCfg.Port)
+		log.Infof("s2s_in: listening at %s [quic]", quicAddress)
+
+		if err := s.listenQUICConn(quicAddress); err != nil {
+			log.Fatalf("%v", err)
+		}
+	}
 	log.Infof("s2s_in: listening at %s", address)
 
 	if err := s.listenConn(address); err != nil {
@@ -51,6 +81,16 @@ func (s *server) shutdown(ctx context.Context) error {
 		if err := s.ln.Close(); err != nil {
 			return err
 		}
+		if s.tlsLn != nil {
+			if err := s.tlsLn.Close(); err != nil {
+				return err
+			}
+		}
+		if s.quicLn != nil {
+			if err := s.quicLn.Close(); err != nil {
+				return err
+			}
+		}
 		// close all connections...
 		c, err := closeConnections(ctx, &s.outConns)
 		if err != nil {
@@ -78,17 +118,93 @@ func (s *server) listenConn(address string) error {
 	for atomic.LoadUint32(&s.listening) == 1 {
 		conn, err := ln.Accept()
 		if err == nil {
-			go s.startInStream(transport.NewSocketTransport(conn, s.cfg.Transport.KeepAlive))
+			go s.startInStream(transport.NewSocketTransport(conn, s.cfg.Transport.KeepAlive), false)
 			continue
 		}
 	}
 	return nil
 }
 
+// XEP-0368: SRV records for XMPP over TLS
+func (s *server) listenDirectTLSConn(address string) error {
+	ln, err := listenerProvider("tcp", address)
+	if err != nil {
+		return err
+	}
+	s.tlsLn = tls.NewListener(ln, &tls.Config{
+		Certificates:   s.router.Certificates(),
+		GetCertificate: s.router.GetCertificate,
+		ClientAuth:     tls.RequestClientCert,
+		NextProtos:     []string{directTLSProtocol},
+	})
+	go func(ln net.Listener) {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				if ne, ok := err.(net.Error); ok && ne.Temporary() {
+					continue
+				}
+				return // listener closed
+			}
+			go s.startInStream(transport.NewSocketTransport(conn, s.cfg.Transport.KeepAlive), true)
+		}
+	}(s.tlsLn)
+	return nil
+}
+
+func (s *server) listenQUICConn(address string) error {
+	ln, err := quicListenerProvider(address, &tls.Config{
+		Certificates:   s.router.Certificates(),
+		GetCertificate: s.router.GetCertificate,
+		ClientAuth:     tls.RequestClientCert,
+		NextProtos:     []string{directTLSProtocol},
+	}, &quic.Config{KeepAlive: true})
+	if err != nil {
+		return err
+	}
+	s.quicLn = ln
+
+	go func(ln quic.Listener) {
+		for {
+			sess, err := ln.Accept()
+			if err != nil {
+				return // listener closed
+			}
+			// remote server opens a bidirectional stream per domain pair,
+			// connection is secured by QUIC TLS handshake, but peers still need to be authenticated
+			go acceptQUICStreams(sess, s.cfg.QUIC.KeepAlive, func(tr transport.Transport) {
+				s.startInStream(tr, true)
+			})
+		}
+	}(s.quicLn)
+	return nil
+}
+
 func (s *server) getOrDial(localDomain, remoteDomain string) (stream.S2SOut, error) {
+	if s.queues != nil {
+		return s.queues.getOut(localDomain, remoteDomain), nil
+	}
+	return s.getOrDialOut(localDomain, remoteDomain)
+}
+
+func (s *server) lookupOut(localDomain, remoteDomain string) deliveryStream {
+	if stm, ok := s.outConns.Load(localDomain + ":" + remoteDomain); ok {
+		return stm.(*outStream)
+	}
+	return nil
+}
+
+func (s *server) dialOut(localDomain, remoteDomain string) (deliveryStream, error) {
+	stm, err := s.getOrDialOut(localDomain, remoteDomain)
+	if err != nil {
+		return nil, err
+	}
+	return stm, nil
+}
+
+func (s *server) getOrDialOut(localDomain, remoteDomain string) (*outStream, error) {
 	domainPair := localDomain + ":" + remoteDomain
-	isScionAddress, _ := rainsLookup(remoteDomain)
-	stm, loaded := s.outConns.LoadOrStore(domainPair, newOutStream(s.router, isScionAddress))
+	stm, loaded := s.outConns.LoadOrStore(domainPair, newOutStream(s.router))
 	if !loaded {
 		outCfg, err := s.dialer.dial(localDomain, remoteDomain)
 		if err != nil {
@@ -96,6 +212,10 @@ func (s *server) getOrDial(localDomain, remoteDomain string) (stream.S2SOut, err
 			s.outConns.Delete(domainPair)
 			return nil, err
 		}
+		outCfg.pingInterval = s.cfg.PingInterval
+		outCfg.pingTimeout = s.cfg.PingTimeout
+		outCfg.whitespace = s.cfg.WhitespaceInterval
+		outCfg.idleTimeout = s.cfg.IdleTimeout
 		outCfg.onOutDisconnect = s.unregisterOutStream
 
 		stm.(*outStream).start(outCfg)
@@ -110,13 +230,28 @@ func (s *server) unregisterOutStream(stm stream.S2SOut) {
 	log.Infof("unregistered s2s out stream... (domainpair: %s)", domainPair)
 }
 
-func (s *server) startInStream(tr transport.Transport) {
+// handlePong hands a ping reply received through an incoming stream
+// over to its domain pair outgoing stream.
+func (s *server) handlePong(iq *xmpp.IQ) bool {
+	stm, ok := s.outConns.Load(iq.ToJID().Domain() + ":" + iq.FromJID().Domain())
+	if !ok {
+		return false
+	}
+	return stm.(*outStream).pong(iq.ID())
+}
+
+func (s *server) startInStream(tr transport.Transport, directTLS bool) {
 	stm := newInStream(&streamConfig{
 		keyGen:         &keyGen{s.cfg.DialbackSecret},
 		transport:      tr,
 		connectTimeout: s.cfg.ConnectTimeout,
 		maxStanzaSize:  s.cfg.MaxStanzaSize,
+		rootCAs:        s.cfg.RootCAs,
+		requireTLSAuth: s.cfg.RequireTLSAuth,
+		directTLS:      directTLS,
 		dialer:         s.dialer,
+		whitespace:     s.cfg.WhitespaceInterval,
+		onPong:         s.handlePong,
 		onInDisconnect: s.unregisterInStream,
 	}, s.mods, s.router, false)
 	s.registerInStream(stm)
@@ -7,10 +7,23 @@ package s2s
 
 import (
 	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
 	"net"
+	"sync"
+	"sync/atomic"
 	"testing"
 	"time"
 
+	"github.com/lucas-clemente/quic-go"
+	"github.com/ortuman/jackal/router"
+	"github.com/ortuman/jackal/storage"
+	"github.com/ortuman/jackal/storage/memstorage"
+	"github.com/ortuman/jackal/transport"
+	"github.com/ortuman/jackal/util"
+	"github.com/ortuman/jackal/xmpp"
+	"github.com/ortuman/jackal/xmpp/jid"
 	"github.com/stretchr/testify/require"
 )
 
@@ -57,3 +70,306 @@ func TestS2SSocketServer(t *testing.T) {
 	err := <-errCh
 	require.Nil(t, err)
 }
+
+func TestS2SDirectTLSServer(t *testing.T) {
+	cer, err := util.LoadCertificate("../testdata/cert/test.server.key", "../testdata/cert/test.server.crt", jackaDomain)
+	require.Nil(t, err)
+
+	r, _ := router.New(&router.Config{
+		Hosts: []router.HostConfig{{Name: jackaDomain, Certificate: cer}},
+	})
+	storage.Set(memstorage.New())
+	defer storage.Unset()
+
+	cfg := Config{
+		ConnectTimeout: time.Second * time.Duration(5),
+		MaxStanzaSize:  8192,
+		Transport: TransportConfig{
+			Port:          12779,
+			DirectTLSPort: 12780,
+			KeepAlive:     time.Duration(600) * time.Second,
+		},
+	}
+	srv := server{cfg: &cfg, router: r, dialer: newDialer(&cfg, r)}
+	go srv.start()
+	defer func() {
+		ctx, cancel := context.WithDeadline(context.Background(), time.Now().Add(time.Second*5))
+		defer cancel()
+		srv.shutdown(ctx)
+	}()
+
+	time.Sleep(time.Millisecond * 150)
+
+	conn, err := tls.Dial("tcp", "127.0.0.1:12780", &tls.Config{
+		ServerName:         jackaDomain,
+		NextProtos:         []string{directTLSProtocol},
+		InsecureSkipVerify: true,
+	})
+	require.Nil(t, err)
+	defer conn.Close()
+	require.Equal(t, directTLSProtocol, conn.ConnectionState().NegotiatedProtocol)
+
+	_, err = conn.Write([]byte(`<?xml version="1.0"?><stream:stream xmlns:stream="http://etherx.jabber.org/streams" xmlns="jabber:server" xmlns:db="jabber:server:dialback" version="1.0" to="jackal.im" from="jabber.org">`))
+	require.Nil(t, err)
+
+	// stream starts already secured
+	p := xmpp.NewParser(conn, xmpp.SocketStream, 0)
+	var features xmpp.XElement
+	for features == nil || features.Name() != "stream:features" {
+		features, err = p.ParseElement()
+		require.Nil(t, err)
+	}
+	require.Nil(t, features.Elements().ChildNamespace("starttls", tlsNamespace))
+	require.NotNil(t, features.Elements().ChildNamespace("dialback", dialbackNamespace))
+}
+
+func TestS2SQUICServer(t *testing.T) {
+	r, _, shutdown := setupTest(jackaDomain)
+	defer shutdown()
+
+	ln := newFakeQUICListener()
+	quicListenerProvider = func(addr string, tlsConf *tls.Config, config *quic.Config) (quic.Listener, error) {
+		require.Equal(t, ":12781", addr)
+		require.Equal(t, []string{directTLSProtocol}, tlsConf.NextProtos)
+		return ln, nil
+	}
+	defer func() { quicListenerProvider = quic.ListenAddr }()
+
+	cfg := Config{
+		DialbackSecret: "s3cr3t",
+		ConnectTimeout: time.Second * time.Duration(5),
+		MaxStanzaSize:  8192,
+		Transport: TransportConfig{
+			Port:      12782,
+			KeepAlive: time.Duration(600) * time.Second,
+		},
+		QUIC: &QUICConfig{
+			Port:      12781,
+			KeepAlive: time.Duration(600) * time.Second,
+			Peers:     map[string]string{jackaDomain: "127.0.0.1:12781"},
+		},
+	}
+	srv := server{cfg: &cfg, router: r, dialer: newDialer(&cfg, r)}
+	go srv.start()
+	defer func() {
+		ctx, cancel := context.WithDeadline(context.Background(), time.Now().Add(time.Second*5))
+		defer cancel()
+		srv.shutdown(ctx)
+	}()
+	time.Sleep(time.Millisecond * 150)
+
+	// dial listening server through its QUIC transport
+	ca, caKey := tUtilGenerateCA(t)
+	cert, _ := tUtilGenerateCert(t, ca, caKey, []string{jackaDomain}, "")
+	cfg.RootCAs = x509.NewCertPool()
+	cfg.RootCAs.AddCert(ca)
+	ln.peerCerts = []*x509.Certificate{cert}
+
+	d := newDialer(&cfg, r)
+	var dials int
+	d.quicDial = func(addr string, tlsConf *tls.Config, config *quic.Config) (quic.Session, error) {
+		require.Equal(t, "127.0.0.1:12781", addr)
+		dials++
+		return ln.dial(), nil
+	}
+	out, err := d.dial("jabber.org", jackaDomain)
+	require.Nil(t, err)
+	require.True(t, out.directTLS)
+	require.Equal(t, transport.QUIC, out.transport.Type())
+
+	// stream starts already secured
+	features := tUtilOpenStream(t, out.transport, "jabber.org")
+	require.Nil(t, features.Elements().ChildNamespace("starttls", tlsNamespace))
+	require.NotNil(t, features.Elements().ChildNamespace("dialback", dialbackNamespace))
+
+	// another domain pair is multiplexed over the same session
+	out2, err := d.dial("jabber.net", jackaDomain)
+	require.Nil(t, err)
+	require.Equal(t, 1, dials)
+	defer out2.transport.Close()
+
+	_ = out.transport.Close()
+	features = tUtilOpenStream(t, out2.transport, "jabber.net")
+	require.NotNil(t, features.Elements().ChildNamespace("dialback", dialbackNamespace))
+}
+
+func TestS2SServerIdleRedial(t *testing.T) {
+	r, _, shutdown := setupTest(jackaDomain)
+	defer shutdown()
+
+	cfg := Config{
+		DialbackSecret: "s3cr3t",
+		DialTimeout:    time.Second,
+		MaxStanzaSize:  8192,
+		IdleTimeout:    time.Millisecond * 100,
+		Transport:      TransportConfig{KeepAlive: time.Duration(600) * time.Second},
+	}
+	srv := server{cfg: &cfg, router: r, dialer: newDialer(&cfg, r)}
+	srv.dialer.resolver = fakeResolver{{typ: tcpEndpoint, address: "jabber.org:5269"}}
+
+	var conns []*fakeSocketConn
+	srv.dialer.dialTimeout = func(_, _ string, _ time.Duration) (net.Conn, error) {
+		conn := newFakeSocketConn()
+		conns = append(conns, conn)
+		return conn, nil
+	}
+	out1, err := srv.getOrDial("jackal.im", "jabber.org")
+	require.Nil(t, err)
+	_ = conns[0].outboundRead() // stream:stream
+	tUtilOutStreamVerify(t, out1.(*outStream), conns[0])
+
+	out2, _ := srv.getOrDial("jackal.im", "jabber.org")
+	require.Equal(t, out1, out2)
+
+	// idle stream gets closed...
+	require.True(t, conns[0].waitClose())
+
+	out3, err := srv.getOrDial("jackal.im", "jabber.org")
+	require.Nil(t, err)
+	require.NotEqual(t, out1, out3)
+	require.Len(t, conns, 2)
+
+	// no pending ping... reply is not consumed
+	from, _ := jid.New("", "jabber.org", "", true)
+	to, _ := jid.New("", "jackal.im", "", true)
+	iq := xmpp.NewIQType("abcd", xmpp.ResultType)
+	iq.SetFromJID(from)
+	iq.SetToJID(to)
+	require.False(t, srv.handlePong(iq))
+}
+
+func tUtilOpenStream(t *testing.T, tr transport.Transport, from string) xmpp.XElement {
+	_, _ = tr.WriteString(`<?xml version="1.0"?><stream:stream xmlns:stream="http://etherx.jabber.org/streams" xmlns="jabber:server" xmlns:db="jabber:server:dialback" version="1.0" to="jackal.im" from="` + from + `">`)
+	require.Nil(t, tr.Flush())
+
+	p := xmpp.NewParser(tr, xmpp.SocketStream, 0)
+	var features xmpp.XElement
+	var err error
+	for features == nil || features.Name() != "stream:features" {
+		features, err = p.ParseElement()
+		require.Nil(t, err)
+	}
+	return features
+}
+
+type fakeQUICStream struct {
+	quic.Stream
+	conn net.Conn
+}
+
+func (s *fakeQUICStream) Read(b []byte) (int, error)        { return s.conn.Read(b) }
+func (s *fakeQUICStream) Write(b []byte) (int, error)       { return s.conn.Write(b) }
+func (s *fakeQUICStream) Close() error                      { return s.conn.Close() }
+func (s *fakeQUICStream) SetReadDeadline(t time.Time) error { return s.conn.SetReadDeadline(t) }
+
+// fakeQUICSession represents one side of an in-memory QUIC connection,
+// where every opened stream is accepted by its peer.
+type fakeQUICSession struct {
+	quic.Session
+	peer      *fakeQUICSession
+	acceptCh  chan quic.Stream
+	closeCh   chan struct{}
+	closeOnce sync.Once
+	opened    int32
+	peerCerts []*x509.Certificate
+	closeErr  error
+}
+
+func newFakeQUICSessionPair() (cli *fakeQUICSession, srv *fakeQUICSession) {
+	cli = &fakeQUICSession{acceptCh: make(chan quic.Stream, 8), closeCh: make(chan struct{})}
+	srv = &fakeQUICSession{acceptCh: make(chan quic.Stream, 8), closeCh: make(chan struct{})}
+	cli.peer, srv.peer = srv, cli
+	return
+}
+
+func (s *fakeQUICSession) AcceptStream() (quic.Stream, error) {
+	select {
+	case stm := <-s.acceptCh:
+		return stm, nil
+	case <-s.closeCh:
+		if s.closeErr != nil {
+			return nil, s.closeErr
+		}
+		return nil, errors.New("session closed")
+	}
+}
+
+func (s *fakeQUICSession) OpenStreamSync() (quic.Stream, error) {
+	if s.isClosed() {
+		return nil, errors.New("session closed")
+	}
+	atomic.AddInt32(&s.opened, 1)
+	cliConn, srvConn := net.Pipe()
+	s.peer.acceptCh <- &fakeQUICStream{conn: srvConn}
+	return &fakeQUICStream{conn: cliConn}, nil
+}
+
+func (s *fakeQUICSession) Close() error {
+	s.closeOnce.Do(func() { close(s.closeCh) })
+	s.peer.closeOnce.Do(func() { close(s.peer.closeCh) })
+	return nil
+}
+
+// closeWithError closes local side of the session only, as if the connection was lost.
+func (s *fakeQUICSession) closeWithError(err error) {
+	s.closeOnce.Do(func() {
+		s.closeErr = err
+		close(s.closeCh)
+	})
+}
+
+func (s *fakeQUICSession) Context() context.Context {
+	ctx, cancel := context.WithCancel(context.Background())
+	go func() {
+		<-s.closeCh
+		cancel()
+	}()
+	return ctx
+}
+
+func (s *fakeQUICSession) isClosed() bool {
+	select {
+	case <-s.closeCh:
+		return true
+	default:
+		return false
+	}
+}
+
+func (s *fakeQUICSession) ConnectionState() tls.ConnectionState {
+	return tls.ConnectionState{PeerCertificates: s.peerCerts}
+}
+
+type fakeQUICListener struct {
+	sessCh    chan quic.Session
+	closeCh   chan struct{}
+	peerCerts []*x509.Certificate // presented to dialing side
+}
+
+func newFakeQUICListener() *fakeQUICListener {
+	return &fakeQUICListener{sessCh: make(chan quic.Session, 1), closeCh: make(chan struct{})}
+}
+
+// dial returns client side session of a new in-memory connection.
+func (l *fakeQUICListener) dial() quic.Session {
+	cli, srv := newFakeQUICSessionPair()
+	cli.peerCerts = l.peerCerts
+	l.sessCh <- srv
+	return cli
+}
+
+func (l *fakeQUICListener) Accept() (quic.Session, error) {
+	select {
+	case sess := <-l.sessCh:
+		return sess, nil
+	case <-l.closeCh:
+		return nil, errors.New("listener closed")
+	}
+}
+
+func (l *fakeQUICListener) Close() error {
+	close(l.closeCh)
+	return nil
+}
+
+func (l *fakeQUICListener) Addr() net.Addr { return nil }
@@ -44,6 +44,10 @@ type Error struct {
 
 	// UnderlyingErr is the underlying session error.
 	UnderlyingErr error
+
+	// ClosedByPeer tells whether the remote peer gracefully
+	// closed the stream.
+	ClosedByPeer bool
 }
 
 // A Config structure is used to configure an XMPP session.
@@ -92,9 +96,9 @@ type Session struct {
 func New(id string, config *Config, router *router.Router) *Session {
 	var parsingMode xmpp.ParsingMode
 	switch config.Transport.Type() {
-	case transport.Socket:
+	case transport.Socket, transport.QUIC:
 		parsingMode = xmpp.SocketStream
-	case transport.WebSocket:
+	case transport.WebSocket, transport.BOSH:
 		parsingMode = xmpp.WebSocketStream
 	}
 	s := &Session{
@@ -144,7 +148,7 @@ func (s *Session) Open(featuresElem xmpp.XElement) error {
 
 	buf := &strings.Builder{}
 	switch s.tr.Type() {
-	case transport.Socket:
+	case transport.Socket, transport.QUIC:
 		ops = xmpp.NewElementName("stream:stream")
 		ops.SetAttribute("xmlns", s.namespace())
 		ops.SetAttribute("xmlns:stream", streamNamespace)
@@ -153,7 +157,7 @@ func (s *Session) Open(featuresElem xmpp.XElement) error {
 		}
 		buf.WriteString(`<?xml version="1.0"?>`)
 
-	case transport.WebSocket:
+	case transport.WebSocket, transport.BOSH:
 		ops = xmpp.NewElementName("open")
 		ops.SetAttribute("xmlns", framedStreamNamespace)
 		includeClosing = true
@@ -193,9 +197,9 @@ func (s *Session) Close() error {
 		return errors.New("session already closed")
 	}
 	switch s.tr.Type() {
-	case transport.Socket:
+	case transport.Socket, transport.QUIC:
 		io.WriteString(s.tr, "</stream:stream>")
-	case transport.WebSocket:
+	case transport.WebSocket, transport.BOSH:
 		io.WriteString(s.tr, fmt.Sprintf(`<close xmlns="%s" />`, framedStreamNamespace))
 	}
 	_ = s.tr.Flush()
@@ -204,7 +208,7 @@ func (s *Session) Close() error {
 }
 
 // Send writes an XML element to the underlying session transport.
-func (s *Session) Send(elem xmpp.XElement) {
+func (s *Session) Send(elem xmpp.XElement) error {
 	// clear namespace if sending a stanza
 	if e, ok := elem.(namespaceSettable); elem.IsStanza() && ok {
 		e.SetNamespace("")
@@ -212,7 +216,7 @@ func (s *Session) Send(elem xmpp.XElement) {
 	log.Debugf("SEND(%s): %v", s.id, elem)
 
 	elem.ToXML(s.tr, true)
-	_ = s.tr.Flush()
+	return s.tr.Flush()
 }
 
 // Receive returns next incoming session element.
@@ -333,7 +337,7 @@ func (s *Session) isValidFrom(from string) bool {
 
 func (s *Session) validateStreamElement(elem xmpp.XElement) *Error {
 	switch s.tr.Type() {
-	case transport.Socket:
+	case transport.Socket, transport.QUIC:
 		if elem.Name() != "stream:stream" {
 			return &Error{UnderlyingErr: streamerror.ErrUnsupportedStanzaType}
 		}
@@ -341,7 +345,7 @@ func (s *Session) validateStreamElement(elem xmpp.XElement) *Error {
 			return &Error{UnderlyingErr: streamerror.ErrInvalidNamespace}
 		}
 
-	case transport.WebSocket:
+	case transport.WebSocket, transport.BOSH:
 		if elem.Name() != "open" {
 			return &Error{UnderlyingErr: streamerror.ErrUnsupportedStanzaType}
 		}
@@ -387,6 +391,7 @@ func (s *Session) mapErrorToSessionError(err error) *Error {
 
 	case xmpp.ErrStreamClosedByPeer:
 		s.Close()
+		return &Error{ClosedByPeer: true}
 
 	case xmpp.ErrTooLargeStanza:
 		return &Error{UnderlyingErr: streamerror.ErrPolicyViolation}
@@ -398,7 +398,7 @@ func TestSession_MapError(t *testing.T) {
 	require.Equal(t, &Error{}, sess.mapErrorToSessionError(nil))
 	require.Equal(t, &Error{}, sess.mapErrorToSessionError(io.EOF))
 	require.Equal(t, &Error{}, sess.mapErrorToSessionError(io.ErrUnexpectedEOF))
-	require.Equal(t, &Error{}, sess.mapErrorToSessionError(xmpp.ErrStreamClosedByPeer))
+	require.Equal(t, &Error{ClosedByPeer: true}, sess.mapErrorToSessionError(xmpp.ErrStreamClosedByPeer))
 
 	require.Equal(t, &Error{UnderlyingErr: streamerror.ErrPolicyViolation}, sess.mapErrorToSessionError(xmpp.ErrTooLargeStanza))
 	require.Equal(t, &Error{UnderlyingErr: streamerror.ErrInvalidXML}, sess.mapErrorToSessionError(&stdxml.SyntaxError{}))
@@ -3,6 +3,12 @@
  * See the LICENSE file for more information.
  */
 
+DROP TABLE IF EXISTS s2s_queue_items;
+DROP TABLE IF EXISTS pubsub_items;
+DROP TABLE IF EXISTS pubsub_nodes;
+DROP TABLE IF EXISTS rooms;
+DROP TABLE IF EXISTS archive_prefs;
+DROP TABLE IF EXISTS archive_messages;
 DROP TABLE IF EXISTS offline_messages;
 DROP TABLE IF EXISTS vcards;
 DROP TABLE IF EXISTS private_storage;
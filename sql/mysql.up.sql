@@ -14,6 +14,27 @@ CREATE TABLE IF NOT EXISTS users (
     created_at       DATETIME NOT NULL
 ) ENGINE=InnoDB CHARACTER SET utf8mb4 COLLATE utf8mb4_unicode_ci;
 
+-- users SCRAM credentials (added to previously created tables as well)
+
+SET @users_scram_migration = (
+    SELECT IF(COUNT(*) = 0,
+        'ALTER TABLE users
+            ADD COLUMN salt              VARBINARY(64),
+            ADD COLUMN iteration_count   INT NOT NULL DEFAULT 0,
+            ADD COLUMN stored_key_sha1   VARBINARY(64),
+            ADD COLUMN server_key_sha1   VARBINARY(64),
+            ADD COLUMN stored_key_sha256 VARBINARY(64),
+            ADD COLUMN server_key_sha256 VARBINARY(64),
+            ADD COLUMN stored_key_sha512 VARBINARY(64),
+            ADD COLUMN server_key_sha512 VARBINARY(64)',
+        'DO 0')
+    FROM information_schema.columns
+    WHERE table_schema = DATABASE() AND table_name = 'users' AND column_name = 'salt'
+);
+PREPARE users_scram_migration FROM @users_scram_migration;
+EXECUTE users_scram_migration;
+DEALLOCATE PREPARE users_scram_migration;
+
 -- roster_notifications
 
 CREATE TABLE IF NOT EXISTS roster_notifications (
@@ -118,3 +139,88 @@ CREATE TABLE IF NOT EXISTS offline_messages (
     INDEX i_offline_messages_username (username)
 
 ) ENGINE=InnoDB CHARACTER SET utf8mb4 COLLATE utf8mb4_unicode_ci;
+
+-- archive_messages
+
+CREATE TABLE IF NOT EXISTS archive_messages (
+    serial     BIGINT UNSIGNED AUTO_INCREMENT PRIMARY KEY,
+    username   VARCHAR(256) NOT NULL,
+    id         VARCHAR(64) NOT NULL,
+    with_jid   VARCHAR(512) NOT NULL,
+    data       MEDIUMTEXT NOT NULL,
+    created_at DATETIME NOT NULL,
+
+    UNIQUE INDEX i_archive_messages_username_id (username, id),
+    INDEX i_archive_messages_username_with_jid (username, with_jid),
+    INDEX i_archive_messages_username_created_at (username, created_at)
+
+) ENGINE=InnoDB CHARACTER SET utf8mb4 COLLATE utf8mb4_unicode_ci;
+
+-- archive_prefs
+
+CREATE TABLE IF NOT EXISTS archive_prefs (
+    username     VARCHAR(256) PRIMARY KEY,
+    default_mode VARCHAR(16) NOT NULL,
+    always       TEXT NOT NULL,
+    never        TEXT NOT NULL,
+    updated_at   DATETIME NOT NULL,
+    created_at   DATETIME NOT NULL
+) ENGINE=InnoDB CHARACTER SET utf8mb4 COLLATE utf8mb4_unicode_ci;
+
+-- rooms
+
+CREATE TABLE IF NOT EXISTS rooms (
+    jid          VARCHAR(512) PRIMARY KEY,
+    service      VARCHAR(256) NOT NULL,
+    config       TEXT NOT NULL,
+    subject      TEXT NOT NULL,
+    affiliations TEXT NOT NULL,
+    updated_at   DATETIME NOT NULL,
+    created_at   DATETIME NOT NULL,
+
+    INDEX i_rooms_service (service)
+
+) ENGINE=InnoDB CHARACTER SET utf8mb4 COLLATE utf8mb4_unicode_ci;
+
+-- pubsub_nodes
+
+CREATE TABLE IF NOT EXISTS pubsub_nodes (
+    host          VARCHAR(256) NOT NULL,
+    name          VARCHAR(256) NOT NULL,
+    options       TEXT NOT NULL,
+    affiliations  TEXT NOT NULL,
+    subscriptions TEXT NOT NULL,
+    updated_at    DATETIME NOT NULL,
+    created_at    DATETIME NOT NULL,
+
+    PRIMARY KEY (host, name)
+
+) ENGINE=InnoDB CHARACTER SET utf8mb4 COLLATE utf8mb4_unicode_ci;
+
+-- pubsub_items
+
+CREATE TABLE IF NOT EXISTS pubsub_items (
+    serial     BIGINT UNSIGNED AUTO_INCREMENT PRIMARY KEY,
+    host       VARCHAR(256) NOT NULL,
+    node       VARCHAR(256) NOT NULL,
+    item_id    VARCHAR(256) NOT NULL,
+    publisher  VARCHAR(512) NOT NULL,
+    payload    MEDIUMTEXT NOT NULL,
+    created_at DATETIME NOT NULL,
+
+    UNIQUE INDEX i_pubsub_items_host_node_item_id (host, node, item_id)
+
+) ENGINE=InnoDB CHARACTER SET utf8mb4 COLLATE utf8mb4_unicode_ci;
+
+-- s2s_queue_items
+
+CREATE TABLE IF NOT EXISTS s2s_queue_items (
+    serial        BIGINT UNSIGNED AUTO_INCREMENT PRIMARY KEY,
+    remote_domain VARCHAR(256) NOT NULL,
+    id            VARCHAR(64) NOT NULL,
+    data          MEDIUMTEXT NOT NULL,
+    enqueued_at   DATETIME NOT NULL,
+
+    UNIQUE INDEX i_s2s_queue_items_remote_domain_id (remote_domain, id)
+
+) ENGINE=InnoDB CHARACTER SET utf8mb4 COLLATE utf8mb4_unicode_ci;
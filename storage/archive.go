@@ -0,0 +1,57 @@
+package storage
+
+import (
+	"time"
+
+	"github.com/ortuman/jackal/metrics"
+	"github.com/ortuman/jackal/model"
+)
+
+// archiveStorage defines storage operations for message archive
+type archiveStorage interface {
+	InsertArchiveMessage(message *model.ArchiveMessage) error
+	CountArchiveMessages(username string, filter *model.ArchiveFilter) (int, error)
+	FetchArchiveMessages(username string, filter *model.ArchiveFilter) ([]model.ArchiveMessage, error)
+	DeleteArchiveMessages(username string) error
+	InsertOrUpdateArchivePrefs(prefs *model.ArchivePrefs) error
+	FetchArchivePrefs(username string) (*model.ArchivePrefs, error)
+}
+
+// InsertArchiveMessage inserts a new message into user's archive.
+func InsertArchiveMessage(message *model.ArchiveMessage) error {
+	defer metrics.ObserveStorageLatency("InsertArchiveMessage", time.Now())
+	return instance().InsertArchiveMessage(message)
+}
+
+// CountArchiveMessages returns the number of archived messages matching
+// filter's with, start and end constraints.
+func CountArchiveMessages(username string, filter *model.ArchiveFilter) (int, error) {
+	defer metrics.ObserveStorageLatency("CountArchiveMessages", time.Now())
+	return instance().CountArchiveMessages(username, filter)
+}
+
+// FetchArchiveMessages retrieves from storage user's archived messages
+// matching a given filter, in chronological order.
+func FetchArchiveMessages(username string, filter *model.ArchiveFilter) ([]model.ArchiveMessage, error) {
+	defer metrics.ObserveStorageLatency("FetchArchiveMessages", time.Now())
+	return instance().FetchArchiveMessages(username, filter)
+}
+
+// DeleteArchiveMessages clears a user message archive.
+func DeleteArchiveMessages(username string) error {
+	defer metrics.ObserveStorageLatency("DeleteArchiveMessages", time.Now())
+	return instance().DeleteArchiveMessages(username)
+}
+
+// InsertOrUpdateArchivePrefs inserts a new archiving preferences entity
+// into storage, or updates it in case it's been previously inserted.
+func InsertOrUpdateArchivePrefs(prefs *model.ArchivePrefs) error {
+	defer metrics.ObserveStorageLatency("InsertOrUpdateArchivePrefs", time.Now())
+	return instance().InsertOrUpdateArchivePrefs(prefs)
+}
+
+// FetchArchivePrefs retrieves from storage user's archiving preferences.
+func FetchArchivePrefs(username string) (*model.ArchivePrefs, error) {
+	defer metrics.ObserveStorageLatency("FetchArchivePrefs", time.Now())
+	return instance().FetchArchivePrefs(username)
+}
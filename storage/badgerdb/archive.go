@@ -0,0 +1,96 @@
+/*
+ * Copyright (c) 2018 Miguel Ángel Ortuño.
+ * See the LICENSE file for more information.
+ */
+
+package badgerdb
+
+import (
+	"fmt"
+
+	"github.com/dgraph-io/badger"
+	"github.com/ortuman/jackal/model"
+)
+
+// InsertArchiveMessage inserts a new message into user's archive.
+func (b *Storage) InsertArchiveMessage(message *model.ArchiveMessage) error {
+	return b.db.Update(func(tx *badger.Txn) error {
+		return b.insertOrUpdate(message, b.archiveMessageKey(message), tx)
+	})
+}
+
+// CountArchiveMessages returns the number of archived messages matching
+// filter's with, start and end constraints.
+func (b *Storage) CountArchiveMessages(username string, filter *model.ArchiveFilter) (int, error) {
+	messages, err := b.fetchArchiveMessages(username, filter)
+	if err != nil {
+		return 0, err
+	}
+	return len(messages), nil
+}
+
+// FetchArchiveMessages retrieves from storage user's archived messages
+// matching a given filter, in chronological order.
+func (b *Storage) FetchArchiveMessages(username string, filter *model.ArchiveFilter) ([]model.ArchiveMessage, error) {
+	messages, err := b.fetchArchiveMessages(username, filter)
+	if err != nil {
+		return nil, err
+	}
+	return filter.Page(messages), nil
+}
+
+// DeleteArchiveMessages clears a user message archive.
+func (b *Storage) DeleteArchiveMessages(username string) error {
+	return b.db.Update(func(tx *badger.Txn) error {
+		return b.deletePrefix(b.archiveMessagesPrefix(username), tx)
+	})
+}
+
+// InsertOrUpdateArchivePrefs inserts a new archiving preferences entity
+// into storage, or updates it in case it's been previously inserted.
+func (b *Storage) InsertOrUpdateArchivePrefs(prefs *model.ArchivePrefs) error {
+	return b.db.Update(func(tx *badger.Txn) error {
+		return b.insertOrUpdate(prefs, b.archivePrefsKey(prefs.Username), tx)
+	})
+}
+
+// FetchArchivePrefs retrieves from storage user's archiving preferences.
+func (b *Storage) FetchArchivePrefs(username string) (*model.ArchivePrefs, error) {
+	var prefs model.ArchivePrefs
+	err := b.fetch(&prefs, b.archivePrefsKey(username))
+	switch err {
+	case nil:
+		return &prefs, nil
+	case errBadgerDBEntityNotFound:
+		return nil, nil
+	default:
+		return nil, err
+	}
+}
+
+func (b *Storage) fetchArchiveMessages(username string, filter *model.ArchiveFilter) ([]model.ArchiveMessage, error) {
+	var messages []model.ArchiveMessage
+	if err := b.fetchAll(&messages, b.archiveMessagesPrefix(username)); err != nil {
+		return nil, err
+	}
+	var res []model.ArchiveMessage
+	for i := range messages {
+		if filter.Matches(&messages[i]) {
+			res = append(res, messages[i])
+		}
+	}
+	return res, nil
+}
+
+// archive message keys are sorted by creation time
+func (b *Storage) archiveMessageKey(message *model.ArchiveMessage) []byte {
+	return []byte(fmt.Sprintf("archiveMessages:%s:%020d:%s", message.Username, message.CreatedAt.UnixNano(), message.ID))
+}
+
+func (b *Storage) archiveMessagesPrefix(username string) []byte {
+	return []byte("archiveMessages:" + username + ":")
+}
+
+func (b *Storage) archivePrefsKey(username string) []byte {
+	return []byte("archivePrefs:" + username)
+}
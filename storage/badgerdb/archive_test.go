@@ -0,0 +1,93 @@
+/*
+ * Copyright (c) 2018 Miguel Ángel Ortuño.
+ * See the LICENSE file for more information.
+ */
+
+package badgerdb
+
+import (
+	"testing"
+	"time"
+
+	"github.com/ortuman/jackal/model"
+	"github.com/ortuman/jackal/xmpp"
+	"github.com/pborman/uuid"
+	"github.com/stretchr/testify/require"
+)
+
+func TestBadgerDB_ArchiveMessages(t *testing.T) {
+	t.Parallel()
+
+	h := tUtilBadgerDBSetup()
+	defer tUtilBadgerDBTeardown(h)
+
+	now := time.Now()
+	am1 := &model.ArchiveMessage{
+		Username:  "ortuman",
+		ID:        uuid.New(),
+		With:      "noelia@jackal.im",
+		Message:   xmpp.NewMessageType(uuid.New(), xmpp.ChatType),
+		CreatedAt: now,
+	}
+	am2 := &model.ArchiveMessage{
+		Username:  "ortuman",
+		ID:        uuid.New(),
+		With:      "romeo@example.net",
+		Message:   xmpp.NewMessageType(uuid.New(), xmpp.ChatType),
+		CreatedAt: now.Add(time.Minute),
+	}
+	// insert in reverse order
+	require.NoError(t, h.db.InsertArchiveMessage(am2))
+	require.NoError(t, h.db.InsertArchiveMessage(am1))
+
+	cnt, err := h.db.CountArchiveMessages("ortuman", &model.ArchiveFilter{})
+	require.Nil(t, err)
+	require.Equal(t, 2, cnt)
+
+	cnt, err = h.db.CountArchiveMessages("ortuman", &model.ArchiveFilter{With: "romeo@example.net"})
+	require.Nil(t, err)
+	require.Equal(t, 1, cnt)
+
+	msgs, err := h.db.FetchArchiveMessages("ortuman", &model.ArchiveFilter{})
+	require.Nil(t, err)
+	require.Equal(t, 2, len(msgs))
+	require.Equal(t, am1.ID, msgs[0].ID)
+	require.Equal(t, am2.ID, msgs[1].ID)
+
+	msgs, err = h.db.FetchArchiveMessages("ortuman", &model.ArchiveFilter{Max: 1, LastPage: true})
+	require.Nil(t, err)
+	require.Equal(t, 1, len(msgs))
+	require.Equal(t, am2.ID, msgs[0].ID)
+
+	msgs, err = h.db.FetchArchiveMessages("ortuman2", &model.ArchiveFilter{})
+	require.Nil(t, err)
+	require.Equal(t, 0, len(msgs))
+
+	require.NoError(t, h.db.DeleteArchiveMessages("ortuman"))
+	cnt, err = h.db.CountArchiveMessages("ortuman", &model.ArchiveFilter{})
+	require.Nil(t, err)
+	require.Equal(t, 0, cnt)
+}
+
+func TestBadgerDB_ArchivePrefs(t *testing.T) {
+	t.Parallel()
+
+	h := tUtilBadgerDBSetup()
+	defer tUtilBadgerDBTeardown(h)
+
+	prefs := &model.ArchivePrefs{
+		Username: "ortuman",
+		Default:  model.ArchiveAlways,
+		Always:   []string{"noelia@jackal.im"},
+		Never:    []string{"romeo@example.net"},
+	}
+	require.NoError(t, h.db.InsertOrUpdateArchivePrefs(prefs))
+
+	p, err := h.db.FetchArchivePrefs("ortuman")
+	require.Nil(t, err)
+	require.Equal(t, prefs, p)
+
+	p, err = h.db.FetchArchivePrefs("ortuman2")
+	require.Nil(t, err)
+	require.Nil(t, p)
+}
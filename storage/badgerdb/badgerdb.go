@@ -103,7 +103,7 @@ func (b *Storage) delete(key []byte, txn *badger.Txn) error {
 func (b *Storage) deletePrefix(prefix []byte, txn *badger.Txn) error {
 	var keys [][]byte
 	if err := b.forEachKey(prefix, func(key []byte) error {
-		keys = append(keys, key)
+		keys = append(keys, append([]byte(nil), key...))
 		return nil
 	}); err != nil {
 		return err
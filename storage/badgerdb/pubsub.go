@@ -0,0 +1,132 @@
+/*
+ * Copyright (c) 2018 Miguel Ángel Ortuño.
+ * See the LICENSE file for more information.
+ */
+
+package badgerdb
+
+import (
+	"fmt"
+
+	"github.com/dgraph-io/badger"
+	"github.com/ortuman/jackal/model/pubsubmodel"
+	"github.com/ortuman/jackal/model/serializer"
+)
+
+// InsertOrUpdatePubSubNode inserts a new pubsub node entity into storage,
+// or updates it in case it's been previously inserted.
+func (b *Storage) InsertOrUpdatePubSubNode(node *pubsubmodel.Node) error {
+	return b.db.Update(func(tx *badger.Txn) error {
+		return b.insertOrUpdate(node, b.pubSubNodeKey(node.Host, node.Name), tx)
+	})
+}
+
+// DeletePubSubNode deletes a pubsub node entity and all its published items from storage.
+func (b *Storage) DeletePubSubNode(host, name string) error {
+	return b.db.Update(func(tx *badger.Txn) error {
+		if err := b.deletePrefix(b.pubSubItemsPrefix(host, name), tx); err != nil {
+			return err
+		}
+		return b.delete(b.pubSubNodeKey(host, name), tx)
+	})
+}
+
+// FetchPubSubNode retrieves from storage a pubsub node entity.
+func (b *Storage) FetchPubSubNode(host, name string) (*pubsubmodel.Node, error) {
+	var node pubsubmodel.Node
+	err := b.fetch(&node, b.pubSubNodeKey(host, name))
+	switch err {
+	case nil:
+		return &node, nil
+	case errBadgerDBEntityNotFound:
+		return nil, nil
+	default:
+		return nil, err
+	}
+}
+
+// FetchPubSubNodes retrieves from storage all node entities associated to a given host.
+func (b *Storage) FetchPubSubNodes(host string) ([]pubsubmodel.Node, error) {
+	var nodes []pubsubmodel.Node
+	if err := b.fetchAll(&nodes, b.pubSubNodesPrefix(host)); err != nil {
+		return nil, err
+	}
+	return nodes, nil
+}
+
+// InsertOrUpdatePubSubItem inserts a new item into a pubsub node, or updates it
+// in case an item with the same identifier was previously published.
+func (b *Storage) InsertOrUpdatePubSubItem(host, name string, item *pubsubmodel.Item, maxItems int) error {
+	return b.db.Update(func(tx *badger.Txn) error {
+		var keys [][]byte
+		if err := b.forEachKeyAndValue(b.pubSubItemsPrefix(host, name), func(k, v []byte) error {
+			var it pubsubmodel.Item
+			if err := serializer.Deserialize(v, &it); err != nil {
+				return err
+			}
+			if it.ID == item.ID {
+				return tx.Delete(k)
+			}
+			keys = append(keys, append([]byte(nil), k...))
+			return nil
+		}); err != nil {
+			return err
+		}
+		if err := b.insertOrUpdate(item, b.pubSubItemKey(host, name, item), tx); err != nil {
+			return err
+		}
+		// discard oldest items
+		if maxItems > 0 {
+			for i := 0; i < len(keys)+1-maxItems; i++ {
+				if err := tx.Delete(keys[i]); err != nil {
+					return err
+				}
+			}
+		}
+		return nil
+	})
+}
+
+// DeletePubSubItem deletes a published item from a pubsub node.
+func (b *Storage) DeletePubSubItem(host, name, itemID string) error {
+	return b.db.Update(func(tx *badger.Txn) error {
+		return b.forEachKeyAndValue(b.pubSubItemsPrefix(host, name), func(k, v []byte) error {
+			var it pubsubmodel.Item
+			if err := serializer.Deserialize(v, &it); err != nil {
+				return err
+			}
+			if it.ID == itemID {
+				return tx.Delete(append([]byte(nil), k...))
+			}
+			return nil
+		})
+	})
+}
+
+// FetchPubSubItems retrieves from storage all items published to a node, oldest first.
+func (b *Storage) FetchPubSubItems(host, name string) ([]pubsubmodel.Item, error) {
+	var items []pubsubmodel.Item
+	if err := b.fetchAll(&items, b.pubSubItemsPrefix(host, name)); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+func (b *Storage) pubSubNodeKey(host, name string) []byte {
+	return []byte("pubsubNodes:" + host + ":" + name)
+}
+
+func (b *Storage) pubSubNodesPrefix(host string) []byte {
+	return []byte("pubsubNodes:" + host + ":")
+}
+
+// node item keys are sorted by creation time
+func (b *Storage) pubSubItemKey(host, name string, item *pubsubmodel.Item) []byte {
+	return []byte(fmt.Sprintf("%s%020d:%s", b.pubSubItemsPrefix(host, name), item.CreatedAt.UnixNano(), item.ID))
+}
+
+// node name length is prepended so that a node prefix never matches
+// items belonging to a different node (eg. 'urn:xmpp:avatar' and 'urn:xmpp:avatar:data').
+func (b *Storage) pubSubItemsPrefix(host, name string) []byte {
+	return []byte(fmt.Sprintf("pubsubItems:%s:%d:%s:", host, len(name), name))
+}
@@ -0,0 +1,106 @@
+/*
+ * Copyright (c) 2018 Miguel Ángel Ortuño.
+ * See the LICENSE file for more information.
+ */
+
+package badgerdb
+
+import (
+	"testing"
+	"time"
+
+	"github.com/ortuman/jackal/model/pubsubmodel"
+	"github.com/ortuman/jackal/xmpp"
+	"github.com/stretchr/testify/require"
+)
+
+func TestBadgerDB_PubSubNodes(t *testing.T) {
+	t.Parallel()
+
+	h := tUtilBadgerDBSetup()
+	defer tUtilBadgerDBTeardown(h)
+
+	n1 := &pubsubmodel.Node{
+		Host:    "pubsub.jackal.im",
+		Name:    "princely_musings",
+		Options: pubsubmodel.Options{Title: "Princely Musings", AccessModel: pubsubmodel.AccessModelOpen},
+	}
+	n1.SetAffiliation("ortuman@jackal.im", pubsubmodel.AffiliationOwner)
+	n1.SetSubscription("noelia@jackal.im", pubsubmodel.SubscriptionSubscribed)
+
+	n2 := &pubsubmodel.Node{Host: "pubsub.jackal.im", Name: "news"}
+	n3 := &pubsubmodel.Node{Host: "ortuman@jackal.im", Name: "urn:xmpp:avatar:data"}
+
+	require.NoError(t, h.db.InsertOrUpdatePubSubNode(n1))
+	require.NoError(t, h.db.InsertOrUpdatePubSubNode(n2))
+	require.NoError(t, h.db.InsertOrUpdatePubSubNode(n3))
+
+	node, err := h.db.FetchPubSubNode("pubsub.jackal.im", "princely_musings")
+	require.Nil(t, err)
+	require.Equal(t, n1, node)
+
+	node, err = h.db.FetchPubSubNode("pubsub.jackal.im", "events")
+	require.Nil(t, err)
+	require.Nil(t, node)
+
+	nodes, err := h.db.FetchPubSubNodes("pubsub.jackal.im")
+	require.Nil(t, err)
+	require.Equal(t, 2, len(nodes))
+
+	require.NoError(t, h.db.InsertOrUpdatePubSubItem("pubsub.jackal.im", "princely_musings", tUtilPubSubItem("1"), 0))
+	require.NoError(t, h.db.DeletePubSubNode("pubsub.jackal.im", "princely_musings"))
+
+	nodes, err = h.db.FetchPubSubNodes("pubsub.jackal.im")
+	require.Nil(t, err)
+	require.Equal(t, 1, len(nodes))
+	require.Equal(t, "news", nodes[0].Name)
+
+	items, err := h.db.FetchPubSubItems("pubsub.jackal.im", "princely_musings")
+	require.Nil(t, err)
+	require.Equal(t, 0, len(items))
+}
+
+func TestBadgerDB_PubSubItems(t *testing.T) {
+	t.Parallel()
+
+	h := tUtilBadgerDBSetup()
+	defer tUtilBadgerDBTeardown(h)
+
+	require.NoError(t, h.db.InsertOrUpdatePubSubItem("ortuman@jackal.im", "urn:xmpp:avatar", tUtilPubSubItem("1"), 2))
+	require.NoError(t, h.db.InsertOrUpdatePubSubItem("ortuman@jackal.im", "urn:xmpp:avatar", tUtilPubSubItem("2"), 2))
+	require.NoError(t, h.db.InsertOrUpdatePubSubItem("ortuman@jackal.im", "urn:xmpp:avatar", tUtilPubSubItem("3"), 2))
+	require.NoError(t, h.db.InsertOrUpdatePubSubItem("ortuman@jackal.im", "urn:xmpp:avatar:data", tUtilPubSubItem("4"), 2))
+
+	items, err := h.db.FetchPubSubItems("ortuman@jackal.im", "urn:xmpp:avatar")
+	require.Nil(t, err)
+	require.Equal(t, 2, len(items))
+	require.Equal(t, "2", items[0].ID)
+	require.Equal(t, "3", items[1].ID)
+	require.Equal(t, "ortuman@jackal.im", items[0].Publisher)
+	require.Equal(t, "entry", items[0].Payload.Name())
+
+	// republishing an item moves it to the tail
+	require.NoError(t, h.db.InsertOrUpdatePubSubItem("ortuman@jackal.im", "urn:xmpp:avatar", tUtilPubSubItem("2"), 2))
+	items, _ = h.db.FetchPubSubItems("ortuman@jackal.im", "urn:xmpp:avatar")
+	require.Equal(t, 2, len(items))
+	require.Equal(t, "3", items[0].ID)
+	require.Equal(t, "2", items[1].ID)
+
+	require.NoError(t, h.db.DeletePubSubItem("ortuman@jackal.im", "urn:xmpp:avatar", "3"))
+	items, _ = h.db.FetchPubSubItems("ortuman@jackal.im", "urn:xmpp:avatar")
+	require.Equal(t, 1, len(items))
+	require.Equal(t, "2", items[0].ID)
+
+	items, _ = h.db.FetchPubSubItems("ortuman@jackal.im", "urn:xmpp:avatar:data")
+	require.Equal(t, 1, len(items))
+	require.Equal(t, "4", items[0].ID)
+}
+
+func tUtilPubSubItem(id string) *pubsubmodel.Item {
+	return &pubsubmodel.Item{
+		ID:        id,
+		Publisher: "ortuman@jackal.im",
+		Payload:   xmpp.NewElementNamespace("entry", "http://www.w3.org/2005/Atom"),
+		CreatedAt: time.Now(),
+	}
+}
@@ -0,0 +1,53 @@
+/*
+ * Copyright (c) 2018 Miguel Ángel Ortuño.
+ * See the LICENSE file for more information.
+ */
+
+package badgerdb
+
+import (
+	"testing"
+
+	"github.com/ortuman/jackal/model/mucmodel"
+	"github.com/stretchr/testify/require"
+)
+
+func TestBadgerDB_Rooms(t *testing.T) {
+	t.Parallel()
+
+	h := tUtilBadgerDBSetup()
+	defer tUtilBadgerDBTeardown(h)
+
+	r1 := &mucmodel.Room{
+		JID:     "room1@conference.jackal.im",
+		Config:  mucmodel.RoomConfig{Name: "Room 1", Persistent: true},
+		Subject: "Hi there!",
+	}
+	r1.SetAffiliation("ortuman@jackal.im", mucmodel.AffiliationOwner)
+
+	r2 := &mucmodel.Room{JID: "room2@conference.jackal.im"}
+	r3 := &mucmodel.Room{JID: "room3@muc.jackal.im"}
+
+	require.NoError(t, h.db.InsertOrUpdateRoom(r1))
+	require.NoError(t, h.db.InsertOrUpdateRoom(r2))
+	require.NoError(t, h.db.InsertOrUpdateRoom(r3))
+
+	room, err := h.db.FetchRoom("room1@conference.jackal.im")
+	require.Nil(t, err)
+	require.Equal(t, r1, room)
+
+	room, err = h.db.FetchRoom("room4@conference.jackal.im")
+	require.Nil(t, err)
+	require.Nil(t, room)
+
+	rooms, err := h.db.FetchRooms("conference.jackal.im")
+	require.Nil(t, err)
+	require.Equal(t, 2, len(rooms))
+
+	require.NoError(t, h.db.DeleteRoom("room1@conference.jackal.im"))
+
+	rooms, err = h.db.FetchRooms("conference.jackal.im")
+	require.Nil(t, err)
+	require.Equal(t, 1, len(rooms))
+	require.Equal(t, "room2@conference.jackal.im", rooms[0].JID)
+}
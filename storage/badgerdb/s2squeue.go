@@ -0,0 +1,43 @@
+/*
+ * Copyright (c) 2018 Miguel Ángel Ortuño.
+ * See the LICENSE file for more information.
+ */
+
+package badgerdb
+
+import (
+	"sort"
+
+	"github.com/dgraph-io/badger"
+	"github.com/ortuman/jackal/model"
+)
+
+// InsertS2SQueueItem inserts a new stanza into its remote domain
+// outgoing queue.
+func (b *Storage) InsertS2SQueueItem(item *model.S2SQueueItem) error {
+	return b.db.Update(func(tx *badger.Txn) error {
+		return b.insertOrUpdate(item, b.s2sQueueItemKey(item.RemoteDomain, item.ID), tx)
+	})
+}
+
+// FetchS2SQueueItems retrieves from storage every pending outgoing
+// s2s queue item, in enqueueing order.
+func (b *Storage) FetchS2SQueueItems() ([]model.S2SQueueItem, error) {
+	var items []model.S2SQueueItem
+	if err := b.fetchAll(&items, []byte("s2sQueueItems:")); err != nil {
+		return nil, err
+	}
+	sort.SliceStable(items, func(i, j int) bool { return items[i].EnqueuedAt.Before(items[j].EnqueuedAt) })
+	return items, nil
+}
+
+// DeleteS2SQueueItem removes an item from a remote domain outgoing queue.
+func (b *Storage) DeleteS2SQueueItem(remoteDomain, id string) error {
+	return b.db.Update(func(tx *badger.Txn) error {
+		return b.delete(b.s2sQueueItemKey(remoteDomain, id), tx)
+	})
+}
+
+func (b *Storage) s2sQueueItemKey(remoteDomain, id string) []byte {
+	return []byte("s2sQueueItems:" + remoteDomain + ":" + id)
+}
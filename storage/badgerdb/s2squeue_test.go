@@ -0,0 +1,52 @@
+/*
+ * Copyright (c) 2018 Miguel Ángel Ortuño.
+ * See the LICENSE file for more information.
+ */
+
+package badgerdb
+
+import (
+	"testing"
+	"time"
+
+	"github.com/ortuman/jackal/model"
+	"github.com/ortuman/jackal/xmpp"
+	"github.com/ortuman/jackal/xmpp/jid"
+	"github.com/pborman/uuid"
+	"github.com/stretchr/testify/require"
+)
+
+func TestBadgerDB_S2SQueueItems(t *testing.T) {
+	t.Parallel()
+
+	h := tUtilBadgerDBSetup()
+	defer tUtilBadgerDBTeardown(h)
+
+	from, _ := jid.NewWithString("ortuman@jackal.im/balcony", true)
+	to, _ := jid.NewWithString("romeo@example.net", true)
+	msg := xmpp.NewMessageType(uuid.New(), xmpp.ChatType)
+	msg.SetFromJID(from)
+	msg.SetToJID(to)
+
+	now := time.Now()
+	qi1 := &model.S2SQueueItem{ID: uuid.New(), RemoteDomain: "example.net", Stanza: msg, EnqueuedAt: now}
+	qi2 := &model.S2SQueueItem{ID: uuid.New(), RemoteDomain: "example.net", Stanza: msg, EnqueuedAt: now.Add(time.Minute)}
+	qi3 := &model.S2SQueueItem{ID: uuid.New(), RemoteDomain: "jabber.org", Stanza: msg, EnqueuedAt: now.Add(time.Second)}
+
+	require.NoError(t, h.db.InsertS2SQueueItem(qi2))
+	require.NoError(t, h.db.InsertS2SQueueItem(qi3))
+	require.NoError(t, h.db.InsertS2SQueueItem(qi1))
+
+	items, err := h.db.FetchS2SQueueItems()
+	require.Nil(t, err)
+	require.Len(t, items, 3)
+	require.Equal(t, qi1.ID, items[0].ID)
+	require.Equal(t, qi3.ID, items[1].ID)
+	require.Equal(t, qi2.ID, items[2].ID)
+	require.Equal(t, msg.String(), items[0].Stanza.String())
+
+	require.NoError(t, h.db.DeleteS2SQueueItem("example.net", qi1.ID))
+	items, _ = h.db.FetchS2SQueueItems()
+	require.Len(t, items, 2)
+	require.Equal(t, qi3.ID, items[0].ID)
+}
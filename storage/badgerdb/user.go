@@ -52,6 +52,19 @@ func (b *Storage) UserExists(username string) (bool, error) {
 	}
 }
 
+// FetchUsernames retrieves from storage all registered usernames in ascending order.
+func (b *Storage) FetchUsernames() ([]string, error) {
+	var usernames []string
+	prefix := []byte("users:")
+	if err := b.forEachKey(prefix, func(k []byte) error {
+		usernames = append(usernames, string(k[len(prefix):]))
+		return nil
+	}); err != nil {
+		return nil, err
+	}
+	return usernames, nil
+}
+
 func (b *Storage) userKey(username string) []byte {
 	return []byte("users:" + username)
 }
@@ -32,6 +32,10 @@ func TestBadgerDB_User(t *testing.T) {
 	require.Nil(t, err)
 	require.True(t, exists)
 
+	usernames, err := h.db.FetchUsernames()
+	require.Nil(t, err)
+	require.Equal(t, []string{"ortuman"}, usernames)
+
 	usr3, err := h.db.FetchUser("ortuman2")
 	require.Nil(t, usr3)
 	require.Nil(t, err)
@@ -1,6 +1,11 @@
 package storage
 
-import "github.com/ortuman/jackal/model"
+import (
+	"time"
+
+	"github.com/ortuman/jackal/metrics"
+	"github.com/ortuman/jackal/model"
+)
 
 // blockListStorage defines storage operations for user's block list
 type blockListStorage interface {
@@ -12,16 +17,19 @@ type blockListStorage interface {
 // InsertBlockListItems inserts a set of block list item entities
 // into storage, only in case they haven't been previously inserted.
 func InsertBlockListItems(items []model.BlockListItem) error {
+	defer metrics.ObserveStorageLatency("InsertBlockListItems", time.Now())
 	return instance().InsertBlockListItems(items)
 }
 
 // DeleteBlockListItems deletes a set of block list item entities from storage.
 func DeleteBlockListItems(items []model.BlockListItem) error {
+	defer metrics.ObserveStorageLatency("DeleteBlockListItems", time.Now())
 	return instance().DeleteBlockListItems(items)
 }
 
 // FetchBlockListItems retrieves from storage all block list item entities
 // associated to a given user.
 func FetchBlockListItems(username string) ([]model.BlockListItem, error) {
+	defer metrics.ObserveStorageLatency("FetchBlockListItems", time.Now())
 	return instance().FetchBlockListItems(username)
 }
@@ -7,6 +7,8 @@ package storage
 
 import (
 	"github.com/ortuman/jackal/model"
+	"github.com/ortuman/jackal/model/mucmodel"
+	"github.com/ortuman/jackal/model/pubsubmodel"
 	"github.com/ortuman/jackal/model/rostermodel"
 	"github.com/ortuman/jackal/xmpp"
 )
@@ -17,6 +19,7 @@ func (*disabledStorage) InsertOrUpdateUser(user *model.User) error      { return
 func (*disabledStorage) DeleteUser(username string) error               { return nil }
 func (*disabledStorage) FetchUser(username string) (*model.User, error) { return nil, nil }
 func (*disabledStorage) UserExists(username string) (bool, error)       { return false, nil }
+func (*disabledStorage) FetchUsernames() ([]string, error)              { return nil, nil }
 
 func (*disabledStorage) InsertOrUpdateRosterItem(ri *rostermodel.Item) (rostermodel.Version, error) {
 	return rostermodel.Version{}, nil
@@ -98,6 +101,86 @@ func (*disabledStorage) FetchBlockListItems(username string) ([]model.BlockListI
 	return nil, nil
 }
 
+func (*disabledStorage) InsertArchiveMessage(message *model.ArchiveMessage) error {
+	return nil
+}
+
+func (*disabledStorage) CountArchiveMessages(username string, filter *model.ArchiveFilter) (int, error) {
+	return 0, nil
+}
+
+func (*disabledStorage) FetchArchiveMessages(username string, filter *model.ArchiveFilter) ([]model.ArchiveMessage, error) {
+	return nil, nil
+}
+
+func (*disabledStorage) DeleteArchiveMessages(username string) error {
+	return nil
+}
+
+func (*disabledStorage) InsertOrUpdateArchivePrefs(prefs *model.ArchivePrefs) error {
+	return nil
+}
+
+func (*disabledStorage) FetchArchivePrefs(username string) (*model.ArchivePrefs, error) {
+	return nil, nil
+}
+
+func (*disabledStorage) InsertOrUpdateRoom(room *mucmodel.Room) error {
+	return nil
+}
+
+func (*disabledStorage) DeleteRoom(roomJID string) error {
+	return nil
+}
+
+func (*disabledStorage) FetchRoom(roomJID string) (*mucmodel.Room, error) {
+	return nil, nil
+}
+
+func (*disabledStorage) FetchRooms(service string) ([]mucmodel.Room, error) {
+	return nil, nil
+}
+
+func (*disabledStorage) InsertOrUpdatePubSubNode(node *pubsubmodel.Node) error {
+	return nil
+}
+
+func (*disabledStorage) DeletePubSubNode(host, name string) error {
+	return nil
+}
+
+func (*disabledStorage) FetchPubSubNode(host, name string) (*pubsubmodel.Node, error) {
+	return nil, nil
+}
+
+func (*disabledStorage) FetchPubSubNodes(host string) ([]pubsubmodel.Node, error) {
+	return nil, nil
+}
+
+func (*disabledStorage) InsertOrUpdatePubSubItem(host, name string, item *pubsubmodel.Item, maxItems int) error {
+	return nil
+}
+
+func (*disabledStorage) DeletePubSubItem(host, name, itemID string) error {
+	return nil
+}
+
+func (*disabledStorage) FetchPubSubItems(host, name string) ([]pubsubmodel.Item, error) {
+	return nil, nil
+}
+
+func (*disabledStorage) InsertS2SQueueItem(item *model.S2SQueueItem) error {
+	return nil
+}
+
+func (*disabledStorage) FetchS2SQueueItems() ([]model.S2SQueueItem, error) {
+	return nil, nil
+}
+
+func (*disabledStorage) DeleteS2SQueueItem(remoteDomain, id string) error {
+	return nil
+}
+
 func (*disabledStorage) IsClusterCompatible() bool {
 	return false
 }
@@ -0,0 +1,129 @@
+/*
+ * Copyright (c) 2018 Miguel Ángel Ortuño.
+ * See the LICENSE file for more information.
+ */
+
+package memstorage
+
+import (
+	"github.com/ortuman/jackal/model"
+	"github.com/ortuman/jackal/model/serializer"
+)
+
+// InsertArchiveMessage inserts a new message into user's archive.
+func (m *Storage) InsertArchiveMessage(message *model.ArchiveMessage) error {
+	return m.inWriteLock(func() error {
+		messages, err := m.fetchUserArchiveMessages(message.Username)
+		if err != nil {
+			return err
+		}
+		messages = append(messages, *message)
+
+		b, err := serializer.SerializeSlice(&messages)
+		if err != nil {
+			return err
+		}
+		m.bytes[archiveMessagesKey(message.Username)] = b
+		return nil
+	})
+}
+
+// CountArchiveMessages returns the number of archived messages matching
+// filter's with, start and end constraints.
+func (m *Storage) CountArchiveMessages(username string, filter *model.ArchiveFilter) (int, error) {
+	var messages []model.ArchiveMessage
+	if err := m.inReadLock(func() error {
+		var fnErr error
+		messages, fnErr = m.fetchUserArchiveMessages(username)
+		return fnErr
+	}); err != nil {
+		return 0, err
+	}
+	var count int
+	for i := range messages {
+		if filter.Matches(&messages[i]) {
+			count++
+		}
+	}
+	return count, nil
+}
+
+// FetchArchiveMessages retrieves from storage user's archived messages
+// matching a given filter, in chronological order.
+func (m *Storage) FetchArchiveMessages(username string, filter *model.ArchiveFilter) ([]model.ArchiveMessage, error) {
+	var messages []model.ArchiveMessage
+	if err := m.inReadLock(func() error {
+		var fnErr error
+		messages, fnErr = m.fetchUserArchiveMessages(username)
+		return fnErr
+	}); err != nil {
+		return nil, err
+	}
+	var res []model.ArchiveMessage
+	for i := range messages {
+		if filter.Matches(&messages[i]) {
+			res = append(res, messages[i])
+		}
+	}
+	return filter.Page(res), nil
+}
+
+// DeleteArchiveMessages clears a user message archive.
+func (m *Storage) DeleteArchiveMessages(username string) error {
+	return m.inWriteLock(func() error {
+		delete(m.bytes, archiveMessagesKey(username))
+		return nil
+	})
+}
+
+// InsertOrUpdateArchivePrefs inserts a new archiving preferences entity
+// into storage, or updates it in case it's been previously inserted.
+func (m *Storage) InsertOrUpdateArchivePrefs(prefs *model.ArchivePrefs) error {
+	b, err := serializer.Serialize(prefs)
+	if err != nil {
+		return err
+	}
+	return m.inWriteLock(func() error {
+		m.bytes[archivePrefsKey(prefs.Username)] = b
+		return nil
+	})
+}
+
+// FetchArchivePrefs retrieves from storage user's archiving preferences.
+func (m *Storage) FetchArchivePrefs(username string) (*model.ArchivePrefs, error) {
+	var b []byte
+	if err := m.inReadLock(func() error {
+		b = m.bytes[archivePrefsKey(username)]
+		return nil
+	}); err != nil {
+		return nil, err
+	}
+	if b == nil {
+		return nil, nil
+	}
+	var prefs model.ArchivePrefs
+	if err := serializer.Deserialize(b, &prefs); err != nil {
+		return nil, err
+	}
+	return &prefs, nil
+}
+
+func (m *Storage) fetchUserArchiveMessages(username string) ([]model.ArchiveMessage, error) {
+	b := m.bytes[archiveMessagesKey(username)]
+	if b == nil {
+		return nil, nil
+	}
+	var messages []model.ArchiveMessage
+	if err := serializer.DeserializeSlice(b, &messages); err != nil {
+		return nil, err
+	}
+	return messages, nil
+}
+
+func archiveMessagesKey(username string) string {
+	return "archiveMessages:" + username
+}
+
+func archivePrefsKey(username string) string {
+	return "archivePrefs:" + username
+}
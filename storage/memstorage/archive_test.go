@@ -0,0 +1,124 @@
+/*
+ * Copyright (c) 2018 Miguel Ángel Ortuño.
+ * See the LICENSE file for more information.
+ */
+
+package memstorage
+
+import (
+	"testing"
+	"time"
+
+	"github.com/ortuman/jackal/model"
+	"github.com/ortuman/jackal/xmpp"
+	"github.com/ortuman/jackal/xmpp/jid"
+	"github.com/pborman/uuid"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMemoryStorage_InsertArchiveMessage(t *testing.T) {
+	am := newArchiveMessage("noelia@jackal.im", time.Now())
+
+	s := New()
+	s.EnableMockedError()
+	require.Equal(t, ErrMockedError, s.InsertArchiveMessage(am))
+	s.DisableMockedError()
+	require.Nil(t, s.InsertArchiveMessage(am))
+}
+
+func TestMemoryStorage_CountArchiveMessages(t *testing.T) {
+	s := New()
+	_ = s.InsertArchiveMessage(newArchiveMessage("noelia@jackal.im", time.Now()))
+	_ = s.InsertArchiveMessage(newArchiveMessage("romeo@example.net", time.Now()))
+
+	s.EnableMockedError()
+	_, err := s.CountArchiveMessages("ortuman", &model.ArchiveFilter{})
+	require.Equal(t, ErrMockedError, err)
+	s.DisableMockedError()
+
+	cnt, _ := s.CountArchiveMessages("ortuman", &model.ArchiveFilter{})
+	require.Equal(t, 2, cnt)
+	cnt, _ = s.CountArchiveMessages("ortuman", &model.ArchiveFilter{With: "romeo@example.net"})
+	require.Equal(t, 1, cnt)
+}
+
+func TestMemoryStorage_FetchArchiveMessages(t *testing.T) {
+	now := time.Now()
+	am1 := newArchiveMessage("noelia@jackal.im", now)
+	am2 := newArchiveMessage("noelia@jackal.im", now.Add(time.Minute))
+	am3 := newArchiveMessage("romeo@example.net", now.Add(time.Minute*2))
+
+	s := New()
+	_ = s.InsertArchiveMessage(am1)
+	_ = s.InsertArchiveMessage(am2)
+	_ = s.InsertArchiveMessage(am3)
+
+	s.EnableMockedError()
+	_, err := s.FetchArchiveMessages("ortuman", &model.ArchiveFilter{})
+	require.Equal(t, ErrMockedError, err)
+	s.DisableMockedError()
+
+	msgs, _ := s.FetchArchiveMessages("ortuman", &model.ArchiveFilter{})
+	require.Equal(t, 3, len(msgs))
+	require.Equal(t, am1.ID, msgs[0].ID)
+	require.Equal(t, am1.Message.String(), msgs[0].Message.String())
+
+	msgs, _ = s.FetchArchiveMessages("ortuman", &model.ArchiveFilter{With: "noelia@jackal.im", Max: 1, AfterID: am1.ID})
+	require.Equal(t, 1, len(msgs))
+	require.Equal(t, am2.ID, msgs[0].ID)
+
+	msgs, _ = s.FetchArchiveMessages("ortuman", &model.ArchiveFilter{Start: now.Add(time.Second)})
+	require.Equal(t, 2, len(msgs))
+
+	msgs, _ = s.FetchArchiveMessages("noelia", &model.ArchiveFilter{})
+	require.Equal(t, 0, len(msgs))
+}
+
+func TestMemoryStorage_DeleteArchiveMessages(t *testing.T) {
+	s := New()
+	_ = s.InsertArchiveMessage(newArchiveMessage("noelia@jackal.im", time.Now()))
+
+	s.EnableMockedError()
+	require.Equal(t, ErrMockedError, s.DeleteArchiveMessages("ortuman"))
+	s.DisableMockedError()
+	require.Nil(t, s.DeleteArchiveMessages("ortuman"))
+
+	cnt, _ := s.CountArchiveMessages("ortuman", &model.ArchiveFilter{})
+	require.Equal(t, 0, cnt)
+}
+
+func TestMemoryStorage_ArchivePrefs(t *testing.T) {
+	prefs := &model.ArchivePrefs{Username: "ortuman", Default: model.ArchiveRoster, Never: []string{"romeo@example.net"}}
+
+	s := New()
+	s.EnableMockedError()
+	require.Equal(t, ErrMockedError, s.InsertOrUpdateArchivePrefs(prefs))
+	s.DisableMockedError()
+	require.Nil(t, s.InsertOrUpdateArchivePrefs(prefs))
+
+	s.EnableMockedError()
+	_, err := s.FetchArchivePrefs("ortuman")
+	require.Equal(t, ErrMockedError, err)
+	s.DisableMockedError()
+
+	p, _ := s.FetchArchivePrefs("ortuman")
+	require.Equal(t, prefs, p)
+
+	p, _ = s.FetchArchivePrefs("noelia")
+	require.Nil(t, p)
+}
+
+func newArchiveMessage(with string, createdAt time.Time) *model.ArchiveMessage {
+	from, _ := jid.NewWithString("ortuman@jackal.im/balcony", true)
+	to, _ := jid.NewWithString(with, true)
+	msg := xmpp.NewMessageType(uuid.New(), xmpp.ChatType)
+	msg.SetFromJID(from)
+	msg.SetToJID(to)
+	return &model.ArchiveMessage{
+		Username:  "ortuman",
+		ID:        uuid.New(),
+		With:      with,
+		Message:   msg,
+		CreatedAt: createdAt,
+	}
+}
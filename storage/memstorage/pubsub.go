@@ -0,0 +1,158 @@
+/*
+ * Copyright (c) 2018 Miguel Ángel Ortuño.
+ * See the LICENSE file for more information.
+ */
+
+package memstorage
+
+import (
+	"strings"
+
+	"github.com/ortuman/jackal/model/pubsubmodel"
+	"github.com/ortuman/jackal/model/serializer"
+)
+
+// InsertOrUpdatePubSubNode inserts a new pubsub node entity into storage,
+// or updates it in case it's been previously inserted.
+func (m *Storage) InsertOrUpdatePubSubNode(node *pubsubmodel.Node) error {
+	b, err := serializer.Serialize(node)
+	if err != nil {
+		return err
+	}
+	return m.inWriteLock(func() error {
+		m.bytes[pubSubNodeKey(node.Host, node.Name)] = b
+		return nil
+	})
+}
+
+// DeletePubSubNode deletes a pubsub node entity and all its published items from storage.
+func (m *Storage) DeletePubSubNode(host, name string) error {
+	return m.inWriteLock(func() error {
+		delete(m.bytes, pubSubNodeKey(host, name))
+		delete(m.bytes, pubSubItemsKey(host, name))
+		return nil
+	})
+}
+
+// FetchPubSubNode retrieves from storage a pubsub node entity.
+func (m *Storage) FetchPubSubNode(host, name string) (*pubsubmodel.Node, error) {
+	var b []byte
+	if err := m.inReadLock(func() error {
+		b = m.bytes[pubSubNodeKey(host, name)]
+		return nil
+	}); err != nil {
+		return nil, err
+	}
+	if b == nil {
+		return nil, nil
+	}
+	var node pubsubmodel.Node
+	if err := serializer.Deserialize(b, &node); err != nil {
+		return nil, err
+	}
+	return &node, nil
+}
+
+// FetchPubSubNodes retrieves from storage all node entities associated to a given host.
+func (m *Storage) FetchPubSubNodes(host string) ([]pubsubmodel.Node, error) {
+	var nodes []pubsubmodel.Node
+	if err := m.inReadLock(func() error {
+		prefix := pubSubNodeKey(host, "")
+		for k, b := range m.bytes {
+			if !strings.HasPrefix(k, prefix) {
+				continue
+			}
+			var node pubsubmodel.Node
+			if err := serializer.Deserialize(b, &node); err != nil {
+				return err
+			}
+			nodes = append(nodes, node)
+		}
+		return nil
+	}); err != nil {
+		return nil, err
+	}
+	return nodes, nil
+}
+
+// InsertOrUpdatePubSubItem inserts a new item into a pubsub node, or updates it
+// in case an item with the same identifier was previously published.
+func (m *Storage) InsertOrUpdatePubSubItem(host, name string, item *pubsubmodel.Item, maxItems int) error {
+	return m.inWriteLock(func() error {
+		items, err := m.fetchPubSubItems(host, name)
+		if err != nil {
+			return err
+		}
+		for i := range items {
+			if items[i].ID == item.ID {
+				items = append(items[:i], items[i+1:]...)
+				break
+			}
+		}
+		items = append(items, *item)
+		if maxItems > 0 && len(items) > maxItems {
+			items = items[len(items)-maxItems:]
+		}
+		b, err := serializer.SerializeSlice(&items)
+		if err != nil {
+			return err
+		}
+		m.bytes[pubSubItemsKey(host, name)] = b
+		return nil
+	})
+}
+
+// DeletePubSubItem deletes a published item from a pubsub node.
+func (m *Storage) DeletePubSubItem(host, name, itemID string) error {
+	return m.inWriteLock(func() error {
+		items, err := m.fetchPubSubItems(host, name)
+		if err != nil {
+			return err
+		}
+		for i := range items {
+			if items[i].ID == itemID {
+				items = append(items[:i], items[i+1:]...)
+				break
+			}
+		}
+		b, err := serializer.SerializeSlice(&items)
+		if err != nil {
+			return err
+		}
+		m.bytes[pubSubItemsKey(host, name)] = b
+		return nil
+	})
+}
+
+// FetchPubSubItems retrieves from storage all items published to a node, oldest first.
+func (m *Storage) FetchPubSubItems(host, name string) ([]pubsubmodel.Item, error) {
+	var items []pubsubmodel.Item
+	if err := m.inReadLock(func() error {
+		var fnErr error
+		items, fnErr = m.fetchPubSubItems(host, name)
+		return fnErr
+	}); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+func (m *Storage) fetchPubSubItems(host, name string) ([]pubsubmodel.Item, error) {
+	b := m.bytes[pubSubItemsKey(host, name)]
+	if b == nil {
+		return nil, nil
+	}
+	var items []pubsubmodel.Item
+	if err := serializer.DeserializeSlice(b, &items); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+func pubSubNodeKey(host, name string) string {
+	return "pubsubNodes:" + host + ":" + name
+}
+
+func pubSubItemsKey(host, name string) string {
+	return "pubsubItems:" + host + ":" + name
+}
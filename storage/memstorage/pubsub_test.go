@@ -0,0 +1,148 @@
+/*
+ * Copyright (c) 2018 Miguel Ángel Ortuño.
+ * See the LICENSE file for more information.
+ */
+
+package memstorage
+
+import (
+	"testing"
+
+	"github.com/ortuman/jackal/model/pubsubmodel"
+	"github.com/ortuman/jackal/xmpp"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMemoryStorage_InsertPubSubNode(t *testing.T) {
+	n := newPubSubNode("pubsub.jackal.im", "princely_musings")
+
+	s := New()
+	s.EnableMockedError()
+	require.Equal(t, ErrMockedError, s.InsertOrUpdatePubSubNode(n))
+	s.DisableMockedError()
+	require.Nil(t, s.InsertOrUpdatePubSubNode(n))
+}
+
+func TestMemoryStorage_FetchPubSubNode(t *testing.T) {
+	n := newPubSubNode("pubsub.jackal.im", "princely_musings")
+
+	s := New()
+	_ = s.InsertOrUpdatePubSubNode(n)
+
+	s.EnableMockedError()
+	_, err := s.FetchPubSubNode("pubsub.jackal.im", "princely_musings")
+	require.Equal(t, ErrMockedError, err)
+	s.DisableMockedError()
+
+	n2, err := s.FetchPubSubNode("pubsub.jackal.im", "princely_musings")
+	require.Nil(t, err)
+	require.Equal(t, n, n2)
+
+	n3, err := s.FetchPubSubNode("pubsub.jackal.im", "news")
+	require.Nil(t, err)
+	require.Nil(t, n3)
+}
+
+func TestMemoryStorage_FetchPubSubNodes(t *testing.T) {
+	s := New()
+	_ = s.InsertOrUpdatePubSubNode(newPubSubNode("pubsub.jackal.im", "princely_musings"))
+	_ = s.InsertOrUpdatePubSubNode(newPubSubNode("pubsub.jackal.im", "news"))
+	_ = s.InsertOrUpdatePubSubNode(newPubSubNode("ortuman@jackal.im", "urn:xmpp:avatar:data"))
+
+	s.EnableMockedError()
+	_, err := s.FetchPubSubNodes("pubsub.jackal.im")
+	require.Equal(t, ErrMockedError, err)
+	s.DisableMockedError()
+
+	nodes, err := s.FetchPubSubNodes("pubsub.jackal.im")
+	require.Nil(t, err)
+	require.Equal(t, 2, len(nodes))
+
+	nodes, err = s.FetchPubSubNodes("ortuman@jackal.im")
+	require.Nil(t, err)
+	require.Equal(t, 1, len(nodes))
+}
+
+func TestMemoryStorage_DeletePubSubNode(t *testing.T) {
+	s := New()
+	_ = s.InsertOrUpdatePubSubNode(newPubSubNode("pubsub.jackal.im", "princely_musings"))
+	_ = s.InsertOrUpdatePubSubItem("pubsub.jackal.im", "princely_musings", newPubSubItem("1"), 0)
+
+	s.EnableMockedError()
+	require.Equal(t, ErrMockedError, s.DeletePubSubNode("pubsub.jackal.im", "princely_musings"))
+	s.DisableMockedError()
+
+	require.Nil(t, s.DeletePubSubNode("pubsub.jackal.im", "princely_musings"))
+
+	n, err := s.FetchPubSubNode("pubsub.jackal.im", "princely_musings")
+	require.Nil(t, err)
+	require.Nil(t, n)
+
+	items, err := s.FetchPubSubItems("pubsub.jackal.im", "princely_musings")
+	require.Nil(t, err)
+	require.Equal(t, 0, len(items))
+}
+
+func TestMemoryStorage_PubSubItems(t *testing.T) {
+	s := New()
+
+	s.EnableMockedError()
+	require.Equal(t, ErrMockedError, s.InsertOrUpdatePubSubItem("pubsub.jackal.im", "princely_musings", newPubSubItem("1"), 2))
+	s.DisableMockedError()
+
+	require.Nil(t, s.InsertOrUpdatePubSubItem("pubsub.jackal.im", "princely_musings", newPubSubItem("1"), 2))
+	require.Nil(t, s.InsertOrUpdatePubSubItem("pubsub.jackal.im", "princely_musings", newPubSubItem("2"), 2))
+	require.Nil(t, s.InsertOrUpdatePubSubItem("pubsub.jackal.im", "princely_musings", newPubSubItem("3"), 2))
+
+	s.EnableMockedError()
+	_, err := s.FetchPubSubItems("pubsub.jackal.im", "princely_musings")
+	require.Equal(t, ErrMockedError, err)
+	s.DisableMockedError()
+
+	items, err := s.FetchPubSubItems("pubsub.jackal.im", "princely_musings")
+	require.Nil(t, err)
+	require.Equal(t, 2, len(items))
+	require.Equal(t, "2", items[0].ID)
+	require.Equal(t, "3", items[1].ID)
+
+	// republishing an item moves it to the tail
+	require.Nil(t, s.InsertOrUpdatePubSubItem("pubsub.jackal.im", "princely_musings", newPubSubItem("2"), 2))
+	items, _ = s.FetchPubSubItems("pubsub.jackal.im", "princely_musings")
+	require.Equal(t, 2, len(items))
+	require.Equal(t, "3", items[0].ID)
+	require.Equal(t, "2", items[1].ID)
+
+	s.EnableMockedError()
+	require.Equal(t, ErrMockedError, s.DeletePubSubItem("pubsub.jackal.im", "princely_musings", "3"))
+	s.DisableMockedError()
+
+	require.Nil(t, s.DeletePubSubItem("pubsub.jackal.im", "princely_musings", "3"))
+	items, _ = s.FetchPubSubItems("pubsub.jackal.im", "princely_musings")
+	require.Equal(t, 1, len(items))
+	require.Equal(t, "2", items[0].ID)
+}
+
+func newPubSubNode(host, name string) *pubsubmodel.Node {
+	n := &pubsubmodel.Node{
+		Host: host,
+		Name: name,
+		Options: pubsubmodel.Options{
+			DeliverPayloads: true,
+			PersistItems:    true,
+			MaxItems:        10,
+			AccessModel:     pubsubmodel.AccessModelOpen,
+			PublishModel:    pubsubmodel.PublishModelPublishers,
+		},
+	}
+	n.SetAffiliation("ortuman@jackal.im", pubsubmodel.AffiliationOwner)
+	n.SetSubscription("noelia@jackal.im", pubsubmodel.SubscriptionSubscribed)
+	return n
+}
+
+func newPubSubItem(id string) *pubsubmodel.Item {
+	return &pubsubmodel.Item{
+		ID:        id,
+		Publisher: "ortuman@jackal.im",
+		Payload:   xmpp.NewElementNamespace("entry", "http://www.w3.org/2005/Atom"),
+	}
+}
@@ -0,0 +1,79 @@
+/*
+ * Copyright (c) 2018 Miguel Ángel Ortuño.
+ * See the LICENSE file for more information.
+ */
+
+package memstorage
+
+import (
+	"strings"
+
+	"github.com/ortuman/jackal/model/mucmodel"
+	"github.com/ortuman/jackal/model/serializer"
+)
+
+// InsertOrUpdateRoom inserts a new room entity into storage,
+// or updates it in case it's been previously inserted.
+func (m *Storage) InsertOrUpdateRoom(room *mucmodel.Room) error {
+	b, err := serializer.Serialize(room)
+	if err != nil {
+		return err
+	}
+	return m.inWriteLock(func() error {
+		m.bytes[roomKey(room.JID)] = b
+		return nil
+	})
+}
+
+// DeleteRoom deletes a room entity from storage.
+func (m *Storage) DeleteRoom(roomJID string) error {
+	return m.inWriteLock(func() error {
+		delete(m.bytes, roomKey(roomJID))
+		return nil
+	})
+}
+
+// FetchRoom retrieves from storage a room entity.
+func (m *Storage) FetchRoom(roomJID string) (*mucmodel.Room, error) {
+	var b []byte
+	if err := m.inReadLock(func() error {
+		b = m.bytes[roomKey(roomJID)]
+		return nil
+	}); err != nil {
+		return nil, err
+	}
+	if b == nil {
+		return nil, nil
+	}
+	var room mucmodel.Room
+	if err := serializer.Deserialize(b, &room); err != nil {
+		return nil, err
+	}
+	return &room, nil
+}
+
+// FetchRooms retrieves from storage all room entities
+// associated to a given multi-user chat service.
+func (m *Storage) FetchRooms(service string) ([]mucmodel.Room, error) {
+	var rooms []mucmodel.Room
+	if err := m.inReadLock(func() error {
+		for k, b := range m.bytes {
+			if !strings.HasPrefix(k, "rooms:") || !strings.HasSuffix(k, "@"+service) {
+				continue
+			}
+			var room mucmodel.Room
+			if err := serializer.Deserialize(b, &room); err != nil {
+				return err
+			}
+			rooms = append(rooms, room)
+		}
+		return nil
+	}); err != nil {
+		return nil, err
+	}
+	return rooms, nil
+}
+
+func roomKey(roomJID string) string {
+	return "rooms:" + roomJID
+}
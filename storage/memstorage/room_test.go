@@ -0,0 +1,92 @@
+/*
+ * Copyright (c) 2018 Miguel Ángel Ortuño.
+ * See the LICENSE file for more information.
+ */
+
+package memstorage
+
+import (
+	"testing"
+
+	"github.com/ortuman/jackal/model/mucmodel"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMemoryStorage_InsertRoom(t *testing.T) {
+	r := newRoom("room@conference.jackal.im")
+
+	s := New()
+	s.EnableMockedError()
+	require.Equal(t, ErrMockedError, s.InsertOrUpdateRoom(r))
+	s.DisableMockedError()
+	require.Nil(t, s.InsertOrUpdateRoom(r))
+}
+
+func TestMemoryStorage_FetchRoom(t *testing.T) {
+	r := newRoom("room@conference.jackal.im")
+
+	s := New()
+	_ = s.InsertOrUpdateRoom(r)
+
+	s.EnableMockedError()
+	_, err := s.FetchRoom("room@conference.jackal.im")
+	require.Equal(t, ErrMockedError, err)
+	s.DisableMockedError()
+
+	r2, err := s.FetchRoom("room@conference.jackal.im")
+	require.Nil(t, err)
+	require.Equal(t, r, r2)
+
+	r3, err := s.FetchRoom("room2@conference.jackal.im")
+	require.Nil(t, err)
+	require.Nil(t, r3)
+}
+
+func TestMemoryStorage_FetchRooms(t *testing.T) {
+	s := New()
+	_ = s.InsertOrUpdateRoom(newRoom("room1@conference.jackal.im"))
+	_ = s.InsertOrUpdateRoom(newRoom("room2@conference.jackal.im"))
+	_ = s.InsertOrUpdateRoom(newRoom("room3@muc.jackal.im"))
+
+	s.EnableMockedError()
+	_, err := s.FetchRooms("conference.jackal.im")
+	require.Equal(t, ErrMockedError, err)
+	s.DisableMockedError()
+
+	rooms, err := s.FetchRooms("conference.jackal.im")
+	require.Nil(t, err)
+	require.Equal(t, 2, len(rooms))
+
+	rooms, err = s.FetchRooms("muc.jackal.im")
+	require.Nil(t, err)
+	require.Equal(t, 1, len(rooms))
+}
+
+func TestMemoryStorage_DeleteRoom(t *testing.T) {
+	s := New()
+	_ = s.InsertOrUpdateRoom(newRoom("room@conference.jackal.im"))
+
+	s.EnableMockedError()
+	require.Equal(t, ErrMockedError, s.DeleteRoom("room@conference.jackal.im"))
+	s.DisableMockedError()
+
+	require.Nil(t, s.DeleteRoom("room@conference.jackal.im"))
+
+	r, err := s.FetchRoom("room@conference.jackal.im")
+	require.Nil(t, err)
+	require.Nil(t, r)
+}
+
+func newRoom(roomJID string) *mucmodel.Room {
+	r := &mucmodel.Room{
+		JID: roomJID,
+		Config: mucmodel.RoomConfig{
+			Name:       "Room",
+			Persistent: true,
+			Whois:      mucmodel.WhoisModerators,
+		},
+		Subject: "Hi there!",
+	}
+	r.SetAffiliation("ortuman@jackal.im", mucmodel.AffiliationOwner)
+	return r
+}
@@ -0,0 +1,78 @@
+/*
+ * Copyright (c) 2018 Miguel Ángel Ortuño.
+ * See the LICENSE file for more information.
+ */
+
+package memstorage
+
+import (
+	"github.com/ortuman/jackal/model"
+	"github.com/ortuman/jackal/model/serializer"
+)
+
+// InsertS2SQueueItem inserts a new stanza into its remote domain
+// outgoing queue.
+func (m *Storage) InsertS2SQueueItem(item *model.S2SQueueItem) error {
+	return m.inWriteLock(func() error {
+		items, err := m.fetchS2SQueueItems()
+		if err != nil {
+			return err
+		}
+		items = append(items, *item)
+		return m.storeS2SQueueItems(items)
+	})
+}
+
+// FetchS2SQueueItems retrieves from storage every pending outgoing
+// s2s queue item, in enqueueing order.
+func (m *Storage) FetchS2SQueueItems() ([]model.S2SQueueItem, error) {
+	var items []model.S2SQueueItem
+	if err := m.inReadLock(func() error {
+		var fnErr error
+		items, fnErr = m.fetchS2SQueueItems()
+		return fnErr
+	}); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+// DeleteS2SQueueItem removes an item from a remote domain outgoing queue.
+func (m *Storage) DeleteS2SQueueItem(remoteDomain, id string) error {
+	return m.inWriteLock(func() error {
+		items, err := m.fetchS2SQueueItems()
+		if err != nil {
+			return err
+		}
+		for i, item := range items {
+			if item.RemoteDomain == remoteDomain && item.ID == id {
+				items = append(items[:i], items[i+1:]...)
+				return m.storeS2SQueueItems(items)
+			}
+		}
+		return nil
+	})
+}
+
+func (m *Storage) fetchS2SQueueItems() ([]model.S2SQueueItem, error) {
+	b := m.bytes[s2sQueueItemsKey]
+	if b == nil {
+		return nil, nil
+	}
+	var items []model.S2SQueueItem
+	if err := serializer.DeserializeSlice(b, &items); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+func (m *Storage) storeS2SQueueItems(items []model.S2SQueueItem) error {
+	b, err := serializer.SerializeSlice(&items)
+	if err != nil {
+		return err
+	}
+	m.bytes[s2sQueueItemsKey] = b
+	return nil
+}
+
+const s2sQueueItemsKey = "s2sQueueItems"
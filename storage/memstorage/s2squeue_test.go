@@ -0,0 +1,78 @@
+/*
+ * Copyright (c) 2018 Miguel Ángel Ortuño.
+ * See the LICENSE file for more information.
+ */
+
+package memstorage
+
+import (
+	"testing"
+	"time"
+
+	"github.com/ortuman/jackal/model"
+	"github.com/ortuman/jackal/xmpp"
+	"github.com/ortuman/jackal/xmpp/jid"
+	"github.com/pborman/uuid"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMemoryStorage_InsertS2SQueueItem(t *testing.T) {
+	qi := newS2SQueueItem("example.net", time.Now())
+
+	s := New()
+	s.EnableMockedError()
+	require.Equal(t, ErrMockedError, s.InsertS2SQueueItem(qi))
+	s.DisableMockedError()
+	require.Nil(t, s.InsertS2SQueueItem(qi))
+}
+
+func TestMemoryStorage_FetchS2SQueueItems(t *testing.T) {
+	now := time.Now()
+	qi1 := newS2SQueueItem("example.net", now)
+	qi2 := newS2SQueueItem("jabber.org", now.Add(time.Second))
+
+	s := New()
+	_ = s.InsertS2SQueueItem(qi1)
+	_ = s.InsertS2SQueueItem(qi2)
+
+	s.EnableMockedError()
+	_, err := s.FetchS2SQueueItems()
+	require.Equal(t, ErrMockedError, err)
+	s.DisableMockedError()
+
+	items, err := s.FetchS2SQueueItems()
+	require.Nil(t, err)
+	require.Len(t, items, 2)
+	require.Equal(t, qi1.ID, items[0].ID)
+	require.Equal(t, qi1.Stanza.String(), items[0].Stanza.String())
+	require.Equal(t, qi2.ID, items[1].ID)
+}
+
+func TestMemoryStorage_DeleteS2SQueueItem(t *testing.T) {
+	qi1 := newS2SQueueItem("example.net", time.Now())
+	qi2 := newS2SQueueItem("example.net", time.Now())
+
+	s := New()
+	_ = s.InsertS2SQueueItem(qi1)
+	_ = s.InsertS2SQueueItem(qi2)
+
+	s.EnableMockedError()
+	require.Equal(t, ErrMockedError, s.DeleteS2SQueueItem("example.net", qi1.ID))
+	s.DisableMockedError()
+
+	require.Nil(t, s.DeleteS2SQueueItem("jabber.org", qi1.ID))
+	require.Nil(t, s.DeleteS2SQueueItem("example.net", qi1.ID))
+
+	items, _ := s.FetchS2SQueueItems()
+	require.Len(t, items, 1)
+	require.Equal(t, qi2.ID, items[0].ID)
+}
+
+func newS2SQueueItem(remoteDomain string, enqueuedAt time.Time) *model.S2SQueueItem {
+	from, _ := jid.NewWithString("ortuman@jackal.im/balcony", true)
+	to, _ := jid.NewWithString("romeo@"+remoteDomain, true)
+	msg := xmpp.NewMessageType(uuid.New(), xmpp.ChatType)
+	msg.SetFromJID(from)
+	msg.SetToJID(to)
+	return &model.S2SQueueItem{ID: uuid.New(), RemoteDomain: remoteDomain, Stanza: msg, EnqueuedAt: enqueuedAt}
+}
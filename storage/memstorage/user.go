@@ -6,6 +6,9 @@
 package memstorage
 
 import (
+	"sort"
+	"strings"
+
 	"github.com/ortuman/jackal/model"
 	"github.com/ortuman/jackal/model/serializer"
 )
@@ -62,6 +65,24 @@ func (m *Storage) UserExists(username string) (bool, error) {
 	return b != nil, nil
 }
 
+// FetchUsernames retrieves from storage all registered usernames in ascending order.
+func (m *Storage) FetchUsernames() ([]string, error) {
+	var usernames []string
+	if err := m.inReadLock(func() error {
+		for k := range m.bytes {
+			if !strings.HasPrefix(k, "users:") {
+				continue
+			}
+			usernames = append(usernames, strings.TrimPrefix(k, "users:"))
+		}
+		return nil
+	}); err != nil {
+		return nil, err
+	}
+	sort.Strings(usernames)
+	return usernames, nil
+}
+
 func userKey(username string) string {
 	return "users:" + username
 }
@@ -64,3 +64,18 @@ func TestMemoryStorage_DeleteUser(t *testing.T) {
 	usr, _ := s.FetchUser("ortuman")
 	require.Nil(t, usr)
 }
+
+func TestMemoryStorage_FetchUsernames(t *testing.T) {
+	s := New()
+	_ = s.InsertOrUpdateUser(&model.User{Username: "ortuman"})
+	_ = s.InsertOrUpdateUser(&model.User{Username: "noelia"})
+
+	s.EnableMockedError()
+	_, err := s.FetchUsernames()
+	require.Equal(t, ErrMockedError, err)
+	s.DisableMockedError()
+
+	usernames, err := s.FetchUsernames()
+	require.Nil(t, err)
+	require.Equal(t, []string{"noelia", "ortuman"}, usernames)
+}
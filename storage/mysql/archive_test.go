@@ -0,0 +1,189 @@
+/*
+ * Copyright (c) 2018 Miguel Ángel Ortuño.
+ * See the LICENSE file for more information.
+ */
+
+package mysql
+
+import (
+	"testing"
+	"time"
+
+	sqlmock "github.com/DATA-DOG/go-sqlmock"
+	"github.com/ortuman/jackal/model"
+	"github.com/ortuman/jackal/xmpp"
+	"github.com/ortuman/jackal/xmpp/jid"
+	"github.com/stretchr/testify/require"
+)
+
+var archiveMessageColumns = []string{"username", "id", "with_jid", "data", "created_at"}
+
+func TestMySQLStorageInsertArchiveMessage(t *testing.T) {
+	j, _ := jid.NewWithString("ortuman@jackal.im/balcony", false)
+	msg := xmpp.NewMessageType("abc", xmpp.ChatType)
+	msg.SetFromJID(j)
+	msg.SetToJID(j)
+
+	now := time.Now()
+	am := &model.ArchiveMessage{Username: "ortuman", ID: "1234", With: "noelia@jackal.im", Message: msg, CreatedAt: now}
+
+	s, mock := NewMock()
+	mock.ExpectExec("INSERT INTO archive_messages (.+)").
+		WithArgs("ortuman", "1234", "noelia@jackal.im", msg.String(), now).
+		WillReturnResult(sqlmock.NewResult(1, 1))
+
+	require.Nil(t, s.InsertArchiveMessage(am))
+	require.Nil(t, mock.ExpectationsWereMet())
+
+	s, mock = NewMock()
+	mock.ExpectExec("INSERT INTO archive_messages (.+)").
+		WithArgs("ortuman", "1234", "noelia@jackal.im", msg.String(), now).
+		WillReturnError(errMySQLStorage)
+
+	require.Equal(t, errMySQLStorage, s.InsertArchiveMessage(am))
+	require.Nil(t, mock.ExpectationsWereMet())
+}
+
+func TestMySQLStorageCountArchiveMessages(t *testing.T) {
+	s, mock := NewMock()
+	mock.ExpectQuery("SELECT COUNT(.+) FROM archive_messages WHERE \\(username = \\? AND with_jid = \\?\\)").
+		WithArgs("ortuman", "noelia@jackal.im").
+		WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(2))
+
+	cnt, err := s.CountArchiveMessages("ortuman", &model.ArchiveFilter{With: "noelia@jackal.im"})
+	require.Nil(t, mock.ExpectationsWereMet())
+	require.Nil(t, err)
+	require.Equal(t, 2, cnt)
+
+	s, mock = NewMock()
+	mock.ExpectQuery("SELECT COUNT(.+) FROM archive_messages (.+)").
+		WithArgs("ortuman").
+		WillReturnError(errMySQLStorage)
+
+	_, err = s.CountArchiveMessages("ortuman", &model.ArchiveFilter{})
+	require.Nil(t, mock.ExpectationsWereMet())
+	require.Equal(t, errMySQLStorage, err)
+}
+
+func TestMySQLStorageFetchArchiveMessages(t *testing.T) {
+	now := time.Now()
+
+	s, mock := NewMock()
+	mock.ExpectQuery("SELECT (.+) FROM archive_messages WHERE (.+) ORDER BY serial LIMIT 10").
+		WithArgs("ortuman", "ortuman", "1234").
+		WillReturnRows(sqlmock.NewRows(archiveMessageColumns).
+			AddRow("ortuman", "1235", "noelia@jackal.im", "<message id='a'><body>Hi!</body></message>", now).
+			AddRow("ortuman", "1236", "noelia@jackal.im", "<message id='b'><body>Bye!</body></message>", now))
+
+	msgs, err := s.FetchArchiveMessages("ortuman", &model.ArchiveFilter{AfterID: "1234", Max: 10})
+	require.Nil(t, mock.ExpectationsWereMet())
+	require.Nil(t, err)
+	require.Equal(t, 2, len(msgs))
+	require.Equal(t, "1235", msgs[0].ID)
+	require.Equal(t, "a", msgs[0].Message.ID())
+
+	// last page must be returned in chronological order
+	s, mock = NewMock()
+	mock.ExpectQuery("SELECT (.+) FROM archive_messages WHERE (.+) ORDER BY serial DESC LIMIT 2").
+		WithArgs("ortuman").
+		WillReturnRows(sqlmock.NewRows(archiveMessageColumns).
+			AddRow("ortuman", "1236", "noelia@jackal.im", "<message id='b'><body>Bye!</body></message>", now).
+			AddRow("ortuman", "1235", "noelia@jackal.im", "<message id='a'><body>Hi!</body></message>", now))
+
+	msgs, err = s.FetchArchiveMessages("ortuman", &model.ArchiveFilter{LastPage: true, Max: 2})
+	require.Nil(t, mock.ExpectationsWereMet())
+	require.Nil(t, err)
+	require.Equal(t, 2, len(msgs))
+	require.Equal(t, "1235", msgs[0].ID)
+
+	s, mock = NewMock()
+	mock.ExpectQuery("SELECT (.+) FROM archive_messages (.+)").
+		WithArgs("ortuman").
+		WillReturnRows(sqlmock.NewRows(archiveMessageColumns).
+			AddRow("ortuman", "1235", "noelia@jackal.im", "<message id='a'><body>Hi!", now))
+
+	_, err = s.FetchArchiveMessages("ortuman", &model.ArchiveFilter{})
+	require.Nil(t, mock.ExpectationsWereMet())
+	require.NotNil(t, err)
+
+	s, mock = NewMock()
+	mock.ExpectQuery("SELECT (.+) FROM archive_messages (.+)").
+		WithArgs("ortuman").
+		WillReturnError(errMySQLStorage)
+
+	_, err = s.FetchArchiveMessages("ortuman", &model.ArchiveFilter{})
+	require.Nil(t, mock.ExpectationsWereMet())
+	require.Equal(t, errMySQLStorage, err)
+}
+
+func TestMySQLStorageDeleteArchiveMessages(t *testing.T) {
+	s, mock := NewMock()
+	mock.ExpectExec("DELETE FROM archive_messages (.+)").
+		WithArgs("ortuman").WillReturnResult(sqlmock.NewResult(0, 1))
+
+	require.Nil(t, s.DeleteArchiveMessages("ortuman"))
+	require.Nil(t, mock.ExpectationsWereMet())
+
+	s, mock = NewMock()
+	mock.ExpectExec("DELETE FROM archive_messages (.+)").
+		WithArgs("ortuman").WillReturnError(errMySQLStorage)
+
+	require.Equal(t, errMySQLStorage, s.DeleteArchiveMessages("ortuman"))
+	require.Nil(t, mock.ExpectationsWereMet())
+}
+
+func TestMySQLStorageInsertArchivePrefs(t *testing.T) {
+	prefs := &model.ArchivePrefs{Username: "ortuman", Default: model.ArchiveRoster, Always: []string{"noelia@jackal.im"}}
+	always := []byte(`["noelia@jackal.im"]`)
+	never := []byte(`null`)
+
+	s, mock := NewMock()
+	mock.ExpectExec("INSERT INTO archive_prefs (.+) ON DUPLICATE KEY UPDATE (.+)").
+		WithArgs("ortuman", model.ArchiveRoster, always, never, model.ArchiveRoster, always, never).
+		WillReturnResult(sqlmock.NewResult(1, 1))
+
+	require.Nil(t, s.InsertOrUpdateArchivePrefs(prefs))
+	require.Nil(t, mock.ExpectationsWereMet())
+
+	s, mock = NewMock()
+	mock.ExpectExec("INSERT INTO archive_prefs (.+) ON DUPLICATE KEY UPDATE (.+)").
+		WithArgs("ortuman", model.ArchiveRoster, always, never, model.ArchiveRoster, always, never).
+		WillReturnError(errMySQLStorage)
+
+	require.Equal(t, errMySQLStorage, s.InsertOrUpdateArchivePrefs(prefs))
+	require.Nil(t, mock.ExpectationsWereMet())
+}
+
+func TestMySQLStorageFetchArchivePrefs(t *testing.T) {
+	var prefsColumns = []string{"username", "default_mode", "always", "never"}
+
+	s, mock := NewMock()
+	mock.ExpectQuery("SELECT (.+) FROM archive_prefs (.+)").
+		WithArgs("ortuman").
+		WillReturnRows(sqlmock.NewRows(prefsColumns).AddRow("ortuman", "never", `["noelia@jackal.im"]`, `[]`))
+
+	prefs, err := s.FetchArchivePrefs("ortuman")
+	require.Nil(t, mock.ExpectationsWereMet())
+	require.Nil(t, err)
+	require.Equal(t, model.ArchiveNever, prefs.Default)
+	require.Equal(t, []string{"noelia@jackal.im"}, prefs.Always)
+
+	s, mock = NewMock()
+	mock.ExpectQuery("SELECT (.+) FROM archive_prefs (.+)").
+		WithArgs("ortuman").
+		WillReturnRows(sqlmock.NewRows(prefsColumns))
+
+	prefs, err = s.FetchArchivePrefs("ortuman")
+	require.Nil(t, mock.ExpectationsWereMet())
+	require.Nil(t, err)
+	require.Nil(t, prefs)
+
+	s, mock = NewMock()
+	mock.ExpectQuery("SELECT (.+) FROM archive_prefs (.+)").
+		WithArgs("ortuman").
+		WillReturnError(errMySQLStorage)
+
+	_, err = s.FetchArchivePrefs("ortuman")
+	require.Nil(t, mock.ExpectationsWereMet())
+	require.Equal(t, errMySQLStorage, err)
+}
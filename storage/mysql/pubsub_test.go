@@ -0,0 +1,222 @@
+/*
+ * Copyright (c) 2018 Miguel Ángel Ortuño.
+ * See the LICENSE file for more information.
+ */
+
+package mysql
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	sqlmock "github.com/DATA-DOG/go-sqlmock"
+	"github.com/ortuman/jackal/model/pubsubmodel"
+	"github.com/ortuman/jackal/xmpp"
+	"github.com/stretchr/testify/require"
+)
+
+var (
+	pubSubNodeColumns = []string{"host", "name", "options", "affiliations", "subscriptions"}
+	pubSubItemColumns = []string{"item_id", "publisher", "payload", "created_at"}
+)
+
+func TestMySQLStorageInsertPubSubNode(t *testing.T) {
+	node := &pubsubmodel.Node{
+		Host:    "pubsub.jackal.im",
+		Name:    "princely_musings",
+		Options: pubsubmodel.Options{Title: "Princely Musings", AccessModel: pubsubmodel.AccessModelOpen},
+	}
+	node.SetAffiliation("ortuman@jackal.im", pubsubmodel.AffiliationOwner)
+	node.SetSubscription("noelia@jackal.im", pubsubmodel.SubscriptionSubscribed)
+
+	options, _ := json.Marshal(&node.Options)
+	affiliations := []byte(`{"ortuman@jackal.im":"owner"}`)
+	subscriptions := []byte(`{"noelia@jackal.im":"subscribed"}`)
+
+	s, mock := NewMock()
+	mock.ExpectExec("INSERT INTO pubsub_nodes (.+) ON DUPLICATE KEY UPDATE (.+)").
+		WithArgs("pubsub.jackal.im", "princely_musings", options, affiliations, subscriptions, options, affiliations, subscriptions).
+		WillReturnResult(sqlmock.NewResult(1, 1))
+
+	require.Nil(t, s.InsertOrUpdatePubSubNode(node))
+	require.Nil(t, mock.ExpectationsWereMet())
+
+	s, mock = NewMock()
+	mock.ExpectExec("INSERT INTO pubsub_nodes (.+) ON DUPLICATE KEY UPDATE (.+)").
+		WithArgs("pubsub.jackal.im", "princely_musings", options, affiliations, subscriptions, options, affiliations, subscriptions).
+		WillReturnError(errMySQLStorage)
+
+	require.Equal(t, errMySQLStorage, s.InsertOrUpdatePubSubNode(node))
+	require.Nil(t, mock.ExpectationsWereMet())
+}
+
+func TestMySQLStorageDeletePubSubNode(t *testing.T) {
+	s, mock := NewMock()
+	mock.ExpectBegin()
+	mock.ExpectExec("DELETE FROM pubsub_items (.+)").
+		WithArgs("pubsub.jackal.im", "princely_musings").
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec("DELETE FROM pubsub_nodes (.+)").
+		WithArgs("pubsub.jackal.im", "princely_musings").
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+
+	require.Nil(t, s.DeletePubSubNode("pubsub.jackal.im", "princely_musings"))
+	require.Nil(t, mock.ExpectationsWereMet())
+
+	s, mock = NewMock()
+	mock.ExpectBegin()
+	mock.ExpectExec("DELETE FROM pubsub_items (.+)").
+		WithArgs("pubsub.jackal.im", "princely_musings").
+		WillReturnError(errMySQLStorage)
+	mock.ExpectRollback()
+
+	require.Equal(t, errMySQLStorage, s.DeletePubSubNode("pubsub.jackal.im", "princely_musings"))
+	require.Nil(t, mock.ExpectationsWereMet())
+}
+
+func TestMySQLStorageFetchPubSubNode(t *testing.T) {
+	s, mock := NewMock()
+	mock.ExpectQuery("SELECT (.+) FROM pubsub_nodes (.+)").
+		WithArgs("pubsub.jackal.im", "princely_musings").
+		WillReturnRows(sqlmock.NewRows(pubSubNodeColumns).
+			AddRow("pubsub.jackal.im", "princely_musings", `{"Title":"Princely Musings","AccessModel":"open"}`, `{"ortuman@jackal.im":"owner"}`, `{}`))
+
+	node, err := s.FetchPubSubNode("pubsub.jackal.im", "princely_musings")
+	require.Nil(t, mock.ExpectationsWereMet())
+	require.Nil(t, err)
+	require.NotNil(t, node)
+	require.Equal(t, "Princely Musings", node.Options.Title)
+	require.Equal(t, pubsubmodel.AccessModelOpen, node.Options.AccessModel)
+	require.Equal(t, pubsubmodel.AffiliationOwner, node.Affiliation("ortuman@jackal.im"))
+
+	s, mock = NewMock()
+	mock.ExpectQuery("SELECT (.+) FROM pubsub_nodes (.+)").
+		WithArgs("pubsub.jackal.im", "princely_musings").
+		WillReturnRows(sqlmock.NewRows(pubSubNodeColumns))
+
+	node, err = s.FetchPubSubNode("pubsub.jackal.im", "princely_musings")
+	require.Nil(t, mock.ExpectationsWereMet())
+	require.Nil(t, err)
+	require.Nil(t, node)
+
+	s, mock = NewMock()
+	mock.ExpectQuery("SELECT (.+) FROM pubsub_nodes (.+)").
+		WithArgs("pubsub.jackal.im", "princely_musings").
+		WillReturnError(errMySQLStorage)
+
+	_, err = s.FetchPubSubNode("pubsub.jackal.im", "princely_musings")
+	require.Nil(t, mock.ExpectationsWereMet())
+	require.Equal(t, errMySQLStorage, err)
+}
+
+func TestMySQLStorageFetchPubSubNodes(t *testing.T) {
+	s, mock := NewMock()
+	mock.ExpectQuery("SELECT (.+) FROM pubsub_nodes (.+)").
+		WithArgs("pubsub.jackal.im").
+		WillReturnRows(sqlmock.NewRows(pubSubNodeColumns).
+			AddRow("pubsub.jackal.im", "princely_musings", `{}`, `{}`, `{}`).
+			AddRow("pubsub.jackal.im", "news", `{}`, `{}`, `{}`))
+
+	nodes, err := s.FetchPubSubNodes("pubsub.jackal.im")
+	require.Nil(t, mock.ExpectationsWereMet())
+	require.Nil(t, err)
+	require.Equal(t, 2, len(nodes))
+	require.Equal(t, "news", nodes[1].Name)
+
+	s, mock = NewMock()
+	mock.ExpectQuery("SELECT (.+) FROM pubsub_nodes (.+)").
+		WithArgs("pubsub.jackal.im").
+		WillReturnError(errMySQLStorage)
+
+	_, err = s.FetchPubSubNodes("pubsub.jackal.im")
+	require.Nil(t, mock.ExpectationsWereMet())
+	require.Equal(t, errMySQLStorage, err)
+}
+
+func TestMySQLStorageInsertPubSubItem(t *testing.T) {
+	now := time.Now()
+	item := &pubsubmodel.Item{
+		ID:        "1",
+		Publisher: "ortuman@jackal.im",
+		Payload:   xmpp.NewElementNamespace("entry", "http://www.w3.org/2005/Atom"),
+		CreatedAt: now,
+	}
+	s, mock := NewMock()
+	mock.ExpectBegin()
+	mock.ExpectExec("DELETE FROM pubsub_items (.+)").
+		WithArgs("pubsub.jackal.im", "princely_musings", "1").
+		WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec("INSERT INTO pubsub_items (.+)").
+		WithArgs("pubsub.jackal.im", "princely_musings", "1", "ortuman@jackal.im", `<entry xmlns="http://www.w3.org/2005/Atom"/>`, now).
+		WillReturnResult(sqlmock.NewResult(1, 1))
+	mock.ExpectQuery("SELECT serial FROM pubsub_items (.+) ORDER BY serial DESC LIMIT 1 OFFSET 10").
+		WithArgs("pubsub.jackal.im", "princely_musings").
+		WillReturnRows(sqlmock.NewRows([]string{"serial"}).AddRow(5))
+	mock.ExpectExec("DELETE FROM pubsub_items (.+)").
+		WithArgs("pubsub.jackal.im", "princely_musings", 5).
+		WillReturnResult(sqlmock.NewResult(0, 5))
+	mock.ExpectCommit()
+
+	require.Nil(t, s.InsertOrUpdatePubSubItem("pubsub.jackal.im", "princely_musings", item, 10))
+	require.Nil(t, mock.ExpectationsWereMet())
+
+	s, mock = NewMock()
+	mock.ExpectBegin()
+	mock.ExpectExec("DELETE FROM pubsub_items (.+)").
+		WithArgs("pubsub.jackal.im", "princely_musings", "1").
+		WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec("INSERT INTO pubsub_items (.+)").
+		WillReturnError(errMySQLStorage)
+	mock.ExpectRollback()
+
+	require.Equal(t, errMySQLStorage, s.InsertOrUpdatePubSubItem("pubsub.jackal.im", "princely_musings", item, 10))
+	require.Nil(t, mock.ExpectationsWereMet())
+}
+
+func TestMySQLStorageDeletePubSubItem(t *testing.T) {
+	s, mock := NewMock()
+	mock.ExpectExec("DELETE FROM pubsub_items (.+)").
+		WithArgs("pubsub.jackal.im", "princely_musings", "1").
+		WillReturnResult(sqlmock.NewResult(0, 1))
+
+	require.Nil(t, s.DeletePubSubItem("pubsub.jackal.im", "princely_musings", "1"))
+	require.Nil(t, mock.ExpectationsWereMet())
+
+	s, mock = NewMock()
+	mock.ExpectExec("DELETE FROM pubsub_items (.+)").
+		WithArgs("pubsub.jackal.im", "princely_musings", "1").
+		WillReturnError(errMySQLStorage)
+
+	require.Equal(t, errMySQLStorage, s.DeletePubSubItem("pubsub.jackal.im", "princely_musings", "1"))
+	require.Nil(t, mock.ExpectationsWereMet())
+}
+
+func TestMySQLStorageFetchPubSubItems(t *testing.T) {
+	now := time.Now()
+
+	s, mock := NewMock()
+	mock.ExpectQuery("SELECT (.+) FROM pubsub_items (.+)").
+		WithArgs("pubsub.jackal.im", "princely_musings").
+		WillReturnRows(sqlmock.NewRows(pubSubItemColumns).
+			AddRow("1", "ortuman@jackal.im", `<entry xmlns="http://www.w3.org/2005/Atom"><title>Soliloquy</title></entry>`, now).
+			AddRow("2", "ortuman@jackal.im", "", now))
+
+	items, err := s.FetchPubSubItems("pubsub.jackal.im", "princely_musings")
+	require.Nil(t, mock.ExpectationsWereMet())
+	require.Nil(t, err)
+	require.Equal(t, 2, len(items))
+	require.Equal(t, "entry", items[0].Payload.Name())
+	require.Equal(t, "Soliloquy", items[0].Payload.Elements().Child("title").Text())
+	require.Nil(t, items[1].Payload)
+
+	s, mock = NewMock()
+	mock.ExpectQuery("SELECT (.+) FROM pubsub_items (.+)").
+		WithArgs("pubsub.jackal.im", "princely_musings").
+		WillReturnError(errMySQLStorage)
+
+	_, err = s.FetchPubSubItems("pubsub.jackal.im", "princely_musings")
+	require.Nil(t, mock.ExpectationsWereMet())
+	require.Equal(t, errMySQLStorage, err)
+}
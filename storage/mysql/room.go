@@ -0,0 +1,104 @@
+/*
+ * Copyright (c) 2018 Miguel Ángel Ortuño.
+ * See the LICENSE file for more information.
+ */
+
+package mysql
+
+import (
+	"encoding/json"
+	"strings"
+
+	sq "github.com/Masterminds/squirrel"
+	"github.com/ortuman/jackal/model/mucmodel"
+)
+
+// InsertOrUpdateRoom inserts a new room entity into storage,
+// or updates it in case it's been previously inserted.
+func (s *Storage) InsertOrUpdateRoom(room *mucmodel.Room) error {
+	configBytes, err := json.Marshal(&room.Config)
+	if err != nil {
+		return err
+	}
+	affiliationsBytes, err := json.Marshal(room.Affiliations)
+	if err != nil {
+		return err
+	}
+	q := sq.Insert("rooms").
+		Columns("jid", "service", "config", "subject", "affiliations", "updated_at", "created_at").
+		Values(room.JID, roomService(room.JID), configBytes, room.Subject, affiliationsBytes, nowExpr, nowExpr).
+		Suffix("ON DUPLICATE KEY UPDATE config = ?, subject = ?, affiliations = ?, updated_at = NOW()", configBytes, room.Subject, affiliationsBytes)
+	_, err = q.RunWith(s.db).Exec()
+	return err
+}
+
+// DeleteRoom deletes a room entity from storage.
+func (s *Storage) DeleteRoom(roomJID string) error {
+	_, err := sq.Delete("rooms").Where(sq.Eq{"jid": roomJID}).RunWith(s.db).Exec()
+	return err
+}
+
+// FetchRoom retrieves from storage a room entity.
+func (s *Storage) FetchRoom(roomJID string) (*mucmodel.Room, error) {
+	q := sq.Select("jid", "config", "subject", "affiliations").
+		From("rooms").
+		Where(sq.Eq{"jid": roomJID})
+
+	rows, err := q.RunWith(s.db).Query()
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = rows.Close() }()
+
+	rooms, err := s.scanRoomEntities(rows)
+	if err != nil {
+		return nil, err
+	}
+	if len(rooms) == 0 {
+		return nil, nil
+	}
+	return &rooms[0], nil
+}
+
+// FetchRooms retrieves from storage all room entities
+// associated to a given multi-user chat service.
+func (s *Storage) FetchRooms(service string) ([]mucmodel.Room, error) {
+	q := sq.Select("jid", "config", "subject", "affiliations").
+		From("rooms").
+		Where(sq.Eq{"service": service}).
+		OrderBy("created_at")
+
+	rows, err := q.RunWith(s.db).Query()
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = rows.Close() }()
+
+	return s.scanRoomEntities(rows)
+}
+
+func (s *Storage) scanRoomEntities(scanner rowsScanner) ([]mucmodel.Room, error) {
+	var ret []mucmodel.Room
+	for scanner.Next() {
+		var room mucmodel.Room
+		var configJSON, affiliationsJSON string
+		if err := scanner.Scan(&room.JID, &configJSON, &room.Subject, &affiliationsJSON); err != nil {
+			return nil, err
+		}
+		if err := json.NewDecoder(strings.NewReader(configJSON)).Decode(&room.Config); err != nil {
+			return nil, err
+		}
+		if err := json.NewDecoder(strings.NewReader(affiliationsJSON)).Decode(&room.Affiliations); err != nil {
+			return nil, err
+		}
+		ret = append(ret, room)
+	}
+	return ret, nil
+}
+
+func roomService(roomJID string) string {
+	if i := strings.Index(roomJID, "@"); i != -1 {
+		return roomJID[i+1:]
+	}
+	return roomJID
+}
@@ -0,0 +1,121 @@
+/*
+ * Copyright (c) 2018 Miguel Ángel Ortuño.
+ * See the LICENSE file for more information.
+ */
+
+package mysql
+
+import (
+	"encoding/json"
+	"testing"
+
+	sqlmock "github.com/DATA-DOG/go-sqlmock"
+	"github.com/ortuman/jackal/model/mucmodel"
+	"github.com/stretchr/testify/require"
+)
+
+var roomColumns = []string{"jid", "config", "subject", "affiliations"}
+
+func TestMySQLStorageInsertRoom(t *testing.T) {
+	room := &mucmodel.Room{
+		JID:     "room@conference.jackal.im",
+		Config:  mucmodel.RoomConfig{Name: "Room", Persistent: true},
+		Subject: "Hi there!",
+	}
+	room.SetAffiliation("ortuman@jackal.im", mucmodel.AffiliationOwner)
+
+	config, _ := json.Marshal(&room.Config)
+	affiliations := []byte(`{"ortuman@jackal.im":"owner"}`)
+
+	s, mock := NewMock()
+	mock.ExpectExec("INSERT INTO rooms (.+) ON DUPLICATE KEY UPDATE (.+)").
+		WithArgs("room@conference.jackal.im", "conference.jackal.im", config, "Hi there!", affiliations, config, "Hi there!", affiliations).
+		WillReturnResult(sqlmock.NewResult(1, 1))
+
+	require.Nil(t, s.InsertOrUpdateRoom(room))
+	require.Nil(t, mock.ExpectationsWereMet())
+
+	s, mock = NewMock()
+	mock.ExpectExec("INSERT INTO rooms (.+) ON DUPLICATE KEY UPDATE (.+)").
+		WithArgs("room@conference.jackal.im", "conference.jackal.im", config, "Hi there!", affiliations, config, "Hi there!", affiliations).
+		WillReturnError(errMySQLStorage)
+
+	require.Equal(t, errMySQLStorage, s.InsertOrUpdateRoom(room))
+	require.Nil(t, mock.ExpectationsWereMet())
+}
+
+func TestMySQLStorageDeleteRoom(t *testing.T) {
+	s, mock := NewMock()
+	mock.ExpectExec("DELETE FROM rooms (.+)").
+		WithArgs("room@conference.jackal.im").
+		WillReturnResult(sqlmock.NewResult(0, 1))
+
+	require.Nil(t, s.DeleteRoom("room@conference.jackal.im"))
+	require.Nil(t, mock.ExpectationsWereMet())
+
+	s, mock = NewMock()
+	mock.ExpectExec("DELETE FROM rooms (.+)").
+		WithArgs("room@conference.jackal.im").
+		WillReturnError(errMySQLStorage)
+
+	require.Equal(t, errMySQLStorage, s.DeleteRoom("room@conference.jackal.im"))
+	require.Nil(t, mock.ExpectationsWereMet())
+}
+
+func TestMySQLStorageFetchRoom(t *testing.T) {
+	s, mock := NewMock()
+	mock.ExpectQuery("SELECT (.+) FROM rooms (.+)").
+		WithArgs("room@conference.jackal.im").
+		WillReturnRows(sqlmock.NewRows(roomColumns).
+			AddRow("room@conference.jackal.im", `{"Name":"Room","Persistent":true}`, "Hi there!", `{"ortuman@jackal.im":"owner"}`))
+
+	room, err := s.FetchRoom("room@conference.jackal.im")
+	require.Nil(t, mock.ExpectationsWereMet())
+	require.Nil(t, err)
+	require.NotNil(t, room)
+	require.Equal(t, "Room", room.Config.Name)
+	require.True(t, room.Config.Persistent)
+	require.Equal(t, mucmodel.AffiliationOwner, room.Affiliation("ortuman@jackal.im"))
+
+	s, mock = NewMock()
+	mock.ExpectQuery("SELECT (.+) FROM rooms (.+)").
+		WithArgs("room@conference.jackal.im").
+		WillReturnRows(sqlmock.NewRows(roomColumns))
+
+	room, err = s.FetchRoom("room@conference.jackal.im")
+	require.Nil(t, mock.ExpectationsWereMet())
+	require.Nil(t, err)
+	require.Nil(t, room)
+
+	s, mock = NewMock()
+	mock.ExpectQuery("SELECT (.+) FROM rooms (.+)").
+		WithArgs("room@conference.jackal.im").
+		WillReturnError(errMySQLStorage)
+
+	_, err = s.FetchRoom("room@conference.jackal.im")
+	require.Nil(t, mock.ExpectationsWereMet())
+	require.Equal(t, errMySQLStorage, err)
+}
+
+func TestMySQLStorageFetchRooms(t *testing.T) {
+	s, mock := NewMock()
+	mock.ExpectQuery("SELECT (.+) FROM rooms (.+)").
+		WithArgs("conference.jackal.im").
+		WillReturnRows(sqlmock.NewRows(roomColumns).
+			AddRow("room1@conference.jackal.im", `{}`, "", `null`).
+			AddRow("room2@conference.jackal.im", `{}`, "", `null`))
+
+	rooms, err := s.FetchRooms("conference.jackal.im")
+	require.Nil(t, mock.ExpectationsWereMet())
+	require.Nil(t, err)
+	require.Equal(t, 2, len(rooms))
+
+	s, mock = NewMock()
+	mock.ExpectQuery("SELECT (.+) FROM rooms (.+)").
+		WithArgs("conference.jackal.im").
+		WillReturnError(errMySQLStorage)
+
+	_, err = s.FetchRooms("conference.jackal.im")
+	require.Nil(t, mock.ExpectationsWereMet())
+	require.Equal(t, errMySQLStorage, err)
+}
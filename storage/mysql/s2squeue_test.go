@@ -0,0 +1,93 @@
+/*
+ * Copyright (c) 2018 Miguel Ángel Ortuño.
+ * See the LICENSE file for more information.
+ */
+
+package mysql
+
+import (
+	"testing"
+	"time"
+
+	sqlmock "github.com/DATA-DOG/go-sqlmock"
+	"github.com/ortuman/jackal/model"
+	"github.com/ortuman/jackal/xmpp"
+	"github.com/ortuman/jackal/xmpp/jid"
+	"github.com/stretchr/testify/require"
+)
+
+var s2sQueueItemColumns = []string{"remote_domain", "id", "data", "enqueued_at"}
+
+func TestMySQLStorageInsertS2SQueueItem(t *testing.T) {
+	from, _ := jid.NewWithString("ortuman@jackal.im/balcony", false)
+	to, _ := jid.NewWithString("romeo@example.net", false)
+	msg := xmpp.NewMessageType("abc", xmpp.ChatType)
+	msg.SetFromJID(from)
+	msg.SetToJID(to)
+
+	now := time.Now()
+	qi := &model.S2SQueueItem{ID: "1234", RemoteDomain: "example.net", Stanza: msg, EnqueuedAt: now}
+
+	s, mock := NewMock()
+	mock.ExpectExec("INSERT INTO s2s_queue_items (.+)").
+		WithArgs("example.net", "1234", msg.String(), now).
+		WillReturnResult(sqlmock.NewResult(1, 1))
+
+	require.Nil(t, s.InsertS2SQueueItem(qi))
+	require.Nil(t, mock.ExpectationsWereMet())
+
+	s, mock = NewMock()
+	mock.ExpectExec("INSERT INTO s2s_queue_items (.+)").
+		WithArgs("example.net", "1234", msg.String(), now).
+		WillReturnError(errMySQLStorage)
+
+	require.Equal(t, errMySQLStorage, s.InsertS2SQueueItem(qi))
+	require.Nil(t, mock.ExpectationsWereMet())
+}
+
+func TestMySQLStorageFetchS2SQueueItems(t *testing.T) {
+	now := time.Now()
+
+	s, mock := NewMock()
+	mock.ExpectQuery("SELECT (.+) FROM s2s_queue_items ORDER BY serial").
+		WillReturnRows(sqlmock.NewRows(s2sQueueItemColumns).
+			AddRow("example.net", "1234", "<message id='a' from='ortuman@jackal.im' to='romeo@example.net'><body>Hi!</body></message>", now).
+			AddRow("jabber.org", "1235", "<presence from='ortuman@jackal.im' to='noelia@jabber.org' type='subscribe'/>", now))
+
+	items, err := s.FetchS2SQueueItems()
+	require.Nil(t, mock.ExpectationsWereMet())
+	require.Nil(t, err)
+	require.Len(t, items, 2)
+	require.Equal(t, "1234", items[0].ID)
+	require.Equal(t, "example.net", items[0].RemoteDomain)
+	_, ok := items[0].Stanza.(*xmpp.Message)
+	require.True(t, ok)
+	_, ok = items[1].Stanza.(*xmpp.Presence)
+	require.True(t, ok)
+
+	s, mock = NewMock()
+	mock.ExpectQuery("SELECT (.+) FROM s2s_queue_items ORDER BY serial").
+		WillReturnError(errMySQLStorage)
+
+	_, err = s.FetchS2SQueueItems()
+	require.Nil(t, mock.ExpectationsWereMet())
+	require.Equal(t, errMySQLStorage, err)
+}
+
+func TestMySQLStorageDeleteS2SQueueItem(t *testing.T) {
+	s, mock := NewMock()
+	mock.ExpectExec("DELETE FROM s2s_queue_items WHERE (.+)").
+		WithArgs("example.net", "1234").
+		WillReturnResult(sqlmock.NewResult(0, 1))
+
+	require.Nil(t, s.DeleteS2SQueueItem("example.net", "1234"))
+	require.Nil(t, mock.ExpectationsWereMet())
+
+	s, mock = NewMock()
+	mock.ExpectExec("DELETE FROM s2s_queue_items WHERE (.+)").
+		WithArgs("example.net", "1234").
+		WillReturnError(errMySQLStorage)
+
+	require.Equal(t, errMySQLStorage, s.DeleteS2SQueueItem("example.net", "1234"))
+	require.Nil(t, mock.ExpectationsWereMet())
+}
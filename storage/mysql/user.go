@@ -7,6 +7,7 @@ package mysql
 
 import (
 	"database/sql"
+	"fmt"
 	"strings"
 	"time"
 
@@ -26,22 +27,33 @@ func (s *Storage) InsertOrUpdateUser(u *model.User) error {
 		presenceXML = buf.String()
 		s.pool.Put(buf)
 	}
-	columns := []string{"username", "password", "updated_at", "created_at"}
-	values := []interface{}{u.Username, u.Password, nowExpr, nowExpr}
+	credentials := userCredentials(u)
 
-	if len(presenceXML) > 0 {
-		columns = append(columns, []string{"last_presence", "last_presence_at"}...)
-		values = append(values, []interface{}{presenceXML, nowExpr}...)
+	columns := []string{"username"}
+	values := []interface{}{u.Username}
+	for _, c := range credentials {
+		columns = append(columns, c.column)
+		values = append(values, c.value)
 	}
-	var suffix string
+	columns = append(columns, []string{"updated_at", "created_at"}...)
+	values = append(values, []interface{}{nowExpr, nowExpr}...)
+
+	var updates []string
 	var suffixArgs []interface{}
+	for _, c := range credentials {
+		updates = append(updates, fmt.Sprintf("%s = ?", c.column))
+		suffixArgs = append(suffixArgs, c.value)
+	}
 	if len(presenceXML) > 0 {
-		suffix = "ON DUPLICATE KEY UPDATE password = ?, last_presence = ?, last_presence_at = NOW(), updated_at = NOW()"
-		suffixArgs = []interface{}{u.Password, presenceXML}
-	} else {
-		suffix = "ON DUPLICATE KEY UPDATE password = ?, updated_at = NOW()"
-		suffixArgs = []interface{}{u.Password}
+		columns = append(columns, []string{"last_presence", "last_presence_at"}...)
+		values = append(values, []interface{}{presenceXML, nowExpr}...)
+
+		updates = append(updates, "last_presence = ?", "last_presence_at = NOW()")
+		suffixArgs = append(suffixArgs, presenceXML)
 	}
+	updates = append(updates, "updated_at = NOW()")
+	suffix := "ON DUPLICATE KEY UPDATE " + strings.Join(updates, ", ")
+
 	q := sq.Insert("users").
 		Columns(columns...).
 		Values(values...).
@@ -52,7 +64,11 @@ func (s *Storage) InsertOrUpdateUser(u *model.User) error {
 
 // FetchUser retrieves from storage a user entity.
 func (s *Storage) FetchUser(username string) (*model.User, error) {
-	q := sq.Select("username", "password", "last_presence", "last_presence_at").
+	q := sq.Select("username", "password", "salt", "iteration_count",
+		"stored_key_sha1", "server_key_sha1",
+		"stored_key_sha256", "server_key_sha256",
+		"stored_key_sha512", "server_key_sha512",
+		"last_presence", "last_presence_at").
 		From("users").
 		Where(sq.Eq{"username": username})
 
@@ -60,7 +76,13 @@ func (s *Storage) FetchUser(username string) (*model.User, error) {
 	var presenceAt time.Time
 	var usr model.User
 
-	err := q.RunWith(s.db).QueryRow().Scan(&usr.Username, &usr.Password, &presenceXML, &presenceAt)
+	err := q.RunWith(s.db).QueryRow().Scan(
+		&usr.Username, &usr.Password, &usr.Salt, &usr.IterationCount,
+		&usr.SHA1.StoredKey, &usr.SHA1.ServerKey,
+		&usr.SHA256.StoredKey, &usr.SHA256.ServerKey,
+		&usr.SHA512.StoredKey, &usr.SHA512.ServerKey,
+		&presenceXML, &presenceAt,
+	)
 	switch err {
 	case nil:
 		if len(presenceXML) > 0 {
@@ -82,6 +104,26 @@ func (s *Storage) FetchUser(username string) (*model.User, error) {
 	}
 }
 
+type userCredential struct {
+	column string
+	value  interface{}
+}
+
+// userCredentials returns user credential columns along with their values.
+func userCredentials(u *model.User) []userCredential {
+	return []userCredential{
+		{"password", u.Password},
+		{"salt", u.Salt},
+		{"iteration_count", u.IterationCount},
+		{"stored_key_sha1", u.SHA1.StoredKey},
+		{"server_key_sha1", u.SHA1.ServerKey},
+		{"stored_key_sha256", u.SHA256.StoredKey},
+		{"server_key_sha256", u.SHA256.ServerKey},
+		{"stored_key_sha512", u.SHA512.StoredKey},
+		{"server_key_sha512", u.SHA512.ServerKey},
+	}
+}
+
 // DeleteUser deletes a user entity from storage.
 func (s *Storage) DeleteUser(username string) error {
 	return s.inTransaction(func(tx *sql.Tx) error {
@@ -126,3 +168,24 @@ func (s *Storage) UserExists(username string) (bool, error) {
 		return false, err
 	}
 }
+
+// FetchUsernames retrieves from storage all registered usernames in ascending order.
+func (s *Storage) FetchUsernames() ([]string, error) {
+	q := sq.Select("username").From("users").OrderBy("username")
+
+	rows, err := q.RunWith(s.db).Query()
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = rows.Close() }()
+
+	var usernames []string
+	for rows.Next() {
+		var username string
+		if err := rows.Scan(&username); err != nil {
+			return nil, err
+		}
+		usernames = append(usernames, username)
+	}
+	return usernames, rows.Err()
+}
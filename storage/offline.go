@@ -1,6 +1,11 @@
 package storage
 
-import "github.com/ortuman/jackal/xmpp"
+import (
+	"time"
+
+	"github.com/ortuman/jackal/metrics"
+	"github.com/ortuman/jackal/xmpp"
+)
 
 // offlineStorage defines storage operations for offline messages
 type offlineStorage interface {
@@ -13,20 +18,24 @@ type offlineStorage interface {
 // InsertOfflineMessage inserts a new message element into
 // user's offline queue.
 func InsertOfflineMessage(message *xmpp.Message, username string) error {
+	defer metrics.ObserveStorageLatency("InsertOfflineMessage", time.Now())
 	return instance().InsertOfflineMessage(message, username)
 }
 
 // CountOfflineMessages returns current length of user's offline queue.
 func CountOfflineMessages(username string) (int, error) {
+	defer metrics.ObserveStorageLatency("CountOfflineMessages", time.Now())
 	return instance().CountOfflineMessages(username)
 }
 
 // FetchOfflineMessages retrieves from storage current user offline queue.
 func FetchOfflineMessages(username string) ([]xmpp.Message, error) {
+	defer metrics.ObserveStorageLatency("FetchOfflineMessages", time.Now())
 	return instance().FetchOfflineMessages(username)
 }
 
 // DeleteOfflineMessages clears a user offline queue.
 func DeleteOfflineMessages(username string) error {
+	defer metrics.ObserveStorageLatency("DeleteOfflineMessages", time.Now())
 	return instance().DeleteOfflineMessages(username)
 }
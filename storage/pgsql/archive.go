@@ -0,0 +1,176 @@
+/*
+ * Copyright (c) 2018 Miguel Ángel Ortuño.
+ * See the LICENSE file for more information.
+ */
+
+package pgsql
+
+import (
+	"database/sql"
+	"encoding/json"
+	"strings"
+
+	sq "github.com/Masterminds/squirrel"
+	"github.com/ortuman/jackal/model"
+	"github.com/ortuman/jackal/xmpp"
+	"github.com/ortuman/jackal/xmpp/jid"
+)
+
+// InsertArchiveMessage inserts a new message into user's archive.
+func (s *Storage) InsertArchiveMessage(message *model.ArchiveMessage) error {
+	q := sq.Insert("archive_messages").
+		Columns("username", "id", "with_jid", "data", "created_at").
+		Values(message.Username, message.ID, message.With, message.Message.String(), message.CreatedAt)
+	_, err := q.RunWith(s.db).Exec()
+	return err
+}
+
+// CountArchiveMessages returns the number of archived messages matching
+// filter's with, start and end constraints.
+func (s *Storage) CountArchiveMessages(username string, filter *model.ArchiveFilter) (int, error) {
+	q := sq.Select("COUNT(*)").
+		From("archive_messages").
+		Where(archiveFilterConditions(username, filter))
+
+	var count int
+	err := q.RunWith(s.db).Scan(&count)
+	switch err {
+	case nil:
+		return count, nil
+	default:
+		return 0, err
+	}
+}
+
+// FetchArchiveMessages retrieves from storage user's archived messages
+// matching a given filter, in chronological order.
+func (s *Storage) FetchArchiveMessages(username string, filter *model.ArchiveFilter) ([]model.ArchiveMessage, error) {
+	conds := archiveFilterConditions(username, filter)
+	if len(filter.AfterID) > 0 {
+		conds = append(conds, sq.Expr("serial > (SELECT serial FROM archive_messages WHERE username = ? AND id = ?)", username, filter.AfterID))
+	}
+	if len(filter.BeforeID) > 0 {
+		conds = append(conds, sq.Expr("serial < (SELECT serial FROM archive_messages WHERE username = ? AND id = ?)", username, filter.BeforeID))
+	}
+	// fetch in reverse order when requesting last page
+	reversed := filter.LastPage || len(filter.BeforeID) > 0
+
+	q := sq.Select("username", "id", "with_jid", "data", "created_at").
+		From("archive_messages").
+		Where(conds)
+	if reversed {
+		q = q.OrderBy("serial DESC")
+	} else {
+		q = q.OrderBy("serial")
+	}
+	if filter.Max > 0 {
+		q = q.Limit(uint64(filter.Max))
+	}
+	rows, err := q.RunWith(s.db).Query()
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = rows.Close() }()
+
+	messages, err := s.scanArchiveMessageEntities(rows)
+	if err != nil {
+		return nil, err
+	}
+	if reversed {
+		for i, j := 0, len(messages)-1; i < j; i, j = i+1, j-1 {
+			messages[i], messages[j] = messages[j], messages[i]
+		}
+	}
+	return messages, nil
+}
+
+// DeleteArchiveMessages clears a user message archive.
+func (s *Storage) DeleteArchiveMessages(username string) error {
+	q := sq.Delete("archive_messages").Where(sq.Eq{"username": username})
+	_, err := q.RunWith(s.db).Exec()
+	return err
+}
+
+// InsertOrUpdateArchivePrefs inserts a new archiving preferences entity
+// into storage, or updates it in case it's been previously inserted.
+func (s *Storage) InsertOrUpdateArchivePrefs(prefs *model.ArchivePrefs) error {
+	alwaysBytes, err := json.Marshal(prefs.Always)
+	if err != nil {
+		return err
+	}
+	neverBytes, err := json.Marshal(prefs.Never)
+	if err != nil {
+		return err
+	}
+	q := sq.Insert("archive_prefs").
+		Columns("username", "default_mode", "always", "never").
+		Values(prefs.Username, prefs.Default, alwaysBytes, neverBytes).
+		Suffix("ON CONFLICT (username) DO UPDATE SET default_mode = $5, always = $6, never = $7", prefs.Default, alwaysBytes, neverBytes)
+	_, err = q.RunWith(s.db).Exec()
+	return err
+}
+
+// FetchArchivePrefs retrieves from storage user's archiving preferences.
+func (s *Storage) FetchArchivePrefs(username string) (*model.ArchivePrefs, error) {
+	q := sq.Select("username", "default_mode", "always", "never").
+		From("archive_prefs").
+		Where(sq.Eq{"username": username})
+
+	var prefs model.ArchivePrefs
+	var alwaysJSON, neverJSON string
+
+	err := q.RunWith(s.db).QueryRow().Scan(&prefs.Username, &prefs.Default, &alwaysJSON, &neverJSON)
+	switch err {
+	case nil:
+		if err := json.NewDecoder(strings.NewReader(alwaysJSON)).Decode(&prefs.Always); err != nil {
+			return nil, err
+		}
+		if err := json.NewDecoder(strings.NewReader(neverJSON)).Decode(&prefs.Never); err != nil {
+			return nil, err
+		}
+		return &prefs, nil
+	case sql.ErrNoRows:
+		return nil, nil
+	default:
+		return nil, err
+	}
+}
+
+func (s *Storage) scanArchiveMessageEntities(scanner rowsScanner) ([]model.ArchiveMessage, error) {
+	var ret []model.ArchiveMessage
+	for scanner.Next() {
+		var am model.ArchiveMessage
+		var data string
+		if err := scanner.Scan(&am.Username, &am.ID, &am.With, &data, &am.CreatedAt); err != nil {
+			return nil, err
+		}
+		parser := xmpp.NewParser(strings.NewReader(data), xmpp.DefaultMode, 0)
+		elem, err := parser.ParseElement()
+		if err != nil {
+			return nil, err
+		}
+		fromJID, _ := jid.NewWithString(elem.From(), true)
+		toJID, _ := jid.NewWithString(elem.To(), true)
+		msg, err := xmpp.NewMessageFromElement(elem, fromJID, toJID)
+		if err != nil {
+			return nil, err
+		}
+		am.Message = msg
+		ret = append(ret, am)
+	}
+	return ret, nil
+}
+
+func archiveFilterConditions(username string, filter *model.ArchiveFilter) sq.And {
+	conds := sq.And{sq.Eq{"username": username}}
+	if len(filter.With) > 0 {
+		conds = append(conds, sq.Eq{"with_jid": filter.With})
+	}
+	if !filter.Start.IsZero() {
+		conds = append(conds, sq.GtOrEq{"created_at": filter.Start})
+	}
+	if !filter.End.IsZero() {
+		conds = append(conds, sq.LtOrEq{"created_at": filter.End})
+	}
+	return conds
+}
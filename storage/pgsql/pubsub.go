@@ -0,0 +1,204 @@
+/*
+ * Copyright (c) 2018 Miguel Ángel Ortuño.
+ * See the LICENSE file for more information.
+ */
+
+package pgsql
+
+import (
+	"database/sql"
+	"encoding/json"
+	"strings"
+
+	sq "github.com/Masterminds/squirrel"
+	"github.com/ortuman/jackal/model/pubsubmodel"
+	"github.com/ortuman/jackal/xmpp"
+)
+
+// InsertOrUpdatePubSubNode inserts a new pubsub node entity into storage,
+// or updates it in case it's been previously inserted.
+func (s *Storage) InsertOrUpdatePubSubNode(node *pubsubmodel.Node) error {
+	optionsBytes, err := json.Marshal(&node.Options)
+	if err != nil {
+		return err
+	}
+	affiliationsBytes, err := json.Marshal(node.Affiliations)
+	if err != nil {
+		return err
+	}
+	subscriptionsBytes, err := json.Marshal(node.Subscriptions)
+	if err != nil {
+		return err
+	}
+	q := sq.Insert("pubsub_nodes").
+		Columns("host", "name", "options", "affiliations", "subscriptions").
+		Values(node.Host, node.Name, optionsBytes, affiliationsBytes, subscriptionsBytes).
+		Suffix("ON CONFLICT (host, name) DO UPDATE SET options = $6, affiliations = $7, subscriptions = $8", optionsBytes, affiliationsBytes, subscriptionsBytes)
+	_, err = q.RunWith(s.db).Exec()
+	return err
+}
+
+// DeletePubSubNode deletes a pubsub node entity and all its published items from storage.
+func (s *Storage) DeletePubSubNode(host, name string) error {
+	return s.inTransaction(func(tx *sql.Tx) error {
+		_, err := sq.Delete("pubsub_items").Where(sq.And{sq.Eq{"host": host}, sq.Eq{"node": name}}).RunWith(tx).Exec()
+		if err != nil {
+			return err
+		}
+		_, err = sq.Delete("pubsub_nodes").Where(sq.And{sq.Eq{"host": host}, sq.Eq{"name": name}}).RunWith(tx).Exec()
+		return err
+	})
+}
+
+// FetchPubSubNode retrieves from storage a pubsub node entity.
+func (s *Storage) FetchPubSubNode(host, name string) (*pubsubmodel.Node, error) {
+	q := sq.Select("host", "name", "options", "affiliations", "subscriptions").
+		From("pubsub_nodes").
+		Where(sq.And{sq.Eq{"host": host}, sq.Eq{"name": name}})
+
+	rows, err := q.RunWith(s.db).Query()
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = rows.Close() }()
+
+	nodes, err := s.scanPubSubNodeEntities(rows)
+	if err != nil {
+		return nil, err
+	}
+	if len(nodes) == 0 {
+		return nil, nil
+	}
+	return &nodes[0], nil
+}
+
+// FetchPubSubNodes retrieves from storage all node entities associated to a given host.
+func (s *Storage) FetchPubSubNodes(host string) ([]pubsubmodel.Node, error) {
+	q := sq.Select("host", "name", "options", "affiliations", "subscriptions").
+		From("pubsub_nodes").
+		Where(sq.Eq{"host": host}).
+		OrderBy("created_at")
+
+	rows, err := q.RunWith(s.db).Query()
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = rows.Close() }()
+
+	return s.scanPubSubNodeEntities(rows)
+}
+
+// InsertOrUpdatePubSubItem inserts a new item into a pubsub node, or updates it
+// in case an item with the same identifier was previously published.
+func (s *Storage) InsertOrUpdatePubSubItem(host, name string, item *pubsubmodel.Item, maxItems int) error {
+	var payload string
+	if item.Payload != nil {
+		payload = item.Payload.String()
+	}
+	return s.inTransaction(func(tx *sql.Tx) error {
+		// republished items are moved to the tail
+		_, err := sq.Delete("pubsub_items").
+			Where(sq.And{sq.Eq{"host": host}, sq.Eq{"node": name}, sq.Eq{"item_id": item.ID}}).
+			RunWith(tx).Exec()
+		if err != nil {
+			return err
+		}
+		_, err = sq.Insert("pubsub_items").
+			Columns("host", "node", "item_id", "publisher", "payload", "created_at").
+			Values(host, name, item.ID, item.Publisher, payload, item.CreatedAt).
+			RunWith(tx).Exec()
+		if err != nil {
+			return err
+		}
+		if maxItems <= 0 {
+			return nil
+		}
+		// discard oldest items
+		var serial int64
+		err = sq.Select("serial").
+			From("pubsub_items").
+			Where(sq.And{sq.Eq{"host": host}, sq.Eq{"node": name}}).
+			OrderBy("serial DESC").
+			Limit(1).
+			Offset(uint64(maxItems)).
+			RunWith(tx).QueryRow().Scan(&serial)
+		switch err {
+		case nil:
+			_, err = sq.Delete("pubsub_items").
+				Where(sq.And{sq.Eq{"host": host}, sq.Eq{"node": name}, sq.LtOrEq{"serial": serial}}).
+				RunWith(tx).Exec()
+			return err
+		case sql.ErrNoRows:
+			return nil
+		default:
+			return err
+		}
+	})
+}
+
+// DeletePubSubItem deletes a published item from a pubsub node.
+func (s *Storage) DeletePubSubItem(host, name, itemID string) error {
+	q := sq.Delete("pubsub_items").
+		Where(sq.And{sq.Eq{"host": host}, sq.Eq{"node": name}, sq.Eq{"item_id": itemID}})
+	_, err := q.RunWith(s.db).Exec()
+	return err
+}
+
+// FetchPubSubItems retrieves from storage all items published to a node, oldest first.
+func (s *Storage) FetchPubSubItems(host, name string) ([]pubsubmodel.Item, error) {
+	q := sq.Select("item_id", "publisher", "payload", "created_at").
+		From("pubsub_items").
+		Where(sq.And{sq.Eq{"host": host}, sq.Eq{"node": name}}).
+		OrderBy("serial")
+
+	rows, err := q.RunWith(s.db).Query()
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = rows.Close() }()
+
+	return s.scanPubSubItemEntities(rows)
+}
+
+func (s *Storage) scanPubSubNodeEntities(scanner rowsScanner) ([]pubsubmodel.Node, error) {
+	var ret []pubsubmodel.Node
+	for scanner.Next() {
+		var node pubsubmodel.Node
+		var optionsJSON, affiliationsJSON, subscriptionsJSON string
+		if err := scanner.Scan(&node.Host, &node.Name, &optionsJSON, &affiliationsJSON, &subscriptionsJSON); err != nil {
+			return nil, err
+		}
+		if err := json.NewDecoder(strings.NewReader(optionsJSON)).Decode(&node.Options); err != nil {
+			return nil, err
+		}
+		if err := json.NewDecoder(strings.NewReader(affiliationsJSON)).Decode(&node.Affiliations); err != nil {
+			return nil, err
+		}
+		if err := json.NewDecoder(strings.NewReader(subscriptionsJSON)).Decode(&node.Subscriptions); err != nil {
+			return nil, err
+		}
+		ret = append(ret, node)
+	}
+	return ret, nil
+}
+
+func (s *Storage) scanPubSubItemEntities(scanner rowsScanner) ([]pubsubmodel.Item, error) {
+	var ret []pubsubmodel.Item
+	for scanner.Next() {
+		var item pubsubmodel.Item
+		var payload string
+		if err := scanner.Scan(&item.ID, &item.Publisher, &payload, &item.CreatedAt); err != nil {
+			return nil, err
+		}
+		if len(payload) > 0 {
+			parser := xmpp.NewParser(strings.NewReader(payload), xmpp.DefaultMode, 0)
+			elem, err := parser.ParseElement()
+			if err != nil {
+				return nil, err
+			}
+			item.Payload = elem
+		}
+		ret = append(ret, item)
+	}
+	return ret, nil
+}
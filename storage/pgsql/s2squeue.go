@@ -0,0 +1,66 @@
+/*
+ * Copyright (c) 2018 Miguel Ángel Ortuño.
+ * See the LICENSE file for more information.
+ */
+
+package pgsql
+
+import (
+	"strings"
+
+	sq "github.com/Masterminds/squirrel"
+	"github.com/ortuman/jackal/model"
+	"github.com/ortuman/jackal/xmpp"
+)
+
+// InsertS2SQueueItem inserts a new stanza into its remote domain
+// outgoing queue.
+func (s *Storage) InsertS2SQueueItem(item *model.S2SQueueItem) error {
+	q := sq.Insert("s2s_queue_items").
+		Columns("remote_domain", "id", "data", "enqueued_at").
+		Values(item.RemoteDomain, item.ID, item.Stanza.String(), item.EnqueuedAt)
+	_, err := q.RunWith(s.db).Exec()
+	return err
+}
+
+// FetchS2SQueueItems retrieves from storage every pending outgoing
+// s2s queue item, in enqueueing order.
+func (s *Storage) FetchS2SQueueItems() ([]model.S2SQueueItem, error) {
+	q := sq.Select("remote_domain", "id", "data", "enqueued_at").
+		From("s2s_queue_items").
+		OrderBy("serial")
+
+	rows, err := q.RunWith(s.db).Query()
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var ret []model.S2SQueueItem
+	for rows.Next() {
+		var item model.S2SQueueItem
+		var data string
+		if err := rows.Scan(&item.RemoteDomain, &item.ID, &data, &item.EnqueuedAt); err != nil {
+			return nil, err
+		}
+		parser := xmpp.NewParser(strings.NewReader(data), xmpp.DefaultMode, 0)
+		elem, err := parser.ParseElement()
+		if err != nil {
+			return nil, err
+		}
+		stanza, err := xmpp.NewStanzaFromElement(elem)
+		if err != nil {
+			return nil, err
+		}
+		item.Stanza = stanza
+		ret = append(ret, item)
+	}
+	return ret, nil
+}
+
+// DeleteS2SQueueItem removes an item from a remote domain outgoing queue.
+func (s *Storage) DeleteS2SQueueItem(remoteDomain, id string) error {
+	q := sq.Delete("s2s_queue_items").Where(sq.And{sq.Eq{"remote_domain": remoteDomain}, sq.Eq{"id": id}})
+	_, err := q.RunWith(s.db).Exec()
+	return err
+}
@@ -7,6 +7,7 @@ package pgsql
 
 import (
 	"database/sql"
+	"fmt"
 	"strings"
 	"time"
 
@@ -28,24 +29,36 @@ func (s *Storage) InsertOrUpdateUser(u *model.User) error {
 		s.pool.Put(buf)
 	}
 
-	q := sq.Insert("users")
+	columns := []string{"username"}
+	values := []interface{}{u.Username}
 
+	var updates []string
+	for _, c := range userCredentials(u) {
+		columns = append(columns, c.column)
+		values = append(values, c.value)
+		updates = append(updates, fmt.Sprintf("%s = $%d", c.column, len(values)))
+	}
 	if len(presenceXML) > 0 {
-		q = q.Columns("username", "password", "last_presence", "last_presence_at").
-			Values(u.Username, u.Password, presenceXML, nowExpr).
-			Suffix("ON CONFLICT (username) DO UPDATE SET password = $2, last_presence = $3, last_presence_at = NOW()")
-	} else {
-		q = q.Columns("username", "password").
-			Values(u.Username, u.Password).
-			Suffix("ON CONFLICT (username) DO UPDATE SET password = $2")
+		columns = append(columns, "last_presence", "last_presence_at")
+		values = append(values, presenceXML, nowExpr)
+		updates = append(updates, fmt.Sprintf("last_presence = $%d", len(values)-1), "last_presence_at = NOW()")
 	}
+	q := sq.Insert("users").
+		Columns(columns...).
+		Values(values...).
+		Suffix("ON CONFLICT (username) DO UPDATE SET " + strings.Join(updates, ", "))
+
 	_, err := q.RunWith(s.db).Exec()
 	return err
 }
 
 // FetchUser retrieves from storage a user entity.
 func (s *Storage) FetchUser(username string) (*model.User, error) {
-	q := sq.Select("username", "password", "last_presence", "last_presence_at").
+	q := sq.Select("username", "password", "salt", "iteration_count",
+		"stored_key_sha1", "server_key_sha1",
+		"stored_key_sha256", "server_key_sha256",
+		"stored_key_sha512", "server_key_sha512",
+		"last_presence", "last_presence_at").
 		From("users").
 		Where(sq.Eq{"username": username})
 
@@ -53,7 +66,13 @@ func (s *Storage) FetchUser(username string) (*model.User, error) {
 	var presenceAt time.Time
 	var usr model.User
 
-	err := q.RunWith(s.db).QueryRow().Scan(&usr.Username, &usr.Password, &presenceXML, &presenceAt)
+	err := q.RunWith(s.db).QueryRow().Scan(
+		&usr.Username, &usr.Password, &usr.Salt, &usr.IterationCount,
+		&usr.SHA1.StoredKey, &usr.SHA1.ServerKey,
+		&usr.SHA256.StoredKey, &usr.SHA256.ServerKey,
+		&usr.SHA512.StoredKey, &usr.SHA512.ServerKey,
+		&presenceXML, &presenceAt,
+	)
 	switch err {
 	case nil:
 		if len(presenceXML) > 0 {
@@ -75,6 +94,26 @@ func (s *Storage) FetchUser(username string) (*model.User, error) {
 	}
 }
 
+type userCredential struct {
+	column string
+	value  interface{}
+}
+
+// userCredentials returns user credential columns along with their values.
+func userCredentials(u *model.User) []userCredential {
+	return []userCredential{
+		{"password", u.Password},
+		{"salt", u.Salt},
+		{"iteration_count", u.IterationCount},
+		{"stored_key_sha1", u.SHA1.StoredKey},
+		{"server_key_sha1", u.SHA1.ServerKey},
+		{"stored_key_sha256", u.SHA256.StoredKey},
+		{"server_key_sha256", u.SHA256.ServerKey},
+		{"stored_key_sha512", u.SHA512.StoredKey},
+		{"server_key_sha512", u.SHA512.ServerKey},
+	}
+}
+
 // DeleteUser deletes a user entity from storage.
 func (s *Storage) DeleteUser(username string) error {
 	return s.inTransaction(func(tx *sql.Tx) error {
@@ -119,3 +158,24 @@ func (s *Storage) UserExists(username string) (bool, error) {
 		return false, err
 	}
 }
+
+// FetchUsernames retrieves from storage all registered usernames in ascending order.
+func (s *Storage) FetchUsernames() ([]string, error) {
+	q := sq.Select("username").From("users").OrderBy("username")
+
+	rows, err := q.RunWith(s.db).Query()
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = rows.Close() }()
+
+	var usernames []string
+	for rows.Next() {
+		var username string
+		if err := rows.Scan(&username); err != nil {
+			return nil, err
+		}
+		usernames = append(usernames, username)
+	}
+	return usernames, rows.Err()
+}
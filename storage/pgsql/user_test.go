@@ -6,11 +6,17 @@
 package pgsql
 
 import (
+	"database/sql/driver"
+	"fmt"
+	"io/ioutil"
+	"regexp"
+	"strings"
 	"testing"
 	"time"
 
 	sqlmock "github.com/DATA-DOG/go-sqlmock"
 	"github.com/ortuman/jackal/model"
+	"github.com/ortuman/jackal/pool"
 	"github.com/ortuman/jackal/xmpp"
 	"github.com/ortuman/jackal/xmpp/jid"
 	"github.com/stretchr/testify/require"
@@ -21,11 +27,19 @@ func TestInsertUser(t *testing.T) {
 	to, _ := jid.NewWithString("ortuman@jackal.im", true)
 	p := xmpp.NewPresence(from, to, xmpp.UnavailableType)
 
-	user := model.User{Username: "ortuman", Password: "1234", LastPresence: p}
+	user := model.User{Username: "ortuman", LastPresence: p}
+	require.Nil(t, user.SetPassword("1234"))
 
+	args := []driver.Value{
+		user.Username, user.Password, user.Salt, user.IterationCount,
+		user.SHA1.StoredKey, user.SHA1.ServerKey,
+		user.SHA256.StoredKey, user.SHA256.ServerKey,
+		user.SHA512.StoredKey, user.SHA512.ServerKey,
+		user.LastPresence.String(),
+	}
 	s, mock := NewMock()
 	mock.ExpectExec("INSERT INTO users (.+) ON CONFLICT (.+) DO UPDATE SET (.+)").
-		WithArgs(user.Username, user.Password, user.LastPresence.String()).
+		WithArgs(args...).
 		WillReturnResult(sqlmock.NewResult(1, 1))
 
 	err := s.InsertOrUpdateUser(&user)
@@ -34,7 +48,7 @@ func TestInsertUser(t *testing.T) {
 
 	s, mock = NewMock()
 	mock.ExpectExec("INSERT INTO users (.+) ON CONFLICT (.+) DO UPDATE SET (.+)").
-		WithArgs(user.Username, user.Password, user.LastPresence.String()).
+		WithArgs(args...).
 		WillReturnError(errGeneric)
 
 	err = s.InsertOrUpdateUser(&user)
@@ -79,7 +93,9 @@ func TestFetchUser(t *testing.T) {
 	to, _ := jid.NewWithString("ortuman@jackal.im", true)
 	p := xmpp.NewPresence(from, to, xmpp.UnavailableType)
 
-	var userColumns = []string{"username", "password", "last_presence", "last_presence_at"}
+	var userColumns = []string{"username", "password", "salt", "iteration_count",
+		"stored_key_sha1", "server_key_sha1", "stored_key_sha256", "server_key_sha256", "stored_key_sha512", "server_key_sha512",
+		"last_presence", "last_presence_at"}
 
 	s, mock := NewMock()
 	mock.ExpectQuery("SELECT (.+) FROM users (.+)").
@@ -93,10 +109,26 @@ func TestFetchUser(t *testing.T) {
 	s, mock = NewMock()
 	mock.ExpectQuery("SELECT (.+) FROM users (.+)").
 		WithArgs("ortuman").
-		WillReturnRows(sqlmock.NewRows(userColumns).AddRow("ortuman", "1234", p.String(), time.Now()))
-	_, err := s.FetchUser("ortuman")
+		WillReturnRows(sqlmock.NewRows(userColumns).AddRow("ortuman", "1234", nil, 0, nil, nil, nil, nil, nil, nil, p.String(), time.Now()))
+	usr, err := s.FetchUser("ortuman")
 	require.Nil(t, mock.ExpectationsWereMet())
 	require.Nil(t, err)
+	require.NotNil(t, usr)
+	require.False(t, usr.HasScramCredentials())
+
+	s, mock = NewMock()
+	mock.ExpectQuery("SELECT (.+) FROM users (.+)").
+		WithArgs("ortuman").
+		WillReturnRows(sqlmock.NewRows(userColumns).AddRow("ortuman", "", []byte{1, 2, 3}, 4096,
+			[]byte{1}, []byte{2}, []byte{3}, []byte{4}, []byte{5}, []byte{6}, "", time.Now()))
+	usr, err = s.FetchUser("ortuman")
+	require.Nil(t, mock.ExpectationsWereMet())
+	require.Nil(t, err)
+	require.NotNil(t, usr)
+	require.Equal(t, []byte{1, 2, 3}, usr.Salt)
+	require.Equal(t, 4096, usr.IterationCount)
+	require.Equal(t, []byte{3}, usr.SHA256.StoredKey)
+	require.Equal(t, []byte{6}, usr.SHA512.ServerKey)
 
 	s, mock = NewMock()
 	mock.ExpectQuery("SELECT (.+) FROM users (.+)").
@@ -127,3 +159,72 @@ func TestUserExists(t *testing.T) {
 	require.Nil(t, mock.ExpectationsWereMet())
 	require.Equal(t, errGeneric, err)
 }
+
+func TestFetchUsernames(t *testing.T) {
+	s, mock := NewMock()
+	mock.ExpectQuery("SELECT username FROM users ORDER BY username").
+		WillReturnRows(sqlmock.NewRows([]string{"username"}).AddRow("noelia").AddRow("ortuman"))
+
+	usernames, err := s.FetchUsernames()
+	require.Nil(t, mock.ExpectationsWereMet())
+	require.Nil(t, err)
+	require.Equal(t, []string{"noelia", "ortuman"}, usernames)
+
+	s, mock = NewMock()
+	mock.ExpectQuery("SELECT username FROM users ORDER BY username").
+		WillReturnError(errGeneric)
+	_, err = s.FetchUsernames()
+	require.Nil(t, mock.ExpectationsWereMet())
+	require.Equal(t, errGeneric, err)
+}
+
+func TestUserSchemaMigration(t *testing.T) {
+	// users table as created before SCRAM credentials were introduced
+	preMigration := []string{"username", "password", "last_presence", "last_presence_at", "updated_at", "created_at"}
+
+	script, err := ioutil.ReadFile("../../sql/postgres.up.psql")
+	require.Nil(t, err)
+	migrated := append([]string{}, preMigration...)
+	for _, m := range regexp.MustCompile(`ADD COLUMN (?:IF NOT EXISTS )?(\w+)`).FindAllStringSubmatch(string(script), -1) {
+		migrated = append(migrated, m[1])
+	}
+	usr := &model.User{Username: "ortuman", Password: "1234"}
+
+	// not migrated... credential columns are missing
+	s, _ := tUtilSchemaMock(t, preMigration)
+	_, err = s.FetchUser("ortuman")
+	require.NotNil(t, err)
+	require.NotNil(t, s.InsertOrUpdateUser(usr))
+
+	s, mock := tUtilSchemaMock(t, migrated)
+	mock.ExpectQuery("users").WithArgs("ortuman").WillReturnRows(sqlmock.NewRows([]string{"username"}))
+	mock.ExpectExec("users").WillReturnResult(sqlmock.NewResult(1, 1))
+	_, _ = s.FetchUser("ortuman")
+	require.Nil(t, s.InsertOrUpdateUser(usr))
+	require.Nil(t, mock.ExpectationsWereMet())
+}
+
+// tUtilSchemaMock returns a mocked storage only accepting users queries whose columns exist in schema.
+func tUtilSchemaMock(t *testing.T, schema []string) (*Storage, sqlmock.Sqlmock) {
+	columns := make(map[string]bool)
+	for _, c := range schema {
+		columns[c] = true
+	}
+	matcher := sqlmock.QueryMatcherFunc(func(_, actualSQL string) error {
+		var list string
+		if m := regexp.MustCompile(`^SELECT (.+) FROM users`).FindStringSubmatch(actualSQL); m != nil {
+			list = m[1]
+		} else if m := regexp.MustCompile(`^INSERT INTO users \(([^)]+)\)`).FindStringSubmatch(actualSQL); m != nil {
+			list = m[1]
+		}
+		for _, c := range strings.Split(list, ",") {
+			if c = strings.TrimSpace(c); !columns[c] {
+				return fmt.Errorf("unknown column '%s' in 'users'", c)
+			}
+		}
+		return nil
+	})
+	db, mock, err := sqlmock.New(sqlmock.QueryMatcherOption(matcher))
+	require.Nil(t, err)
+	return &Storage{db: db, pool: pool.NewBufferPool()}, mock
+}
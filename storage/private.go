@@ -1,6 +1,11 @@
 package storage
 
-import "github.com/ortuman/jackal/xmpp"
+import (
+	"time"
+
+	"github.com/ortuman/jackal/metrics"
+	"github.com/ortuman/jackal/xmpp"
+)
 
 // privateStorage defines operations for private storage
 type privateStorage interface {
@@ -10,11 +15,13 @@ type privateStorage interface {
 
 // FetchPrivateXML retrieves from storage a private element.
 func FetchPrivateXML(namespace string, username string) ([]xmpp.XElement, error) {
+	defer metrics.ObserveStorageLatency("FetchPrivateXML", time.Now())
 	return instance().FetchPrivateXML(namespace, username)
 }
 
 // InsertOrUpdatePrivateXML inserts a new private element into storage,
 // or updates it in case it's been previously inserted.
 func InsertOrUpdatePrivateXML(privateXML []xmpp.XElement, namespace string, username string) error {
+	defer metrics.ObserveStorageLatency("InsertOrUpdatePrivateXML", time.Now())
 	return instance().InsertOrUpdatePrivateXML(privateXML, namespace, username)
 }
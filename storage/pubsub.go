@@ -0,0 +1,65 @@
+package storage
+
+import (
+	"time"
+
+	"github.com/ortuman/jackal/metrics"
+	"github.com/ortuman/jackal/model/pubsubmodel"
+)
+
+// pubSubStorage defines storage operations for publish-subscribe nodes
+type pubSubStorage interface {
+	InsertOrUpdatePubSubNode(node *pubsubmodel.Node) error
+	DeletePubSubNode(host, name string) error
+	FetchPubSubNode(host, name string) (*pubsubmodel.Node, error)
+	FetchPubSubNodes(host string) ([]pubsubmodel.Node, error)
+
+	InsertOrUpdatePubSubItem(host, name string, item *pubsubmodel.Item, maxItems int) error
+	DeletePubSubItem(host, name, itemID string) error
+	FetchPubSubItems(host, name string) ([]pubsubmodel.Item, error)
+}
+
+// InsertOrUpdatePubSubNode inserts a new pubsub node entity into storage,
+// or updates it in case it's been previously inserted.
+func InsertOrUpdatePubSubNode(node *pubsubmodel.Node) error {
+	defer metrics.ObserveStorageLatency("InsertOrUpdatePubSubNode", time.Now())
+	return instance().InsertOrUpdatePubSubNode(node)
+}
+
+// DeletePubSubNode deletes a pubsub node entity and all its published items from storage.
+func DeletePubSubNode(host, name string) error {
+	defer metrics.ObserveStorageLatency("DeletePubSubNode", time.Now())
+	return instance().DeletePubSubNode(host, name)
+}
+
+// FetchPubSubNode retrieves from storage a pubsub node entity.
+func FetchPubSubNode(host, name string) (*pubsubmodel.Node, error) {
+	defer metrics.ObserveStorageLatency("FetchPubSubNode", time.Now())
+	return instance().FetchPubSubNode(host, name)
+}
+
+// FetchPubSubNodes retrieves from storage all node entities associated to a given host.
+func FetchPubSubNodes(host string) ([]pubsubmodel.Node, error) {
+	defer metrics.ObserveStorageLatency("FetchPubSubNodes", time.Now())
+	return instance().FetchPubSubNodes(host)
+}
+
+// InsertOrUpdatePubSubItem inserts a new item into a pubsub node, or updates it
+// in case an item with the same identifier was previously published.
+// Oldest items will be discarded so that no more than maxItems are kept (if greater than zero).
+func InsertOrUpdatePubSubItem(host, name string, item *pubsubmodel.Item, maxItems int) error {
+	defer metrics.ObserveStorageLatency("InsertOrUpdatePubSubItem", time.Now())
+	return instance().InsertOrUpdatePubSubItem(host, name, item, maxItems)
+}
+
+// DeletePubSubItem deletes a published item from a pubsub node.
+func DeletePubSubItem(host, name, itemID string) error {
+	defer metrics.ObserveStorageLatency("DeletePubSubItem", time.Now())
+	return instance().DeletePubSubItem(host, name, itemID)
+}
+
+// FetchPubSubItems retrieves from storage all items published to a node, oldest first.
+func FetchPubSubItems(host, name string) ([]pubsubmodel.Item, error) {
+	defer metrics.ObserveStorageLatency("FetchPubSubItems", time.Now())
+	return instance().FetchPubSubItems(host, name)
+}
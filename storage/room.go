@@ -0,0 +1,42 @@
+package storage
+
+import (
+	"time"
+
+	"github.com/ortuman/jackal/metrics"
+	"github.com/ortuman/jackal/model/mucmodel"
+)
+
+// roomStorage defines storage operations for multi-user chat rooms
+type roomStorage interface {
+	InsertOrUpdateRoom(room *mucmodel.Room) error
+	DeleteRoom(roomJID string) error
+	FetchRoom(roomJID string) (*mucmodel.Room, error)
+	FetchRooms(service string) ([]mucmodel.Room, error)
+}
+
+// InsertOrUpdateRoom inserts a new room entity into storage,
+// or updates it in case it's been previously inserted.
+func InsertOrUpdateRoom(room *mucmodel.Room) error {
+	defer metrics.ObserveStorageLatency("InsertOrUpdateRoom", time.Now())
+	return instance().InsertOrUpdateRoom(room)
+}
+
+// DeleteRoom deletes a room entity from storage.
+func DeleteRoom(roomJID string) error {
+	defer metrics.ObserveStorageLatency("DeleteRoom", time.Now())
+	return instance().DeleteRoom(roomJID)
+}
+
+// FetchRoom retrieves from storage a room entity.
+func FetchRoom(roomJID string) (*mucmodel.Room, error) {
+	defer metrics.ObserveStorageLatency("FetchRoom", time.Now())
+	return instance().FetchRoom(roomJID)
+}
+
+// FetchRooms retrieves from storage all room entities
+// associated to a given multi-user chat service.
+func FetchRooms(service string) ([]mucmodel.Room, error) {
+	defer metrics.ObserveStorageLatency("FetchRooms", time.Now())
+	return instance().FetchRooms(service)
+}
@@ -1,6 +1,11 @@
 package storage
 
-import "github.com/ortuman/jackal/model/rostermodel"
+import (
+	"time"
+
+	"github.com/ortuman/jackal/metrics"
+	"github.com/ortuman/jackal/model/rostermodel"
+)
 
 // rosterStorage defines storage oprations for user's roster
 type rosterStorage interface {
@@ -18,49 +23,58 @@ type rosterStorage interface {
 // InsertOrUpdateRosterItem inserts a new roster item entity into storage,
 // or updates it in case it's been previously inserted.
 func InsertOrUpdateRosterItem(ri *rostermodel.Item) (rostermodel.Version, error) {
+	defer metrics.ObserveStorageLatency("InsertOrUpdateRosterItem", time.Now())
 	return instance().InsertOrUpdateRosterItem(ri)
 }
 
 // DeleteRosterItem deletes a roster item entity from storage.
 func DeleteRosterItem(username, jid string) (rostermodel.Version, error) {
+	defer metrics.ObserveStorageLatency("DeleteRosterItem", time.Now())
 	return instance().DeleteRosterItem(username, jid)
 }
 
 // FetchRosterItems retrieves from storage all roster item entities
 // associated to a given user.
 func FetchRosterItems(username string) ([]rostermodel.Item, rostermodel.Version, error) {
+	defer metrics.ObserveStorageLatency("FetchRosterItems", time.Now())
 	return instance().FetchRosterItems(username)
 }
 
 // FetchRosterItemsInGroups retrieves from storage all roster item entities
 // associated to a given user and a set of groups.
 func FetchRosterItemsInGroups(username string, groups []string) ([]rostermodel.Item, rostermodel.Version, error) {
+	defer metrics.ObserveStorageLatency("FetchRosterItemsInGroups", time.Now())
 	return instance().FetchRosterItemsInGroups(username, groups)
 }
 
 // FetchRosterItem retrieves from storage a roster item entity.
 func FetchRosterItem(username, jid string) (*rostermodel.Item, error) {
+	defer metrics.ObserveStorageLatency("FetchRosterItem", time.Now())
 	return instance().FetchRosterItem(username, jid)
 }
 
 // InsertOrUpdateRosterNotification inserts a new roster notification entity
 // into storage, or updates it in case it's been previously inserted.
 func InsertOrUpdateRosterNotification(rn *rostermodel.Notification) error {
+	defer metrics.ObserveStorageLatency("InsertOrUpdateRosterNotification", time.Now())
 	return instance().InsertOrUpdateRosterNotification(rn)
 }
 
 // DeleteRosterNotification deletes a roster notification entity from storage.
 func DeleteRosterNotification(contact, jid string) error {
+	defer metrics.ObserveStorageLatency("DeleteRosterNotification", time.Now())
 	return instance().DeleteRosterNotification(contact, jid)
 }
 
 // FetchRosterNotification retrieves from storage a roster notification entity.
 func FetchRosterNotification(contact string, jid string) (*rostermodel.Notification, error) {
+	defer metrics.ObserveStorageLatency("FetchRosterNotification", time.Now())
 	return instance().FetchRosterNotification(contact, jid)
 }
 
 // FetchRosterNotifications retrieves from storage all roster notifications
 // associated to a given user.
 func FetchRosterNotifications(contact string) ([]rostermodel.Notification, error) {
+	defer metrics.ObserveStorageLatency("FetchRosterNotifications", time.Now())
 	return instance().FetchRosterNotifications(contact)
 }
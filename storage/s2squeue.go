@@ -0,0 +1,40 @@
+/*
+ * Copyright (c) 2018 Miguel Ángel Ortuño.
+ * See the LICENSE file for more information.
+ */
+
+package storage
+
+import (
+	"time"
+
+	"github.com/ortuman/jackal/metrics"
+	"github.com/ortuman/jackal/model"
+)
+
+// s2sQueueStorage defines storage operations for outgoing s2s queues
+type s2sQueueStorage interface {
+	InsertS2SQueueItem(item *model.S2SQueueItem) error
+	FetchS2SQueueItems() ([]model.S2SQueueItem, error)
+	DeleteS2SQueueItem(remoteDomain, id string) error
+}
+
+// InsertS2SQueueItem inserts a new stanza into its remote domain
+// outgoing queue.
+func InsertS2SQueueItem(item *model.S2SQueueItem) error {
+	defer metrics.ObserveStorageLatency("InsertS2SQueueItem", time.Now())
+	return instance().InsertS2SQueueItem(item)
+}
+
+// FetchS2SQueueItems retrieves from storage every pending outgoing
+// s2s queue item, in enqueueing order.
+func FetchS2SQueueItems() ([]model.S2SQueueItem, error) {
+	defer metrics.ObserveStorageLatency("FetchS2SQueueItems", time.Now())
+	return instance().FetchS2SQueueItems()
+}
+
+// DeleteS2SQueueItem removes an item from a remote domain outgoing queue.
+func DeleteS2SQueueItem(remoteDomain, id string) error {
+	defer metrics.ObserveStorageLatency("DeleteS2SQueueItem", time.Now())
+	return instance().DeleteS2SQueueItem(remoteDomain, id)
+}
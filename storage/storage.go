@@ -27,6 +27,10 @@ type Storage interface {
 	vCardStorage
 	privateStorage
 	blockListStorage
+	archiveStorage
+	roomStorage
+	pubSubStorage
+	s2sQueueStorage
 }
 
 var (
@@ -1,6 +1,11 @@
 package storage
 
-import "github.com/ortuman/jackal/model"
+import (
+	"time"
+
+	"github.com/ortuman/jackal/metrics"
+	"github.com/ortuman/jackal/model"
+)
 
 // userStorage defines storage operations for users
 type userStorage interface {
@@ -8,25 +13,36 @@ type userStorage interface {
 	DeleteUser(username string) error
 	FetchUser(username string) (*model.User, error)
 	UserExists(username string) (bool, error)
+	FetchUsernames() ([]string, error)
 }
 
 // InsertOrUpdateUser inserts a new user entity into storage,
 // or updates it in case it's been previously inserted.
 func InsertOrUpdateUser(user *model.User) error {
+	defer metrics.ObserveStorageLatency("InsertOrUpdateUser", time.Now())
 	return instance().InsertOrUpdateUser(user)
 }
 
 // DeleteUser deletes a user entity from storage.
 func DeleteUser(username string) error {
+	defer metrics.ObserveStorageLatency("DeleteUser", time.Now())
 	return instance().DeleteUser(username)
 }
 
 // FetchUser retrieves from storage a user entity.
 func FetchUser(username string) (*model.User, error) {
+	defer metrics.ObserveStorageLatency("FetchUser", time.Now())
 	return instance().FetchUser(username)
 }
 
 // UserExists returns whether or not a user exists within storage.
 func UserExists(username string) (bool, error) {
+	defer metrics.ObserveStorageLatency("UserExists", time.Now())
 	return instance().UserExists(username)
 }
+
+// FetchUsernames retrieves from storage all registered usernames in ascending order.
+func FetchUsernames() ([]string, error) {
+	defer metrics.ObserveStorageLatency("FetchUsernames", time.Now())
+	return instance().FetchUsernames()
+}
@@ -1,6 +1,11 @@
 package storage
 
-import "github.com/ortuman/jackal/xmpp"
+import (
+	"time"
+
+	"github.com/ortuman/jackal/metrics"
+	"github.com/ortuman/jackal/xmpp"
+)
 
 // vCardStorage defines storage operations for vCards
 type vCardStorage interface {
@@ -11,11 +16,13 @@ type vCardStorage interface {
 // InsertOrUpdateVCard inserts a new vCard element into storage,
 // or updates it in case it's been previously inserted.
 func InsertOrUpdateVCard(vCard xmpp.XElement, username string) error {
+	defer metrics.ObserveStorageLatency("InsertOrUpdateVCard", time.Now())
 	return instance().InsertOrUpdateVCard(vCard, username)
 }
 
 // FetchVCard retrieves from storage a vCard element associated
 // to a given user.
 func FetchVCard(username string) (xmpp.XElement, error) {
+	defer metrics.ObserveStorageLatency("FetchVCard", time.Now())
 	return instance().FetchVCard(username)
 }
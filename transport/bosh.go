@@ -0,0 +1,540 @@
+/*
+ * Copyright (c) 2018 Miguel Ángel Ortuño.
+ * See the LICENSE file for more information.
+ */
+
+package transport
+
+import (
+	"bytes"
+	"crypto/tls"
+	"crypto/x509"
+	"io"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/ortuman/jackal/log"
+	"github.com/ortuman/jackal/transport/compress"
+	"github.com/ortuman/jackal/xmpp"
+	"github.com/pborman/uuid"
+)
+
+const (
+	boshNamespace         = "http://jabber.org/protocol/httpbind"
+	xboshNamespace        = "urn:xmpp:xbosh"
+	framedStreamNamespace = "urn:ietf:params:xml:ns:xmpp-framing"
+	streamNamespace       = "http://etherx.jabber.org/streams"
+	jabberClientNamespace = "jabber:client"
+	boshVersion           = "1.11"
+)
+
+const (
+	defaultBOSHMaxWait        = time.Duration(60) * time.Second
+	defaultBOSHMaxHold        = 1
+	defaultBOSHInactivity     = time.Duration(60) * time.Second
+	defaultBOSHMaxRequestSize = 65536
+)
+
+// BOSH terminal binding conditions (XEP-0124 section 17.2)
+const (
+	boshBadRequest        = "bad-request"
+	boshItemNotFound      = "item-not-found"
+	boshRemoteStreamError = "remote-stream-error"
+	boshSystemShutdown    = "system-shutdown"
+)
+
+// BOSHConfig represents a BOSH session manager configuration.
+type BOSHConfig struct {
+	// MaxWait is the longest time the manager holds a request
+	// before responding to it.
+	MaxWait time.Duration
+
+	// MaxHold is the maximum number of requests the manager holds
+	// simultaneously for a single session.
+	MaxHold int
+
+	// Inactivity is the longest time a session can stay without
+	// pending requests before being terminated.
+	Inactivity time.Duration
+
+	// MaxRequestSize is the maximum size of an incoming request body.
+	MaxRequestSize int
+}
+
+// BOSHManager maps BOSH (XEP-0124/XEP-0206) HTTP long-polling sessions
+// onto stream transports.
+type BOSHManager struct {
+	cfg       BOSHConfig
+	onSession func(tr Transport)
+	mu        sync.RWMutex
+	sessions  map[string]*boshTransport
+	closed    bool
+}
+
+// NewBOSHManager returns a BOSH session manager invoking onSession
+// every time a new session has been created.
+func NewBOSHManager(cfg *BOSHConfig, onSession func(tr Transport)) *BOSHManager {
+	m := &BOSHManager{
+		cfg:       *cfg,
+		onSession: onSession,
+		sessions:  make(map[string]*boshTransport),
+	}
+	if m.cfg.MaxWait == 0 {
+		m.cfg.MaxWait = defaultBOSHMaxWait
+	}
+	if m.cfg.MaxHold == 0 {
+		m.cfg.MaxHold = defaultBOSHMaxHold
+	}
+	if m.cfg.Inactivity == 0 {
+		m.cfg.Inactivity = defaultBOSHInactivity
+	}
+	if m.cfg.MaxRequestSize == 0 {
+		m.cfg.MaxRequestSize = defaultBOSHMaxRequestSize
+	}
+	return m
+}
+
+// ServeHTTP satisfies http.Handler interface.
+func (m *BOSHManager) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Access-Control-Allow-Origin", "*")
+	w.Header().Set("Access-Control-Allow-Headers", "Content-Type")
+	switch r.Method {
+	case http.MethodOptions:
+		w.Header().Set("Access-Control-Allow-Methods", "POST, OPTIONS")
+		w.WriteHeader(http.StatusOK)
+		return
+	case http.MethodPost:
+		break
+	default:
+		w.Header().Set("Allow", "POST, OPTIONS")
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+	maxSize := m.cfg.MaxRequestSize
+	elem, err := xmpp.NewParser(io.LimitReader(r.Body, int64(maxSize)+1), xmpp.DefaultMode, maxSize).ParseElement()
+	if err != nil || elem == nil || elem.Name() != "body" || elem.Namespace() != boshNamespace {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	rid, err := strconv.ParseInt(elem.Attributes().Get("rid"), 10, 64)
+	if err != nil || rid < 0 {
+		writeBOSHResponse(w, terminateBody(boshBadRequest))
+		return
+	}
+	var tr *boshTransport
+	if sid := elem.Attributes().Get("sid"); len(sid) > 0 {
+		m.mu.RLock()
+		tr = m.sessions[sid]
+		m.mu.RUnlock()
+		if tr == nil {
+			writeBOSHResponse(w, terminateBody(boshItemNotFound))
+			return
+		}
+	} else {
+		tr = m.createSession(elem, rid)
+		if tr == nil {
+			writeBOSHResponse(w, terminateBody(boshSystemShutdown))
+			return
+		}
+	}
+	select {
+	case resp := <-tr.handleRequest(elem, rid):
+		writeBOSHResponse(w, resp)
+	case <-r.Context().Done():
+		tr.cancelRequest(rid)
+	}
+}
+
+func (m *BOSHManager) createSession(body xmpp.XElement, rid int64) *boshTransport {
+	wait := m.cfg.MaxWait
+	if s, err := strconv.Atoi(body.Attributes().Get("wait")); err == nil && s >= 0 {
+		if reqWait := time.Duration(s) * time.Second; reqWait < wait {
+			wait = reqWait
+		}
+	}
+	hold := m.cfg.MaxHold
+	if h, err := strconv.Atoi(body.Attributes().Get("hold")); err == nil && h >= 0 && h < hold {
+		hold = h
+	}
+	tr := &boshTransport{
+		mgr:        m,
+		sid:        uuid.New(),
+		domain:     body.To(),
+		wait:       wait,
+		hold:       hold,
+		inactivity: m.cfg.Inactivity,
+		nextRID:    rid,
+		creating:   true,
+		needsOpen:  true,
+		responses:  make(map[int64]*xmpp.Element),
+		pending:    make(map[int64]xmpp.XElement),
+		readCh:     make(chan struct{}, 1),
+		doneCh:     make(chan struct{}),
+	}
+	m.mu.Lock()
+	if m.closed {
+		m.mu.Unlock()
+		return nil
+	}
+	m.sessions[tr.sid] = tr
+	m.mu.Unlock()
+
+	log.Infof("created bosh session... (sid: %s)", tr.sid)
+
+	m.onSession(tr)
+	return tr
+}
+
+// Close stops accepting new sessions, while already created ones keep being served.
+func (m *BOSHManager) Close() {
+	m.mu.Lock()
+	m.closed = true
+	m.mu.Unlock()
+}
+
+func (m *BOSHManager) unregisterSession(sid string) {
+	m.mu.Lock()
+	delete(m.sessions, sid)
+	m.mu.Unlock()
+
+	log.Infof("terminated bosh session... (sid: %s)", sid)
+}
+
+type boshRequest struct {
+	rid    int64
+	respCh chan *xmpp.Element
+	waitTm *time.Timer
+}
+
+type boshTransport struct {
+	mgr        *BOSHManager
+	sid        string
+	domain     string
+	wait       time.Duration
+	hold       int
+	inactivity time.Duration
+
+	mu           sync.Mutex
+	nextRID      int64
+	creating     bool
+	needsOpen    bool
+	terminated   bool
+	held         []*boshRequest
+	pending      map[int64]xmpp.XElement
+	responses    map[int64]*xmpp.Element
+	outgoing     []xmpp.XElement
+	inactivityTm *time.Timer
+
+	readBuf  bytes.Buffer
+	readCh   chan struct{}
+	writeBuf bytes.Buffer
+	doneCh   chan struct{}
+}
+
+func (t *boshTransport) Read(p []byte) (n int, err error) {
+	for {
+		t.mu.Lock()
+		if t.readBuf.Len() > 0 {
+			n, err = t.readBuf.Read(p)
+			t.mu.Unlock()
+			return n, err
+		}
+		t.mu.Unlock()
+
+		select {
+		case <-t.readCh:
+			continue
+		case <-t.doneCh:
+			return 0, io.EOF
+		}
+	}
+}
+
+func (t *boshTransport) Write(p []byte) (n int, err error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.writeBuf.Write(p)
+}
+
+func (t *boshTransport) Close() error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.isClosed() {
+		return nil
+	}
+	close(t.doneCh)
+	t.terminate("")
+	if t.inactivityTm != nil {
+		t.inactivityTm.Stop()
+	}
+	t.mgr.unregisterSession(t.sid)
+	return nil
+}
+
+func (t *boshTransport) Type() Type {
+	return BOSH
+}
+
+func (t *boshTransport) WriteString(s string) (n int, err error) {
+	return t.Write([]byte(s))
+}
+
+// Flush delivers all written elements to the oldest held request.
+func (t *boshTransport) Flush() error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	pr := xmpp.NewParser(bytes.NewReader(append([]byte(nil), t.writeBuf.Bytes()...)), xmpp.WebSocketStream, 0)
+	t.writeBuf.Reset()
+
+	var closed, streamErr bool
+	for {
+		elem, err := pr.ParseElement()
+		if err == xmpp.ErrStreamClosedByPeer {
+			closed = true
+			break
+		} else if err != nil {
+			break
+		}
+		if elem == nil || (elem.Name() == "open" && elem.Namespace() == framedStreamNamespace) {
+			continue
+		}
+		if elem.Name() == "stream:error" {
+			streamErr = true
+		}
+		if e, ok := elem.(*xmpp.Element); ok && elem.IsStanza() && len(elem.Namespace()) == 0 {
+			e.SetNamespace(jabberClientNamespace)
+		}
+		t.outgoing = append(t.outgoing, elem)
+	}
+	if closed {
+		var condition string
+		if streamErr {
+			condition = boshRemoteStreamError
+		}
+		t.terminate(condition)
+		return nil
+	}
+	if len(t.outgoing) > 0 && len(t.held) > 0 {
+		t.respond(t.held[0], false, "")
+	}
+	return nil
+}
+
+func (t *boshTransport) StartTLS(_ *tls.Config, _ bool) {
+}
+
+func (t *boshTransport) EnableCompression(_ compress.Level) {
+}
+
+func (t *boshTransport) ChannelBindingBytes(_ ChannelBindingMechanism) []byte {
+	// requests may be carried over different connections
+	return nil
+}
+
+func (t *boshTransport) PeerCertificates() []*x509.Certificate {
+	return nil
+}
+
+func (t *boshTransport) handleRequest(body xmpp.XElement, rid int64) <-chan *xmpp.Element {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	req := &boshRequest{rid: rid, respCh: make(chan *xmpp.Element, 1)}
+	switch {
+	case t.terminated:
+		req.respCh <- terminateBody(boshItemNotFound)
+		return req.respCh
+
+	case rid < t.nextRID:
+		// retransmission of an already answered request
+		if resp := t.responses[rid]; resp != nil {
+			req.respCh <- resp
+		} else {
+			req.respCh <- terminateBody(boshItemNotFound)
+		}
+		return req.respCh
+
+	case rid > t.nextRID+int64(t.hold):
+		t.terminate(boshItemNotFound)
+		req.respCh <- terminateBody(boshItemNotFound)
+		return req.respCh
+	}
+	if t.inactivityTm != nil {
+		t.inactivityTm.Stop()
+		t.inactivityTm = nil
+	}
+	t.held = append(t.held, req)
+	req.waitTm = time.AfterFunc(t.wait, func() { t.expireRequest(req) })
+
+	// process requests in order
+	t.pending[rid] = body
+	for {
+		body, ok := t.pending[t.nextRID]
+		if !ok {
+			break
+		}
+		delete(t.pending, t.nextRID)
+		t.nextRID++
+		t.processBody(body)
+	}
+	if t.terminated {
+		return req.respCh
+	}
+	if len(t.outgoing) > 0 {
+		t.respond(t.held[0], false, "")
+	}
+	// keep at most 'hold' requests waiting
+	for len(t.held) > t.hold && !t.creating {
+		t.respond(t.held[0], false, "")
+	}
+	return req.respCh
+}
+
+func (t *boshTransport) processBody(body xmpp.XElement) {
+	// open a new stream on session creation and whenever the client restarts it
+	if t.needsOpen || body.Attributes().Get("xmpp:restart") == "true" {
+		t.needsOpen = false
+		t.openStream()
+	}
+	for _, elem := range body.Elements().All() {
+		t.writeInput(elem.String())
+	}
+	if body.Type() == "terminate" {
+		t.writeInput(`<close xmlns="` + framedStreamNamespace + `"/>`)
+	}
+}
+
+func (t *boshTransport) openStream() {
+	open := xmpp.NewElementNamespace("open", framedStreamNamespace)
+	open.SetAttribute("to", t.domain)
+	open.SetAttribute("version", "1.0")
+	t.writeInput(open.String())
+}
+
+func (t *boshTransport) writeInput(s string) {
+	t.readBuf.WriteString(s)
+	select {
+	case t.readCh <- struct{}{}:
+	default:
+	}
+}
+
+func (t *boshTransport) expireRequest(req *boshRequest) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	for _, held := range t.held {
+		if held == req {
+			t.respond(req, false, "")
+			return
+		}
+	}
+}
+
+func (t *boshTransport) cancelRequest(rid int64) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	for i, req := range t.held {
+		if req.rid == rid {
+			req.waitTm.Stop()
+			t.held = append(t.held[:i], t.held[i+1:]...)
+			t.scheduleInactivity()
+			return
+		}
+	}
+}
+
+// respond answers a held request including all outgoing elements.
+func (t *boshTransport) respond(req *boshRequest, terminate bool, condition string) {
+	for i, held := range t.held {
+		if held == req {
+			t.held = append(t.held[:i], t.held[i+1:]...)
+			break
+		}
+	}
+	if req.waitTm != nil {
+		req.waitTm.Stop()
+	}
+	var body *xmpp.Element
+	if terminate {
+		body = terminateBody(condition)
+	} else {
+		body = xmpp.NewElementNamespace("body", boshNamespace)
+	}
+	if t.creating {
+		t.creating = false
+		body.SetAttribute("sid", t.sid)
+		body.SetAttribute("wait", strconv.Itoa(int(t.wait/time.Second)))
+		body.SetAttribute("hold", strconv.Itoa(t.hold))
+		body.SetAttribute("requests", strconv.Itoa(t.hold+1))
+		body.SetAttribute("inactivity", strconv.Itoa(int(t.inactivity/time.Second)))
+		body.SetAttribute("ver", boshVersion)
+		body.SetAttribute("from", t.domain)
+		body.SetAttribute("xmpp:version", "1.0")
+		body.SetAttribute("xmlns:xmpp", xboshNamespace)
+	}
+	if len(t.outgoing) > 0 {
+		body.SetAttribute("xmlns:stream", streamNamespace)
+		body.AppendElements(t.outgoing)
+		t.outgoing = nil
+	}
+	// keep last responses to honor retransmissions
+	t.responses[req.rid] = body
+	delete(t.responses, req.rid-int64(t.hold)-1)
+
+	req.respCh <- body
+	t.scheduleInactivity()
+}
+
+func (t *boshTransport) terminate(condition string) {
+	if t.terminated {
+		return
+	}
+	t.terminated = true
+	if len(t.held) == 0 {
+		t.outgoing = nil
+	}
+	for len(t.held) > 0 {
+		t.respond(t.held[0], true, condition)
+	}
+	if !t.isClosed() {
+		// notify stream reader
+		t.writeInput(`<close xmlns="` + framedStreamNamespace + `"/>`)
+	}
+}
+
+func (t *boshTransport) scheduleInactivity() {
+	if len(t.held) > 0 || t.terminated || t.inactivityTm != nil {
+		return
+	}
+	t.inactivityTm = time.AfterFunc(t.inactivity, func() {
+		log.Infof("bosh session inactivity timeout... (sid: %s)", t.sid)
+		_ = t.Close()
+	})
+}
+
+func (t *boshTransport) isClosed() bool {
+	select {
+	case <-t.doneCh:
+		return true
+	default:
+		return false
+	}
+}
+
+func terminateBody(condition string) *xmpp.Element {
+	body := xmpp.NewElementNamespace("body", boshNamespace)
+	body.SetAttribute("type", "terminate")
+	if len(condition) > 0 {
+		body.SetAttribute("condition", condition)
+	}
+	return body
+}
+
+func writeBOSHResponse(w http.ResponseWriter, body *xmpp.Element) {
+	w.Header().Set("Content-Type", "text/xml; charset=utf-8")
+	w.WriteHeader(http.StatusOK)
+	_, _ = io.WriteString(w, body.String())
+}
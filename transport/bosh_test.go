@@ -0,0 +1,234 @@
+/*
+ * Copyright (c) 2018 Miguel Ángel Ortuño.
+ * See the LICENSE file for more information.
+ */
+
+package transport
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ortuman/jackal/xmpp"
+	"github.com/stretchr/testify/require"
+)
+
+func TestBOSHManager_BadRequests(t *testing.T) {
+	mgr := NewBOSHManager(&BOSHConfig{}, func(tr Transport) {})
+
+	rec := httptest.NewRecorder()
+	mgr.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/http-bind", nil))
+	require.Equal(t, http.StatusMethodNotAllowed, rec.Code)
+
+	rec = httptest.NewRecorder()
+	mgr.ServeHTTP(rec, httptest.NewRequest(http.MethodOptions, "/http-bind", nil))
+	require.Equal(t, http.StatusOK, rec.Code)
+	require.Equal(t, "*", rec.Header().Get("Access-Control-Allow-Origin"))
+
+	rec = httptest.NewRecorder()
+	mgr.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/http-bind", strings.NewReader(`<foo/>`)))
+	require.Equal(t, http.StatusBadRequest, rec.Code)
+
+	resp := doBOSHRequest(t, mgr, `<body xmlns="http://jabber.org/protocol/httpbind" rid="foo"/>`)
+	require.Equal(t, "terminate", resp.Type())
+	require.Equal(t, boshBadRequest, resp.Attributes().Get("condition"))
+
+	resp = doBOSHRequest(t, mgr, `<body xmlns="http://jabber.org/protocol/httpbind" rid="1" sid="unknown"/>`)
+	require.Equal(t, "terminate", resp.Type())
+	require.Equal(t, boshItemNotFound, resp.Attributes().Get("condition"))
+}
+
+func TestBOSHManager_CreateSession(t *testing.T) {
+	trCh := make(chan Transport, 1)
+	mgr := NewBOSHManager(&BOSHConfig{MaxWait: time.Second * 30, MaxHold: 2}, func(tr Transport) { trCh <- tr })
+
+	respCh := doAsyncBOSHRequest(t, mgr, `<body xmlns="http://jabber.org/protocol/httpbind" rid="100" to="jackal.im" wait="60" hold="1" xmpp:version="1.0" xmlns:xmpp="urn:xmpp:xbosh"/>`)
+
+	tr := <-trCh
+	require.Equal(t, BOSH, tr.Type())
+
+	// the stream gets opened on behalf of the client
+	pr := xmpp.NewParser(tr, xmpp.WebSocketStream, 0)
+	open, err := pr.ParseElement()
+	require.Nil(t, err)
+	require.Equal(t, "open", open.Name())
+	require.Equal(t, framedStreamNamespace, open.Namespace())
+	require.Equal(t, "jackal.im", open.To())
+
+	// server opening element is not delivered to the client
+	io.WriteString(tr, `<open xmlns="urn:ietf:params:xml:ns:xmpp-framing" from="jackal.im" version="1.0"/>`)
+	io.WriteString(tr, `<stream:features xmlns:stream="http://etherx.jabber.org/streams"><mechanisms xmlns="urn:ietf:params:xml:ns:xmpp-sasl"/></stream:features>`)
+	tr.Flush()
+
+	resp := <-respCh
+	require.NotEmpty(t, resp.Attributes().Get("sid"))
+	require.Equal(t, "30", resp.Attributes().Get("wait"))
+	require.Equal(t, "1", resp.Attributes().Get("hold"))
+	require.Equal(t, "2", resp.Attributes().Get("requests"))
+	require.Equal(t, "jackal.im", resp.Attributes().Get("from"))
+	require.Equal(t, "1.0", resp.Attributes().Get("xmpp:version"))
+	require.Len(t, resp.Elements().All(), 1)
+	require.Equal(t, "stream:features", resp.Elements().All()[0].Name())
+}
+
+func TestBOSHManager_RequestIDs(t *testing.T) {
+	mgr, tr, pr, sid := setupBOSHSession(t, &BOSHConfig{MaxWait: time.Second * 30, MaxHold: 1})
+
+	// payload gets delivered to the stream
+	respCh := doAsyncBOSHRequest(t, mgr, `<body xmlns="http://jabber.org/protocol/httpbind" rid="101" sid="`+sid+`"><message xmlns="jabber:client" to="noelia@jackal.im"><body>hi!</body></message></body>`)
+
+	elem, err := pr.ParseElement()
+	require.Nil(t, err)
+	require.Equal(t, "message", elem.Name())
+
+	// stanzas are qualified by the client namespace
+	io.WriteString(tr, `<message from="noelia@jackal.im/garden"><body>hello</body></message>`)
+	tr.Flush()
+
+	resp := <-respCh
+	require.Len(t, resp.Elements().All(), 1)
+	require.Equal(t, "jabber:client", resp.Elements().All()[0].Namespace())
+
+	// retransmission
+	resp = doBOSHRequest(t, mgr, `<body xmlns="http://jabber.org/protocol/httpbind" rid="101" sid="`+sid+`"/>`)
+	require.Len(t, resp.Elements().All(), 1)
+
+	// out of order requests are processed in sequence
+	respCh2 := doAsyncBOSHRequest(t, mgr, `<body xmlns="http://jabber.org/protocol/httpbind" rid="103" sid="`+sid+`"><presence xmlns="jabber:client" id="2"/></body>`)
+	time.Sleep(time.Millisecond * 50)
+	respCh1 := doAsyncBOSHRequest(t, mgr, `<body xmlns="http://jabber.org/protocol/httpbind" rid="102" sid="`+sid+`"><presence xmlns="jabber:client" id="1"/></body>`)
+
+	elem, _ = pr.ParseElement()
+	require.Equal(t, "1", elem.ID())
+	elem, _ = pr.ParseElement()
+	require.Equal(t, "2", elem.ID())
+
+	// hold limit exceeded... oldest request gets answered
+	resp = <-respCh2
+	require.Len(t, resp.Elements().All(), 0)
+
+	// out of window request terminates the session
+	resp = doBOSHRequest(t, mgr, `<body xmlns="http://jabber.org/protocol/httpbind" rid="110" sid="`+sid+`"/>`)
+	require.Equal(t, "terminate", resp.Type())
+	require.Equal(t, boshItemNotFound, resp.Attributes().Get("condition"))
+
+	resp = <-respCh1
+	require.Equal(t, "terminate", resp.Type())
+}
+
+func TestBOSHManager_WaitAndInactivity(t *testing.T) {
+	mgr, tr, pr, sid := setupBOSHSession(t, &BOSHConfig{MaxWait: time.Millisecond * 100, MaxHold: 1, Inactivity: time.Millisecond * 200})
+
+	// empty response after 'wait' period
+	start := time.Now()
+	resp := doBOSHRequest(t, mgr, `<body xmlns="http://jabber.org/protocol/httpbind" rid="101" sid="`+sid+`"/>`)
+	require.Len(t, resp.Elements().All(), 0)
+	require.True(t, time.Since(start) >= time.Millisecond*100)
+
+	// session gets terminated after inactivity period
+	_, err := pr.ParseElement()
+	require.Equal(t, io.EOF, err)
+	require.Nil(t, tr.Close())
+
+	resp = doBOSHRequest(t, mgr, `<body xmlns="http://jabber.org/protocol/httpbind" rid="102" sid="`+sid+`"/>`)
+	require.Equal(t, "terminate", resp.Type())
+	require.Equal(t, boshItemNotFound, resp.Attributes().Get("condition"))
+}
+
+func TestBOSHManager_RestartAndTerminate(t *testing.T) {
+	mgr, tr, pr, sid := setupBOSHSession(t, &BOSHConfig{MaxWait: time.Second * 30, MaxHold: 1})
+
+	respCh := doAsyncBOSHRequest(t, mgr, `<body xmlns="http://jabber.org/protocol/httpbind" rid="101" sid="`+sid+`" to="jackal.im" xmpp:restart="true" xmlns:xmpp="urn:xmpp:xbosh"/>`)
+
+	// a new parser is used every time the stream restarts
+	pr = xmpp.NewParser(tr, xmpp.WebSocketStream, 0)
+	elem, err := pr.ParseElement()
+	require.Nil(t, err)
+	require.Equal(t, "open", elem.Name())
+
+	io.WriteString(tr, `<open xmlns="urn:ietf:params:xml:ns:xmpp-framing" from="jackal.im" version="1.0"/><stream:features xmlns:stream="http://etherx.jabber.org/streams"/>`)
+	tr.Flush()
+
+	resp := <-respCh
+	require.Len(t, resp.Elements().All(), 1)
+	require.Empty(t, resp.Attributes().Get("sid"))
+
+	respCh = doAsyncBOSHRequest(t, mgr, `<body xmlns="http://jabber.org/protocol/httpbind" rid="102" sid="`+sid+`" type="terminate"><presence xmlns="jabber:client" type="unavailable"/></body>`)
+
+	elem, _ = pr.ParseElement()
+	require.Equal(t, "presence", elem.Name())
+	_, err = pr.ParseElement()
+	require.Equal(t, xmpp.ErrStreamClosedByPeer, err)
+
+	io.WriteString(tr, `<close xmlns="urn:ietf:params:xml:ns:xmpp-framing"/>`)
+	tr.Flush()
+	tr.Close()
+
+	resp = <-respCh
+	require.Equal(t, "terminate", resp.Type())
+}
+
+func TestBOSHManager_Close(t *testing.T) {
+	mgr, tr, pr, sid := setupBOSHSession(t, &BOSHConfig{MaxWait: time.Second * 30, MaxHold: 1})
+	mgr.Close()
+
+	// no more sessions are created...
+	resp := doBOSHRequest(t, mgr, `<body xmlns="http://jabber.org/protocol/httpbind" rid="200" to="jackal.im" wait="60" hold="1"/>`)
+	require.Equal(t, "terminate", resp.Type())
+	require.Equal(t, boshSystemShutdown, resp.Attributes().Get("condition"))
+
+	// ...but existing ones are still served until closed
+	respCh := doAsyncBOSHRequest(t, mgr, `<body xmlns="http://jabber.org/protocol/httpbind" rid="101" sid="`+sid+`"><presence xmlns="jabber:client" id="1"/></body>`)
+
+	elem, err := pr.ParseElement()
+	require.Nil(t, err)
+	require.Equal(t, "1", elem.ID())
+
+	io.WriteString(tr, `<close xmlns="urn:ietf:params:xml:ns:xmpp-framing"/>`)
+	tr.Flush()
+	tr.Close()
+
+	resp = <-respCh
+	require.Equal(t, "terminate", resp.Type())
+}
+
+func setupBOSHSession(t *testing.T, cfg *BOSHConfig) (*BOSHManager, Transport, *xmpp.Parser, string) {
+	trCh := make(chan Transport, 1)
+	mgr := NewBOSHManager(cfg, func(tr Transport) { trCh <- tr })
+
+	respCh := doAsyncBOSHRequest(t, mgr, `<body xmlns="http://jabber.org/protocol/httpbind" rid="100" to="jackal.im" wait="60" hold="1"/>`)
+	tr := <-trCh
+
+	pr := xmpp.NewParser(tr, xmpp.WebSocketStream, 0)
+	_, err := pr.ParseElement()
+	require.Nil(t, err)
+
+	io.WriteString(tr, `<open xmlns="urn:ietf:params:xml:ns:xmpp-framing" from="jackal.im" version="1.0"/><stream:features xmlns:stream="http://etherx.jabber.org/streams"/>`)
+	tr.Flush()
+
+	resp := <-respCh
+	return mgr, tr, pr, resp.Attributes().Get("sid")
+}
+
+func doAsyncBOSHRequest(t *testing.T, mgr *BOSHManager, body string) <-chan xmpp.XElement {
+	respCh := make(chan xmpp.XElement, 1)
+	go func() { respCh <- doBOSHRequest(t, mgr, body) }()
+	return respCh
+}
+
+func doBOSHRequest(t *testing.T, mgr *BOSHManager, body string) xmpp.XElement {
+	rec := httptest.NewRecorder()
+	mgr.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/http-bind", strings.NewReader(body)))
+	require.Equal(t, http.StatusOK, rec.Code)
+	require.Equal(t, "text/xml; charset=utf-8", rec.Header().Get("Content-Type"))
+
+	resp, err := xmpp.NewParser(rec.Body, xmpp.DefaultMode, 0).ParseElement()
+	require.Nil(t, err)
+	require.Equal(t, "body", resp.Name())
+	require.Equal(t, boshNamespace, resp.Namespace())
+	return resp
+}
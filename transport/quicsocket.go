@@ -8,6 +8,7 @@ package transport
 import (
 	"bufio"
 	"crypto/tls"
+	"crypto/x509"
 	"time"
 
 	"github.com/lucas-clemente/quic-go"
@@ -15,7 +16,8 @@ import (
 
 type quicSocketTransport struct {
 	socketTransport
-	conn quic.Session
+	sess   quic.Session
+	stream quic.Stream
 }
 
 // NewQUICSocketTransport create and return a new quicSocketTransport.
@@ -28,15 +30,45 @@ func NewQUICSocketTransport(conn quic.Session, uniStream quic.Stream,
 			bw:        bufio.NewWriterSize(uniStream, socketBuffSize),
 			keepAlive: keepAlive,
 		},
-		conn: conn,
+		sess:   conn,
+		stream: uniStream,
 	}
 	return s
 }
 
 func (s *quicSocketTransport) Read(p []byte) (n int, err error) {
-	n, err = s.br.Read(p)
-	return n, err
+	if s.keepAlive > 0 {
+		s.stream.SetReadDeadline(time.Now().Add(s.keepAlive))
+	}
+	return s.br.Read(p)
+}
+
+func (s *quicSocketTransport) Close() error {
+	s.stream.Close()
+	return s.sess.Close()
+}
+
+func (s *quicSocketTransport) Type() Type {
+	return QUIC
 }
 
+// StartTLS is a no-op, since QUIC connections are always secured
+// by its built-in TLS handshake.
 func (s *quicSocketTransport) StartTLS(cfg *tls.Config, asClient bool) {
 }
+
+func (s *quicSocketTransport) ChannelBindingBytes(mechanism ChannelBindingMechanism) []byte {
+	switch mechanism {
+	case TLSUnique:
+		st := s.sess.ConnectionState()
+		return st.TLSUnique
+	default:
+		break
+	}
+	return nil
+}
+
+func (s *quicSocketTransport) PeerCertificates() []*x509.Certificate {
+	st := s.sess.ConnectionState()
+	return st.PeerCertificates
+}
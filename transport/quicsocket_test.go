@@ -0,0 +1,74 @@
+/*
+ * Copyright (c) 2018 Miguel Ángel Ortuño.
+ * See the LICENSE file for more information.
+ */
+
+package transport
+
+import (
+	"bytes"
+	"crypto/tls"
+	"crypto/x509"
+	"testing"
+	"time"
+
+	"github.com/lucas-clemente/quic-go"
+	"github.com/ortuman/jackal/xmpp"
+	"github.com/stretchr/testify/require"
+)
+
+type fakeQUICStream struct {
+	quic.Stream
+	r      *bytes.Buffer
+	w      *bytes.Buffer
+	closed bool
+}
+
+func (s *fakeQUICStream) Read(b []byte) (n int, err error)  { return s.r.Read(b) }
+func (s *fakeQUICStream) Write(b []byte) (n int, err error) { return s.w.Write(b) }
+func (s *fakeQUICStream) Close() error                      { s.closed = true; return nil }
+func (s *fakeQUICStream) SetReadDeadline(t time.Time) error { return nil }
+
+type fakeQUICSession struct {
+	quic.Session
+	state  tls.ConnectionState
+	closed bool
+}
+
+func (s *fakeQUICSession) Close() error                         { s.closed = true; return nil }
+func (s *fakeQUICSession) ConnectionState() tls.ConnectionState { return s.state }
+
+func TestQUICSocket(t *testing.T) {
+	buff := make([]byte, 4096)
+	stm := &fakeQUICStream{r: new(bytes.Buffer), w: new(bytes.Buffer)}
+	cert := &x509.Certificate{}
+	sess := &fakeQUICSession{
+		state: tls.ConnectionState{
+			TLSUnique:        []byte("tls-unique"),
+			PeerCertificates: []*x509.Certificate{cert},
+		},
+	}
+	st := NewQUICSocketTransport(sess, stm, time.Second)
+	require.Equal(t, QUIC, st.Type())
+
+	el1 := xmpp.NewElementNamespace("elem", "exodus:ns")
+	el1.ToXML(st, true)
+	_ = st.Flush()
+	require.Equal(t, el1.String(), stm.w.String())
+
+	el2 := xmpp.NewElementNamespace("elem2", "exodus2:ns")
+	el2.ToXML(stm.r, true)
+	n, err := st.Read(buff)
+	require.Nil(t, err)
+	require.Equal(t, el2.String(), string(buff[:n]))
+
+	// connection is already secured...
+	st.StartTLS(&tls.Config{}, false)
+	require.Equal(t, []byte("tls-unique"), st.ChannelBindingBytes(TLSUnique))
+	require.Nil(t, st.ChannelBindingBytes(ChannelBindingMechanism(99)))
+	require.Equal(t, []*x509.Certificate{cert}, st.PeerCertificates())
+
+	st.Close()
+	require.True(t, stm.closed)
+	require.True(t, sess.closed)
+}
@@ -22,6 +22,12 @@ const (
 
 	// WebSocket represents a websocket transport type.
 	WebSocket
+
+	// BOSH represents a BOSH (XEP-0124) transport type.
+	BOSH
+
+	// QUIC represents a QUIC transport type.
+	QUIC
 )
 
 // String returns TransportType string representation.
@@ -31,6 +37,10 @@ func (tt Type) String() string {
 		return "socket"
 	case WebSocket:
 		return "websocket"
+	case BOSH:
+		return "bosh"
+	case QUIC:
+		return "quic"
 	}
 	return ""
 }
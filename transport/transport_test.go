@@ -13,5 +13,7 @@ import (
 
 func TestTypeStrings(t *testing.T) {
 	require.Equal(t, "socket", Socket.String())
+	require.Equal(t, "bosh", BOSH.String())
+	require.Equal(t, "quic", QUIC.String())
 	require.Equal(t, "", Type(99).String())
 }
@@ -11,8 +11,10 @@ import (
 	"crypto/tls"
 	"crypto/x509"
 	"crypto/x509/pkix"
+	"encoding/asn1"
 	"encoding/pem"
 	"fmt"
+	"io/ioutil"
 	"math/big"
 	"os"
 	"time"
@@ -20,6 +22,11 @@ import (
 
 const localhostDomain = "localhost"
 
+var (
+	oidSubjectAltName = asn1.ObjectIdentifier{2, 5, 29, 17}
+	oidXMPPAddr       = asn1.ObjectIdentifier{1, 3, 6, 1, 5, 5, 7, 8, 5}
+)
+
 const (
 	selfSignedCertKeyRSABits = 2048
 	selfSignedCertFolder     = "./.cert/"
@@ -54,6 +61,55 @@ func LoadCertificate(keyFile, certFile, domain string) (tls.Certificate, error)
 	return cer, nil
 }
 
+// LoadCertPool loads a certificate pool from a PEM encoded CA bundle file.
+func LoadCertPool(caFile string) (*x509.CertPool, error) {
+	b, err := ioutil.ReadFile(caFile)
+	if err != nil {
+		return nil, err
+	}
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(b) {
+		return nil, fmt.Errorf("no valid certificates found in CA bundle '%s'", caFile)
+	}
+	return pool, nil
+}
+
+// XMPPAddresses returns all id-on-xmppAddr identities (RFC 6120, section 13.7.1.4)
+// found within the certificate subject alternative name extension.
+func XMPPAddresses(cert *x509.Certificate) []string {
+	var ret []string
+	for _, ext := range cert.Extensions {
+		if !ext.Id.Equal(oidSubjectAltName) {
+			continue
+		}
+		var names []asn1.RawValue
+		if _, err := asn1.Unmarshal(ext.Value, &names); err != nil {
+			return nil
+		}
+		for _, name := range names {
+			// otherName [0]
+			if name.Class != asn1.ClassContextSpecific || name.Tag != 0 {
+				continue
+			}
+			var typeID asn1.ObjectIdentifier
+			rest, err := asn1.Unmarshal(name.Bytes, &typeID)
+			if err != nil || !typeID.Equal(oidXMPPAddr) {
+				continue
+			}
+			var value asn1.RawValue
+			if _, err := asn1.Unmarshal(rest, &value); err != nil {
+				continue
+			}
+			var addr string
+			if _, err := asn1.UnmarshalWithParams(value.Bytes, &addr, "utf8"); err != nil {
+				continue
+			}
+			ret = append(ret, addr)
+		}
+	}
+	return ret
+}
+
 func generateSelfSignedCertificate(keyFile, certFile, domain string) error {
 	if err := os.MkdirAll(selfSignedCertFolder, os.ModePerm); err != nil {
 		return err
@@ -6,9 +6,17 @@
 package util
 
 import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
 	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"math/big"
 	"os"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/require"
 )
@@ -33,3 +41,47 @@ func TestLoadCertificate(t *testing.T) {
 		require.Equal(t, "must specify a private key and a server certificate for the domain 'jackal.im'", err.Error())
 	})
 }
+
+func TestLoadCertPool(t *testing.T) {
+	pool, err := LoadCertPool("../testdata/cert/test.server.crt")
+	require.Nil(t, err)
+	require.Len(t, pool.Subjects(), 1)
+
+	_, err = LoadCertPool("../testdata/cert/test.server.key")
+	require.NotNil(t, err)
+
+	_, err = LoadCertPool("../testdata/cert/unknown.crt")
+	require.NotNil(t, err)
+}
+
+func TestXMPPAddresses(t *testing.T) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.Nil(t, err)
+
+	// otherName [0] { id-on-xmppAddr, [0] EXPLICIT UTF8String }
+	value, _ := asn1.MarshalWithParams("jackal.im", "utf8")
+	typeID, _ := asn1.Marshal(oidXMPPAddr)
+	explicitValue, _ := asn1.Marshal(asn1.RawValue{Class: asn1.ClassContextSpecific, Tag: 0, IsCompound: true, Bytes: value})
+	otherName := append(typeID, explicitValue...)
+	san, err := asn1.Marshal([]asn1.RawValue{
+		{Class: asn1.ClassContextSpecific, Tag: 0, IsCompound: true, Bytes: otherName},
+		{Class: asn1.ClassContextSpecific, Tag: 2, Bytes: []byte("jackal.im")}, // dNSName
+	})
+	require.Nil(t, err)
+
+	tmpl := &x509.Certificate{
+		SerialNumber:    big.NewInt(1),
+		NotBefore:       time.Now(),
+		NotAfter:        time.Now().Add(time.Hour),
+		ExtraExtensions: []pkix.Extension{{Id: oidSubjectAltName, Value: san}},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	require.Nil(t, err)
+	cert, err := x509.ParseCertificate(der)
+	require.Nil(t, err)
+
+	require.Equal(t, []string{"jackal.im"}, XMPPAddresses(cert))
+	require.Equal(t, []string{"jackal.im"}, cert.DNSNames)
+
+	require.Nil(t, XMPPAddresses(&x509.Certificate{}))
+}